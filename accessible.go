@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// Line positions of the large-text layout: a banner across the top and two
+// lines of content below it, all in the largest font
+const (
+	largeLine1 = 40
+	largeLine2 = 62
+)
+
+// layout is a complete set of screen renderers. render draws every screen
+// through the active layout, so an alternate presentation is a layout of
+// its own rather than conditionals inside each renderer. Input handling is
+// shared, so every screen works the same whichever layout draws it.
+type layout struct {
+	statusBar func()
+	menu      func(title string, items []menuItem)
+	screens   map[AppState]func()
+}
+
+// largeText selects the high-contrast large-text layout
+var largeText = false
+
+// standardLayout is the detailed layout drawn in the small fonts
+var standardLayout = layout{
+	statusBar: renderStatusBar,
+	menu:      renderMenu,
+	screens: map[AppState]func(){
+		StateIdle:             renderIdleScreen,
+		StateRecording:        renderRecordingScreen,
+		StateStarting:         renderStarting,
+		StateCopying:          renderCopyProgress,
+		StateNetworkInfo:      renderNetworkInfo,
+		StateConfirm:          renderConfirmDialog,
+		StateRecordingSummary: renderRecordingSummary,
+		StateFileDetails:      renderFileDetails,
+		StatePreflight:        renderPreflight,
+		StateNoteEditor:       renderNoteEditor,
+		StateAbout:            renderAbout,
+		StatePlayback:         renderPlayback,
+		StateCopySummary:      renderCopySummary,
+		StateError:            renderErrorScreen,
+	},
+}
+
+// largeLayout shows one thing at a time in the largest font, with status
+// in a full-width banner instead of status bar icons
+var largeLayout = layout{
+	statusBar: renderLargeBanner,
+	menu:      renderLargeMenu,
+	screens: map[AppState]func(){
+		StateIdle:             renderLargeIdle,
+		StateRecording:        renderLargeRecording,
+		StateStarting:         renderLargeStarting,
+		StateCopying:          renderLargeCopyProgress,
+		StateNetworkInfo:      renderLargeNetworkInfo,
+		StateConfirm:          renderLargeConfirm,
+		StateRecordingSummary: renderLargeSummary,
+		StateFileDetails:      renderLargeFileDetails,
+		StatePreflight:        renderLargePreflight,
+		StateNoteEditor:       renderLargeNoteEditor,
+		StateAbout:            renderLargeAbout,
+		StatePlayback:         renderLargePlayback,
+		StateCopySummary:      renderLargeCopySummary,
+		StateError:            renderLargeError,
+	},
+}
+
+// activeLayout returns the layout selected in settings. Must be called with
+// mutex held.
+func activeLayout() layout {
+	if largeText {
+		return largeLayout
+	}
+	return standardLayout
+}
+
+// largeTextText shows whether the large-text layout is on
+func largeTextText() string {
+	if largeText {
+		return i18n.T("common.on")
+	}
+	return i18n.T("common.off")
+}
+
+// toggleLargeText switches between the standard and large-text layouts
+func toggleLargeText() {
+	largeText = !largeText
+}
+
+// drawLargeLines draws the two content lines of the large-text layout.
+// Either may be empty.
+func drawLargeLines(line1, line2 string) {
+	if line1 != "" {
+		hwManager.DrawCenteredText(line1, "emphasis", largeLine1)
+	}
+	if line2 != "" {
+		hwManager.DrawCenteredText(line2, "large", largeLine2)
+	}
+}
+
+// itemOf narrates the position of the one visible entry of a list
+func itemOf(index, count int) string {
+	return i18n.Tf("large.item_of", index+1, count)
+}
+
+// clampScroll keeps menuScrollOffset on one of count single-line entries
+func clampScroll(count int) {
+	if menuScrollOffset > count-1 {
+		menuScrollOffset = count - 1
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
+}
+
+// largeBannerText is the banner of the large-text layout: the take while
+// recording, otherwise the title of the screen, or the format and USB state
+// on the idle screen
+func largeBannerText() string {
+	if isRecording {
+		return i18n.Tf("rec.elapsed", formatDuration(time.Since(recordStart)))
+	}
+	if screen, ok := menuScreens[currentState]; ok {
+		return screen.title()
+	}
+
+	switch currentState {
+	case StateStarting:
+		return i18n.T("rec.starting")
+	case StateCopying:
+		return copyTitle()
+	case StateCopySummary:
+		return i18n.T("copy.summary_title")
+	case StateError:
+		if shownError != nil {
+			return i18n.Tf("error.title", shownError.kind.code)
+		}
+	case StateNetworkInfo:
+		return i18n.T("network.title")
+	case StateConfirm:
+		title, _, _ := confirmText()
+		return title
+	case StateRecordingSummary:
+		return i18n.T("summary.title")
+	case StateFileDetails:
+		return filepath.Base(detailsFile)
+	case StatePlayback:
+		if player != nil {
+			return player.take
+		}
+	case StatePreflight:
+		return preflightTitle()
+	case StateNoteEditor:
+		return noteTitle()
+	case StateAbout:
+		return i18n.T("about.title")
+	}
+
+	usb := i18n.T("large.no_usb")
+	if usbMounted {
+		usb = i18n.T("large.usb")
+	}
+	return fmt.Sprintf("%dkHz %dch  %s", sampleRates[sampleRateIdx]/1000, channelCount, usb)
+}
+
+func renderLargeBanner() {
+	text := largeBannerText()
+	if demoMode {
+		text = "DEMO  " + text
+	}
+	if hwManager.FontMissing() {
+		text = i18n.T("status.font_missing") + "  " + text
+	}
+	if safeMode {
+		text = i18n.T("status.safe_mode") + "  " + text
+	}
+	if len(degradedStorage()) > 0 {
+		text = i18n.T("status.storage_degraded") + "  " + text
+	}
+	if r := powerReading(); r != nil {
+		text += fmt.Sprintf("  %d%%", r.Percent)
+	}
+	hwManager.DrawHeaderBanner(text)
+}
+
+func renderLargeIdle() {
+	drawLargeLines(i18n.T("idle.standby"), idlePanelText())
+}
+
+func renderLargeRecording() {
+	target := ""
+	if recorder != nil {
+		target = recorder.CurrentTarget().Name
+		if text := migrateStatusText(); text != "" {
+			target = text
+		}
+	}
+	if monitor != nil && monitorMuted {
+		target += "  " + i18n.T("monitor.muted")
+	}
+	drawLargeLines(i18n.Tf("large.left", formatDuration(estimateRemainingTime())), strings.TrimSpace(target))
+}
+
+// renderLargeMenu shows only the selected item, with its position in the list
+func renderLargeMenu(title string, items []menuItem) {
+	if len(items) == 0 {
+		return
+	}
+	if selectedMenu >= len(items) {
+		selectedMenu = len(items) - 1
+	}
+
+	item := items[selectedMenu]
+	text := item.Label
+	if item.Value != nil {
+		if editingValue {
+			text = "‹" + item.Value() + "›"
+		} else {
+			text += " " + item.Value()
+		}
+	}
+	// An unavailable item says why in place of its position
+	line2 := itemOf(selectedMenu, len(items))
+	if item.Disabled {
+		line2 = item.Reason
+	}
+	drawLargeLines(text, line2)
+}
+
+func renderLargeCopyProgress() {
+	if spanWaiting {
+		drawLargeLines(spanPromptText(), i18n.T("copy.hold_cancel"))
+		return
+	}
+	drawLargeLines(fmt.Sprintf("%d%%", copyProgress), i18n.T("copy.hold_cancel"))
+}
+
+func renderLargeNetworkInfo() {
+	details := networkInfoLines()
+	if len(details) == 0 {
+		return
+	}
+	clampScroll(len(details))
+	drawLargeLines(details[menuScrollOffset], itemOf(menuScrollOffset, len(details)))
+}
+
+func renderLargeConfirm() {
+	_, message, _ := confirmText()
+	yes, no := i18n.T("common.yes"), "‹"+i18n.T("common.no")+"›"
+	if confirmOption == ConfirmYes {
+		yes, no = "‹"+i18n.T("common.yes")+"›", i18n.T("common.no")
+	}
+	drawLargeLines(message, yes+"   "+no)
+}
+
+func renderLargeSummary() {
+	duration := ""
+	if lastTake != nil {
+		duration = formatDuration(time.Duration(lastTake.DurationSeconds * float64(time.Second)))
+	}
+	drawLargeLines(duration, summaryOptionText(i18n.T("common.click_continue")))
+}
+
+func renderLargeFileDetails() {
+	text := i18n.T("details.unreadable")
+	if detailsInfo != nil {
+		text = formatDuration(detailsInfo.Duration())
+	}
+	drawLargeLines(text, detailsOptionText(i18n.T("common.click_return")))
+}
+
+// renderLargePreflight shows one check at a time, scrolled with the encoder
+func renderLargePreflight() {
+	if preflight == nil {
+		return
+	}
+	results := preflight.Results()
+	if len(results) == 0 {
+		return
+	}
+	clampScroll(len(results))
+	r := results[menuScrollOffset]
+	drawLargeLines(i18n.T("preflight.state_"+r.State.String())+" "+i18n.T("preflight.check."+r.ID), itemOf(menuScrollOffset, len(results)))
+}
+
+// renderLargeNoteEditor shows the note around the cursor and the selected
+// entry with one neighbour either side
+func renderLargeNoteEditor() {
+	hwManager.SwitchToContext("emphasis")
+	drawLargeLines(noteLine(DisplayWidth-8), noteStrip(1, DisplayWidth-8))
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	// archiveReadme and archiveManifest are written at the top of every
+	// archive, with the take list
+	archiveReadme   = "README.txt"
+	archiveTakeList = "takes.csv"
+	archiveManifest = "manifest.sha256"
+
+	// archiveEntryOverhead allows for the tar header of each entry and the
+	// generated files when checking for space
+	archiveEntryOverhead = 1024
+	// fatMaxFileSize is the largest file a FAT drive can hold
+	fatMaxFileSize = 1<<32 - 1
+)
+
+// isArchiving is set while the copy in progress is a session archive
+var isArchiving = false
+
+// archiveEntry is one file in an archive, streamed from a source file or
+// generated
+type archiveEntry struct {
+	name string // Within the archive's top folder
+	src  string // Empty for generated entries
+	data []byte
+	size int64
+	mod  time.Time
+}
+
+// archiveSink is where an archive is written: a single tar file or a
+// directory tree
+type archiveSink interface {
+	// create starts an entry, returning where its content goes
+	create(e archiveEntry) (io.Writer, error)
+	// endEntry finishes the entry started last
+	endEntry() error
+	close() error
+	// readBack reads each entry back from the drive, in order
+	readBack(fn func(name string, r io.Reader) error) error
+	// written returns the name an entry was given on the drive
+	written(name string) string
+	remove()
+	path() string
+}
+
+// tarSink writes an uncompressed tar with every entry under a top folder
+type tarSink struct {
+	file string
+	root string
+	f    *os.File
+	tw   *tar.Writer
+}
+
+func newTarSink(file, root string) (*tarSink, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &tarSink{file: file, root: root, f: f, tw: tar.NewWriter(f)}, nil
+}
+
+func (s *tarSink) create(e archiveEntry) (io.Writer, error) {
+	err := s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     s.root + "/" + e.name,
+		Mode:     0644,
+		Size:     e.size,
+		ModTime:  e.mod,
+	})
+	return s.tw, err
+}
+
+func (s *tarSink) endEntry() error { return nil }
+
+func (s *tarSink) close() error {
+	err := s.tw.Close()
+	if serr := s.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *tarSink) readBack(fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(strings.TrimPrefix(hdr.Name, s.root+"/"), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *tarSink) written(name string) string { return name }
+func (s *tarSink) remove()                    { os.Remove(s.file) }
+func (s *tarSink) path() string               { return s.file }
+
+// dirSink writes each entry as a file in a folder, named as the drive needs
+type dirSink struct {
+	dir   string
+	plan  *namePlan
+	names []string // Entry names in order
+	dst   map[string]string
+	cur   *os.File
+}
+
+func newDirSink(dir string) (*dirSink, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirSink{dir: dir, plan: newNamePlan(filepath.Dir(dir)), dst: make(map[string]string)}, nil
+}
+
+func (s *dirSink) create(e archiveEntry) (io.Writer, error) {
+	dst := filepath.Join(s.dir, s.plan.name(e.name))
+	f, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	s.names = append(s.names, e.name)
+	s.dst[e.name] = dst
+	s.cur = f
+	return f, nil
+}
+
+func (s *dirSink) endEntry() error {
+	err := s.cur.Sync()
+	if cerr := s.cur.Close(); err == nil {
+		err = cerr
+	}
+	s.cur = nil
+	return err
+}
+
+func (s *dirSink) close() error {
+	if s.cur != nil {
+		return s.endEntry()
+	}
+	return nil
+}
+
+func (s *dirSink) readBack(fn func(name string, r io.Reader) error) error {
+	for _, name := range s.names {
+		f, err := os.Open(s.dst[name])
+		if err != nil {
+			return err
+		}
+		err = fn(name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dirSink) written(name string) string { return filepath.Base(s.dst[name]) }
+func (s *dirSink) remove()                    { os.RemoveAll(s.dir) }
+func (s *dirSink) path() string               { return s.dir }
+
+// fileEntry adds a source file to entries, if it exists and is not already
+// in them
+func fileEntry(entries []archiveEntry, seen map[string]bool, name, src string) []archiveEntry {
+	info, err := os.Stat(src)
+	if err != nil || seen[name] {
+		return entries
+	}
+	seen[name] = true
+	return append(entries, archiveEntry{name: name, src: src, size: info.Size(), mod: info.ModTime()})
+}
+
+// dataEntry returns a generated entry
+func dataEntry(name string, data []byte) archiveEntry {
+	return archiveEntry{name: name, data: data, size: int64(len(data)), mod: time.Now()}
+}
+
+// planArchive lists what goes into the archive of a session: the README,
+// the take list, then each recording with its sidecar, notes and marker
+// lists. The manifest is added once the rest is written.
+func planArchive(g *copyGroup) ([]archiveEntry, []*TakeInfo) {
+	var entries []archiveEntry
+	var takes []*TakeInfo
+	seen := make(map[string]bool)
+	for _, file := range g.files {
+		entries = fileEntry(entries, seen, filepath.Base(file), file)
+		take, err := readTakeInfo(file)
+		if err != nil {
+			continue
+		}
+		if sidecar := sidecarPath(file); !seen[filepath.Base(sidecar)] {
+			takes = append(takes, take)
+			entries = fileEntry(entries, seen, filepath.Base(sidecar), sidecar)
+		}
+		entries = fileEntry(entries, seen, filepath.Base(takeNotePath(file)), takeNotePath(file))
+		entries = fileEntry(entries, seen, sessionNotesName, filepath.Join(filepath.Dir(file), sessionNotesName))
+
+		if markers := markersIn(take.Markers, filepath.Base(file)); len(markers) > 0 && take.SampleRate > 0 {
+			stem, _ := splitName(filepath.Base(file))
+			entries = append(entries,
+				dataEntry(stem+"_markers.txt", audacityLabels(markers, take.SampleRate)),
+				dataEntry(stem+"_markers.csv", reaperMarkers(markers, take.SampleRate)))
+		}
+	}
+	sort.Slice(takes, func(i, j int) bool { return takes[i].Start.Before(takes[j].Start) })
+
+	head := []archiveEntry{
+		dataEntry(archiveReadme, archiveReadmeText(g, takes, entries)),
+		dataEntry(archiveTakeList, archiveTakesCSV(takes)),
+	}
+	return append(head, entries...), takes
+}
+
+// archiveReadmeText summarizes the session for whoever receives the archive
+func archiveReadmeText(g *copyGroup, takes []*TakeInfo, entries []archiveEntry) []byte {
+	var b bytes.Buffer
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	var length time.Duration
+	for _, t := range takes {
+		length += time.Duration(t.DurationSeconds * float64(time.Second))
+	}
+
+	fmt.Fprintf(&b, "PI9696 session archive\n\n")
+	fmt.Fprintf(&b, "Session:   %s\n", g.name)
+	if name := unitName(); name != "" {
+		fmt.Fprintf(&b, "Unit:      %s\n", name)
+	}
+	fmt.Fprintf(&b, "Archived:  %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Takes:     %d, %s recorded\n", len(takes), formatDuration(length))
+	if len(takes) > 0 {
+		first, last := takes[0], takes[len(takes)-1]
+		end := last.Start.Add(time.Duration(last.DurationSeconds * float64(time.Second)))
+		fmt.Fprintf(&b, "Recorded:  %s to %s\n", first.Start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(&b, "Files:     %d, %s\n", len(entries)+3, formatSize(uint64(size)))
+
+	if len(takes) > 0 {
+		fmt.Fprintf(&b, "\nTakes:\n")
+		for _, t := range takes {
+			fmt.Fprintf(&b, "  %-24s %s  %s  %d Hz %d-bit %dch", t.Name, t.Start.Format("15:04:05"),
+				formatDuration(time.Duration(t.DurationSeconds*float64(time.Second))), t.SampleRate, t.BitsPerSample, t.Channels)
+			if t.StartTimecode != "" {
+				fmt.Fprintf(&b, "  TC %s", t.StartTimecode)
+			}
+			if len(t.Markers) > 0 {
+				fmt.Fprintf(&b, "  markers: %d", len(t.Markers))
+			}
+			fmt.Fprintln(&b)
+		}
+	}
+
+	fmt.Fprintf(&b, `
+Contents:
+  *.wav              Recordings, Broadcast WAV with iXML
+  *.json             Take details: format, timecode, markers, checksums
+  *.txt              Take notes; %s holds the session notes
+  *_markers.txt      Markers as Audacity labels
+  *_markers.csv      Markers as a Reaper marker list
+  %s          The take list
+  %s    SHA-256 of every other file. Check with:
+                       sha256sum -c %s
+`, sessionNotesName, archiveTakeList, archiveManifest, archiveManifest)
+	return b.Bytes()
+}
+
+// archiveTakesCSV lists the takes of a session, one per row
+func archiveTakesCSV(takes []*TakeInfo) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"name", "start", "duration_seconds", "sample_rate", "bits_per_sample", "channels", "start_timecode", "timecode_source", "markers", "files", "take_data_xxh64", "peak_seconds_per_bucket", "peaks_dbfs"})
+	for _, t := range takes {
+		files := make([]string, len(t.Files))
+		for i, f := range t.Files {
+			files[i] = filepath.Base(f)
+		}
+		// The level history in dBFS, silence at the meter floor
+		var bucket string
+		var peaks []string
+		if t.Peaks != nil {
+			bucket = strconv.Itoa(t.Peaks.SecondsPerBucket)
+			for _, p := range t.Peaks.Peaks {
+				db := levelFloorDB
+				if p > 0 {
+					db = max(20*math.Log10(p), levelFloorDB)
+				}
+				peaks = append(peaks, strconv.FormatFloat(db, 'f', 1, 64))
+			}
+		}
+		w.Write([]string{
+			t.Name,
+			t.Start.Format(time.RFC3339),
+			strconv.FormatFloat(t.DurationSeconds, 'f', 3, 64),
+			strconv.Itoa(t.SampleRate),
+			strconv.Itoa(t.BitsPerSample),
+			strconv.Itoa(t.Channels),
+			t.StartTimecode,
+			t.TimecodeSource,
+			strconv.Itoa(len(t.Markers)),
+			strings.Join(files, ";"),
+			t.TakeDataXXH64,
+			bucket,
+			strings.Join(peaks, ";"),
+		})
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// archiveSize returns the space an archive of entries needs
+func archiveSize(entries []archiveEntry) int64 {
+	size := int64(3 * archiveEntryOverhead)
+	for _, e := range entries {
+		size += e.size + archiveEntryOverhead
+	}
+	return size
+}
+
+// archivePath returns a name for a session's archive in dir that is not yet
+// taken, with ext added for a tar
+func archivePath(dir, session, ext string) string {
+	if fatFilesystem(dir) {
+		session = fatName(session)
+	}
+	path := filepath.Join(dir, session+ext)
+	for n := 2; fileExists(path); n++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", session, n, ext))
+	}
+	return path
+}
+
+// streamEntry copies the file src into w, like streamCopy
+func streamEntry(ctx context.Context, w io.Writer, src string, checkpoint func() error, progress func(n int)) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return streamCopy(ctx, w, f, checkpoint, progress)
+}
+
+// writeArchive writes a session to dir on the USB drive as a tar or a
+// folder, hashing each file as it goes and adding the hashes as the
+// manifest. Nothing is staged on the card. The archive is then read back
+// from the drive and checked against the hashes, and removed if it fails
+// or is cancelled. A failure is noted against the drive's health and filed
+// under the catalog entry for its cause.
+func writeArchive(ctx context.Context, g *copyGroup, dir string, asTar bool, checkpoint func() error, progress func(n int)) (string, error) {
+	entries, _ := planArchive(g)
+	var sink archiveSink
+	var err error
+	if asTar {
+		path := archivePath(dir, g.name, ".tar")
+		sink, err = newTarSink(path, strings.TrimSuffix(filepath.Base(path), ".tar"))
+	} else {
+		sink, err = newDirSink(archivePath(dir, g.name, ""))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sums := make(map[string]string)
+	var manifest bytes.Buffer
+	write := func(e archiveEntry) error {
+		w, err := sink.create(e)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		out := io.MultiWriter(wearWriter{w, sink.path()}, h)
+		if e.src != "" {
+			err = streamEntry(ctx, out, e.src, checkpoint, progress)
+		} else {
+			_, err = out.Write(e.data)
+			progress(len(e.data))
+		}
+		if err == nil {
+			err = sink.endEntry()
+		}
+		sums[e.name] = hex.EncodeToString(h.Sum(nil))
+		if e.name != archiveManifest {
+			fmt.Fprintf(&manifest, "%s  %s\n", sums[e.name], sink.written(e.name))
+		}
+		return err
+	}
+
+	for _, e := range entries {
+		if err = write(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = write(dataEntry(archiveManifest, manifest.Bytes()))
+	}
+	if cerr := sink.close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = sink.readBack(func(name string, r io.Reader) error {
+			h := sha256.New()
+			if err := streamCopy(ctx, h, r, checkpoint, progress); err != nil {
+				return err
+			}
+			if got := hex.EncodeToString(h.Sum(nil)); got != sums[name] {
+				return fmt.Errorf("%s does not match its hash on the drive", name)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		sink.remove()
+		if ctx.Err() != nil {
+			return "", err
+		}
+		noteWriteError(sink.path(), "archive", err)
+		if strings.HasPrefix(dir, USBMountPoint) {
+			return "", usbError(err)
+		}
+		return "", storageError(err)
+	}
+	return sink.path(), nil
+}
+
+// wearWriter counts what is written through it to path's write counter
+type wearWriter struct {
+	w    io.Writer
+	path string
+}
+
+func (w wearWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	countWritten(w.path, n)
+	return n, err
+}
+
+// streamCopy copies r into w a buffer at a time, paced by the background I/O
+// scheduler and stopping at checkpoints while a recording needs the storage
+func streamCopy(ctx context.Context, w io.Writer, r io.Reader, checkpoint func() error, progress func(n int)) error {
+	buf := make([]byte, copyBufferSize)
+	for {
+		if err := checkpoint(); err != nil {
+			return err
+		}
+		if err := backgroundIO.Wait(ctx, len(buf)); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			progress(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveSelected archives every session in the copy list with a file
+// selected, whole, to the USB drive. Must be called with mutex held.
+func archiveSelected() {
+	if !usbMounted {
+		showError(errNoUSB)
+		return
+	}
+	var groups []*copyGroup
+	var need int64
+	for _, g := range copyGroups {
+		if g.selectedCount() == 0 {
+			continue
+		}
+		groups = append(groups, g)
+		entries, _ := planArchive(g)
+		size := archiveSize(entries)
+		if config.Archive.Format == "tar" && size > fatMaxFileSize && fatFilesystem(USBMountPoint) {
+			showAlert(i18n.Tf("archive.too_big", g.name), 5*time.Second)
+			return
+		}
+		need += size
+	}
+	if len(groups) == 0 {
+		showAlert(i18n.T("archive.none"), 3*time.Second)
+		return
+	}
+	if free, _ := usbSpace(); uint64(need) > free {
+		showAlert(i18n.Tf("archive.no_space", formatSize(uint64(need)), formatSize(free)), 5*time.Second)
+		return
+	}
+	beginArchive(groups, need)
+}
+
+// beginArchive writes the archives of groups to the USB drive in the
+// background, through the copy screen. Each is written then read back, so
+// progress counts need twice. Must be called with mutex held.
+func beginArchive(groups []*copyGroup, need int64) {
+	currentState = StateCopying
+	isCopying, isArchiving = true, true
+	copyProgress = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	copyCancel = cancel
+	asTar := config.Archive.Format == "tar"
+
+	go func() {
+		defer cancel()
+		written, failed := 0, 0
+
+		lease, err := resources.Acquire(ctx, jobCopy, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 3*time.Second)
+		}, append(targetPaths(), USBMountPoint)...)
+		if err == nil {
+			defer lease.Release()
+			checkpoint := func() error {
+				return lease.Checkpoint(ctx, func() {
+					showAlert(i18n.Tf("resource.paused", jobCopy.Label()), 3*time.Second)
+				})
+			}
+			job := startBackgroundJob(jobCopy, 2*need)
+			defer job.Finish()
+			progress := func(n int) {
+				job.Add(int64(n))
+				mutex.Lock()
+				copyProgress = job.Percent()
+				mutex.Unlock()
+			}
+
+			for _, g := range groups {
+				path, err := writeArchive(ctx, g, USBMountPoint, asTar, checkpoint, progress)
+				if ctx.Err() != nil {
+					break
+				}
+				if err != nil {
+					reportError("Failed to archive "+g.name, err)
+					failed++
+					continue
+				}
+				log.Printf("Archived %s to %s", g.name, path)
+				written++
+			}
+		}
+
+		mutex.Lock()
+		isCopying, isArchiving = false, false
+		copyCancel = nil
+		if currentState == StateCopying {
+			currentState = StateIdle
+		}
+		switch {
+		case ctx.Err() != nil:
+		case failed > 0:
+			showAlert(i18n.Tf("archive.failed", failed, len(groups)), 5*time.Second)
+		default:
+			showAlert(i18n.Tf("archive.done", written), 5*time.Second)
+		}
+		mutex.Unlock()
+	}()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveTakesCSVHasLevelHistory(t *testing.T) {
+	takes := []*TakeInfo{
+		{Name: "take_0001", Peaks: &PeakHistory{SecondsPerBucket: 2, Peaks: []float64{1, 0.5, 0}}},
+		{Name: "take_0002"}, // From before the level history was kept
+	}
+	rows, err := csv.NewReader(bytes.NewReader(archiveTakesCSV(takes))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := make(map[string]int)
+	for i, name := range rows[0] {
+		column[name] = i
+	}
+	for _, tt := range []struct {
+		row           int
+		bucket, peaks string
+	}{
+		{1, "2", "0.0;-6.0;-120.0"},
+		{2, "", ""},
+	} {
+		row := rows[tt.row]
+		if got := row[column["peak_seconds_per_bucket"]]; got != tt.bucket {
+			t.Errorf("%s: %q seconds per bucket, want %q", row[0], got, tt.bucket)
+		}
+		if got := row[column["peaks_dbfs"]]; got != tt.peaks {
+			t.Errorf("%s: peaks %q, want %q", row[0], got, tt.peaks)
+		}
+	}
+}
+
+func TestArchiveCountsWhatReachesTheDrive(t *testing.T) {
+	rec, dst := t.TempDir(), t.TempDir()
+	useTargets(t, []*RecordTarget{{Name: "A", Path: rec}, {Name: "B", Path: dst}})
+	wearMutex.Lock()
+	saved := wear
+	wear = make(map[string]*wearCounter)
+	wearMutex.Unlock()
+	t.Cleanup(func() {
+		wearMutex.Lock()
+		wear = saved
+		wearMutex.Unlock()
+	})
+	written := func() uint64 {
+		wearMutex.Lock()
+		defer wearMutex.Unlock()
+		if c := wear["B"]; c != nil {
+			return c.BytesWritten
+		}
+		return 0
+	}
+
+	take := filepath.Join(rec, "take_0001.wav")
+	writeTestWAV(t, take)
+	g := &copyGroup{name: "Session", files: []string{take}}
+	path, err := writeArchive(context.Background(), g, dst, false, noCheckpoint, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size uint64
+	files, _ := os.ReadDir(path)
+	for _, f := range files {
+		info, _ := f.Info()
+		size += uint64(info.Size())
+	}
+	if got := written(); got != size {
+		t.Errorf("%d bytes counted for an archive of %d", got, size)
+	}
+
+	// A failed entry counts only what was written before it failed, and the
+	// failure is filed under the storage it was written to
+	unreadable := filepath.Join(rec, "take_0002.wav")
+	if err := os.Mkdir(unreadable, 0755); err != nil {
+		t.Fatal(err)
+	}
+	g.files = append(g.files, unreadable)
+	entries, _ := planArchive(g)
+	var before uint64
+	for _, e := range entries {
+		if e.src == unreadable {
+			break
+		}
+		before += uint64(e.size)
+	}
+	_, err = writeArchive(context.Background(), g, dst, false, noCheckpoint, func(int) {})
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("failed archive reported as %v, want %s", err, errWriteFailed.code)
+	}
+	if got := written() - size; got != before {
+		t.Errorf("%d bytes counted for a failed archive, want the %d written", got, before)
+	}
+}
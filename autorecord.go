@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	// autoToken in the file prefix marks where AUTO_ goes in the names of
+	// takes started by auto-record
+	autoToken      = "{auto}"
+	autoFilePrefix = "AUTO_"
+
+	// levelFloorDB is reported for digital silence
+	levelFloorDB = -120.0
+	// levelStale is how long a level reading stays current. The input
+	// pipeline hands over between the monitor and the recorder at each
+	// take start and stop, and readings older than this are not acted on.
+	levelStale = 500 * time.Millisecond
+
+	// coarseLevelInterval and coarseFrameStride set how often a coarse
+	// meter measures and how many frames it steps over
+	coarseLevelInterval = 250 * time.Millisecond
+	coarseFrameStride   = 8
+)
+
+// levelMeter measures the peak level of the armed channels of each block.
+// It is a SampleTap for the input monitor and the recorder. Auto-record and
+// the idle signal indicator both read it.
+type levelMeter struct {
+	mutex    sync.Mutex
+	channels int
+	armed    []int // 0-based, nil for every channel
+	coarse   bool  // Measure a sample of blocks and frames only
+	level    float64
+	at       time.Time
+}
+
+// SetCoarse trades accuracy for CPU when only the signal indicator reads the
+// level: blocks are measured at most every coarseLevelInterval, on every
+// coarseFrameStride-th frame
+func (m *levelMeter) SetCoarse(coarse bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.coarse = coarse
+}
+
+// SetChannels selects the channels measured
+func (m *levelMeter) SetChannels(channels int, armed []int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.channels = channels
+	m.armed = armed
+}
+
+// Tap measures a block of interleaved S32LE frames
+func (m *levelMeter) Tap(block []byte, startFrame int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.channels == 0 {
+		return
+	}
+	step := 1
+	if m.coarse {
+		if time.Since(m.at) < coarseLevelInterval {
+			return
+		}
+		step = coarseFrameStride
+	}
+
+	frameSize := m.channels * BitsPerSample / 8
+	var peak int64
+	measure := func(sample []byte) {
+		v := int64(int32(binary.LittleEndian.Uint32(sample)))
+		if v < 0 {
+			v = -v
+		}
+		if v > peak {
+			peak = v
+		}
+	}
+	for off := 0; off+frameSize <= len(block); off += step * frameSize {
+		frame := block[off : off+frameSize]
+		if m.armed == nil {
+			for ch := 0; ch < m.channels; ch++ {
+				measure(frame[ch*4:])
+			}
+		} else {
+			for _, ch := range m.armed {
+				measure(frame[ch*4:])
+			}
+		}
+	}
+
+	m.level = levelFloorDB
+	if peak > 0 {
+		m.level = math.Max(20*math.Log10(float64(peak)/math.MaxInt32), levelFloorDB)
+	}
+	m.at = time.Now()
+}
+
+// Level returns the latest peak level in dBFS and whether it is current
+func (m *levelMeter) Level() (float64, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.level, !m.at.IsZero() && time.Since(m.at) <= levelStale
+}
+
+// autoAction is what the auto-record trigger asks for
+type autoAction int
+
+const (
+	autoNone autoAction = iota
+	autoStart
+	autoStop
+)
+
+// levelTrigger decides when auto-record starts and stops a take. The level
+// must stay at or above the threshold for startHold to start, and below it
+// for stopHold to stop, so short sounds and pauses do not flap the take.
+type levelTrigger struct {
+	threshold float64 // dBFS
+	startHold time.Duration
+	stopHold  time.Duration
+
+	aboveSince time.Time
+	belowSince time.Time
+}
+
+// Update takes a level reading and returns the action due, given whether an
+// auto take is running
+func (t *levelTrigger) Update(level float64, now time.Time, running bool) autoAction {
+	if level >= t.threshold {
+		t.belowSince = time.Time{}
+		if t.aboveSince.IsZero() {
+			t.aboveSince = now
+		}
+		if !running && now.Sub(t.aboveSince) >= t.startHold {
+			return autoStart
+		}
+	} else {
+		t.aboveSince = time.Time{}
+		if t.belowSince.IsZero() {
+			t.belowSince = now
+		}
+		if running && now.Sub(t.belowSince) >= t.stopHold {
+			return autoStop
+		}
+	}
+	return autoNone
+}
+
+// Reset forgets the current run of signal or silence
+func (t *levelTrigger) Reset() {
+	t.aboveSince = time.Time{}
+	t.belowSince = time.Time{}
+}
+
+var (
+	autoArmed      = false
+	autoTake       = false // The current take was started by auto-record
+	autoSuppressed = false // Stopped by hand; wait for silence before starting again
+
+	autoMeter   = &levelMeter{}
+	autoTrigger *levelTrigger
+)
+
+// initAutoRecord sets up auto-record from the config
+func initAutoRecord(cfg AutoRecordConfig) {
+	autoTrigger = &levelTrigger{
+		threshold: cfg.ThresholdDB,
+		startHold: time.Duration(cfg.StartHoldMs) * time.Millisecond,
+		stopHold:  time.Duration(cfg.StopHoldMs) * time.Millisecond,
+	}
+	autoArmed = cfg.Enabled
+}
+
+// updateAutoRecord starts and stops takes on the input level. Must be
+// called with mutex held.
+func updateAutoRecord() {
+	if !autoArmed {
+		return
+	}
+	autoMeter.SetChannels(channelCount, armedChannelIndexes())
+	level, live := autoMeter.Level()
+	if !live {
+		return
+	}
+
+	// After a manual stop, the trigger runs as if a take were going so that
+	// sustained silence clears the suppression
+	running := (isRecording && autoTake) || autoSuppressed
+	switch autoTrigger.Update(level, time.Now(), running) {
+	case autoStart:
+		if isRecording || (currentState != StateIdle && currentState != StateRecordingSummary) {
+			return
+		}
+		log.Printf("Auto-record: signal at %.0f dBFS, starting take", level)
+		autoTake = true
+		autoTake = startRecording() == nil
+	case autoStop:
+		if autoSuppressed {
+			autoSuppressed = false
+			return
+		}
+		log.Printf("Auto-record: silence, ending take")
+		stopRecording()
+	}
+}
+
+// toggleAutoRecord arms or disarms auto-record
+func toggleAutoRecord() {
+	autoArmed = !autoArmed
+	autoSuppressed = false
+	autoTrigger.Reset()
+}
+
+// autoRecordText formats the auto-record setting
+func autoRecordText() string {
+	if autoArmed {
+		return i18n.T("settings.chase_armed")
+	}
+	return i18n.T("common.off")
+}
+
+// autoIdleText is the idle screen line while auto-record is armed
+func autoIdleText() string {
+	level, live := autoMeter.Level()
+	if !live {
+		return i18n.T("idle.auto_listening")
+	}
+	return i18n.T("idle.auto_listening") + " " + i18n.Tf("idle.auto_level", level)
+}
+
+// expandAutoToken marks takes started by auto-record with AUTO_, in place of
+// {auto} in the prefix or else in front of it. Manual takes drop the token.
+func expandAutoToken(prefix string, auto bool) string {
+	mark := ""
+	if auto {
+		mark = autoFilePrefix
+		if !strings.Contains(prefix, autoToken) {
+			return mark + prefix
+		}
+	}
+	return strings.ReplaceAll(prefix, autoToken, mark)
+}
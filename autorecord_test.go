@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// levelRun is a stretch of constant input level
+type levelRun struct {
+	level float64
+	dur   time.Duration
+}
+
+// triggerEvents feeds runs of levels to a trigger with the default hold
+// times, a reading every 250ms, and returns the actions taken and when
+func triggerEvents(runs []levelRun) []string {
+	const step = 250 * time.Millisecond
+	trigger := &levelTrigger{threshold: -50, startHold: 2 * time.Second, stopHold: 30 * time.Second}
+	start := time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC)
+	var events []string
+	var at time.Duration
+	running := false
+	for _, run := range runs {
+		for end := at + run.dur; at < end; at += step {
+			switch trigger.Update(run.level, start.Add(at), running) {
+			case autoStart:
+				running = true
+				events = append(events, fmt.Sprintf("start %v", at))
+			case autoStop:
+				running = false
+				events = append(events, fmt.Sprintf("stop %v", at))
+			}
+		}
+	}
+	return events
+}
+
+func TestLevelTrigger(t *testing.T) {
+	const (
+		signal  = -20.0
+		silence = -70.0
+	)
+	tests := []struct {
+		name string
+		runs []levelRun
+		want []string
+	}{
+		{"silence", []levelRun{{silence, time.Minute}}, nil},
+		{"short sound", []levelRun{{silence, time.Second}, {signal, 1750 * time.Millisecond}, {silence, time.Minute}}, nil},
+		{"sustained signal", []levelRun{{silence, time.Second}, {signal, 5 * time.Second}},
+			[]string{"start 3s"}},
+		{"threshold counts as signal", []levelRun{{-50, 3 * time.Second}}, []string{"start 2s"}},
+		{"just below threshold", []levelRun{{-50.1, time.Minute}}, nil},
+		{"pauses keep the take", []levelRun{{signal, 10 * time.Second}, {silence, 29 * time.Second}, {signal, time.Second}, {silence, 29 * time.Second}, {signal, time.Second}},
+			[]string{"start 2s"}},
+		{"sustained silence ends it", []levelRun{{signal, 10 * time.Second}, {silence, time.Minute}},
+			[]string{"start 2s", "stop 40s"}},
+		{"flapping input", []levelRun{
+			{signal, time.Second}, {silence, time.Second}, {signal, time.Second}, {silence, time.Second},
+			{signal, 1750 * time.Millisecond}, {silence, time.Second},
+		}, nil},
+		{"next take after the silence", []levelRun{{signal, 5 * time.Second}, {silence, 35 * time.Second}, {signal, 5 * time.Second}},
+			[]string{"start 2s", "stop 35s", "start 42s"}},
+	}
+	for _, tt := range tests {
+		if got := triggerEvents(tt.runs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevelTriggerReset(t *testing.T) {
+	trigger := &levelTrigger{threshold: -50, startHold: 2 * time.Second, stopHold: 30 * time.Second}
+	now := time.Now()
+	trigger.Update(-20, now, false)
+	trigger.Reset()
+	// The signal before the reset does not count towards the hold
+	if got := trigger.Update(-20, now.Add(2*time.Second), false); got != autoNone {
+		t.Errorf("action %d straight after a reset", got)
+	}
+	if got := trigger.Update(-20, now.Add(4*time.Second), false); got != autoStart {
+		t.Errorf("action %d after the hold, want start", got)
+	}
+}
+
+// meterBlock returns a block of frames with every sample of channel ch at
+// value and the rest silent
+func meterBlock(frames, channels, ch int, value int32) []byte {
+	block := make([]byte, frames*channels*4)
+	for f := 0; f < frames; f++ {
+		binary.LittleEndian.PutUint32(block[(f*channels+ch)*4:], uint32(value))
+	}
+	return block
+}
+
+func TestLevelMeter(t *testing.T) {
+	half := int32(math.MaxInt32 / 2)
+	tests := []struct {
+		name  string
+		armed []int
+		ch    int
+		value int32
+		want  float64
+	}{
+		{"silence", nil, 0, 0, levelFloorDB},
+		{"half scale", nil, 3, half, -6.02},
+		{"negative peak", nil, 1, -half, -6.02},
+		{"full scale", nil, 0, math.MaxInt32, 0},
+		{"armed channel", []int{2}, 2, half, -6.02},
+		{"unarmed channel", []int{2}, 3, half, levelFloorDB},
+	}
+	for _, tt := range tests {
+		m := &levelMeter{}
+		if _, live := m.Level(); live {
+			t.Errorf("%s: live before any block", tt.name)
+		}
+		m.SetChannels(4, tt.armed)
+		m.Tap(meterBlock(64, 4, tt.ch, tt.value), 0)
+		level, live := m.Level()
+		if !live || math.Abs(level-tt.want) > 0.01 {
+			t.Errorf("%s: level %.2f (live %t), want %.2f", tt.name, level, live, tt.want)
+		}
+	}
+}
+
+func TestExpandAutoToken(t *testing.T) {
+	tests := []struct {
+		prefix string
+		auto   bool
+		want   string
+	}{
+		{"take", false, "take"},
+		{"take", true, "AUTO_take"},
+		{"lecture_{auto}", true, "lecture_AUTO_"},
+		{"lecture_{auto}", false, "lecture_"},
+		{"{auto}{auto}", true, "AUTO_AUTO_"},
+	}
+	for _, tt := range tests {
+		if got := expandAutoToken(tt.prefix, tt.auto); got != tt.want {
+			t.Errorf("expandAutoToken(%q, %t) = %q, want %q", tt.prefix, tt.auto, got, tt.want)
+		}
+	}
+}
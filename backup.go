@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	backupDirName   = "pi9696-backup"
+	backupQueue     = 32 // Blocks buffered for the chunk writer before new ones are dropped
+	backupChunkGlob = "chunk_*.wav"
+	backupChunkName = "chunk_%012d.wav" // Numbered by the take frame the chunk starts at
+	backupSuffix    = "_backup.wav"
+)
+
+// backupBlock is a block of file frames and where it starts in the take
+type backupBlock struct {
+	data  []byte
+	frame int64
+}
+
+// BackupWriter mirrors a take into short chunk files on a second target and
+// deletes chunks older than the backup window, so the last stretch of every
+// take survives the loss of its main file. It is fed from a recorder tap and
+// always gives way to the main writer: blocks are dropped rather than held,
+// and a drop starts a new chunk so every chunk stays sample-continuous.
+type BackupWriter struct {
+	r           *Recorder
+	dir         string
+	chunkFrames int64
+	window      time.Duration
+
+	queue   chan backupBlock
+	done    chan struct{}
+	dropped atomic.Int64
+
+	chunk      *wavWriter
+	chunkStart int64
+	nextFrame  int64
+	failed     bool
+}
+
+var backup *BackupWriter
+
+// backupRoot returns the backup folder of the configured backup target
+func backupRoot() string {
+	return filepath.Join(config.Backup.Path, backupDirName)
+}
+
+// newBackupWriter starts mirroring a take into dir
+func newBackupWriter(r *Recorder, dir string, chunk, window time.Duration) (*BackupWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &BackupWriter{
+		r:           r,
+		dir:         dir,
+		chunkFrames: int64(chunk.Seconds() * float64(r.sampleRate)),
+		window:      window,
+		queue:       make(chan backupBlock, backupQueue),
+		done:        make(chan struct{}),
+	}
+	go b.run()
+	return b, nil
+}
+
+// Tap copies the take's channels out of a block and queues them, dropping
+// the block if the chunk writer has fallen behind. It is a SampleTap.
+func (b *BackupWriter) Tap(block []byte, startFrame int64) {
+	var data []byte
+	if b.r.armed == nil {
+		data = append([]byte(nil), block...)
+	} else {
+		frames := len(block) / b.r.frameSize()
+		data = b.r.pack(block, make([]byte, frames*b.r.fileFrameSize()))
+	}
+
+	select {
+	case b.queue <- backupBlock{data: data, frame: startFrame}:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (b *BackupWriter) run() {
+	defer close(b.done)
+	frameSize := int64(b.r.fileFrameSize())
+
+	for block := range b.queue {
+		if b.failed {
+			continue
+		}
+		frame, data := block.frame, block.data
+		for len(data) > 0 {
+			if b.chunk == nil || frame != b.nextFrame || frame-b.chunkStart >= b.chunkFrames {
+				if err := b.rotate(frame); err != nil {
+					log.Printf("Backup stopped: %v", err)
+					b.failed = true
+					break
+				}
+			}
+
+			// Split blocks that cross a chunk boundary
+			n := int64(len(data)) / frameSize
+			if room := b.chunkFrames - (frame - b.chunkStart); n > room {
+				n = room
+			}
+			if _, err := b.chunk.Write(data[:n*frameSize]); err != nil {
+				log.Printf("Backup stopped: %v", err)
+				b.chunk.Close()
+				b.chunk = nil
+				b.failed = true
+				break
+			}
+			data = data[n*frameSize:]
+			frame += n
+			b.nextFrame = frame
+		}
+	}
+
+	if b.chunk != nil {
+		if err := b.chunk.Close(); err != nil {
+			log.Printf("Failed to close backup chunk: %v", err)
+		}
+	}
+	b.prune()
+}
+
+// rotate closes the current chunk and starts the next one at frame
+func (b *BackupWriter) rotate(frame int64) error {
+	if b.chunk != nil {
+		if err := b.chunk.Close(); err != nil {
+			log.Printf("Failed to close backup chunk: %v", err)
+		}
+		b.chunk = nil
+		b.prune()
+	}
+
+	path := filepath.Join(b.dir, fmt.Sprintf(backupChunkName, frame))
+	w, err := createWAV(path, b.r.sampleRate, b.r.fileChannels(), BitsPerSample)
+	if err != nil {
+		return err
+	}
+	ref, _ := b.r.TimeReference()
+	w.bext.Description = b.r.baseName + " backup"
+	w.bext.Originator = bextOriginator()
+	w.bext.TimeReference = ref + uint64(frame)
+	b.chunk = w
+	b.chunkStart = frame
+	b.nextFrame = frame
+	return nil
+}
+
+// prune deletes chunks of every take that finished before the window
+func (b *BackupWriter) prune() {
+	chunks, _ := filepath.Glob(filepath.Join(filepath.Dir(b.dir), "*", backupChunkGlob))
+	cutoff := time.Now().Add(-b.window)
+	for _, chunk := range chunks {
+		info, err := os.Stat(chunk)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(chunk); err != nil {
+			log.Printf("Failed to delete old backup chunk: %v", err)
+			continue
+		}
+		os.Remove(filepath.Dir(chunk)) // Only succeeds once the take folder is empty
+	}
+}
+
+// Stop writes out queued blocks and closes the last chunk
+func (b *BackupWriter) Stop() {
+	close(b.queue)
+	<-b.done
+	if n := b.dropped.Load(); n > 0 {
+		log.Printf("Backup dropped %d blocks to keep up with the main writer", n)
+	}
+}
+
+// startBackup mirrors a starting take to the backup target, if one is
+// configured. Must be called with mutex held.
+func startBackup(r *Recorder) {
+	if config.Backup.Path == "" {
+		return
+	}
+	dir := filepath.Join(backupRoot(), r.baseName)
+	b, err := newBackupWriter(r, dir,
+		time.Duration(config.Backup.ChunkSeconds)*time.Second,
+		time.Duration(config.Backup.WindowMinutes)*time.Minute)
+	if err != nil {
+		setLastError("Backup unavailable on %s: %v", config.Backup.Path, err)
+		return
+	}
+	r.AddTap(b.Tap)
+	backup = b
+}
+
+// stopBackup closes the backup of the take. Must be called with mutex held.
+func stopBackup() {
+	if backup != nil {
+		backup.Stop()
+		backup = nil
+	}
+}
+
+// backupChunk is a chunk file and the take frame it starts at
+type backupChunk struct {
+	path  string
+	start int64
+}
+
+// backupChunks lists the chunks in dir in take order
+func backupChunks(dir string) []backupChunk {
+	paths, _ := filepath.Glob(filepath.Join(dir, backupChunkGlob))
+	var chunks []backupChunk
+	for _, path := range paths {
+		var start int64
+		if _, err := fmt.Sscanf(filepath.Base(path), backupChunkName, &start); err == nil {
+			chunks = append(chunks, backupChunk{path: path, start: start})
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].start < chunks[j].start })
+	return chunks
+}
+
+// reassembleBackup joins the chunks in dir into one WAV file at out. Gaps
+// left by dropped blocks are filled with silence so the file keeps the
+// take's timing.
+func reassembleBackup(dir, out string) error {
+	chunks := backupChunks(dir)
+	if len(chunks) == 0 {
+		return fmt.Errorf("no backup chunks in %s", dir)
+	}
+	first, err := readWAVInfo(chunks[0].path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(chunks[0].path), err)
+	}
+
+	w, err := createWAV(out, first.SampleRate, first.Channels, first.Bits)
+	if err != nil {
+		return err
+	}
+	w.bext.Description = strings.TrimSuffix(filepath.Base(out), ".wav")
+	w.bext.Originator = bextOriginator()
+	w.bext.TimeReference = first.TimeReference
+
+	frameSize := int64(first.Channels * first.Bits / 8)
+	next := chunks[0].start
+	for _, chunk := range chunks {
+		if err := appendChunk(w, chunk, &next, frameSize); err != nil {
+			w.Close()
+			os.Remove(out)
+			return fmt.Errorf("%s: %v", filepath.Base(chunk.path), err)
+		}
+	}
+	return w.Close()
+}
+
+// appendChunk adds a chunk's samples to w from frame *next on, padding a gap
+// before it with silence and skipping frames already written
+func appendChunk(w *wavWriter, chunk backupChunk, next *int64, frameSize int64) error {
+	info, err := readWAVInfo(chunk.path)
+	if err != nil {
+		return err
+	}
+	if int64(info.Channels*info.Bits/8) != frameSize {
+		return fmt.Errorf("format differs from the first chunk")
+	}
+
+	if chunk.start > *next {
+		if _, err := w.Write(make([]byte, (chunk.start-*next)*frameSize)); err != nil {
+			return err
+		}
+		*next = chunk.start
+	}
+
+	skip := (*next - chunk.start) * frameSize
+	if info.DataBytes <= skip {
+		return nil
+	}
+	f, err := os.Open(chunk.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(wavHeaderSize+skip, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.CopyN(w, f, info.DataBytes-skip)
+	*next += n / frameSize
+	return err
+}
+
+// latestBackup returns the folder of the most recently written backup
+func latestBackup() (string, error) {
+	dirs, err := filepath.Glob(filepath.Join(backupRoot(), "*", backupChunkGlob))
+	if err != nil || len(dirs) == 0 {
+		return "", fmt.Errorf("no backup on %s", config.Backup.Path)
+	}
+	var latest string
+	var latestTime time.Time
+	for _, chunk := range dirs {
+		if info, err := os.Stat(chunk); err == nil && info.ModTime().After(latestTime) {
+			latest, latestTime = filepath.Dir(chunk), info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// backupMenuItem is the Reassemble Backup item of the system options, which
+// needs a backup target and no take in progress. Must be called with mutex
+// held.
+func backupMenuItem() menuItem {
+	item := menuItem{ID: "reassemble_backup", Label: i18n.T("system.reassemble_backup"), Action: reassembleLatestBackup}
+	return item.disableFor(reasonIf(config.Backup.Path == "", "backup.off"), reasonIf(isRecording, "reason.recording"))
+}
+
+// reassembleLatestBackup turns the chunks of the last take into a WAV file
+// next to them. Must be called with mutex held.
+func reassembleLatestBackup() {
+	showAlert(i18n.T("backup.reassembling"), 10*time.Second)
+
+	go func() {
+		dir, err := latestBackup()
+		if err == nil {
+			out := filepath.Join(backupRoot(), filepath.Base(dir)+backupSuffix)
+			if err = reassembleBackup(dir, out); err == nil {
+				log.Printf("Reassembled backup %s", out)
+				showAlert(i18n.Tf("backup.saved", filepath.Base(out)), 5*time.Second)
+				return
+			}
+		}
+		setLastError("Failed to reassemble backup: %v", err)
+		showAlert(i18n.T("backup.failed"), 5*time.Second)
+	}()
+}
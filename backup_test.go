@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reassembled joins the chunks in dir and returns the samples and details
+// of the result
+func reassembled(t *testing.T, dir string) ([]byte, *WAVInfo) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "take"+backupSuffix)
+	if err := reassembleBackup(dir, out); err != nil {
+		t.Fatalf("reassembleBackup: %v", err)
+	}
+	return readSamples(t, out)
+}
+
+func TestBackupReassemblesAcrossChunks(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	dir := filepath.Join(t.TempDir(), "take")
+	// Chunks of 3360 frames, so recorder blocks cross every boundary
+	b, err := newBackupWriter(r, dir, 70*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddTap(b.Tap)
+
+	samples := testSamples(20000)
+	record(t, r, samples)
+	b.Stop()
+
+	chunks := backupChunks(dir)
+	if len(chunks) != 6 {
+		t.Fatalf("%d chunks, want 6", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.start != int64(i)*3360 {
+			t.Errorf("chunk %d starts at frame %d", i, chunk.start)
+		}
+	}
+
+	got, info := reassembled(t, dir)
+	if !bytes.Equal(got, samples) {
+		t.Errorf("reassembled %d bytes that differ from the %d recorded", len(got), len(samples))
+	}
+	first, _ := readWAVInfo(chunks[0].path)
+	if info.TimeReference != first.TimeReference {
+		t.Errorf("time reference %d, want the first chunk's %d", info.TimeReference, first.TimeReference)
+	}
+}
+
+func TestBackupFillsDroppedBlocks(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	dir := filepath.Join(t.TempDir(), "take")
+	b, err := newBackupWriter(r, dir, time.Second, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Frames 1000 to 1499 never reach the backup
+	frameSize := r.fileFrameSize()
+	samples := testSamples(3000)
+	b.Tap(samples[:1000*frameSize], 0)
+	b.Tap(samples[1500*frameSize:], 1500)
+	b.Stop()
+
+	if chunks := backupChunks(dir); len(chunks) != 2 || chunks[1].start != 1500 {
+		t.Fatalf("chunks %+v, want a new one after the drop", chunks)
+	}
+	want := bytes.Clone(samples)
+	clear(want[1000*frameSize : 1500*frameSize])
+	if got, _ := reassembled(t, dir); !bytes.Equal(got, want) {
+		t.Errorf("reassembled %d bytes, want %d with the drop silent", len(got), len(want))
+	}
+}
+
+func TestBackupSkipsOverlappingFrames(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	dir := t.TempDir()
+	frameSize := r.fileFrameSize()
+	samples := testSamples(150)
+
+	// The second chunk repeats the last 50 frames of the first
+	for _, start := range []int{0, 50} {
+		w, err := createWAV(filepath.Join(dir, fmt.Sprintf(backupChunkName, start)), r.sampleRate, r.fileChannels(), BitsPerSample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(samples[start*frameSize : (start+100)*frameSize]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := reassembled(t, dir); !bytes.Equal(got, samples) {
+		t.Errorf("reassembled %d bytes, want the %d of 150 frames", len(got), len(samples))
+	}
+}
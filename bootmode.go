@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+// Actions a set of buttons held at boot can pick
+const (
+	bootSafeMode     = "safe_mode"
+	bootFactoryReset = "factory_reset"
+	bootNone         = "none"
+)
+
+// bootButtonNames are the button names used in boot_buttons
+var bootButtonNames = []string{"record", "stop", "play"}
+
+var (
+	// safeMode is set for the run when the unit booted into safe mode:
+	// auto-record and the schedule stay off, remote interfaces are not
+	// started and the UI is drawn in the built-in bitmap font
+	safeMode = false
+
+	// factorySettings are the settings before the saved ones were restored,
+	// which a factory reset goes back to
+	factorySettings Settings
+)
+
+// bootButtonSet names a set of buttons the same way whatever the order,
+// such as "record+stop"
+func bootButtonSet(names []string) string {
+	set := make([]string, len(names))
+	for i, name := range names {
+		set[i] = strings.ToLower(name)
+	}
+	slices.Sort(set)
+	return strings.Join(set, "+")
+}
+
+// validateBootButtons checks the boot_buttons entries: known buttons and
+// actions, and no set of buttons listed twice
+func validateBootButtons(combos []BootButtonsConfig) error {
+	seen := make(map[string]bool)
+	for _, c := range combos {
+		if len(c.Buttons) == 0 {
+			return fmt.Errorf("boot_buttons entries need at least one button")
+		}
+		for i, name := range c.Buttons {
+			if !slices.Contains(bootButtonNames, strings.ToLower(name)) {
+				return fmt.Errorf("boot_buttons: unknown button %q (available: %v)", name, bootButtonNames)
+			}
+			if slices.ContainsFunc(c.Buttons[:i], func(other string) bool { return strings.EqualFold(other, name) }) {
+				return fmt.Errorf("boot_buttons: %s is listed twice in one entry", name)
+			}
+		}
+		switch c.Action {
+		case bootSafeMode, bootFactoryReset, bootNone:
+		default:
+			return fmt.Errorf("boot_buttons: unknown action %q (available: %s, %s, %s)", c.Action, bootSafeMode, bootFactoryReset, bootNone)
+		}
+		set := bootButtonSet(c.Buttons)
+		if seen[set] {
+			return fmt.Errorf("boot_buttons: %s is listed twice", set)
+		}
+		seen[set] = true
+	}
+	return nil
+}
+
+// bootAction returns the action of the entry whose buttons are exactly the
+// ones held, or bootNone
+func bootAction(held []hardware.ButtonType, combos []BootButtonsConfig) string {
+	if len(held) == 0 {
+		return bootNone
+	}
+	names := make([]string, len(held))
+	for i, b := range held {
+		names[i] = b.String()
+	}
+	set := bootButtonSet(names)
+	for _, c := range combos {
+		if bootButtonSet(c.Buttons) == set {
+			return c.Action
+		}
+	}
+	return bootNone
+}
+
+// heldNames lists buttons for the log, such as "Record+Stop"
+func heldNames(held []hardware.ButtonType) string {
+	names := make([]string, len(held))
+	for i, b := range held {
+		names[i] = b.String()
+	}
+	return strings.Join(names, "+")
+}
+
+// enterSafeMode starts safe mode if the buttons held as the hardware came up
+// pick it. It runs before the saved settings are restored, so that safe mode
+// starts from the defaults whatever was saved. Must be called with mutex
+// held.
+func enterSafeMode() {
+	held := hwManager.HeldAtBoot()
+	if bootAction(held, config.BootButtons) != bootSafeMode {
+		return
+	}
+	log.Printf("Boot: %s held, starting in safe mode", heldNames(held))
+	safeMode = true
+	autoArmed = false
+	if err := hwManager.UseBitmapFont(); err != nil {
+		log.Printf("Safe mode: %v", err)
+	}
+	showAlert(i18n.T("boot.safe_mode"), 10*time.Second)
+}
+
+// enterBootMode applies the other actions picked by the buttons held as the
+// hardware came up. A factory reset only asks, after the saved settings have
+// been restored. Must be called with mutex held.
+func enterBootMode() {
+	held := hwManager.HeldAtBoot()
+	switch action := bootAction(held, config.BootButtons); action {
+	case bootSafeMode:
+		// Entered by enterSafeMode
+	case bootFactoryReset:
+		log.Printf("Boot: %s held, asking for a factory reset", heldNames(held))
+		menuMode = FactoryResetConfirm
+		currentState = StateConfirm
+		confirmOption = ConfirmNo
+	default:
+		if len(held) > 0 {
+			log.Printf("Boot: %s held, no boot action for these buttons", heldNames(held))
+		}
+	}
+}
+
+// factoryReset puts the settings back to their defaults and forgets the
+// remembered editor entries and idle panel. Recordings, the unit name and
+// the write counters are kept. Must be called with mutex held.
+func factoryReset() {
+	log.Printf("Factory reset: restoring default settings")
+	applySettings(factorySettings)
+	showIdlePanel("")
+	recentEntries = make(map[string][]string)
+
+	if stateWritable() {
+		for _, path := range []string{settingsPath, settingsPath + ".bak", recentPath} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Factory reset: failed to remove %s: %v", path, err)
+			}
+		}
+	}
+	settingsFlushMutex.Lock()
+	savedSettings = nil
+	settingsFlushMutex.Unlock()
+	flushSettings(currentSettings())
+	showAlert(i18n.T("boot.factory_reset_done"), 5*time.Second)
+}
+
+// safeModeStatusElements marks the status bar for as long as the unit runs
+// in safe mode, which is until restart
+func safeModeStatusElements() []hardware.StatusElement {
+	if !safeMode {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("safe", i18n.T("status.safe_mode"), hardware.AlignLeft, 130)}
+}
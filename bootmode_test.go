@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pi9696/hardware"
+)
+
+func TestBootAction(t *testing.T) {
+	combos := defaultConfig().BootButtons
+	tests := []struct {
+		held []hardware.ButtonType
+		want string
+	}{
+		{nil, bootNone},
+		{[]hardware.ButtonType{hardware.StopButton}, bootSafeMode},
+		{[]hardware.ButtonType{hardware.RecordButton}, bootFactoryReset},
+		{[]hardware.ButtonType{hardware.RecordButton, hardware.StopButton}, bootSafeMode},
+		{[]hardware.ButtonType{hardware.StopButton, hardware.RecordButton}, bootSafeMode},
+		{[]hardware.ButtonType{hardware.PlayButton}, bootNone},
+		{[]hardware.ButtonType{hardware.RecordButton, hardware.StopButton, hardware.PlayButton}, bootNone},
+	}
+	for _, tt := range tests {
+		if got := bootAction(tt.held, combos); got != tt.want {
+			t.Errorf("%s held: %s, want %s", heldNames(tt.held), got, tt.want)
+		}
+	}
+
+	// A set of buttons matches whatever case and order the config uses
+	custom := []BootButtonsConfig{{Buttons: []string{"Play", "STOP"}, Action: bootFactoryReset}}
+	if got := bootAction([]hardware.ButtonType{hardware.StopButton, hardware.PlayButton}, custom); got != bootFactoryReset {
+		t.Errorf("Stop+Play held: %s, want %s", got, bootFactoryReset)
+	}
+	if got := bootAction([]hardware.ButtonType{hardware.StopButton}, nil); got != bootNone {
+		t.Errorf("Stop held with boot buttons off: %s, want %s", got, bootNone)
+	}
+}
+
+func TestValidateBootButtons(t *testing.T) {
+	if err := validateBootButtons(defaultConfig().BootButtons); err != nil {
+		t.Errorf("default boot buttons rejected: %v", err)
+	}
+	bad := [][]BootButtonsConfig{
+		{{Action: bootSafeMode}},
+		{{Buttons: []string{"eject"}, Action: bootSafeMode}},
+		{{Buttons: []string{"stop", "Stop"}, Action: bootSafeMode}},
+		{{Buttons: []string{"stop"}, Action: "reboot"}},
+		{{Buttons: []string{"record", "stop"}, Action: bootSafeMode}, {Buttons: []string{"stop", "record"}, Action: bootNone}},
+	}
+	for _, combos := range bad {
+		if err := validateBootButtons(combos); err == nil {
+			t.Errorf("%+v accepted", combos)
+		}
+	}
+}
+
+func TestSafeModeKeepsSavedSettings(t *testing.T) {
+	path := settingsPath
+	settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	t.Cleanup(func() { settingsPath = path })
+	writeTestSettings(t, settingsPath, newSettings)
+	saved, err := os.ReadFile(settingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	volume := monitorVolume
+	defer func() { monitorVolume = volume }()
+
+	keepDefaultSettings()
+	if monitorVolume == newSettings.MonitorVolume {
+		t.Error("safe mode restored the saved settings")
+	}
+	flushSettings(currentSettings())
+	if data, _ := os.ReadFile(settingsPath); !bytes.Equal(data, saved) {
+		t.Error("the defaults were saved over the settings without a change")
+	}
+
+	// A change in safe mode is kept, as when recovering from a bad setting
+	adjustMonitorVolume(-1)
+	flushSettings(currentSettings())
+	s, err := readSettingsFile(settingsPath, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MonitorVolume != monitorVolume {
+		t.Errorf("saved monitor volume %d, want the %d set in safe mode", s.MonitorVolume, monitorVolume)
+	}
+}
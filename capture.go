@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const (
+	// monitorRetryDelay is how long to wait before restarting a monitor
+	// pipeline that exited
+	monitorRetryDelay = 5 * time.Second
+	// firstSamplesTimeout is how long a new take waits for audio before it
+	// is abandoned
+	firstSamplesTimeout = 2 * time.Second
+)
+
+// startCapture launches save_to_file, which streams interleaved 32-bit
+// little-endian samples on stdout
+func startCapture(sampleRate, channels int) (*exec.Cmd, io.Reader, error) {
+	cmd := exec.Command("sh", "-c",
+		fmt.Sprintf("sample_rate=%d ./save_to_file %d", sampleRate, channels))
+	if demoMode {
+		var err error
+		if cmd, err = demoCapture(sampleRate, channels); err != nil {
+			return nil, nil, err
+		}
+	}
+	cmd.Dir = "." // Set working directory
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open pipeline output: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start inferno2pipe: %v", err)
+	}
+
+	return cmd, stdout, nil
+}
+
+// InputMonitor runs the capture pipeline while nothing is recording so the
+// incoming audio can be watched, e.g. for LTC. It writes nothing to disk.
+type InputMonitor struct {
+	sampleRate int
+	channels   int
+	taps       []SampleTap
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// newInputMonitor creates a monitor feeding the given taps
+func newInputMonitor(sampleRate, channels int, taps ...SampleTap) *InputMonitor {
+	return &InputMonitor{
+		sampleRate: sampleRate,
+		channels:   channels,
+		taps:       taps,
+		done:       make(chan struct{}),
+	}
+}
+
+// Start launches the pipeline and begins feeding the taps
+func (m *InputMonitor) Start() error {
+	cmd, stdout, err := startCapture(m.sampleRate, m.channels)
+	if err != nil {
+		return err
+	}
+	m.cmd = cmd
+	go m.run(stdout)
+	return nil
+}
+
+// Stop terminates the pipeline and waits for the reader to finish
+func (m *InputMonitor) Stop() {
+	if m.cmd != nil && m.cmd.Process != nil {
+		m.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	<-m.done
+	if m.cmd != nil {
+		m.cmd.Wait()
+	}
+}
+
+// Done is closed once the pipeline output has ended
+func (m *InputMonitor) Done() <-chan struct{} {
+	return m.done
+}
+
+func (m *InputMonitor) run(source io.Reader) {
+	defer close(m.done)
+
+	frameSize := m.channels * BitsPerSample / 8
+	buf := make([]byte, recordBlockFrames*frameSize)
+	var frame int64
+	for {
+		n, err := io.ReadFull(source, buf)
+		n -= n % frameSize
+		if n > 0 {
+			for _, tap := range m.taps {
+				tap(buf[:n], frame)
+			}
+			frame += int64(n / frameSize)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// captureError files a take that got no samples under the catalog entry
+// for its probable cause
+func captureError(err error, sampleRate int) *opError {
+	if errors.Is(err, errPipelineExited) {
+		if dependencyReason(depCapture) != "" {
+			return newOpError(errCaptureMissing, err)
+		}
+		return newOpError(errPipelineExit, err)
+	}
+	return newOpError(errNoAudio, err, sampleRate/1000)
+}
+
+var (
+	inputMonitor      *InputMonitor
+	inputMonitorRetry time.Time
+)
+
+// wantInputMonitor reports whether the input should be watched while idle
+func wantInputMonitor() bool {
+	return !isRecording && !streamProbing && (autoArmed || (ltcChannel > 0 && ltcChannel <= channelCount) || idleSignalWanted())
+}
+
+// updateInputMonitor starts, restarts or stops the input monitor to match
+// the current settings. Must be called with mutex held.
+func updateInputMonitor() {
+	sampleRate := sampleRates[sampleRateIdx]
+	// Auto-record needs every block; the signal indicator does not
+	autoMeter.SetCoarse(!autoArmed)
+
+	if inputMonitor != nil {
+		exited := false
+		select {
+		case <-inputMonitor.Done():
+			exited = true
+		default:
+		}
+
+		if exited || !wantInputMonitor() || inputMonitor.sampleRate != sampleRate || inputMonitor.channels != channelCount {
+			inputMonitor.Stop()
+			inputMonitor = nil
+			if exited {
+				log.Printf("Input monitor pipeline exited, retrying in %v", monitorRetryDelay)
+				inputMonitorRetry = time.Now().Add(monitorRetryDelay)
+			}
+		}
+	}
+
+	if inputMonitor != nil || !wantInputMonitor() || time.Now().Before(inputMonitorRetry) {
+		return
+	}
+
+	ltcWatch.Resync(sampleRate, channelCount)
+	autoMeter.SetChannels(channelCount, armedChannelIndexes())
+	m := newInputMonitor(sampleRate, channelCount, ltcWatch.Tap, autoMeter.Tap)
+	if err := m.Start(); err != nil {
+		log.Printf("Failed to start input monitor: %v", err)
+		inputMonitorRetry = time.Now().Add(monitorRetryDelay)
+		return
+	}
+	inputMonitor = m
+}
+
+// stopInputMonitor releases the input before a take opens its own pipeline.
+// Must be called with mutex held.
+func stopInputMonitor() {
+	if inputMonitor != nil {
+		inputMonitor.Stop()
+		inputMonitor = nil
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"pi9696/i18n"
+)
+
+const (
+	// channelNamesFile is the channel-name table looked for on a newly
+	// mounted USB drive and stored in the session folder
+	channelNamesFile = "pi9696-channels.csv"
+	maxChannelName   = 32
+)
+
+// channelNames maps 1-based pipeline channels to their names. Channels
+// without an entry use defaultChannelName.
+var channelNames map[int]string
+
+// defaultChannelName is the name of a channel with no entry in the table
+func defaultChannelName(ch int) string {
+	return fmt.Sprintf("Ch %d", ch)
+}
+
+// channelName returns the name of a 1-based pipeline channel. Must be called
+// with mutex held.
+func channelName(ch int) string {
+	if name := channelNames[ch]; name != "" {
+		return name
+	}
+	return defaultChannelName(ch)
+}
+
+// fileChannelNames returns the names of the channels written to each file,
+// in file order. Must be called with mutex held.
+func fileChannelNames() []string {
+	var names []string
+	if len(armedChannels) > 0 {
+		for _, ch := range armedChannels {
+			names = append(names, channelName(ch))
+		}
+		return names
+	}
+	for ch := 1; ch <= channelCount; ch++ {
+		names = append(names, channelName(ch))
+	}
+	return names
+}
+
+// validateChannelNames checks a channel-name table read from a show config or CSV
+func validateChannelNames(names map[int]string) error {
+	for ch, name := range names {
+		if ch < 1 || ch > MaxChannelCount {
+			return fmt.Errorf("channel %d is outside 1-%d", ch, MaxChannelCount)
+		}
+		if len([]rune(name)) > maxChannelName {
+			return fmt.Errorf("channel %d name is longer than %d characters", ch, maxChannelName)
+		}
+		if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			return fmt.Errorf("channel %d name contains control characters", ch)
+		}
+	}
+	return nil
+}
+
+// parseChannelNames reads a channel,name table. A header row and blank names
+// are skipped.
+func parseChannelNames(data []byte) (map[int]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	names := make(map[int]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected channel,name", line)
+		}
+		ch, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("line %d: %q is not a channel number", line, record[0])
+		}
+		if _, ok := names[ch]; ok {
+			return nil, fmt.Errorf("line %d: channel %d is listed twice", line, ch)
+		}
+		if name := strings.TrimSpace(record[1]); name != "" {
+			names[ch] = name
+		}
+	}
+
+	if err := validateChannelNames(names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// formatChannelNames writes a table in the form parseChannelNames reads
+func formatChannelNames(names map[int]string) []byte {
+	var channels []int
+	for ch := range names {
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"channel", "name"})
+	for _, ch := range channels {
+		w.Write([]string{strconv.Itoa(ch), names[ch]})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// checkChannelNames imports a channel-name table from a newly mounted USB
+// drive. Must be called with mutex held.
+func checkChannelNames() {
+	path := filepath.Join(USBMountPoint, channelNamesFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	names, err := parseChannelNames(data)
+	if err != nil {
+		setLastError("Rejected channel names: %s: %v", channelNamesFile, err)
+		showAlert(i18n.Tf("alert.channels_rejected", err), 15*time.Second)
+		return
+	}
+	setChannelNames(names)
+	log.Printf("Loaded %d channel names from USB", len(names))
+	showAlert(i18n.Tf("alert.channels_loaded", len(names)), 5*time.Second)
+}
+
+// setChannelNames makes a table active and stores it in the session folder
+// on every available target. Must be called with mutex held.
+func setChannelNames(names map[int]string) {
+	channelNames = names
+	data := formatChannelNames(names)
+	for _, target := range recordTargets {
+		if !target.Available() {
+			continue
+		}
+		dir := sessionDir(target.Path, sessionName)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Failed to create session %s on %s: %v", sessionName, target.Name, err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, channelNamesFile), data, 0644); err != nil {
+			log.Printf("Failed to store channel names on %s: %v", target.Name, err)
+		}
+	}
+}
+
+// channelNamesMenuItems lists the current channels with their names and
+// whether they are armed
+func channelNamesMenuItems() []menuItem {
+	armed := make(map[int]bool)
+	for _, ch := range armedChannels {
+		armed[ch] = true
+	}
+
+	var items []menuItem
+	for ch := 1; ch <= channelCount; ch++ {
+		ch := ch
+		label := channelName(ch)
+		if len(armedChannels) > 0 && !armed[ch] {
+			label = i18n.Tf("channels.unarmed", label)
+		}
+		items = append(items, menuItem{Label: label, Value: func() string { return strconv.Itoa(ch) }})
+	}
+	items = append(items, menuItem{Label: i18n.T("common.back"), Action: func() { openMenu(StateSettings) }})
+	return items
+}
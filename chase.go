@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/ltc"
+)
+
+// ltcGapTolerance is the longest gap between advancing frames that still
+// counts as continuously running code. Samples arrive in blocks, so frames
+// are seen in bursts rather than at the frame rate.
+const ltcGapTolerance = 500 * time.Millisecond
+
+// ltcWatcher follows the incoming LTC continuously, from the input monitor
+// while idle and from the recorder during a take
+type ltcWatcher struct {
+	mutex     sync.Mutex
+	channel   int // 0-based, -1 when no LTC input is designated
+	channels  int
+	decoder   *ltc.Decoder
+	samples   []int32
+	seenValid bool
+
+	last          ltc.Frame
+	lastFrameAt   time.Time
+	lastAdvanceAt time.Time
+	runningSince  time.Time // Start of the current run of advancing code
+}
+
+// ltcWatch is the watcher for the designated LTC input
+var ltcWatch = &ltcWatcher{channel: -1}
+
+// SetChannel selects the 0-based input channel to watch, or -1 for none,
+// and forgets any code seen on the previous channel
+func (w *ltcWatcher) SetChannel(channel int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.channel = channel
+	w.seenValid = false
+	w.decoder = nil
+	w.last = ltc.Frame{}
+	w.lastFrameAt = time.Time{}
+	w.lastAdvanceAt = time.Time{}
+	w.runningSince = time.Time{}
+}
+
+// Resync prepares for a new sample stream. The stream is discontinuous with
+// the previous one, so decoding starts afresh, but the code is assumed to
+// still be running across the switch.
+func (w *ltcWatcher) Resync(sampleRate, channels int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.channels = channels
+	w.decoder = ltc.NewDecoder(sampleRate)
+
+	now := time.Now()
+	if !w.runningSince.IsZero() && now.Sub(w.lastAdvanceAt) <= ltcGapTolerance {
+		w.lastAdvanceAt = now
+	} else {
+		w.runningSince = time.Time{}
+	}
+}
+
+// Tap decodes the watched channel of a block of S32LE frames
+func (w *ltcWatcher) Tap(block []byte, startFrame int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.decoder == nil || w.channel < 0 || w.channel >= w.channels {
+		return
+	}
+
+	frameSize := w.channels * 4
+	frames := len(block) / frameSize
+	if cap(w.samples) < frames {
+		w.samples = make([]int32, frames)
+	}
+	w.samples = w.samples[:frames]
+	for i := range w.samples {
+		w.samples[i] = int32(binary.LittleEndian.Uint32(block[i*frameSize+w.channel*4:]))
+	}
+
+	now := time.Now()
+	for _, frame := range w.decoder.Process(w.samples) {
+		w.observe(frame, now)
+	}
+}
+
+// observe tracks whether the code is advancing, frozen or jumping
+func (w *ltcWatcher) observe(frame ltc.Frame, now time.Time) {
+	w.seenValid = true
+
+	if !w.lastFrameAt.IsZero() {
+		step := frame.SecondsAt(frame.FPS) - w.last.SecondsAt(w.last.FPS)
+		frameLength := 1 / float64(frame.FPS)
+		switch {
+		case step == 0:
+			// Frozen code: not advancing
+		case step > 0 && step <= 2.5*frameLength && now.Sub(w.lastAdvanceAt) <= ltcGapTolerance:
+			w.lastAdvanceAt = now
+			if w.runningSince.IsZero() {
+				w.runningSince = now
+			}
+		default:
+			// A jump or the first frame after a gap starts a new run
+			w.lastAdvanceAt = now
+			w.runningSince = now
+		}
+	}
+
+	w.last = frame
+	w.lastFrameAt = now
+}
+
+// SeenValid reports whether any valid frame has been decoded on this channel
+func (w *ltcWatcher) SeenValid() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.seenValid
+}
+
+// Current returns the most recent timecode and whether it is still live
+func (w *ltcWatcher) Current() (ltc.Timecode, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.last.Timecode, !w.lastFrameAt.IsZero() && time.Since(w.lastFrameAt) <= ltcGapTolerance
+}
+
+// Rolling reports whether the code has been advancing continuously for at
+// least the confidence window
+func (w *ltcWatcher) Rolling(confidence time.Duration) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	now := time.Now()
+	return !w.runningSince.IsZero() &&
+		now.Sub(w.lastAdvanceAt) <= ltcGapTolerance &&
+		now.Sub(w.runningSince) >= confidence
+}
+
+// Stopped reports whether the code has not advanced for at least holdOff
+func (w *ltcWatcher) Stopped(holdOff time.Duration) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return time.Since(w.lastAdvanceAt) >= holdOff
+}
+
+var (
+	chaseArmed      = false
+	chaseTake       = false // The current take was started by chase
+	chaseSuppressed = false // Chase take stopped by hand; wait for the code to stop
+)
+
+// chaseLoop keeps the input monitor running and starts and stops takes from
+// LTC, the input level and the schedule
+func chaseLoop() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		mutex.Lock()
+		updateInputMonitor()
+		updateChase()
+		updateAutoRecord()
+		updateSignal()
+		updateSchedule()
+		mutex.Unlock()
+	}
+}
+
+// updateChase applies the chase rules. Must be called with mutex held.
+func updateChase() {
+	if !chaseArmed {
+		return
+	}
+
+	confidence := time.Duration(config.ChaseConfidenceMs) * time.Millisecond
+	holdOff := time.Duration(config.ChaseHoldOffMs) * time.Millisecond
+
+	if chaseSuppressed && ltcWatch.Stopped(holdOff) {
+		chaseSuppressed = false
+	}
+
+	switch {
+	case !isRecording && !chaseSuppressed && (currentState == StateIdle || currentState == StateRecordingSummary):
+		if ltcWatch.Rolling(confidence) {
+			log.Printf("Chase: LTC rolling, starting take")
+			chaseTake = startRecording() == nil
+		}
+
+	case isRecording && chaseTake:
+		if ltcWatch.Stopped(holdOff) {
+			log.Printf("Chase: LTC stopped, ending take")
+			stopRecording()
+		}
+	}
+}
+
+// toggleChase arms or disarms chase. Arming is refused until valid code has
+// been seen on the LTC input so a misconfigured input cannot silently fail
+// to record.
+func toggleChase() {
+	if chaseArmed {
+		chaseArmed = false
+		return
+	}
+	if ltcChannel == 0 {
+		showAlert(i18n.T("alert.set_ltc_first"), 3*time.Second)
+		return
+	}
+	if !ltcWatch.SeenValid() {
+		showAlert(i18n.T("alert.no_ltc"), 3*time.Second)
+		return
+	}
+	chaseArmed = true
+	chaseSuppressed = false
+}
+
+// chaseText formats the chase setting
+func chaseText() string {
+	if chaseArmed {
+		return i18n.T("settings.chase_armed")
+	}
+	return i18n.T("common.off")
+}
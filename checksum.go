@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// dataSum is the checksum of a recording's sample data, with the hash it
+// was made with
+type dataSum struct {
+	value   string
+	newHash func() hash.Hash
+}
+
+// newXXH64 starts the hash recordings are checksummed with
+func newXXH64() hash.Hash { return xxhash.New() }
+
+// takeDataSum returns the checksum of the sample data of file i of a take,
+// if the take was hashed as it was recorded. Takes recorded before XXH64
+// have MD5 sums.
+func takeDataSum(take *TakeInfo, i int) (dataSum, bool) {
+	switch {
+	case i < len(take.DataXXH64):
+		return dataSum{take.DataXXH64[i], newXXH64}, true
+	case i < len(take.DataMD5):
+		return dataSum{take.DataMD5[i], md5.New}, true
+	}
+	return dataSum{}, false
+}
+
+// storedDataSum returns the checksum of a recording's sample data kept in
+// its take sidecar, if the take was hashed as it was recorded
+func storedDataSum(path string) (dataSum, bool) {
+	info, err := readTakeInfo(path)
+	if err != nil {
+		return dataSum{}, false
+	}
+	for i, file := range info.Files {
+		if filepath.Base(file) == filepath.Base(path) {
+			return takeDataSum(info, i)
+		}
+	}
+	return dataSum{}, false
+}
+
+// hashWAVData reads a recording's sample data once the background I/O
+// scheduler allows it and returns its checksum made with newHash.
+// progress, if set, counts the bytes read.
+func hashWAVData(ctx context.Context, path string, newHash func() hash.Hash, progress *backgroundJob) (string, error) {
+	info, err := readWAVInfo(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if end := info.DataOffset + info.DataBytes; end > stat.Size() {
+		return "", fmt.Errorf("header claims %d bytes of samples, file has %d", info.DataBytes, stat.Size()-info.DataOffset)
+	}
+
+	sum := newHash()
+	data := io.NewSectionReader(f, info.DataOffset, info.DataBytes)
+	buf := make([]byte, verifyBlockSize)
+	for {
+		if err := backgroundIO.Wait(ctx, len(buf)); err != nil {
+			return "", err
+		}
+		n, err := data.Read(buf)
+		sum.Write(buf[:n])
+		if progress != nil {
+			progress.Add(int64(n))
+		}
+		if err == io.EOF {
+			return hex.EncodeToString(sum.Sum(nil)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// verifyCopy checks a copied recording's sample data against the checksum
+// recorded with the take, so the source is not read a second time. The
+// copy is removed if it does not match. Recordings without a checksum pass.
+func verifyCopy(ctx context.Context, src, dst string) error {
+	want, ok := storedDataSum(src)
+	if !ok {
+		return nil
+	}
+	got, err := hashWAVData(ctx, dst, want.newHash, nil)
+	if err != nil {
+		return err
+	}
+	if got != want.value {
+		os.Remove(dst)
+		return fmt.Errorf("copy does not match the checksum recorded with the take")
+	}
+	return nil
+}
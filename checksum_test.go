@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sumOf returns the checksum of data made with newHash, in hex
+func sumOf(newHash func() hash.Hash, data []byte) string {
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestChecksumsOfSplitTake(t *testing.T) {
+	r, _ := newTestRecorder(t, 2)
+	failAfter(r, 2*recordBlockFrames, 5) // Fails part way into a frame
+	samples := testSamples(4 * recordBlockFrames)
+	record(t, r, samples)
+
+	files := r.Files()
+	sums, take := r.Checksums()
+	if len(files) != 2 || len(sums) != 2 {
+		t.Fatalf("%d files with %d sums, want 2 of each", len(files), len(sums))
+	}
+	for i, file := range files {
+		data, _ := readSamples(t, file)
+		if sums[i] != sumOf(newXXH64, data) {
+			t.Errorf("part %d: sum %s does not match its samples", i+1, sums[i])
+		}
+		got, err := hashWAVData(context.Background(), file, newXXH64, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sums[i] {
+			t.Errorf("part %d: read back as %s, recorded as %s", i+1, got, sums[i])
+		}
+	}
+	if take != sumOf(newXXH64, samples) {
+		t.Error("take sum does not cover every sample in order")
+	}
+}
+
+// copyTestTake records a take with the given sidecar sums and copies its
+// file, returning the original and the copy
+func copyTestTake(t *testing.T, sums func(take *TakeInfo, data []byte)) (string, string) {
+	t.Helper()
+	r, _ := newTestRecorder(t, 1)
+	record(t, r, testSamples(recordBlockFrames))
+	src := r.Files()[0]
+	data, _ := readSamples(t, src)
+	take := &TakeInfo{Name: "take", Files: []string{src}}
+	sums(take, data)
+	if err := writeTakeInfo(take); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), filepath.Base(src))
+	whole, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, whole, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return src, dst
+}
+
+// corruptSample flips a bit in the last sample of a WAV file
+func corruptSample(t *testing.T, path string) {
+	t.Helper()
+	_, info := readSamples(t, path)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	at := info.DataOffset + info.DataBytes - 1
+	if _, err := f.ReadAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 1
+	if _, err := f.WriteAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCopy(t *testing.T) {
+	sums := map[string]func(take *TakeInfo, data []byte){
+		"xxh64": func(take *TakeInfo, data []byte) { take.DataXXH64 = []string{sumOf(newXXH64, data)} },
+		"md5":   func(take *TakeInfo, data []byte) { take.DataMD5 = []string{sumOf(md5.New, data)} },
+	}
+	for name, sum := range sums {
+		src, dst := copyTestTake(t, sum)
+		if err := verifyCopy(context.Background(), src, dst); err != nil {
+			t.Errorf("%s: good copy refused: %v", name, err)
+		}
+		corruptSample(t, dst)
+		if err := verifyCopy(context.Background(), src, dst); err == nil {
+			t.Errorf("%s: corrupt copy passed", name)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Errorf("%s: corrupt copy left behind", name)
+		}
+	}
+
+	// Takes from before checksums pass on size and header alone
+	src, dst := copyTestTake(t, func(*TakeInfo, []byte) {})
+	corruptSample(t, dst)
+	if err := verifyCopy(context.Background(), src, dst); err != nil {
+		t.Errorf("copy of a take without sums refused: %v", err)
+	}
+}
+
+// BenchmarkChecksum hashes one second of 128 channels at 96kHz as the
+// writer does, into the file's and the take's sums, in the blocks read from
+// the pipeline. The %realtime metric is the share of a core it takes.
+func BenchmarkChecksum(b *testing.B) {
+	const channels, sampleRate = 128, 96000
+	block := make([]byte, recordBlockFrames*channels*BitsPerSample/8)
+	for i := range block {
+		block[i] = byte(i * 7)
+	}
+	blocks := sampleRate / recordBlockFrames
+
+	for name, newHash := range map[string]func() hash.Hash{"xxh64": newXXH64, "md5": md5.New} {
+		b.Run(name, func(b *testing.B) {
+			w := &wavWriter{sum: newHash(), takeSum: newHash()}
+			b.SetBytes(int64(len(block) * blocks))
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < blocks; j++ {
+					w.hashData(block)
+				}
+			}
+			b.ReportMetric(100*time.Since(start).Seconds()/float64(b.N), "%realtime")
+		})
+	}
+}
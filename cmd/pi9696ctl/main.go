@@ -0,0 +1,159 @@
+// Command pi9696ctl inspects and controls a running PI9696 recorder from the
+// shell.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"pi9696/status"
+)
+
+// command is a pi9696ctl subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"status", "Show the recorder status", runStatus},
+	{"migrate", "Upgrade saved state to this version", runMigrate},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "pi9696ctl %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "pi9696ctl: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: pi9696ctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// runStatus prints the status file written by the recorder
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	path := flags.String("file", status.DefaultPath, "status file to read")
+	asJSON := flags.Bool("json", false, "print the raw status as JSON")
+	flags.Parse(args)
+
+	s, err := status.Read(*path)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	age := time.Since(s.UpdatedAt).Round(time.Second)
+	if s.Unit != "" {
+		fmt.Printf("Unit:      %s\n", s.Unit)
+	}
+	if s.Demo {
+		fmt.Println("Mode:      DEMO (synthetic audio)")
+	}
+	fmt.Printf("State:     %s (updated %s ago)\n", s.State, age)
+	if age > 10*time.Second {
+		fmt.Println("Warning:   status is stale; is pi9696 running?")
+	}
+
+	if r := s.Recording; r != nil {
+		elapsed := time.Duration(r.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+		fmt.Printf("Recording: %s, %s on %s\n", r.Take, elapsed, r.Target)
+		fmt.Printf("           %d channels at %d Hz -> %s\n", r.Channels, r.SampleRate, r.File)
+	}
+	if s.Copying != nil {
+		fmt.Printf("Copying:   %d%%\n", s.Copying.Percent)
+	}
+
+	remaining := time.Duration(s.Storage.RemainingSeconds * float64(time.Second)).Round(time.Minute)
+	fmt.Printf("Storage:   %s free, %s remaining\n", formatBytes(s.Storage.FreeBytes), remaining)
+	for _, t := range s.Storage.Targets {
+		state := "unavailable"
+		if t.Available {
+			state = formatBytes(t.FreeBytes) + " free"
+		}
+		fmt.Printf("           %s (%s): %s\n", t.Name, t.Path, state)
+	}
+	if len(s.Storage.Degraded) > 0 {
+		fmt.Printf("Degraded:  %s, no new writes until restart\n", strings.Join(s.Storage.Degraded, ", "))
+	}
+	if s.Storage.USBMounted {
+		fmt.Printf("USB:       mounted, %s\n", s.Storage.USBSize)
+	} else {
+		fmt.Println("USB:       not mounted")
+	}
+
+	if n := s.Hardware.Network; n != nil {
+		if n.Error != "" {
+			fmt.Printf("Network:   %s error: %s\n", n.Interface, n.Error)
+		} else {
+			fmt.Printf("Network:   %s %s\n", n.Interface, n.IPAddress)
+		}
+	}
+	if p := s.Power; p != nil {
+		state := "discharging"
+		if p.Charging {
+			state = "charging"
+		}
+		fmt.Printf("Battery:   %d%% (%.2fV, %s)\n", p.Percent, p.Volts, state)
+	}
+	if p := s.Preflight; p != nil {
+		fmt.Printf("Preflight: %s (%s)\n", strings.ToUpper(p.Verdict), p.Started.Local().Format("2006-01-02 15:04:05"))
+		for _, c := range p.Checks {
+			fmt.Printf("           %-7s %-12s %s\n", c.State, c.ID, c.Detail)
+		}
+	}
+	for _, d := range s.SelfCheck {
+		if !d.OK {
+			fmt.Printf("Missing:   %s (%s): %s\n", d.ID, d.Severity, d.Error)
+		}
+	}
+	if e := s.LastError; e != nil {
+		code := ""
+		if e.Code != "" {
+			code = e.Code + " "
+		}
+		fmt.Printf("Last error: %s%s (%s)\n", code, e.Message, e.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// formatBytes renders a byte count in the largest whole unit
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%dMB", n>>20)
+	default:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+}
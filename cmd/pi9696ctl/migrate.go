@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi9696/schema"
+	"pi9696/status"
+)
+
+// defaultStateDir is where the recorder keeps its state between runs
+const defaultStateDir = "/var/lib/pi9696"
+
+// runMigrate upgrades the recorder's state files, and the take sidecars in
+// any directories given, to the schema versions of this build. With
+// -dry-run it only reports what would change.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", defaultStateDir, "recorder state directory")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+	statusPath := flags.String("status", status.DefaultPath, "status file used to tell whether the recorder is running")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: pi9696ctl migrate [flags] [recording directories...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if !*dryRun {
+		// The recorder would save over the files with its own versions
+		if s, err := status.Read(*statusPath); err == nil && time.Since(s.UpdatedAt) < 10*time.Second {
+			return errors.New("pi9696 is running; stop it first or use -dry-run")
+		}
+	}
+
+	pending, newer := 0, 0
+	check := func(path string, a *schema.Artifact) error {
+		changed, err := migrateFile(path, a, *dryRun)
+		var newerErr *schema.NewerError
+		switch {
+		case errors.As(err, &newerErr):
+			newer++
+			fmt.Printf("%s: %v, left alone\n", path, err)
+		case err != nil:
+			return fmt.Errorf("%s: %v", path, err)
+		case changed:
+			pending++
+		}
+		return nil
+	}
+
+	for _, a := range schema.All {
+		if a.File == "" {
+			continue
+		}
+		path := filepath.Join(*dir, a.File)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("%s: not present\n", path)
+			continue
+		}
+		if err := check(path, a); err != nil {
+			return err
+		}
+	}
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !isSidecar(path) {
+				return err
+			}
+			return check(path, &schema.TakeInfo)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	verb := "upgraded"
+	if *dryRun {
+		verb = "would be upgraded"
+	}
+	fmt.Printf("%d files %s", pending, verb)
+	if newer > 0 {
+		fmt.Printf(", %d from a newer version", newer)
+	}
+	fmt.Println()
+	return nil
+}
+
+// isSidecar reports whether path is a take sidecar: a JSON object listing
+// the take's files
+func isSidecar(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(data, &doc) != nil {
+		return false
+	}
+	_, ok := doc["files"]
+	return ok
+}
+
+// migrateFile reports the version of a file and what upgrading it would
+// change, and upgrades it unless dryRun is set. It returns whether the file
+// needs or got an upgrade.
+func migrateFile(path string, a *schema.Artifact, dryRun bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	doc, from, err := a.Upgrade(data)
+	if err != nil {
+		return false, err
+	}
+
+	changes := a.Pending(from)
+	var old map[string]json.RawMessage
+	json.Unmarshal(data, &old)
+	if _, ok := old["version"]; !ok {
+		// Files from before versioning
+		changes = append(changes, "record the version")
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s: %s version %d, current\n", path, a.Name, from)
+		return false, nil
+	}
+	fmt.Printf("%s: %s version %d -> %d\n", path, a.Name, from, a.Version)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return true, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(out, '\n'), 0644); err != nil {
+		return true, err
+	}
+	return true, os.Rename(tmp, path)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+)
+
+// Status LED patterns a condition can ask for. With no condition active the
+// LED plays ledIdle.
+const (
+	ledBooting = "booting"
+	ledError   = "error"
+	ledWarning = "warning"
+	ledIdle    = "idle"
+)
+
+// recentErrorAge is how long the last error counts as an error state
+const recentErrorAge = time.Minute
+
+// condition is a health state a subsystem reports. The status LED shows the
+// pattern of the active condition with the highest priority.
+type condition struct {
+	name     string
+	pattern  string // ledBooting, ledError or ledWarning
+	priority int
+	active   func() bool // Called with mutex held
+}
+
+var (
+	conditions []condition
+
+	// booted is set once startup is complete
+	booted = false
+)
+
+// registerCondition adds a condition to the registry. Conditions of equal
+// priority are ranked in the order they are registered.
+func registerCondition(name, pattern string, priority int, active func() bool) {
+	conditions = append(conditions, condition{name: name, pattern: pattern, priority: priority, active: active})
+}
+
+// registerConditions sets up the conditions of each subsystem: errors above
+// warnings, and booting above both
+func registerConditions() {
+	registerCondition("booting", ledBooting, 300, func() bool { return !booted })
+
+	registerCondition("capture_missing", ledError, 230, selfCheckFatal)
+	registerCondition("storage_degraded", ledError, 220, func() bool { return len(degradedStorage()) > 0 })
+	registerCondition("display_offline", ledError, 210, hwManager.DisplayOffline)
+	registerCondition("recent_error", ledError, 200, func() bool {
+		lastErrorMutex.Lock()
+		defer lastErrorMutex.Unlock()
+		return lastError != nil && time.Since(lastError.Time) < recentErrorAge
+	})
+
+	registerCondition("state_newer", ledWarning, 120, stateNewer)
+	registerCondition("low_storage", ledWarning, 110, func() bool { return estimateRemainingTime() < lowStorageWarning })
+	registerCondition("clock_unsynced", ledWarning, 100, func() bool { return !clockSynced() })
+}
+
+// topCondition returns the active condition with the highest priority, the
+// first registered among equals. Must be called with mutex held.
+func topCondition(conds []condition) (condition, bool) {
+	var top condition
+	found := false
+	for _, c := range conds {
+		if (!found || c.priority > top.priority) && c.active() {
+			top, found = c, true
+		}
+	}
+	return top, found
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+// testCondition is a condition that is active while *on is set
+func testCondition(name string, priority int, on *bool) condition {
+	return condition{name: name, pattern: ledWarning, priority: priority, active: func() bool { return *on }}
+}
+
+func TestTopCondition(t *testing.T) {
+	var low, first, second, high bool
+	conds := []condition{
+		testCondition("low", 100, &low),
+		testCondition("first", 200, &first),
+		testCondition("second", 200, &second),
+		testCondition("high", 300, &high),
+	}
+	for _, tt := range []struct {
+		low, first, second, high bool
+		want                     string
+	}{
+		{want: ""},
+		{low: true, want: "low"},
+		{low: true, second: true, want: "second"},
+		{low: true, first: true, second: true, want: "first"},
+		{first: true, high: true, want: "high"},
+		{low: true, first: true, second: true, high: true, want: "high"},
+	} {
+		low, first, second, high = tt.low, tt.first, tt.second, tt.high
+		top, ok := topCondition(conds)
+		if ok != (tt.want != "") || top.name != tt.want {
+			t.Errorf("low %v, first %v, second %v, high %v: top %q, want %q", low, first, second, high, top.name, tt.want)
+		}
+	}
+}
+
+func TestRegisteredConditionsRank(t *testing.T) {
+	saved := conditions
+	conditions = nil
+	t.Cleanup(func() { conditions = saved })
+	registerConditions()
+
+	// Booting outranks errors, which outrank warnings
+	rank := map[string]int{ledWarning: 0, ledError: 1, ledBooting: 2}
+	for _, a := range conditions {
+		for _, b := range conditions {
+			if rank[a.pattern] > rank[b.pattern] && a.priority <= b.priority {
+				t.Errorf("%s (%s) does not outrank %s (%s)", a.name, a.pattern, b.name, b.pattern)
+			}
+		}
+	}
+
+	// Every pattern a condition asks for has a valid default
+	patterns := defaultConfig().StatusLED.Patterns
+	for _, name := range ledPatternNames {
+		if err := validateLEDPattern(patterns[name]); err != nil || len(patterns[name]) == 0 {
+			t.Errorf("default %s pattern %v: %v", name, patterns[name], err)
+		}
+	}
+}
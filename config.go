@@ -0,0 +1,585 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+	"pi9696/status"
+)
+
+// ConfigPath is where the recorder looks for its configuration file
+const ConfigPath = "/etc/pi9696/config.json"
+
+// StateDir holds what the recorder remembers between runs
+const StateDir = "/var/lib/pi9696"
+
+// Config holds the settings loaded from the configuration file
+type Config struct {
+	// RecordTargets is the ordered list of places recordings may be written to.
+	// The first healthy target is used at record start and the rest are
+	// tried in order if it fails mid-take.
+	RecordTargets []RecordTargetConfig `json:"record_targets"`
+
+	// TimecodeFPS is the frame rate used to display timecode derived from the
+	// system clock. Takes stamped from LTC use the rate of the incoming code.
+	TimecodeFPS int `json:"timecode_fps"`
+
+	// ChaseConfidenceMs is how long LTC must run before chase starts a take,
+	// and ChaseHoldOffMs how long it must stop or freeze before the take ends
+	ChaseConfidenceMs int `json:"chase_confidence_ms"`
+	ChaseHoldOffMs    int `json:"chase_hold_off_ms"`
+
+	// UnitName tells this unit's files, logs and status apart from other
+	// units. It is asked for on first boot and saved back here.
+	UnitName string `json:"unit_name"`
+
+	// Language is the UI language selected at startup
+	Language string `json:"language"`
+
+	// LargeText starts the UI in the high-contrast large-text layout
+	LargeText bool `json:"large_text"`
+
+	// ClickFlash pulses the display brightness when a click is accepted
+	ClickFlash bool `json:"click_flash"`
+
+	// ConfirmStop makes Stop ask for a second press before ending a take
+	ConfirmStop ConfirmStopConfig `json:"confirm_stop"`
+
+	// Fonts overrides the display font directory, files and sizes
+	Fonts FontConfig `json:"fonts"`
+
+	// Power configures the UPS battery gauge
+	Power PowerConfig `json:"power"`
+
+	// AutoRecord starts takes when audio appears and ends them after silence
+	AutoRecord AutoRecordConfig `json:"auto_record"`
+
+	// IdleSignal shows on the idle screen whether audio is arriving
+	IdleSignal IdleSignalConfig `json:"idle_signal"`
+
+	// Backup mirrors the last minutes of every take to a second target
+	Backup BackupConfig `json:"backup"`
+
+	// MQTT publishes tally state to a broker and takes commands from it
+	MQTT MQTTConfig `json:"mqtt"`
+
+	// HTTP serves the screen for remote support
+	HTTP HTTPConfig `json:"http"`
+
+	// Slate writes a tone over the head of each take
+	Slate SlateConfig `json:"slate"`
+
+	// Process trims silence from takes and normalizes their level on request
+	Process ProcessConfig `json:"process"`
+
+	// Archive sets how "Archive sessions" packages a session for handover
+	Archive ArchiveConfig `json:"archive"`
+
+	// Schedule starts and stops takes from an iCal feed
+	Schedule ScheduleConfig `json:"schedule"`
+
+	// Maintenance runs housekeeping in a nightly window while the unit is
+	// idle
+	Maintenance MaintenanceConfig `json:"maintenance"`
+
+	// BackgroundIO paces copies and write tests so they leave the card to
+	// the recorder
+	BackgroundIO BackgroundIOConfig `json:"background_io"`
+
+	// PowerProfile is the power profile at first start: "performance",
+	// "balanced" or "power_save". The profile picked in Settings is kept
+	// with the settings after that.
+	PowerProfile string `json:"power_profile"`
+
+	// PowerProfiles tunes what each power profile sets
+	PowerProfiles PowerProfilesConfig `json:"power_profiles"`
+
+	// StatusPath is where the JSON status file is written
+	StatusPath string `json:"status_path"`
+
+	// PreflightMinMinutes is the recording time the preflight storage check
+	// requires at the current rate and channel count
+	PreflightMinMinutes int `json:"preflight_min_minutes"`
+
+	// StatusLED blinks a health LED
+	StatusLED StatusLEDConfig `json:"status_led"`
+
+	// BootButtons picks what holding buttons through power-up does. Only
+	// an entry listing exactly the buttons held applies.
+	BootButtons []BootButtonsConfig `json:"boot_buttons"`
+}
+
+// RecordTargetConfig describes a single record target
+type RecordTargetConfig struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	RequireMount bool   `json:"require_mount"` // Only use the path if a filesystem is mounted there
+}
+
+// StatusLEDConfig describes the status LED. The LED is off when Pin is
+// empty.
+type StatusLEDConfig struct {
+	Pin      string           `json:"pin"`      // GPIO name, such as "GPIO26"
+	Patterns map[string][]int `json:"patterns"` // booting, error, warning and idle to on and off times in ms
+}
+
+// BootButtonsConfig is an action taken when a set of buttons is held at boot
+type BootButtonsConfig struct {
+	Buttons []string `json:"buttons"` // "record", "stop" and "play"
+	Action  string   `json:"action"`  // "safe_mode", "factory_reset" or "none"
+}
+
+// PowerConfig describes the fuel gauge of a UPS HAT. The feature is off when
+// no gauge answers at startup.
+type PowerConfig struct {
+	Chip          string  `json:"chip"`    // "max17048", "ina219" or "" for none
+	Bus           string  `json:"bus"`     // I2C bus, empty for the first
+	Address       uint16  `json:"address"` // 0 for the chip's default
+	EmptyVolts    float64 `json:"empty_volts"`
+	FullVolts     float64 `json:"full_volts"`
+	ShuntOhms     float64 `json:"shunt_ohms"`     // INA219 current sense resistor
+	WarnPercent   []int   `json:"warn_percent"`   // Charge levels that raise a warning
+	ShutdownVolts float64 `json:"shutdown_volts"` // Stop and halt at or below this
+}
+
+// FontConfig overrides the display fonts. See hardware.FontOverrides.
+type FontConfig struct {
+	Dir   string             `json:"dir"`   // Directory holding the font files
+	Files map[string]string  `json:"files"` // Weight (Regular, Bold...) to font file
+	Sizes map[string]float64 `json:"sizes"` // UI context (statusbar, recording...) to point size
+}
+
+// overrides converts the font settings for the hardware manager
+func (c FontConfig) overrides() hardware.FontOverrides {
+	return hardware.FontOverrides{Dir: c.Dir, Files: c.Files, Sizes: c.Sizes}
+}
+
+// AutoRecordConfig describes the level trigger of auto-record
+type AutoRecordConfig struct {
+	Enabled     bool    `json:"enabled"`       // Armed at startup
+	ThresholdDB float64 `json:"threshold_db"`  // Peak level in dBFS that counts as signal
+	StartHoldMs int     `json:"start_hold_ms"` // Signal must last this long to start a take
+	StopHoldMs  int     `json:"stop_hold_ms"`  // Silence must last this long to end it
+}
+
+// IdleSignalConfig describes the idle screen signal indicator. It lights at
+// the auto-record threshold.
+type IdleSignalConfig struct {
+	Enabled     bool `json:"enabled"`
+	DimAfterSec int  `json:"dim_after_sec"` // Silence before the indicator dims
+}
+
+// ConfirmStopConfig describes when Stop asks for confirmation: always with
+// Enabled, which Settings can change, or else once a take has run for
+// AfterMinutes. Both off, the default, stops at once.
+type ConfirmStopConfig struct {
+	Enabled      bool `json:"enabled"`
+	AfterMinutes int  `json:"after_minutes"` // 0 never arms the prompt by length
+}
+
+// MQTTConfig describes the MQTT broker connection. The client is off when
+// Broker is empty.
+type MQTTConfig struct {
+	Broker           string `json:"broker"` // host or host:port
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	BaseTopic        string `json:"base_topic"` // {unit} is replaced by the unit name
+	TelemetrySeconds int    `json:"telemetry_seconds"`
+}
+
+// HTTPConfig describes the HTTP server. The server is off when Listen is
+// empty.
+type HTTPConfig struct {
+	Listen string `json:"listen"` // host:port, or :port for every interface
+	Token  string `json:"token"`  // Required of every request when set
+}
+
+// SlateConfig describes the tone written at the start of each take
+type SlateConfig struct {
+	Enabled     bool    `json:"enabled"`
+	FrequencyHz float64 `json:"frequency_hz"`
+	LengthMs    int     `json:"length_ms"`
+	LevelDB     float64 `json:"level_db"` // Peak level in dBFS
+	Channels    []int   `json:"channels"` // 1-based, empty for every recorded channel
+}
+
+// ProcessConfig describes the silence trim and normalization of processed
+// copies
+type ProcessConfig struct {
+	ThresholdDB  float64 `json:"threshold_db"`   // Peak level in dBFS below which audio counts as silence
+	PaddingMs    int     `json:"padding_ms"`     // Silence kept before the first and after the last sound
+	TargetPeakDB float64 `json:"target_peak_db"` // Peak level in dBFS of the processed copy
+}
+
+// ArchiveConfig describes session archives
+type ArchiveConfig struct {
+	Format string `json:"format"` // "tar" for a single uncompressed tar, or "directory"
+}
+
+// ScheduleConfig describes the iCal feed takes are scheduled from. The
+// scheduler is off when URL is empty.
+type ScheduleConfig struct {
+	URL            string `json:"url"`            // http or https ICS feed
+	SummaryFilter  string `json:"summary_filter"` // Only events whose summary contains this, in any case
+	RefreshMinutes int    `json:"refresh_minutes"`
+}
+
+// MaintenanceConfig describes the nightly maintenance window. Maintenance
+// is off when Start is empty.
+type MaintenanceConfig struct {
+	Start         string `json:"start"`          // Local time the window opens, "15:04"
+	WindowMinutes int    `json:"window_minutes"` // How long the window stays open
+	HealthCheck   bool   `json:"health_check"`   // Check the record targets and card endurance
+	Verify        bool   `json:"verify"`         // Read back recordings added since the last run
+}
+
+// BackgroundIOConfig describes how background jobs share storage with the
+// recorder
+type BackgroundIOConfig struct {
+	MBPerSec  float64 `json:"mb_per_sec"` // Throughput limit, 0 for none
+	PauseLoad float64 `json:"pause_load"` // Recorder write load that pauses jobs, 0 to 1
+}
+
+// PowerProfilesConfig holds the values of each power profile
+type PowerProfilesConfig struct {
+	Performance PowerProfileConfig `json:"performance"`
+	Balanced    PowerProfileConfig `json:"balanced"`
+	PowerSave   PowerProfileConfig `json:"power_save"`
+}
+
+// PowerProfileConfig is how often the unit polls and redraws, how bright
+// the display may be and how fast background jobs may move data
+type PowerProfileConfig struct {
+	RenderMs           int     `json:"render_ms"`
+	EncoderPollMs      int     `json:"encoder_poll_ms"`
+	ButtonPollMs       int     `json:"button_poll_ms"`
+	USBPollMs          int     `json:"usb_poll_ms"`
+	BrightnessPercent  int     `json:"brightness_percent"`
+	BackgroundMBPerSec float64 `json:"background_mb_per_sec"` // Cap below background_io, 0 for none
+}
+
+// BackupConfig describes the rolling safety backup
+type BackupConfig struct {
+	Path          string `json:"path"`           // Second target, empty to disable
+	ChunkSeconds  int    `json:"chunk_seconds"`  // Length of each chunk file
+	WindowMinutes int    `json:"window_minutes"` // Chunks older than this are deleted
+}
+
+// defaultConfig returns the configuration used when no file is present
+func defaultConfig() *Config {
+	return &Config{
+		RecordTargets: []RecordTargetConfig{
+			{Name: "SSD", Path: "/mnt/ssd", RequireMount: true},
+			{Name: "SD", Path: RecordPath},
+		},
+		TimecodeFPS:         25,
+		ChaseConfidenceMs:   1000,
+		ChaseHoldOffMs:      2000,
+		Language:            i18n.DefaultLanguage,
+		StatusPath:          status.DefaultPath,
+		PreflightMinMinutes: 60,
+		ClickFlash:          true,
+		Power: PowerConfig{
+			Chip:          "max17048",
+			EmptyVolts:    3.0,
+			FullVolts:     4.2,
+			WarnPercent:   []int{20, 10},
+			ShutdownVolts: 3.3,
+			ShuntOhms:     0.1,
+		},
+		AutoRecord: AutoRecordConfig{
+			ThresholdDB: -50,
+			StartHoldMs: 2000,
+			StopHoldMs:  30000,
+		},
+		IdleSignal: IdleSignalConfig{
+			Enabled:     true,
+			DimAfterSec: 3,
+		},
+		MQTT: MQTTConfig{
+			BaseTopic:        "pi9696/" + unitToken,
+			TelemetrySeconds: 30,
+		},
+		Slate: SlateConfig{
+			FrequencyHz: 1000,
+			LengthMs:    1000,
+			LevelDB:     -20,
+		},
+		Process: ProcessConfig{
+			ThresholdDB:  -50,
+			PaddingMs:    250,
+			TargetPeakDB: -1,
+		},
+		Archive: ArchiveConfig{
+			Format: "tar",
+		},
+		Schedule: ScheduleConfig{
+			RefreshMinutes: 15,
+		},
+		Maintenance: MaintenanceConfig{
+			Start:         "04:00",
+			WindowMinutes: 60,
+			HealthCheck:   true,
+		},
+		BackgroundIO: BackgroundIOConfig{
+			PauseLoad: defaultPauseLoad,
+		},
+		PowerProfile: "performance",
+		PowerProfiles: PowerProfilesConfig{
+			Performance: PowerProfileConfig{
+				RenderMs:          100,
+				EncoderPollMs:     1,
+				ButtonPollMs:      5,
+				USBPollMs:         1000,
+				BrightnessPercent: 100,
+			},
+			Balanced: PowerProfileConfig{
+				RenderMs:          100,
+				EncoderPollMs:     2,
+				ButtonPollMs:      10,
+				USBPollMs:         2000,
+				BrightnessPercent: 100,
+			},
+			PowerSave: PowerProfileConfig{
+				RenderMs:           250,
+				EncoderPollMs:      4,
+				ButtonPollMs:       20,
+				USBPollMs:          5000,
+				BrightnessPercent:  60,
+				BackgroundMBPerSec: 8,
+			},
+		},
+		Backup: BackupConfig{
+			ChunkSeconds:  60,
+			WindowMinutes: 30,
+		},
+		StatusLED: StatusLEDConfig{
+			Patterns: map[string][]int{
+				ledBooting: {1000},
+				ledError:   {100, 100},
+				ledWarning: {150, 150, 150, 1550},
+				ledIdle:    {1000, 1000},
+			},
+		},
+		BootButtons: []BootButtonsConfig{
+			{Buttons: []string{"stop"}, Action: bootSafeMode},
+			{Buttons: []string{"record"}, Action: bootFactoryReset},
+			{Buttons: []string{"record", "stop"}, Action: bootSafeMode},
+		},
+	}
+}
+
+// loadConfig reads the configuration file, falling back to defaults when it is absent
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("No config file at %s, using defaults", path)
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+
+	if len(cfg.RecordTargets) == 0 {
+		return nil, fmt.Errorf("config %s: record_targets must not be empty", path)
+	}
+	for i, target := range cfg.RecordTargets {
+		if target.Path == "" {
+			return nil, fmt.Errorf("config %s: record target %d has no path", path, i)
+		}
+		if target.Name == "" {
+			cfg.RecordTargets[i].Name = target.Path
+		}
+	}
+
+	switch cfg.TimecodeFPS {
+	case 24, 25, 30:
+	default:
+		return nil, fmt.Errorf("config %s: timecode_fps must be 24, 25 or 30", path)
+	}
+
+	if cfg.ChaseConfidenceMs < 0 || cfg.ChaseHoldOffMs <= 0 {
+		return nil, fmt.Errorf("config %s: chase_confidence_ms must not be negative and chase_hold_off_ms must be positive", path)
+	}
+
+	if a := cfg.AutoRecord; a.ThresholdDB < levelFloorDB || a.ThresholdDB >= 0 || a.StartHoldMs <= 0 || a.StopHoldMs <= 0 {
+		return nil, fmt.Errorf("config %s: auto_record threshold_db must be %.0f to below 0 and its hold times positive", path, levelFloorDB)
+	}
+	if cfg.IdleSignal.DimAfterSec <= 0 {
+		return nil, fmt.Errorf("config %s: idle_signal dim_after_sec must be positive", path)
+	}
+	if cfg.ConfirmStop.AfterMinutes < 0 {
+		return nil, fmt.Errorf("config %s: confirm_stop after_minutes must not be negative", path)
+	}
+
+	if m := cfg.MQTT; m.Broker != "" {
+		if m.BaseTopic == "" || strings.ContainsAny(m.BaseTopic, "#+") {
+			return nil, fmt.Errorf("config %s: mqtt base_topic must be set and must not contain wildcards", path)
+		}
+		if m.TelemetrySeconds <= 0 {
+			return nil, fmt.Errorf("config %s: mqtt telemetry_seconds must be positive", path)
+		}
+	}
+
+	if h := cfg.HTTP; h.Listen != "" {
+		if _, _, err := net.SplitHostPort(h.Listen); err != nil {
+			return nil, fmt.Errorf("config %s: http listen must be host:port or :port: %v", path, err)
+		}
+	}
+
+	if s := cfg.Slate; s.Enabled {
+		if s.FrequencyHz < 20 || s.FrequencyHz > 20000 || s.LengthMs <= 0 || s.LengthMs > 10000 || s.LevelDB < -60 || s.LevelDB > 0 {
+			return nil, fmt.Errorf("config %s: slate needs frequency_hz 20 to 20000, length_ms 1 to 10000 and level_db -60 to 0", path)
+		}
+		for _, ch := range s.Channels {
+			if ch < 1 || ch > MaxChannelCount {
+				return nil, fmt.Errorf("config %s: slate channel %d is not between 1 and %d", path, ch, MaxChannelCount)
+			}
+		}
+	}
+
+	if p := cfg.Process; p.ThresholdDB < levelFloorDB || p.ThresholdDB >= 0 || p.PaddingMs < 0 || p.PaddingMs > 10000 || p.TargetPeakDB < -60 || p.TargetPeakDB > 0 {
+		return nil, fmt.Errorf("config %s: process threshold_db must be %.0f to below 0, padding_ms 0 to 10000 and target_peak_db -60 to 0", path, levelFloorDB)
+	}
+	if f := cfg.Archive.Format; f != "tar" && f != "directory" {
+		return nil, fmt.Errorf("config %s: archive format must be \"tar\" or \"directory\"", path)
+	}
+
+	if s := cfg.Schedule; s.URL != "" {
+		if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+			return nil, fmt.Errorf("config %s: schedule url must be http or https", path)
+		}
+		if s.RefreshMinutes <= 0 {
+			return nil, fmt.Errorf("config %s: schedule refresh_minutes must be positive", path)
+		}
+	}
+
+	if m := cfg.Maintenance; m.Start != "" {
+		if _, err := time.Parse("15:04", m.Start); err != nil {
+			return nil, fmt.Errorf("config %s: maintenance start must be a time like 04:00", path)
+		}
+		if m.WindowMinutes <= 0 || m.WindowMinutes > 24*60 {
+			return nil, fmt.Errorf("config %s: maintenance window_minutes must be 1 to 1440", path)
+		}
+	}
+
+	if b := cfg.BackgroundIO; b.MBPerSec < 0 || b.PauseLoad <= 0 || b.PauseLoad > 1 {
+		return nil, fmt.Errorf("config %s: background_io mb_per_sec must not be negative and pause_load must be above 0 and at most 1", path)
+	}
+
+	if !validPowerProfile(cfg.PowerProfile) {
+		return nil, fmt.Errorf("config %s: unknown power_profile %q (available: %v)", path, cfg.PowerProfile, powerProfileNames)
+	}
+	for _, name := range powerProfileNames {
+		if err := cfg.PowerProfiles.profile(name).validate(); err != nil {
+			return nil, fmt.Errorf("config %s: power_profiles %s: %v", path, name, err)
+		}
+	}
+
+	if err := validateUnitName(cfg.UnitName); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+
+	if !i18n.Has(cfg.Language) {
+		return nil, fmt.Errorf("config %s: unknown language %q (available: %v)", path, cfg.Language, i18n.Languages())
+	}
+
+	if err := cfg.Fonts.overrides().Validate(); err != nil {
+		return nil, fmt.Errorf("config %s: fonts: %v", path, err)
+	}
+
+	if cfg.PreflightMinMinutes < 0 {
+		return nil, fmt.Errorf("config %s: preflight_min_minutes must not be negative", path)
+	}
+
+	switch cfg.Power.Chip {
+	case "", "max17048", "ina219":
+	default:
+		return nil, fmt.Errorf("config %s: power.chip must be \"max17048\", \"ina219\" or empty", path)
+	}
+	for _, p := range cfg.Power.WarnPercent {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("config %s: power.warn_percent must be 0-100, got %d", path, p)
+		}
+	}
+
+	if cfg.Backup.Path != "" && (cfg.Backup.ChunkSeconds <= 0 || cfg.Backup.WindowMinutes <= 0) {
+		return nil, fmt.Errorf("config %s: backup.chunk_seconds and backup.window_minutes must be positive", path)
+	}
+
+	if cfg.StatusPath == "" {
+		return nil, fmt.Errorf("config %s: status_path must not be empty", path)
+	}
+
+	if l := cfg.StatusLED; l.Pin != "" {
+		if slices.Contains(ledReservedPins, l.Pin) {
+			return nil, fmt.Errorf("config %s: status_led pin %s is used by the display, encoder or buttons", path, l.Pin)
+		}
+		for name, steps := range l.Patterns {
+			if !slices.Contains(ledPatternNames, name) {
+				return nil, fmt.Errorf("config %s: status_led has unknown pattern %q (available: %v)", path, name, ledPatternNames)
+			}
+			if err := validateLEDPattern(steps); err != nil {
+				return nil, fmt.Errorf("config %s: status_led pattern %s: %v", path, name, err)
+			}
+		}
+	}
+
+	if err := validateBootButtons(cfg.BootButtons); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// saveConfigValue sets a single key in the config file, keeping the rest of
+// the file as it is. The file is created if it does not exist.
+func saveConfigValue(path, key string, value interface{}) error {
+	values := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse config %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	values[key] = raw
+	data, err = json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// stopConfirmWindow is how long the stop prompt waits for a second Stop
+// press or a click
+const stopConfirmWindow = 3 * time.Second
+
+// errStopUnconfirmed is returned for a Stop that only raised the prompt
+var errStopUnconfirmed = errors.New("stop needs confirming: send record/stop again within 3s, or record/stop force")
+
+var (
+	// confirmStop asks for confirmation before every Stop, set in Settings
+	confirmStop = false
+	// stopPromptUntil is when the stop prompt on screen lapses
+	stopPromptUntil time.Time
+)
+
+// stopNeedsConfirm reports whether Stop should prompt rather than end the
+// take: always with Confirm Stop on, otherwise once the take has run for
+// the configured length. Must be called with mutex held.
+func stopNeedsConfirm() bool {
+	if confirmStop {
+		return true
+	}
+	after := config.ConfirmStop.AfterMinutes
+	return after > 0 && time.Since(recordStart) >= time.Duration(after)*time.Minute
+}
+
+// stopPrompted reports whether the stop prompt is waiting for confirmation.
+// Must be called with mutex held.
+func stopPrompted() bool {
+	return isRecording && time.Now().Before(stopPromptUntil)
+}
+
+// promptStop raises the stop prompt over the current screen. Must be called
+// with mutex held.
+func promptStop() {
+	stopPromptUntil = time.Now().Add(stopConfirmWindow)
+}
+
+// dismissStopPrompt takes the stop prompt down, leaving the take running.
+// Must be called with mutex held.
+func dismissStopPrompt() {
+	stopPromptUntil = time.Time{}
+}
+
+// confirmStopText shows whether Stop asks for confirmation
+func confirmStopText() string {
+	if confirmStop {
+		return i18n.T("common.on")
+	}
+	if after := config.ConfirmStop.AfterMinutes; after > 0 {
+		return i18n.Tf("confirm_stop.after", after)
+	}
+	return i18n.T("common.off")
+}
+
+// renderStopPrompt draws the stop prompt as a banner, so the elapsed time on
+// the recording screen stays in view
+func renderStopPrompt() {
+	if stopPrompted() {
+		hwManager.DrawBanner(i18n.T("confirm_stop.prompt"))
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	copySmallFile  = 4 << 20 // Files below this are copied whole by the small-file workers
+	copyWorkers    = 3       // Small files copied at once
+	copyBufferSize = 1 << 20
+	copyBuffers    = 4 // Buffers in flight between the reader and writer of a large file
+)
+
+// copyJob is a recording and the notes and marker lists that travel with it
+type copyJob struct {
+	src, dst string
+	notes    map[string]string // Destination name to source path
+	large    bool              // Copied through copyPipelined rather than whole
+	fat      bool              // The destination is a FAT drive, so names are sanitized
+	progress *backgroundJob    // Counts the bytes of recordings copied
+}
+
+// copyJobs plans the copy of files to dir, counting progress in bytes. On a
+// FAT drive the files are renamed as FAT needs.
+func copyJobs(files []string, dir string, progress *backgroundJob) []copyJob {
+	plan := newNamePlan(dir)
+	jobs := make([]copyJob, len(files))
+	for i, file := range files {
+		dst := filepath.Join(dir, plan.name(filepath.Base(file)))
+		jobs[i] = copyJob{src: file, dst: dst, notes: noteFiles(file), fat: plan.fat, progress: progress}
+	}
+	return jobs
+}
+
+// besideDst returns the destination path of a file that travels beside the
+// recording, such as a note or marker list
+func (job copyJob) besideDst(name string) string {
+	if job.fat {
+		name = fatName(name)
+	}
+	return filepath.Join(filepath.Dir(job.dst), name)
+}
+
+// totalSize adds up the sizes of files, skipping any that are gone
+func totalSize(files []string) int64 {
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// runCopyJobs copies each job in order. Large files are copied one at a time
+// through copyPipelined; small ones are handed to up to copyWorkers workers so
+// per-file latency overlaps. checkpoint runs before each job and stops the
+// copy when it returns an error; onDone is called as each job finishes, from
+// whichever goroutine copied it. The first recording that failed to copy is
+// returned, filed in the error catalog.
+func runCopyJobs(ctx context.Context, jobs []copyJob, checkpoint func() error, onDone func(done int)) error {
+	var wg sync.WaitGroup
+	var doneMutex sync.Mutex
+	done := 0
+	var failure error
+	finish := func(err error) {
+		doneMutex.Lock()
+		done++
+		n := done
+		if failure == nil {
+			failure = err
+		}
+		doneMutex.Unlock()
+		onDone(n)
+	}
+
+	workers := make(chan struct{}, copyWorkers)
+	for _, job := range jobs {
+		if err := checkpoint(); err != nil {
+			break
+		}
+
+		info, err := os.Stat(job.src)
+		if err == nil && info.Size() >= copySmallFile {
+			job.large = true
+			finish(job.run(ctx))
+			continue
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(job copyJob) {
+			defer wg.Done()
+			err := job.run(ctx)
+			<-workers
+			finish(err)
+		}(job)
+	}
+	wg.Wait()
+	return failure
+}
+
+// run copies a recording with its notes and marker lists, reporting
+// failures. It returns the failure to copy the recording itself, unless the
+// copy was cancelled.
+func (job copyJob) run(ctx context.Context) error {
+	var err error
+	if job.large {
+		err = copyPipelined(ctx, job.src, job.dst, job.progress)
+	} else {
+		var n int
+		n, err = copyFile(ctx, job.src, job.dst)
+		job.progress.Add(int64(n))
+	}
+	if err == nil {
+		err = verifyCopy(ctx, job.src, job.dst)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		noteWriteError(job.dst, "copy", err)
+		if strings.HasPrefix(job.dst, USBMountPoint) {
+			err = usbError(err)
+		} else {
+			err = storageError(err)
+		}
+		reportError(fmt.Sprintf("Failed to copy %s", job.src), err)
+	}
+
+	// Take and session notes travel with their files
+	for name, note := range job.notes {
+		if _, err := copyFile(ctx, note, job.besideDst(name)); err != nil && ctx.Err() == nil {
+			setLastError("Failed to copy %s: %v", note, err)
+		}
+	}
+	// DAWs import the markers from lists beside the file
+	if err := exportMarkers(job.src, strings.TrimSuffix(filepath.Base(job.dst), filepath.Ext(job.dst)), job.besideDst); err != nil && ctx.Err() == nil {
+		setLastError("Failed to export markers of %s: %v", job.src, err)
+	}
+	return err
+}
+
+// copyFile copies a small file whole once the background I/O scheduler
+// allows it, returning the number of bytes copied
+func copyFile(ctx context.Context, src, dst string) (int, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := backgroundIO.Wait(ctx, int(info.Size())); err != nil {
+		return 0, err
+	}
+	input, err := os.ReadFile(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(dst, input, 0644); err != nil {
+		return 0, err
+	}
+	countWritten(dst, len(input))
+	return len(input), nil
+}
+
+// copyPipelined copies a file with reading and writing overlapped: a reader
+// goroutine fills a small ring of buffers that the caller writes out, so
+// neither device waits for the other. The reader is paced by the background
+// I/O scheduler and progress counts each buffer written. A failed or
+// cancelled copy removes the partial destination.
+func copyPipelined(ctx context.Context, src, dst string, progress *backgroundJob) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	free := make(chan []byte, copyBuffers)
+	full := make(chan []byte, copyBuffers) // Never blocks: there are only copyBuffers buffers
+	for i := 0; i < copyBuffers; i++ {
+		free <- make([]byte, copyBufferSize)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(full)
+		for {
+			// A free buffer must not win over a cancellation
+			if err := ctx.Err(); err != nil {
+				readErr <- err
+				return
+			}
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+			if err := backgroundIO.Wait(ctx, len(buf)); err != nil {
+				readErr <- err
+				return
+			}
+			n, err := io.ReadFull(in, buf)
+			if n > 0 {
+				full <- buf[:n]
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				readErr <- nil
+				return
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var writeErr error
+	for buf := range full {
+		if writeErr == nil {
+			n, err := out.Write(buf)
+			countWritten(dst, n)
+			progress.Add(int64(n))
+			if err != nil {
+				writeErr = err
+				cancel() // Stop the reader; the rest is drained below
+			}
+		}
+		free <- buf[:cap(buf)]
+	}
+
+	err = <-readErr
+	if writeErr != nil {
+		err = writeErr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
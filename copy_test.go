@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// copySet is a generated set of files to copy
+type copySet struct {
+	name  string
+	files int
+	size  int
+}
+
+var copySets = []copySet{
+	{"small", 200, 64 << 10},
+	{"large", 2, 3 * copySmallFile},
+	{"mixed", 40, copySmallFile - 1},
+}
+
+// writeCopySet writes the files of set to a directory of their own
+func writeCopySet(tb testing.TB, set copySet) ([]string, int64) {
+	tb.Helper()
+	dir := tb.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	var files []string
+	var total int64
+	for i := 0; i < set.files; i++ {
+		data := make([]byte, set.size+i)
+		rng.Read(data)
+		path := filepath.Join(dir, fmt.Sprintf("take%03d.wav", i))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, path)
+		total += int64(len(data))
+	}
+	return files, total
+}
+
+// copySequential copies files one at a time, each read whole and then
+// written, as the copy engine did before it was pipelined
+func copySequential(files []string, dir string) error {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func noCheckpoint() error { return nil }
+
+func TestRunCopyJobs(t *testing.T) {
+	for _, set := range copySets {
+		files, total := writeCopySet(t, set)
+		dir := t.TempDir()
+		progress := startBackgroundJob(jobCopy, total)
+		defer progress.Finish()
+
+		var calls, last atomic.Int32
+		err := runCopyJobs(context.Background(), copyJobs(files, dir, progress), noCheckpoint, func(done int) {
+			calls.Add(1)
+			for {
+				prev := last.Load()
+				if int32(done) <= prev || last.CompareAndSwap(prev, int32(done)) {
+					break
+				}
+			}
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", set.name, err)
+		}
+		if int(calls.Load()) != len(files) || int(last.Load()) != len(files) {
+			t.Errorf("%s: %d progress calls reaching %d, want %d", set.name, calls.Load(), last.Load(), len(files))
+		}
+		if progress.done.Load() != total || progress.Percent() != 100 {
+			t.Errorf("%s: %d of %d bytes counted", set.name, progress.done.Load(), total)
+		}
+		for _, file := range files {
+			want, _ := os.ReadFile(file)
+			got, err := os.ReadFile(filepath.Join(dir, filepath.Base(file)))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: %s copied wrong: %v", set.name, filepath.Base(file), err)
+			}
+		}
+	}
+}
+
+func TestRunCopyJobsStopsAtCheckpoint(t *testing.T) {
+	files, _ := writeCopySet(t, copySets[1])
+	dir := t.TempDir()
+	progress := startBackgroundJob(jobCopy, 0)
+	defer progress.Finish()
+
+	// The copy is told to stop before the second file
+	checks := 0
+	stop := errors.New("stopped")
+	err := runCopyJobs(context.Background(), copyJobs(files, dir, progress), func() error {
+		checks++
+		if checks > 1 {
+			return stop
+		}
+		return nil
+	}, func(int) {})
+	if err != nil {
+		t.Fatalf("runCopyJobs() = %v, want the first file's result", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(files[0]) {
+		t.Errorf("copied %v, want only the first file", entries)
+	}
+}
+
+func TestCopyPipelinedCancelled(t *testing.T) {
+	files, _ := writeCopySet(t, copySet{"one", 1, 3 * copySmallFile})
+	dst := filepath.Join(t.TempDir(), "take.wav")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	progress := startBackgroundJob(jobCopy, 0)
+	defer progress.Finish()
+	if err := copyPipelined(ctx, files[0], dst, progress); !errors.Is(err, context.Canceled) {
+		t.Fatalf("copyPipelined() = %v after cancelling, want context.Canceled", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("partial copy left behind")
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	for _, set := range copySets {
+		files, total := writeCopySet(b, set)
+		b.Run(set.name+"/sequential", func(b *testing.B) {
+			b.SetBytes(total)
+			for i := 0; i < b.N; i++ {
+				if err := copySequential(files, b.TempDir()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(set.name+"/pipelined", func(b *testing.B) {
+			b.SetBytes(total)
+			progress := startBackgroundJob(jobCopy, 0)
+			defer progress.Finish()
+			for i := 0; i < b.N; i++ {
+				jobs := copyJobs(files, b.TempDir(), progress)
+				if err := runCopyJobs(context.Background(), jobs, noCheckpoint, func(int) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"pi9696/i18n"
+)
+
+// copyGroup is a session folder, or a day of takes recorded outside any
+// session, in the copy or import list
+type copyGroup struct {
+	name      string
+	files     []string
+	size      uint64
+	collapsed bool
+	selection map[string]bool // Which files of the list are selected
+}
+
+// copyGroups is the copy list, built by loadFilesToCopy
+var copyGroups []*copyGroup
+
+// groupRecordings sorts files into groups by session folder, or by the day
+// they were recorded when they are not in a session. Groups are in name
+// order and keep the order of their files, and select from selection.
+func groupRecordings(files []string, targets []*RecordTarget, selection map[string]bool) []*copyGroup {
+	roots := make(map[string]bool)
+	for _, t := range targets {
+		roots[filepath.Clean(t.Path)] = true
+	}
+
+	byName := make(map[string]*copyGroup)
+	var groups []*copyGroup
+	for _, file := range files {
+		var size uint64
+		name := filepath.Base(filepath.Dir(file))
+		info, err := os.Stat(file)
+		if err == nil {
+			size = uint64(info.Size())
+		}
+		if roots[filepath.Dir(file)] {
+			name = i18n.T("copy.no_session")
+			if err == nil {
+				name = info.ModTime().Format("2006-01-02")
+			}
+		}
+
+		g := byName[name]
+		if g == nil {
+			g = &copyGroup{name: name, selection: selection}
+			byName[name] = g
+			groups = append(groups, g)
+		}
+		g.files = append(g.files, file)
+		g.size += size
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+// selectedCount returns how many of the group's files are selected
+func (g *copyGroup) selectedCount() int {
+	n := 0
+	for _, file := range g.files {
+		if g.selection[file] {
+			n++
+		}
+	}
+	return n
+}
+
+// checkbox shows whether all, some or none of the group is selected
+func (g *copyGroup) checkbox() string {
+	switch g.selectedCount() {
+	case len(g.files):
+		return "[X]"
+	case 0:
+		return "[ ]"
+	}
+	return "[-]"
+}
+
+// toggle selects the whole group, or clears it if it is fully selected
+func (g *copyGroup) toggle() {
+	selected := g.selectedCount() < len(g.files)
+	for _, file := range g.files {
+		g.selection[file] = selected
+	}
+}
+
+// setAllSelected selects or clears every file in a list
+func setAllSelected(selection map[string]bool, selected bool) {
+	for file := range selection {
+		selection[file] = selected
+	}
+}
+
+// copyFilesMenuItems lists the copy actions, then the copy list
+func copyFilesMenuItems() []menuItem {
+	items := []menuItem{
+		{Label: i18n.T("copy.start"), Action: startCopyOperation},
+		{Label: i18n.T("copy.select_all"), Value: func() string { return i18n.Tf("copy.file_count", len(allFiles)) },
+			Action: func() { setAllSelected(filesToCopy, true) }},
+		{Label: i18n.T("copy.clear_all"), Action: func() { setAllSelected(filesToCopy, false) }},
+		{Label: i18n.T("process.selected"), Action: processSelected},
+		{Label: i18n.T("archive.selected"), Action: archiveSelected},
+	}
+	return append(items, groupMenuItems(copyGroups)...)
+}
+
+// groupMenuItems lists each group header with its files indented below
+// unless it is collapsed. Clicking a header selects or clears its files;
+// double clicking collapses or expands it.
+func groupMenuItems(groups []*copyGroup) []menuItem {
+	var items []menuItem
+	for _, g := range groups {
+		g := g
+		arrow := "▾"
+		if g.collapsed {
+			arrow = "▸"
+		}
+		items = append(items, menuItem{
+			Label:       fmt.Sprintf("%s %s %s", g.checkbox(), arrow, g.name),
+			Value:       func() string { return i18n.Tf("copy.group_info", len(g.files), formatSize(g.size)) },
+			Action:      g.toggle,
+			DoubleClick: func() { g.collapsed = !g.collapsed },
+			Header:      true,
+		})
+		if g.collapsed {
+			continue
+		}
+		for _, file := range g.files {
+			file := file
+			checkbox := "[ ]"
+			if g.selection[file] {
+				checkbox = "[X]"
+			}
+			items = append(items, menuItem{
+				Label:  checkbox + " " + filepath.Base(file),
+				Action: func() { g.selection[file] = !g.selection[file] },
+				Indent: 1,
+			})
+		}
+	}
+	return items
+}
+
+// formatSize renders a byte count in the largest whole unit
+func formatSize(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%dMB", n>>20)
+	}
+	return fmt.Sprintf("%dKB", n>>10)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTakes writes files of size bytes under root, recorded at when
+func writeTakes(t *testing.T, root string, when time.Time, size int, names ...string) []string {
+	t.Helper()
+	var files []string
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// labels returns the labels of the header rows and of the file rows below
+func labels(items []menuItem) (headers, files []string) {
+	for _, item := range items {
+		if item.Header {
+			headers = append(headers, item.Label)
+		} else if item.Indent == 1 {
+			files = append(files, item.Label)
+		}
+	}
+	return headers, files
+}
+
+func TestGroupRecordings(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 3, 20, 15, 0, 0, 0, time.Local)
+	var files []string
+	files = append(files, writeTakes(t, root, day, 1<<20, "Sunday/take1.wav", "Sunday/take2.wav")...)
+	files = append(files, writeTakes(t, root, day, 2<<20, "loose1.wav")...)
+	files = append(files, writeTakes(t, root, day.Add(24*time.Hour), 1<<20, "loose2.wav")...)
+	files = append(files, writeTakes(t, root, day, 1<<20, "Friday/take.wav")...)
+
+	groups := groupRecordings(files, []*RecordTarget{{Path: root + "/"}}, make(map[string]bool))
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.name)
+	}
+	if want := []string{"2024-03-20", "2024-03-21", "Friday", "Sunday"}; !slices.Equal(names, want) {
+		t.Fatalf("groups %v, want %v", names, want)
+	}
+	if g := groups[3]; len(g.files) != 2 || g.files[0] != files[0] || g.size != 2<<20 {
+		t.Errorf("Sunday holds %v of %d bytes", g.files, g.size)
+	}
+	if g := groups[0]; len(g.files) != 1 || g.size != 2<<20 {
+		t.Errorf("loose takes of the 20th: %v of %d bytes", g.files, g.size)
+	}
+}
+
+func TestGroupSelectionPropagates(t *testing.T) {
+	root := t.TempDir()
+	files := writeTakes(t, root, time.Now(), 1<<10, "Sunday/take1.wav", "Sunday/take2.wav", "Sunday/take3.wav")
+	selection := map[string]bool{files[0]: false, files[1]: false, files[2]: false}
+	g := groupRecordings(files, nil, selection)[0]
+	header := func() menuItem { return groupMenuItems([]*copyGroup{g})[0] }
+
+	steps := []struct {
+		what  string
+		click func()
+		box   string
+		files []bool
+	}{
+		{"nothing selected", func() {}, "[ ]", []bool{false, false, false}},
+		{"header selects every file", header().Action, "[X]", []bool{true, true, true}},
+		{"header clears them again", header().Action, "[ ]", []bool{false, false, false}},
+		{"one file", groupMenuItems([]*copyGroup{g})[2].Action, "[-]", []bool{false, true, false}},
+		{"header completes a partial group", header().Action, "[X]", []bool{true, true, true}},
+		{"one file off", groupMenuItems([]*copyGroup{g})[3].Action, "[-]", []bool{true, true, false}},
+	}
+	for _, step := range steps {
+		step.click()
+		headers, rows := labels(groupMenuItems([]*copyGroup{g}))
+		if len(headers) != 1 || !strings.HasPrefix(headers[0], step.box+" ▾ Sunday") {
+			t.Errorf("%s: header %q, want %s", step.what, headers, step.box)
+		}
+		for i, file := range files {
+			box := "[ ]"
+			if step.files[i] {
+				box = "[X]"
+			}
+			if selection[file] != step.files[i] || rows[i] != box+" "+filepath.Base(file) {
+				t.Errorf("%s: %s selected %t, shown as %q", step.what, filepath.Base(file), selection[file], rows[i])
+			}
+		}
+	}
+
+	// Collapsed, the header row stays and keeps the partial state
+	groupMenuItems([]*copyGroup{g})[0].DoubleClick()
+	items := groupMenuItems([]*copyGroup{g})
+	if len(items) != 1 || items[0].Label != "[-] ▸ Sunday" {
+		t.Errorf("collapsed group lists %d rows headed %q", len(items), items[0].Label)
+	}
+	if got := items[0].Value(); !strings.Contains(got, "3") {
+		t.Errorf("header value %q does not count the files", got)
+	}
+}
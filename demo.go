@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"pi9696/hardware"
+)
+
+const (
+	// demoSourceCommand runs the binary as the synthetic capture pipeline
+	demoSourceCommand = "demo-source"
+	demoFilePrefix    = "DEMO_"
+
+	demoTonePeriod = 4 * time.Second // A tone starts on every channel this often
+	demoToneLength = time.Second
+	demoToneHz     = 1000.0
+	demoBlock      = 10 * time.Millisecond
+)
+
+// demoToneLevel is the tone amplitude, -18dBFS
+var demoToneLevel = math.Pow(10, -18.0/20)
+
+// demoMode replaces the Dante capture pipeline with a synthetic one, for
+// training and demos without a network. Everything downstream of the
+// pipeline runs as normal.
+var demoMode = false
+
+// demoCapture starts the binary itself as a synthetic capture pipeline in
+// place of save_to_file
+func demoCapture(sampleRate, channels int) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find demo source: %v", err)
+	}
+	return exec.Command(exe, demoSourceCommand, strconv.Itoa(sampleRate), strconv.Itoa(channels)), nil
+}
+
+// runDemoSource writes a periodic tone in the capture pipeline's format to
+// stdout in real time until the reader goes away. Each channel's tone is
+// offset a little from the previous one so the meters ripple across.
+func runDemoSource(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s <sample rate> <channels>", demoSourceCommand)
+	}
+	sampleRate, err := strconv.Atoi(args[0])
+	if err != nil || sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %q", args[0])
+	}
+	channels, err := strconv.Atoi(args[1])
+	if err != nil || channels <= 0 {
+		return fmt.Errorf("invalid channel count %q", args[1])
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	frames := int(int64(sampleRate) * int64(demoBlock) / int64(time.Second))
+	block := make([]byte, frames*channels*4)
+	period := int64(demoTonePeriod.Seconds() * float64(sampleRate))
+	length := int64(demoToneLength.Seconds() * float64(sampleRate))
+	stagger := int64(sampleRate) / 100 // 10ms between channels
+
+	start := time.Now()
+	var frame int64
+	for n := 0; ; n++ {
+		for i := 0; i < frames; i++ {
+			for ch := 0; ch < channels; ch++ {
+				var sample int32
+				pos := (frame + int64(i) - int64(ch)*stagger) % period
+				if pos >= 0 && pos < length {
+					phase := 2 * math.Pi * demoToneHz * float64(frame+int64(i)) / float64(sampleRate)
+					sample = int32(demoToneLevel * math.Sin(phase) * math.MaxInt32)
+				}
+				binary.LittleEndian.PutUint32(block[(i*channels+ch)*4:], uint32(sample))
+			}
+		}
+		frame += int64(frames)
+
+		if _, err := out.Write(block); err != nil {
+			return nil
+		}
+		if err := out.Flush(); err != nil {
+			return nil
+		}
+
+		// Pace the output like a live source
+		time.Sleep(time.Until(start.Add(time.Duration(n+1) * demoBlock)))
+	}
+}
+
+// demoStatusElements returns the status bar badge in demo mode
+func demoStatusElements() []hardware.StatusElement {
+	if !demoMode {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("demo", "DEMO", hardware.AlignLeft, 100)}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	diagFrames       = 10          // Screen snapshots kept for a bundle
+	diagFrameEvery   = time.Second // How often a snapshot is kept
+	diagJournalLines = 5000
+	diagTimeout      = 15 * time.Second // For reading the journal
+
+	// serviceName is the systemd unit the recorder runs as
+	serviceName = "pi9696"
+
+	// redacted replaces credentials in exported config and settings
+	redacted = "[REDACTED]"
+)
+
+// frameSnapshot is a screen kept for diagnostics
+type frameSnapshot struct {
+	at    time.Time
+	frame *image.Gray
+}
+
+// frameHistory holds the last diagFrames screens, oldest first
+var frameHistory []frameSnapshot
+
+// recordFrame keeps the frame just drawn if the last one kept is old enough.
+// Must be called with mutex held.
+func recordFrame() {
+	now := time.Now()
+	if n := len(frameHistory); n > 0 && now.Sub(frameHistory[n-1].at) < diagFrameEvery {
+		return
+	}
+	frame := hwManager.Snapshot()
+	if frame == nil {
+		return
+	}
+	frameHistory = append(frameHistory, frameSnapshot{at: now, frame: frame})
+	if len(frameHistory) > diagFrames {
+		frameHistory = frameHistory[len(frameHistory)-diagFrames:]
+	}
+}
+
+// diagPart is one file in a diagnostics bundle
+type diagPart struct {
+	name    string
+	collect func() ([]byte, error)
+}
+
+// diagParts lists what goes into a bundle. Must be called with mutex held;
+// the parts themselves are collected later, without it.
+func diagParts() []diagPart {
+	remote, remoteErr := remoteReportJSON()
+	parts := []diagPart{
+		{"journal.log", readJournal},
+		{"config.json", func() ([]byte, error) { return readRedacted(ConfigPath) }},
+		{"settings.json", func() ([]byte, error) { return readRedacted(settingsPath) }},
+		{"status.json", func() ([]byte, error) { return os.ReadFile(config.StatusPath) }},
+		{"remote.json", func() ([]byte, error) { return remote, remoteErr }},
+		{"reported_errors.txt", func() ([]byte, error) { return errorHistoryText(), nil }},
+		{"goroutines.txt", func() ([]byte, error) {
+			var buf bytes.Buffer
+			err := pprof.Lookup("goroutine").WriteTo(&buf, 2)
+			return buf.Bytes(), err
+		}},
+		{"heap.pprof", func() ([]byte, error) {
+			var buf bytes.Buffer
+			err := pprof.WriteHeapProfile(&buf)
+			return buf.Bytes(), err
+		}},
+	}
+	for _, snap := range frameHistory {
+		frame := snap.frame
+		parts = append(parts, diagPart{"screens/" + snap.at.Format("150405") + ".png", func() ([]byte, error) {
+			var buf bytes.Buffer
+			err := png.Encode(&buf, frame)
+			return buf.Bytes(), err
+		}})
+	}
+	return parts
+}
+
+// readJournal returns the recorder's recent log from the systemd journal
+func readJournal() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "journalctl", "-u", serviceName, "--no-pager",
+		"-o", "short-iso", "-n", fmt.Sprint(diagJournalLines)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("journalctl: %v", err)
+	}
+	return out, nil
+}
+
+// readRedacted reads a JSON file with its credentials redacted. A file that
+// does not parse is left out rather than risk exporting it as it is.
+func readRedacted(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return redactJSON(data)
+}
+
+// redactJSON replaces the value of every password, secret or token field,
+// at any depth, with a marker
+func redactJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("not valid JSON, left out: %v", err)
+	}
+	return json.MarshalIndent(redactValue(v), "", "  ")
+}
+
+// redactValue redacts credentials within a decoded JSON value
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isCredential(key) && field != nil && field != "" {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return v
+}
+
+// isCredential reports whether a field name is for a credential
+func isCredential(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "passwd", "passphrase", "secret", "token", "apikey", "api_key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportDiagnostics writes a diagnostics bundle to the USB drive in the
+// background, showing progress on the status bar and the file name when it
+// is done. Must be called with mutex held.
+func exportDiagnostics() {
+	if !usbMounted {
+		showError(errNoUSB)
+		return
+	}
+	parts := diagParts()
+	name := fmt.Sprintf("pi9696-diag-%s-%s.tar.gz", unitSlug(), time.Now().Format("20060102-150405"))
+
+	go func() {
+		lease, err := resources.TryAcquire(jobDiagnostics, USBMountPoint)
+		if err != nil {
+			showAlert(busyMessage(err), 5*time.Second)
+			return
+		}
+		defer lease.Release()
+
+		progress := startBackgroundJob(jobDiagnostics, int64(len(parts)))
+		defer progress.Finish()
+
+		path := filepath.Join(USBMountPoint, name)
+		if err := writeDiagBundle(path, parts, progress); err != nil {
+			setLastError("Failed to export diagnostics to %s: %v", path, err)
+			showAlert(i18n.T("alert.diag_failed"), 5*time.Second)
+			return
+		}
+		log.Printf("Diagnostics exported to %s", path)
+		showAlert(i18n.Tf("alert.diag_saved", name), 8*time.Second)
+	}()
+}
+
+// writeDiagBundle collects each part into a gzipped tar at path. Parts that
+// cannot be collected are listed in errors.txt instead, so one missing
+// source never costs the rest of the bundle.
+func writeDiagBundle(path string, parts []diagPart, progress *backgroundJob) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // No-op once renamed
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	var failures []string
+	for _, part := range parts {
+		data, err := part.collect()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", part.name, err))
+		} else if err := add(part.name, data); err != nil {
+			f.Close()
+			return err
+		}
+		progress.Add(1)
+	}
+	if len(failures) > 0 {
+		if err := add("errors.txt", []byte(strings.Join(failures, "\n")+"\n")); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if gerr := gz.Close(); err == nil {
+		err = gerr
+	}
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	in := `{
+		"mqtt": {"broker": "mqtt.local", "username": "pi", "password": "mqtt-pass"},
+		"http": {"listen": ":8080", "token": "http-token"},
+		"smtp": {"Host": "mail.local", "Password": "smtp-pass", "APIKey": "smtp-key"},
+		"sftp": [{"host": "a", "passphrase": "sftp-phrase"}, {"host": "b", "client_secret": "sftp-secret"}],
+		"uploads": {"nested": {"deeper": {"api_key": "upload-key", "passwd": "upload-passwd"}}},
+		"unset": {"password": "", "token": null}
+	}`
+	out, err := redactJSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"mqtt-pass", "http-token", "smtp-pass", "smtp-key", "sftp-phrase", "sftp-secret", "upload-key", "upload-passwd"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("%s left in:\n%s", secret, out)
+		}
+	}
+
+	var v struct {
+		MQTT  map[string]interface{} `json:"mqtt"`
+		Unset map[string]interface{} `json:"unset"`
+	}
+	if err := json.Unmarshal(out, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.MQTT["password"] != redacted || v.MQTT["username"] != "pi" || v.MQTT["broker"] != "mqtt.local" {
+		t.Errorf("mqtt redacted to %v, want only the password marked", v.MQTT)
+	}
+	// Unset credentials show as unset rather than as redacted
+	if v.Unset["password"] != "" || v.Unset["token"] != nil {
+		t.Errorf("unset credentials became %v", v.Unset)
+	}
+
+	if _, err := redactJSON([]byte(`{"password": "half`)); err == nil {
+		t.Error("broken JSON passed through")
+	}
+}
+
+// bundleFiles reads every file of a diagnostics bundle
+func bundleFiles(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(data)
+	}
+}
+
+func TestDiagBundleLeavesOutCredentials(t *testing.T) {
+	dir := t.TempDir()
+
+	// The config as the recorder writes it, with every credential set
+	cfg := defaultConfig()
+	cfg.MQTT.Broker, cfg.MQTT.Username, cfg.MQTT.Password = "mqtt.local", "pi", "mqtt-pass"
+	cfg.HTTP.Token = "http-token"
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A settings file cut short by a crash, credentials and all
+	settingsFile := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(settingsFile, []byte(`{"password": "settings-pass"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := startBackgroundJob(jobDiagnostics, 2)
+	defer progress.Finish()
+	bundle := filepath.Join(dir, "diag.tar.gz")
+	err = writeDiagBundle(bundle, []diagPart{
+		{"config.json", func() ([]byte, error) { return readRedacted(configPath) }},
+		{"settings.json", func() ([]byte, error) { return readRedacted(settingsFile) }},
+	}, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := bundleFiles(t, bundle)
+	for name, content := range files {
+		for _, secret := range []string{"mqtt-pass", "http-token", "settings-pass"} {
+			if strings.Contains(content, secret) {
+				t.Errorf("%s in the bundle's %s", secret, name)
+			}
+		}
+	}
+	if !strings.Contains(files["config.json"], `"mqtt.local"`) {
+		t.Error("config left out of the bundle")
+	}
+	if _, ok := files["settings.json"]; ok || !strings.Contains(files["errors.txt"], "settings.json") {
+		t.Errorf("unreadable settings bundled as %q, errors %q", files["settings.json"], files["errors.txt"])
+	}
+	if progress.Percent() != 100 {
+		t.Errorf("progress %d%% once written", progress.Percent())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"pi9696/hardware"
+)
+
+const (
+	// displayFailureLimit is the number of frames in a row that may fail to
+	// reach the display before it is re-initialized
+	displayFailureLimit = 10
+	// displayRetryEvery is how often a display given up on is tried again,
+	// in case the cable has been reseated
+	displayRetryEvery = time.Minute
+)
+
+var (
+	displayFailures = 0 // Frames in a row that failed to upload
+	displayOffline  = false
+	displayRetryAt  time.Time
+)
+
+// checkDisplayUpdate follows the result of each frame upload. The first
+// failure is logged with its cause; after displayFailureLimit in a row the
+// display is re-initialized. Must be called with mutex held.
+func checkDisplayUpdate(err error) {
+	if err == nil {
+		if displayFailures > 0 {
+			log.Printf("Display: frames getting through again after %d failed", displayFailures)
+		}
+		displayFailures = 0
+		return
+	}
+
+	displayFailures++
+	if displayFailures == 1 {
+		log.Printf("Display: frame upload failed: %v", err)
+	}
+	if displayFailures >= displayFailureLimit {
+		reinitDisplay(err)
+	}
+}
+
+// reinitDisplay resets the display after repeated failures. If that fails
+// too the unit carries on headless: frames stop being sent, recording is
+// unaffected, and the fault is raised on the tally and status file. Must be
+// called with mutex held.
+func reinitDisplay(cause error) {
+	log.Printf("Display: %d frames failed, re-initializing", displayFailures)
+	if err := hwManager.ReinitDisplay(); err != nil {
+		if !displayOffline {
+			reportError("Display did not re-initialize, running headless", newOpError(errDisplayIO, fmt.Errorf("%w; re-initializing: %v", cause, err)))
+			displayOffline = true
+			hwManager.SetDisplayOffline(true)
+		}
+		displayRetryAt = time.Now().Add(displayRetryEvery)
+		return
+	}
+
+	if displayOffline {
+		log.Printf("Display: back online")
+	} else {
+		log.Printf("Display: re-initialized")
+	}
+	displayOffline = false
+	displayFailures = 0
+}
+
+// retryDisplay tries a display given up on again once displayRetryEvery has
+// passed. Must be called with mutex held.
+func retryDisplay() {
+	if displayOffline && time.Now().After(displayRetryAt) {
+		reinitDisplay(hardware.ErrDisplayOffline)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/spi"
+
+	"pi9696/hardware"
+)
+
+// flakyConn is an SPI connection that fails every transfer while failing is
+// set, like a panel with a loose ribbon cable
+type flakyConn struct {
+	mutex    sync.Mutex
+	failing  bool
+	attempts int
+}
+
+func (c *flakyConn) setFailing(failing bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failing = failing
+}
+
+func (c *flakyConn) tries() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.attempts
+}
+
+func (c *flakyConn) String() string      { return "flaky" }
+func (c *flakyConn) Duplex() conn.Duplex { return conn.Half }
+
+func (c *flakyConn) Tx(w, r []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.attempts++
+	if c.failing {
+		return errors.New("remote I/O error")
+	}
+	return nil
+}
+
+func (c *flakyConn) TxPackets(packets []spi.Packet) error {
+	for _, p := range packets {
+		if err := c.Tx(p.W, p.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestDisplayFailuresGoHeadless(t *testing.T) {
+	c := &flakyConn{}
+	mutex.Lock()
+	saved := hwManager
+	hwManager = hardware.NewHeadlessManagerOn(c)
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		hwManager = saved
+		displayFailures, displayOffline, displayRetryAt = 0, false, time.Time{}
+		lastErrorMutex.Lock()
+		lastError = nil
+		lastErrorMutex.Unlock()
+	})
+	failures := func() (int, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return displayFailures, displayOffline
+	}
+
+	// A single bad frame is forgotten once the next gets through
+	c.setFailing(true)
+	render()
+	c.setFailing(false)
+	render()
+	if n, _ := failures(); n != 0 {
+		t.Errorf("%d failures counted after a good frame", n)
+	}
+
+	c.setFailing(true)
+	for i := 1; i < displayFailureLimit; i++ {
+		render()
+	}
+	if n, offline := failures(); n != displayFailureLimit-1 || offline {
+		t.Fatalf("%d failures, offline %t, before the limit", n, offline)
+	}
+	render()
+	if _, offline := failures(); !offline || !hwManager.DisplayOffline() {
+		t.Fatal("still sending frames after re-initializing failed")
+	}
+	lastErrorMutex.Lock()
+	reported := lastError
+	lastErrorMutex.Unlock()
+	if reported == nil || reported.Code != errDisplayIO.code {
+		t.Errorf("reported %+v, want %s", reported, errDisplayIO.code)
+	}
+
+	// Headless, frames are drawn but not sent until the retry is due
+	tries := c.tries()
+	for i := 0; i < 5; i++ {
+		render()
+	}
+	if c.tries() != tries {
+		t.Errorf("%d transfers tried while headless", c.tries()-tries)
+	}
+
+	// The cable is reseated
+	c.setFailing(false)
+	mutex.Lock()
+	displayRetryAt = time.Now()
+	mutex.Unlock()
+	render()
+	if n, offline := failures(); offline || n != 0 || hwManager.DisplayOffline() {
+		t.Errorf("display offline %t with %d failures after the retry", offline, n)
+	}
+	if c.tries() == tries {
+		t.Error("nothing sent after the retry")
+	}
+}
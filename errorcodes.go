@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/status"
+)
+
+// errorKind is an entry in the catalog of failures reported to the
+// operator. The code is short enough to read off the screen and is listed
+// in the README; the message and suggested action are the i18n keys
+// "error.<name>" and "error.<name>.action".
+type errorKind struct {
+	code string
+	name string
+}
+
+func (k *errorKind) Error() string {
+	return k.code + " " + k.name
+}
+
+// The error catalog. Codes are grouped by subsystem and never reused.
+var (
+	errNoUSB           = &errorKind{"E10", "no_usb"}
+	errUSBFull         = &errorKind{"E11", "usb_full"}
+	errCopyFailed      = &errorKind{"E12", "copy_failed"}
+	errNoTarget        = &errorKind{"E20", "no_target"}
+	errStorageFull     = &errorKind{"E21", "storage_full"}
+	errStorageReadOnly = &errorKind{"E22", "storage_read_only"}
+	errWriteFailed     = &errorKind{"E23", "write_failed"}
+	errCaptureMissing  = &errorKind{"E30", "capture_missing"}
+	errPipelineStart   = &errorKind{"E31", "pipeline_start"}
+	errPipelineExit    = &errorKind{"E32", "pipeline_exited"}
+	errNoAudio         = &errorKind{"E33", "no_audio"}
+	errDisplayIO       = &errorKind{"E40", "display_io"}
+	errSettingsLoad    = &errorKind{"E50", "settings_load"}
+)
+
+// opError is a failure as the operator sees it: its catalog entry, the
+// arguments of the message, and the underlying cause, which goes to the log
+// only
+type opError struct {
+	kind  *errorKind
+	args  []interface{}
+	cause error
+}
+
+// newOpError wraps cause in the catalog entry kind. args fill in the
+// entry's message.
+func newOpError(kind *errorKind, cause error, args ...interface{}) *opError {
+	return &opError{kind: kind, args: args, cause: cause}
+}
+
+func (e *opError) Error() string {
+	if e.cause == nil {
+		return e.kind.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.kind, e.cause)
+}
+
+func (e *opError) Unwrap() error {
+	return e.cause
+}
+
+// Is matches the catalog entry, so errors.Is(err, errNoUSB) holds however
+// the failure was wrapped
+func (e *opError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Message is the operator-facing text, in the current language
+func (e *opError) Message() string {
+	return i18n.Tf("error."+e.kind.name, e.args...)
+}
+
+// Action is the suggested fix, in the current language
+func (e *opError) Action() string {
+	return i18n.T("error." + e.kind.name + ".action")
+}
+
+// asOpError finds the catalog failure in err's chain, if any
+func asOpError(err error) (*opError, bool) {
+	var e *opError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	var kind *errorKind
+	if errors.As(err, &kind) {
+		return newOpError(kind, nil), true
+	}
+	return nil, false
+}
+
+// errorCode returns the catalog code of err, or "" for a failure not in
+// the catalog
+func errorCode(err error) string {
+	if e, ok := asOpError(err); ok {
+		return e.kind.code
+	}
+	return ""
+}
+
+// storageError files a failure to write a record target under the catalog
+// entry for its cause
+func storageError(err error) *opError {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return newOpError(errStorageFull, err)
+	case errors.Is(err, syscall.EROFS):
+		return newOpError(errStorageReadOnly, err)
+	}
+	return newOpError(errWriteFailed, err)
+}
+
+// usbError files a failure to write the USB drive under the catalog entry
+// for its cause
+func usbError(err error) *opError {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return newOpError(errUSBFull, err)
+	case errors.Is(err, syscall.ENODEV), errors.Is(err, syscall.ENXIO):
+		return newOpError(errNoUSB, err)
+	}
+	return newOpError(errCopyFailed, err)
+}
+
+// errorHistoryLength is how many reported errors the diagnostics bundle
+// keeps
+const errorHistoryLength = 50
+
+// reportedError is one reported error with its whole chain
+type reportedError struct {
+	at      time.Time
+	code    string
+	context string
+	err     error
+}
+
+var (
+	errorHistory      []reportedError
+	errorHistoryMutex sync.Mutex
+)
+
+// reportError logs err with its whole chain under what was being done, and
+// records it with its catalog code for the status file and diagnostics
+func reportError(context string, err error) {
+	code := errorCode(err)
+	msg := fmt.Sprintf("%s: %v", context, err)
+	log.Print(msg)
+
+	lastErrorMutex.Lock()
+	lastError = &status.Error{Code: code, Message: msg, Time: time.Now()}
+	lastErrorMutex.Unlock()
+
+	errorHistoryMutex.Lock()
+	errorHistory = append(errorHistory, reportedError{at: time.Now(), code: code, context: context, err: err})
+	if len(errorHistory) > errorHistoryLength {
+		errorHistory = errorHistory[len(errorHistory)-errorHistoryLength:]
+	}
+	errorHistoryMutex.Unlock()
+}
+
+// errorHistoryText lists the reported errors for the diagnostics bundle,
+// each with every error in its chain
+func errorHistoryText() []byte {
+	errorHistoryMutex.Lock()
+	defer errorHistoryMutex.Unlock()
+
+	var b strings.Builder
+	for _, r := range errorHistory {
+		code := r.code
+		if code == "" {
+			code = "-"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", r.at.Format(time.RFC3339), code, r.context)
+		for err := r.err; err != nil; err = errors.Unwrap(err) {
+			fmt.Fprintf(&b, "  %v\n", err)
+		}
+	}
+	return []byte(b.String())
+}
+
+var (
+	shownError  *opError // Failure on the error screen
+	errorReturn AppState // Screen to go back to from the error screen
+)
+
+// showError tells the operator about a catalog failure: on the error
+// screen, or in a banner while a take is recording so the recording screen
+// stays up. Must be called with mutex held.
+func showError(err error) {
+	e, ok := asOpError(err)
+	if !ok {
+		return
+	}
+	if isRecording {
+		showAlert(i18n.Tf("error.banner", e.kind.code, e.Message()), 10*time.Second)
+		return
+	}
+	if currentState != StateError {
+		errorReturn = currentState
+	}
+	shownError = e
+	currentState = StateError
+}
+
+// closeError leaves the error screen for the one it covered. Must be called
+// with mutex held.
+func closeError() {
+	shownError = nil
+	currentState = errorReturn
+	if currentState == StateRecording || currentState == StateCopying {
+		currentState = StateIdle
+	}
+}
+
+func renderErrorScreen() {
+	if shownError == nil {
+		return
+	}
+	hwManager.DrawCenteredText(i18n.Tf("error.title", shownError.kind.code), "header", 16)
+	hwManager.DrawCenteredText(shownError.Message(), "details", 30)
+	hwManager.DrawCenteredText(shownError.Action(), "details", 42)
+	hwManager.DrawCenteredText(i18n.T("common.click_continue"), "details", 58)
+}
+
+func renderLargeError() {
+	if shownError == nil {
+		return
+	}
+	drawLargeLines(shownError.Message(), shownError.Action())
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"pi9696/i18n"
+	"pi9696/status"
+)
+
+// errorCatalog lists every catalog entry
+var errorCatalog = []*errorKind{
+	errNoUSB, errUSBFull, errCopyFailed,
+	errNoTarget, errStorageFull, errStorageReadOnly, errWriteFailed,
+	errCaptureMissing, errPipelineStart, errPipelineExit, errNoAudio,
+	errDisplayIO, errSettingsLoad,
+}
+
+// keepErrorReports restores the last error and the error history when the
+// test ends
+func keepErrorReports(t *testing.T) {
+	lastErrorMutex.Lock()
+	savedLast := lastError
+	lastErrorMutex.Unlock()
+	errorHistoryMutex.Lock()
+	savedHistory := errorHistory
+	errorHistory = nil
+	errorHistoryMutex.Unlock()
+	t.Cleanup(func() {
+		lastErrorMutex.Lock()
+		lastError = savedLast
+		lastErrorMutex.Unlock()
+		errorHistoryMutex.Lock()
+		errorHistory = savedHistory
+		errorHistoryMutex.Unlock()
+	})
+}
+
+func TestErrorCatalog(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := i18n.Language()
+	t.Cleanup(func() { i18n.SetLanguage(saved) })
+
+	codes := make(map[string]string)
+	for _, kind := range errorCatalog {
+		if other, ok := codes[kind.code]; ok {
+			t.Errorf("%s is the code of both %s and %s", kind.code, other, kind.name)
+		}
+		codes[kind.code] = kind.name
+		if !bytes.Contains(readme, []byte("| "+kind.code+" | ")) {
+			t.Errorf("%s (%s) not listed in the README", kind.code, kind.name)
+		}
+		for _, lang := range i18n.Languages() {
+			i18n.SetLanguage(lang)
+			for _, key := range []string{"error." + kind.name, "error." + kind.name + ".action"} {
+				if i18n.T(key) == key {
+					t.Errorf("%s: no %s text for %s", lang, key, kind.code)
+				}
+			}
+		}
+	}
+}
+
+func TestFailuresMapToCatalog(t *testing.T) {
+	// Failures as the subsystems meet them, with the path and system error
+	// the operator should not have to read
+	pathErr := func(errno syscall.Errno) error {
+		return &os.PathError{Op: "write", Path: "/rec/Session/take_0001.wav", Err: errno}
+	}
+	tests := []struct {
+		name  string
+		err   error
+		cause error
+		want  *errorKind
+	}{
+		{"record target full", storageError(pathErr(syscall.ENOSPC)), syscall.ENOSPC, errStorageFull},
+		{"record target read-only", storageError(pathErr(syscall.EROFS)), syscall.EROFS, errStorageReadOnly},
+		{"record target I/O error", storageError(pathErr(syscall.EIO)), syscall.EIO, errWriteFailed},
+		{"USB drive full", usbError(pathErr(syscall.ENOSPC)), syscall.ENOSPC, errUSBFull},
+		{"USB drive pulled", usbError(pathErr(syscall.ENODEV)), syscall.ENODEV, errNoUSB},
+		{"USB drive gone", usbError(pathErr(syscall.ENXIO)), syscall.ENXIO, errNoUSB},
+		{"USB drive I/O error", usbError(pathErr(syscall.EIO)), syscall.EIO, errCopyFailed},
+		{"capture exited", captureError(fmt.Errorf("waiting for audio: %w", errPipelineExited), 48000), errPipelineExited, errPipelineExit},
+		{"no samples", captureError(errors.New("no samples in 5s"), 96000), nil, errNoAudio},
+	}
+	for _, tt := range tests {
+		for _, err := range []error{tt.err, fmt.Errorf("recording take_0001: %w", tt.err)} {
+			if got := errorCode(err); got != tt.want.code {
+				t.Errorf("%s: code %q, want %s", tt.name, got, tt.want.code)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: %v is not %s", tt.name, err, tt.want.name)
+			}
+			if tt.cause != nil && !errors.Is(err, tt.cause) {
+				t.Errorf("%s: cause %v lost from %v", tt.name, tt.cause, err)
+			}
+		}
+		e, _ := asOpError(tt.err)
+		if msg := e.Message(); strings.Contains(msg, "/rec") || strings.Contains(msg, "%!") || e.Action() == "" {
+			t.Errorf("%s: shown as %q, %q", tt.name, msg, e.Action())
+		}
+	}
+	if e, _ := asOpError(tests[len(tests)-1].err); !strings.Contains(e.Message(), "96") {
+		t.Errorf("no audio shown as %q, want the sample rate", e.Message())
+	}
+	if code := errorCode(errors.New("something else")); code != "" {
+		t.Errorf("failure outside the catalog given code %s", code)
+	}
+}
+
+func TestCaptureMissingMapsToCatalog(t *testing.T) {
+	saved := selfCheck
+	t.Cleanup(func() { selfCheck = saved })
+	selfCheck = nil
+	for _, dep := range dependencies {
+		selfCheck = append(selfCheck, status.Dependency{ID: dep.id, OK: dep.id != depCapture})
+	}
+	if code := errorCode(captureError(errPipelineExited, 48000)); code != errCaptureMissing.code {
+		t.Errorf("capture exiting with inferno2pipe missing is %s, want %s", code, errCaptureMissing.code)
+	}
+}
+
+func TestRecordingWriteFailureMapsToCatalog(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	failAfter(r, recordBlockFrames, 0)
+	r.Start(bytes.NewReader(testSamples(3 * recordBlockFrames)))
+	err := storageError(r.Stop())
+	if code := errorCode(err); code != errWriteFailed.code {
+		t.Errorf("take ended by a write error reported as %q, want %s", code, errWriteFailed.code)
+	}
+}
+
+func TestReportErrorKeepsChain(t *testing.T) {
+	keepErrorReports(t)
+	cause := &os.PathError{Op: "write", Path: "/rec/take_0001.wav", Err: syscall.ENOSPC}
+	reportError("Recording take_0001 failed", storageError(cause))
+	reportError("Something else failed", errors.New("unlisted"))
+
+	lastErrorMutex.Lock()
+	last := *lastError
+	lastErrorMutex.Unlock()
+	if last.Code != "" || !strings.Contains(last.Message, "unlisted") {
+		t.Errorf("last error %+v, want the unlisted failure without a code", last)
+	}
+
+	// The history has the code and every error down to the system one
+	history := string(errorHistoryText())
+	for _, want := range []string{" E21 Recording take_0001 failed\n", "  write /rec/take_0001.wav: no space left on device\n", " - Something else failed\n"} {
+		if !strings.Contains(history, want) {
+			t.Errorf("error history lacks %q:\n%s", want, history)
+		}
+	}
+}
+
+func TestShowError(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	t.Cleanup(func() {
+		currentState, shownError, isRecording = StateIdle, nil, false
+		takeAlert()
+	})
+
+	currentState = StateRecordings
+	showError(errors.New("unlisted"))
+	if currentState != StateRecordings {
+		t.Errorf("failure outside the catalog shown on the %s screen", stateNames[currentState])
+	}
+
+	// On the error screen, going back to the screen it covered
+	showError(fmt.Errorf("copying: %w", usbError(syscall.ENOSPC)))
+	if currentState != StateError || shownError == nil || shownError.kind != errUSBFull {
+		t.Fatalf("state %s showing %v, want %s", stateNames[currentState], shownError, errUSBFull.code)
+	}
+	closeError()
+	if currentState != StateRecordings || shownError != nil {
+		t.Errorf("state %s after closing the error", stateNames[currentState])
+	}
+
+	// In a banner while recording
+	currentState, isRecording = StateRecording, true
+	showError(storageError(syscall.EROFS))
+	if currentState != StateRecording {
+		t.Errorf("error screen over a recording")
+	}
+	if want := i18n.Tf("error.banner", errStorageReadOnly.code, i18n.T("error.storage_read_only")); takeAlert() != want {
+		t.Errorf("no %q banner while recording", want)
+	}
+}
+
+func TestUnreadableSettingsMapToCatalog(t *testing.T) {
+	keepErrorReports(t)
+	saved := settingsPath
+	settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	t.Cleanup(func() { settingsPath = saved })
+	if err := os.WriteFile(settingsPath, []byte("{torn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	loadSettings()
+	mutex.Unlock()
+	lastErrorMutex.Lock()
+	defer lastErrorMutex.Unlock()
+	if lastError == nil || lastError.Code != errSettingsLoad.code {
+		t.Errorf("unreadable settings reported as %+v, want %s", lastError, errSettingsLoad.code)
+	}
+}
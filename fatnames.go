@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// fatMaxNameBytes is the longest name written to a FAT drive. FAT32 and
+	// exFAT allow 255 UTF-16 units, which a name of 255 UTF-8 bytes never
+	// exceeds.
+	fatMaxNameBytes = 255
+	// fatReservedChars are refused in FAT names, along with control
+	// characters
+	fatReservedChars = `<>:"/\|?*`
+	// renameManifestPrefix starts the name of the list of renamed files a
+	// copy leaves on a FAT drive
+	renameManifestPrefix = "pi9696-names-"
+)
+
+// fatDeviceNames cannot be used as a name stem on FAT, in any case
+var fatDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// fatFilesystem reports whether path is on a FAT32 or exFAT file system,
+// going by the longest mount point in /proc/mounts that holds it. fuseblk
+// counts, as FUSE exFAT and NTFS drives share FAT's name rules.
+func fatFilesystem(path string) bool {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	path = filepath.Clean(path)
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	best, fstype := "", ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mount := unescape.Replace(fields[1])
+		if len(mount) > len(best) && (mount == "/" || path == mount || strings.HasPrefix(path, mount+"/")) {
+			best, fstype = mount, fields[2]
+		}
+	}
+	switch fstype {
+	case "vfat", "msdos", "exfat", "fuseblk":
+		return true
+	}
+	return false
+}
+
+// fatName returns name as it can be written to a FAT drive. Reserved and
+// control characters become "_", trailing dots and spaces are dropped, a
+// device name before the first dot gets a "_" and a name longer than
+// fatMaxNameBytes is cut short with a hash of the original before its
+// extension, so names that share a long beginning stay apart. A name FAT
+// takes as it is is returned unchanged.
+func fatName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == utf8.RuneError && !strings.HasPrefix(name[i:], "�"), r < 0x20, r == 0x7f, strings.ContainsRune(fatReservedChars, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s := strings.TrimRight(b.String(), ". ")
+	if s == "" {
+		s = "_"
+	}
+	// Windows takes a device name as the device whatever follows its dot
+	if i := strings.IndexByte(s+".", '.'); fatDeviceNames[strings.ToUpper(s[:i])] {
+		s = s[:i] + "_" + s[i:]
+	}
+	if len(s) > fatMaxNameBytes {
+		s = withNameSuffix(s, "~"+nameHash(name))
+	}
+	return s
+}
+
+// splitName splits a name into its stem and extension. A leading dot starts
+// the stem rather than an extension.
+func splitName(name string) (stem, ext string) {
+	ext = filepath.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// nameHash is a short hash of a name, used to tell apart names that were
+// cut short or collided
+func nameHash(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// withNameSuffix puts suffix before the extension of name, cutting the stem
+// at a rune boundary so the result fits within fatMaxNameBytes. An
+// extension too long to keep is cut along with the stem.
+func withNameSuffix(name, suffix string) string {
+	stem, ext := splitName(name)
+	if len(ext) > 16 {
+		stem, ext = name, ""
+	}
+	room := fatMaxNameBytes - len(suffix) - len(ext)
+	if len(stem) > room {
+		cut := room
+		for cut > 0 && !utf8.RuneStart(stem[cut]) {
+			cut--
+		}
+		stem = stem[:cut]
+	}
+	return strings.TrimRight(stem, ". ") + suffix + ext
+}
+
+// namePlan gives each file copied to one folder its destination name. On a
+// FAT drive names are made valid with fatName and kept apart from each
+// other, ignoring case as FAT does; elsewhere they are left as they are.
+type namePlan struct {
+	fat   bool
+	taken map[string]bool // Lowercased names given out
+}
+
+// newNamePlan starts naming files for dir
+func newNamePlan(dir string) *namePlan {
+	return &namePlan{fat: fatFilesystem(dir), taken: make(map[string]bool)}
+}
+
+// name returns the destination name for a file named original. A sanitized
+// name that clashes with one already given out gets a hash of the original,
+// and a counter if that clashes too.
+func (p *namePlan) name(original string) string {
+	if !p.fat {
+		return original
+	}
+	name := fatName(original)
+	for n := 0; p.taken[strings.ToLower(name)]; n++ {
+		key := original
+		if n > 0 {
+			key = fmt.Sprintf("%s#%d", original, n)
+		}
+		name = withNameSuffix(fatName(original), "~"+nameHash(key))
+	}
+	p.taken[strings.ToLower(name)] = true
+	return name
+}
+
+// sessionDir returns the session folder on a record target root, with the
+// session name made valid when the target is a FAT drive
+func sessionDir(root, session string) string {
+	if session != "" && fatFilesystem(root) {
+		session = fatName(session)
+	}
+	return filepath.Join(root, session)
+}
+
+// renamedFiles returns how many of files would be renamed copying them to
+// dir
+func renamedFiles(files []string, dir string) int {
+	plan := newNamePlan(dir)
+	n := 0
+	for _, file := range files {
+		if plan.name(filepath.Base(file)) != filepath.Base(file) {
+			n++
+		}
+	}
+	return n
+}
+
+// renameManifest lists the files a copy renamed to suit the destination
+type renameManifest struct {
+	Written time.Time  `json:"written"`
+	Files   []spanFile `json:"files"`
+}
+
+// writeRenameManifest writes the original and final names of the files of
+// jobs that were renamed to dir, if any were
+func writeRenameManifest(dir string, jobs []copyJob) error {
+	manifest := renameManifest{Written: time.Now()}
+	for _, job := range jobs {
+		if original := filepath.Base(job.src); filepath.Base(job.dst) != original {
+			manifest.Files = append(manifest.Files, spanFile{Name: filepath.Base(job.dst), Original: original, Source: job.src, Size: totalSize([]string{job.dst})})
+		}
+	}
+	if len(manifest.Files) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, renameManifestPrefix+manifest.Written.Format("20060102-150405")+".json")
+	return os.WriteFile(path, data, 0644)
+}
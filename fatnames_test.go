@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFatName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"take.wav", "take.wav"},
+		{`a<b>c:d"e/f\g|h?i*j.wav`, "a_b_c_d_e_f_g_h_i_j.wav"},
+		{"tab\there\x01\x7f.wav", "tab_here__.wav"},
+		{"Take 1. . ", "Take 1"},
+		{"...", "_"},
+		{"", "_"},
+		{"con.wav", "con_.wav"},
+		{"LPT1", "LPT1_"},
+		{"Aux.tar.gz", "Aux_.tar.gz"},
+		{"nul", "nul_"},
+		{"Console.wav", "Console.wav"},
+		{"COM10.wav", "COM10.wav"},
+		{".hidden", ".hidden"},
+		{"bad\xffbyte.wav", "bad_byte.wav"},
+		{"kept�.wav", "kept�.wav"},
+		{"Café Ünïcödé 日本語 🎤.wav", "Café Ünïcödé 日本語 🎤.wav"},
+		{strings.Repeat("a", 251) + ".wav", strings.Repeat("a", 251) + ".wav"},
+	}
+	for _, tt := range tests {
+		if got := fatName(tt.name); got != tt.want {
+			t.Errorf("fatName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFatNameTruncates(t *testing.T) {
+	tests := []struct {
+		name, original, ext string
+	}{
+		{"one byte over", strings.Repeat("a", 252) + ".wav", ".wav"},
+		{"two-byte runes", strings.Repeat("é", 200) + ".wav", ".wav"},
+		{"three-byte runes", strings.Repeat("日", 100) + ".wav", ".wav"},
+		{"four-byte runes", strings.Repeat("🎤", 70) + ".wav", ".wav"},
+		{"runes of every width", strings.Repeat("aé日🎤", 30) + ".bwf", ".bwf"},
+		{"dots at the cut", strings.Repeat("a", 235) + strings.Repeat(".", 40) + ".wav", ".wav"},
+		{"reserved characters", strings.Repeat("?", 300) + ".wav", ".wav"},
+		{"long extension", "take." + strings.Repeat("x", 300), ""},
+	}
+	for _, tt := range tests {
+		got := fatName(tt.original)
+		if len(got) > fatMaxNameBytes {
+			t.Errorf("%s: %d bytes", tt.name, len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: cut inside a rune: %q", tt.name, got)
+		}
+		if !strings.HasSuffix(got, "~"+nameHash(tt.original)+tt.ext) {
+			t.Errorf("%s: %q does not end with the hash and %q", tt.name, got, tt.ext)
+		}
+		if stem, _ := splitName(got); strings.Contains(stem, ".~") {
+			t.Errorf("%s: dot left before the hash in %q", tt.name, got)
+		}
+		if fatName(got) != got {
+			t.Errorf("%s: %q changes again", tt.name, got)
+		}
+	}
+}
+
+func TestFatNamesApartAfterTruncation(t *testing.T) {
+	// Names that only differ past the cut
+	prefix := strings.Repeat("Session 日本 ", 30)
+	seen := make(map[string]string)
+	for _, end := range []string{"take 1.wav", "take 2.wav", "TAKE 1.wav"} {
+		got := fatName(prefix + end)
+		if other, ok := seen[strings.ToLower(got)]; ok {
+			t.Errorf("%q and %q both become %q", other, end, got)
+		}
+		seen[strings.ToLower(got)] = end
+	}
+}
+
+func TestNamePlanKeepsNamesApart(t *testing.T) {
+	plan := &namePlan{fat: true, taken: make(map[string]bool)}
+	long := strings.Repeat("ü", 140)
+	originals := []string{
+		"a?.wav", "a*.wav", "a_.wav", // Collide once sanitized
+		"Take.wav", "take.WAV", // FAT ignores case
+		long + "1.wav", long + "2.wav", // Collide once cut short
+	}
+	// The name the next collision would get is already taken, so it falls
+	// back to a counter
+	plan.taken[strings.ToLower(withNameSuffix("b?.wav", "~"+nameHash("b?.wav")))] = true
+	plan.taken["b_.wav"] = true
+	originals = append(originals, "b?.wav")
+
+	given := make(map[string]string)
+	for _, original := range originals {
+		name := plan.name(original)
+		if other, ok := given[strings.ToLower(name)]; ok {
+			t.Errorf("%q and %q both named %q", other, original, name)
+		}
+		given[strings.ToLower(name)] = original
+		if len(name) > fatMaxNameBytes || !utf8.ValidString(name) || fatName(name) != name {
+			t.Errorf("%q named %q, which FAT does not take as it is", original, name)
+		}
+	}
+	if name := plan.name("c.wav"); name != "c.wav" {
+		t.Errorf("free valid name given as %q", name)
+	}
+
+	other := &namePlan{taken: make(map[string]bool)}
+	for _, original := range []string{"a?.wav", "a?.wav"} {
+		if name := other.name(original); name != original {
+			t.Errorf("%q renamed to %q off a FAT drive", original, name)
+		}
+	}
+}
+
+func TestRenameManifest(t *testing.T) {
+	dir := t.TempDir()
+	renamed := filepath.Join(dir, "con_.wav")
+	if err := os.WriteFile(renamed, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []copyJob{
+		{src: "/rec/s1/con.wav", dst: renamed},
+		{src: "/rec/s1/take.wav", dst: filepath.Join(dir, "take.wav")},
+	}
+	if err := writeRenameManifest(dir, jobs); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, renameManifestPrefix+"*.json"))
+	if len(matches) != 1 {
+		t.Fatalf("%d manifests, want one", len(matches))
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest renameManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := spanFile{Name: "con_.wav", Original: "con.wav", Source: "/rec/s1/con.wav", Size: 4}
+	if len(manifest.Files) != 1 || manifest.Files[0] != want {
+		t.Errorf("manifest lists %+v, want only %+v", manifest.Files, want)
+	}
+
+	// Nothing renamed, no manifest
+	other := t.TempDir()
+	if err := writeRenameManifest(other, jobs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(other); len(entries) != 0 {
+		t.Errorf("manifest written for a copy that renamed nothing")
+	}
+}
@@ -0,0 +1,50 @@
+package hardware
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBitmapFontCoversPrintableASCII(t *testing.T) {
+	d := newMemoryDisplay(nil)
+	for r := rune('!'); r <= '~'; r++ {
+		d.Clear()
+		d.DrawText(0, bitmapGlyphHeight, string(r))
+		lit := false
+		for _, p := range d.canvas.Pix {
+			lit = lit || p != 0
+		}
+		if !lit {
+			t.Errorf("%q draws nothing", r)
+		}
+	}
+}
+
+func TestFontlessManagerMeasuresText(t *testing.T) {
+	hm := NewFontlessManager()
+	if !hm.FontMissing() {
+		t.Error("fonts not reported missing")
+	}
+	if NewHeadlessManager().FontMissing() {
+		t.Error("bitmap font chosen on purpose reported as missing fonts")
+	}
+
+	// The bitmap font has one size, so every context measures the same
+	for _, context := range []string{"status", "idle", "details", "menu", "header", "recording", "alert", ""} {
+		if err := hm.SwitchToContext(context); err != nil {
+			t.Errorf("context %q: %v", context, err)
+		}
+		if got := hm.GetTextWidth("Ch 17"); got != 4*bitmapAdvance+bitmapGlyphWidth {
+			t.Errorf("context %q: \"Ch 17\" is %d pixels wide", context, got)
+		}
+		if got := hm.GetFontHeight(); got != bitmapLineHeight {
+			t.Errorf("context %q: font %d pixels high, want %d", context, got, bitmapLineHeight)
+		}
+	}
+
+	long := strings.Repeat("Recording ", 10)
+	fitted := hm.FitText(long, 100)
+	if hm.GetTextWidth(fitted) > 100 || !strings.HasSuffix(fitted, "…") {
+		t.Errorf("FitText() = %q, %d pixels wide", fitted, hm.GetTextWidth(fitted))
+	}
+}
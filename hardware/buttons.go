@@ -3,6 +3,7 @@ package hardware
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/gpio/gpioreg"
@@ -26,8 +27,9 @@ type Button struct {
 }
 
 type ButtonManager struct {
-	buttons []*Button
-	mutex   sync.Mutex
+	buttons  []*Button
+	mutex    sync.Mutex
+	interval atomic.Int64 // Poll interval in nanoseconds; see SetPollInterval
 }
 
 func NewButtonManager() (*ButtonManager, error) {
@@ -75,22 +77,33 @@ func NewButtonManager() (*ButtonManager, error) {
 	}
 
 	// Start monitoring goroutine
+	bm.interval.Store(int64(5 * time.Millisecond))
 	go bm.monitor()
 
 	return bm, nil
 }
 
 func (bm *ButtonManager) monitor() {
-	ticker := time.NewTicker(5 * time.Millisecond)
+	interval := time.Duration(bm.interval.Load())
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		for _, button := range bm.buttons {
 			bm.readButton(button)
 		}
+		if d := time.Duration(bm.interval.Load()); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
 	}
 }
 
+// SetPollInterval changes how often the buttons are sampled
+func (bm *ButtonManager) SetPollInterval(d time.Duration) {
+	bm.interval.Store(int64(d))
+}
+
 func (bm *ButtonManager) readButton(button *Button) {
 	currentState := button.pin.Read() == gpio.Low // Active low (pressed when low)
 
@@ -138,6 +151,32 @@ func (bm *ButtonManager) IsPressed(buttonType ButtonType) bool {
 	return false
 }
 
+// Held returns the buttons held down right now, read from the pins rather
+// than the monitor so it can be used straight after NewButtonManager. A
+// button counts as held only if it stays down for the debounce time.
+func (bm *ButtonManager) Held() []ButtonType {
+	down := make([]bool, len(bm.buttons))
+	for i := range down {
+		down[i] = true
+	}
+	for sample := 0; sample < 5; sample++ {
+		if sample > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for i, button := range bm.buttons {
+			down[i] = down[i] && button.pin.Read() == gpio.Low
+		}
+	}
+
+	var held []ButtonType
+	for i, button := range bm.buttons {
+		if down[i] {
+			held = append(held, button.buttonType)
+		}
+	}
+	return held
+}
+
 func (bt ButtonType) String() string {
 	switch bt {
 	case RecordButton:
@@ -0,0 +1,154 @@
+package hardware
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCPLease holds the timing of the current DHCP lease for an interface
+type DHCPLease struct {
+	Obtained time.Time
+	Expires  time.Time
+}
+
+// dhcpcdLeaseDirs are searched for dhcpcd's binary lease files
+var dhcpcdLeaseDirs = []string{"/var/lib/dhcpcd", "/var/lib/dhcpcd5", "/var/db/dhcpcd"}
+
+// dhclientLeaseFiles are the usual locations of dhclient's text lease database
+var dhclientLeaseFiles = []string{
+	"/var/lib/dhcp/dhclient.%s.leases",
+	"/var/lib/dhcp/dhclient.leases",
+	"/var/lib/dhclient/dhclient.%s.leases",
+}
+
+// readDHCPLease looks for a lease for the interface from dhcpcd or dhclient.
+// It returns nil when no lease file can be found or parsed.
+func readDHCPLease(interfaceName string) *DHCPLease {
+	for _, dir := range dhcpcdLeaseDirs {
+		if lease, err := parseDhcpcdLease(filepath.Join(dir, interfaceName+".lease")); err == nil {
+			return lease
+		}
+	}
+
+	for _, pattern := range dhclientLeaseFiles {
+		path := pattern
+		if strings.Contains(pattern, "%s") {
+			path = fmt.Sprintf(pattern, interfaceName)
+		}
+		if lease, err := parseDhclientLeases(path, interfaceName); err == nil {
+			return lease
+		}
+	}
+
+	return nil
+}
+
+// parseDhcpcdLease reads a dhcpcd lease file, which holds the raw DHCP ACK.
+// dhcpcd writes the file when the lease is obtained, so its modification
+// time is the obtained time.
+func parseDhcpcdLease(path string) (*DHCPLease, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// BOOTP fixed header is 236 bytes followed by the DHCP magic cookie
+	const optionsStart = 240
+	if len(data) < optionsStart || binary.BigEndian.Uint32(data[236:240]) != 0x63825363 {
+		return nil, fmt.Errorf("%s is not a DHCP message", path)
+	}
+
+	lease := &DHCPLease{Obtained: info.ModTime()}
+	for i := optionsStart; i < len(data); {
+		code := data[i]
+		if code == 0 { // Pad
+			i++
+			continue
+		}
+		if code == 255 || i+1 >= len(data) { // End
+			break
+		}
+		length := int(data[i+1])
+		if i+2+length > len(data) {
+			break
+		}
+		value := data[i+2 : i+2+length]
+		if code == 51 && length == 4 { // IP address lease time
+			seconds := binary.BigEndian.Uint32(value)
+			lease.Expires = lease.Obtained.Add(time.Duration(seconds) * time.Second)
+		}
+		i += 2 + length
+	}
+
+	if lease.Expires.IsZero() {
+		return nil, fmt.Errorf("%s has no lease time", path)
+	}
+	return lease, nil
+}
+
+// parseDhclientLeases reads the last lease block for the interface from a
+// dhclient lease database
+func parseDhclientLeases(path, interfaceName string) (*DHCPLease, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var found *DHCPLease
+	var current *DHCPLease
+	var currentIface string
+	var leaseTime time.Duration
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "lease" && strings.HasSuffix(line, "{"):
+			current = &DHCPLease{}
+			currentIface = ""
+			leaseTime = 0
+		case current == nil:
+			continue
+		case fields[0] == "interface" && len(fields) >= 2:
+			currentIface = strings.Trim(fields[1], `"`)
+		case fields[0] == "option" && len(fields) >= 3 && fields[1] == "dhcp-lease-time":
+			if seconds, err := strconv.Atoi(fields[2]); err == nil {
+				leaseTime = time.Duration(seconds) * time.Second
+			}
+		case fields[0] == "expire" && len(fields) >= 4:
+			// expire <weekday> <yyyy/mm/dd> <hh:mm:ss> (UTC)
+			if t, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3]); err == nil {
+				current.Expires = t
+			}
+		case fields[0] == "}":
+			if currentIface == interfaceName && !current.Expires.IsZero() {
+				if leaseTime > 0 {
+					current.Obtained = current.Expires.Add(-leaseTime)
+				}
+				found = current
+			}
+			current = nil
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no lease for %s in %s", interfaceName, path)
+	}
+	return found, nil
+}
@@ -0,0 +1,43 @@
+package hardware
+
+import "errors"
+
+// ErrDisplayOffline is returned instead of sending anything to a display
+// that has been taken offline
+var ErrDisplayOffline = errors.New("display offline")
+
+// SetOffline stops or resumes sending frames and commands. Drawing carries
+// on into the canvas, so snapshots still show what the screen would.
+func (d *TTFDisplay) SetOffline(offline bool) {
+	d.offline = offline
+}
+
+// Reinit resets the controller and sends the initialization sequence again,
+// bringing the display back online if that succeeds
+func (d *TTFDisplay) Reinit() error {
+	if err := d.init(); err != nil {
+		return err
+	}
+	d.offline = false
+	return nil
+}
+
+// SetDisplayOffline stops or resumes display updates
+func (hm *HardwareManager) SetDisplayOffline(offline bool) {
+	if hm.FiraCode != nil && hm.FiraCode.display != nil {
+		hm.FiraCode.display.SetOffline(offline)
+	}
+}
+
+// DisplayOffline reports whether display updates are stopped
+func (hm *HardwareManager) DisplayOffline() bool {
+	return hm.FiraCode != nil && hm.FiraCode.display != nil && hm.FiraCode.display.offline
+}
+
+// ReinitDisplay re-initializes the display controller. See TTFDisplay.Reinit.
+func (hm *HardwareManager) ReinitDisplay() error {
+	if hm.FiraCode == nil || hm.FiraCode.display == nil {
+		return errors.New("display not initialized")
+	}
+	return hm.FiraCode.display.Reinit()
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	"io/ioutil"
 	"log"
 
@@ -28,10 +27,29 @@ type TTFDisplay struct {
 	buffer    []byte
 	font      font.Face
 	canvas    *image.Gray
-	svgLoader *SVGLoader
+	svgLoader  *SVGLoader
+	offline    bool // Frames are not sent; see SetOffline
+	brightness int  // Percent of the full contrast current; see SetBrightness
 }
 
 func NewTTFDisplay(fontPath string, fontSize float64) (*TTFDisplay, error) {
+	// Load TTF font
+	fontFace, err := loadTTFFont(fontPath, fontSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font: %v", err)
+	}
+	return openDisplay(fontFace)
+}
+
+// NewBitmapDisplay opens the display with the built-in 5x7 bitmap font, for
+// when no TTF font can be loaded
+func NewBitmapDisplay() (*TTFDisplay, error) {
+	return openDisplay(newBitmapFace())
+}
+
+// openDisplay sets up SPI and the control pins and initializes the display
+// to draw text in fontFace
+func openDisplay(fontFace font.Face) (*TTFDisplay, error) {
 	if _, err := host.Init(); err != nil {
 		return nil, fmt.Errorf("failed to initialize periph: %v", err)
 	}
@@ -65,21 +83,16 @@ func NewTTFDisplay(fontPath string, fontSize float64) (*TTFDisplay, error) {
 		return nil, fmt.Errorf("failed to set RES pin: %v", err)
 	}
 
-	// Load TTF font
-	fontFace, err := loadTTFFont(fontPath, fontSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load font: %v", err)
-	}
-
 	d := &TTFDisplay{
-		spiPort:   spiPort,
-		spiConn:   spiConn,
-		dcPin:     dcPin,
-		resPin:    resPin,
-		buffer:    make([]byte, DisplayWidth*DisplayHeight/2), // 4 bits per pixel for SSD1322
-		font:      fontFace,
-		canvas:    image.NewGray(image.Rect(0, 0, DisplayWidth, DisplayHeight)),
-		svgLoader: NewSVGLoader("./svg"), // Initialize SVG loader with svg directory
+		spiPort:    spiPort,
+		spiConn:    spiConn,
+		dcPin:      dcPin,
+		resPin:     resPin,
+		buffer:     make([]byte, DisplayWidth*DisplayHeight/2), // 4 bits per pixel for SSD1322
+		font:       fontFace,
+		canvas:     image.NewGray(image.Rect(0, 0, DisplayWidth, DisplayHeight)),
+		svgLoader:  NewSVGLoader("./svg"), // Initialize SVG loader with svg directory
+		brightness: 100,
 	}
 
 	if err := d.init(); err != nil {
@@ -136,7 +149,7 @@ func (d *TTFDisplay) init() error {
 		{0xB5, 0x00}, // GPIO
 		{0xAB, 0x01}, // Function selection
 		{0xB4, 0xA0, 0xB5, 0x55}, // Display enhancement
-		{0xC1, 0x9F}, // Contrast current
+		{0xC1, d.contrast(normalContrast)}, // Contrast current
 		{0xC7, 0x0F}, // Master contrast current control
 		{0xB1, 0xE2}, // Phase length
 		{0xD1, 0x82, 0x20}, // Display enhancement B
@@ -156,14 +169,58 @@ func (d *TTFDisplay) init() error {
 	return nil
 }
 
+// Contrast currents for normal drawing and for a flash
+const (
+	normalContrast = 0x9F
+	flashContrast  = 0xFF
+)
+
+// SetFlash raises the contrast current for a brief brightness pulse, or
+// restores it. It is a single command, so it costs no frame upload.
+func (d *TTFDisplay) SetFlash(on bool) error {
+	if d.offline {
+		return ErrDisplayOffline
+	}
+	level := d.contrast(normalContrast)
+	if on {
+		level = d.contrast(flashContrast)
+	}
+	return d.writeCommand([]byte{0xC1, level})
+}
+
+// SetBrightness caps the contrast current at percent of the full level,
+// flashes included. An offline display takes it on its next Reinit.
+func (d *TTFDisplay) SetBrightness(percent int) error {
+	d.brightness = percent
+	if d.offline {
+		return ErrDisplayOffline
+	}
+	return d.writeCommand([]byte{0xC1, d.contrast(normalContrast)})
+}
+
+// contrast scales a contrast current by the brightness cap
+func (d *TTFDisplay) contrast(level int) byte {
+	return byte(level * d.brightness / 100)
+}
+
 func (d *TTFDisplay) writeCommand(cmd []byte) error {
-	d.dcPin.Out(gpio.Low) // Command mode
-	return d.spiConn.Tx(cmd, nil)
+	if err := d.dcPin.Out(gpio.Low); err != nil { // Command mode
+		return fmt.Errorf("DC pin: %w", err)
+	}
+	if err := d.spiConn.Tx(cmd, nil); err != nil {
+		return fmt.Errorf("SPI command 0x%02X: %w", cmd[0], err)
+	}
+	return nil
 }
 
 func (d *TTFDisplay) writeData(data []byte) error {
-	d.dcPin.Out(gpio.High) // Data mode
-	return d.spiConn.Tx(data, nil)
+	if err := d.dcPin.Out(gpio.High); err != nil { // Data mode
+		return fmt.Errorf("DC pin: %w", err)
+	}
+	if err := d.spiConn.Tx(data, nil); err != nil {
+		return fmt.Errorf("SPI data, %d bytes: %w", len(data), err)
+	}
+	return nil
 }
 
 func (d *TTFDisplay) Clear() {
@@ -251,27 +308,47 @@ func (d *TTFDisplay) getNetworkIconSmall() [8][8]byte {
 
 
 func (d *TTFDisplay) DrawText(x, y int, text string) {
-	// Clear the canvas area where text will be drawn
-	bounds := d.getTextBounds(text)
-	clearRect := image.Rect(x, y-bounds.Max.Y, x+bounds.Max.X, y)
-	draw.Draw(d.canvas, clearRect, &image.Uniform{color.Gray{0}}, image.Point{}, draw.Src)
+	d.drawTextGray(x, y, text, 255)
+}
+
+// DrawDimText draws text at reduced brightness, e.g. for unavailable items
+func (d *TTFDisplay) DrawDimText(x, y int, text string) {
+	d.drawTextGray(x, y, text, dimTextGray)
+}
 
+// dimTextGray is the canvas level of dimmed text, about a third of full
+const dimTextGray = 85
+
+func (d *TTFDisplay) drawTextGray(x, y int, text string, gray uint8) {
 	// Create a drawer for rendering text
 	drawer := &font.Drawer{
 		Dst:  d.canvas,
-		Src:  &image.Uniform{color.Gray{255}}, // White text
+		Src:  image.NewUniform(color.Gray{gray}),
 		Face: d.font,
 		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
 	}
 
+	// Clear the canvas area where text will be drawn
+	ink, _ := drawer.BoundString(text)
+	width, height := (ink.Max.X-ink.Min.X).Floor(), (ink.Max.Y-ink.Min.Y).Floor()
+	clearRect := image.Rect(x, y-height, x+width, y).Intersect(d.canvas.Rect)
+	for row := clearRect.Min.Y; row < clearRect.Max.Y; row++ {
+		start := row*d.canvas.Stride + clearRect.Min.X
+		clear(d.canvas.Pix[start : start+clearRect.Dx()])
+	}
+
 	// Draw the text
 	drawer.DrawString(text)
 
-	// Convert rendered text to display buffer
-	d.canvasToBuffer()
+	// Convert only what changed to the display buffer: the cleared area and
+	// the glyphs, which may reach past it, with a pixel to spare for glyph
+	// positions being rounded
+	glyphs := image.Rect(ink.Min.X.Floor(), ink.Min.Y.Floor(), ink.Max.X.Ceil(), ink.Max.Y.Ceil()).Inset(-1)
+	d.convertRect(clearRect.Union(glyphs))
 }
 
 func (d *TTFDisplay) DrawTextCentered(text string, y int) {
+	text = d.FitText(text, DisplayWidth-4)
 	bounds := d.getTextBounds(text)
 	x := (DisplayWidth - bounds.Max.X) / 2
 	if x < 0 {
@@ -309,31 +386,65 @@ func (d *TTFDisplay) GetTextWidth(text string) int {
 	return bounds.Max.X
 }
 
+// FitText shortens text with an ellipsis so it fits within maxWidth pixels
+func (d *TTFDisplay) FitText(text string, maxWidth int) string {
+	if d.GetTextWidth(text) <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if candidate := string(runes) + "…"; d.GetTextWidth(candidate) <= maxWidth {
+			return candidate
+		}
+	}
+	return ""
+}
+
 func (d *TTFDisplay) GetFontHeight() int {
 	metrics := d.font.Metrics()
 	return int(metrics.Height >> 6) // Convert from fixed.Int26_6
 }
 
+// canvasToBuffer converts the whole canvas to the display buffer
 func (d *TTFDisplay) canvasToBuffer() {
-	// Convert grayscale canvas to 4-bit buffer for SSD1322
-	for y := 0; y < DisplayHeight; y++ {
-		for x := 0; x < DisplayWidth; x++ {
-			grayVal := d.canvas.GrayAt(x, y).Y
-			brightness := byte(grayVal / 17) // Convert 0-255 to 0-15
-			
-			if brightness > 15 {
-				brightness = 15
-			}
-			
-			bufferIndex := (y*DisplayWidth + x) / 2
-			
-			if x%2 == 0 {
-				// Even pixel (upper nibble)
-				d.buffer[bufferIndex] = (d.buffer[bufferIndex] & 0x0F) | ((brightness & 0x0F) << 4)
-			} else {
-				// Odd pixel (lower nibble)
-				d.buffer[bufferIndex] = (d.buffer[bufferIndex] & 0xF0) | (brightness & 0x0F)
-			}
+	d.convertRect(d.canvas.Rect)
+}
+
+// grayLevels maps each canvas gray to its 4-bit display brightness
+var grayLevels = func() (levels [256]byte) {
+	for gray := range levels {
+		levels[gray] = byte(gray / 17)
+	}
+	return levels
+}()
+
+// convertRect converts the canvas pixels within r to the 4-bit display
+// buffer, where each byte holds two pixels with the left one in the upper
+// nibble. It works on whole rows of canvas.Pix, so drawing a short string
+// only costs the pixels it covers.
+func (d *TTFDisplay) convertRect(r image.Rectangle) {
+	r = r.Intersect(d.canvas.Rect)
+	if r.Empty() {
+		return
+	}
+
+	const rowBytes = DisplayWidth / 2
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := d.canvas.Pix[y*d.canvas.Stride : y*d.canvas.Stride+DisplayWidth]
+		out := d.buffer[y*rowBytes : (y+1)*rowBytes]
+		x := r.Min.X
+		if x%2 == 1 {
+			// Odd pixel (lower nibble) of a byte shared with the left
+			out[x/2] = out[x/2]&0xF0 | grayLevels[row[x]]
+			x++
+		}
+		for ; x+1 < r.Max.X; x += 2 {
+			out[x/2] = grayLevels[row[x]]<<4 | grayLevels[row[x+1]]
+		}
+		if x < r.Max.X {
+			// Even pixel (upper nibble) of a byte shared with the right
+			out[x/2] = out[x/2]&0x0F | grayLevels[row[x]]<<4
 		}
 	}
 }
@@ -384,6 +495,9 @@ func (d *TTFDisplay) FillBox(x, y, width, height int, brightness byte) {
 }
 
 func (d *TTFDisplay) Update() error {
+	if d.offline {
+		return ErrDisplayOffline
+	}
 	// Set column address
 	if err := d.writeCommand([]byte{0x15, 0x1C, 0x5B}); err != nil {
 		return err
@@ -541,6 +655,9 @@ func (d *TTFDisplay) DrawNetworkStatus(x, y int, connected bool, ipAddr string)
 	}
 }
 
+// statusIndicatorWidth is the width of an 8px icon plus a three letter label
+const statusIndicatorWidth = 10 + 3*6
+
 // DrawUSBStatus draws USB connection status with icon and text
 func (d *TTFDisplay) DrawUSBStatus(x, y int, connected bool, size string) {
 	// Draw USB icon
@@ -568,63 +685,55 @@ func (d *TTFDisplay) DrawUSBStatus(x, y int, connected bool, size string) {
 	}
 }
 
-// drawSimpleChar draws a simple 5x7 character for status indicators
+// drawSimpleChar draws a 5x7 character from the bitmap font for status
+// indicators
 func (d *TTFDisplay) drawSimpleChar(x, y int, char byte, brightness byte) {
-	var charData [7]byte
-	
-	switch char {
-	case 'U':
-		charData = [7]byte{0x1E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}
-	case 'S':
-		charData = [7]byte{0x0E, 0x11, 0x10, 0x0E, 0x01, 0x11, 0x0E}
-	case 'B':
-		charData = [7]byte{0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E}
-	case '-':
-		charData = [7]byte{0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00}
-	default:
-		charData = [7]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	}
-	
-	// Draw character bitmap
-	for row := 0; row < 7; row++ {
-		for col := 0; col < 5; col++ {
-			if charData[row]&(1<<(4-col)) != 0 {
+	glyph := bitmapGlyph(char)
+	for col := 0; col < bitmapGlyphWidth; col++ {
+		for row := 0; row < bitmapGlyphHeight; row++ {
+			if glyph[col]&(1<<row) != 0 {
 				d.SetPixel(x+col, y+row, brightness)
 			}
 		}
 	}
 }
 
-// DrawStatusBarWithIcons draws the status bar with USB and network icon integration
-func (d *TTFDisplay) DrawStatusBarWithIcons(formatInfo, usbInfo string, usbConnected bool, networkConnected bool, ipAddr string) {
-	// Clear status bar area
-	d.FillBox(0, 0, DisplayWidth, 12, 0)
-	
-	// Draw format info on the left
-	d.DrawText(2, 10, formatInfo)
-	
-	// Calculate positions for icons on the right
-	rightMargin := 8
-	currentX := DisplayWidth - rightMargin
-	
-	// Draw USB status with icon (rightmost)
-	usbX := currentX - 40 // Reserve space for USB icon + text
-	d.DrawUSBStatus(usbX, 2, usbConnected, "small")
-	currentX = usbX - 5
-	
-	// Draw network status with icon (left of USB)
-	netX := currentX - 40 // Reserve space for network icon + text
-	d.DrawNetworkStatus(netX, 2, networkConnected, ipAddr)
-	currentX = netX - 5
-	
-	// Draw USB info text if connected and space allows
+// DrawStatusBarWithIcons draws the status bar with USB and network icon integration.
+// Extra elements (clock, storage, lock icon...) are laid out alongside the
+// built-in ones according to their priority.
+func (d *TTFDisplay) DrawStatusBarWithIcons(formatInfo, usbInfo string, usbConnected bool, networkConnected bool, ipAddr string, extras ...StatusElement) {
+	elements := []StatusElement{
+		// Format info on the left
+		TextStatusElement("format", formatInfo, AlignLeft, 100),
+		// USB status with icon (rightmost)
+		{
+			Name:     "usb",
+			Align:    AlignRight,
+			Priority: 90,
+			Measure:  func(d *TTFDisplay) int { return statusIndicatorWidth },
+			Draw: func(d *TTFDisplay, x, y int) {
+				d.DrawUSBStatus(x, y+2, usbConnected, "small")
+			},
+		},
+		// Network status with icon (left of USB)
+		{
+			Name:     "network",
+			Align:    AlignRight,
+			Priority: 80,
+			Measure:  func(d *TTFDisplay) int { return statusIndicatorWidth },
+			Draw: func(d *TTFDisplay, x, y int) {
+				d.DrawNetworkStatus(x, y+2, networkConnected, ipAddr)
+			},
+		},
+	}
+	elements = append(elements, extras...)
+
+	// USB info text is the first thing to go when space is short
 	if usbConnected && usbInfo != "" {
-		infoWidth := d.GetTextWidth(usbInfo)
-		infoX := currentX - infoWidth - 5
-		if infoX > d.GetTextWidth(formatInfo) + 10 {
-			d.DrawText(infoX, 10, usbInfo)
-		}
+		elements = append(elements, TextStatusElement("usbinfo", usbInfo, AlignRight, 10))
 	}
+
+	d.DrawStatusBarElements(elements)
 }
 
 // DrawStatusBarWithUSB draws the status bar with USB icon integration
@@ -648,14 +757,15 @@ func (d *TTFDisplay) Close() error {
 	return nil
 }
 
-// Helper function to create display with default font if TTF loading fails
-func NewDisplayWithFallback(fontPath string, fontSize float64) (*TTFDisplay, error) {
-	// Try to load TTF font first
-	display, err := NewTTFDisplay(fontPath, fontSize)
-	if err != nil {
-		log.Printf("Failed to load TTF font, falling back to bitmap font: %v", err)
-		// Could fallback to original bitmap font implementation here
-		return nil, err
-	}
-	return display, nil
+// NewDisplayWithFallback opens the display with a TTF font, falling back to
+// the built-in bitmap font if the TTF cannot be loaded. bitmap reports
+// whether the fallback is in use.
+func NewDisplayWithFallback(fontPath string, fontSize float64) (display *TTFDisplay, bitmap bool, err error) {
+	display, err = NewTTFDisplay(fontPath, fontSize)
+	if err == nil {
+		return display, false, nil
+	}
+	log.Printf("Failed to load TTF font, falling back to bitmap font: %v", err)
+	display, err = NewBitmapDisplay()
+	return display, true, err
 }
\ No newline at end of file
@@ -0,0 +1,223 @@
+package hardware
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// referenceDisplay draws as the display did before conversion worked on
+// rows: text clears its area with draw.Draw and every change converts the
+// whole canvas pixel by pixel
+type referenceDisplay struct {
+	canvas *image.Gray
+	buffer []byte
+	font   font.Face
+}
+
+func newReferenceDisplay(face font.Face) *referenceDisplay {
+	return &referenceDisplay{
+		canvas: image.NewGray(image.Rect(0, 0, DisplayWidth, DisplayHeight)),
+		buffer: make([]byte, DisplayWidth*DisplayHeight/2),
+		font:   face,
+	}
+}
+
+func (r *referenceDisplay) drawText(x, y int, text string, gray uint8) {
+	bounds, _ := (&font.Drawer{Face: r.font}).BoundString(text)
+	width, height := int(bounds.Max.X-bounds.Min.X)>>6, int(bounds.Max.Y-bounds.Min.Y)>>6
+	draw.Draw(r.canvas, image.Rect(x, y-height, x+width, y), &image.Uniform{color.Gray{0}}, image.Point{}, draw.Src)
+	drawer := &font.Drawer{
+		Dst:  r.canvas,
+		Src:  &image.Uniform{color.Gray{gray}},
+		Face: r.font,
+		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
+	}
+	drawer.DrawString(text)
+	r.canvasToBuffer()
+}
+
+func (r *referenceDisplay) canvasToBuffer() {
+	for y := 0; y < DisplayHeight; y++ {
+		for x := 0; x < DisplayWidth; x++ {
+			brightness := r.canvas.GrayAt(x, y).Y / 17
+			if brightness > 15 {
+				brightness = 15
+			}
+			i := (y*DisplayWidth + x) / 2
+			if x%2 == 0 {
+				r.buffer[i] = r.buffer[i]&0x0F | brightness<<4
+			} else {
+				r.buffer[i] = r.buffer[i]&0xF0 | brightness
+			}
+		}
+	}
+}
+
+func (r *referenceDisplay) fillBox(x, y, width, height int, brightness byte) {
+	for py := y; py < y+height; py++ {
+		for px := x; px < x+width; px++ {
+			if px < 0 || px >= DisplayWidth || py < 0 || py >= DisplayHeight {
+				continue
+			}
+			r.canvas.SetGray(px, py, color.Gray{Y: brightness * 17})
+			i := (py*DisplayWidth + px) / 2
+			if px%2 == 0 {
+				r.buffer[i] = r.buffer[i]&0x0F | brightness<<4
+			} else {
+				r.buffer[i] = r.buffer[i]&0xF0 | brightness
+			}
+		}
+	}
+}
+
+// testFaces are the faces the display is compared in: the bitmap font and
+// TTF faces at the sizes the UI uses
+func testFaces(t testing.TB) map[string]font.Face {
+	faces := map[string]font.Face{"bitmap": newBitmapFace()}
+	for _, f := range []struct {
+		name string
+		ttf  []byte
+		size float64
+	}{
+		{"regular 8", goregular.TTF, 8},
+		{"regular 11", goregular.TTF, 11},
+		{"mono 9", gomono.TTF, 9},
+		{"bold 13", gobold.TTF, 13},
+		{"bold 16", gobold.TTF, 16},
+	} {
+		parsed, err := opentype.Parse(f.ttf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: f.size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			t.Fatal(err)
+		}
+		faces[f.name] = face
+	}
+	return faces
+}
+
+// testStrings are drawn in the comparison, including glyphs the faces lack
+var testStrings = []string{
+	"", "A", "48k/24/2ch", "REC 00:12:34", "192.168.100.200", "USB 256GB free of 512GB",
+	"Recording_20240320_ch64_96kHz.wav", "▾ Session …", "gjpqy|", "µs ±0.5dB", "Ω→✓",
+}
+
+func TestTextConversionMatchesReference(t *testing.T) {
+	for name, face := range testFaces(t) {
+		rng := rand.New(rand.NewSource(1))
+		d := newMemoryDisplay(nil)
+		d.font = face
+		ref := newReferenceDisplay(face)
+
+		for frame := 0; frame < 400; frame++ {
+			d.Clear()
+			clear(ref.canvas.Pix)
+			clear(ref.buffer)
+			for op := 0; op < 8; op++ {
+				x, y := rng.Intn(300)-20, rng.Intn(90)-10
+				var what string
+				switch rng.Intn(4) {
+				case 0:
+					w, h, b := rng.Intn(80), rng.Intn(30), byte(rng.Intn(16))
+					d.FillBox(x, y, w, h, b)
+					ref.fillBox(x, y, w, h, b)
+					what = fmt.Sprintf("box %dx%d at %d,%d", w, h, x, y)
+				case 1:
+					text := testStrings[rng.Intn(len(testStrings))]
+					d.DrawDimText(x, y, text)
+					ref.drawText(x, y, text, dimTextGray)
+					what = fmt.Sprintf("dim %q at %d,%d", text, x, y)
+				default:
+					text := testStrings[rng.Intn(len(testStrings))]
+					d.DrawText(x, y, text)
+					ref.drawText(x, y, text, 255)
+					what = fmt.Sprintf("%q at %d,%d", text, x, y)
+				}
+				if !bytes.Equal(d.canvas.Pix, ref.canvas.Pix) {
+					t.Fatalf("%s frame %d: canvas differs after %s", name, frame, what)
+				}
+				if !bytes.Equal(d.buffer, ref.buffer) {
+					t.Fatalf("%s frame %d: buffer differs after %s", name, frame, what)
+				}
+			}
+		}
+	}
+}
+
+func TestCanvasConversionEveryGray(t *testing.T) {
+	d := newMemoryDisplay(nil)
+	ref := newReferenceDisplay(nil)
+	for gray := 0; gray < 256; gray++ {
+		for i := range d.canvas.Pix {
+			// Alternate with the neighbouring level so both nibbles vary
+			g := byte(gray)
+			if i%2 == 1 {
+				g = byte(255 - gray)
+			}
+			d.canvas.Pix[i], ref.canvas.Pix[i] = g, g
+		}
+		d.canvasToBuffer()
+		ref.canvasToBuffer()
+		if !bytes.Equal(d.buffer, ref.buffer) {
+			t.Fatalf("gray %d converts differently", gray)
+		}
+	}
+}
+
+func BenchmarkCanvasToBuffer(b *testing.B) {
+	d := newMemoryDisplay(nil)
+	for i := 0; i < b.N; i++ {
+		d.canvasToBuffer()
+	}
+}
+
+func BenchmarkCanvasToBufferReference(b *testing.B) {
+	ref := newReferenceDisplay(nil)
+	for i := 0; i < b.N; i++ {
+		ref.canvasToBuffer()
+	}
+}
+
+// statusBarText is a typical status bar update
+const statusBarText = "48k/24/2ch"
+
+func BenchmarkStatusBarText(b *testing.B) {
+	for _, name := range []string{"bitmap", "regular 8"} {
+		b.Run(name, func(b *testing.B) {
+			d := newMemoryDisplay(nil)
+			d.font = testFaces(b)[name]
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.DrawText(2, 9, statusBarText)
+			}
+		})
+	}
+}
+
+func BenchmarkStatusBarTextReference(b *testing.B) {
+	for _, name := range []string{"bitmap", "regular 8"} {
+		b.Run(name, func(b *testing.B) {
+			ref := newReferenceDisplay(testFaces(b)[name])
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ref.drawText(2, 9, statusBarText, 255)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package hardware
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/gpio/gpioreg"
@@ -18,6 +19,7 @@ type Encoder struct {
 	buttonDown bool
 	buttonTime time.Time
 	mutex      sync.Mutex
+	interval   atomic.Int64 // Poll interval in nanoseconds; see SetPollInterval
 	callbacks  struct {
 		onRotate func(direction int)  // +1 for clockwise, -1 for counter-clockwise
 		onClick  func()
@@ -58,6 +60,7 @@ func NewEncoder() (*Encoder, error) {
 		lastB:     pinB.Read(),
 		position:  0,
 	}
+	e.interval.Store(int64(time.Millisecond))
 
 	// Start monitoring goroutine
 	go e.monitor()
@@ -66,15 +69,26 @@ func NewEncoder() (*Encoder, error) {
 }
 
 func (e *Encoder) monitor() {
-	ticker := time.NewTicker(1 * time.Millisecond)
+	interval := time.Duration(e.interval.Load())
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		e.readEncoder()
 		e.readButton()
+		if d := time.Duration(e.interval.Load()); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
 	}
 }
 
+// SetPollInterval changes how often the pins are sampled. Slower polling
+// saves power but can miss detents on a fast spin.
+func (e *Encoder) SetPollInterval(d time.Duration) {
+	e.interval.Store(int64(d))
+}
+
 func (e *Encoder) readEncoder() {
 	currentA := e.pinA.Read()
 	currentB := e.pinB.Read()
@@ -5,6 +5,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"pi9696/i18n"
 )
 
 // FiraCodeManager handles FiraCode font integration for PI9696
@@ -13,42 +17,147 @@ type FiraCodeManager struct {
 	config      *FiraCodeConfig
 	currentFont string
 	currentSize float64
+	bitmapFont  bool // Drawing with the built-in bitmap font; contexts have no effect
+	bitmapAsked bool // The bitmap font was chosen with UseBitmapFont, not forced by missing fonts
 }
 
 // FiraCodeConfig holds all FiraCode font variants and settings
 type FiraCodeConfig struct {
-	BasePath   string
-	Regular    string
-	Bold       string
-	Light      string
-	Medium     string
-	SemiBold   string
-	Retina     string
-	sizes      map[string]float64
-}
-
-// NewFiraCodeManager creates a new FiraCode font manager
-func NewFiraCodeManager() (*FiraCodeManager, error) {
-	config := &FiraCodeConfig{
-		BasePath: "./fonts",
-		sizes: map[string]float64{
-			"StatusBar":    9.0,  // Top status bar - compact but readable
-			"MainContent":  11.0, // Primary content - optimal balance
-			"MenuItems":    10.0, // Menu navigation - clean spacing
-			"Headers":      13.0, // Section headers - prominent
-			"Recording":    14.0, // Recording indicator - attention grabbing
-			"Small":        8.0,  // Fine details - minimum readable
-			"Large":        16.0, // Alerts/emphasis - maximum for display
-		},
+	BasePath     string
+	Regular      string
+	Bold         string
+	Light        string
+	Medium       string
+	SemiBold     string
+	Retina       string
+	sizes        map[string]float64
+	contextSizes map[string]float64 // Per-context size overrides
+}
+
+// FontOverrides replaces parts of the built-in font setup; anything left
+// empty keeps its default. File names are relative to Dir unless absolute.
+// In the config file:
+//
+//	"fonts": {
+//	  "dir": "/usr/share/fonts/truetype/jetbrains-mono",
+//	  "files": {
+//	    "Regular": "JetBrainsMono-Regular.ttf",
+//	    "Bold": "JetBrainsMono-Bold.ttf"
+//	  },
+//	  "sizes": {"recording": 16, "statusbar": 10}
+//	}
+type FontOverrides struct {
+	Dir   string             // Directory holding the font files
+	Files map[string]string  // Weight (see FontWeights) to font file
+	Sizes map[string]float64 // Context (see FontContexts) to point size
+}
+
+// FontWeights are the font variants a context can be drawn in
+var FontWeights = []string{"Regular", "Bold", "Light", "Medium", "SemiBold", "Retina"}
+
+// contextWeights picks the variant for each UI context; unlisted contexts
+// use Regular
+var contextWeights = map[string]string{
+	"statusbar": "Regular", "time": "Regular", "counters": "Regular", "storage": "Regular",
+	"recording": "Bold", "alert": "Bold", "error": "Bold", "warning": "Bold",
+	"menu": "Regular", "navigation": "Regular", "settings": "Regular",
+	"details": "Light", "filename": "Light", "path": "Light", "metadata": "Light",
+	"emphasis": "SemiBold", "selected": "SemiBold", "active": "SemiBold",
+	"header": "Medium", "title": "Medium", "section": "Medium",
+	"standby": "Regular", "idle": "Regular",
+}
+
+// contextSizeNames picks the size for each UI context; unlisted contexts
+// use MainContent
+var contextSizeNames = map[string]string{
+	"statusbar": "StatusBar",
+	"recording": "Recording", "alert": "Recording", "header": "Recording",
+	"menu": "MenuItems", "navigation": "MenuItems", "settings": "MenuItems",
+	"title": "Headers", "section": "Headers",
+	"details": "Small", "filename": "Small", "metadata": "Small",
+	"emphasis": "Large", "large": "Large",
+}
+
+// FontContexts lists the UI context names sizes can be set for
+func FontContexts() []string {
+	seen := make(map[string]bool)
+	var contexts []string
+	for _, m := range []map[string]string{contextWeights, contextSizeNames} {
+		for context := range m {
+			if !seen[context] {
+				seen[context] = true
+				contexts = append(contexts, context)
+			}
+		}
 	}
+	sort.Strings(contexts)
+	return contexts
+}
 
-	// Set font paths
-	config.Regular = filepath.Join(config.BasePath, "FiraCode-Regular.ttf")
-	config.Bold = filepath.Join(config.BasePath, "FiraCode-Bold.ttf")
-	config.Light = filepath.Join(config.BasePath, "FiraCode-Light.ttf")
-	config.Medium = filepath.Join(config.BasePath, "FiraCode-Medium.ttf")
-	config.SemiBold = filepath.Join(config.BasePath, "FiraCode-SemiBold.ttf")
-	config.Retina = filepath.Join(config.BasePath, "FiraCode-Retina.ttf")
+// Validate reports unknown weights and contexts, and sizes the display
+// cannot show
+func (o FontOverrides) Validate() error {
+	var unknownWeights, unknownContexts []string
+	for weight := range o.Files {
+		if !containsString(FontWeights, weight) {
+			unknownWeights = append(unknownWeights, weight)
+		}
+	}
+	if len(unknownWeights) > 0 {
+		sort.Strings(unknownWeights)
+		return fmt.Errorf("unknown font weights %s (known: %s)",
+			strings.Join(unknownWeights, ", "), strings.Join(FontWeights, ", "))
+	}
+
+	contexts := FontContexts()
+	for context, size := range o.Sizes {
+		if !containsString(contexts, context) {
+			unknownContexts = append(unknownContexts, context)
+			continue
+		}
+		if size < 4 || size > DisplayHeight {
+			return fmt.Errorf("size %g for %s must be 4-%d", size, context, DisplayHeight)
+		}
+	}
+	if len(unknownContexts) > 0 {
+		sort.Strings(unknownContexts)
+		return fmt.Errorf("unknown font contexts %s (known: %s)",
+			strings.Join(unknownContexts, ", "), strings.Join(contexts, ", "))
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// variant returns the font file of a weight
+func (fc *FiraCodeConfig) variant(weight string) *string {
+	switch weight {
+	case "Bold":
+		return &fc.Bold
+	case "Light":
+		return &fc.Light
+	case "Medium":
+		return &fc.Medium
+	case "SemiBold":
+		return &fc.SemiBold
+	case "Retina":
+		return &fc.Retina
+	default:
+		return &fc.Regular
+	}
+}
+
+// NewFiraCodeManager creates a new FiraCode font manager with overrides
+// applied over the defaults
+func NewFiraCodeManager(overrides FontOverrides) (*FiraCodeManager, error) {
+	config := newFiraCodeConfig(overrides)
 
 	// Validate installation
 	if err := config.ValidateInstallation(); err != nil {
@@ -72,6 +181,51 @@ func NewFiraCodeManager() (*FiraCodeManager, error) {
 	return manager, nil
 }
 
+// newFiraCodeConfig returns the default font setup with overrides merged in
+func newFiraCodeConfig(overrides FontOverrides) *FiraCodeConfig {
+	config := &FiraCodeConfig{
+		BasePath: "./fonts",
+		sizes: map[string]float64{
+			"StatusBar":    9.0,  // Top status bar - compact but readable
+			"MainContent":  11.0, // Primary content - optimal balance
+			"MenuItems":    10.0, // Menu navigation - clean spacing
+			"Headers":      13.0, // Section headers - prominent
+			"Recording":    14.0, // Recording indicator - attention grabbing
+			"Small":        8.0,  // Fine details - minimum readable
+			"Large":        16.0, // Alerts/emphasis - maximum for display
+		},
+	}
+
+	// Set font paths
+	config.Regular = filepath.Join(config.BasePath, "FiraCode-Regular.ttf")
+	config.Bold = filepath.Join(config.BasePath, "FiraCode-Bold.ttf")
+	config.Light = filepath.Join(config.BasePath, "FiraCode-Light.ttf")
+	config.Medium = filepath.Join(config.BasePath, "FiraCode-Medium.ttf")
+	config.SemiBold = filepath.Join(config.BasePath, "FiraCode-SemiBold.ttf")
+	config.Retina = filepath.Join(config.BasePath, "FiraCode-Retina.ttf")
+	config.applyOverrides(overrides)
+	return config
+}
+
+// applyOverrides replaces the directory, font files and context sizes set in
+// overrides. A file set for a weight wins over the directory alone.
+func (fc *FiraCodeConfig) applyOverrides(overrides FontOverrides) {
+	if overrides.Dir != "" {
+		fc.BasePath = overrides.Dir
+		for _, weight := range FontWeights {
+			path := fc.variant(weight)
+			*path = filepath.Join(fc.BasePath, filepath.Base(*path))
+		}
+	}
+	for weight, file := range overrides.Files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(fc.BasePath, file)
+		}
+		*fc.variant(weight) = file
+	}
+	fc.contextSizes = overrides.Sizes
+}
+
 // ValidateInstallation checks if required FiraCode fonts are available
 func (fc *FiraCodeConfig) ValidateInstallation() error {
 	requiredFonts := map[string]string{
@@ -117,6 +271,10 @@ func (fc *FiraCodeConfig) ValidateInstallation() error {
 
 // SwitchToContext changes font and size based on UI context
 func (fcm *FiraCodeManager) SwitchToContext(context string) error {
+	if fcm.bitmapFont {
+		return nil // The bitmap font has a single size
+	}
+
 	fontPath := fcm.GetFontForContext(context)
 	fontSize := fcm.GetSizeForContext(context)
 
@@ -129,44 +287,19 @@ func (fcm *FiraCodeManager) SwitchToContext(context string) error {
 
 // GetFontForContext returns the best font variant for different UI contexts
 func (fcm *FiraCodeManager) GetFontForContext(context string) string {
-	switch context {
-	case "statusbar", "time", "counters", "storage":
-		return fcm.config.Regular
-	case "recording", "alert", "error", "warning":
-		return fcm.config.Bold
-	case "menu", "navigation", "settings":
-		return fcm.config.Regular
-	case "details", "filename", "path", "metadata":
-		return fcm.config.Light
-	case "emphasis", "selected", "active":
-		return fcm.config.SemiBold
-	case "header", "title", "section":
-		return fcm.config.Medium
-	case "standby", "idle":
-		return fcm.config.Regular
-	default:
-		return fcm.config.Regular
-	}
+	return *fcm.config.variant(contextWeights[context])
 }
 
-// GetSizeForContext returns optimal font size for different UI contexts
+// GetSizeForContext returns optimal font size for different UI contexts,
+// preferring a size set for the context in the config
 func (fcm *FiraCodeManager) GetSizeForContext(context string) float64 {
-	switch context {
-	case "statusbar":
-		return fcm.config.sizes["StatusBar"]
-	case "recording", "alert", "header":
-		return fcm.config.sizes["Recording"]
-	case "menu", "navigation", "settings":
-		return fcm.config.sizes["MenuItems"]
-	case "title", "section":
-		return fcm.config.sizes["Headers"]
-	case "details", "filename", "metadata":
-		return fcm.config.sizes["Small"]
-	case "emphasis", "large":
-		return fcm.config.sizes["Large"]
-	default:
-		return fcm.config.sizes["MainContent"]
+	if size, ok := fcm.config.contextSizes[context]; ok {
+		return size
+	}
+	if name, ok := contextSizeNames[context]; ok {
+		return fcm.config.sizes[name]
 	}
+	return fcm.config.sizes["MainContent"]
 }
 
 // switchFont changes the current font and size
@@ -199,7 +332,7 @@ func (fcm *FiraCodeManager) DrawStatusBar(formatInfo, usbInfo string) error {
 }
 
 // DrawStatusBarWithNetwork renders the status bar with network and USB status
-func (fcm *FiraCodeManager) DrawStatusBarWithNetwork(formatInfo, usbInfo string, networkConnected bool, networkInfo string) error {
+func (fcm *FiraCodeManager) DrawStatusBarWithNetwork(formatInfo, usbInfo string, networkConnected bool, networkInfo string, extras ...StatusElement) error {
 	if err := fcm.SwitchToContext("statusbar"); err != nil {
 		return err
 	}
@@ -210,7 +343,7 @@ func (fcm *FiraCodeManager) DrawStatusBarWithNetwork(formatInfo, usbInfo string,
 	usbConnected := usbInfo != "" && usbInfo != "[---]" && usbInfo != "[ ]"
 	
 	// Use enhanced status bar with both USB and network icons
-	fcm.display.DrawStatusBarWithIcons(formatInfo, usbInfo, usbConnected, networkConnected, networkInfo)
+	fcm.display.DrawStatusBarWithIcons(formatInfo, usbInfo, usbConnected, networkConnected, networkInfo, extras...)
 
 	return fcm.display.Update()
 }
@@ -251,16 +384,18 @@ func (fcm *FiraCodeManager) DrawMenuItems(items []MenuItem, selectedIndex int) e
 			prefix = "> "
 		}
 
-		// Draw label
-		labelText := prefix + item.Label
-		fcm.display.DrawText(8, y, labelText)
-
-		// Draw right-aligned value if present
+		// Draw right-aligned value if present, and fit the label beside it
+		labelWidth := 256 - 16
 		if item.Value != "" {
 			valueWidth := fcm.display.GetTextWidth(item.Value)
 			fcm.display.DrawText(256-valueWidth-16, y, item.Value)
+			labelWidth = 256 - valueWidth - 16 - 4 - 8
 		}
 
+		// Draw label
+		labelText := fcm.display.FitText(prefix+item.Label, labelWidth)
+		fcm.display.DrawText(8, y, labelText)
+
 		y += fontHeight + 2
 
 		// Don't draw beyond display bounds
@@ -280,29 +415,20 @@ func (fcm *FiraCodeManager) DrawRecordingStatus(elapsed, remaining, filename str
 	if err := fcm.SwitchToContext("recording"); err != nil {
 		return err
 	}
-	recText := fmt.Sprintf("● REC %s", elapsed)
+	recText := i18n.Tf("rec.elapsed", elapsed)
 	fcm.display.DrawTextCentered(recText, 24)
 
 	// Time remaining with regular font
 	if err := fcm.SwitchToContext("details"); err != nil {
 		return err
 	}
-	timeText := fmt.Sprintf("Time Remaining: %s", remaining)
+	timeText := i18n.Tf("rec.remaining", remaining)
 	fcm.display.DrawTextCentered(timeText, 40)
 
 	// Filename with light font
 	if filename != "" {
-		// Truncate filename if too long
-		maxWidth := 256 - 32 // Leave margins
-		if fcm.display.GetTextWidth(filename) > maxWidth {
-			// Estimate characters that fit
-			avgCharWidth := fcm.display.GetTextWidth("M") // Use 'M' as average width
-			maxChars := maxWidth/avgCharWidth - 3         // Reserve space for "..."
-			if maxChars > 0 && maxChars < len(filename) {
-				filename = filename[:maxChars] + "..."
-			}
-		}
-		fcm.display.DrawTextCentered(filename, 56)
+		// Truncate filename if too long, leaving margins
+		fcm.display.DrawTextCentered(fcm.display.FitText(filename, 256-32), 56)
 	}
 
 	return fcm.display.Update()
@@ -369,15 +495,15 @@ func (fcm *FiraCodeManager) DrawConfirmationDialog(title, message1, message2 str
 	}
 
 	// YES/NO options
-	yesText := "YES"
-	noText := "NO"
+	yesText := i18n.T("common.yes")
+	noText := i18n.T("common.no")
 
 	// Emphasize selected option
 	if selectedOption == 1 { // YES selected
 		if err := fcm.SwitchToContext("selected"); err != nil {
 			return err
 		}
-		yesText = "> YES"
+		yesText = "> " + yesText
 		fcm.display.DrawText(96, 56, yesText)
 
 		if err := fcm.SwitchToContext("menu"); err != nil {
@@ -393,13 +519,40 @@ func (fcm *FiraCodeManager) DrawConfirmationDialog(title, message1, message2 str
 		if err := fcm.SwitchToContext("selected"); err != nil {
 			return err
 		}
-		noText = "> NO"
+		noText = "> " + noText
 		fcm.display.DrawText(160, 56, noText)
 	}
 
 	return fcm.display.Update()
 }
 
+// DrawBanner draws an alert banner across the bottom of the display
+func (fcm *FiraCodeManager) DrawBanner(text string) error {
+	if err := fcm.SwitchToContext("alert"); err != nil {
+		return err
+	}
+
+	bannerHeight := fcm.display.GetFontHeight() + 2
+	fcm.display.FillBox(0, DisplayHeight-bannerHeight, DisplayWidth, bannerHeight, 4)
+	fcm.display.DrawTextCentered(text, DisplayHeight-2)
+
+	return nil
+}
+
+// DrawHeaderBanner draws a full-width banner across the top of the display
+// in the largest font, in place of the status bar
+func (fcm *FiraCodeManager) DrawHeaderBanner(text string) error {
+	if err := fcm.SwitchToContext("large"); err != nil {
+		return err
+	}
+
+	bannerHeight := fcm.display.GetFontHeight() + 2
+	fcm.display.FillBox(0, 0, DisplayWidth, bannerHeight, 4)
+	fcm.display.DrawTextCentered(text, bannerHeight-4)
+
+	return nil
+}
+
 // MenuItem represents a menu item with label and optional value
 type MenuItem struct {
 	Label string
@@ -411,6 +564,37 @@ func (fcm *FiraCodeManager) GetDisplay() *TTFDisplay {
 	return fcm.display
 }
 
+// BitmapFont reports whether text is drawn with the built-in bitmap font
+func (fcm *FiraCodeManager) BitmapFont() bool {
+	return fcm.bitmapFont
+}
+
+// FontMissing reports whether the bitmap font is in use because no TTF font
+// could be loaded
+func (fcm *FiraCodeManager) FontMissing() bool {
+	return fcm.bitmapFont && !fcm.bitmapAsked
+}
+
+// UseBitmapFont reopens the display with the built-in bitmap font, which
+// then stays in use for every context
+func (fcm *FiraCodeManager) UseBitmapFont() error {
+	if fcm.bitmapFont {
+		return nil
+	}
+	if fcm.display != nil {
+		fcm.display.Close()
+	}
+	display, err := NewBitmapDisplay()
+	if err != nil {
+		// Keep the TTF font rather than no display at all
+		fcm.display, _ = NewTTFDisplay(fcm.currentFont, fcm.currentSize)
+		return fmt.Errorf("failed to switch to the bitmap font: %v", err)
+	}
+	fcm.display = display
+	fcm.bitmapFont, fcm.bitmapAsked = true, true
+	return nil
+}
+
 // GetCurrentFont returns the currently active font path
 func (fcm *FiraCodeManager) GetCurrentFont() string {
 	return fcm.currentFont
@@ -459,6 +643,22 @@ func (fcm *FiraCodeManager) ClearDisplay() {
 	}
 }
 
+// SetFlash starts or ends a brightness pulse
+func (fcm *FiraCodeManager) SetFlash(on bool) error {
+	if fcm.display != nil {
+		return fcm.display.SetFlash(on)
+	}
+	return fmt.Errorf("display not initialized")
+}
+
+// SetBrightness caps the display brightness at percent of full
+func (fcm *FiraCodeManager) SetBrightness(percent int) error {
+	if fcm.display != nil {
+		return fcm.display.SetBrightness(percent)
+	}
+	return fmt.Errorf("display not initialized")
+}
+
 // UpdateDisplay sends the current buffer to the physical display
 func (fcm *FiraCodeManager) UpdateDisplay() error {
 	if fcm.display != nil {
@@ -0,0 +1,82 @@
+package hardware
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFontOverridePrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides FontOverrides
+		regular   string
+		bold      string
+	}{
+		{"defaults", FontOverrides{},
+			"fonts/FiraCode-Regular.ttf", "fonts/FiraCode-Bold.ttf"},
+		{"directory keeps the file names", FontOverrides{Dir: "/opt/fonts"},
+			"/opt/fonts/FiraCode-Regular.ttf", "/opt/fonts/FiraCode-Bold.ttf"},
+		{"file in the default directory", FontOverrides{Files: map[string]string{"Bold": "Mono-Bold.ttf"}},
+			"fonts/FiraCode-Regular.ttf", "fonts/Mono-Bold.ttf"},
+		{"file in the directory", FontOverrides{Dir: "/opt/fonts", Files: map[string]string{"Regular": "Mono.ttf"}},
+			"/opt/fonts/Mono.ttf", "/opt/fonts/FiraCode-Bold.ttf"},
+		{"absolute file wins over the directory", FontOverrides{Dir: "/opt/fonts", Files: map[string]string{"Bold": "/usr/share/Mono-Bold.ttf"}},
+			"/opt/fonts/FiraCode-Regular.ttf", "/usr/share/Mono-Bold.ttf"},
+	}
+	for _, tt := range tests {
+		fcm := &FiraCodeManager{config: newFiraCodeConfig(tt.overrides)}
+		if got := fcm.GetFontForContext("idle"); filepath.Clean(got) != tt.regular {
+			t.Errorf("%s: idle in %s, want %s", tt.name, got, tt.regular)
+		}
+		if got := fcm.GetFontForContext("recording"); filepath.Clean(got) != tt.bold {
+			t.Errorf("%s: recording in %s, want %s", tt.name, got, tt.bold)
+		}
+	}
+}
+
+func TestFontSizeOverridePrecedence(t *testing.T) {
+	fcm := &FiraCodeManager{config: newFiraCodeConfig(FontOverrides{
+		Sizes: map[string]float64{"recording": 20, "idle": 12},
+	})}
+	tests := []struct {
+		context string
+		want    float64
+	}{
+		{"recording", 20}, // Set for the context
+		{"alert", 14},     // Shares the Recording size, which is unchanged
+		{"idle", 12},      // Set for a context with no size of its own
+		{"standby", 11},   // Falls back to MainContent
+		{"unlisted", 11},
+		{"statusbar", 9},
+	}
+	for _, tt := range tests {
+		if got := fcm.GetSizeForContext(tt.context); got != tt.want {
+			t.Errorf("%s at %g points, want %g", tt.context, got, tt.want)
+		}
+	}
+}
+
+func TestFontOverridesValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides FontOverrides
+		want      string // Part of the error, or empty for none
+	}{
+		{"none", FontOverrides{}, ""},
+		{"known", FontOverrides{Files: map[string]string{"Retina": "r.ttf"}, Sizes: map[string]float64{"recording": 16}}, ""},
+		{"unknown weights", FontOverrides{Files: map[string]string{"Thin": "t.ttf", "Heavy": "h.ttf"}}, "unknown font weights Heavy, Thin"},
+		{"unknown contexts", FontOverrides{Sizes: map[string]float64{"timer": 16, "banner": 12, "menu": 10}}, "unknown font contexts banner, timer"},
+		{"too small", FontOverrides{Sizes: map[string]float64{"menu": 3}}, "size 3 for menu must be 4-64"},
+		{"too large", FontOverrides{Sizes: map[string]float64{"menu": 65}}, "size 65 for menu"},
+	}
+	for _, tt := range tests {
+		err := tt.overrides.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
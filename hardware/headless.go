@@ -0,0 +1,58 @@
+package hardware
+
+import (
+	"image"
+	"io"
+
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spitest"
+)
+
+// newMemoryDisplay returns a display drawing in the bitmap font whose
+// commands and frames go to conn, with the control pins simulated
+func newMemoryDisplay(conn spi.Conn) *TTFDisplay {
+	return &TTFDisplay{
+		spiConn:    conn,
+		dcPin:      &gpiotest.Pin{N: "GPIO25"},
+		resPin:     &gpiotest.Pin{N: "GPIO24"},
+		buffer:     make([]byte, DisplayWidth*DisplayHeight/2),
+		font:       newBitmapFace(),
+		canvas:     image.NewGray(image.Rect(0, 0, DisplayWidth, DisplayHeight)),
+		svgLoader:  NewSVGLoader("./svg"),
+		brightness: 100,
+	}
+}
+
+// NewHeadlessManager returns a manager that draws with the built-in bitmap
+// font into memory, for rendering screens without the panel. Frames are
+// converted as on the unit and discarded; Snapshot shows what the screen
+// would. It has no encoder or buttons, and watches the loopback interface
+// in place of eth0.
+func NewHeadlessManager() *HardwareManager {
+	conn, _ := spitest.NewRecordRaw(io.Discard).Connect(10000000, spi.Mode0, 8)
+	return NewHeadlessManagerOn(conn)
+}
+
+// NewHeadlessManagerOn returns a headless manager whose display commands and
+// frames go to conn, for following what would reach the panel
+func NewHeadlessManagerOn(conn spi.Conn) *HardwareManager {
+	return &HardwareManager{
+		FiraCode: &FiraCodeManager{
+			display:     newMemoryDisplay(conn),
+			config:      &FiraCodeConfig{BasePath: "./fonts"},
+			bitmapFont:  true,
+			bitmapAsked: true,
+		},
+		Network: NewNetworkDetector("lo"),
+	}
+}
+
+// NewFontlessManager returns a headless manager as it comes up when no TTF
+// font can be loaded: drawing in the bitmap font and reporting the fonts
+// missing.
+func NewFontlessManager() *HardwareManager {
+	hm := NewHeadlessManager()
+	hm.FiraCode.bitmapAsked = false
+	return hm
+}
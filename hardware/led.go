@@ -0,0 +1,74 @@
+package hardware
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/host/v3"
+)
+
+// LEDPattern is a repeating blink pattern: on and off times in turn,
+// starting with on. A pattern of one step keeps the LED lit and an empty one
+// keeps it dark.
+type LEDPattern []time.Duration
+
+// StatusLED blinks an LED on a GPIO pin, high for on
+type StatusLED struct {
+	pin      gpio.PinOut
+	patterns chan LEDPattern
+}
+
+// NewStatusLED sets up the LED on the named pin, such as "GPIO26", dark
+// until a pattern is set
+func NewStatusLED(pinName string) (*StatusLED, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize periph: %v", err)
+	}
+	pin := gpioreg.ByName(pinName)
+	if pin == nil {
+		return nil, fmt.Errorf("failed to get LED pin %s", pinName)
+	}
+	if err := pin.Out(gpio.Low); err != nil {
+		return nil, fmt.Errorf("failed to configure LED pin %s: %v", pinName, err)
+	}
+	led := &StatusLED{pin: pin, patterns: make(chan LEDPattern, 1)}
+	go led.run()
+	return led, nil
+}
+
+// SetPattern plays pattern from its first step, replacing the one playing.
+// Only the latest pattern set is played if several arrive at once.
+func (l *StatusLED) SetPattern(pattern LEDPattern) {
+	select {
+	case <-l.patterns:
+	default:
+	}
+	l.patterns <- pattern
+}
+
+// run steps through the current pattern until a new one is set
+func (l *StatusLED) run() {
+	var pattern LEDPattern
+	step := 0
+	for {
+		var next <-chan time.Time
+		switch len(pattern) {
+		case 0:
+			l.pin.Out(gpio.Low)
+		case 1:
+			l.pin.Out(gpio.High)
+		default:
+			l.pin.Out(gpio.Level(step%2 == 0))
+			next = time.After(pattern[step])
+		}
+
+		select {
+		case pattern = <-l.patterns:
+			step = 0
+		case <-next:
+			step = (step + 1) % len(pattern)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package hardware
 import (
 	"fmt"
 	"log"
+	"time"
+
+	"pi9696/i18n"
 )
 
 type HardwareManager struct {
@@ -10,19 +13,24 @@ type HardwareManager struct {
 	Encoder  *Encoder
 	Buttons  *ButtonManager
 	Network  *NetworkDetector
+
+	bootHeld []ButtonType // Buttons held down as the controls came up
 }
 
-func NewHardwareManager() (*HardwareManager, error) {
+// NewHardwareManager initializes the display, controls and network
+// detector. fonts overrides the default font setup.
+func NewHardwareManager(fonts FontOverrides) (*HardwareManager, error) {
 	hm := &HardwareManager{}
 
 	// Initialize FiraCode display manager
-	firacode, err := NewFiraCodeManager()
+	firacode, err := NewFiraCodeManager(fonts)
 	if err != nil {
 		// Fallback to basic display if FiraCode fails
 		log.Printf("FiraCode initialization failed, attempting fallback: %v", err)
 		
-		// Try basic TTF display with system font
-		basicDisplay, basicErr := NewTTFDisplay("/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", 11.0)
+		// Try basic TTF display with system font, then the built-in bitmap
+		// font so the UI always comes up
+		basicDisplay, bitmap, basicErr := NewDisplayWithFallback("/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", 11.0)
 		if basicErr != nil {
 			return nil, fmt.Errorf("failed to initialize any display: FiraCode=%v, Basic=%v", err, basicErr)
 		}
@@ -37,8 +45,13 @@ func NewHardwareManager() (*HardwareManager, error) {
 			},
 			currentFont: "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
 			currentSize: 11.0,
+			bitmapFont:  bitmap,
+		}
+		if bitmap {
+			log.Println("No fonts found, using the built-in bitmap font")
+		} else {
+			log.Println("Using fallback display with system fonts")
 		}
-		log.Println("Using fallback display with system fonts")
 	}
 	hm.FiraCode = firacode
 
@@ -61,6 +74,12 @@ func NewHardwareManager() (*HardwareManager, error) {
 	}
 	hm.Buttons = buttons
 
+	// Buttons held through power-up pick a boot mode
+	hm.bootHeld = buttons.Held()
+	if len(hm.bootHeld) > 0 {
+		log.Printf("Buttons held at boot: %v", hm.bootHeld)
+	}
+
 	log.Println("Hardware initialized successfully with FiraCode support")
 	return hm, nil
 }
@@ -87,12 +106,49 @@ func (hm *HardwareManager) UpdateDisplay() error {
 	return nil
 }
 
+// FontMissing reports whether the display fell back to the built-in bitmap
+// font because no TTF font could be loaded
+func (hm *HardwareManager) FontMissing() bool {
+	return hm.FiraCode != nil && hm.FiraCode.FontMissing()
+}
+
+// HeldAtBoot returns the buttons that were held down when the hardware was
+// initialized
+func (hm *HardwareManager) HeldAtBoot() []ButtonType {
+	return hm.bootHeld
+}
+
+// UseBitmapFont draws the UI in the built-in bitmap font from now on, even
+// when the TTF fonts are available
+func (hm *HardwareManager) UseBitmapFont() error {
+	if hm.FiraCode == nil {
+		return nil
+	}
+	return hm.FiraCode.UseBitmapFont()
+}
+
+// SetFlash starts or ends a brightness pulse of the whole display
+func (hm *HardwareManager) SetFlash(on bool) error {
+	if hm.FiraCode != nil {
+		return hm.FiraCode.SetFlash(on)
+	}
+	return nil
+}
+
+// SetBrightness caps the display brightness at percent of full
+func (hm *HardwareManager) SetBrightness(percent int) error {
+	if hm.FiraCode != nil {
+		return hm.FiraCode.SetBrightness(percent)
+	}
+	return nil
+}
+
 // Context-aware text drawing methods
 
-func (hm *HardwareManager) DrawStatusBar(formatInfo, usbInfo string) error {
+func (hm *HardwareManager) DrawStatusBar(formatInfo, usbInfo string, extras ...StatusElement) error {
 	// Get network status
 	networkConnected, networkInfo := hm.Network.GetNetworkStatus()
-	return hm.FiraCode.DrawStatusBarWithNetwork(formatInfo, usbInfo, networkConnected, networkInfo)
+	return hm.FiraCode.DrawStatusBarWithNetwork(formatInfo, usbInfo, networkConnected, networkInfo, extras...)
 }
 
 func (hm *HardwareManager) DrawCenteredText(text, context string, y int) error {
@@ -115,6 +171,14 @@ func (hm *HardwareManager) DrawConfirmationDialog(title, message1, message2 stri
 	return hm.FiraCode.DrawConfirmationDialog(title, message1, message2, selectedOption)
 }
 
+func (hm *HardwareManager) DrawBanner(text string) error {
+	return hm.FiraCode.DrawBanner(text)
+}
+
+func (hm *HardwareManager) DrawHeaderBanner(text string) error {
+	return hm.FiraCode.DrawHeaderBanner(text)
+}
+
 // Legacy compatibility methods for existing code
 
 func (hm *HardwareManager) DrawText(x, y int, text string) {
@@ -123,6 +187,13 @@ func (hm *HardwareManager) DrawText(x, y int, text string) {
 	}
 }
 
+// DrawDimText draws text at reduced brightness
+func (hm *HardwareManager) DrawDimText(x, y int, text string) {
+	if hm.FiraCode != nil && hm.FiraCode.display != nil {
+		hm.FiraCode.display.DrawDimText(x, y, text)
+	}
+}
+
 func (hm *HardwareManager) SetPixel(x, y int, brightness byte) {
 	if hm.FiraCode != nil && hm.FiraCode.display != nil {
 		hm.FiraCode.display.SetPixel(x, y, brightness)
@@ -139,6 +210,16 @@ func (hm *HardwareManager) SetEncoderCallbacks(onRotate func(int), onClick func(
 	}
 }
 
+// SetPollIntervals sets how often the encoder and the buttons are sampled
+func (hm *HardwareManager) SetPollIntervals(encoder, buttons time.Duration) {
+	if hm.Encoder != nil {
+		hm.Encoder.SetPollInterval(encoder)
+	}
+	if hm.Buttons != nil {
+		hm.Buttons.SetPollInterval(buttons)
+	}
+}
+
 func (hm *HardwareManager) GetEncoderPosition() int {
 	if hm.Encoder != nil {
 		return hm.Encoder.GetPosition()
@@ -217,14 +298,14 @@ func (hm *HardwareManager) GetNetworkStatus() (bool, string) {
 	if hm.Network != nil {
 		return hm.Network.GetNetworkStatus()
 	}
-	return false, "No Network"
+	return false, i18n.T("network.no_network")
 }
 
 func (hm *HardwareManager) GetDetailedNetworkInfo() []string {
 	if hm.Network != nil {
 		return hm.Network.GetDetailedNetworkInfo()
 	}
-	return []string{"Network Error", "Not initialized"}
+	return []string{i18n.T("network.error"), "Not initialized"}
 }
 
 func (hm *HardwareManager) IsNetworkAvailable() bool {
@@ -251,6 +332,14 @@ func (hm *HardwareManager) GetFontHeight() int {
 	return 12 // Default fallback
 }
 
+// FitText shortens text with an ellipsis so it fits within maxWidth pixels
+func (hm *HardwareManager) FitText(text string, maxWidth int) string {
+	if hm.FiraCode != nil && hm.FiraCode.display != nil {
+		return hm.FiraCode.display.FitText(text, maxWidth)
+	}
+	return text
+}
+
 func (hm *HardwareManager) GetTextWidth(text string) int {
 	if hm.FiraCode != nil && hm.FiraCode.display != nil {
 		return hm.FiraCode.display.GetTextWidth(text)
@@ -260,55 +349,149 @@ func (hm *HardwareManager) GetTextWidth(text string) int {
 
 // Hardware status methods
 
+// GetHardwareStatus returns the hardware status as nested maps, with
+// "not initialized" for missing components.
+//
+// Deprecated: use Status, which has a stable schema. This wrapper will be
+// removed in the next release.
 func (hm *HardwareManager) GetHardwareStatus() map[string]interface{} {
-	status := make(map[string]interface{})
-	
-	// Display status
-	if hm.FiraCode != nil {
+	s := hm.Status()
+	status := map[string]interface{}{
+		"display": "not initialized",
+		"encoder": "not initialized",
+		"buttons": "not initialized",
+		"network": "not initialized",
+	}
+
+	if d := s.Display; d != nil {
 		status["display"] = map[string]interface{}{
-			"type":         "FiraCode TTF",
-			"current_font": hm.FiraCode.GetCurrentFont(),
-			"current_size": hm.FiraCode.GetCurrentSize(),
-			"available_fonts": len(hm.FiraCode.GetAvailableFonts()),
+			"type":            d.Type,
+			"current_font":    d.CurrentFont,
+			"current_size":    d.CurrentSize,
+			"available_fonts": d.AvailableFonts,
 		}
-	} else {
-		status["display"] = "not initialized"
 	}
-	
-	// Encoder status
-	if hm.Encoder != nil {
+
+	if e := s.Encoder; e != nil {
 		status["encoder"] = map[string]interface{}{
-			"position": hm.Encoder.GetPosition(),
-			"pressed":  hm.Encoder.IsButtonPressed(),
+			"position": e.Position,
+			"pressed":  e.Pressed,
 		}
-	} else {
-		status["encoder"] = "not initialized"
 	}
-	
-	// Button status
-	if hm.Buttons != nil {
+
+	if b := s.Buttons; b != nil {
 		status["buttons"] = map[string]interface{}{
-			"record": hm.Buttons.IsPressed(RecordButton),
-			"stop":   hm.Buttons.IsPressed(StopButton),
-			"play":   hm.Buttons.IsPressed(PlayButton),
+			"record": b.Record,
+			"stop":   b.Stop,
+			"play":   b.Play,
 		}
-	} else {
-		status["buttons"] = "not initialized"
 	}
-	
-	// Network status
-	if hm.Network != nil {
-		networkInfo, _ := hm.Network.GetNetworkInfo()
+
+	if n := s.Network; n != nil && n.Error != "" {
 		status["network"] = map[string]interface{}{
-			"interface":  networkInfo.InterfaceName,
-			"connected":  networkInfo.Connected,
-			"ip_address": networkInfo.IPAddress,
-			"link_up":    networkInfo.LinkUp,
+			"interface": n.Interface,
+			"error":     n.Error,
+		}
+	} else if n != nil {
+		network := map[string]interface{}{
+			"interface":   n.Interface,
+			"connected":   n.Connected,
+			"ip_address":  n.IPAddress,
+			"mac_address": n.MACAddress,
+			"link_up":     n.LinkUp,
 		}
-	} else {
-		status["network"] = "not initialized"
+		if n.LeaseObtained != nil {
+			network["lease_obtained"] = *n.LeaseObtained
+			network["lease_expires"] = *n.LeaseExpires
+		}
+		status["network"] = network
 	}
-	
+
+	return status
+}
+
+// HardwareStatus is a snapshot of the hardware state with a stable JSON
+// schema. Components that are not initialized are nil.
+type HardwareStatus struct {
+	Display *DisplayStatus `json:"display,omitempty"`
+	Encoder *EncoderStatus `json:"encoder,omitempty"`
+	Buttons *ButtonsStatus `json:"buttons,omitempty"`
+	Network *NetworkStatus `json:"network,omitempty"`
+}
+
+// DisplayStatus describes the active display font
+type DisplayStatus struct {
+	Type           string  `json:"type"`
+	CurrentFont    string  `json:"current_font"`
+	CurrentSize    float64 `json:"current_size"`
+	AvailableFonts int     `json:"available_fonts"`
+	Offline        bool    `json:"offline,omitempty"` // Given up on after repeated SPI failures
+}
+
+// EncoderStatus is the rotary encoder position and button state
+type EncoderStatus struct {
+	Position int  `json:"position"`
+	Pressed  bool `json:"pressed"`
+}
+
+// ButtonsStatus is the state of the transport buttons
+type ButtonsStatus struct {
+	Record bool `json:"record"`
+	Stop   bool `json:"stop"`
+	Play   bool `json:"play"`
+}
+
+// NetworkStatus is the wired interface state. If the interface could not be
+// queried only Interface and Error are set.
+type NetworkStatus struct {
+	Interface     string     `json:"interface"`
+	Error         string     `json:"error,omitempty"`
+	Connected     bool       `json:"connected"`
+	IPAddress     string     `json:"ip_address"`
+	MACAddress    string     `json:"mac_address"`
+	LinkUp        bool       `json:"link_up"`
+	LeaseObtained *time.Time `json:"lease_obtained,omitempty"`
+	LeaseExpires  *time.Time `json:"lease_expires,omitempty"`
+}
+
+// Status returns the hardware state
+func (hm *HardwareManager) Status() HardwareStatus {
+	var status HardwareStatus
+
+	if hm.FiraCode != nil {
+		status.Display = &DisplayStatus{
+			Type:           "FiraCode TTF",
+			CurrentFont:    hm.FiraCode.GetCurrentFont(),
+			CurrentSize:    hm.FiraCode.GetCurrentSize(),
+			AvailableFonts: len(hm.FiraCode.GetAvailableFonts()),
+		}
+		status.Display.Offline = hm.DisplayOffline()
+		if hm.FiraCode.BitmapFont() {
+			status.Display.Type = "bitmap"
+			status.Display.CurrentFont = "built-in 5x7"
+			status.Display.CurrentSize = bitmapGlyphHeight
+		}
+	}
+
+	if hm.Encoder != nil {
+		status.Encoder = &EncoderStatus{
+			Position: hm.Encoder.GetPosition(),
+			Pressed:  hm.Encoder.IsButtonPressed(),
+		}
+	}
+
+	if hm.Buttons != nil {
+		status.Buttons = &ButtonsStatus{
+			Record: hm.Buttons.IsPressed(RecordButton),
+			Stop:   hm.Buttons.IsPressed(StopButton),
+			Play:   hm.Buttons.IsPressed(PlayButton),
+		}
+	}
+
+	if hm.Network != nil {
+		status.Network = hm.Network.status()
+	}
+
 	return status
 }
 
@@ -0,0 +1,62 @@
+package hardware
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// failingNetwork returns a manager whose network interface query fails
+func failingNetwork() *HardwareManager {
+	nd := NewNetworkDetector("lo")
+	nd.addrs = func(*net.Interface) ([]net.Addr, error) {
+		return nil, errors.New("address query refused")
+	}
+	return &HardwareManager{Network: nd}
+}
+
+func TestStatusNetworkError(t *testing.T) {
+	status := failingNetwork().Status()
+	if status.Network == nil {
+		t.Fatal("network left out of the status when its query failed")
+	}
+	if status.Network.Interface != "lo" || status.Network.Error == "" {
+		t.Errorf("network status %+v, want the interface and the error", status.Network)
+	}
+	if status.Display != nil || status.Encoder != nil || status.Buttons != nil {
+		t.Error("components that were never set up are in the status")
+	}
+}
+
+func TestGetHardwareStatusNetworkError(t *testing.T) {
+	status := failingNetwork().GetHardwareStatus()
+	network, ok := status["network"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("network is %#v, want a map", status["network"])
+	}
+	if network["interface"] != "lo" {
+		t.Errorf("interface %#v, want lo", network["interface"])
+	}
+	if msg, ok := network["error"].(string); !ok || msg == "" {
+		t.Errorf("error %#v, want the query error", network["error"])
+	}
+	for _, key := range []string{"display", "encoder", "buttons"} {
+		if status[key] != "not initialized" {
+			t.Errorf("%s is %#v, want not initialized", key, status[key])
+		}
+	}
+}
+
+func TestGetHardwareStatusKeepsTypes(t *testing.T) {
+	status := (&HardwareManager{Network: NewNetworkDetector("lo")}).GetHardwareStatus()
+	network, ok := status["network"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("network is %#v, want a map", status["network"])
+	}
+	if _, ok := network["link_up"].(bool); !ok {
+		t.Errorf("link_up is %T, want bool", network["link_up"])
+	}
+	if _, ok := network["ip_address"].(string); !ok {
+		t.Errorf("ip_address is %T, want string", network["ip_address"])
+	}
+}
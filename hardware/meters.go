@@ -0,0 +1,68 @@
+package hardware
+
+import "math"
+
+const (
+	// MeterFloorDB is the level drawn as an empty meter
+	MeterFloorDB = -60.0
+	// meterClip is the level, linear, at which a hold is drawn as a clip
+	meterClip = 0.999
+)
+
+// meterRows converts a linear peak to the rows lit in a meter of height rows
+func meterRows(level float64, height int) int {
+	if level <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(level)
+	if db <= MeterFloorDB {
+		return 0
+	}
+	return min(int(math.Ceil((db-MeterFloorDB)/-MeterFloorDB*float64(height))), height)
+}
+
+// DrawMeters draws a row of vertical level meters across width pixels from
+// x, with their bottom row at y. levels and holds are linear peaks, 1.0 being
+// full scale; each hold is a single line over its meter, drawn as a full
+// block when it reached a clip. Meters with dim set are drawn faintly. Every
+// meter keeps a baseline so silent channels are still seen.
+func (d *TTFDisplay) DrawMeters(x, y, width, height int, levels, holds []float64, dim []bool) {
+	n := len(levels)
+	if n == 0 {
+		return
+	}
+	slot := width / n
+	if slot < 1 {
+		slot = 1
+	}
+	bar := slot - max(1, slot/4)
+	if bar < 1 {
+		bar = 1
+	}
+
+	for i, level := range levels {
+		left := x + i*slot
+		fill, hold := byte(10), byte(15)
+		if i < len(dim) && dim[i] {
+			fill, hold = 3, 5
+		}
+
+		rows := max(meterRows(level, height), 1)
+		d.FillBox(left, y-rows+1, bar, rows, fill)
+
+		if i < len(holds) {
+			if holds[i] >= meterClip {
+				d.FillBox(left, y-height+1, bar, 2, hold)
+			} else if r := meterRows(holds[i], height); r > rows {
+				d.FillBox(left, y-r+1, bar, 1, hold)
+			}
+		}
+	}
+}
+
+// DrawMeters draws a row of level meters. See TTFDisplay.DrawMeters.
+func (hm *HardwareManager) DrawMeters(x, y, width, height int, levels, holds []float64, dim []bool) {
+	if hm.FiraCode != nil && hm.FiraCode.display != nil {
+		hm.FiraCode.display.DrawMeters(x, y, width, height, levels, holds, dim)
+	}
+}
@@ -7,20 +7,36 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
 )
 
+// leaseCacheTTL limits how often DHCP lease files are re-read
+const leaseCacheTTL = 10 * time.Second
+
 // NetworkInfo holds network interface information
 type NetworkInfo struct {
 	InterfaceName string
 	IPAddress     string
 	SubnetMask    string
+	MACAddress    string
 	Connected     bool
 	LinkUp        bool
+	Lease         *DHCPLease // nil when no lease file is available
 }
 
 // NetworkDetector handles network interface detection and status
 type NetworkDetector struct {
 	interfaceName string
+
+	// addrs lists the addresses of the interface; nil for net.Interface.Addrs
+	addrs func(iface *net.Interface) ([]net.Addr, error)
+
+	leaseMutex sync.Mutex
+	lease      *DHCPLease
+	leaseRead  time.Time
 }
 
 // NewNetworkDetector creates a new network detector for the specified interface
@@ -45,13 +61,19 @@ func (nd *NetworkDetector) GetNetworkInfo() (*NetworkInfo, error) {
 		return info, nil
 	}
 
+	info.MACAddress = iface.HardwareAddr.String()
+
 	// Check link status
 	info.LinkUp = nd.isLinkUp(iface)
 
 	// Get IP address and subnet mask
-	addrs, err := iface.Addrs()
+	listAddrs := (*net.Interface).Addrs
+	if nd.addrs != nil {
+		listAddrs = nd.addrs
+	}
+	addrs, err := listAddrs(iface)
 	if err != nil {
-		return info, nil
+		return nil, fmt.Errorf("failed to read addresses of %s: %v", nd.interfaceName, err)
 	}
 
 	for _, addr := range addrs {
@@ -65,9 +87,47 @@ func (nd *NetworkDetector) GetNetworkInfo() (*NetworkInfo, error) {
 		}
 	}
 
+	if info.Connected {
+		info.Lease = nd.getLease()
+	}
+
 	return info, nil
 }
 
+// status reports the interface for HardwareStatus, including query errors
+func (nd *NetworkDetector) status() *NetworkStatus {
+	info, err := nd.GetNetworkInfo()
+	if err != nil {
+		return &NetworkStatus{Interface: nd.interfaceName, Error: err.Error()}
+	}
+
+	status := &NetworkStatus{
+		Interface:  info.InterfaceName,
+		Connected:  info.Connected,
+		IPAddress:  info.IPAddress,
+		MACAddress: info.MACAddress,
+		LinkUp:     info.LinkUp,
+	}
+	if info.Lease != nil {
+		obtained, expires := info.Lease.Obtained, info.Lease.Expires
+		status.LeaseObtained = &obtained
+		status.LeaseExpires = &expires
+	}
+	return status
+}
+
+// getLease returns the cached DHCP lease, re-reading the lease files when stale
+func (nd *NetworkDetector) getLease() *DHCPLease {
+	nd.leaseMutex.Lock()
+	defer nd.leaseMutex.Unlock()
+
+	if time.Since(nd.leaseRead) > leaseCacheTTL {
+		nd.lease = readDHCPLease(nd.interfaceName)
+		nd.leaseRead = time.Now()
+	}
+	return nd.lease
+}
+
 // isLinkUp checks if the network interface link is up
 func (nd *NetworkDetector) isLinkUp(iface *net.Interface) bool {
 	// Check interface flags
@@ -95,7 +155,7 @@ func (nd *NetworkDetector) getSubnetMask(mask net.IPMask) string {
 func (nd *NetworkDetector) GetNetworkStatus() (connected bool, status string) {
 	info, err := nd.GetNetworkInfo()
 	if err != nil || !info.Connected {
-		return false, "No Network"
+		return false, i18n.T("network.no_network")
 	}
 
 	if info.IPAddress != "" {
@@ -104,50 +164,68 @@ func (nd *NetworkDetector) GetNetworkStatus() (connected bool, status string) {
 		if len(parts) >= 3 {
 			return true, fmt.Sprintf("%s.%s.*", parts[0], parts[1])
 		}
-		return true, "Connected"
+		return true, i18n.T("network.connected")
 	}
 
-	return false, "No IP"
+	return false, i18n.T("network.no_ip")
 }
 
 // GetDetailedNetworkInfo returns formatted network information for menu display
 func (nd *NetworkDetector) GetDetailedNetworkInfo() []string {
 	info, err := nd.GetNetworkInfo()
 	if err != nil {
-		return []string{"Network Error", err.Error()}
+		return []string{i18n.T("network.error"), err.Error()}
 	}
 
 	var details []string
-	details = append(details, fmt.Sprintf("Interface: %s", info.InterfaceName))
+	details = append(details, i18n.Tf("network.interface", info.InterfaceName))
 
 	if !info.LinkUp {
-		details = append(details, "Status: Link Down")
-		details = append(details, "Cable: Not Connected")
+		details = append(details, i18n.T("network.status_link_down"))
+		details = append(details, i18n.T("network.cable_disconnected"))
+		if info.MACAddress != "" {
+			details = append(details, i18n.Tf("network.mac", info.MACAddress))
+		}
 		return details
 	}
 
 	if !info.Connected || info.IPAddress == "" {
-		details = append(details, "Status: Link Up")
-		details = append(details, "IP Address: Not Assigned")
-		details = append(details, "DHCP: Waiting...")
+		details = append(details, i18n.T("network.status_link_up"))
+		details = append(details, i18n.T("network.ip_unassigned"))
+		details = append(details, i18n.T("network.dhcp_waiting"))
+		if info.MACAddress != "" {
+			details = append(details, i18n.Tf("network.mac", info.MACAddress))
+		}
 		return details
 	}
 
-	details = append(details, "Status: Connected")
-	details = append(details, fmt.Sprintf("IP Address: %s", info.IPAddress))
+	details = append(details, i18n.T("network.status_connected"))
+	details = append(details, i18n.Tf("network.ip", info.IPAddress))
 	if info.SubnetMask != "" {
-		details = append(details, fmt.Sprintf("Subnet Mask: %s", info.SubnetMask))
+		details = append(details, i18n.Tf("network.subnet", info.SubnetMask))
 	}
 
 	// Get additional network information
 	gateway := nd.getGateway()
 	if gateway != "" {
-		details = append(details, fmt.Sprintf("Gateway: %s", gateway))
+		details = append(details, i18n.Tf("network.gateway", gateway))
 	}
 
 	dns := nd.getDNSServers()
 	if len(dns) > 0 {
-		details = append(details, fmt.Sprintf("DNS: %s", strings.Join(dns, ", ")))
+		details = append(details, i18n.Tf("network.dns", strings.Join(dns, ", ")))
+	}
+
+	if info.MACAddress != "" {
+		details = append(details, i18n.Tf("network.mac", info.MACAddress))
+	}
+
+	// Lease lines are omitted when no lease file was found
+	if info.Lease != nil {
+		if !info.Lease.Obtained.IsZero() {
+			details = append(details, i18n.Tf("network.lease", info.Lease.Obtained.Local().Format("2006-01-02 15:04")))
+		}
+		details = append(details, i18n.Tf("network.expires", info.Lease.Expires.Local().Format("2006-01-02 15:04")))
 	}
 
 	return details
@@ -0,0 +1,173 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+// Supported battery fuel gauges
+const (
+	ChipMAX17048 = "max17048"
+	ChipINA219   = "ina219"
+)
+
+// PowerConfig selects the fuel gauge of a UPS HAT
+type PowerConfig struct {
+	Chip    string // ChipMAX17048 or ChipINA219
+	Bus     string // I2C bus name, empty for the first bus
+	Address uint16 // 0 for the chip's default address
+
+	// EmptyVolts and FullVolts give the charge level of gauges that only
+	// measure voltage (INA219)
+	EmptyVolts float64
+	FullVolts  float64
+
+	// ShuntOhms is the current sense resistor of gauges that measure
+	// current (INA219)
+	ShuntOhms float64
+}
+
+// PowerReading is one sample from the fuel gauge
+type PowerReading struct {
+	Percent  int     `json:"percent"`
+	Volts    float64 `json:"volts"`
+	Charging bool    `json:"charging"`
+	// Amps is the battery current, positive while charging. Gauges that
+	// do not measure current (MAX17048) leave it at 0.
+	Amps float64 `json:"amps,omitempty"`
+}
+
+// PowerMonitor reads a battery fuel gauge over I2C
+type PowerMonitor struct {
+	config PowerConfig
+	bus    i2c.BusCloser
+	dev    *i2c.Dev
+	mutex  sync.Mutex
+}
+
+// NewPowerMonitor opens the fuel gauge and takes a first reading to check it
+// is there
+func NewPowerMonitor(config PowerConfig) (*PowerMonitor, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize periph: %v", err)
+	}
+
+	addr := config.Address
+	switch config.Chip {
+	case ChipMAX17048:
+		if addr == 0 {
+			addr = 0x36
+		}
+	case ChipINA219:
+		if addr == 0 {
+			addr = 0x42 // Default of the common UPS HATs; bare breakouts use 0x40
+		}
+	default:
+		return nil, fmt.Errorf("unknown fuel gauge %q", config.Chip)
+	}
+
+	bus, err := i2creg.Open(config.Bus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open I2C bus %q: %v", config.Bus, err)
+	}
+
+	pm := &PowerMonitor{
+		config: config,
+		bus:    bus,
+		dev:    &i2c.Dev{Bus: bus, Addr: addr},
+	}
+	if _, err := pm.Read(); err != nil {
+		bus.Close()
+		return nil, fmt.Errorf("no %s at 0x%02x: %v", config.Chip, addr, err)
+	}
+	return pm, nil
+}
+
+// readRegister reads a big-endian 16-bit register
+func (pm *PowerMonitor) readRegister(reg byte) (uint16, error) {
+	buf := make([]byte, 2)
+	if err := pm.dev.Tx([]byte{reg}, buf); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(buf), nil
+}
+
+// Read samples the charge level, voltage and charging state
+func (pm *PowerMonitor) Read() (PowerReading, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if pm.config.Chip == ChipMAX17048 {
+		return pm.readMAX17048()
+	}
+	return pm.readINA219()
+}
+
+func (pm *PowerMonitor) readMAX17048() (PowerReading, error) {
+	vcell, err := pm.readRegister(0x02)
+	if err != nil {
+		return PowerReading{}, err
+	}
+	soc, err := pm.readRegister(0x04)
+	if err != nil {
+		return PowerReading{}, err
+	}
+	crate, err := pm.readRegister(0x16)
+	if err != nil {
+		return PowerReading{}, err
+	}
+
+	return PowerReading{
+		Percent:  clampPercent(int(soc >> 8)),
+		Volts:    float64(vcell) * 78.125e-6,
+		Charging: int16(crate) > 0,
+	}, nil
+}
+
+func (pm *PowerMonitor) readINA219() (PowerReading, error) {
+	shunt, err := pm.readRegister(0x01)
+	if err != nil {
+		return PowerReading{}, err
+	}
+	busVoltage, err := pm.readRegister(0x02)
+	if err != nil {
+		return PowerReading{}, err
+	}
+
+	volts := float64(busVoltage>>3) * 0.004
+	percent := 0
+	if span := pm.config.FullVolts - pm.config.EmptyVolts; span > 0 {
+		percent = int((volts - pm.config.EmptyVolts) / span * 100)
+	}
+	amps := 0.0
+	if pm.config.ShuntOhms > 0 {
+		amps = float64(int16(shunt)) * 10e-6 / pm.config.ShuntOhms // 10µV per bit
+	}
+	return PowerReading{
+		Percent: clampPercent(percent),
+		Volts:   volts,
+		// Current flows into the battery through the shunt while charging
+		Charging: int16(shunt) > 0,
+		Amps:     amps,
+	}, nil
+}
+
+func clampPercent(p int) int {
+	if p < 0 {
+		return 0
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
+
+// Close releases the I2C bus
+func (pm *PowerMonitor) Close() error {
+	return pm.bus.Close()
+}
@@ -0,0 +1,18 @@
+package hardware
+
+import "image"
+
+// Snapshot returns a copy of the frame being drawn, one gray level per pixel
+func (d *TTFDisplay) Snapshot() *image.Gray {
+	frame := image.NewGray(d.canvas.Rect)
+	copy(frame.Pix, d.canvas.Pix)
+	return frame
+}
+
+// Snapshot returns a copy of the current frame, or nil without a display
+func (hm *HardwareManager) Snapshot() *image.Gray {
+	if hm.FiraCode == nil || hm.FiraCode.GetDisplay() == nil {
+		return nil
+	}
+	return hm.FiraCode.GetDisplay().Snapshot()
+}
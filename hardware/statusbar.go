@@ -0,0 +1,235 @@
+package hardware
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StatusBarHeight is the height of the status bar strip at the top of the display
+const StatusBarHeight = 12
+
+// statusBarGap is the horizontal spacing between status bar elements
+const statusBarGap = 5
+
+// StatusAlign selects which side of the status bar an element is packed against
+type StatusAlign int
+
+const (
+	AlignLeft StatusAlign = iota
+	AlignRight
+)
+
+// StatusElement is a single item in the status bar. Elements are packed in
+// the order they are added: left elements from the left edge inwards, right
+// elements from the right edge inwards. When space runs out the lowest
+// priority elements are dropped rather than drawn over each other.
+type StatusElement struct {
+	Name     string
+	Align    StatusAlign
+	Priority int // Higher priority elements are kept first
+	MinWidth int // Width reserved even if the measured content is narrower
+
+	// Measure returns the element's natural width in pixels
+	Measure func(d *TTFDisplay) int
+	// Draw renders the element with its top-left corner at x, y
+	Draw func(d *TTFDisplay, x, y int)
+}
+
+// placedElement is a status element with its resolved position
+type placedElement struct {
+	element *StatusElement
+	x       int
+	width   int
+}
+
+// TextStatusElement creates a status element showing plain text
+func TextStatusElement(name, text string, align StatusAlign, priority int) StatusElement {
+	return StatusElement{
+		Name:     name,
+		Align:    align,
+		Priority: priority,
+		Measure: func(d *TTFDisplay) int {
+			return d.GetTextWidth(text)
+		},
+		Draw: func(d *TTFDisplay, x, y int) {
+			d.DrawText(x, y+StatusBarHeight-2, text)
+		},
+	}
+}
+
+// headphoneIcon is an 8x8 headphone bitmap
+var headphoneIcon = [8][8]byte{
+	{0, 0, 15, 15, 15, 15, 0, 0},
+	{0, 15, 0, 0, 0, 0, 15, 0},
+	{15, 0, 0, 0, 0, 0, 0, 15},
+	{15, 0, 0, 0, 0, 0, 0, 15},
+	{15, 15, 0, 0, 0, 0, 15, 15},
+	{15, 15, 0, 0, 0, 0, 15, 15},
+	{15, 15, 0, 0, 0, 0, 15, 15},
+	{0, 15, 0, 0, 0, 0, 15, 0},
+}
+
+// HeadphoneStatusElement creates a status element showing that the monitor
+// output is active. A muted monitor is drawn dim and struck through.
+func HeadphoneStatusElement(muted bool) StatusElement {
+	return StatusElement{
+		Name:     "monitor",
+		Align:    AlignRight,
+		Priority: 70,
+		Measure:  func(d *TTFDisplay) int { return 8 },
+		Draw: func(d *TTFDisplay, x, y int) {
+			brightness := byte(15)
+			if muted {
+				brightness = 5
+			}
+			top := y + 2
+			for py := 0; py < 8; py++ {
+				for px := 0; px < 8; px++ {
+					if headphoneIcon[py][px] > 0 {
+						d.SetPixel(x+px, top+py, brightness)
+					}
+				}
+			}
+			if muted {
+				for i := 0; i < 8; i++ {
+					d.SetPixel(x+i, top+7-i, 15)
+				}
+			}
+		},
+	}
+}
+
+// lockIcon is a 7x8 padlock bitmap
+var lockIcon = [8][7]byte{
+	{0, 0, 15, 15, 15, 0, 0},
+	{0, 15, 0, 0, 0, 15, 0},
+	{0, 15, 0, 0, 0, 15, 0},
+	{15, 15, 15, 15, 15, 15, 15},
+	{15, 15, 15, 0, 15, 15, 15},
+	{15, 15, 15, 0, 15, 15, 15},
+	{15, 15, 15, 15, 15, 15, 15},
+	{15, 15, 15, 15, 15, 15, 15},
+}
+
+// LockStatusElement creates a status element showing that the recording
+// format is locked. It sits next to the format text.
+func LockStatusElement() StatusElement {
+	return StatusElement{
+		Name:     "lock",
+		Align:    AlignLeft,
+		Priority: 95,
+		Measure:  func(d *TTFDisplay) int { return 7 },
+		Draw: func(d *TTFDisplay, x, y int) {
+			top := y + 2
+			for py := 0; py < 8; py++ {
+				for px := 0; px < 7; px++ {
+					if lockIcon[py][px] > 0 {
+						d.SetPixel(x+px, top+py, 15)
+					}
+				}
+			}
+		},
+	}
+}
+
+// BatteryStatusElement creates a status element showing the battery charge
+// as a filled outline followed by the percentage. A "+" marks charging.
+func BatteryStatusElement(percent int, charging bool) StatusElement {
+	const iconWidth, iconHeight = 12, 7
+	text := fmt.Sprintf("%d%%", percent)
+	if charging {
+		text += "+"
+	}
+	return StatusElement{
+		Name:     "battery",
+		Align:    AlignRight,
+		Priority: 80,
+		Measure: func(d *TTFDisplay) int {
+			return iconWidth + 2 + d.GetTextWidth(text)
+		},
+		Draw: func(d *TTFDisplay, x, y int) {
+			top := y + 3
+			d.DrawBox(x, top, iconWidth-1, iconHeight, 15)
+			d.FillBox(x+iconWidth-1, top+2, 1, iconHeight-4, 15) // Terminal
+			fill := (iconWidth - 3) * percent / 100
+			d.FillBox(x+1, top+1, fill, iconHeight-2, 15)
+			d.DrawText(x+iconWidth+2, y+StatusBarHeight-2, text)
+		},
+	}
+}
+
+// layoutStatusBar decides which elements fit in the given width and where
+// they go. widthOf returns the natural width of an element.
+func layoutStatusBar(elements []StatusElement, totalWidth, margin int, widthOf func(*StatusElement) int) []placedElement {
+	widths := make([]int, len(elements))
+	for i := range elements {
+		w := widthOf(&elements[i])
+		if w < elements[i].MinWidth {
+			w = elements[i].MinWidth
+		}
+		widths[i] = w
+	}
+
+	// Admit elements by priority until the bar is full; ties go to the
+	// element registered first
+	order := make([]int, len(elements))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return elements[order[a]].Priority > elements[order[b]].Priority
+	})
+
+	available := totalWidth - 2*margin
+	used := 0
+	kept := make([]bool, len(elements))
+	for _, i := range order {
+		needed := widths[i]
+		if used > 0 {
+			needed += statusBarGap
+		}
+		if used+needed > available {
+			continue
+		}
+		used += needed
+		kept[i] = true
+	}
+
+	var placed []placedElement
+	leftX := margin
+	rightX := totalWidth - margin
+	for i := range elements {
+		if !kept[i] {
+			continue
+		}
+		if elements[i].Align == AlignLeft {
+			placed = append(placed, placedElement{element: &elements[i], x: leftX, width: widths[i]})
+			leftX += widths[i] + statusBarGap
+		} else {
+			rightX -= widths[i]
+			placed = append(placed, placedElement{element: &elements[i], x: rightX, width: widths[i]})
+			rightX -= statusBarGap
+		}
+	}
+
+	return placed
+}
+
+// DrawStatusBarElements lays out and draws the given elements across the status bar
+func (d *TTFDisplay) DrawStatusBarElements(elements []StatusElement) {
+	// Clear status bar area
+	d.FillBox(0, 0, DisplayWidth, StatusBarHeight, 0)
+
+	placed := layoutStatusBar(elements, DisplayWidth, 2, func(e *StatusElement) int {
+		if e.Measure == nil {
+			return 0
+		}
+		return e.Measure(d)
+	})
+
+	for _, p := range placed {
+		if p.element.Draw != nil {
+			p.element.Draw(d, p.x, 0)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package hardware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// charWidth is the simulated width of one character of status bar text
+const charWidth = 6
+
+// textElement is a status element whose width is its text at charWidth
+func textElement(name, text string, align StatusAlign, priority int) StatusElement {
+	e := TextStatusElement(name, text, align, priority)
+	e.Measure = func(*TTFDisplay) int { return len(text) * charWidth }
+	return e
+}
+
+func measured(e *StatusElement) int { return e.Measure(nil) }
+
+// checkPlacement fails the test if placed elements leave the bar or touch
+func checkPlacement(t *testing.T, label string, placed []placedElement, width, margin int) {
+	t.Helper()
+	sorted := append([]placedElement(nil), placed...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].x < sorted[b].x })
+	for i, p := range sorted {
+		if p.x < margin || p.x+p.width > width-margin {
+			t.Errorf("%s: %s at %d+%d leaves the bar", label, p.element.Name, p.x, p.width)
+		}
+		if i > 0 {
+			prev := sorted[i-1]
+			if gap := p.x - (prev.x + prev.width); gap < statusBarGap {
+				t.Errorf("%s: %s and %s %d pixels apart", label, prev.element.Name, p.element.Name, gap)
+			}
+		}
+	}
+}
+
+func TestStatusBarLayoutNeverOverlaps(t *testing.T) {
+	formats := []string{"48k", "48k/24/2ch", "192kHz 32bit 128ch"}
+	usbs := []string{"", "USB", "USB 256GB free of 512GB"}
+	for _, width := range []int{64, 128, 256} {
+		for _, format := range formats {
+			for _, usb := range usbs {
+				elements := []StatusElement{
+					textElement("format", format, AlignLeft, 100),
+					LockStatusElement(),
+					textElement("usb", usb, AlignRight, 50),
+					textElement("network", "192.168.100.200", AlignRight, 40),
+					BatteryStatusElement(100, true),
+					HeadphoneStatusElement(false),
+				}
+				// The battery measures its text with the display's font
+				elements[4].Measure = func(*TTFDisplay) int { return 12 + 2 + 4*charWidth }
+
+				placed := layoutStatusBar(elements, width, 2, measured)
+				checkPlacement(t, fmt.Sprintf("%q %q at %d", format, usb, width), placed, width, 2)
+			}
+		}
+	}
+}
+
+func TestStatusBarLayoutDropsLowestPriority(t *testing.T) {
+	elements := []StatusElement{
+		textElement("format", "48k/24/2ch", AlignLeft, 100), // 60
+		textElement("usb", "USB 12G", AlignRight, 50),       // 42
+		textElement("network", "10.0.0.1", AlignRight, 40),  // 48
+	}
+	names := func(placed []placedElement) string {
+		var n []string
+		for _, p := range placed {
+			n = append(n, p.element.Name)
+		}
+		return strings.Join(n, ",")
+	}
+
+	tests := []struct {
+		width int
+		want  string
+	}{
+		{256, "format,usb,network"},
+		{128, "format,usb"}, // 4+60+5+42 fits, the network does not
+		{80, "format"},      // Only the format fits
+		{50, "usb"},         // The format is too wide on its own
+		{10, ""},
+	}
+	for _, tt := range tests {
+		placed := layoutStatusBar(elements, tt.width, 2, measured)
+		if got := names(placed); got != tt.want {
+			t.Errorf("width %d: kept %q, want %q", tt.width, got, tt.want)
+		}
+		checkPlacement(t, fmt.Sprint(tt.width), placed, tt.width, 2)
+	}
+}
+
+func TestStatusBarLayoutPacksFromEdges(t *testing.T) {
+	elements := []StatusElement{
+		textElement("format", "48k", AlignLeft, 100),
+		textElement("usb", "USB", AlignRight, 50),
+		textElement("lock", "L", AlignLeft, 95),
+		textElement("battery", "99%", AlignRight, 80),
+	}
+	placed := layoutStatusBar(elements, 128, 2, measured)
+	at := make(map[string]int)
+	for _, p := range placed {
+		at[p.element.Name] = p.x
+	}
+	want := map[string]int{
+		"format":  2,
+		"lock":    2 + 18 + statusBarGap,
+		"usb":     128 - 2 - 18,
+		"battery": 128 - 2 - 18 - statusBarGap - 18,
+	}
+	for name, x := range want {
+		if at[name] != x {
+			t.Errorf("%s at %d, want %d", name, at[name], x)
+		}
+	}
+}
+
+func TestStatusBarLayoutReservesMinWidth(t *testing.T) {
+	short := textElement("format", "48k", AlignLeft, 100)
+	short.MinWidth = 40
+	placed := layoutStatusBar([]StatusElement{short, textElement("rec", "REC", AlignLeft, 90)}, 128, 2, measured)
+	if len(placed) != 2 || placed[0].width != 40 || placed[1].x != 2+40+statusBarGap {
+		t.Errorf("placed %+v, want the format 40 wide and the next element after it", placed)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// httpCommands maps the control paths of the HTTP server to remote commands
+var httpCommands = map[string]string{
+	"/record/start": remoteRecordStart,
+	"/record/stop":  remoteRecordStop,
+	"/marker":       remoteMarker,
+}
+
+// controlHandler runs a remote command for a POST to its path. Control
+// needs a token, so a server set up only to share the screen cannot start
+// or stop takes.
+func controlHandler(command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if config.HTTP.Token == "" {
+			http.Error(w, "control needs a token", http.StatusForbidden)
+			return
+		}
+		if !httpAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pi9696"`)
+			http.Error(w, "token required", http.StatusUnauthorized)
+			return
+		}
+
+		cmd := command
+		if cmd == remoteRecordStop && r.URL.Query().Get("force") == "1" {
+			cmd = remoteRecordStopForce
+		}
+		err := runRemoteCommand("http", r.RemoteAddr, cmd)
+		if err != nil {
+			http.Error(w, err.Error(), httpCommandStatus(err))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// httpCommandStatus is the status code answering a command that failed
+// with err
+func httpCommandStatus(err error) int {
+	switch {
+	case errors.Is(err, errAlreadyRecording), errors.Is(err, errNotRecording):
+		// The command conflicts with whether a take is running
+		return http.StatusConflict
+	case errors.Is(err, errStopUnconfirmed):
+		// The prompt is up; a second stop ends the take
+		return http.StatusAccepted
+	case errors.Is(err, errRemoteOff):
+		return http.StatusForbidden
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
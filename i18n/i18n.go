@@ -0,0 +1,118 @@
+// Package i18n holds the user interface strings. Each language is a flat
+// JSON table of key to text embedded in the binary; keys missing from the
+// selected language fall back to English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the fallback for keys missing from other languages
+const DefaultLanguage = "en"
+
+//go:embed lang/*.json
+var langFiles embed.FS
+
+var (
+	mutex   sync.RWMutex
+	tables  = make(map[string]map[string]string)
+	current = DefaultLanguage
+)
+
+func init() {
+	entries, err := langFiles.ReadDir("lang")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %v", err))
+	}
+	for _, entry := range entries {
+		data, err := langFiles.ReadFile(path.Join("lang", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: %v", err))
+		}
+		table := make(map[string]string)
+		if err := json.Unmarshal(data, &table); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+		tables[strings.TrimSuffix(entry.Name(), ".json")] = table
+	}
+}
+
+// T returns the text for key in the current language
+func T(key string) string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if text, ok := tables[current][key]; ok && text != "" {
+		return text
+	}
+	if text, ok := tables[DefaultLanguage][key]; ok {
+		return text
+	}
+	return key
+}
+
+// Tf formats the text for key with args
+func Tf(key string, args ...interface{}) string {
+	return fmt.Sprintf(T(key), args...)
+}
+
+// SetLanguage selects the language used by T
+func SetLanguage(code string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := tables[code]; !ok {
+		return fmt.Errorf("unknown language %q", code)
+	}
+	current = code
+	return nil
+}
+
+// Language returns the code of the current language
+func Language() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+// Has reports whether a language is available
+func Has(code string) bool {
+	_, ok := tables[code]
+	return ok
+}
+
+// Languages returns the available language codes, English first
+func Languages() []string {
+	codes := make([]string, 0, len(tables))
+	for code := range tables {
+		if code != DefaultLanguage {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return append([]string{DefaultLanguage}, codes...)
+}
+
+// Name returns a language's own name for itself
+func Name(code string) string {
+	if name := tables[code]["language.name"]; name != "" {
+		return name
+	}
+	return code
+}
+
+// Missing returns the English keys that a language does not translate
+func Missing(code string) []string {
+	var missing []string
+	for key := range tables[DefaultLanguage] {
+		if tables[code][key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
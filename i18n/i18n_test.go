@@ -0,0 +1,72 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// verb matches a formatting verb, skipping escaped percent signs
+var verb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// verbs returns the formatting verbs of a text in order
+func verbs(text string) []string {
+	var found []string
+	for _, v := range verb.FindAllString(text, -1) {
+		if v != "%%" {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+func TestEveryKeyTranslated(t *testing.T) {
+	for _, code := range Languages() {
+		if missing := Missing(code); len(missing) > 0 {
+			t.Errorf("%s does not translate %d keys: %v", code, len(missing), missing)
+		}
+	}
+}
+
+func TestNoKeysOutsideEnglish(t *testing.T) {
+	for _, code := range Languages() {
+		for key := range tables[code] {
+			if _, ok := tables[DefaultLanguage][key]; !ok {
+				t.Errorf("%s has %q, which English does not", code, key)
+			}
+		}
+	}
+}
+
+func TestTranslationsKeepFormatVerbs(t *testing.T) {
+	for _, code := range Languages() {
+		for key, text := range tables[code] {
+			want := verbs(tables[DefaultLanguage][key])
+			if got := verbs(text); !slices.Equal(got, want) {
+				t.Errorf("%s %q has verbs %v, English has %v", code, key, got, want)
+			}
+		}
+	}
+}
+
+func TestFallbackToEnglish(t *testing.T) {
+	tables["xx"] = map[string]string{"language.name": "Test", "common.back": ""}
+	defer delete(tables, "xx")
+	defer SetLanguage(DefaultLanguage)
+
+	if err := SetLanguage("xx"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := T("common.back"), tables[DefaultLanguage]["common.back"]; got != want {
+		t.Errorf("empty translation gave %q, want the English %q", got, want)
+	}
+	if got := T("no.such.key"); got != "no.such.key" {
+		t.Errorf("unknown key gave %q, want the key", got)
+	}
+	if err := SetLanguage("zz"); err == nil {
+		t.Error("unknown language accepted")
+	}
+	if Language() != "xx" {
+		t.Errorf("language %q after a refused change, want xx", Language())
+	}
+}
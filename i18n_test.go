@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"pi9696/i18n"
+)
+
+// textKey matches a whole literal key passed to i18n.T or i18n.Tf, not the
+// prefix of one built at run time
+var textKey = regexp.MustCompile(`i18n\.Tf?\("([^"]+)"[,)]`)
+
+func TestTextKeysExist(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, _ := filepath.Glob("hardware/*.go")
+	for _, file := range append(files, more...) {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range textKey.FindAllSubmatch(src, -1) {
+			if key := string(m[1]); i18n.T(key) == key {
+				t.Errorf("%s: %q has no English text", file, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,472 @@
+// Package ical reads the events of an iCalendar (RFC 5545) feed and expands
+// their recurrences. It covers what room booking systems publish: timed
+// events with DAILY, WEEKLY, MONTHLY or YEARLY rules, exception dates,
+// moved or cancelled occurrences, and time zones by IANA name.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIterations bounds the expansion of one rule, in case of a rule that
+// never reaches the window
+const maxIterations = 100000
+
+// Event is a VEVENT. A recurring event has a Rule; an event with a
+// RecurrenceID replaces one occurrence of the event with the same UID.
+type Event struct {
+	UID          string
+	Summary      string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Cancelled    bool
+	Rule         *Rule
+	ExDates      []time.Time
+	RecurrenceID time.Time
+}
+
+// Rule is an RRULE
+type Rule struct {
+	Freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval int
+	Count    int       // 0 for no limit
+	Until    time.Time // Zero for no limit
+	ByDay    []time.Weekday
+}
+
+// Occurrence is one sitting of an event
+type Occurrence struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+// Calendar is a parsed feed. Warnings lists the events left out because
+// they are malformed or use something not covered here.
+type Calendar struct {
+	Events   []Event
+	Warnings []string
+}
+
+// Parse reads a feed. Times without a zone, and zones that are not known
+// by name, are taken to be in local.
+func Parse(r io.Reader, local *time.Location) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{}
+	var event *Event
+	var duration time.Duration
+	hasDuration := false
+	depth := 0   // Components nested in the current event, such as VALARM
+	broken := "" // Why the current event cannot be used
+	sawCalendar := false
+	for n, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			sawCalendar = true
+			continue
+		case name == "BEGIN" && value == "VEVENT" && event == nil:
+			event = &Event{}
+			duration, hasDuration, depth, broken = 0, false, 0, ""
+			continue
+		case name == "BEGIN" && event != nil:
+			depth++
+			continue
+		case name == "END" && event != nil && depth > 0:
+			depth--
+			continue
+		case name == "END" && value == "VEVENT" && event != nil:
+			warning := broken
+			if warning == "" {
+				warning = finish(event, duration, hasDuration)
+			}
+			if warning != "" {
+				cal.Warnings = append(cal.Warnings, warning)
+			} else {
+				cal.Events = append(cal.Events, *event)
+			}
+			event = nil
+			continue
+		}
+		if event == nil || depth > 0 {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			event.UID = value
+		case "SUMMARY":
+			event.Summary = unescape(value)
+		case "DTSTART":
+			event.Start, event.AllDay, err = parseTime(value, params, local)
+		case "DTEND":
+			event.End, _, err = parseTime(value, params, local)
+		case "DURATION":
+			duration, err = parseDuration(value)
+			hasDuration = err == nil
+		case "RRULE":
+			event.Rule, err = parseRule(value, local)
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				var t time.Time
+				if t, _, err = parseTime(v, params, local); err == nil {
+					event.ExDates = append(event.ExDates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			event.RecurrenceID, _, err = parseTime(value, params, local)
+		case "STATUS":
+			event.Cancelled = strings.EqualFold(value, "CANCELLED")
+		}
+		if err != nil && broken == "" {
+			broken = fmt.Sprintf("line %d: %s: %v", n+1, name, err)
+		}
+		err = nil
+	}
+	if !sawCalendar {
+		return nil, fmt.Errorf("not an iCalendar feed")
+	}
+	return cal, nil
+}
+
+// finish fills in the end of an event from its duration, or explains why it
+// is left out
+func finish(event *Event, duration time.Duration, hasDuration bool) string {
+	if event.Start.IsZero() {
+		return fmt.Sprintf("event %q has no start", event.Summary)
+	}
+	if event.AllDay {
+		return fmt.Sprintf("event %q lasts all day", event.Summary)
+	}
+	if event.End.IsZero() {
+		if !hasDuration {
+			return fmt.Sprintf("event %q has no end", event.Summary)
+		}
+		event.End = event.Start.Add(duration)
+	}
+	if !event.End.After(event.Start) {
+		return fmt.Sprintf("event %q ends before it starts", event.Summary)
+	}
+	if r := event.Rule; r != nil {
+		switch r.Freq {
+		case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		default:
+			return fmt.Sprintf("event %q repeats %s, which is not supported", event.Summary, r.Freq)
+		}
+	}
+	return ""
+}
+
+// unfold reads the content lines of a feed, joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line into its upper-cased name, parameters
+// and value. The value starts at the first colon outside a quoted
+// parameter.
+func splitLine(line string) (string, map[string]string, string, bool) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	fields := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, p := range fields[1:] {
+		if key, value, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return strings.ToUpper(fields[0]), params, line[colon+1:], true
+}
+
+// unescape undoes the escaping of a text value
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseTime reads a DATE or DATE-TIME value, reporting whether it is a date
+func parseTime(value string, params map[string]string, local *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseDuration reads a DURATION value such as PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign, value = -1, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") || len(value) < 3 {
+		return 0, fmt.Errorf("bad duration %q", value)
+	}
+
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, c := range value[1:] {
+		switch {
+		case c == 'T':
+			inTime = true
+			continue
+		case c >= '0' && c <= '9':
+			number += string(c)
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+		number = ""
+		unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+		if inTime {
+			unit = map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+		}
+		u, ok := unit[c]
+		if !ok {
+			return 0, fmt.Errorf("bad duration %q", value)
+		}
+		d += time.Duration(n) * u
+	}
+	if number != "" {
+		return 0, fmt.Errorf("bad duration %q", value)
+	}
+	return sign * d, nil
+}
+
+// weekdays maps the BYDAY codes to weekdays
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRule reads an RRULE value
+func parseRule(value string, local *time.Location) (*Rule, error) {
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(v)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(v)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("interval %d", rule.Interval)
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(v)
+		case "UNTIL":
+			rule.Until, _, err = parseTime(v, nil, local)
+			if err == nil && len(v) == 8 {
+				// A date includes the whole day
+				rule.Until = rule.Until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				// Ordinals such as 2MO are not supported; the weekday is kept
+				day = strings.ToUpper(strings.TrimLeft(day, "+-0123456789"))
+				wd, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("bad weekday %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad rule part %q: %v", part, err)
+		}
+	}
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("rule has no FREQ")
+	}
+	return rule, nil
+}
+
+// starts calls yield with each start of the event, in order, until yield
+// returns false or the rule ends. The wall clock time of the first start is
+// kept across daylight saving changes.
+func (e *Event) starts(yield func(time.Time) bool) {
+	r := e.Rule
+	if r == nil {
+		yield(e.Start)
+		return
+	}
+
+	count := 0
+	emit := func(t time.Time) bool {
+		if t.Before(e.Start) {
+			return true
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		if r.Count > 0 && count >= r.Count {
+			return false
+		}
+		count++
+		return yield(t)
+	}
+
+	s := e.Start
+	for i := 0; i < maxIterations; i++ {
+		switch r.Freq {
+		case "DAILY":
+			t := s.AddDate(0, 0, i*r.Interval)
+			if r.onDay(t.Weekday()) && !emit(t) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.ByDay) == 0 {
+				if !emit(s.AddDate(0, 0, 7*i*r.Interval)) {
+					return
+				}
+				continue
+			}
+			// Weeks start on Monday
+			monday := s.AddDate(0, 0, -((int(s.Weekday())+6)%7)+7*i*r.Interval)
+			days := make([]int, 0, len(r.ByDay))
+			for _, wd := range r.ByDay {
+				days = append(days, (int(wd)+6)%7)
+			}
+			sort.Ints(days)
+			for _, d := range days {
+				if !emit(monday.AddDate(0, 0, d)) {
+					return
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			// Months without the day, such as the 31st, are skipped
+			months := i * r.Interval
+			if r.Freq == "YEARLY" {
+				months *= 12
+			}
+			first := time.Date(s.Year(), s.Month(), 1, s.Hour(), s.Minute(), s.Second(), 0, s.Location()).AddDate(0, months, 0)
+			t := time.Date(first.Year(), first.Month(), s.Day(), s.Hour(), s.Minute(), s.Second(), 0, s.Location())
+			if t.Month() == first.Month() && !emit(t) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// onDay reports whether a DAILY rule includes a weekday
+func (r *Rule) onDay(wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// Occurrences expands the events into the sittings that overlap from to
+// to, in start order. Cancelled events, exception dates and occurrences
+// that were moved are left out; moved occurrences appear at their new time.
+func (c *Calendar) Occurrences(from, to time.Time) []Occurrence {
+	// Occurrences replaced by a RECURRENCE-ID event, by UID
+	replaced := make(map[string]map[int64]bool)
+	for _, e := range c.Events {
+		if !e.RecurrenceID.IsZero() {
+			if replaced[e.UID] == nil {
+				replaced[e.UID] = make(map[int64]bool)
+			}
+			replaced[e.UID][e.RecurrenceID.Unix()] = true
+		}
+	}
+
+	var out []Occurrence
+	for i := range c.Events {
+		e := &c.Events[i]
+		if e.Cancelled {
+			continue
+		}
+		length := e.End.Sub(e.Start)
+		excluded := make(map[int64]bool)
+		for _, t := range e.ExDates {
+			excluded[t.Unix()] = true
+		}
+		if e.RecurrenceID.IsZero() {
+			for t := range replaced[e.UID] {
+				excluded[t] = true
+			}
+		}
+
+		e.starts(func(start time.Time) bool {
+			if !start.Before(to) {
+				return false
+			}
+			end := start.Add(length)
+			if end.After(from) && !excluded[start.Unix()] {
+				out = append(out, Occurrence{UID: e.UID, Summary: e.Summary, Start: start, End: end})
+			}
+			return true
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
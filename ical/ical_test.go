@@ -0,0 +1,150 @@
+package ical
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // The fixtures name their zones
+)
+
+// parseFixture parses a feed from testdata, with floating times in UTC
+func parseFixture(t *testing.T, name string) *Calendar {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cal, err := Parse(f, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	return cal
+}
+
+// utc reads a time written as 2006-01-02 15:04 in UTC
+func utc(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// sitting is an expected occurrence
+type sitting struct {
+	summary string
+	start   string // UTC
+	length  time.Duration
+}
+
+// checkOccurrences fails the test unless got are the sittings in want
+func checkOccurrences(t *testing.T, got []Occurrence, want []sitting) {
+	t.Helper()
+	if len(got) != len(want) {
+		var starts []string
+		for _, o := range got {
+			starts = append(starts, o.Start.UTC().Format("2006-01-02 15:04")+" "+o.Summary)
+		}
+		t.Fatalf("%d occurrences, want %d:\n%s", len(got), len(want), strings.Join(starts, "\n"))
+	}
+	for i, w := range want {
+		o := got[i]
+		if o.Summary != w.summary || !o.Start.Equal(utc(w.start)) || o.End.Sub(o.Start) != w.length {
+			t.Errorf("occurrence %d is %q at %s for %s, want %q at %s for %s", i,
+				o.Summary, o.Start.UTC().Format("2006-01-02 15:04"), o.End.Sub(o.Start), w.summary, w.start, w.length)
+		}
+	}
+}
+
+func TestWeeklyLecturesAcrossDaylightSaving(t *testing.T) {
+	cal := parseFixture(t, "lectures.ics")
+	const lecture, moved = "Acoustics 101", "Acoustics 101 (moved)"
+	const guest = "Guest lecture, Dr. Smith on room modes and bass trapping in small rooms"
+	lesson := 90 * time.Minute
+
+	// London moves to summer time on 31 March; the lectures stay at 9:00
+	// local. The 25th is cancelled, the 27th excluded and the 3rd moved.
+	checkOccurrences(t, cal.Occurrences(utc("2024-03-18 00:00"), utc("2024-04-30 00:00")), []sitting{
+		{lecture, "2024-03-18 09:00", lesson},
+		{lecture, "2024-03-20 09:00", lesson},
+		{guest, "2024-03-20 12:00", 45 * time.Minute},
+		{lecture, "2024-04-01 08:00", lesson},
+		{moved, "2024-04-03 13:00", lesson},
+		{lecture, "2024-04-08 08:00", lesson},
+		{lecture, "2024-04-10 08:00", lesson},
+	})
+}
+
+func TestOccurrenceRunningAtWindowStart(t *testing.T) {
+	cal := parseFixture(t, "lectures.ics")
+	got := cal.Occurrences(utc("2024-03-18 10:00"), utc("2024-03-19 00:00"))
+	checkOccurrences(t, got, []sitting{{"Acoustics 101", "2024-03-18 09:00", 90 * time.Minute}})
+	if got := cal.Occurrences(utc("2024-03-18 10:30"), utc("2024-03-19 00:00")); len(got) != 0 {
+		t.Errorf("occurrence that ended as the window opened included: %v", got)
+	}
+}
+
+func TestUnsupportedEventsWarned(t *testing.T) {
+	cal := parseFixture(t, "lectures.ics")
+	want := []string{`"Open day" lasts all day`, `"Clock test" repeats SECONDLY`}
+	if len(cal.Warnings) != len(want) {
+		t.Fatalf("warnings %q, want %d", cal.Warnings, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(cal.Warnings[i], w) {
+			t.Errorf("warning %q, want one about %s", cal.Warnings[i], w)
+		}
+	}
+
+	// The reminder inside the guest lecture does not change it
+	for _, e := range cal.Events {
+		if e.UID == "guest@rooms" && e.End.Sub(e.Start) != 45*time.Minute {
+			t.Errorf("guest lecture lasts %s, want the event's 45m", e.End.Sub(e.Start))
+		}
+	}
+}
+
+func TestMonthlyDailyAndYearlyRules(t *testing.T) {
+	cal := parseFixture(t, "studio.ics")
+	const mix, rehearsal, leap, news = "Month end mix", "Rehearsal", "Leap day session", "Morning news"
+	hour := time.Hour
+	half := 30 * time.Minute
+
+	// Months without a 31st are skipped without using up the count, the
+	// rehearsal runs every other day over the leap day, and the news runs on
+	// weekdays until the 12th
+	checkOccurrences(t, cal.Occurrences(utc("2024-01-01 00:00"), utc("2025-01-01 00:00")), []sitting{
+		{mix, "2024-01-31 18:00", 2 * hour},
+		{rehearsal, "2024-02-28 19:00", 2 * hour},
+		{leap, "2024-02-29 10:00", hour},
+		{rehearsal, "2024-03-01 19:00", 2 * hour},
+		{rehearsal, "2024-03-03 19:00", 2 * hour},
+		{news, "2024-03-04 07:00", half},
+		{news, "2024-03-05 07:00", half},
+		{news, "2024-03-06 07:00", half},
+		{news, "2024-03-07 07:00", half},
+		{news, "2024-03-08 07:00", half},
+		{news, "2024-03-11 07:00", half},
+		{mix, "2024-03-31 18:00", 2 * hour},
+		{mix, "2024-05-31 18:00", 2 * hour},
+		{mix, "2024-07-31 18:00", 2 * hour},
+	})
+
+	// A leap day comes round every four years
+	checkOccurrences(t, cal.Occurrences(utc("2025-01-01 00:00"), utc("2029-01-01 00:00")), []sitting{
+		{leap, "2028-02-29 10:00", hour},
+	})
+
+	if len(cal.Warnings) != 1 || !strings.Contains(cal.Warnings[0], `"No end" has no end`) {
+		t.Errorf("warnings %q, want one for the event without an end", cal.Warnings)
+	}
+}
+
+func TestParseRejectsOtherFormats(t *testing.T) {
+	if _, err := Parse(strings.NewReader("<html><body>Sign in</body></html>"), time.UTC); err == nil {
+		t.Error("a login page parsed as a calendar")
+	}
+}
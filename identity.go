@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// unitToken in the file prefix is replaced by the unit name
+const unitToken = "{unit}"
+
+var (
+	// The unit name has its own lock as it is read by the recorder and
+	// status goroutines
+	unit      string
+	unitMutex sync.Mutex
+)
+
+// unitName returns the name that tells this unit apart from the others
+func unitName() string {
+	unitMutex.Lock()
+	defer unitMutex.Unlock()
+	return unit
+}
+
+// initUnitName sets the unit name from the config at startup
+func initUnitName(name string) {
+	unitMutex.Lock()
+	unit = name
+	unitMutex.Unlock()
+	setLogPrefix(name)
+}
+
+// validateUnitName checks a unit name can be used in file names
+func validateUnitName(name string) error {
+	if len(name) > 32 {
+		return fmt.Errorf("unit_name %q is longer than 32 characters", name)
+	}
+	return validateName("unit_name", name)
+}
+
+// setLogPrefix starts every log line with the unit name
+func setLogPrefix(name string) {
+	if name == "" {
+		log.SetPrefix("")
+		return
+	}
+	log.SetPrefix("[" + name + "] ")
+}
+
+// setUnitName renames the unit and saves the name to the config file.
+// Existing files keep their names; the change is noted in the current
+// session so later takes can be told apart. Must be called with mutex held.
+func setUnitName(name string) error {
+	if err := validateUnitName(name); err != nil {
+		return err
+	}
+	old := unitName()
+	if name == old {
+		return nil
+	}
+	if err := saveConfigValue(ConfigPath, "unit_name", name); err != nil {
+		return err
+	}
+
+	initUnitName(name)
+	config.UnitName = name
+	log.Printf("Unit name changed from %q to %q", old, name)
+	if old != "" {
+		if err := saveSessionNote(fmt.Sprintf("Unit renamed from %s to %s", old, name)); err != nil {
+			log.Printf("Failed to note unit rename in session: %v", err)
+		}
+	}
+	return nil
+}
+
+// finishUnitName saves the unit name entered in the editor
+func finishUnitName(text string) {
+	if text == "" {
+		return
+	}
+	if err := setUnitName(text); err != nil {
+		setLastError("Failed to set unit name: %v", err)
+		showAlert(i18n.T("unit.failed"), 5*time.Second)
+		return
+	}
+	showAlert(i18n.Tf("unit.saved", text), 3*time.Second)
+}
+
+// bextOriginator is the originator written to the bext chunk of each file
+func bextOriginator() string {
+	originator := "PI9696"
+	if name := unitName(); name != "" {
+		originator += " " + name
+	}
+	if len(originator) > 32 {
+		originator = originator[:32]
+	}
+	return originator
+}
+
+// expandFilePrefix replaces the unit token in the file prefix. Spaces in the
+// unit name become hyphens so file names stay free of them.
+func expandFilePrefix(prefix string) string {
+	if !strings.Contains(prefix, unitToken) {
+		return prefix
+	}
+	return strings.ReplaceAll(prefix, unitToken, unitSlug())
+}
+
+// unitSlug is the unit name as used in file names and MQTT topics
+func unitSlug() string {
+	name := strings.ReplaceAll(unitName(), " ", "-")
+	if name == "" {
+		name = "unit"
+	}
+	return name
+}
+
+// unitNameText shows the unit name in settings
+func unitNameText() string {
+	if name := unitName(); name != "" {
+		return name
+	}
+	return i18n.T("unit.unnamed")
+}
+
+// openUnitNameEditor edits the unit name with the note editor. Must be
+// called with mutex held.
+func openUnitNameEditor() {
+	openNoteEditor("")
+	noteUnitName = true
+	setNoteText(unitName())
+}
+
+// promptUnitName asks for a unit name on first boot, when none is set
+func promptUnitName() {
+	if unitName() == "" {
+		openUnitNameEditor()
+		showAlert(i18n.T("unit.prompt"), 5*time.Second)
+	}
+}
+
+// cpuSerial returns the board serial number from /proc/cpuinfo
+func cpuSerial() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "Serial" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// aboutLines are the lines of the About screen
+func aboutLines() []string {
+	lines := []string{i18n.Tf("about.unit", unitNameText())}
+	if serial := cpuSerial(); serial != "" {
+		lines = append(lines, i18n.Tf("about.serial", serial))
+	}
+	if host, err := os.Hostname(); err == nil {
+		lines = append(lines, i18n.Tf("about.hostname", host))
+	}
+	lines = append(lines, selfCheckLines()...)
+	return append(lines, schemaLines()...)
+}
+
+// renderAbout shows the unit identity, scrolled with the encoder
+func renderAbout() {
+	hwManager.DrawCenteredText(i18n.T("about.title"), "header", 16)
+
+	lines := aboutLines()
+	maxLines := 3
+	if menuScrollOffset > len(lines)-maxLines {
+		menuScrollOffset = len(lines) - maxLines
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
+	y := 28
+	for _, line := range lines[menuScrollOffset:] {
+		if y > 48 {
+			break
+		}
+		hwManager.DrawCenteredText(line, "details", y)
+		y += 10
+	}
+
+	hwManager.DrawCenteredText(i18n.T("common.click_return"), "details", 58)
+}
+
+func renderLargeAbout() {
+	lines := aboutLines()
+	clampScroll(len(lines))
+	drawLargeLines(lines[menuScrollOffset], itemOf(menuScrollOffset, len(lines)))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// ImportInfo marks a take that was brought back from a USB drive rather
+// than recorded on this unit
+type ImportInfo struct {
+	Source string    `json:"source"` // Path on the drive it was imported from
+	At     time.Time `json:"at"`
+}
+
+var (
+	// The import list, built by loadFilesToImport
+	importFiles   []string
+	filesToImport = make(map[string]bool)
+	importGroups  []*copyGroup
+	isImporting   = false // The copy in progress is an import
+)
+
+// usbRecordings lists the WAV files on the USB drive, at the top level and
+// one folder down, sorted by name
+func usbRecordings() []string {
+	var files []string
+	dirs := []string{USBMountPoint}
+	if entries, err := os.ReadDir(USBMountPoint); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				dirs = append(dirs, filepath.Join(USBMountPoint, e.Name()))
+			}
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") && strings.ToLower(filepath.Ext(e.Name())) == ".wav" {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+	return files
+}
+
+// loadFilesToImport builds the import list with nothing selected
+func loadFilesToImport() {
+	importFiles = usbRecordings()
+	filesToImport = make(map[string]bool)
+	for _, file := range importFiles {
+		filesToImport[file] = false
+	}
+	importGroups = groupRecordings(importFiles, []*RecordTarget{{Path: USBMountPoint}}, filesToImport)
+}
+
+// importFilesMenuItems lists the import actions, then the files on the drive
+func importFilesMenuItems() []menuItem {
+	items := []menuItem{
+		{Label: i18n.T("import.start"), Action: startImportOperation},
+		{Label: i18n.T("copy.select_all"), Value: func() string { return i18n.Tf("copy.file_count", len(importFiles)) },
+			Action: func() { setAllSelected(filesToImport, true) }},
+		{Label: i18n.T("copy.clear_all"), Action: func() { setAllSelected(filesToImport, false) }},
+	}
+	return append(items, groupMenuItems(importGroups)...)
+}
+
+// importName returns a name for file in dir that clashes with neither a
+// recording nor a take sidecar there, nor with names already in taken. The
+// extension is lowercased so the file is listed with the recordings, and
+// the name is made valid when dir is on a FAT drive.
+func importName(dir, file string, taken map[string]bool) string {
+	stem := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if fatFilesystem(dir) {
+		stem = strings.TrimSuffix(fatName(stem+".wav"), ".wav")
+	}
+	ext := ".wav"
+	for n := 1; ; n++ {
+		name := stem + ext
+		switch n {
+		case 1:
+		case 2:
+			name = stem + "_import" + ext
+		default:
+			name = fmt.Sprintf("%s_import%d%s", stem, n-1, ext)
+		}
+		path := filepath.Join(dir, name)
+		if !taken[path] && !fileExists(path) && !fileExists(sidecarPath(path)) {
+			taken[path] = true
+			return path
+		}
+	}
+}
+
+// startImportOperation imports the selected files into the current session
+// on the first healthy record target, if they fit. Must be called with
+// mutex held.
+func startImportOperation() {
+	if !usbMounted {
+		showError(errNoUSB)
+		return
+	}
+	var selected []string
+	for file, ok := range filesToImport {
+		if ok {
+			selected = append(selected, file)
+		}
+	}
+	if len(selected) == 0 {
+		currentState = StateIdle
+		return
+	}
+	sort.Strings(selected)
+
+	idx, err := pickRecordTarget(recordTargets, 0)
+	if err != nil {
+		showError(newOpError(errNoTarget, err))
+		return
+	}
+	target := recordTargets[idx]
+	need := uint64(totalSize(selected))
+	if free := target.FreeSpace(); need+minTargetFreeBytes > free {
+		showAlert(i18n.Tf("import.no_space", formatSize(need), target.Name, formatSize(free)), 5*time.Second)
+		return
+	}
+	beginImport(selected, target)
+}
+
+// beginImport copies files from the USB drive into the current session on
+// target in the background, through the copy screen. Must be called with
+// mutex held.
+func beginImport(files []string, target *RecordTarget) {
+	dir := sessionDir(target.Path, sessionName)
+	currentState = StateCopying
+	isCopying, isImporting = true, true
+	copyProgress = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	copyCancel = cancel
+
+	go func() {
+		defer cancel()
+		failed := 0
+
+		lease, err := resources.Acquire(ctx, jobImport, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 3*time.Second)
+		}, target.Path, USBMountPoint)
+		if err == nil {
+			defer lease.Release()
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				setLastError("Failed to create %s: %v", dir, err)
+				failed = len(files)
+			} else {
+				failed = runImport(ctx, files, dir, lease)
+			}
+		}
+
+		mutex.Lock()
+		isCopying, isImporting = false, false
+		copyCancel = nil
+		if currentState == StateCopying {
+			currentState = StateIdle
+		}
+		if failed > 0 && ctx.Err() == nil {
+			showAlert(i18n.Tf("import.failed", failed), 5*time.Second)
+		}
+		mutex.Unlock()
+	}()
+}
+
+// runImport copies files into dir, keeps those that arrived whole and
+// marks them as imported. It returns how many failed.
+func runImport(ctx context.Context, files []string, dir string, lease *Lease) int {
+	checkpoint := func() error {
+		return lease.Checkpoint(ctx, func() {
+			showAlert(i18n.Tf("resource.paused", jobImport.Label()), 3*time.Second)
+		})
+	}
+	progress := startBackgroundJob(jobImport, totalSize(files))
+	defer progress.Finish()
+
+	taken := make(map[string]bool)
+	jobs := make([]copyJob, len(files))
+	for i, file := range files {
+		jobs[i] = copyJob{src: file, dst: importName(dir, file, taken), progress: progress}
+	}
+	runCopyJobs(ctx, jobs, checkpoint, func(done int) {
+		mutex.Lock()
+		copyProgress = int(float64(done) / float64(len(files)) * 100)
+		mutex.Unlock()
+	})
+
+	failed := 0
+	for _, job := range jobs {
+		if err := finishImport(job.src, job.dst); err != nil {
+			if ctx.Err() == nil {
+				setLastError("Failed to import %s: %v", job.src, err)
+				failed++
+			}
+			continue
+		}
+		log.Printf("Imported %s as %s", job.src, job.dst)
+	}
+	return failed
+}
+
+// finishImport checks an imported file arrived whole, removing it if not,
+// and writes a sidecar marking it as imported
+func finishImport(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if dstInfo.Size() != srcInfo.Size() {
+		os.Remove(dst)
+		return fmt.Errorf("%d of %d bytes copied", dstInfo.Size(), srcInfo.Size())
+	}
+
+	info := &TakeInfo{
+		Name:          takeName(dst),
+		Files:         []string{dst},
+		Start:         srcInfo.ModTime(),
+		TimecodeFPS:   config.TimecodeFPS,
+		Imported:      &ImportInfo{Source: src, At: time.Now()},
+		BitsPerSample: BitsPerSample,
+	}
+	if wav, err := readWAVInfo(dst); err == nil {
+		info.SampleRate = wav.SampleRate
+		info.Channels = wav.Channels
+		info.BitsPerSample = wav.Bits
+		info.DurationSeconds = wav.Duration().Seconds()
+		if wav.HasBext {
+			info.TimeReference = wav.TimeReference
+			info.TimecodeSource = "import"
+			info.StartTimecode = timecodeAt(wav.TimeReference, wav.SampleRate, info.TimecodeFPS)
+		}
+	}
+	return writeTakeInfo(info)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+const (
+	// ioErrorLimit is how many media errors within ioErrorWindow mark a
+	// storage device degraded
+	ioErrorLimit  = 3
+	ioErrorWindow = 10 * time.Minute
+	// systemStorageName stands for the state directory on the boot card,
+	// which holds the settings, write counters and maintenance report
+	systemStorageName = "system"
+)
+
+// ioHealth tracks the write errors of one storage device
+type ioHealth struct {
+	errors   []time.Time // Media errors within ioErrorWindow
+	degraded bool
+	cause    string
+}
+
+var (
+	// Writers report errors from their own goroutines, so the error counts
+	// have their own lock
+	ioHealthOf    = make(map[string]*ioHealth)
+	ioHealthMutex sync.Mutex
+)
+
+// mediaError reports whether err means the storage itself is failing, as
+// opposed to being full or missing a folder
+func mediaError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.EROFS, syscall.ENXIO, syscall.ENODEV} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// ioStorageName returns the storage a path is on for error counting: the
+// state directory, or a record target. USB drives are left out, as a
+// failing one is simply swapped.
+func ioStorageName(path string) string {
+	if pathsOverlap(StateDir, path) {
+		return systemStorageName
+	}
+	if name := storageName(path); name != usbStorageName {
+		return name
+	}
+	return ""
+}
+
+// noteWriteError counts a failed write to path by subsystem. A device with
+// ioErrorLimit media errors within ioErrorWindow, or that has gone
+// read-only, is marked degraded and gets no new writes until restart.
+// Other errors are not counted. It returns whether the device is degraded.
+func noteWriteError(path, subsystem string, err error) bool {
+	if err == nil || !mediaError(err) {
+		return false
+	}
+	name := ioStorageName(path)
+	if name == "" {
+		return false
+	}
+
+	ioHealthMutex.Lock()
+	h := ioHealthOf[name]
+	if h == nil {
+		h = &ioHealth{}
+		ioHealthOf[name] = h
+	}
+	if h.degraded {
+		ioHealthMutex.Unlock()
+		return true
+	}
+	now := time.Now()
+	recent := h.errors[:0]
+	for _, t := range h.errors {
+		if now.Sub(t) < ioErrorWindow {
+			recent = append(recent, t)
+		}
+	}
+	h.errors = append(recent, now)
+	log.Printf("Storage %s: %s write error %d of %d: %v", name, subsystem, len(h.errors), ioErrorLimit, err)
+	if len(h.errors) < ioErrorLimit && !errors.Is(err, syscall.EROFS) {
+		ioHealthMutex.Unlock()
+		return false
+	}
+	h.degraded, h.cause = true, fmt.Sprintf("%s: %v", subsystem, err)
+	cause := h.cause
+	ioHealthMutex.Unlock()
+
+	go degradeStorage(name, cause)
+	return true
+}
+
+// degradeStorage flushes what has been written, announces the failure and
+// protects the data already on the device by remounting it read-only. The
+// device's recordings stay readable so they can be copied off.
+func degradeStorage(name, cause string) {
+	mutex.Lock()
+	var paths []string
+	for _, target := range recordTargets {
+		if target.Name == name {
+			paths = append(paths, target.Path)
+		}
+	}
+	mutex.Unlock()
+
+	syscall.Sync()
+	setLastError("Storage %s degraded after write errors (%s), no new writes go there until restart", name, cause)
+	showAlert(i18n.Tf("alert.storage_degraded", name), 15*time.Second)
+
+	for _, path := range paths {
+		if !isMountPoint(path) {
+			continue
+		}
+		if out, err := exec.Command("sudo", "mount", "-o", "remount,ro", path).CombinedOutput(); err != nil {
+			log.Printf("Storage %s: failed to remount %s read-only: %v: %s", name, path, err, out)
+		} else {
+			log.Printf("Storage %s: remounted %s read-only", name, path)
+		}
+	}
+}
+
+// storageDegraded reports whether a device has been marked degraded
+func storageDegraded(name string) bool {
+	ioHealthMutex.Lock()
+	defer ioHealthMutex.Unlock()
+	h := ioHealthOf[name]
+	return h != nil && h.degraded
+}
+
+// degradedStorage lists the degraded devices, sorted
+func degradedStorage() []string {
+	ioHealthMutex.Lock()
+	defer ioHealthMutex.Unlock()
+	var names []string
+	for name, h := range ioHealthOf {
+		if h.degraded {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stateWritable reports whether the state directory may be written. Once
+// the boot card is degraded, or a file in it is found from a newer version,
+// settings and counters are kept in memory only.
+func stateWritable() bool {
+	return !storageDegraded(systemStorageName) && !stateNewer()
+}
+
+// storageStatusElements shows a warning for as long as any device is
+// degraded, which is until restart
+func storageStatusElements() []hardware.StatusElement {
+	if len(degradedStorage()) == 0 {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("storage", i18n.T("status.storage_degraded"), hardware.AlignLeft, 120)}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMediaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&fs.PathError{Op: "write", Path: "/rec/take.wav", Err: syscall.EIO}, true},
+		{fmt.Errorf("sync: %w", syscall.EROFS), true},
+		{syscall.ENODEV, true},
+		{&fs.PathError{Op: "write", Path: "/rec/take.wav", Err: syscall.ENOSPC}, false},
+		{os.ErrNotExist, false},
+		{errors.New("input/output error"), false}, // Only the errno counts
+	}
+	for _, tt := range tests {
+		if got := mediaError(tt.err); got != tt.want {
+			t.Errorf("mediaError(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// freshIOHealth clears the error counts for the test
+func freshIOHealth(t *testing.T) {
+	ioHealthMutex.Lock()
+	saved := ioHealthOf
+	ioHealthOf = make(map[string]*ioHealth)
+	ioHealthMutex.Unlock()
+	t.Cleanup(func() {
+		ioHealthMutex.Lock()
+		ioHealthOf = saved
+		ioHealthMutex.Unlock()
+		lastErrorMutex.Lock()
+		lastError = nil
+		lastErrorMutex.Unlock()
+		takeAlert()
+	})
+}
+
+// announced waits for a degraded device to be announced, which happens in
+// the background
+func announced(t *testing.T, name string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		lastErrorMutex.Lock()
+		msg := ""
+		if lastError != nil {
+			msg = lastError.Message
+		}
+		lastErrorMutex.Unlock()
+		if strings.Contains(msg, "Storage "+name+" degraded") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("storage %s never announced as degraded, last error %q", name, msg)
+		}
+	}
+}
+
+func TestRepeatedEIODegradesTarget(t *testing.T) {
+	freshIOHealth(t)
+	_, targets := newTestRecorder(t, 2)
+	useTargets(t, targets)
+
+	// Each take loses target A to an injected EIO and carries on on B
+	for take := 1; take <= ioErrorLimit; take++ {
+		r, err := newRecorder(targets, 48000, testChannels, nil, nil, "", fmt.Sprintf("take%d", take))
+		if err != nil {
+			t.Fatalf("take %d: %v", take, err)
+		}
+		if r.CurrentTarget() != targets[0] {
+			t.Fatalf("take %d started on %s before A was degraded", take, r.CurrentTarget().Name)
+		}
+		failAfter(r, recordBlockFrames, 0)
+		samples := testSamples(3 * recordBlockFrames)
+		record(t, r, samples)
+
+		var got []byte
+		for _, file := range r.Files() {
+			data, _ := readSamples(t, file)
+			got = append(got, data...)
+		}
+		if !bytes.Equal(got, samples) {
+			t.Errorf("take %d lost samples to the failing target", take)
+		}
+		if degraded := storageDegraded("A"); degraded != (take == ioErrorLimit) {
+			t.Errorf("A degraded %t after %d errors", degraded, take)
+		}
+	}
+	announced(t, "A")
+
+	// New takes go straight to B, and B is still healthy
+	r, err := newRecorder(targets, 48000, testChannels, nil, nil, "", "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CurrentTarget() != targets[1] {
+		t.Errorf("new take on %s, want B", r.CurrentTarget().Name)
+	}
+	record(t, r, testSamples(recordBlockFrames))
+	if got := degradedStorage(); len(got) != 1 || got[0] != "A" {
+		t.Errorf("degraded storage %v, want only A", got)
+	}
+
+	// A write error that is not the media's fault is never counted
+	if noteWriteError(filepath.Join(targets[1].Path, "x"), "copy", syscall.ENOSPC) || storageDegraded("B") {
+		t.Error("full target counted as failing")
+	}
+}
+
+func TestReadOnlyBootCardKeepsRunning(t *testing.T) {
+	freshIOHealth(t)
+	saved := settingsPath
+	settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	t.Cleanup(func() { settingsPath = saved })
+
+	// A card gone read-only is degraded on the first error
+	if !noteWriteError(filepath.Join(StateDir, "settings.json"), "settings", &fs.PathError{Op: "open", Path: StateDir, Err: syscall.EROFS}) {
+		t.Fatal("read-only boot card not degraded")
+	}
+	announced(t, systemStorageName)
+	if stateWritable() {
+		t.Error("state still written to a degraded card")
+	}
+
+	// Settings stay in memory, and the UI carries on with a warning
+	mutex.Lock()
+	s := currentSettings()
+	mutex.Unlock()
+	flushSettings(s)
+	if _, err := os.Stat(settingsPath); !os.IsNotExist(err) {
+		t.Errorf("settings written to a degraded card: %v", err)
+	}
+	if len(storageStatusElements()) == 0 {
+		t.Error("no storage warning on the status bar")
+	}
+	inEachLayout(t, func(t *testing.T) { drawn(t) })
+}
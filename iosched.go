@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+const (
+	// ioPressurePoll is how often a paused background job checks whether the
+	// recorder has caught up
+	ioPressurePoll = 100 * time.Millisecond
+	// recorderLoadSmoothing weights each block in the recorder's load average
+	recorderLoadSmoothing = 0.2
+	// defaultPauseLoad is the recorder write load that pauses background jobs
+	defaultPauseLoad = 0.5
+)
+
+// recorderLoad is the recorder's write load as float64 bits: the time spent
+// writing each block over the time the block lasts, smoothed. At 1 the
+// writer only just keeps up and the capture pipe starts to fill; it is 0
+// while nothing is recording.
+var recorderLoad atomic.Uint64
+
+// setRecorderLoad publishes the recorder's write load
+func setRecorderLoad(load float64) {
+	recorderLoad.Store(math.Float64bits(load))
+}
+
+// currentRecorderLoad returns the recorder's write load
+func currentRecorderLoad() float64 {
+	return math.Float64frombits(recorderLoad.Load())
+}
+
+// ioScheduler paces the disk I/O of background jobs so they never starve the
+// recorder. Throughput is limited by a token bucket holding up to a second
+// of bytes, and jobs stop entirely while the recorder's write load is at or
+// above pauseAbove, until it falls back to half of that.
+type ioScheduler struct {
+	rate       float64 // Bytes per second, 0 for unlimited
+	pauseAbove float64
+	load       func() float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+	paused bool
+}
+
+// backgroundIO paces every background job
+var backgroundIO = newIOScheduler(0, defaultPauseLoad, currentRecorderLoad)
+
+// newIOScheduler creates a scheduler allowing mbPerSec megabytes a second,
+// or any rate if it is 0
+func newIOScheduler(mbPerSec, pauseAbove float64, load func() float64) *ioScheduler {
+	rate := mbPerSec * 1024 * 1024
+	return &ioScheduler{rate: rate, pauseAbove: pauseAbove, load: load, tokens: rate, last: time.Now()}
+}
+
+// Wait blocks until the job may move n more bytes, or until ctx is done.
+// Passing 0 only waits out recorder pressure.
+func (s *ioScheduler) Wait(ctx context.Context, n int) error {
+	for s.pressured() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ioPressurePoll):
+		}
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	delay := s.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long to wait before
+// using them. The bucket goes into debt for a request larger than it holds,
+// so the next caller waits for it to be paid off.
+func (s *ioScheduler) reserve(n int) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	s.tokens = math.Min(s.tokens+s.rate*now.Sub(s.last).Seconds(), s.rate)
+	s.last = now
+	s.tokens -= float64(n)
+	if s.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-s.tokens / s.rate * float64(time.Second))
+}
+
+// SetRate changes the limit to mbPerSec megabytes a second, or any rate if
+// it is 0. Jobs already waiting keep their delay.
+func (s *ioScheduler) SetRate(mbPerSec float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rate = mbPerSec * 1024 * 1024
+	s.tokens = math.Min(s.tokens, s.rate)
+	s.last = time.Now()
+}
+
+// pressured reports whether background jobs should stay paused for the
+// recorder
+func (s *ioScheduler) pressured() bool {
+	load := s.load()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case !s.paused && load >= s.pauseAbove:
+		s.paused = true
+		log.Printf("Background I/O paused: recorder write load %.0f%%", load*100)
+	case s.paused && load <= s.pauseAbove/2:
+		s.paused = false
+		log.Printf("Background I/O resumed: recorder write load %.0f%%", load*100)
+	}
+	return s.paused
+}
+
+// Paused reports whether jobs are currently held back for the recorder
+func (s *ioScheduler) Paused() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.paused
+}
+
+// backgroundJob is a running background job's progress, shown on the status
+// bar
+type backgroundJob struct {
+	kind  jobKind
+	total int64
+	done  atomic.Int64
+}
+
+var (
+	// Running background jobs have their own lock as they update from their
+	// own goroutines
+	backgroundJobs      []*backgroundJob
+	backgroundJobsMutex sync.Mutex
+)
+
+// startBackgroundJob registers a job of total units of work, usually bytes
+func startBackgroundJob(kind jobKind, total int64) *backgroundJob {
+	job := &backgroundJob{kind: kind, total: total}
+	backgroundJobsMutex.Lock()
+	defer backgroundJobsMutex.Unlock()
+	backgroundJobs = append(backgroundJobs, job)
+	return job
+}
+
+// Add records n more units done
+func (j *backgroundJob) Add(n int64) {
+	j.done.Add(n)
+}
+
+// Percent returns how far through the job is
+func (j *backgroundJob) Percent() int {
+	if j.total <= 0 {
+		return 0
+	}
+	return int(min(j.done.Load()*100/j.total, 100))
+}
+
+// Finish removes the job from the status bar
+func (j *backgroundJob) Finish() {
+	backgroundJobsMutex.Lock()
+	defer backgroundJobsMutex.Unlock()
+	for i, job := range backgroundJobs {
+		if job == j {
+			backgroundJobs = append(backgroundJobs[:i], backgroundJobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// backgroundStatusText is the single status line for every background job:
+// the oldest job's progress and how many more are running, or that they
+// are paused for the recorder. It is empty when nothing is running.
+func backgroundStatusText() string {
+	backgroundJobsMutex.Lock()
+	defer backgroundJobsMutex.Unlock()
+	if len(backgroundJobs) == 0 {
+		return ""
+	}
+
+	first := backgroundJobs[0]
+	text := i18n.Tf("status.job_progress", first.kind.Label(), first.Percent())
+	if first.kind.background() && backgroundIO.Paused() {
+		text = i18n.Tf("status.job_paused", first.kind.Label())
+	}
+	if more := len(backgroundJobs) - 1; more > 0 {
+		text += i18n.Tf("status.jobs_more", more)
+	}
+	return text
+}
+
+// jobStatusElements shows background jobs on the status bar
+func jobStatusElements() []hardware.StatusElement {
+	text := backgroundStatusText()
+	if text == "" {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("jobs", text, hardware.AlignLeft, 20)}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIOSchedulerRate(t *testing.T) {
+	s := newIOScheduler(1, 1, func() float64 { return 0 })
+	// A full bucket holds a second of bytes
+	if d := s.reserve(1 << 20); d > 0 {
+		t.Errorf("first second of bytes waits %v", d)
+	}
+	if d := s.reserve(512 << 10); d < 450*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("half a second over the rate waits %v", d)
+	}
+	// The debt is paid off before anyone else moves data
+	if d := s.reserve(1); d < 450*time.Millisecond {
+		t.Errorf("next byte waits %v behind the debt", d)
+	}
+
+	s.SetRate(0)
+	if d := s.reserve(1 << 30); d != 0 {
+		t.Errorf("unlimited scheduler waits %v", d)
+	}
+}
+
+func TestIOSchedulerPauses(t *testing.T) {
+	var load atomic.Uint64
+	setLoad := func(l float64) { load.Store(math.Float64bits(l)) }
+	s := newIOScheduler(0, 0.5, func() float64 { return math.Float64frombits(load.Load()) })
+
+	// Paused at the threshold, resumed at half of it
+	for _, step := range []struct {
+		load   float64
+		paused bool
+	}{
+		{0.4, false}, {0.5, true}, {0.3, true}, {0.26, true}, {0.25, false}, {0.4, false},
+	} {
+		setLoad(step.load)
+		if got := s.pressured(); got != step.paused {
+			t.Errorf("load %.2f: paused %t, want %t", step.load, got, step.paused)
+		}
+	}
+
+	// A paused job waits, and gives up when cancelled
+	setLoad(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*ioPressurePoll)
+	defer cancel()
+	if err := s.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %v under pressure, want the deadline", err)
+	}
+	setLoad(0)
+	if err := s.Wait(context.Background(), 1); err != nil {
+		t.Errorf("Wait() = %v once the recorder caught up", err)
+	}
+}
+
+// slowDisk serves one request at a time, taking a millisecond for every
+// 32KB, like a card with a single queue
+type slowDisk struct {
+	mutex sync.Mutex
+}
+
+func (d *slowDisk) do(n int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	time.Sleep(time.Duration(n>>15) * time.Millisecond)
+}
+
+// starved runs a simulated recorder, writing a 64KB block every 10ms through
+// a buffer of 8 blocks, against a verify reading 512KB at a time through s.
+// It reports whether the recorder's buffer overflowed and how much the
+// verify read.
+func starved(s *ioScheduler, load *atomic.Uint64, run time.Duration) (bool, int64) {
+	const (
+		block  = 64 << 10
+		period = 10 * time.Millisecond
+		chunk  = 512 << 10
+	)
+	disk := &slowDisk{}
+	ctx, cancel := context.WithTimeout(context.Background(), run)
+	defer cancel()
+
+	var read atomic.Int64
+	verifyDone := make(chan struct{})
+	go func() {
+		defer close(verifyDone)
+		for ctx.Err() == nil && s.Wait(ctx, chunk) == nil {
+			disk.do(chunk)
+			read.Add(chunk)
+		}
+	}()
+
+	// The writer smooths its load as the recorder does
+	buffer := make(chan struct{}, 8)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		var smoothed float64
+		for range buffer {
+			start := time.Now()
+			disk.do(block)
+			smoothed += (time.Since(start).Seconds()/period.Seconds() - smoothed) * recorderLoadSmoothing
+			load.Store(math.Float64bits(smoothed))
+		}
+	}()
+
+	overflowed := false
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for ctx.Err() == nil && !overflowed {
+		<-ticker.C
+		select {
+		case buffer <- struct{}{}:
+		default:
+			overflowed = true
+		}
+	}
+	close(buffer)
+	<-writerDone
+	cancel()
+	<-verifyDone
+	return overflowed, read.Load()
+}
+
+func TestRecorderNeverStarves(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a simulated recorder for seconds")
+	}
+	var load atomic.Uint64
+	current := func() float64 { return math.Float64frombits(load.Load()) }
+
+	// Without pausing, the verify holds the disk long enough that the
+	// recorder falls behind
+	if overflowed, _ := starved(newIOScheduler(0, math.Inf(1), current), &load, time.Second); !overflowed {
+		t.Fatal("recorder kept up with an unpaced verify; the disk is not slow enough to test")
+	}
+
+	load.Store(0)
+	s := newIOScheduler(0, defaultPauseLoad, current)
+	overflowed, read := starved(s, &load, 2*time.Second)
+	if overflowed {
+		t.Error("recorder buffer overflowed while the verify was paced")
+	}
+	if read == 0 {
+		t.Error("verify never ran")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// ixmlVersion is the iXML specification the chunk follows
+const ixmlVersion = "2.10"
+
+// ixmlDocument is the part of the iXML schema DAWs read track names from
+type ixmlDocument struct {
+	XMLName   xml.Name      `xml:"BWFXML"`
+	Version   string        `xml:"IXML_VERSION"`
+	Project   string        `xml:"PROJECT,omitempty"`
+	Tape      string        `xml:"TAPE,omitempty"`
+	Note      string        `xml:"NOTE,omitempty"`
+	TrackList ixmlTrackList `xml:"TRACK_LIST"`
+}
+
+type ixmlTrackList struct {
+	TrackCount int         `xml:"TRACK_COUNT"`
+	Tracks     []ixmlTrack `xml:"TRACK"`
+}
+
+type ixmlTrack struct {
+	ChannelIndex    string `xml:"CHANNEL_INDEX"`
+	InterleaveIndex string `xml:"INTERLEAVE_INDEX"`
+	Name            string `xml:"NAME"`
+}
+
+// IXMLInfo is the take metadata written to the iXML chunk of each file
+type IXMLInfo struct {
+	Project string   // Session folder
+	Tape    string   // Unit name
+	Note    string   // Take description
+	Tracks  []string // Name of each channel in the file, in order
+}
+
+// encode builds the iXML document for the chunk body
+func (info IXMLInfo) encode() []byte {
+	doc := ixmlDocument{
+		Version: ixmlVersion,
+		Project: info.Project,
+		Tape:    info.Tape,
+		Note:    info.Note,
+	}
+	doc.TrackList.TrackCount = len(info.Tracks)
+	for i, name := range info.Tracks {
+		index := strconv.Itoa(i + 1)
+		doc.TrackList.Tracks = append(doc.TrackList.Tracks, ixmlTrack{
+			ChannelIndex:    index,
+			InterleaveIndex: index,
+			Name:            name,
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil // Only strings and ints, so this cannot happen
+	}
+	return append([]byte(xml.Header), append(data, '\n')...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureIXML is the take described by testdata/ixml_tracks.xml, laid out
+// as DAWs that import track names from iXML expect
+var fixtureIXML = IXMLInfo{
+	Project: "Sunday Service",
+	Tape:    "pi9696-foh",
+	Note:    "take_20240320_1030",
+	Tracks:  []string{"Kick", "Snare & Hat", "Vox <Lead> 日本"},
+}
+
+// dawTrackNames reads track names from an iXML document the way a DAW
+// does: by CHANNEL_INDEX, ignoring the order of the TRACK elements
+func dawTrackNames(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	var doc struct {
+		Count  int `xml:"TRACK_LIST>TRACK_COUNT"`
+		Tracks []struct {
+			Index string `xml:"CHANNEL_INDEX"`
+			Name  string `xml:"NAME"`
+		} `xml:"TRACK_LIST>TRACK"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("iXML does not parse: %v", err)
+	}
+	if doc.Count != len(doc.Tracks) {
+		t.Errorf("TRACK_COUNT %d for %d tracks", doc.Count, len(doc.Tracks))
+	}
+	names := make(map[string]string)
+	for _, track := range doc.Tracks {
+		names[track.Index] = track.Name
+	}
+	return names
+}
+
+func TestIXMLMatchesFixture(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "ixml_tracks.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fixtureIXML.encode()
+	if !bytes.Equal(got, want) {
+		t.Errorf("iXML:\n%s\nwant:\n%s", got, want)
+	}
+	names := dawTrackNames(t, got)
+	for i, name := range fixtureIXML.Tracks {
+		if index := string(rune('1' + i)); names[index] != name {
+			t.Errorf("channel %s named %q, want %q", index, names[index], name)
+		}
+	}
+}
+
+func TestIXMLChunkInWAV(t *testing.T) {
+	// Mono 24-bit with an odd frame count leaves the data chunk odd-sized,
+	// so the iXML chunk needs a pad byte before it
+	for _, frames := range []int{480, 481} {
+		path := filepath.Join(t.TempDir(), "take.wav")
+		w, err := createWAV(path, 48000, 1, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.ixml = &fixtureIXML
+		if _, err := w.Write(make([]byte, frames*3)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := binary.LittleEndian.Uint32(data[4:8]); int(size) != len(data)-8 {
+			t.Errorf("%d frames: RIFF size %d for a %d byte file", frames, size, len(data))
+		}
+
+		// Walk the chunks as a RIFF reader does, each padded to a word
+		var body []byte
+		for offset := 12; offset+8 <= len(data); {
+			id, size := string(data[offset:offset+4]), int(binary.LittleEndian.Uint32(data[offset+4:offset+8]))
+			if offset+8+size > len(data) {
+				t.Fatalf("%d frames: %q chunk runs past the end of the file", frames, id)
+			}
+			if id == "iXML" {
+				body = data[offset+8 : offset+8+size]
+			}
+			offset += 8 + size + size%2
+		}
+		if !bytes.Equal(body, fixtureIXML.encode()) {
+			t.Errorf("%d frames: iXML chunk holds %q", frames, body)
+		}
+		if info, err := readWAVInfo(path); err != nil || info.DataBytes != int64(frames*3) {
+			t.Errorf("%d frames: readWAVInfo() = %+v, %v", frames, info, err)
+		}
+	}
+}
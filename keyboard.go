@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/schema"
+)
+
+// noteRecentMax is how many recent entries are remembered for each field
+const noteRecentMax = 5
+
+// recentPath remembers the last entries saved in each editor field
+var recentPath = filepath.Join(StateDir, schema.Recent.File)
+
+// recentFile is the on-disk form of the recent entries
+type recentFile struct {
+	Version int                 `json:"version"`
+	Entries map[string][]string `json:"entries"`
+}
+
+// noteEntryKind is what an editor entry does when clicked
+type noteEntryKind int
+
+const (
+	entrySave noteEntryKind = iota
+	entryDelete
+	entryDeleteWord
+	entryLeft
+	entryRight
+	entryInsert // Inserts text at the cursor: a token, recent entry or character
+)
+
+// noteEntry is one entry of the editor strip
+type noteEntry struct {
+	kind  noteEntryKind
+	label string
+	text  string // Inserted by entryInsert
+}
+
+// recentEntries holds the last entries saved in each field, newest first
+var recentEntries = make(map[string][]string)
+
+var (
+	recentSaveMutex sync.Mutex // Serialises saving the recent entries
+	recentPending   []byte     // Recent entries still to be saved, nil once saved
+)
+
+// noteField names the field being edited, which picks its tokens and
+// recent entries
+func noteField() string {
+	switch {
+	case noteUnitName:
+		return "unit_name"
+	case noteMarker > 0:
+		return "marker"
+	}
+	return "note"
+}
+
+// noteTokens returns the shortcuts offered for the field being edited, each
+// labelled with its token and inserting what the token stands for. Must be
+// called with mutex held.
+func noteTokens() []noteEntry {
+	if noteUnitName {
+		if name := unitName(); name != "" {
+			return []noteEntry{{kind: entryInsert, label: name, text: name}}
+		}
+		return nil
+	}
+	tokens := []noteEntry{{kind: entryInsert, label: "{date}", text: time.Now().Format("2006-01-02")}}
+	if noteTake != "" {
+		tokens = append(tokens, noteEntry{kind: entryInsert, label: "{take}", text: takeName(noteTake)})
+	}
+	if sessionName != "" {
+		tokens = append(tokens, noteEntry{kind: entryInsert, label: "{session}", text: sessionName})
+	}
+	return tokens
+}
+
+// buildNoteEntries lays out the editor strip for the field being edited:
+// the actions, then its tokens and recent entries, then the characters.
+// Must be called with mutex held.
+func buildNoteEntries() {
+	noteEntries = []noteEntry{
+		{kind: entrySave, label: i18n.T("notes.save")},
+		{kind: entryDelete, label: i18n.T("notes.delete")},
+		{kind: entryDeleteWord, label: i18n.T("notes.delete_word")},
+		{kind: entryLeft, label: i18n.T("notes.left")},
+		{kind: entryRight, label: i18n.T("notes.right")},
+	}
+	noteEntries = append(noteEntries, noteTokens()...)
+	for _, text := range recentEntries[noteField()] {
+		noteEntries = append(noteEntries, noteEntry{kind: entryInsert, label: `"` + shortRecent(text) + `"`, text: text})
+	}
+	for _, c := range noteChars {
+		label := string(c)
+		if c == ' ' {
+			label = "␣"
+		}
+		if c == 'A' {
+			noteCharIdx = len(noteEntries) // Start on "A"
+		}
+		noteEntries = append(noteEntries, noteEntry{kind: entryInsert, label: label, text: string(c)})
+	}
+}
+
+// shortRecent shortens a recent entry to fit the strip
+func shortRecent(text string) string {
+	if r := []rune(text); len(r) > 12 {
+		return string(r[:11]) + "…"
+	}
+	return text
+}
+
+// insertNoteText inserts text at the cursor, as much as fits within
+// noteMaxLen, and moves the cursor past it
+func insertNoteText(text string) {
+	r := []rune(text)
+	if room := noteMaxLen - len(noteText); len(r) > room {
+		r = r[:room]
+	}
+	noteText = append(noteText[:noteCursor], append(r, noteText[noteCursor:]...)...)
+	noteCursor += len(r)
+}
+
+// deleteNoteChar removes the character before the cursor
+func deleteNoteChar() {
+	if noteCursor == 0 {
+		return
+	}
+	noteText = append(noteText[:noteCursor-1], noteText[noteCursor:]...)
+	noteCursor--
+}
+
+// deleteNoteWord removes the word before the cursor along with any spaces
+// between it and the cursor
+func deleteNoteWord() {
+	start := noteCursor
+	for start > 0 && noteText[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && noteText[start-1] != ' ' {
+		start--
+	}
+	noteText = append(noteText[:start], noteText[noteCursor:]...)
+	noteCursor = start
+}
+
+// moveNoteCursor moves the cursor by offset characters within the text
+func moveNoteCursor(offset int) {
+	noteCursor = min(max(noteCursor+offset, 0), len(noteText))
+}
+
+// loadRecentEntries reads the remembered entries at startup
+func loadRecentEntries() {
+	data, err := os.ReadFile(recentPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read recent entries: %v", err)
+		}
+		return
+	}
+	var file recentFile
+	_, err = schema.Recent.Decode(data, &file)
+	var newer *schema.NewerError
+	if errors.As(err, &newer) {
+		noteNewerState(recentPath, newer)
+	} else if err != nil {
+		log.Printf("Failed to parse %s, starting with no recent entries: %v", recentPath, err)
+		return
+	}
+	if file.Entries != nil {
+		recentEntries = file.Entries
+	}
+}
+
+// rememberEntry puts text first in the recent entries of the field being
+// edited and saves them. Must be called with mutex held.
+func rememberEntry(text string) {
+	field := noteField()
+	recent := []string{text}
+	for _, r := range recentEntries[field] {
+		if r != text && len(recent) < noteRecentMax {
+			recent = append(recent, r)
+		}
+	}
+	recentEntries[field] = recent
+
+	if !stateWritable() {
+		return
+	}
+	data, err := json.MarshalIndent(recentFile{Version: schema.Recent.Version, Entries: recentEntries}, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode recent entries: %v", err)
+		return
+	}
+	recentSaveMutex.Lock()
+	recentPending = data
+	recentSaveMutex.Unlock()
+	go saveRecentEntries()
+}
+
+// saveRecentEntries writes the latest recent entries, so a save that runs
+// late never puts older entries back over newer ones
+func saveRecentEntries() {
+	recentSaveMutex.Lock()
+	defer recentSaveMutex.Unlock()
+	data := recentPending
+	if data == nil {
+		return // Already saved by an earlier call
+	}
+	recentPending = nil
+	err := os.MkdirAll(filepath.Dir(recentPath), 0755)
+	if err == nil {
+		err = os.WriteFile(recentPath, data, 0644)
+	}
+	if err != nil {
+		noteWriteError(recentPath, "recent entries", err)
+		log.Printf("Failed to save recent entries: %v", err)
+	}
+}
+
+// noteLine shows the text with the cursor, cut with "…" on either side to
+// fit maxWidth while keeping the cursor in view
+func noteLine(maxWidth int) string {
+	line := make([]rune, 0, len(noteText)+1)
+	line = append(append(append(line, noteText[:noteCursor]...), '_'), noteText[noteCursor:]...)
+	start, end := 0, len(line)
+	window := func() string {
+		s := string(line[start:end])
+		if start > 0 {
+			s = "…" + s
+		}
+		if end < len(line) {
+			s += "…"
+		}
+		return s
+	}
+	for end > noteCursor+1 && hwManager.GetTextWidth(window()) > maxWidth {
+		end--
+	}
+	for start < noteCursor && hwManager.GetTextWidth(window()) > maxWidth {
+		start++
+	}
+	return window()
+}
+
+// noteStrip shows the selected entry in brackets, centred among as many
+// neighbours either side as fit maxWidth, up to spread, wrapping around the
+// strip so it scrolls as the knob turns
+func noteStrip(spread, maxWidth int) string {
+	count := len(noteEntries)
+	label := func(offset int) string {
+		return noteEntries[((noteCharIdx+offset)%count+count)%count].label
+	}
+	strip := []string{"‹" + label(0) + "›"}
+	for offset := 1; offset <= spread && 2*offset < count; offset++ {
+		wider := append([]string{label(-offset)}, append(strip, label(offset))...)
+		if hwManager.GetTextWidth(strings.Join(wider, " ")) > maxWidth {
+			break
+		}
+		strip = wider
+	}
+	return strings.Join(strip, " ")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// editing puts text in the note editor with the cursor at cursor, restoring
+// the editor when the test ends
+func editing(t *testing.T, text string, cursor int) {
+	savedText, savedCursor := noteText, noteCursor
+	savedTake, savedMarker, savedUnit, savedSession := noteTake, noteMarker, noteUnitName, sessionName
+	t.Cleanup(func() {
+		noteText, noteCursor = savedText, savedCursor
+		noteTake, noteMarker, noteUnitName, sessionName = savedTake, savedMarker, savedUnit, savedSession
+	})
+	noteText, noteCursor = []rune(text), cursor
+	noteTake, noteMarker, noteUnitName, sessionName = "", 0, false, ""
+}
+
+// edited is the text with the cursor shown as "|"
+func edited() string {
+	return string(noteText[:noteCursor]) + "|" + string(noteText[noteCursor:])
+}
+
+func TestMoveNoteCursor(t *testing.T) {
+	editing(t, "Café 日本", 7)
+	for _, step := range []struct {
+		offset int
+		want   string
+	}{
+		{-1, "Café 日|本"},
+		{-3, "Caf|é 日本"},
+		{-5, "|Café 日本"},
+		{2, "Ca|fé 日本"},
+		{100, "Café 日本|"},
+		{1, "Café 日本|"},
+	} {
+		moveNoteCursor(step.offset)
+		if got := edited(); got != step.want {
+			t.Errorf("moved %d to %q, want %q", step.offset, got, step.want)
+		}
+	}
+}
+
+func TestInsertNoteText(t *testing.T) {
+	editing(t, "take one", 5)
+	insertNoteText("日本 ")
+	if got := edited(); got != "take 日本 |one" {
+		t.Errorf("inserted to %q", got)
+	}
+	moveNoteCursor(-100)
+	insertNoteText("A")
+	if got := edited(); got != "A|take 日本 one" {
+		t.Errorf("inserted at the start to %q", got)
+	}
+
+	// Only what fits is inserted
+	editing(t, strings.Repeat("a", noteMaxLen-2), 0)
+	insertNoteText("日本語")
+	if len(noteText) != noteMaxLen || string(noteText[:3]) != "日本a" || noteCursor != 2 {
+		t.Errorf("inserted into a nearly full note to %q", edited())
+	}
+	insertNoteText("x")
+	if len(noteText) != noteMaxLen || noteCursor != 2 {
+		t.Errorf("inserted into a full note to %q", edited())
+	}
+}
+
+func TestDeleteNoteText(t *testing.T) {
+	for _, tt := range []struct {
+		text   string
+		cursor int
+		char   string
+		word   string
+	}{
+		{"one two", 7, "one tw|", "one |"},
+		{"one two  ", 9, "one two |", "one |"},
+		{"one two", 5, "one |wo", "one |wo"},
+		{"one 日本", 6, "one 日|", "one |"},
+		{"one", 0, "|one", "|one"},
+		{"  one", 2, " |one", "|one"},
+		{"", 0, "|", "|"},
+	} {
+		editing(t, tt.text, tt.cursor)
+		deleteNoteChar()
+		if got := edited(); got != tt.char {
+			t.Errorf("deleting a character of %q at %d left %q, want %q", tt.text, tt.cursor, got, tt.char)
+		}
+		editing(t, tt.text, tt.cursor)
+		deleteNoteWord()
+		if got := edited(); got != tt.word {
+			t.Errorf("deleting a word of %q at %d left %q, want %q", tt.text, tt.cursor, got, tt.word)
+		}
+	}
+}
+
+func TestNoteTokens(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	today := time.Now().Format("2006-01-02")
+
+	editing(t, "", 0)
+	if got := noteTokens(); !slices.Equal(got, []noteEntry{{kind: entryInsert, label: "{date}", text: today}}) {
+		t.Errorf("tokens without a session or take: %+v", got)
+	}
+
+	sessionName = "Rehearsal"
+	noteTake = "/media/usb/Rehearsal/take_003_part2.wav"
+	want := []noteEntry{
+		{kind: entryInsert, label: "{date}", text: today},
+		{kind: entryInsert, label: "{take}", text: "take_003"},
+		{kind: entryInsert, label: "{session}", text: "Rehearsal"},
+	}
+	if got := noteTokens(); !slices.Equal(got, want) {
+		t.Errorf("tokens for a take note: %+v, want %+v", got, want)
+	}
+
+	// Each token inserts what it stands for at the cursor
+	editing(t, "Take  notes", 5)
+	sessionName = "Rehearsal"
+	for _, token := range noteTokens() {
+		insertNoteText(token.text)
+	}
+	if got := edited(); got != "Take "+today+"Rehearsal| notes" {
+		t.Errorf("tokens inserted to %q", got)
+	}
+
+	// The unit name is offered only when naming the unit, and only once set
+	saved := unitName()
+	t.Cleanup(func() { initUnitName(saved) })
+	noteUnitName = true
+	initUnitName("")
+	if got := noteTokens(); got != nil {
+		t.Errorf("tokens for an unnamed unit: %+v", got)
+	}
+	initUnitName("stage-left")
+	if got := noteTokens(); !slices.Equal(got, []noteEntry{{kind: entryInsert, label: "stage-left", text: "stage-left"}}) {
+		t.Errorf("tokens when naming the unit: %+v", got)
+	}
+}
+
+func TestRecentEntries(t *testing.T) {
+	savedPath, savedEntries := recentPath, recentEntries
+	recentPath = filepath.Join(t.TempDir(), "state", "recent.json")
+	recentEntries = make(map[string][]string)
+	t.Cleanup(func() { recentPath, recentEntries = savedPath, savedEntries })
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	editing(t, "", 0)
+	for _, text := range []string{"one", "two", "three", "two", "four", "five", "six"} {
+		rememberEntry(text)
+	}
+	noteMarker = 1
+	rememberEntry("Applause")
+
+	want := map[string][]string{
+		"note":   {"six", "five", "four", "two", "three"},
+		"marker": {"Applause"},
+	}
+	for field, entries := range want {
+		if got := recentEntries[field]; !slices.Equal(got, entries) {
+			t.Errorf("recent %s entries %q, want %q", field, got, entries)
+		}
+	}
+
+	// Recent entries follow the tokens in the strip, newest first
+	noteMarker = 0
+	buildNoteEntries()
+	var labels []string
+	for _, e := range noteEntries[5:12] {
+		labels = append(labels, e.label)
+	}
+	today := time.Now().Format("2006-01-02")
+	if wantLabels := []string{"{date}", `"six"`, `"five"`, `"four"`, `"two"`, `"three"`, "␣"}; !slices.Equal(labels, wantLabels) {
+		t.Errorf("strip %q, want %q", labels, wantLabels)
+	}
+	if noteEntries[5].text != today || noteEntries[noteCharIdx].label != "A" {
+		t.Errorf("strip starts on %q with the date token inserting %q", noteEntries[noteCharIdx].label, noteEntries[5].text)
+	}
+
+	// The newest entries are saved, whichever save runs last, and read back
+	// at startup
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(recentPath)
+		if strings.Contains(string(data), "Applause") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("recent entries not saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	recentEntries = make(map[string][]string)
+	loadRecentEntries()
+	for field, entries := range want {
+		if got := recentEntries[field]; !slices.Equal(got, entries) {
+			t.Errorf("recent %s entries read back as %q, want %q", field, got, entries)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+// inEachLayout runs test once in the standard layout and once in the large
+// text layout, with the screens drawn into memory
+func inEachLayout(t *testing.T, test func(t *testing.T)) {
+	inEachLayoutOn(t, hardware.NewHeadlessManager, test)
+}
+
+// inEachLayoutOn runs test in both layouts on a manager from newManager
+func inEachLayoutOn(t *testing.T, newManager func() *hardware.HardwareManager, test func(t *testing.T)) {
+	for _, large := range []bool{false, true} {
+		name := "standard"
+		if large {
+			name = "large"
+		}
+		t.Run(name, func(t *testing.T) {
+			mutex.Lock()
+			saved := hwManager
+			hwManager = newManager()
+			largeText = large
+			mutex.Unlock()
+			t.Cleanup(func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+				hwManager, largeText = saved, false
+				currentState, selectedMenu, menuScrollOffset, editingValue = StateIdle, 0, 0, false
+				shownError = nil
+			})
+			test(t)
+		})
+	}
+}
+
+// drawn fails the test if the last frame is blank
+func drawn(t *testing.T) {
+	t.Helper()
+	render()
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, p := range hwManager.Snapshot().Pix {
+		if p != 0 {
+			return
+		}
+	}
+	t.Errorf("nothing drawn on the %s screen", stateNames[currentState])
+}
+
+// inState fails the test unless the controller is in state
+func inState(t *testing.T, state AppState, after string) {
+	t.Helper()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if currentState != state {
+		t.Fatalf("state %s after %s, want %s", stateNames[currentState], after, stateNames[state])
+	}
+}
+
+// click presses the encoder, waiting out the double-click window of the
+// screens that have one, and draws the result
+func click(t *testing.T) {
+	t.Helper()
+	onEncoderClick()
+	for deadline := time.Now().Add(time.Second); ; {
+		mutex.Lock()
+		pending := pendingClick != nil
+		mutex.Unlock()
+		if !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("click never resolved")
+		}
+		time.Sleep(doubleClickWindow / 4)
+	}
+	drawn(t)
+}
+
+// turn rotates the encoder one step and draws the result
+func turn(t *testing.T, direction int) {
+	t.Helper()
+	onEncoderRotate(direction)
+	drawn(t)
+}
+
+// selectItem turns the encoder until the menu item with the given ID or
+// label is selected
+func selectItem(t *testing.T, item string) {
+	t.Helper()
+	mutex.Lock()
+	count := len(currentMenuItems())
+	mutex.Unlock()
+	for i := 0; i <= count; i++ {
+		mutex.Lock()
+		items := currentMenuItems()
+		found := selectedMenu < len(items) && (items[selectedMenu].ID == item || items[selectedMenu].Label == item)
+		mutex.Unlock()
+		if found {
+			return
+		}
+		turn(t, 1)
+	}
+	t.Fatalf("no %q on the %s screen", item, stateNames[currentState])
+}
+
+// until draws frames until cond holds, as the display loop would
+func until(t *testing.T, cond func() bool, timeout time.Duration, what string) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); ; {
+		render()
+		mutex.Lock()
+		ok := cond()
+		mutex.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// useTargets records to targets for the rest of the test
+func useTargets(t *testing.T, targets []*RecordTarget) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	saved := recordTargets
+	recordTargets = targets
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		recordTargets = saved
+	})
+}
+
+func TestEveryScreenInBothLayouts(t *testing.T) {
+	for state, name := range stateNames {
+		_, menu := menuScreens[state]
+		_, standard := standardLayout.screens[state]
+		_, large := largeLayout.screens[state]
+		if !menu && (!standard || !large) {
+			t.Errorf("%s screen: standard layout %t, large layout %t", name, standard, large)
+		}
+	}
+}
+
+func TestRecordInBothLayouts(t *testing.T) {
+	inEachLayout(t, func(t *testing.T) {
+		useTargets(t, []*RecordTarget{{Name: "A", Path: t.TempDir()}})
+		mutex.Lock()
+		demoMode = true
+		channels := channelCount
+		channelCount = testChannels
+		mutex.Unlock()
+		t.Cleanup(func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if isRecording || startingRecorder != nil {
+				stopRecording()
+			}
+			demoMode, channelCount, lastTake = false, channels, nil
+		})
+
+		drawn(t)
+		onButtonPress(hardware.RecordButton)
+		until(t, func() bool { return currentState == StateRecording }, 2*firstSamplesTimeout, "the take to start")
+		mutex.Lock()
+		if !isRecording {
+			t.Error("recording screen shown without a take")
+		}
+		mutex.Unlock()
+		turn(t, 1) // The next recording view
+		turn(t, -1)
+		until(t, func() bool { return recorder.FramesWritten() > 0 }, time.Second, "samples")
+
+		onButtonPress(hardware.StopButton)
+		drawn(t)
+		inState(t, StateRecordingSummary, "stopping")
+		mutex.Lock()
+		files := lastTake.Files
+		mutex.Unlock()
+		if _, err := os.Stat(files[0]); err != nil {
+			t.Errorf("take not on the target: %v", err)
+		}
+		click(t)
+		inState(t, StateIdle, "leaving the summary")
+	})
+}
+
+func TestCopyInBothLayouts(t *testing.T) {
+	inEachLayout(t, func(t *testing.T) {
+		_, targets := recordTestTake(t, recordBlockFrames)
+		useTargets(t, targets)
+		mutex.Lock()
+		mounted := usbMounted
+		usbMounted = true
+		mutex.Unlock()
+		t.Cleanup(func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			usbMounted = mounted
+		})
+
+		click(t)
+		inState(t, StateSettings, "clicking on the idle screen")
+		selectItem(t, "copy_files")
+		click(t)
+		inState(t, StateCopyFiles, "choosing Copy Files")
+		selectItem(t, i18n.T("copy.start"))
+		click(t)
+
+		// No drive is mounted, so the take needs another drive
+		inState(t, StateConfirm, "starting the copy")
+		turn(t, 1)
+		click(t)
+		inState(t, StateCopying, "agreeing to span drives")
+
+		// Holding cancels the copy waiting for the next drive
+		onEncoderHold()
+		until(t, func() bool { return !isCopying }, time.Second, "the copy to end")
+		inState(t, StateIdle, "cancelling the copy")
+	})
+}
+
+func TestConfirmInBothLayouts(t *testing.T) {
+	inEachLayout(t, func(t *testing.T) {
+		file, targets := recordTestTake(t, recordBlockFrames)
+		useTargets(t, targets)
+		openDeleteAll := func() {
+			click(t)
+			selectItem(t, "system_options")
+			click(t)
+			selectItem(t, "delete_all")
+			click(t)
+			inState(t, StateConfirm, "choosing Delete All")
+		}
+
+		// No is selected first and keeps the recordings
+		openDeleteAll()
+		click(t)
+		inState(t, StateIdle, "declining")
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("declined delete removed the take: %v", err)
+		}
+
+		openDeleteAll()
+		turn(t, 1)
+		click(t)
+		inState(t, StateIdle, "confirming")
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Error("confirmed delete left the take")
+		}
+	})
+}
+
+func TestBootsOnBitmapFont(t *testing.T) {
+	inEachLayoutOn(t, hardware.NewFontlessManager, func(t *testing.T) {
+		drawn(t)
+		mutex.Lock()
+		warned := bytes.Clone(hwManager.Snapshot().Pix)
+		fontless := hwManager
+		hwManager = hardware.NewHeadlessManager()
+		mutex.Unlock()
+		render()
+		mutex.Lock()
+		if bytes.Equal(hwManager.Snapshot().Pix, warned) {
+			t.Error("idle screen does not warn that the fonts are missing")
+		}
+		hwManager = fontless
+		mutex.Unlock()
+
+		// Every settings item lays out in the bitmap font
+		click(t)
+		inState(t, StateSettings, "clicking on the idle screen")
+		mutex.Lock()
+		count := len(currentMenuItems())
+		mutex.Unlock()
+		for i := 0; i < count; i++ {
+			turn(t, 1)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+// Package ltc decodes SMPTE linear timecode from an audio signal.
+package ltc
+
+import (
+	"fmt"
+	"math"
+)
+
+// syncWord is the 16-bit LTC sync pattern in transmission order (bits 64-79)
+var syncWord = [16]uint8{0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 1}
+
+// frameBits is the number of bits in one LTC frame
+const frameBits = 80
+
+// Timecode is an hours:minutes:seconds:frames value
+type Timecode struct {
+	Hours     int
+	Minutes   int
+	Seconds   int
+	Frames    int
+	DropFrame bool
+}
+
+// String formats the timecode as HH:MM:SS:FF, using ';' before the frames
+// for drop-frame code
+func (tc Timecode) String() string {
+	sep := ":"
+	if tc.DropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+// SecondsAt returns the timecode as seconds since midnight at the given frame rate
+func (tc Timecode) SecondsAt(fps int) float64 {
+	return float64(tc.Hours*3600+tc.Minutes*60+tc.Seconds) + float64(tc.Frames)/float64(fps)
+}
+
+// FromSamples converts a sample offset since midnight into a timecode
+func FromSamples(samples int64, sampleRate, fps int) Timecode {
+	if sampleRate <= 0 || fps <= 0 {
+		return Timecode{}
+	}
+	totalFrames := samples * int64(fps) / int64(sampleRate)
+	frames := int(totalFrames % int64(fps))
+	totalSeconds := totalFrames / int64(fps)
+	return Timecode{
+		Hours:   int(totalSeconds/3600) % 24,
+		Minutes: int(totalSeconds/60) % 60,
+		Seconds: int(totalSeconds % 60),
+		Frames:  frames,
+	}
+}
+
+// Frame is a decoded LTC frame
+type Frame struct {
+	Timecode
+	// StartSample is the index of the sample where the frame began, counted
+	// from the first sample passed to the decoder
+	StartSample int64
+	// FPS is the nominal frame rate estimated from the bit rate (24, 25 or 30)
+	FPS int
+}
+
+// Decoder recovers LTC frames from a stream of samples. LTC is biphase-mark
+// coded: every bit cell starts with a transition and a 1 has an extra
+// transition in the middle, so the decoder classifies the intervals between
+// zero crossings as half or whole bit periods.
+type Decoder struct {
+	sampleRate int
+	threshold  int32
+
+	sample    int64 // Index of the next sample
+	positive  bool
+	lastEdge  int64
+	bitPeriod float64 // Estimated bit length in samples
+	halfSeen  bool
+	halfStart int64 // Edge that began the half bit seen
+
+	bits   [frameBits]uint8
+	starts [frameBits]int64 // Sample where each bit in the ring began
+	count  int              // Valid bits in the ring, up to frameBits
+	head   int              // Next write position in the ring
+}
+
+// NewDecoder creates a decoder for a signal at the given sample rate
+func NewDecoder(sampleRate int) *Decoder {
+	d := &Decoder{
+		sampleRate: sampleRate,
+		// Ignore crossings closer than ~-40dBFS to zero
+		threshold: math.MaxInt32 / 100,
+	}
+	d.reset()
+	return d
+}
+
+// reset drops bit sync, e.g. after a dropout
+func (d *Decoder) reset() {
+	d.bitPeriod = float64(d.sampleRate) / (frameBits * 25)
+	d.halfSeen = false
+	d.count = 0
+}
+
+// Process consumes samples and returns any frames that completed within them
+func (d *Decoder) Process(samples []int32) []Frame {
+	var frames []Frame
+	for _, s := range samples {
+		edge := false
+		if d.positive && s < -d.threshold {
+			d.positive = false
+			edge = true
+		} else if !d.positive && s > d.threshold {
+			d.positive = true
+			edge = true
+		}
+
+		if edge {
+			if frame, ok := d.edge(d.sample - d.lastEdge); ok {
+				frames = append(frames, frame)
+			}
+			d.lastEdge = d.sample
+		}
+		d.sample++
+	}
+	return frames
+}
+
+// edge handles a transition interval samples after the previous one
+func (d *Decoder) edge(interval int64) (Frame, bool) {
+	length := float64(interval)
+
+	switch {
+	case length > 1.5*d.bitPeriod || length < 0.25*d.bitPeriod:
+		// Out of range: noise, a dropout or stopped code
+		d.reset()
+		return Frame{}, false
+
+	case length >= 0.75*d.bitPeriod:
+		// Whole bit period: a 0
+		if d.halfSeen {
+			d.reset()
+			return Frame{}, false
+		}
+		d.bitPeriod = d.bitPeriod*0.9 + length*0.1
+		return d.push(0, d.lastEdge)
+
+	default:
+		// Half bit period: two in a row make a 1
+		if !d.halfSeen {
+			d.halfSeen = true
+			d.halfStart = d.lastEdge
+			return Frame{}, false
+		}
+		d.halfSeen = false
+		return d.push(1, d.halfStart)
+	}
+}
+
+// push appends a bit that began at sample start and decodes a frame if it
+// completes a sync word
+func (d *Decoder) push(bit uint8, start int64) (Frame, bool) {
+	d.bits[d.head] = bit
+	d.starts[d.head] = start
+	d.head = (d.head + 1) % frameBits
+	if d.count < frameBits {
+		d.count++
+		if d.count < frameBits {
+			return Frame{}, false
+		}
+	}
+
+	// The oldest bit in the ring is bit 0 of the candidate frame
+	var frame [frameBits]uint8
+	for i := 0; i < frameBits; i++ {
+		frame[i] = d.bits[(d.head+i)%frameBits]
+	}
+	for i := 0; i < 16; i++ {
+		if frame[64+i] != syncWord[i] {
+			return Frame{}, false
+		}
+	}
+
+	tc := decodeTimecode(frame)
+	fps := d.nominalFPS()
+	if tc.Hours > 23 || tc.Minutes > 59 || tc.Seconds > 59 || tc.Frames >= fps {
+		return Frame{}, false
+	}
+
+	return Frame{
+		Timecode:    tc,
+		StartSample: d.starts[d.head],
+		FPS:         fps,
+	}, true
+}
+
+// nominalFPS snaps the measured frame rate to 24, 25 or 30
+func (d *Decoder) nominalFPS() int {
+	fps := float64(d.sampleRate) / (frameBits * d.bitPeriod)
+	switch {
+	case fps < 24.5:
+		return 24
+	case fps < 27.5:
+		return 25
+	default:
+		return 30
+	}
+}
+
+// decodeTimecode reads the BCD fields of an LTC frame
+func decodeTimecode(bits [frameBits]uint8) Timecode {
+	value := func(start, n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v |= int(bits[start+i]) << i
+		}
+		return v
+	}
+	return Timecode{
+		Frames:    value(0, 4) + 10*value(8, 2),
+		DropFrame: bits[10] == 1,
+		Seconds:   value(16, 4) + 10*value(24, 3),
+		Minutes:   value(32, 4) + 10*value(40, 3),
+		Hours:     value(48, 4) + 10*value(56, 2),
+	}
+}
@@ -0,0 +1,228 @@
+package ltc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// level is the amplitude of the encoded code, about -6dBFS
+const level = 1 << 30
+
+// encodeFrame lays out the bits of one LTC frame
+func encodeFrame(tc Timecode) [frameBits]uint8 {
+	var b [frameBits]uint8
+	put := func(start, n, v int) {
+		for i := 0; i < n; i++ {
+			b[start+i] = uint8(v >> i & 1)
+		}
+	}
+	put(0, 4, tc.Frames%10)
+	put(8, 2, tc.Frames/10)
+	if tc.DropFrame {
+		b[10] = 1
+	}
+	put(16, 4, tc.Seconds%10)
+	put(24, 3, tc.Seconds/10)
+	put(32, 4, tc.Minutes%10)
+	put(40, 3, tc.Minutes/10)
+	put(48, 4, tc.Hours%10)
+	put(56, 2, tc.Hours/10)
+	copy(b[64:], syncWord[:])
+	return b
+}
+
+// next returns the timecode one frame after tc
+func next(tc Timecode, fps int) Timecode {
+	tc.Frames++
+	if tc.Frames == fps {
+		tc.Frames = 0
+		tc.Seconds++
+	}
+	if tc.Seconds == 60 {
+		tc.Seconds = 0
+		tc.Minutes++
+	}
+	if tc.Minutes == 60 {
+		tc.Minutes = 0
+		tc.Hours++
+	}
+	if tc.Hours == 24 {
+		tc.Hours = 0
+	}
+	return tc
+}
+
+// encode biphase-mark codes count frames from start as samples. A bit more
+// than the frames is returned, as the decoder completes a frame on the
+// transition that starts the next.
+func encode(start Timecode, count, fps, sampleRate int) []int32 {
+	var bits []uint8
+	tc := start
+	for i := 0; i < count; i++ {
+		frame := encodeFrame(tc)
+		bits = append(bits, frame[:]...)
+		tc = next(tc, fps)
+	}
+	bits = append(bits, 0)
+
+	// Every bit starts with a transition and a 1 has another half way
+	startHigh := make([]bool, len(bits))
+	midHigh := make([]bool, len(bits))
+	high := false
+	for i, bit := range bits {
+		high = !high
+		startHigh[i] = high
+		if bit == 1 {
+			high = !high
+		}
+		midHigh[i] = high
+	}
+
+	period := float64(sampleRate) / float64(frameBits*fps)
+	samples := make([]int32, int(float64(len(bits))*period))
+	for i := range samples {
+		t := float64(i) / period
+		bit := int(t)
+		high := startHigh[bit]
+		if t-float64(bit) >= 0.5 {
+			high = midHigh[bit]
+		}
+		samples[i] = -level
+		if high {
+			samples[i] = level
+		}
+	}
+	return samples
+}
+
+// checkFrames verifies frames are count consecutive frames from start,
+// each beginning where it was encoded
+func checkFrames(t *testing.T, frames []Frame, start Timecode, count, fps, sampleRate int, offset int64) {
+	t.Helper()
+	if len(frames) != count {
+		t.Fatalf("decoded %d frames, want %d", len(frames), count)
+	}
+	period := float64(sampleRate) / float64(fps)
+	tc := start
+	for i, f := range frames {
+		if f.Timecode != tc {
+			t.Errorf("frame %d is %v, want %v", i, f.Timecode, tc)
+		}
+		if f.FPS != fps {
+			t.Errorf("frame %d at %dfps, want %d", i, f.FPS, fps)
+		}
+		want := offset + int64(float64(i)*period)
+		if d := f.StartSample - want; d < -1 || d > 1 {
+			t.Errorf("frame %d starts at sample %d, want %d", i, f.StartSample, want)
+		}
+		tc = next(tc, fps)
+	}
+}
+
+func TestDecodeFrameRates(t *testing.T) {
+	start := Timecode{Hours: 10, Minutes: 59, Seconds: 59, Frames: 20}
+	for _, sampleRate := range []int{44100, 48000, 96000} {
+		for _, fps := range []int{24, 25, 30} {
+			d := NewDecoder(sampleRate)
+			frames := d.Process(encode(start, 12, fps, sampleRate))
+			checkFrames(t, frames, start, 12, fps, sampleRate, 0)
+		}
+	}
+}
+
+func TestDecodeAcrossBlocks(t *testing.T) {
+	start := Timecode{Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}
+	samples := encode(start, 10, 25, 48000)
+
+	// Blocks that split bits, frames and the sync word anywhere
+	d := NewDecoder(48000)
+	var frames []Frame
+	for len(samples) > 0 {
+		n := min(37, len(samples))
+		frames = append(frames, d.Process(samples[:n])...)
+		samples = samples[n:]
+	}
+	checkFrames(t, frames, start, 10, 25, 48000, 0)
+}
+
+func TestDecodeInvertedPolarity(t *testing.T) {
+	start := Timecode{Hours: 23, Minutes: 0, Seconds: 0, Frames: 0}
+	samples := encode(start, 5, 30, 48000)
+	for i := range samples {
+		samples[i] = -samples[i]
+	}
+	frames := NewDecoder(48000).Process(samples)
+	checkFrames(t, frames, start, 5, 30, 48000, 0)
+}
+
+func TestDecodeDropFrameFlag(t *testing.T) {
+	start := Timecode{Hours: 12, Seconds: 10, DropFrame: true}
+	frames := NewDecoder(48000).Process(encode(start, 3, 30, 48000))
+	checkFrames(t, frames, start, 3, 30, 48000, 0)
+	if len(frames) > 0 && frames[0].String() != "12:00:10;00" {
+		t.Errorf("drop-frame code formats as %s, want 12:00:10;00", frames[0])
+	}
+}
+
+func TestDecodeAfterDropout(t *testing.T) {
+	first := Timecode{Hours: 8}
+	second := Timecode{Hours: 8, Seconds: 2}
+	silence := make([]int32, 24000)
+	samples := append(encode(first, 4, 25, 48000), silence...)
+	resume := int64(len(samples))
+	samples = append(samples, encode(second, 4, 25, 48000)...)
+
+	// The code may come back on either polarity, so the first frame after
+	// the dropout can be lost while the decoder finds the bit edges again
+	frames := NewDecoder(48000).Process(samples)
+	if len(frames) < 7 {
+		t.Fatalf("decoded %d frames, want 4 before the dropout and at least 3 after", len(frames))
+	}
+	checkFrames(t, frames[:4], first, 4, 25, 48000, 0)
+	after := frames[len(frames)-3:]
+	checkFrames(t, after, next(second, 25), 3, 25, 48000, resume+48000/25)
+}
+
+func TestDecodeIgnoresNoise(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	quiet := make([]int32, 48000)
+	loud := make([]int32, 48000)
+	for i := range quiet {
+		quiet[i] = int32(rng.Intn(2*level/200) - level/200)
+		loud[i] = int32(rng.Intn(2*level) - level)
+	}
+	if frames := NewDecoder(48000).Process(quiet); len(frames) != 0 {
+		t.Errorf("decoded %d frames from noise under the threshold", len(frames))
+	}
+	if frames := NewDecoder(48000).Process(loud); len(frames) != 0 {
+		t.Errorf("decoded %d frames from full-scale noise", len(frames))
+	}
+}
+
+func TestFromSamples(t *testing.T) {
+	tests := []struct {
+		samples    int64
+		sampleRate int
+		fps        int
+		want       string
+	}{
+		{0, 48000, 25, "00:00:00:00"},
+		{48000*3600*10 + 48000*61 + 48000/25*7, 48000, 25, "10:01:01:07"},
+		{48000*86400 - 1, 48000, 30, "23:59:59:29"},
+		{48000 * 86400, 48000, 30, "00:00:00:00"},
+		{44100*90 + 44100*23/24 + 1, 44100, 24, "00:01:30:23"},
+		{1000, 0, 25, "00:00:00:00"},
+	}
+	for _, tt := range tests {
+		if got := FromSamples(tt.samples, tt.sampleRate, tt.fps).String(); got != tt.want {
+			t.Errorf("FromSamples(%d, %d, %d) = %s, want %s", tt.samples, tt.sampleRate, tt.fps, got, tt.want)
+		}
+	}
+}
+
+func TestSecondsAt(t *testing.T) {
+	tc := Timecode{Hours: 1, Minutes: 1, Seconds: 1, Frames: 12}
+	if got := tc.SecondsAt(24); got != 3661.5 {
+		t.Errorf("SecondsAt(24) = %v, want 3661.5", got)
+	}
+}
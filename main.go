@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math"
@@ -9,12 +12,11 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"pi9696/hardware"
+	"pi9696/i18n"
 )
 
 const (
@@ -38,6 +40,22 @@ const (
 	StateSystemOptions
 	StateNetworkInfo
 	StateConfirm
+	StateRecordingSummary
+	StateRecordings
+	StateFileDetails
+	StateQuickJump
+	StatePreflight
+	StateNoteEditor
+	StateAbout
+	StateStorageHealth
+	StateChannelNames
+	StatePlayback
+	StateCopySummary
+	StateMarkers
+	StateImportFiles
+	StateRemoteControl
+	StateError
+	StateStarting
 )
 
 type MenuMode int
@@ -51,6 +69,11 @@ const (
 	FormatConfirm
 	ShutdownConfirm
 	RestartConfirm
+	ShowConfigConfirm
+	WearResetConfirm
+	SpanConfirm
+	RenameConfirm
+	FactoryResetConfirm
 )
 
 type ConfirmOption int
@@ -68,7 +91,24 @@ var (
 	isRecording    = false
 	isCopying      = false
 	recordStart    time.Time
-	recordingFile  string
+	recorder       *Recorder
+	// startingRecorder is a take waiting for its first samples
+	startingRecorder *Recorder
+	recorderLTC    *ltcReader
+	recorderPeaks  *peakRecorder
+	recordLease    *Lease
+	lastTake       *TakeInfo
+	detailsFile    string
+	// detailsInfo and detailsTake are the header and sidecar of detailsFile,
+	// read when the details screen opens and when the watcher sees a
+	// change, never while drawing. Either is nil if it cannot be read.
+	detailsInfo *WAVInfo
+	detailsTake *TakeInfo
+	// recordingFiles is the list on the Recordings screen, read when it
+	// opens and kept up to date by the watcher
+	recordingFiles []string
+	config         *Config
+	recordTargets  []*RecordTarget
 	currentState   = StateIdle
 	menuMode       = SettingsMenu
 	selectedMenu   = 0
@@ -79,22 +119,108 @@ var (
 	filesToCopy    = make(map[string]bool)
 	allFiles       []string
 	copyProgress   = 0
+	copyCancel     context.CancelFunc
 	showRemaining  = false
-	infernoPipeCmd *exec.Cmd
 	mutex          sync.Mutex
+
+	// Alert banner state has its own lock so background goroutines can
+	// raise alerts without contending for the UI mutex
+	alertText      string
+	alertUntil     time.Time
+	alertMutex     sync.Mutex
+
+	// Click acknowledgment: a one-frame brightness pulse
+	clickFlash   = true
+	flashPending = false // Pulse on the next frame
+	flashShown   = false // Pulse on the current frame, to end on the next
 )
 
 func main() {
+	// The binary doubles as the synthetic capture pipeline in demo mode
+	if len(os.Args) > 1 && os.Args[1] == demoSourceCommand {
+		if err := runDemoSource(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	flag.BoolVar(&demoMode, "demo", false, "record synthetic audio instead of the Dante input")
+	flag.Parse()
+	if demoMode {
+		log.Printf("Demo mode: recording synthetic audio")
+	}
+
 	var err error
-	hwManager, err = hardware.NewHardwareManager()
+	config, err = loadConfig(ConfigPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	recordTargets = newRecordTargets(config)
+	loadWear()
+	loadRecentEntries()
+	initUnitName(config.UnitName)
+	i18n.SetLanguage(config.Language)
+	largeText = config.LargeText
+	clickFlash = config.ClickFlash
+	confirmStop = config.ConfirmStop.Enabled
+	initAutoRecord(config.AutoRecord)
+	backgroundIO = newIOScheduler(config.BackgroundIO.MBPerSec, config.BackgroundIO.PauseLoad, currentRecorderLoad)
+
+	// Flag untranslated strings; they fall back to English on screen
+	for _, code := range i18n.Languages() {
+		if missing := i18n.Missing(code); len(missing) > 0 {
+			log.Printf("Language %s is missing %d strings: %v", code, len(missing), missing)
+		}
+	}
+
+	hwManager, err = hardware.NewHardwareManager(config.Fonts.overrides())
 	if err != nil {
 		log.Fatalf("Failed to initialize hardware: %v", err)
 	}
 	defer hwManager.Close()
+	if hwManager.FontMissing() {
+		noteError("Fonts missing, using the built-in bitmap font")
+	}
 
+	registerConditions()
+	startStatusLED()
+	registerMenus()
+	registerInfoPanels()
 	setupHardwareCallbacks()
+	mutex.Lock()
+	applyPowerProfile(config.PowerProfile)
+	factorySettings = currentSettings()
+	enterSafeMode()
+	if safeMode {
+		keepDefaultSettings()
+	} else {
+		loadSettings()
+	}
+	runSelfCheck()
+	promptUnitName()
+	enterBootMode()
+	mutex.Unlock()
+	refreshStorage()
+	go storageLoop()
+	startRecordingWatcher()
 	go detectUSB()
 	go updateLoop()
+	go chaseLoop()
+	go statusLoop()
+	go wearLoop()
+	go settingsLoop()
+	go flushOnSignal()
+	startPowerMonitor()
+	if !safeMode {
+		startMQTT()
+		startHTTP()
+		startMDNS()
+		startScheduler()
+	}
+	startMaintenance()
+	mutex.Lock()
+	booted = true
+	mutex.Unlock()
 
 	// Keep main thread alive
 	select {}
@@ -115,25 +241,44 @@ func setupHardwareCallbacks() {
 func onEncoderRotate(direction int) {
 	mutex.Lock()
 	defer mutex.Unlock()
+	noteInput()
+
+	// Turning leaves the take running
+	if stopPrompted() {
+		dismissStopPrompt()
+		return
+	}
 
 	switch currentState {
 	case StateIdle:
-		// No action on idle screen
+		flipPanel(direction)
 
-	case StateSettings:
-		if selectedMenu == 0 { // Sample Rate
-			adjustSampleRate(direction)
-		} else if selectedMenu == 1 { // Channel Count
-			adjustChannelCount(direction)
-		} else {
-			navigateMenu(direction)
+	case StateRecording:
+		rotateRecordView(direction)
+
+	case StateSettings, StateRecordings, StateSystemOptions, StateQuickJump, StateStorageHealth, StateChannelNames, StateCopyFiles, StateMarkers, StateImportFiles, StateRemoteControl:
+		menuRotate(direction)
+
+	case StateRecordingSummary:
+		cycleSummaryOption()
+
+	case StateFileDetails:
+		cycleDetailsOption()
+
+	case StatePlayback:
+		if player != nil {
+			player.Seek(time.Duration(direction) * playSeekStep)
 		}
 
-	case StateCopyFiles:
-		navigateMenu(direction)
+	case StateNoteEditor:
+		noteEditorRotate(direction)
 
-	case StateSystemOptions:
-		navigateMenu(direction)
+	case StateNetworkInfo, StatePreflight, StateAbout, StateCopySummary:
+		// Scroll through the detail lines
+		menuScrollOffset += direction
+		if menuScrollOffset < 0 {
+			menuScrollOffset = 0
+		}
 
 	case StateConfirm:
 		if confirmOption == ConfirmNo {
@@ -147,22 +292,77 @@ func onEncoderRotate(direction int) {
 func onEncoderClick() {
 	mutex.Lock()
 	defer mutex.Unlock()
+	noteInput()
+
+	if stopPrompted() {
+		acknowledge()
+		requestStop(true)
+		return
+	}
+
+	// Screens that ignore clicks get no acknowledgment
+	ignored := (currentState == StateRecording && recordView == 0 && !canMigrate()) || currentState == StateCopying ||
+		(currentState == StateIdle && isRecording)
+	if !ignored {
+		acknowledge()
+	}
 
 	switch currentState {
 	case StateIdle:
 		if !isRecording {
-			currentState = StateSettings
-			selectedMenu = 0
+			openMenu(StateSettings)
 		}
 
 	case StateSettings:
-		handleSettingsClick()
+		menuClickOrDoubleClick(openQuickJump)
+
+	case StateRecordings, StateSystemOptions, StateQuickJump, StateStorageHealth, StateChannelNames, StateCopyFiles, StateMarkers, StateImportFiles, StateRemoteControl:
+		menuItemClick()
 
-	case StateCopyFiles:
-		handleCopyFilesClick()
+	case StateRecordingSummary:
+		if noteOption && lastTake != nil && len(lastTake.Files) > 0 {
+			openNoteEditor(lastTake.Files[0])
+		} else if processOption {
+			processLastTake()
+			currentState = StateIdle
+		} else {
+			currentState = StateIdle
+		}
 
-	case StateSystemOptions:
-		handleSystemOptionsClick()
+	case StateFileDetails:
+		if markerOption {
+			openMenu(StateMarkers)
+		} else if noteOption {
+			openNoteEditor(detailsFile)
+		} else {
+			currentState = StateRecordings
+		}
+
+	case StatePlayback:
+		stopPlayback()
+		currentState = StateFileDetails
+
+	case StateCopySummary:
+		currentState = StateIdle
+
+	case StateError:
+		closeError()
+
+	case StateRecording:
+		if recordView > 0 {
+			recorderMeters.ResetHolds()
+		} else {
+			requestMigrate()
+		}
+
+	case StateNoteEditor:
+		noteEditorClick()
+
+	case StatePreflight:
+		jumpTo(StateSettings, preflightReturn)
+
+	case StateAbout:
+		openMenu(StateSystemOptions)
 
 	case StateConfirm:
 		handleConfirmClick()
@@ -172,11 +372,20 @@ func onEncoderClick() {
 func onEncoderHold() {
 	mutex.Lock()
 	defer mutex.Unlock()
+	noteInput()
 
+	if currentState == StatePlayback {
+		stopPlayback()
+	}
 	if currentState == StateCopying {
-		isCopying = false
+		if copyCancel != nil {
+			copyCancel()
+		}
 		currentState = StateIdle
-	} else if currentState != StateIdle && currentState != StateRecording {
+	} else if currentState == StateNoteEditor {
+		// Cancel the note
+		currentState = noteReturn
+	} else if currentState != StateIdle && currentState != StateRecording && currentState != StateStarting {
 		currentState = StateIdle
 		selectedMenu = 0
 		menuScrollOffset = 0
@@ -186,122 +395,190 @@ func onEncoderHold() {
 func onButtonPress(buttonType hardware.ButtonType) {
 	mutex.Lock()
 	defer mutex.Unlock()
+	noteInput()
 
 	switch buttonType {
 	case hardware.RecordButton:
-		if currentState == StateIdle && !isRecording {
-			startRecording()
-		}
+		requestStart()
 	case hardware.StopButton:
-		if isRecording {
-			stopRecording()
-		}
+		requestStop(false)
+	case hardware.PlayButton:
+		onPlayPress()
 	}
 }
 
-func adjustSampleRate(direction int) {
+// adjustSampleRate steps through the sample rates, unless a take is
+// recording. Must be called with mutex held.
+func adjustSampleRate(direction int) error {
+	if err := checkUnlocked(lockedSampleRate); err != nil {
+		return err
+	}
 	sampleRateIdx += direction
 	if sampleRateIdx < 0 {
 		sampleRateIdx = len(sampleRates) - 1
 	} else if sampleRateIdx >= len(sampleRates) {
 		sampleRateIdx = 0
 	}
+	return nil
 }
 
-func adjustChannelCount(direction int) {
+// adjustChannelCount changes the channel count, unless a take is recording.
+// Must be called with mutex held.
+func adjustChannelCount(direction int) error {
+	if err := checkUnlocked(lockedChannels); err != nil {
+		return err
+	}
 	channelCount += direction
 	if channelCount < 1 {
 		channelCount = 1
 	} else if channelCount > MaxChannelCount {
 		channelCount = MaxChannelCount
 	}
-}
-
-func navigateMenu(direction int) {
-	var maxItems int
-
-	switch currentState {
-	case StateSettings:
-		maxItems = 6 // Sample Rate, Channel Count, Copy Files, System Options, Network Info, Exit
-	case StateCopyFiles:
-		maxItems = len(allFiles) + 3 // Start Copy, [All], [NONE], files...
-	case StateSystemOptions:
-		maxItems = 5 // Delete All, Format USB, Shutdown, Restart, Exit
+	if ltcChannel > channelCount {
+		setLTCChannel(channelCount)
+	}
+	if 2*monitorSource-1 > channelCount {
+		monitorSource = 0
 	}
 
-	selectedMenu += direction
-	if selectedMenu < 0 {
-		selectedMenu = maxItems - 1
-	} else if selectedMenu >= maxItems {
-		selectedMenu = 0
+	// Drop armed channels that no longer exist
+	var armed []int
+	for _, ch := range armedChannels {
+		if ch <= channelCount {
+			armed = append(armed, ch)
+		}
+	}
+	armedChannels = nil
+	if len(armed) > 0 && len(armed) < channelCount {
+		armedChannels = armed
 	}
+	return nil
 }
 
-func handleSettingsClick() {
-	switch selectedMenu {
-	case 0, 1: // Sample Rate or Channel Count - do nothing, direct adjustment
-	case 2: // Copy Files
-		if usbMounted {
+func settingsMenuItems() []menuItem {
+	return []menuItem{
+		{
+			ID:     "sample_rate",
+			Label:  i18n.T("settings.sample_rate"),
+			Value:  func() string { return fmt.Sprintf("%dkHz", sampleRates[sampleRateIdx]/1000) },
+			Adjust: alertIfLocked(adjustSampleRate),
+		},
+		{
+			ID:     "channels",
+			Label:  i18n.T("settings.channels"),
+			Value:  func() string { return strconv.Itoa(channelCount) },
+			Adjust: alertIfLocked(adjustChannelCount),
+		},
+		{
+			ID:     "language",
+			Label:  i18n.T("settings.language"),
+			Value:  func() string { return i18n.Name(i18n.Language()) },
+			Adjust: adjustLanguage,
+		},
+		{ID: "channel_names", Label: i18n.T("settings.channel_names"), Action: func() { openMenu(StateChannelNames) }},
+		{ID: "ltc_input", Label: i18n.T("settings.ltc_input"), Value: ltcChannelText, Adjust: adjustLTCChannel},
+		{ID: "chase", Label: i18n.T("settings.chase"), Value: chaseText, Action: toggleChase},
+		{ID: "auto_record", Label: i18n.T("settings.auto_record"), Value: autoRecordText, Action: toggleAutoRecord},
+		{ID: "large_text", Label: i18n.T("settings.large_text"), Value: largeTextText, Action: toggleLargeText},
+		{ID: "click_flash", Label: i18n.T("settings.click_flash"), Value: clickFlashText, Action: func() { clickFlash = !clickFlash }},
+		{ID: "confirm_stop", Label: i18n.T("settings.confirm_stop"), Value: confirmStopText, Action: func() { confirmStop = !confirmStop }},
+		menuItem{ID: "power_profile", Label: i18n.T("settings.power_profile"), Value: powerProfileText, Adjust: adjustPowerProfile}.
+			disableFor(reasonIf(measuringPower, "reason.measuring_power")),
+		menuItem{ID: "monitor", Label: i18n.T("settings.monitor"), Value: monitorSourceText, Adjust: adjustMonitorSource}.
+			disableFor(dependencyReason(depMonitor)),
+		menuItem{ID: "monitor_device", Label: i18n.T("settings.monitor_device"), Value: monitorDeviceText, Adjust: adjustMonitorDevice}.
+			disableFor(dependencyReason(depMonitor)),
+		{ID: "monitor_volume", Label: i18n.T("settings.monitor_volume"), Value: monitorVolumeText, Adjust: adjustMonitorVolume},
+		{ID: "preflight", Label: i18n.T("settings.preflight"), Action: openPreflight},
+		{ID: "session_note", Label: i18n.T("settings.session_note"), Action: func() { openNoteEditor("") }},
+		{ID: "recordings", Label: i18n.T("settings.recordings"), Action: openRecordings},
+		{ID: "copy_files", Label: i18n.T("settings.copy_files"), Action: func() {
 			loadFilesToCopy()
-			currentState = StateCopyFiles
-			selectedMenu = 0
+			openMenu(StateCopyFiles)
+		}, Disabled: !usbMounted, Reason: i18n.T("reason.no_usb_copy")},
+		{ID: "import_files", Label: i18n.T("settings.import_files"), Action: func() {
+			loadFilesToImport()
+			openMenu(StateImportFiles)
+		}, Disabled: !usbMounted, Reason: i18n.T("reason.no_usb_import")},
+		{ID: "system_options", Label: i18n.T("settings.system_options"), Action: func() { openMenu(StateSystemOptions) }},
+		{ID: "network_info", Label: i18n.T("settings.network_info"), Action: func() { openMenu(StateNetworkInfo) }},
+		{ID: "remote_control", Label: i18n.T("settings.remote_control"), Action: func() { openMenu(StateRemoteControl) }},
+		{Label: i18n.T("common.exit"), Action: func() {
+			currentState = StateIdle
 			menuScrollOffset = 0
-		}
-	case 3: // System Options
-		currentState = StateSystemOptions
-		selectedMenu = 0
-		menuScrollOffset = 0
-	case 4: // Network Info
-		currentState = StateNetworkInfo
-		selectedMenu = 0
-		menuScrollOffset = 0
-	case 5: // Exit
-		currentState = StateIdle
-		menuScrollOffset = 0
+		}},
 	}
 }
 
-func handleCopyFilesClick() {
-	if selectedMenu == 0 { // Start Copy
-		startCopyOperation()
-	} else if selectedMenu == 1 { // [All]
-		for file := range filesToCopy {
-			filesToCopy[file] = true
-		}
-	} else if selectedMenu == 2 { // [NONE]
-		for file := range filesToCopy {
-			filesToCopy[file] = false
-		}
-	} else if selectedMenu >= 3 && selectedMenu-3 < len(allFiles) {
-		file := allFiles[selectedMenu-3]
-		filesToCopy[file] = !filesToCopy[file]
+// recordingsMenuItems lists every recording across the record targets, as
+// read when the screen opened or the watcher last saw a change
+func recordingsMenuItems() []menuItem {
+	var items []menuItem
+	for _, file := range recordingFiles {
+		file := file
+		items = append(items, menuItem{Label: filepath.Base(file), Action: func() { openFileDetails(file) }})
 	}
+	items = append(items, menuItem{Label: i18n.T("common.back"), Action: func() { openMenu(StateSettings) }})
+	return items
 }
 
-func handleSystemOptionsClick() {
-	switch selectedMenu {
-	case 0: // Delete All Recordings
-		menuMode = DeleteConfirm
-		currentState = StateConfirm
-		confirmOption = ConfirmNo
-	case 1: // Format USB Drive
-		if usbMounted {
-			menuMode = FormatConfirm
+// openRecordings lists the recordings on every target. Must be called with
+// mutex held.
+func openRecordings() {
+	recordingFiles = allRecordings(recordTargets)
+	openMenu(StateRecordings)
+}
+
+// openFileDetails shows the details of a recording. Must be called with
+// mutex held.
+func openFileDetails(file string) {
+	detailsFile = file
+	loadFileDetails()
+	currentState = StateFileDetails
+	noteOption, markerOption = false, false
+}
+
+// loadFileDetails reads the header and sidecar of detailsFile for the
+// details screen. Must be called with mutex held.
+func loadFileDetails() {
+	detailsInfo, detailsTake = nil, nil
+	if info, err := readWAVInfo(detailsFile); err == nil {
+		detailsInfo = info
+	}
+	if take, err := readTakeInfo(detailsFile); err == nil {
+		detailsTake = take
+	}
+}
+
+// systemOptionsMenuItems lists the maintenance actions, each behind a confirmation
+func systemOptionsMenuItems() []menuItem {
+	confirm := func(mode MenuMode) func() {
+		return func() {
+			menuMode = mode
 			currentState = StateConfirm
 			confirmOption = ConfirmNo
 		}
-	case 2: // Shutdown System
-		menuMode = ShutdownConfirm
-		currentState = StateConfirm
-		confirmOption = ConfirmNo
-	case 3: // Restart System
-		menuMode = RestartConfirm
-		currentState = StateConfirm
-		confirmOption = ConfirmNo
-	case 4: // Exit
-		currentState = StateSettings
-		selectedMenu = 0
-		menuScrollOffset = 0
+	}
+	return []menuItem{
+		{ID: "delete_all", Label: i18n.T("system.delete_all"), Action: confirm(DeleteConfirm)},
+		menuItem{ID: "format_usb", Label: i18n.T("system.format_usb"), Action: confirm(FormatConfirm)}.
+			disableFor(reasonIf(!usbMounted, "reason.no_usb_format"), dependencyReason(depSudo), dependencyReason(depFormat)),
+		{ID: "unit_name", Label: i18n.T("system.unit_name"), Value: unitNameText, Action: openUnitNameEditor},
+		{ID: "storage_health", Label: i18n.T("system.storage_health"), Action: func() { openMenu(StateStorageHealth) }},
+		backupMenuItem(),
+		menuItem{ID: "measure_power", Label: i18n.T("system.measure_power"), Action: startPowerMeasurement}.
+			disableFor(reasonIf(isRecording, "reason.recording"), reasonIf(measuringPower, "reason.measuring_power")),
+		{ID: "about", Label: i18n.T("system.about"), Action: func() {
+			currentState = StateAbout
+			menuScrollOffset = 0
+		}},
+		menuItem{ID: "export_diagnostics", Label: i18n.T("system.export_diagnostics"), Action: exportDiagnostics}.
+			disableFor(reasonIf(!usbMounted, "reason.no_usb_export")),
+		menuItem{ID: "shutdown", Label: i18n.T("system.shutdown"), Action: confirm(ShutdownConfirm)}.
+			disableFor(reasonIf(isRecording, "reason.recording"), dependencyReason(depSudo)),
+		menuItem{ID: "restart", Label: i18n.T("system.restart"), Action: confirm(RestartConfirm)}.
+			disableFor(reasonIf(isRecording, "reason.recording"), dependencyReason(depSudo)),
+		{Label: i18n.T("common.exit"), Action: func() { openMenu(StateSettings) }},
 	}
 }
 
@@ -313,184 +590,445 @@ func handleConfirmClick() {
 		case FormatConfirm:
 			formatUSB()
 		case ShutdownConfirm:
+			flushSettings(currentSettings())
 			exec.Command("sudo", "shutdown", "-h", "now").Run()
 		case RestartConfirm:
+			flushSettings(currentSettings())
 			exec.Command("sudo", "reboot").Run()
+		case ShowConfigConfirm:
+			applyShowConfig(pendingShow)
+		case WearResetConfirm:
+			resetWear(wearPending)
+		case FactoryResetConfirm:
+			factoryReset()
+		case SpanConfirm:
+			beginCopy(pendingCopy, true)
+			pendingCopy = nil
+			return
+		case RenameConfirm:
+			files := pendingCopy
+			pendingCopy = nil
+			planCopy(files)
+			return
 		}
 	}
+	if menuMode == SpanConfirm || menuMode == RenameConfirm {
+		// Back to the selection to pick less
+		pendingCopy = nil
+		currentState = StateCopyFiles
+		return
+	}
+	if menuMode == ShowConfigConfirm {
+		pendingShow = nil
+	}
 	currentState = StateIdle
 }
 
-func startRecording() {
+// startRecording starts a take with the current settings. A failure is
+// shown and returned. Must be called with mutex held.
+func startRecording() error {
 	recordStart = time.Now()
 	timestamp := recordStart.Format("20060102_150405")
 	sampleRate := sampleRates[sampleRateIdx]
-	recordingFile = fmt.Sprintf("%s/recording_%s_ch%d_%dkHz.wav",
-		RecordPath, timestamp, channelCount, sampleRate/1000)
+	prefix := expandAutoToken(expandFilePrefix(filePrefix), autoTake)
+	baseName := fmt.Sprintf("%s_%s_ch%d_%dkHz", prefix, timestamp, recordedChannelCount(), sampleRate/1000)
+	if demoMode {
+		baseName = demoFilePrefix + baseName
+	}
 
-	os.MkdirAll(RecordPath, 0755)
+	if dependencyReason(depCapture) != "" {
+		err := newOpError(errCaptureMissing, errors.New("capture pipeline missing"))
+		reportError("Failed to start recording", err)
+		showError(err)
+		return err
+	}
 
-	// Build inferno2pipe command
-	var cmdName string
-	var args []string
+	lease, err := resources.TryAcquire(jobRecording, targetPaths()...)
+	if err != nil {
+		setLastError("Failed to start recording: %v", err)
+		showAlert(busyMessage(err), 5*time.Second)
+		return err
+	}
+
+	r, err := newRecorder(recordTargets, sampleRate, channelCount, armedChannelIndexes(), fileChannelNames(), sessionName, baseName)
+	if err != nil {
+		lease.Release()
+		err := newOpError(errNoTarget, err)
+		reportError("Failed to start recording", err)
+		showError(err)
+		return err
+	}
+	stopInputMonitor()
+	// The take may want the output device, and the card to itself
+	stopPlayback()
+	r.OnFailover = func(from, to *RecordTarget, cause error) {
+		noteError(fmt.Sprintf("Record target %s failed (%v), continuing on %s", from.Name, cause, to.Name))
+		showAlert(i18n.Tf("alert.failover", from.Name, to.Name), 10*time.Second)
+	}
+	r.OnMigrate = onMigrate
+	if slate := newSlateTone(config.Slate, sampleRate, channelCount, armedChannelIndexes(), ltcChannel-1); slate != nil {
+		log.Printf("Slate: %.0fHz tone at %.0f dBFS for %dms on channels %v", slate.info.FrequencyHz, slate.info.LevelDB, slate.info.LengthMs, slate.info.Channels)
+		r.SetSlate(slate)
+	}
+	recorderPeaks = newPeakRecorder(sampleRate, channelCount, armedChannelIndexes())
+	r.AddTap(recorderPeaks.Tap)
+	recorderMeters.Reset(sampleRate, channelCount)
+	r.AddTap(recorderMeters.Tap)
+	if autoArmed {
+		r.AddTap(autoMeter.Tap)
+	}
+	startMonitor(r)
+	startBackup(r)
+
+	recorderLTC = nil
+	if ltcChannel > 0 && ltcChannel <= channelCount {
+		recorderLTC = newLTCReader(r, ltcChannel-1)
+		ltcWatch.Resync(sampleRate, channelCount)
+		r.AddTap(ltcWatch.Tap)
+	}
 
-	cmdName = "sh"
-	args = []string{
-		"-c",
-		fmt.Sprintf("sample_rate=%d ./save_to_file %d", sampleRate, channelCount),
+	if err := r.StartPipeline(); err != nil {
+		err := newOpError(errPipelineStart, err)
+		reportError("Failed to start recording with inferno2pipe", err)
+		showError(err)
+		stopMonitor()
+		stopBackup()
+		lease.Release()
+		return err
 	}
+	// The pipeline starts even with no Dante stream, so don't show REC until
+	// audio is actually arriving. The wait runs without the mutex, so the
+	// screen and buttons stay live meanwhile.
+	startingRecorder = r
+	recordLease = lease
+	currentState = StateStarting
+	go awaitFirstSamples(r, sampleRate)
+	return nil
+}
+
+// awaitFirstSamples waits for the first samples of a starting take, then
+// shows REC, or tears the take down if none arrive in time. A take
+// cancelled while waiting is left alone.
+func awaitFirstSamples(r *Recorder, sampleRate int) {
+	err := r.WaitForSamples(firstSamplesTimeout)
 
-	infernoPipeCmd = exec.Command(cmdName, args...)
-	infernoPipeCmd.Dir = "." // Set working directory
-	err := infernoPipeCmd.Start()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if startingRecorder != r {
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to start recording with inferno2pipe: %v", err)
+		cancelStart()
+		err := captureError(err, sampleRate)
+		reportError("Failed to start recording", err)
+		showError(err)
 		return
 	}
+	log.Printf("Recording %s to %s", r.baseName, r.CurrentTarget().Name)
 
+	startingRecorder = nil
+	recorder = r
 	isRecording = true
+	dismissStopPrompt()
+	lastTakeFailed = false
 	currentState = StateRecording
+
+	go watchRecorder(r)
+	go watchMigration(r)
+}
+
+// cancelStart tears down a take still waiting for its first samples and
+// removes its files. Must be called with mutex held.
+func cancelStart() {
+	r := startingRecorder
+	if r == nil {
+		return
+	}
+	startingRecorder = nil
+	r.Cancel()
+	stopMonitor()
+	stopBackup()
+	releaseRecordLease()
+	chaseTake = false
+	autoTake = false
+	scheduleTake = false
+	if currentState == StateStarting {
+		currentState = StateIdle
+	}
+}
+
+// renderStarting shows that a take waits for its first samples
+func renderStarting() {
+	hwManager.DrawCenteredText(i18n.T("rec.starting"), "header", 20)
+	hwManager.DrawCenteredText(i18n.T("rec.waiting"), "details", 36)
+	hwManager.DrawCenteredText(i18n.T("rec.stop_cancels"), "details", 58)
+}
+
+// renderLargeStarting shows that a take waits for its first samples in the
+// large font
+func renderLargeStarting() {
+	drawLargeLines(i18n.T("rec.waiting"), i18n.T("rec.stop_cancels"))
 }
 
 func stopRecording() {
-	if infernoPipeCmd != nil && infernoPipeCmd.Process != nil {
-		infernoPipeCmd.Process.Signal(syscall.SIGTERM)
-		infernoPipeCmd.Wait()
-		infernoPipeCmd = nil
+	if startingRecorder != nil {
+		cancelStart()
+		return
+	}
+	chaseTake = false
+	autoTake = false
+	scheduleTake = false
+	currentState = StateIdle
+	if recorder != nil {
+		if err := recorder.Stop(); err != nil {
+			setLastError("Recording stopped with error: %v", err)
+		}
+		stopMonitor()
+		stopBackup()
+		releaseRecordLease()
+		if finishTake(recorder) {
+			currentState = StateRecordingSummary
+			noteOption, processOption = false, false
+		}
+		recorder = nil
 	}
 	isRecording = false
+}
+
+// releaseRecordLease lets background jobs resume once a take has stopped.
+// Must be called with mutex held.
+func releaseRecordLease() {
+	if recordLease != nil {
+		recordLease.Release()
+		recordLease = nil
+	}
+}
+
+// finishTake writes the sidecar for a stopped take and keeps its details for
+// the summary screen. It returns false if nothing was recorded.
+func finishTake(r *Recorder) bool {
+	if r.FramesWritten() == 0 {
+		return false
+	}
+
+	lastTake = newTakeInfo(r, recorderLTC, ltcChannel)
+	lastTake.Peaks = recorderPeaks.History()
+	if err := writeTakeInfo(lastTake); err != nil {
+		setLastError("Failed to write take sidecar: %v", err)
+	}
+	go flushWear()
+	if r.Migrated() {
+		startTakeMigration(*lastTake)
+	}
+	if lastTake.LTCDriftMs != nil {
+		log.Printf("Take %s stamped from LTC %s (%.1fms from system clock)", lastTake.Name, lastTake.StartTimecode, *lastTake.LTCDriftMs)
+	}
+	return true
+}
+
+// watchRecorder returns the UI to idle if a take ends on its own, e.g. when
+// every record target has failed
+func watchRecorder(r *Recorder) {
+	<-r.Done()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if recorder != r {
+		return // Stopped normally
+	}
+	err := r.Stop()
+	if err != nil {
+		err = storageError(err)
+		reportError(fmt.Sprintf("Recording %s failed", r.baseName), err)
+		lastTakeFailed = true
+	}
+	stopMonitor()
+	stopBackup()
+	releaseRecordLease()
+	finishTake(r)
+	chaseTake = false
+	autoTake = false
+	scheduleTake = false
+	recorder = nil
+	isRecording = false
 	currentState = StateIdle
+	if err != nil {
+		showError(err)
+	}
 }
 
 func loadFilesToCopy() {
 	allFiles = []string{}
 	filesToCopy = make(map[string]bool)
 
-	files, err := filepath.Glob(filepath.Join(RecordPath, "*.wav"))
-	if err != nil {
+	for _, file := range allRecordings(recordTargets) {
+		allFiles = append(allFiles, file)
+		filesToCopy[file] = true
+	}
+	copyGroups = groupRecordings(allFiles, recordTargets, filesToCopy)
+}
+
+func startCopyOperation() {
+	if !usbMounted {
+		showError(errNoUSB)
 		return
 	}
 
-	for _, file := range files {
-		basename := filepath.Base(file)
-		allFiles = append(allFiles, basename)
-		filesToCopy[basename] = true
+	selectedFiles := []string{}
+	for file, selected := range filesToCopy {
+		if selected {
+			selectedFiles = append(selectedFiles, file)
+		}
 	}
+	if len(selectedFiles) == 0 {
+		currentState = StateIdle
+		return
+	}
+	sort.Strings(selectedFiles)
 
-	sort.Strings(allFiles)
+	// Say before copying when names have to change for a FAT drive
+	if n := renamedFiles(selectedFiles, USBMountPoint); n > 0 {
+		pendingCopy, copyRenamed = selectedFiles, n
+		menuMode = RenameConfirm
+		currentState = StateConfirm
+		confirmOption = ConfirmNo
+		return
+	}
+	planCopy(selectedFiles)
 }
 
-func startCopyOperation() {
-	if !usbMounted {
+// planCopy copies selectedFiles to the USB drive, first offering to span
+// drives when they do not fit on this one. Must be called with mutex held.
+func planCopy(selectedFiles []string) {
+	var need uint64
+	for _, file := range selectedFiles {
+		need += uint64(copySize(file))
+	}
+	if free, _ := usbSpace(); need > free {
+		pendingCopy, copyNeed, copyFree = selectedFiles, need, free
+		menuMode = SpanConfirm
+		currentState = StateConfirm
+		confirmOption = ConfirmNo
 		return
 	}
+	beginCopy(selectedFiles, false)
+}
 
+// beginCopy copies selectedFiles to the USB drive in the background, across
+// several drives if span is set. Must be called with mutex held.
+func beginCopy(selectedFiles []string, span bool) {
 	currentState = StateCopying
 	isCopying = true
 	copyProgress = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	copyCancel = cancel
 
 	go func() {
-		selectedFiles := []string{}
-		for file, selected := range filesToCopy {
-			if selected {
-				selectedFiles = append(selectedFiles, file)
-			}
-		}
-
-		if len(selectedFiles) == 0 {
-			mutex.Lock()
-			isCopying = false
-			currentState = StateIdle
-			mutex.Unlock()
-			return
-		}
-
-		for i, file := range selectedFiles {
-			if !isCopying {
-				break
+		defer cancel()
+
+		// A recording pauses the copy rather than competing with it for the card
+		lease, err := resources.Acquire(ctx, jobCopy, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 3*time.Second)
+		}, append(targetPaths(), USBMountPoint)...)
+		if err == nil {
+			defer lease.Release()
+			checkpoint := func() error {
+				return lease.Checkpoint(ctx, func() {
+					showAlert(i18n.Tf("resource.paused", jobCopy.Label()), 3*time.Second)
+				})
 			}
-
-			src := filepath.Join(RecordPath, file)
-			dst := filepath.Join(USBMountPoint, file)
-
-			err := copyFile(src, dst)
-			if err != nil {
-				log.Printf("Failed to copy %s: %v", file, err)
+			progress := startBackgroundJob(jobCopy, totalSize(selectedFiles))
+			defer progress.Finish()
+			if span {
+				results, failed := spanCopy(ctx, selectedFiles, checkpoint, progress)
+				mutex.Lock()
+				spanResults, spanFailed = results, failed
+				if currentState == StateCopying && ctx.Err() == nil {
+					currentState = StateCopySummary
+					menuScrollOffset = 0
+				}
+				mutex.Unlock()
+			} else {
+				jobs := copyJobs(selectedFiles, USBMountPoint, progress)
+				err = runCopyJobs(ctx, jobs, checkpoint, func(done int) {
+					mutex.Lock()
+					copyProgress = int(float64(done) / float64(len(selectedFiles)) * 100)
+					mutex.Unlock()
+				})
+				if err := writeRenameManifest(USBMountPoint, jobs); err != nil {
+					setLastError("Failed to write the list of renamed files: %v", err)
+				}
 			}
-
-			mutex.Lock()
-			copyProgress = int(float64(i+1) / float64(len(selectedFiles)) * 100)
-			mutex.Unlock()
 		}
 
 		mutex.Lock()
 		isCopying = false
-		currentState = StateIdle
+		copyCancel = nil
+		if currentState == StateCopying {
+			currentState = StateIdle
+			if err != nil && ctx.Err() == nil {
+				showError(err)
+			}
+		}
 		mutex.Unlock()
 	}()
 }
 
-func copyFile(src, dst string) error {
-	input, err := os.ReadFile(src)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(dst, input, 0644)
-}
-
 func deleteAllRecordings() {
-	files, err := filepath.Glob(filepath.Join(RecordPath, "*.wav"))
+	lease, err := resources.TryAcquire(jobDelete, targetPaths()...)
 	if err != nil {
+		showAlert(busyMessage(err), 5*time.Second)
 		return
 	}
-	for _, file := range files {
+	defer lease.Release()
+
+	for _, file := range allRecordings(recordTargets) {
 		os.Remove(file)
 	}
 }
 
+// formatUSB formats the USB drive once nothing else is using it
 func formatUSB() {
 	if !usbMounted {
 		return
 	}
-	exec.Command("sudo", "umount", USBMountPoint).Run()
-	exec.Command("sudo", "mkfs.vfat", "-F", "32", "/dev/sda1").Run()
-	time.Sleep(2 * time.Second)
+	go func() {
+		lease, err := resources.Acquire(context.Background(), jobFormat, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 5*time.Second)
+		}, USBMountPoint)
+		if err != nil {
+			return
+		}
+		defer lease.Release()
+
+		exec.Command("sudo", "umount", USBMountPoint).Run()
+		exec.Command("sudo", "mkfs.vfat", "-F", "32", "/dev/sda1").Run()
+		time.Sleep(2 * time.Second)
+	}()
 }
 
 func detectUSB() {
 	for {
 		if _, err := os.Stat(USBMountPoint); err == nil {
 			mutex.Lock()
+			if !usbMounted {
+				usbGeneration++
+				checkShowConfig()
+				checkChannelNames()
+			}
 			usbMounted = true
-			usbSize = getUSBSize()
+			usbSize = cachedUSBSize()
+			offerShowConfig()
 			mutex.Unlock()
 		} else {
 			mutex.Lock()
 			usbMounted = false
 			usbSize = ""
+			pendingShow = nil
 			mutex.Unlock()
 		}
-		time.Sleep(1 * time.Second)
-	}
-}
-
-func getUSBSize() string {
-	var stat syscall.Statfs_t
-	if err := syscall.Statfs(USBMountPoint, &stat); err != nil {
-		return ""
-	}
-
-	totalBytes := uint64(stat.Blocks) * uint64(stat.Bsize)
-
-	if totalBytes < 1024*1024*1024 { // Less than 1GB
-		mb := totalBytes / (1024 * 1024)
-		return fmt.Sprintf("%dmb", roundToPowerOfTwo(int(mb)))
-	} else if totalBytes < 1024*1024*1024*1024 { // Less than 1TB
-		gb := totalBytes / (1024 * 1024 * 1024)
-		return fmt.Sprintf("%dGB", roundToPowerOfTwo(int(gb)))
-	} else {
-		tb := totalBytes / (1024 * 1024 * 1024 * 1024)
-		return fmt.Sprintf("%dTB", roundToPowerOfTwo(int(tb)))
+		time.Sleep(time.Duration(usbPollInterval.Load()))
 	}
 }
 
@@ -503,11 +1041,16 @@ func roundToPowerOfTwo(value int) int {
 }
 
 func updateLoop() {
-	ticker := time.NewTicker(100 * time.Millisecond)
+	interval := time.Duration(renderInterval.Load())
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		render()
+		if d := time.Duration(renderInterval.Load()); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
 	}
 }
 
@@ -518,28 +1061,69 @@ func render() {
 	hwManager.ClearDisplay()
 
 	// Always render status bar first
-	renderStatusBar()
+	l := activeLayout()
+	l.statusBar()
 
-	switch currentState {
-	case StateIdle:
-		renderIdleScreen()
-	case StateRecording:
-		renderRecordingScreen()
-	case StateSettings:
-		renderSettingsMenu()
-	case StateCopyFiles:
-		renderCopyFilesMenu()
-	case StateCopying:
-		renderCopyProgress()
-	case StateSystemOptions:
-		renderSystemOptionsMenu()
-	case StateNetworkInfo:
-		renderNetworkInfo()
-	case StateConfirm:
-		renderConfirmDialog()
+	if screen, ok := menuScreens[currentState]; ok {
+		l.menu(screen.title(), screen.items())
+	} else if draw, ok := l.screens[currentState]; ok {
+		draw()
 	}
 
-	hwManager.UpdateDisplay()
+	renderAlert()
+	renderStopPrompt()
+
+	// A display given up on is left alone between retries
+	retryDisplay()
+	if !displayOffline {
+		// The pulse is a contrast command sent alongside the scheduled frame
+		if flashPending {
+			hwManager.SetFlash(true)
+			flashPending, flashShown = false, true
+		} else if flashShown {
+			hwManager.SetFlash(false)
+			flashShown = false
+		}
+
+		checkDisplayUpdate(hwManager.UpdateDisplay())
+	}
+	recordFrame()
+}
+
+// acknowledge confirms an accepted input with a brief brightness pulse on the
+// next frame, for screens where nothing visibly changes. Must be called with
+// mutex held.
+func acknowledge() {
+	if clickFlash {
+		flashPending = true
+	}
+}
+
+// clickFlashText shows whether clicks are acknowledged with a flash
+func clickFlashText() string {
+	if clickFlash {
+		return i18n.T("common.on")
+	}
+	return i18n.T("common.off")
+}
+
+// showAlert displays a banner over the current screen for the given duration
+func showAlert(text string, duration time.Duration) {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+	alertText = text
+	alertUntil = time.Now().Add(duration)
+}
+
+func renderAlert() {
+	alertMutex.Lock()
+	text := alertText
+	active := time.Now().Before(alertUntil)
+	alertMutex.Unlock()
+
+	if active && text != "" {
+		hwManager.DrawBanner(text)
+	}
 }
 
 func renderStatusBar() {
@@ -557,29 +1141,81 @@ func renderStatusBar() {
 	}
 
 	// Use context-aware FiraCode rendering
-	hwManager.DrawStatusBar(formatStr, rightSide)
+	extras := append(lockStatusElements(), safeModeStatusElements()...)
+	extras = append(extras, newerStateStatusElements()...)
+	extras = append(extras, fontStatusElements()...)
+	extras = append(extras, demoStatusElements()...)
+	extras = append(extras, powerStatusElements()...)
+	extras = append(extras, storageStatusElements()...)
+	extras = append(extras, staleStatusElements()...)
+	extras = append(extras, jobStatusElements()...)
+	hwManager.DrawStatusBar(formatStr, rightSide, append(extras, monitorStatusElements()...)...)
+}
+
+// lockStatusElements shows a padlock by the format while a take locks it
+func lockStatusElements() []hardware.StatusElement {
+	if !isRecording {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.LockStatusElement()}
+}
+
+// fontStatusElements warns for as long as the UI is drawn in the built-in
+// bitmap font because the TTF fonts are missing
+func fontStatusElements() []hardware.StatusElement {
+	if !hwManager.FontMissing() {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("font", i18n.T("status.font_missing"), hardware.AlignLeft, 110)}
 }
 
 func renderIdleScreen() {
+	// Name of the loaded show, if any
+	if showName != "" {
+		hwManager.DrawCenteredText(showName, "details", 20)
+	}
+
 	// Use context-aware rendering for standby state
-	hwManager.DrawCenteredText("~ Standby ~", "idle", 32)
+	hwManager.DrawCenteredText(i18n.T("idle.standby"), "idle", 32)
+	renderIdleSignal()
 
-	// Time remaining with enhanced formatting using FiraCode features
-	remaining := estimateRemainingTime()
-	storage := getRemainingStorage()
-	// Use mathematical symbols and arrows for better typography
-	timeText := fmt.Sprintf("⏱ %s (%s) available", formatDuration(remaining), storage)
-	hwManager.DrawCenteredText(timeText, "details", 48)
+	// Rotating detail line: time available, last take, session...
+	hwManager.DrawCenteredText(idlePanelText(), "details", 48)
+
+	// Incoming timecode when an LTC input is designated
+	if ltcChannel > 0 {
+		tcText := "LTC --:--:--:--"
+		if tc, live := ltcWatch.Current(); live {
+			tcText = "LTC " + tc.String()
+		}
+		if chaseArmed {
+			tcText += "  " + i18n.T("idle.chase_armed")
+		}
+		hwManager.DrawCenteredText(tcText, "details", 60)
+	} else if autoArmed {
+		hwManager.DrawCenteredText(autoIdleText(), "details", 60)
+	} else if name := unitName(); name != "" {
+		hwManager.DrawCenteredText(name, "details", 60)
+	}
 }
 
 func renderRecordingScreen() {
+	if recordView > 0 {
+		renderMeterView()
+		return
+	}
+
 	elapsed := time.Since(recordStart)
 	remaining := estimateRemainingTime()
 	storage := getRemainingStorage()
 	filename := ""
 
-	if recordingFile != "" {
-		filename = filepath.Base(recordingFile)
+	if recorder != nil {
+		// Show which record target the take is going to
+		filename = fmt.Sprintf("%s: %s", recorder.CurrentTarget().Name, filepath.Base(recorder.CurrentFile()))
+		if text := migrateStatusText(); text != "" {
+			filename = text
+		}
 	}
 
 	// Use FiraCode's context-aware recording display with enhanced typography
@@ -589,233 +1225,74 @@ func renderRecordingScreen() {
 	hwManager.DrawRecordingStatus(elapsedStr, remainingStr, filename)
 }
 
-func renderSettingsMenu() {
-	// Use FiraCode header context for the title
-	hwManager.DrawCenteredText("⚙ Settings", "header", 20)
-
-	// Menu items using FiraCode MenuItem rendering
-	sampleRate := sampleRates[sampleRateIdx]
-	sampleRateText := fmt.Sprintf("%dkHz", sampleRate/1000)
-
-	// Use arrow ligatures and enhanced typography
-	allItems := []hardware.MenuItem{
-		{Label: "Sample Rate →", Value: sampleRateText},
-		{Label: "Channels →", Value: strconv.Itoa(channelCount)},
-		{Label: "Copy Files → USB", Value: ""},
-		{Label: "System Options →", Value: ""},
-		{Label: "🌐 Network Info →", Value: ""},
-		{Label: "← Exit", Value: ""},
-	}
-
-	// Calculate scrolling parameters
-	maxVisibleItems := 3 // Max items that fit after header (64px height - 20px header - margins)
-	totalItems := len(allItems)
-
-	// Update scroll offset based on selected item
-	if selectedMenu < menuScrollOffset {
-		menuScrollOffset = selectedMenu
-	} else if selectedMenu >= menuScrollOffset + maxVisibleItems {
-		menuScrollOffset = selectedMenu - maxVisibleItems + 1
-	}
-
-	// Ensure scroll offset doesn't go past the end
-	if menuScrollOffset > totalItems - maxVisibleItems {
-		menuScrollOffset = totalItems - maxVisibleItems
-	}
-	if menuScrollOffset < 0 {
-		menuScrollOffset = 0
-	}
-
-	// Create visible items slice
-	endIdx := menuScrollOffset + maxVisibleItems
-	if endIdx > totalItems {
-		endIdx = totalItems
-	}
-	visibleItems := allItems[menuScrollOffset:endIdx]
-
-	// Adjust selected index for visible items
-	visibleSelectedIndex := selectedMenu - menuScrollOffset
-
-	// Draw visible items
-	y := 32
-	fontHeight := hwManager.GetFontHeight()
-
-	for i, item := range visibleItems {
-		// Switch to emphasis font for selected items
-		if i == visibleSelectedIndex {
-			if err := hwManager.SwitchToContext("selected"); err != nil {
-				return
-			}
-		} else {
-			if err := hwManager.SwitchToContext("menu"); err != nil {
-				return
-			}
-		}
-
-		prefix := "  "
-		if i == visibleSelectedIndex {
-			prefix = "> "
-		}
-
-		// Draw label
-		labelText := prefix + item.Label
-		hwManager.DrawText(8, y, labelText)
-
-		// Draw right-aligned value if present
-		if item.Value != "" {
-			valueWidth := hwManager.GetTextWidth(item.Value)
-			hwManager.DrawText(256-valueWidth-16, y, item.Value)
-		}
-
-		y += fontHeight + 2
-	}
-
-	// Draw scroll indicators if needed
-	if totalItems > maxVisibleItems {
-		hwManager.SwitchToContext("details")
-		// Up arrow if we can scroll up
-		if menuScrollOffset > 0 {
-			hwManager.DrawText(240, 32, "↑")
-		}
-		// Down arrow if we can scroll down
-		if menuScrollOffset + maxVisibleItems < totalItems {
-			hwManager.DrawText(240, 52, "↓")
-		}
+// registerMenus sets up the list-style menu screens
+func registerMenus() {
+	title := func(key string) func() string {
+		return func() string { return i18n.T(key) }
 	}
+	registerMenu(StateSettings, title("settings.title"), settingsMenuItems)
+	registerMenu(StateSystemOptions, title("system.title"), systemOptionsMenuItems)
+	registerMenu(StateRecordings, title("recordings.title"), recordingsMenuItems)
+	registerMenu(StateQuickJump, title("quickjump.title"), quickJumpMenuItems)
+	registerMenu(StateStorageHealth, title("wear.title"), storageHealthMenuItems)
+	registerMenu(StateChannelNames, title("channels.title"), channelNamesMenuItems)
+	registerMenu(StateCopyFiles, title("copy.title"), copyFilesMenuItems)
+	registerMenu(StateMarkers, title("markers.title"), markerMenuItems)
+	registerMenu(StateImportFiles, title("import.title"), importFilesMenuItems)
+	registerMenu(StateRemoteControl, title("remote.title"), remoteControlMenuItems)
 }
 
-func renderCopyFilesMenu() {
-	// Use FiraCode header with USB symbol
-	hwManager.DrawCenteredText("📁 → USB Copy", "header", 20)
+// renderRecordingSummary shows the take that was just stopped
+func renderRecordingSummary() {
+	hwManager.DrawCenteredText(i18n.T("summary.title"), "header", 16)
 
-	// Create fixed menu items
-	fixedMenuItems := []hardware.MenuItem{
-		{Label: "▶ Start Copy", Value: ""},
-		{Label: "☑ Select All", Value: fmt.Sprintf("(%d files)", len(allFiles))},
-		{Label: "☐ Clear All", Value: ""},
+	if lastTake != nil {
+		duration := time.Duration(lastTake.DurationSeconds * float64(time.Second))
+		hwManager.DrawCenteredText(lastTake.Name, "details", 26)
+		hwManager.DrawCenteredText(fmt.Sprintf("⏱ %s  TC %s (%s)", formatDuration(duration), lastTake.StartTimecode, lastTake.TimecodeSource), "menu", 37)
+		drawPeakStrip(lastTake.Peaks, peakStripX, peakStripBottom, peakStripHeight)
 	}
 
-	// Calculate scrolling parameters for file list
-	maxVisibleFiles := 2 // Max file items that fit on screen after header and fixed items
-	totalItems := len(fixedMenuItems) + len(allFiles)
-	fixedItemsCount := len(fixedMenuItems)
-
-	// Update scroll offset based on selected item
-	if selectedMenu < menuScrollOffset {
-		menuScrollOffset = selectedMenu
-	} else if selectedMenu >= menuScrollOffset + fixedItemsCount + maxVisibleFiles {
-		menuScrollOffset = selectedMenu - fixedItemsCount - maxVisibleFiles + 1
-	}
-
-	// Ensure scroll offset doesn't go past the end
-	if menuScrollOffset > totalItems - fixedItemsCount - maxVisibleFiles {
-		menuScrollOffset = totalItems - fixedItemsCount - maxVisibleFiles
-	}
-	if menuScrollOffset < 0 {
-		menuScrollOffset = 0
-	}
-
-	// Draw fixed menu items first
-	y := 32
-	fontHeight := hwManager.GetFontHeight()
-
-	for i, item := range fixedMenuItems {
-		if selectedMenu == i {
-			hwManager.SwitchToContext("selected")
-		} else {
-			hwManager.SwitchToContext("menu")
-		}
-
-		prefix := "  "
-		if selectedMenu == i {
-			prefix = "> "
-		}
-
-		labelText := prefix + item.Label
-		hwManager.DrawText(8, y, labelText)
-
-		if item.Value != "" {
-			valueWidth := hwManager.GetTextWidth(item.Value)
-			hwManager.DrawText(256-valueWidth-16, y, item.Value)
-		}
-
-		y += fontHeight + 2
-	}
+	hwManager.DrawCenteredText(summaryOptionText(i18n.T("common.click_continue")), "details", 58)
+}
 
-	// Draw visible file items with scrolling
-	fileStartIdx := 0
-	if selectedMenu >= fixedItemsCount {
-		fileOffset := selectedMenu - fixedItemsCount
-		if fileOffset >= maxVisibleFiles {
-			fileStartIdx = fileOffset - maxVisibleFiles + 1
-		}
-	}
+// renderFileDetails shows the format and start timecode of a recording
+func renderFileDetails() {
+	hwManager.DrawCenteredText(filepath.Base(detailsFile), "header", 16)
 
-	endIdx := fileStartIdx + maxVisibleFiles
-	if endIdx > len(allFiles) {
-		endIdx = len(allFiles)
+	info := detailsInfo
+	if info == nil {
+		hwManager.DrawCenteredText(i18n.T("details.unreadable"), "details", 34)
+		hwManager.DrawCenteredText(detailsOptionText(i18n.T("common.click_return")), "details", 58)
+		return
 	}
 
-	for i := fileStartIdx; i < endIdx; i++ {
-		file := allFiles[i]
-		itemIndex := fixedItemsCount + i
-
-		if selectedMenu == itemIndex {
-			hwManager.SwitchToContext("selected")
-		} else {
-			hwManager.SwitchToContext("menu")
-		}
-
-		prefix := "  "
-		if selectedMenu == itemIndex {
-			prefix = "> "
-		}
-
-		checkbox := "[ ]"
-		if filesToCopy[file] {
-			checkbox = "[X]"
-		}
+	hwManager.DrawCenteredText(fmt.Sprintf("%s  %dkHz %dbit %dch", formatDuration(info.Duration()), info.SampleRate/1000, info.Bits, info.Channels), "details", 26)
 
-		displayName := file
-		maxTextWidth := DisplayWidth - 32 // Account for margins and checkbox
-		if hwManager.GetTextWidth(prefix+checkbox+" "+displayName) > maxTextWidth {
-			// Truncate filename if too long
-			for len(displayName) > 0 && hwManager.GetTextWidth(prefix+checkbox+" "+displayName+"...") > maxTextWidth {
-				displayName = displayName[:len(displayName)-1]
-			}
-			if len(displayName) > 0 {
-				displayName = displayName + "..."
-			}
-		}
-
-		hwManager.DrawText(8, y, fmt.Sprintf("%s%s %s", prefix, checkbox, displayName))
-		y += fontHeight + 2
+	// Prefer the sidecar, which knows the frame rate and source; part files
+	// on another target only have the bext reference
+	tcText := "TC --:--:--:--"
+	if take := detailsTake; take != nil {
+		tcText = fmt.Sprintf("TC %s (%s)", timecodeAt(info.TimeReference, info.SampleRate, take.TimecodeFPS), take.TimecodeSource)
+		drawPeakStrip(take.Peaks, peakStripX, peakStripBottom, peakStripHeight)
+	} else if info.HasBext {
+		tcText = fmt.Sprintf("TC %s", timecodeAt(info.TimeReference, info.SampleRate, config.TimecodeFPS))
 	}
+	hwManager.DrawCenteredText(tcText, "menu", 37)
 
-	// Draw scroll indicators if needed
-	if len(allFiles) > maxVisibleFiles {
-		hwManager.SwitchToContext("details")
-		// Up arrow if we can scroll up
-		if fileStartIdx > 0 {
-			hwManager.DrawText(240, 48, "↑")
-		}
-		// Down arrow if we can scroll down
-		if endIdx < len(allFiles) {
-			hwManager.DrawText(240, 58, "↓")
-		}
-	}
+	hwManager.DrawCenteredText(detailsOptionText(i18n.T("common.click_return")), "details", 58)
 }
 
 func renderCopyProgress() {
 	// Use FiraCode progress bar with enhanced typography
-	title := "📁 → USB Copying..."
-	details := "Hold encoder 3s to cancel"
+	title := copyTitle()
+	details := i18n.T("copy.hold_cancel")
 
 	// Calculate estimated remaining time
-	remainingText := "⏱ Calculating..."
+	remainingText := i18n.T("copy.calculating")
 	if copyProgress > 0 {
 		// Simple estimation based on current progress
-		remainingText = "⏱ ~02:34 remaining"
+		remainingText = i18n.Tf("copy.remaining", "02:34")
 	}
 
 	// Use context-aware progress bar rendering
@@ -825,44 +1302,54 @@ func renderCopyProgress() {
 	hwManager.DrawCenteredText(details, "details", 58)
 }
 
-func renderSystemOptionsMenu() {
-	// Use FiraCode header with system icon
-	hwManager.DrawCenteredText("⚡ System Options", "header", 20)
-
-	// Menu items with enhanced icons and typography
-	items := []hardware.MenuItem{
-		{Label: "🗑 Delete All Recordings", Value: ""},
-		{Label: "💾 Format USB Drive", Value: ""},
-		{Label: "🔌 Shutdown System", Value: ""},
-		{Label: "🔄 Restart System", Value: ""},
-		{Label: "← Exit", Value: ""},
-	}
-
-	// Use context-aware menu rendering
-	hwManager.DrawMenuItems(items, selectedMenu)
-}
-
-func renderConfirmDialog() {
-	var title, message1, message2 string
-
+// confirmText returns the title and message lines of the pending confirmation
+func confirmText() (title, message1, message2 string) {
 	switch menuMode {
 	case DeleteConfirm:
-		title = "⚠ CONFIRM DELETE"
-		message1 = "Delete ALL recordings?"
-		message2 = "This action cannot be undone!"
+		title = i18n.T("confirm.delete.title")
+		message1 = i18n.T("confirm.delete.message")
+		message2 = i18n.T("confirm.delete.warning")
 	case FormatConfirm:
-		title = "⚠ CONFIRM FORMAT"
-		message1 = "Format USB drive?"
-		message2 = "All data will be lost!"
+		title = i18n.T("confirm.format.title")
+		message1 = i18n.T("confirm.format.message")
+		message2 = i18n.T("confirm.format.warning")
 	case ShutdownConfirm:
-		title = "🔌 SHUTDOWN"
-		message1 = "Power off the system?"
+		title = i18n.T("confirm.shutdown.title")
+		message1 = i18n.T("confirm.shutdown.message")
 		message2 = ""
 	case RestartConfirm:
-		title = "🔄 RESTART"
-		message1 = "Restart the system?"
+		title = i18n.T("confirm.restart.title")
+		message1 = i18n.T("confirm.restart.message")
 		message2 = ""
+	case ShowConfigConfirm:
+		title = i18n.T("confirm.show.title")
+		if pendingShow != nil {
+			settings := pendingShow.Settings
+			message1 = i18n.Tf("confirm.show.message", pendingShow.ShowName)
+			message2 = fmt.Sprintf("%dkHz %dch", settings.SampleRate/1000, settings.Channels)
+		}
+	case WearResetConfirm:
+		title = i18n.T("confirm.wear_reset.title")
+		message1 = i18n.Tf("confirm.wear_reset.message", wearPending)
+		message2 = formatWritten(wearOf(wearPending).BytesWritten)
+	case SpanConfirm:
+		title = i18n.T("confirm.span.title")
+		message1 = spanConfirmText()
+		message2 = i18n.T("confirm.span.warning")
+	case RenameConfirm:
+		title = i18n.T("confirm.rename.title")
+		message1 = i18n.Tf("confirm.rename.message", copyRenamed)
+		message2 = i18n.T("confirm.rename.warning")
+	case FactoryResetConfirm:
+		title = i18n.T("confirm.factory_reset.title")
+		message1 = i18n.T("confirm.factory_reset.message")
+		message2 = i18n.T("confirm.factory_reset.warning")
 	}
+	return title, message1, message2
+}
+
+func renderConfirmDialog() {
+	title, message1, message2 := confirmText()
 
 	// Use FiraCode context-aware confirmation dialog
 	selectedOption := 0 // NO is default (safer)
@@ -873,18 +1360,32 @@ func renderConfirmDialog() {
 	hwManager.DrawConfirmationDialog(title, message1, message2, selectedOption)
 }
 
+// networkInfoLines lists the network details, then the MQTT broker state
+func networkInfoLines() []string {
+	return append(hwManager.GetDetailedNetworkInfo(), mqttStatusLines()...)
+}
+
 func renderNetworkInfo() {
 	// Use FiraCode header with network icon
-	hwManager.DrawCenteredText("🌐 Network Information", "header", 16)
+	hwManager.DrawCenteredText(i18n.T("network.title"), "header", 16)
 
 	// Get detailed network information
-	networkDetails := hwManager.GetDetailedNetworkInfo()
+	networkDetails := networkInfoLines()
 
-	// Display network information
+	// Display network information, scrolled with the encoder
 	y := 28
-	maxLines := 4 // Limit to fit on screen
+	maxLines := 3 // Limit to fit on screen above the back instruction
+	if menuScrollOffset > len(networkDetails)-maxLines {
+		menuScrollOffset = len(networkDetails) - maxLines
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
 	for i, detail := range networkDetails {
-		if i >= maxLines {
+		if i < menuScrollOffset {
+			continue
+		}
+		if i >= menuScrollOffset+maxLines {
 			break
 		}
 
@@ -892,20 +1393,27 @@ func renderNetworkInfo() {
 		context := "details"
 		if i == 0 { // Interface name
 			context = "menu"
-		} else if strings.Contains(detail, "Status:") {
-			if strings.Contains(detail, "Connected") {
-				context = "emphasis"
-			} else {
-				context = "details"
-			}
+		} else if detail == i18n.T("network.status_connected") {
+			context = "emphasis"
 		}
 
 		hwManager.DrawCenteredText(detail, context, y)
 		y += 10
 	}
 
+	// Draw scroll indicators if needed
+	if len(networkDetails) > maxLines {
+		hwManager.SwitchToContext("details")
+		if menuScrollOffset > 0 {
+			hwManager.DrawText(240, 28, "↑")
+		}
+		if menuScrollOffset+maxLines < len(networkDetails) {
+			hwManager.DrawText(240, 48, "↓")
+		}
+	}
+
 	// Add back instruction
-	hwManager.DrawCenteredText("Hold encoder to return", "details", 58)
+	hwManager.DrawCenteredText(i18n.T("common.hold_return"), "details", 58)
 }
 
 func formatDuration(d time.Duration) string {
@@ -918,7 +1426,7 @@ func formatDuration(d time.Duration) string {
 
 func estimateRemainingTime() time.Duration {
 	sampleRate := sampleRates[sampleRateIdx]
-	bytesPerSec := float64(sampleRate * channelCount * BitsPerSample / 8)
+	bytesPerSec := float64(sampleRate * recordedChannelCount() * BitsPerSample / 8)
 	free := getFreeSpace()
 	return time.Duration(float64(free)/bytesPerSec) * time.Second
 }
@@ -934,15 +1442,8 @@ func getRemainingStorage() string {
 	}
 }
 
+// getFreeSpace returns the free space across the record targets at the
+// last reading, so drawing a screen never waits on a file system
 func getFreeSpace() uint64 {
-	var stat syscall.Statfs_t
-	path := RecordPath
-	if usbMounted {
-		path = USBMountPoint
-	}
-
-	if err := syscall.Statfs(path, &stat); err != nil {
-		return 0
-	}
-	return stat.Bavail * uint64(stat.Bsize)
+	return cachedFreeSpace()
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Demo takes run the test binary as their capture pipeline
+	if len(os.Args) > 1 && os.Args[1] == demoSourceCommand {
+		if err := runDemoSource(os.Args[2:]); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if path := os.Getenv(settingsWriterEnv); path != "" {
+		writeSettingsForever(path)
+	}
+	config = defaultConfig()
+	initAutoRecord(config.AutoRecord)
+	registerMenus()
+	registerInfoPanels()
+	os.Exit(m.Run())
+}
+
+// beginStart puts r in the starting state as startRecording does and waits
+// for its first samples in the background. The returned channel is closed
+// once the wait has been resolved.
+func beginStart(t *testing.T, r *Recorder) <-chan struct{} {
+	t.Helper()
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		cancelStart()
+		if recorder == r {
+			recorder = nil
+			isRecording = false
+			r.Cancel()
+		}
+		currentState = StateIdle
+		shownError = nil
+	})
+
+	mutex.Lock()
+	startingRecorder = r
+	currentState = StateStarting
+	mutex.Unlock()
+
+	resolved := make(chan struct{})
+	go func() {
+		awaitFirstSamples(r, 48000)
+		close(resolved)
+	}()
+	return resolved
+}
+
+// waitResolved fails the test if the wait for samples is still going
+func waitResolved(t *testing.T, resolved <-chan struct{}, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-resolved:
+	case <-time.After(timeout):
+		t.Fatal("still waiting for the first samples")
+	}
+}
+
+func TestStartingLeavesMutexFree(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, 0)
+	resolved := beginStart(t, r)
+
+	// The buttons and the display keep working while the take waits
+	locked := make(chan struct{})
+	go func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if currentState != StateStarting || isRecording {
+			t.Errorf("state %s while waiting for audio, want starting", stateNames[currentState])
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(firstSamplesTimeout / 2):
+		t.Fatal("mutex held while waiting for the first samples")
+	}
+
+	mutex.Lock()
+	err := requestStart()
+	mutex.Unlock()
+	if err == nil {
+		t.Error("a second take started while the first was starting")
+	}
+	waitResolved(t, resolved, 2*firstSamplesTimeout)
+}
+
+func TestStopWhileStartingAbandonsTake(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, 0)
+	files := r.Files()
+	resolved := beginStart(t, r)
+
+	mutex.Lock()
+	if err := requestStop(false); err != nil {
+		t.Errorf("requestStop() = %v while starting", err)
+	}
+	mutex.Unlock()
+	waitResolved(t, resolved, time.Second)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if isRecording || recorder != nil || startingRecorder != nil {
+		t.Error("abandoned take went on to record")
+	}
+	if currentState != StateIdle {
+		t.Errorf("state %s after abandoning the take, want idle", stateNames[currentState])
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s left behind by the abandoned take", f)
+		}
+	}
+}
+
+func TestStartingWithoutAudioFails(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, 0)
+	resolved := beginStart(t, r)
+	waitResolved(t, resolved, 2*firstSamplesTimeout)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if isRecording || startingRecorder != nil {
+		t.Error("take without audio went on to record")
+	}
+	if currentState != StateError || shownError == nil || shownError.kind != errNoAudio {
+		t.Errorf("state %s showing %v, want the %s error", stateNames[currentState], shownError, errNoAudio.code)
+	}
+}
+
+func TestStartingWithAudioRecords(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, recordBlockFrames*testChannels*4)
+	resolved := beginStart(t, r)
+	waitResolved(t, resolved, 2*firstSamplesTimeout)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !isRecording || recorder != r || startingRecorder != nil {
+		t.Error("take with audio did not start recording")
+	}
+	if currentState != StateRecording {
+		t.Errorf("state %s, want recording", stateNames[currentState])
+	}
+}
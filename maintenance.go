@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/schema"
+)
+
+const (
+	// maintenanceCheck is how often the scheduler looks for the window
+	maintenanceCheck = time.Minute
+	// maintenanceQuiet is how long the controls must be left alone before
+	// maintenance starts
+	maintenanceQuiet = 10 * time.Minute
+	// maintenanceScheduleGuard keeps maintenance clear of a scheduled take
+	// due this soon
+	maintenanceScheduleGuard = 30 * time.Minute
+	// maintenanceWatch is how often a run checks whether it must abort
+	maintenanceWatch = 100 * time.Millisecond
+	// enduranceWarnPercent is the rated endurance left that the health
+	// check reports
+	enduranceWarnPercent = 10
+	verifyBlockSize      = 1 << 20
+)
+
+// maintenancePath keeps the last run, so recordings are verified once
+// across restarts
+var maintenancePath = filepath.Join(StateDir, schema.Maintenance.File)
+
+// maintenanceReport is the outcome of a maintenance run
+type maintenanceReport struct {
+	Version  int       `json:"version"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Aborted  string    `json:"aborted,omitempty"` // Why the run stopped early
+	Verified int       `json:"verified"`
+	Problems []string  `json:"problems,omitempty"`
+	// VerifiedUntil is the newest recording covered by verification, so
+	// the next run only looks at recordings added after it
+	VerifiedUntil time.Time `json:"verified_until"`
+}
+
+var (
+	// lastInput is when the encoder or a button was last used
+	lastInput time.Time
+
+	// lastMaintenance is the last run, shown on the storage health screen
+	lastMaintenance *maintenanceReport
+)
+
+// noteInput records use of the controls, which aborts maintenance. Must be
+// called with mutex held.
+func noteInput() {
+	lastInput = time.Now()
+}
+
+// startMaintenance runs the nightly maintenance window in the background
+func startMaintenance() {
+	if config.Maintenance.Start == "" {
+		return
+	}
+	report := loadMaintenanceReport()
+	mutex.Lock()
+	lastMaintenance = report
+	mutex.Unlock()
+	go maintenanceLoop(config.Maintenance)
+}
+
+// loadMaintenanceReport reads the last run, if any
+func loadMaintenanceReport() *maintenanceReport {
+	data, err := os.ReadFile(maintenancePath)
+	if err != nil {
+		return nil
+	}
+	var report maintenanceReport
+	_, err = schema.Maintenance.Decode(data, &report)
+	var newer *schema.NewerError
+	if errors.As(err, &newer) {
+		noteNewerState(maintenancePath, newer)
+	} else if err != nil {
+		log.Printf("Maintenance: ignoring %s: %v", maintenancePath, err)
+		return nil
+	}
+	return &report
+}
+
+// saveMaintenanceReport keeps the last run for the next start
+func saveMaintenanceReport(report *maintenanceReport) error {
+	if !stateWritable() {
+		return errors.New("state directory degraded, report kept in memory")
+	}
+	report.Version = schema.Maintenance.Version
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(maintenancePath), 0755); err != nil {
+		return err
+	}
+	tmp := maintenancePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, maintenancePath)
+}
+
+// windowStart returns when the window that now falls in opened, if it does
+func windowStart(cfg MaintenanceConfig, now time.Time) (time.Time, bool) {
+	at, err := time.Parse("15:04", cfg.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if start.After(now) {
+		// A window that runs past midnight opened yesterday
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, now.Sub(start) < time.Duration(cfg.WindowMinutes)*time.Minute
+}
+
+// maintenanceLoop runs maintenance once in each window, as soon as the unit
+// is idle. A run that is aborted is tried again later in the window.
+func maintenanceLoop(cfg MaintenanceConfig) {
+	for range time.Tick(maintenanceCheck) {
+		start, open := windowStart(cfg, time.Now())
+		if !open {
+			continue
+		}
+		mutex.Lock()
+		last := lastMaintenance
+		ready := maintenanceReason(time.Time{}) == ""
+		mutex.Unlock()
+		if !ready || (last != nil && last.Aborted == "" && !last.Started.Before(start)) {
+			continue
+		}
+		runMaintenance(cfg, last)
+	}
+}
+
+// maintenanceReason returns why maintenance must not run, or "" if it may.
+// Input since started counts, or any input within maintenanceQuiet when
+// started is zero. Must be called with mutex held.
+func maintenanceReason(started time.Time) string {
+	switch {
+	case isRecording:
+		return "recording started"
+	case currentState != StateIdle:
+		return "controls in use"
+	case started.IsZero() && time.Since(lastInput) < maintenanceQuiet:
+		return "controls in use"
+	case !started.IsZero() && lastInput.After(started):
+		return "controls in use"
+	case backgroundStatusText() != "" && started.IsZero():
+		return "background job running"
+	}
+	if e, ok := nextScheduledEvent(); ok && time.Until(e.Start) < maintenanceScheduleGuard {
+		return "scheduled take due"
+	}
+	return ""
+}
+
+// runMaintenance runs each enabled task, stopping as soon as the unit is
+// needed, and logs and keeps the report
+func runMaintenance(cfg MaintenanceConfig, last *maintenanceReport) {
+	report := &maintenanceReport{Started: time.Now()}
+	if last != nil {
+		report.VerifiedUntil = last.VerifiedUntil
+	}
+	log.Printf("Maintenance: starting")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(maintenanceWatch)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			mutex.Lock()
+			reason := maintenanceReason(report.Started)
+			if reason != "" && report.Aborted == "" {
+				report.Aborted = reason
+			}
+			mutex.Unlock()
+			if reason != "" {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if cfg.HealthCheck && ctx.Err() == nil {
+		problems := checkStorageHealth()
+		report.Problems = append(report.Problems, problems...)
+		log.Printf("Maintenance: storage health check found %d problems", len(problems))
+	}
+	if cfg.Verify && ctx.Err() == nil {
+		verified, until, problems := verifyNewRecordings(ctx, report.VerifiedUntil)
+		report.Verified = verified
+		report.Problems = append(report.Problems, problems...)
+		if ctx.Err() == nil {
+			report.VerifiedUntil = until
+		}
+		log.Printf("Maintenance: verified %d recordings, %d problems", verified, len(problems))
+	}
+	cancel()
+
+	mutex.Lock()
+	report.Finished = time.Now()
+	if report.Aborted == "" && ctx.Err() != nil {
+		report.Aborted = "stopped"
+	}
+	lastMaintenance = report
+	mutex.Unlock()
+
+	for _, problem := range report.Problems {
+		log.Printf("Maintenance: %s", problem)
+	}
+	if report.Aborted != "" {
+		log.Printf("Maintenance: aborted after %v: %s", report.Finished.Sub(report.Started).Round(time.Second), report.Aborted)
+	} else {
+		log.Printf("Maintenance: finished in %v, %d problems", report.Finished.Sub(report.Started).Round(time.Second), len(report.Problems))
+	}
+	if err := saveMaintenanceReport(report); err != nil {
+		noteWriteError(maintenancePath, "maintenance", err)
+		log.Printf("Maintenance: failed to save report: %v", err)
+	}
+}
+
+// checkStorageHealth checks that each record target can take a recording
+// and that no card is near the end of its rated endurance
+func checkStorageHealth() []string {
+	var problems []string
+	for _, target := range recordTargets {
+		if err := target.CheckHealth(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", target.Name, err))
+		}
+	}
+	for _, name := range wearStorageNames() {
+		if left := wearOf(name).enduranceLeft(); left >= 0 && left <= enduranceWarnPercent {
+			problems = append(problems, fmt.Sprintf("%s: %d%% of rated endurance left", name, left))
+		}
+	}
+	return problems
+}
+
+// verifyNewRecordings reads through every recording changed after since,
+// checking its header and that its samples read back. It returns how many
+// were verified, the newest one's time and what was wrong.
+func verifyNewRecordings(ctx context.Context, since time.Time) (int, time.Time, []string) {
+	lease, err := resources.TryAcquire(jobVerify, targetPaths()...)
+	if err != nil {
+		return 0, since, []string{"verify skipped: " + err.Error()}
+	}
+	defer lease.Release()
+
+	var files []string
+	var total int64
+	until := since
+	for _, file := range allRecordings(recordTargets) {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().After(since) {
+			continue
+		}
+		files = append(files, file)
+		total += info.Size()
+		if info.ModTime().After(until) {
+			until = info.ModTime()
+		}
+	}
+
+	progress := startBackgroundJob(jobVerify, total)
+	defer progress.Finish()
+	verified := 0
+	var problems []string
+	for _, file := range files {
+		if ctx.Err() != nil || lease.Preempted() {
+			break
+		}
+		if err := verifyRecording(ctx, file, progress); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			problems = append(problems, fmt.Sprintf("%s: %v", filepath.Base(file), err))
+		}
+		verified++
+	}
+	return verified, until, problems
+}
+
+// verifyRecording checks a recording's header describes the file, reads
+// every byte of its samples and compares them with the checksum recorded
+// with the take, if there is one
+func verifyRecording(ctx context.Context, path string, progress *backgroundJob) error {
+	want, ok := storedDataSum(path)
+	if !ok {
+		want.newHash = newXXH64
+	}
+	got, err := hashWAVData(ctx, path, want.newHash, progress)
+	if err != nil {
+		return err
+	}
+	if ok && got != want.value {
+		return fmt.Errorf("samples do not match the checksum recorded with the take")
+	}
+	return nil
+}
+
+// maintenanceText summarises the last run for the storage health screen
+func maintenanceText() string {
+	report := lastMaintenance
+	if report == nil {
+		return i18n.T("maintenance.never")
+	}
+	when := report.Started.Format("Jan 2 15:04")
+	switch {
+	case report.Aborted != "":
+		return i18n.Tf("maintenance.aborted", when)
+	case len(report.Problems) > 0:
+		return i18n.Tf("maintenance.problems", when, len(report.Problems))
+	}
+	return i18n.Tf("maintenance.ok", when)
+}
+
+// maintenanceDetails shows the problems found by the last run
+func maintenanceDetails() {
+	report := lastMaintenance
+	if report == nil || len(report.Problems) == 0 {
+		return
+	}
+	showAlert(strings.Join(report.Problems, "; "), 5*time.Second)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// Marker is a point dropped in a take while it was recording
+type Marker struct {
+	ID    int    `json:"id"`    // 1-based, numbered across the take
+	File  string `json:"file"`  // Name of the file of the take it falls in
+	Frame int64  `json:"frame"` // Sample frame within that file
+	Label string `json:"label,omitempty"`
+}
+
+// errCuesNotLast is returned when a file has chunks after its cue points,
+// which cannot be rewritten without moving them
+var errCuesNotLast = errors.New("cue points are not at the end of the file")
+
+var (
+	markerOption = false // "Markers" is selected on the details screen
+	noteMarker   = 0     // ID of the marker the editor is naming, 0 for none
+)
+
+// AddMarker drops a marker at the last frame written
+func (r *Recorder) AddMarker() Marker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.addMarker("")
+}
+
+// addMarker drops a marker with label at the current position. Must be
+// called with r.mutex held.
+func (r *Recorder) addMarker(label string) Marker {
+	m := Marker{
+		ID:    len(r.markers) + 1,
+		File:  filepath.Base(r.writer.path),
+		Frame: r.framesWritten - r.fileStartFrame,
+		Label: label,
+	}
+	r.markers = append(r.markers, m)
+	return m
+}
+
+// Markers returns the markers dropped so far, in order
+func (r *Recorder) Markers() []Marker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Marker(nil), r.markers...)
+}
+
+// markersIn returns the markers that fall in the file named name
+func markersIn(markers []Marker, name string) []Marker {
+	var in []Marker
+	for _, m := range markers {
+		if m.File == name {
+			in = append(in, m)
+		}
+	}
+	return in
+}
+
+// fileMarkers returns the markers of a recording file from its take sidecar,
+// with the take's sample rate
+func fileMarkers(file string) ([]Marker, int) {
+	take, err := readTakeInfo(file)
+	if err != nil {
+		return nil, 0
+	}
+	return markersIn(take.Markers, filepath.Base(file)), take.SampleRate
+}
+
+// detailsMarkers returns the markers of the file on the details screen from
+// the sidecar read when it opened, with the take's sample rate
+func detailsMarkers() ([]Marker, int) {
+	if detailsTake == nil {
+		return nil, 0
+	}
+	return markersIn(detailsTake.Markers, filepath.Base(detailsFile)), detailsTake.SampleRate
+}
+
+// markerTime formats a position within a file as hours, minutes, seconds
+// and milliseconds
+func markerTime(frame int64, sampleRate int) string {
+	if sampleRate <= 0 {
+		return "--:--:--.---"
+	}
+	ms := frame * 1000 / int64(sampleRate)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// markerLabel is how a marker is listed
+func markerLabel(m Marker) string {
+	if m.Label == "" {
+		return i18n.Tf("markers.unnamed", m.ID)
+	}
+	return fmt.Sprintf("%d %s", m.ID, m.Label)
+}
+
+// cueChunks builds the cue chunk for markers and, when any are named, the
+// associated data list holding their labels. pad starts the chunks with a
+// byte so they begin on a word boundary.
+func cueChunks(markers []Marker, pad bool) []byte {
+	if len(markers) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if pad {
+		buf.WriteByte(0)
+	}
+
+	cue := make([]byte, 12+24*len(markers))
+	copy(cue[0:4], "cue ")
+	binary.LittleEndian.PutUint32(cue[4:8], uint32(4+24*len(markers)))
+	binary.LittleEndian.PutUint32(cue[8:12], uint32(len(markers)))
+	for i, m := range markers {
+		point := cue[12+24*i:]
+		binary.LittleEndian.PutUint32(point[0:4], uint32(m.ID))
+		binary.LittleEndian.PutUint32(point[4:8], uint32(m.Frame))
+		copy(point[8:12], "data")
+		binary.LittleEndian.PutUint32(point[20:24], uint32(m.Frame))
+	}
+	buf.Write(cue)
+
+	adtl := []byte("adtl")
+	for _, m := range markers {
+		if m.Label == "" {
+			continue
+		}
+		text := append([]byte(m.Label), 0)
+		labl := make([]byte, 12, 12+len(text)+1)
+		copy(labl[0:4], "labl")
+		binary.LittleEndian.PutUint32(labl[4:8], uint32(4+len(text)))
+		binary.LittleEndian.PutUint32(labl[8:12], uint32(m.ID))
+		labl = append(labl, text...)
+		if len(labl)%2 == 1 {
+			labl = append(labl, 0)
+		}
+		adtl = append(adtl, labl...)
+	}
+	if len(adtl) > 4 {
+		list := make([]byte, 8)
+		copy(list[0:4], "LIST")
+		binary.LittleEndian.PutUint32(list[4:8], uint32(len(adtl)))
+		buf.Write(list)
+		buf.Write(adtl)
+	}
+	return buf.Bytes()
+}
+
+// rewriteCues replaces the cue points of a recording without touching its
+// samples. The new chunks go where the old ones started, or at the end of a
+// file that has none, so this fails if other chunks follow the cue points.
+func rewriteCues(path string, markers []Marker) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return fmt.Errorf("%s is not a WAV file", path)
+	}
+
+	// Find where the existing cue and label chunks start
+	start := int64(-1)
+	pos := int64(12)
+	chunk := make([]byte, 12)
+	for pos+8 <= stat.Size() {
+		n, err := f.ReadAt(chunk, pos)
+		if n < 8 {
+			return err
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		ours := id == "cue " || (id == "LIST" && n == 12 && string(chunk[8:12]) == "adtl")
+		switch {
+		case ours && start < 0:
+			start = pos
+		case !ours && start >= 0:
+			return errCuesNotLast
+		}
+		pos += 8 + size + size%2
+	}
+	if pos > stat.Size() {
+		return fmt.Errorf("%s is cut short", path)
+	}
+	if start < 0 {
+		start = pos
+	}
+
+	chunks := cueChunks(markers, false)
+	if err := f.Truncate(start); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(chunks, start); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(header[4:8], uint32(start+int64(len(chunks))-8))
+	if _, err := f.WriteAt(header[4:8], 4); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// audacityLabels writes markers as an Audacity label track: start and end
+// in seconds and the label, separated by tabs. Tabs and line breaks in a
+// label become spaces, as they would end the field.
+func audacityLabels(markers []Marker, sampleRate int) []byte {
+	var buf bytes.Buffer
+	for _, m := range markers {
+		seconds := float64(m.Frame) / float64(sampleRate)
+		fmt.Fprintf(&buf, "%.6f\t%.6f\t%s\n", seconds, seconds, labelBreaks.Replace(m.Label))
+	}
+	return buf.Bytes()
+}
+
+// labelBreaks replaces the characters that end an Audacity label
+var labelBreaks = strings.NewReplacer("\t", " ", "\r\n", " ", "\r", " ", "\n", " ")
+
+// reaperMarkers writes markers as a Reaper region and marker list, as
+// imported from the Region/Marker Manager
+func reaperMarkers(markers []Marker, sampleRate int) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"#", "Name", "Start", "End", "Length"})
+	for _, m := range markers {
+		w.Write([]string{fmt.Sprintf("M%d", m.ID), m.Label, markerTime(m.Frame, sampleRate), "", ""})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// exportMarkers writes the markers of a recording file as an Audacity label
+// file and a Reaper marker list named after stem, at the paths dst gives
+// for their names. Files without markers get neither.
+func exportMarkers(file, stem string, dst func(name string) string) error {
+	markers, sampleRate := fileMarkers(file)
+	if len(markers) == 0 || sampleRate <= 0 {
+		return nil
+	}
+	if err := os.WriteFile(dst(stem+"_markers.txt"), audacityLabels(markers, sampleRate), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(dst(stem+"_markers.csv"), reaperMarkers(markers, sampleRate), 0644)
+}
+
+// renameMarker changes the label of marker id of the take file belongs to,
+// in the sidecar and in the cue points of the file holding it
+func renameMarker(file string, id int, label string) error {
+	take, err := readTakeInfo(file)
+	if err != nil {
+		return err
+	}
+	var marker *Marker
+	for i := range take.Markers {
+		if take.Markers[i].ID == id {
+			marker = &take.Markers[i]
+		}
+	}
+	if marker == nil {
+		return fmt.Errorf("take %s has no marker %d", take.Name, id)
+	}
+	marker.Label = label
+	if err := writeTakeInfo(take); err != nil {
+		return err
+	}
+
+	// The sidecar is what matters; the cue points follow when they can
+	path := filepath.Join(filepath.Dir(file), marker.File)
+	if err := rewriteCues(path, markersIn(take.Markers, marker.File)); err != nil {
+		log.Printf("Markers: cue points in %s left as they were: %v", path, err)
+	}
+	return nil
+}
+
+// cycleDetailsOption moves the bottom line of the details screen between
+// leaving, adding a note and, when the file has any, its markers
+func cycleDetailsOption() {
+	switch {
+	case !noteOption && !markerOption:
+		noteOption = true
+	case noteOption:
+		noteOption = false
+		markers, _ := detailsMarkers()
+		markerOption = len(markers) > 0
+	default:
+		markerOption = false
+	}
+}
+
+// detailsOptionText shows the bottom line of the details screen
+func detailsOptionText(leave string) string {
+	if markerOption {
+		markers, _ := detailsMarkers()
+		return "‹" + i18n.Tf("markers.open", len(markers)) + "›"
+	}
+	return noteOptionText(leave)
+}
+
+// markerMenuItems lists the markers of the file on the details screen,
+// each opening the editor to name it
+func markerMenuItems() []menuItem {
+	markers, sampleRate := detailsMarkers()
+	var items []menuItem
+	for _, m := range markers {
+		m := m
+		items = append(items, menuItem{
+			Label:  markerLabel(m),
+			Value:  func() string { return markerTime(m.Frame, sampleRate) },
+			Action: func() { openMarkerEditor(m) },
+		})
+	}
+	items = append(items, menuItem{Label: i18n.T("common.back"), Action: func() { currentState = StateFileDetails }})
+	return items
+}
+
+// openMarkerEditor names a marker with the note editor. Must be called with
+// mutex held.
+func openMarkerEditor(m Marker) {
+	openNoteEditor(detailsFile)
+	noteMarker = m.ID
+	setNoteText(m.Label)
+}
+
+// finishMarkerLabel saves the name entered for a marker. An empty name
+// clears it.
+func finishMarkerLabel(text string) {
+	if err := renameMarker(noteTake, noteMarker, text); err != nil {
+		setLastError("Failed to rename marker %d: %v", noteMarker, err)
+		showAlert(i18n.T("markers.failed"), 5*time.Second)
+		return
+	}
+	log.Printf("Named marker %d of %s: %q", noteMarker, takeName(noteTake), text)
+	loadFileDetails()
+	showAlert(i18n.T("markers.saved"), 3*time.Second)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// exportTestMarkers cover the start of the file, a fraction of a second,
+// hours in, and labels that need escaping in each format
+var exportTestMarkers = []Marker{
+	{ID: 1, Frame: 0},
+	{ID: 2, Frame: 72000, Label: "Applause"},
+	{ID: 3, Frame: 48000*3723 + 12000, Label: `Q&A, part "two"`},
+	{ID: 4, Frame: 96000, Label: "Encore\tstarts\nhere"},
+}
+
+func TestAudacityLabels(t *testing.T) {
+	want := "0.000000\t0.000000\t\n" +
+		"1.500000\t1.500000\tApplause\n" +
+		"3723.250000\t3723.250000\tQ&A, part \"two\"\n" +
+		"2.000000\t2.000000\tEncore starts here\n"
+	if got := string(audacityLabels(exportTestMarkers, 48000)); got != want {
+		t.Errorf("labels:\n%q\nwant:\n%q", got, want)
+	}
+
+	// A rate that does not divide evenly keeps sample accuracy
+	if got := string(audacityLabels([]Marker{{ID: 1, Frame: 44101}}, 44100)); got != "1.000023\t1.000023\t\n" {
+		t.Errorf("label at 44101/44100 is %q", got)
+	}
+}
+
+func TestReaperMarkers(t *testing.T) {
+	want := "#,Name,Start,End,Length\n" +
+		"M1,,0:00:00.000,,\n" +
+		"M2,Applause,0:00:01.500,,\n" +
+		"M3,\"Q&A, part \"\"two\"\"\",1:02:03.250,,\n" +
+		"M4,\"Encore\tstarts\nhere\",0:00:02.000,,\n"
+	data := reaperMarkers(exportTestMarkers, 48000)
+	if string(data) != want {
+		t.Errorf("marker list:\n%q\nwant:\n%q", data, want)
+	}
+
+	// Every label reads back whole
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(exportTestMarkers)+1 {
+		t.Fatalf("%d records, want a header and %d markers", len(records), len(exportTestMarkers))
+	}
+	for i, m := range exportTestMarkers {
+		if records[i+1][1] != m.Label {
+			t.Errorf("marker %d reads back as %q, want %q", m.ID, records[i+1][1], m.Label)
+		}
+	}
+}
+
+func TestExportMarkersOfOneFile(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	first, second := filepath.Join(dir, "take.wav"), filepath.Join(dir, "take_part2.wav")
+	err := writeTakeInfo(&TakeInfo{
+		Name:       "take",
+		Files:      []string{first, second},
+		SampleRate: 48000,
+		Markers: []Marker{
+			{ID: 1, File: "take.wav", Frame: 48000, Label: "Intro"},
+			{ID: 2, File: "take_part2.wav", Frame: 24000, Label: "Finale"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := func(name string) string { return filepath.Join(out, name) }
+
+	// Only the markers in the file are exported, at their place in it
+	if err := exportMarkers(second, "take_part2", dst); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := os.ReadFile(dst("take_part2_markers.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(labels) != "0.500000\t0.500000\tFinale\n" {
+		t.Errorf("labels of the second part: %q", labels)
+	}
+	if _, err := os.Stat(dst("take_part2_markers.csv")); err != nil {
+		t.Errorf("no marker list: %v", err)
+	}
+
+	// A file without markers or without a sidecar gets no files
+	if err := writeTakeInfo(&TakeInfo{Name: "quiet", Files: []string{filepath.Join(dir, "quiet.wav")}, SampleRate: 48000}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"quiet", "lost"} {
+		if err := exportMarkers(filepath.Join(dir, file+".wav"), file, dst); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+	entries, _ := os.ReadDir(out)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"take_part2_markers.csv", "take_part2_markers.txt"}; !slices.Equal(names, want) {
+		t.Errorf("exported %v, want %v", names, want)
+	}
+}
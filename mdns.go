@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsGroup   = "224.0.0.251:5353"
+	mdnsService = "_pi9696._tcp.local."
+	mdnsBrowse  = "_services._dns-sd._udp.local."
+	mdnsTTL     = 120 // Seconds
+)
+
+// mdnsAdvert is what the unit announces about itself over multicast DNS:
+// the HTTP server as a DNS-SD service, with the unit's MAC address and name
+// in its TXT record
+type mdnsAdvert struct {
+	instance string // Service instance name
+	host     string // Host name without .local
+	ip       net.IP
+	port     uint16
+	txt      []string
+}
+
+// currentAdvert describes the unit as it is now, so a new DHCP address or
+// unit name is announced without a restart
+func currentAdvert(port uint16) (*mdnsAdvert, error) {
+	info, err := hwManager.GetNetworkInfo()
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(info.IPAddress).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("%s has no IPv4 address", info.InterfaceName)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	instance := unitName()
+	if instance == "" {
+		instance = host
+	}
+	return &mdnsAdvert{
+		// Dots would split the name into labels
+		instance: strings.ReplaceAll(instance, ".", "-"),
+		host:     host,
+		ip:       ip,
+		port:     port,
+		txt:      []string{"mac=" + info.MACAddress, "unit=" + unitName(), "path=/screen.png"},
+	}, nil
+}
+
+// startMDNS advertises the HTTP server on the local network when it is on
+func startMDNS() {
+	if config.HTTP.Listen == "" {
+		return
+	}
+	_, portText, err := net.SplitHostPort(config.HTTP.Listen)
+	if err != nil {
+		setLastError("mDNS: bad listen address %q: %v", config.HTTP.Listen, err)
+		return
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		setLastError("mDNS: bad port in %q: %v", config.HTTP.Listen, err)
+		return
+	}
+	info, err := hwManager.GetNetworkInfo()
+	if err != nil {
+		setLastError("mDNS: %v", err)
+		return
+	}
+	iface, err := net.InterfaceByName(info.InterfaceName)
+	if err != nil {
+		setLastError("mDNS: %v", err)
+		return
+	}
+	group, err := net.ResolveUDPAddr("udp4", mdnsGroup)
+	if err != nil {
+		setLastError("mDNS: %v", err)
+		return
+	}
+	conn, err := net.ListenMulticastUDP("udp4", iface, group)
+	if err != nil {
+		setLastError("mDNS: cannot listen on %s: %v", iface.Name, err)
+		return
+	}
+	log.Printf("mDNS: advertising %s on %s", mdnsService, iface.Name)
+	go serveMDNS(conn, group, uint16(port))
+}
+
+// serveMDNS answers the questions asked about the unit. Answers go to the
+// group, or straight back to a querier that is not an mDNS responder.
+func serveMDNS(conn *net.UDPConn, group *net.UDPAddr, port uint16) {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			setLastError("mDNS: stopped: %v", err)
+			return
+		}
+		ad, err := currentAdvert(port)
+		if err != nil {
+			continue
+		}
+		reply, err := ad.answer(buf[:n])
+		if err != nil || reply == nil {
+			continue
+		}
+		to := group
+		if from.Port != group.Port {
+			to = from
+		}
+		if _, err := conn.WriteToUDP(reply, to); err != nil {
+			log.Printf("mDNS: reply to %s failed: %v", from, err)
+		}
+	}
+}
+
+func (a *mdnsAdvert) instanceName() string { return a.instance + "." + mdnsService }
+func (a *mdnsAdvert) hostName() string     { return a.host + ".local." }
+
+// answer returns the response to an mDNS query, or nil when nothing asked
+// is about the unit
+func (a *mdnsAdvert) answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil, err
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+
+	var answers, extra []string
+	add := func(list *[]string, records ...string) {
+		for _, r := range records {
+			if !slices.Contains(*list, r) {
+				*list = append(*list, r)
+			}
+		}
+	}
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		all := q.Type == dnsmessage.TypeALL
+		switch {
+		case name == mdnsBrowse && (all || q.Type == dnsmessage.TypePTR):
+			add(&answers, "browse")
+		case name == mdnsService && (all || q.Type == dnsmessage.TypePTR):
+			add(&answers, "ptr")
+			add(&extra, "srv", "txt", "a")
+		case name == strings.ToLower(a.instanceName()):
+			if all || q.Type == dnsmessage.TypeSRV {
+				add(&answers, "srv")
+				add(&extra, "a")
+			}
+			if all || q.Type == dnsmessage.TypeTXT {
+				add(&answers, "txt")
+			}
+		case name == strings.ToLower(a.hostName()) && (all || q.Type == dnsmessage.TypeA):
+			add(&answers, "a")
+		}
+	}
+	if len(answers) == 0 {
+		return nil, nil
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, r := range answers {
+		if err := a.addRecord(&b, r); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	for _, r := range extra {
+		if !slices.Contains(answers, r) {
+			if err := a.addRecord(&b, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+// addRecord adds one of the unit's records to a response. The records only
+// the unit can answer for have the cache-flush bit set.
+func (a *mdnsAdvert) addRecord(b *dnsmessage.Builder, record string) error {
+	header := func(name string, unique bool) (dnsmessage.ResourceHeader, error) {
+		n, err := dnsmessage.NewName(name)
+		class := dnsmessage.ClassINET
+		if unique {
+			class |= 0x8000
+		}
+		return dnsmessage.ResourceHeader{Name: n, Class: class, TTL: mdnsTTL}, err
+	}
+
+	switch record {
+	case "browse":
+		h, err := header(mdnsBrowse, false)
+		if err != nil {
+			return err
+		}
+		service, err := dnsmessage.NewName(mdnsService)
+		if err != nil {
+			return err
+		}
+		return b.PTRResource(h, dnsmessage.PTRResource{PTR: service})
+	case "ptr":
+		h, err := header(mdnsService, false)
+		if err != nil {
+			return err
+		}
+		instance, err := dnsmessage.NewName(a.instanceName())
+		if err != nil {
+			return err
+		}
+		return b.PTRResource(h, dnsmessage.PTRResource{PTR: instance})
+	case "srv":
+		h, err := header(a.instanceName(), true)
+		if err != nil {
+			return err
+		}
+		host, err := dnsmessage.NewName(a.hostName())
+		if err != nil {
+			return err
+		}
+		return b.SRVResource(h, dnsmessage.SRVResource{Target: host, Port: a.port})
+	case "txt":
+		h, err := header(a.instanceName(), true)
+		if err != nil {
+			return err
+		}
+		return b.TXTResource(h, dnsmessage.TXTResource{TXT: a.txt})
+	default:
+		h, err := header(a.hostName(), true)
+		if err != nil {
+			return err
+		}
+		var ip [4]byte
+		copy(ip[:], a.ip)
+		return b.AResource(h, dnsmessage.AResource{A: ip})
+	}
+}
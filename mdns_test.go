@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var testAdvert = &mdnsAdvert{
+	instance: "Stage-Left",
+	host:     "pi9696",
+	ip:       net.IPv4(192, 168, 1, 20).To4(),
+	port:     8080,
+	txt:      []string{"mac=dc:a6:32:01:02:03", "unit=Stage.Left", "path=/screen.png"},
+}
+
+// mdnsQuery builds a query for name of type typ
+func mdnsQuery(t *testing.T, name string, typ dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{Questions: []dnsmessage.Question{
+		{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET},
+	}}
+	query, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestMDNSBrowseFindsMAC(t *testing.T) {
+	reply, err := testAdvert.answer(mdnsQuery(t, mdnsService, dnsmessage.TypePTR))
+	if err != nil || reply == nil {
+		t.Fatalf("no answer to a browse: %v", err)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Header.Response || len(msg.Answers) != 1 {
+		t.Fatalf("%d answers, want the service pointer", len(msg.Answers))
+	}
+	if ptr, ok := msg.Answers[0].Body.(*dnsmessage.PTRResource); !ok || ptr.PTR.String() != "Stage-Left."+mdnsService {
+		t.Errorf("answer %v, want a pointer to the unit", msg.Answers[0].Body)
+	}
+
+	var txt *dnsmessage.TXTResource
+	var srv *dnsmessage.SRVResource
+	var a *dnsmessage.AResource
+	for _, r := range msg.Additionals {
+		switch body := r.Body.(type) {
+		case *dnsmessage.TXTResource:
+			txt = body
+		case *dnsmessage.SRVResource:
+			srv = body
+		case *dnsmessage.AResource:
+			a = body
+		}
+	}
+	if txt == nil || !slices.Contains(txt.TXT, "mac=dc:a6:32:01:02:03") {
+		t.Errorf("TXT record %v does not carry the MAC address", txt)
+	}
+	if srv == nil || srv.Port != 8080 || srv.Target.String() != "pi9696.local." {
+		t.Errorf("SRV record %v, want pi9696.local. port 8080", srv)
+	}
+	if a == nil || net.IP(a.A[:]).String() != "192.168.1.20" {
+		t.Errorf("A record %v, want 192.168.1.20", a)
+	}
+}
+
+func TestMDNSIgnoresOtherNames(t *testing.T) {
+	for _, q := range []struct {
+		name string
+		typ  dnsmessage.Type
+	}{
+		{"_http._tcp.local.", dnsmessage.TypePTR},
+		{"other.local.", dnsmessage.TypeA},
+		{"pi9696.local.", dnsmessage.TypeAAAA},
+	} {
+		reply, err := testAdvert.answer(mdnsQuery(t, q.name, q.typ))
+		if err != nil || reply != nil {
+			t.Errorf("%s %v: answered (%v)", q.name, q.typ, err)
+		}
+	}
+}
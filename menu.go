@@ -0,0 +1,347 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+// doubleClickWindow is how long a click on the settings root waits for a
+// second click that opens quick jump
+const doubleClickWindow = 300 * time.Millisecond
+
+// menuItem is an entry in one of the list-style menu screens
+type menuItem struct {
+	// ID identifies items listed in quick jump; leave empty to keep an item out
+	ID    string
+	Label string
+	// Value returns the right-aligned value text, if any
+	Value func() string
+	// Adjust makes the value editable: click toggles editing and rotation
+	// calls Adjust while editing
+	Adjust func(direction int)
+	// Action runs when the item is clicked
+	Action func()
+	// Disabled items are drawn dimmed; clicking one shows Reason instead of
+	// running the item
+	Disabled bool
+	Reason   string
+	// DoubleClick, if set, runs on a double click; single clicks then wait
+	// out the double-click window
+	DoubleClick func()
+	// Header rows head a group of the items below them, which are
+	// indented by Indent levels
+	Header bool
+	Indent int
+}
+
+// menuScreen is a registered list-style menu screen
+type menuScreen struct {
+	title func() string
+	items func() []menuItem
+}
+
+var (
+	// editingValue is true while the selected item's value is being adjusted
+	editingValue = false
+
+	menuScreens = make(map[AppState]menuScreen)
+
+	// Quick jump returns here when backed out of
+	quickJumpFrom     AppState
+	quickJumpSelected int
+	// quickJumpList is built when quick jump opens rather than on every frame
+	quickJumpList []quickJumpEntry
+	pendingClick  *time.Timer
+)
+
+// registerMenu makes a state a list-style menu screen. Items with an ID are
+// listed in quick jump.
+func registerMenu(state AppState, title func() string, items func() []menuItem) {
+	menuScreens[state] = menuScreen{title: title, items: items}
+}
+
+// isMenuState reports whether a state is a registered menu screen
+func isMenuState(state AppState) bool {
+	_, ok := menuScreens[state]
+	return ok
+}
+
+// currentMenuItems returns the items of the active list-style menu screen
+func currentMenuItems() []menuItem {
+	if screen, ok := menuScreens[currentState]; ok {
+		return screen.items()
+	}
+	return nil
+}
+
+// disableFor disables the item with the first non-empty reason, if any
+func (item menuItem) disableFor(reasons ...string) menuItem {
+	for _, reason := range reasons {
+		if reason != "" {
+			item.Disabled, item.Reason = true, reason
+			break
+		}
+	}
+	return item
+}
+
+// reasonIf returns the translated reason key when cond holds, or ""
+func reasonIf(cond bool, key string) string {
+	if cond {
+		return i18n.T(key)
+	}
+	return ""
+}
+
+// openMenu switches to a menu screen with the first item selected
+func openMenu(state AppState) {
+	currentState = state
+	selectedMenu = 0
+	menuScrollOffset = 0
+	editingValue = false
+}
+
+// menuRotate moves the selection, or adjusts the selected value while editing
+func menuRotate(direction int) {
+	items := currentMenuItems()
+	if len(items) == 0 {
+		return
+	}
+
+	if editingValue && selectedMenu < len(items) && items[selectedMenu].Adjust != nil {
+		items[selectedMenu].Adjust(direction)
+		return
+	}
+
+	selectedMenu += direction
+	if selectedMenu < 0 {
+		selectedMenu = len(items) - 1
+	} else if selectedMenu >= len(items) {
+		selectedMenu = 0
+	}
+}
+
+// menuClickOrDoubleClick handles a click where a double click runs onDouble,
+// such as the settings root where it opens quick jump. The single click is
+// held back until the double-click window has passed.
+func menuClickOrDoubleClick(onDouble func()) {
+	if pendingClick != nil && pendingClick.Stop() {
+		pendingClick = nil
+		onDouble()
+		return
+	}
+
+	state := currentState
+	pendingClick = time.AfterFunc(doubleClickWindow, func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		pendingClick = nil
+		if currentState == state {
+			menuClick()
+		}
+	})
+}
+
+// menuItemClick clicks the selected item, waiting to see if a click on an
+// item with a double-click action is the first of two
+func menuItemClick() {
+	items := currentMenuItems()
+	if selectedMenu < len(items) && items[selectedMenu].DoubleClick != nil && !items[selectedMenu].Disabled {
+		menuClickOrDoubleClick(items[selectedMenu].DoubleClick)
+		return
+	}
+	menuClick()
+}
+
+// menuClick toggles editing of adjustable items or runs the item's action
+func menuClick() {
+	items := currentMenuItems()
+	if selectedMenu >= len(items) {
+		return
+	}
+
+	item := items[selectedMenu]
+	if item.Disabled {
+		showAlert(item.Reason, 3*time.Second)
+		return
+	}
+	if item.Adjust != nil {
+		editingValue = !editingValue
+		return
+	}
+	if item.Action != nil {
+		item.Action()
+	}
+}
+
+// renderMenu draws a titled, scrolling list of menu items
+func renderMenu(title string, allItems []menuItem) {
+	hwManager.DrawCenteredText(title, "header", 20)
+
+	// Calculate scrolling parameters
+	maxVisibleItems := 3 // Max items that fit after header (64px height - 20px header - margins)
+	totalItems := len(allItems)
+
+	// Update scroll offset based on selected item
+	if selectedMenu < menuScrollOffset {
+		menuScrollOffset = selectedMenu
+	} else if selectedMenu >= menuScrollOffset+maxVisibleItems {
+		menuScrollOffset = selectedMenu - maxVisibleItems + 1
+	}
+
+	// Ensure scroll offset doesn't go past the end
+	if menuScrollOffset > totalItems-maxVisibleItems {
+		menuScrollOffset = totalItems - maxVisibleItems
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
+
+	// Create visible items slice
+	endIdx := menuScrollOffset + maxVisibleItems
+	if endIdx > totalItems {
+		endIdx = totalItems
+	}
+
+	// Draw visible items
+	y := 32
+	fontHeight := hwManager.GetFontHeight()
+
+	for i := menuScrollOffset; i < endIdx; i++ {
+		item := hardware.MenuItem{Label: allItems[i].Label}
+		if allItems[i].Value != nil {
+			item.Value = allItems[i].Value()
+		}
+		selected := i == selectedMenu
+
+		// Switch to emphasis font for selected items and group headers
+		context := "menu"
+		if selected {
+			context = "selected"
+		} else if allItems[i].Header {
+			context = "emphasis"
+		}
+		if err := hwManager.SwitchToContext(context); err != nil {
+			return
+		}
+
+		prefix := "  "
+		if selected {
+			prefix = "> "
+		}
+		prefix += strings.Repeat("  ", allItems[i].Indent)
+
+		// Unavailable items are dimmed
+		drawText := hwManager.DrawText
+		if allItems[i].Disabled {
+			drawText = hwManager.DrawDimText
+		}
+
+		// Draw right-aligned value if present, bracketed while being edited
+		labelWidth := DisplayWidth - 16
+		if item.Value != "" {
+			value := item.Value
+			if selected && editingValue {
+				value = "‹" + value + "›"
+			}
+			valueWidth := hwManager.GetTextWidth(value)
+			drawText(DisplayWidth-valueWidth-16, y, value)
+			labelWidth = DisplayWidth - valueWidth - 16 - 4 - 8
+		}
+
+		// Draw label, shortened to fit beside the value
+		drawText(8, y, hwManager.FitText(prefix+item.Label, labelWidth))
+
+		y += fontHeight + 2
+	}
+
+	// Draw scroll indicators if needed
+	if totalItems > maxVisibleItems {
+		hwManager.SwitchToContext("details")
+		// Up arrow if we can scroll up
+		if menuScrollOffset > 0 {
+			hwManager.DrawText(240, 32, "↑")
+		}
+		// Down arrow if we can scroll down
+		if menuScrollOffset+maxVisibleItems < totalItems {
+			hwManager.DrawText(240, 52, "↓")
+		}
+	}
+}
+
+// quickJumpEntry is a setting listed in quick jump
+type quickJumpEntry struct {
+	name  string
+	state AppState
+	index int
+}
+
+// quickJumpEntries lists every registered item with an ID alphabetically
+func quickJumpEntries() []quickJumpEntry {
+	var entries []quickJumpEntry
+	for state, screen := range menuScreens {
+		if state == StateQuickJump {
+			continue
+		}
+		for i, item := range screen.items() {
+			if item.ID != "" {
+				entries = append(entries, quickJumpEntry{name: searchName(item.Label), state: state, index: i})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := strings.ToLower(entries[i].name), strings.ToLower(entries[j].name)
+		if a != b {
+			return a < b
+		}
+		if entries[i].state != entries[j].state {
+			return entries[i].state < entries[j].state
+		}
+		return entries[i].index < entries[j].index
+	})
+	return entries
+}
+
+// searchName strips arrows and icons from a label, leaving its words
+func searchName(label string) string {
+	var words []string
+	for _, word := range strings.Fields(label) {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// openQuickJump shows the flat list of settings
+func openQuickJump() {
+	quickJumpFrom = currentState
+	quickJumpSelected = selectedMenu
+	quickJumpList = quickJumpEntries()
+	openMenu(StateQuickJump)
+}
+
+// jumpTo opens a menu screen with the given item selected
+func jumpTo(state AppState, index int) {
+	openMenu(state)
+	selectedMenu = index
+}
+
+// quickJumpMenuItems lists every setting, each jumping to its screen
+func quickJumpMenuItems() []menuItem {
+	items := []menuItem{{Label: i18n.T("common.back"), Action: func() {
+		jumpTo(quickJumpFrom, quickJumpSelected)
+	}}}
+	for _, entry := range quickJumpList {
+		entry := entry
+		items = append(items, menuItem{Label: entry.name, Action: func() {
+			jumpTo(entry.state, entry.index)
+		}})
+	}
+	return items
+}
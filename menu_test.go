@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// clickItem selects the item with the given ID on the current screen and
+// clicks it. Must be called with mutex held.
+func clickItem(t *testing.T, id string) {
+	t.Helper()
+	for i, item := range currentMenuItems() {
+		if item.ID == id {
+			selectedMenu = i
+			menuClick()
+			return
+		}
+	}
+	t.Fatalf("no %s item on the %s screen", id, stateNames[currentState])
+}
+
+// takeAlert returns the alert on screen, if any, and clears it
+func takeAlert() string {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+	text := alertText
+	if time.Now().After(alertUntil) {
+		text = ""
+	}
+	alertText, alertUntil = "", time.Time{}
+	return text
+}
+
+func TestQuickJumpReachesEveryItem(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	t.Cleanup(func() { currentState = StateIdle })
+
+	openMenu(StateSettings)
+	selectedMenu = 2
+	openQuickJump()
+	items := quickJumpMenuItems()
+	if len(items) != len(quickJumpList)+1 {
+		t.Fatalf("quick jump lists %d items for %d entries", len(items), len(quickJumpList))
+	}
+	if len(quickJumpList) == 0 {
+		t.Fatal("quick jump lists no settings")
+	}
+
+	for i, entry := range quickJumpList {
+		openQuickJump()
+		quickJumpMenuItems()[i+1].Action()
+		if currentState != entry.state || selectedMenu != entry.index {
+			t.Errorf("%q jumped to %s item %d, want %s item %d", entry.name,
+				stateNames[currentState], selectedMenu, stateNames[entry.state], entry.index)
+			continue
+		}
+		item := currentMenuItems()[selectedMenu]
+		if item.ID == "" || searchName(item.Label) != entry.name {
+			t.Errorf("%q jumped to %q", entry.name, item.Label)
+		}
+
+		// And back to where quick jump was opened
+		selectedMenu = entry.index
+		openQuickJump()
+		quickJumpMenuItems()[0].Action()
+		if currentState != entry.state || selectedMenu != entry.index {
+			t.Errorf("back from quick jump opened over %q went to %s item %d", entry.name, stateNames[currentState], selectedMenu)
+		}
+	}
+}
+
+func TestQuickJumpListBuiltOnOpen(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	t.Cleanup(func() { currentState = StateIdle })
+
+	openMenu(StateSettings)
+	openQuickJump()
+	calls := 0
+	screen := menuScreens[StateSettings]
+	menuScreens[StateSettings] = menuScreen{title: screen.title, items: func() []menuItem {
+		calls++
+		return screen.items()
+	}}
+	defer func() { menuScreens[StateSettings] = screen }()
+
+	for i := 0; i < 10; i++ {
+		quickJumpMenuItems()
+	}
+	if calls != 0 {
+		t.Errorf("drawing quick jump listed the settings %d times", calls)
+	}
+}
+
+func TestDisabledItemShowsReason(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	mounted, recording := usbMounted, isRecording
+	t.Cleanup(func() {
+		usbMounted, isRecording, currentState = mounted, recording, StateIdle
+		takeAlert()
+	})
+
+	tests := []struct {
+		screen    AppState
+		id        string
+		mounted   bool
+		recording bool
+		reason    string
+	}{
+		{StateSettings, "copy_files", false, false, "reason.no_usb_copy"},
+		{StateSettings, "import_files", false, false, "reason.no_usb_import"},
+		{StateSystemOptions, "format_usb", false, false, "reason.no_usb_format"},
+		{StateSystemOptions, "shutdown", true, true, "reason.recording"},
+		{StateSystemOptions, "restart", true, true, "reason.recording"},
+	}
+	for _, tt := range tests {
+		usbMounted, isRecording = tt.mounted, tt.recording
+		openMenu(tt.screen)
+		takeAlert()
+		clickItem(t, tt.id)
+		if currentState != tt.screen {
+			t.Errorf("disabled %s opened the %s screen", tt.id, stateNames[currentState])
+		}
+		if got, want := takeAlert(), i18n.T(tt.reason); got != want {
+			t.Errorf("disabled %s shows %q, want %q", tt.id, got, want)
+		}
+	}
+
+	// With a drive in, the same click goes through without a toast
+	usbMounted, isRecording = true, false
+	openMenu(StateSettings)
+	clickItem(t, "copy_files")
+	if currentState != StateCopyFiles {
+		t.Errorf("enabled copy_files left the menu on the %s screen", stateNames[currentState])
+	}
+	if alert := takeAlert(); alert != "" {
+		t.Errorf("enabled copy_files shows %q", alert)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	meterBankSize   = 16   // Channels in each bank of meters on the recording screen
+	meterFallDB     = 20.0 // dB a second the meters fall back after a peak
+	meterTop        = 26   // Rows used by the meters on the recording screen
+	meterBottom     = 63
+	meterHeaderLine = 22
+)
+
+// channelMeters measures the peak of every input channel for the meter
+// views of the recording screen, with a hold of the highest peak since the
+// last reset. It is a SampleTap.
+type channelMeters struct {
+	mutex      sync.Mutex
+	sampleRate int
+	channels   int
+	levels     [MaxChannelCount]float64 // Linear, falling at meterFallDB
+	holds      [MaxChannelCount]float64
+	peaks      [MaxChannelCount]int64 // Scratch for the block being measured
+}
+
+// recorderMeters meters the take being recorded
+var recorderMeters = &channelMeters{}
+
+// Reset starts metering a new stream from silence
+func (m *channelMeters) Reset(sampleRate, channels int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sampleRate = sampleRate
+	m.channels = min(channels, MaxChannelCount)
+	m.levels = [MaxChannelCount]float64{}
+	m.holds = [MaxChannelCount]float64{}
+}
+
+// Tap measures a block of interleaved S32LE frames
+func (m *channelMeters) Tap(block []byte, startFrame int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.channels == 0 {
+		return
+	}
+
+	frameSize := m.channels * BitsPerSample / 8
+	peaks := m.peaks[:m.channels]
+	clear(peaks)
+	frames := 0
+	for off := 0; off+frameSize <= len(block); off += frameSize {
+		for ch := range peaks {
+			v := int64(int32(binary.LittleEndian.Uint32(block[off+ch*4:])))
+			if v < 0 {
+				v = -v
+			}
+			if v > peaks[ch] {
+				peaks[ch] = v
+			}
+		}
+		frames++
+	}
+
+	fall := math.Pow(10, -meterFallDB*float64(frames)/float64(m.sampleRate)/20)
+	for ch, peak := range peaks {
+		level := float64(peak) / math.MaxInt32
+		m.levels[ch] = math.Max(m.levels[ch]*fall, level)
+		m.holds[ch] = math.Max(m.holds[ch], level)
+	}
+}
+
+// Read copies the levels and holds of channels first to first+len(levels)
+// into levels and holds, returning how many there were
+func (m *channelMeters) Read(first int, levels, holds []float64) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if first >= m.channels {
+		return 0
+	}
+	n := copy(levels, m.levels[first:m.channels])
+	copy(holds, m.holds[first:first+n])
+	return n
+}
+
+// ResetHolds clears the peak holds
+func (m *channelMeters) ResetHolds() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.holds = [MaxChannelCount]float64{}
+}
+
+// recordView is the recording screen view chosen with the encoder: 0 for
+// the text layout, then each bank of meters, then the overview of every
+// channel. It is kept for the rest of the session.
+var recordView = 0
+
+// Buffers for drawing the meters, so a frame allocates nothing
+var (
+	meterLevels [MaxChannelCount]float64
+	meterHolds  [MaxChannelCount]float64
+	meterDim    [MaxChannelCount]bool
+)
+
+// meterBanks is the number of banks of meters for the channel count
+func meterBanks() int {
+	return max(1, (channelCount+meterBankSize-1)/meterBankSize)
+}
+
+// recordViewCount is the number of recording screen views. The overview is
+// left out when every channel already fits in one bank.
+func recordViewCount() int {
+	if meterBanks() == 1 {
+		return 2
+	}
+	return meterBanks() + 2
+}
+
+// rotateRecordView moves to the next or previous recording screen view.
+// Must be called with mutex held.
+func rotateRecordView(direction int) {
+	n := recordViewCount()
+	recordView = ((recordView+direction)%n + n) % n
+}
+
+// renderMeterView draws the bank of meters or the overview chosen by
+// recordView, under the elapsed time and the channels shown
+func renderMeterView() {
+	first, count := 0, channelCount
+	if bank := recordView - 1; bank < meterBanks() {
+		first = bank * meterBankSize
+		count = min(meterBankSize, channelCount-first)
+	}
+
+	n := recorderMeters.Read(first, meterLevels[:count], meterHolds[:count])
+	for i := 0; i < n; i++ {
+		meterDim[i] = len(armedChannels) > 0 && !slices.Contains(armedChannels, first+i+1)
+	}
+
+	channels := fmt.Sprintf("%d–%d", first+1, first+count)
+	if count == channelCount {
+		channels = i18n.T("meters.all")
+	}
+	header := i18n.Tf("rec.elapsed", formatDuration(time.Since(recordStart))) + "  " + i18n.Tf("meters.channels", channels)
+	hwManager.DrawCenteredText(header, "details", meterHeaderLine)
+	hwManager.DrawMeters(0, meterBottom, DisplayWidth, meterBottom-meterTop+1, meterLevels[:n], meterHolds[:n], meterDim[:n])
+}
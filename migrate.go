@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// migrateCheckInterval is how often a take looks for a preferred record
+// target that has become available
+const migrateCheckInterval = 5 * time.Second
+
+// migrateCandidate is the index of a record target earlier in the list than
+// the one the take is on that has become healthy, or -1. Set while
+// recording by watchMigration.
+var migrateCandidate = -1
+
+// watchMigration looks for a record target earlier in the list than the one
+// r is writing to, such as an SSD attached after the take started, and
+// offers it on the recording screen until the take ends
+func watchMigration(r *Recorder) {
+	ticker := time.NewTicker(migrateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Done():
+			mutex.Lock()
+			migrateCandidate = -1
+			mutex.Unlock()
+			return
+		case <-ticker.C:
+		}
+
+		// Health checks write a probe file, so run them without the mutex
+		idx := -1
+		for i := 0; i < r.TargetIndex(); i++ {
+			if recordTargets[i].CheckHealth() == nil {
+				idx = i
+				break
+			}
+		}
+
+		mutex.Lock()
+		if recorder == r && idx != migrateCandidate {
+			if idx >= 0 {
+				log.Printf("Record target %s available, offering to migrate %s", recordTargets[idx].Name, r.baseName)
+				showAlert(i18n.Tf("migrate.available", recordTargets[idx].Name), 5*time.Second)
+			}
+			migrateCandidate = idx
+		}
+		mutex.Unlock()
+	}
+}
+
+// canMigrate reports whether the take can move to a newly available target.
+// Must be called with mutex held.
+func canMigrate() bool {
+	return recorder != nil && migrateCandidate >= 0 && !recorder.MigratePending()
+}
+
+// requestMigrate moves the take to the offered target at the next block.
+// Must be called with mutex held.
+func requestMigrate() {
+	if !canMigrate() {
+		return
+	}
+	log.Printf("Migrating %s to %s", recorder.baseName, recordTargets[migrateCandidate].Name)
+	recorder.MigrateTo(migrateCandidate)
+	migrateCandidate = -1
+}
+
+// onMigrate reports the outcome of a migration. It runs on the writer
+// goroutine, so it must not take the mutex.
+func onMigrate(from, to *RecordTarget, err error) {
+	if err != nil {
+		setLastError("Failed to migrate take from %s to %s: %v", from.Name, to.Name, err)
+		showAlert(i18n.Tf("migrate.failed", to.Name), 5*time.Second)
+		return
+	}
+	showAlert(i18n.Tf("migrate.done", to.Name), 5*time.Second)
+}
+
+// migrateStatusText shows on the recording screen that a target can be
+// migrated to, or that the take's earlier files will follow it there once
+// it ends. Must be called with mutex held.
+func migrateStatusText() string {
+	switch {
+	case recorder == nil:
+		return ""
+	case recorder.MigratePending():
+		return i18n.T("migrate.pending")
+	case canMigrate():
+		return i18n.Tf("migrate.offer", recordTargets[migrateCandidate].Name)
+	case recorder.Migrated():
+		return i18n.Tf("migrate.after_take", recorder.CurrentTarget().Name)
+	}
+	return ""
+}
+
+// startTakeMigration moves the files of a migrated take recorded before the
+// migration to the folder of its last file, in the background once the
+// record targets are free
+func startTakeMigration(take TakeInfo) {
+	take.Files = append([]string(nil), take.Files...)
+	dir := filepath.Dir(take.Files[len(take.Files)-1])
+	go func() {
+		ctx := context.Background()
+		lease, err := resources.Acquire(ctx, jobMigrate, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 3*time.Second)
+		}, targetPaths()...)
+		if err != nil {
+			return
+		}
+		defer lease.Release()
+
+		moved, err := migrateTake(ctx, &take, dir)
+		if moved > 0 {
+			mutex.Lock()
+			if lastTake != nil && lastTake.Name == take.Name {
+				lastTake = &take
+			}
+			mutex.Unlock()
+		}
+		if err != nil {
+			setLastError("Failed to move take %s to %s: %v", take.Name, dir, err)
+			showAlert(i18n.T("migrate.move_failed"), 5*time.Second)
+			return
+		}
+		log.Printf("Moved %d files of take %s to %s", moved, take.Name, dir)
+	}()
+}
+
+// migrateTake copies each file of take outside dir into dir, checks the
+// copy against the checksum recorded with the take, and points the take at
+// it. Once the sidecar beside the new first file lists the copies, the
+// originals and their sidecar and note are deleted. It returns how many
+// files moved; files that failed stay where they were.
+func migrateTake(ctx context.Context, take *TakeInfo, dir string) (int, error) {
+	oldSidecar := sidecarPath(take.Files[0])
+	oldNote := takeNotePath(take.Files[0])
+	var moved []string
+	var firstErr error
+	for i, file := range take.Files {
+		if filepath.Dir(file) == dir {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(file))
+		if err := moveTakeFile(ctx, take, i, dst); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", filepath.Base(file), err)
+			}
+			continue
+		}
+		moved = append(moved, file)
+		take.Files[i] = dst
+	}
+	if len(moved) == 0 {
+		return 0, firstErr
+	}
+
+	if err := writeTakeInfo(take); err != nil {
+		// Without a sidecar listing the copies, keep the originals
+		for _, file := range moved {
+			os.Remove(filepath.Join(dir, filepath.Base(file)))
+		}
+		return 0, err
+	}
+	for _, file := range moved {
+		if err := os.Remove(file); err != nil {
+			log.Printf("Failed to remove %s after moving it: %v", file, err)
+		}
+	}
+	if newSidecar := sidecarPath(take.Files[0]); newSidecar != oldSidecar {
+		os.Remove(oldSidecar)
+	}
+	if newNote := takeNotePath(take.Files[0]); newNote != oldNote && fileExists(oldNote) && !fileExists(newNote) {
+		if _, err := copyFile(ctx, oldNote, newNote); err == nil {
+			os.Remove(oldNote)
+		}
+	}
+	return len(moved), firstErr
+}
+
+// moveTakeFile copies file i of take to dst and checks the copy's sample
+// data against the checksum recorded with the take, or against the
+// original's when the take has none. A copy that does not match is removed.
+func moveTakeFile(ctx context.Context, take *TakeInfo, i int, dst string) error {
+	src := take.Files[i]
+	if fileExists(dst) {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	progress := startBackgroundJob(jobMigrate, totalSize([]string{src}))
+	defer progress.Finish()
+	if err := copyPipelined(ctx, src, dst, progress); err != nil {
+		noteWriteError(dst, "migrate", err)
+		return err
+	}
+
+	want, ok := takeDataSum(take, i)
+	if !ok {
+		want.newHash = newXXH64
+		var err error
+		if want.value, err = hashWAVData(ctx, src, want.newHash, nil); err != nil {
+			os.Remove(dst)
+			return err
+		}
+	}
+	got, err := hashWAVData(ctx, dst, want.newHash, nil)
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if got != want.value {
+		os.Remove(dst)
+		return fmt.Errorf("copy does not match the checksum of the original")
+	}
+	return nil
+}
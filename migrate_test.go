@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cueFrames returns the sample frame of each cue point in a WAV file
+func cueFrames(t *testing.T, path string) []int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []int64
+	for at := 12; at+8 <= len(data); {
+		id, size := string(data[at:at+4]), int(binary.LittleEndian.Uint32(data[at+4:at+8]))
+		if id == "cue " {
+			for i := 0; i < int(binary.LittleEndian.Uint32(data[at+8:])); i++ {
+				frames = append(frames, int64(binary.LittleEndian.Uint32(data[at+12+24*i+20:])))
+			}
+		}
+		at += 8 + size + size%2
+	}
+	return frames
+}
+
+func TestMigrateToTargetAttachedMidTake(t *testing.T) {
+	// The SSD is first in the list but not there when the take starts
+	ssd := filepath.Join(t.TempDir(), "ssd")
+	targets := []*RecordTarget{{Name: "SSD", Path: ssd}, {Name: "SD", Path: t.TempDir()}}
+	r, err := newRecorder(targets, 48000, testChannels, nil, nil, "", "take")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CurrentTarget() != targets[1] {
+		t.Fatalf("take started on %s, want SD", r.CurrentTarget().Name)
+	}
+	var migrateErr error
+	r.OnMigrate = func(from, to *RecordTarget, err error) { migrateErr = err }
+
+	source, feed := io.Pipe()
+	r.Start(source)
+	samples := testSamples(8 * recordBlockFrames)
+	block := len(samples) / 8
+	if _, err := feed.Write(samples[:2*block]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The SSD is attached and the take told to move there
+	if err := os.Mkdir(ssd, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := targets[0].CheckHealth(); err != nil {
+		t.Fatalf("attached target unhealthy: %v", err)
+	}
+	r.MigrateTo(0)
+	if _, err := feed.Write(samples[2*block:]); err != nil {
+		t.Fatal(err)
+	}
+	feed.Close()
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if migrateErr != nil {
+		t.Fatalf("migration failed: %v", migrateErr)
+	}
+
+	files := r.Files()
+	if len(files) != 2 || filepath.Dir(files[0]) != targets[1].Path || filepath.Dir(files[1]) != ssd {
+		t.Fatalf("files %v, want the first on SD and the second on the SSD", files)
+	}
+	first, firstInfo := readSamples(t, files[0])
+	second, secondInfo := readSamples(t, files[1])
+	if !bytes.Equal(append(first, second...), samples) {
+		t.Fatal("the parts together do not hold the samples recorded")
+	}
+
+	// The second part numbers its samples on from the first
+	if want := firstInfo.TimeReference + uint64(len(first)/r.fileFrameSize()); secondInfo.TimeReference != want {
+		t.Errorf("second part starts at sample %d, want %d", secondInfo.TimeReference, want)
+	}
+	markers := r.Markers()
+	if len(markers) != 1 || markers[0].File != filepath.Base(files[1]) || markers[0].Frame != 0 || markers[0].Label == "" {
+		t.Fatalf("markers %+v, want one labelled at the start of the second part", markers)
+	}
+	if cues := cueFrames(t, files[1]); len(cues) != 1 || cues[0] != 0 {
+		t.Errorf("second part has cue points at %v, want one at 0", cues)
+	}
+
+	// Once the take ends its first part follows it to the SSD
+	take := newTakeInfo(r, nil, 0)
+	if err := writeTakeInfo(take); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := migrateTake(context.Background(), take, ssd)
+	if err != nil || moved != 1 {
+		t.Fatalf("moved %d files: %v", moved, err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Error("original of the moved part left behind")
+	}
+	if _, err := os.Stat(sidecarPath(files[0])); !os.IsNotExist(err) {
+		t.Error("sidecar left beside the moved part's original")
+	}
+	saved, err := readTakeInfo(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, file := range saved.Files {
+		if filepath.Dir(file) != ssd {
+			t.Errorf("sidecar lists %s, want it on the SSD", file)
+		}
+		got, err := hashWAVData(context.Background(), file, newXXH64, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != saved.DataXXH64[i] {
+			t.Errorf("%s does not match the checksum recorded with the take", filepath.Base(file))
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+const (
+	monitorQueueBlocks = 8  // Blocks buffered for the output before new ones are dropped
+	monitorMix         = -1 // monitorSource value for the stereo mix of every armed channel
+	volumeStep         = 5
+)
+
+// OutputDevice is an ALSA playback device
+type OutputDevice struct {
+	ID   string // ALSA device name, e.g. "plughw:1,0"
+	Name string
+}
+
+var (
+	monitor       *Monitor
+	monitorSource = 0  // 0 off, 1-based channel pair, or monitorMix
+	monitorDevice = "" // ID of the chosen output device
+	monitorVolume = 70 // Percent
+	monitorMuted  = false
+	lastPlayPress time.Time
+)
+
+// Monitor plays a channel pair or the stereo mix of a take to an ALSA device
+// through aplay. Fed from a recorder tap it is strictly best effort: blocks
+// are dropped rather than ever holding up the file writer. The player feeds
+// it instead, waiting for room so playback runs at the output's pace.
+type Monitor struct {
+	channels    int
+	left, right int   // 0-based input channels, unused for the mix
+	mix         []int // 0-based channels summed for the mix
+	gain        atomic.Int32
+
+	cmd   *exec.Cmd
+	queue chan []byte
+	done  chan struct{}
+}
+
+// listOutputDevices returns the ALSA playback devices
+func listOutputDevices() []OutputDevice {
+	f, err := os.Open("/proc/asound/pcm")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// Lines look like "01-00: USB Audio : USB Audio : playback 1 : capture 1"
+	var devices []OutputDevice
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 || !strings.Contains(scanner.Text(), "playback") {
+			continue
+		}
+		var card, dev int
+		if _, err := fmt.Sscanf(fields[0], "%d-%d", &card, &dev); err != nil {
+			continue
+		}
+		devices = append(devices, OutputDevice{
+			ID:   fmt.Sprintf("plughw:%d,%d", card, dev),
+			Name: strings.TrimSpace(fields[1]),
+		})
+	}
+	return devices
+}
+
+// newMonitor starts aplay on device for a take. armed lists the 0-based
+// channels in the mix, or nil for every channel.
+func newMonitor(device string, sampleRate, channels, source int, armed []int) (*Monitor, error) {
+	m := &Monitor{
+		channels: channels,
+		queue:    make(chan []byte, monitorQueueBlocks),
+		done:     make(chan struct{}),
+	}
+	if source == monitorMix {
+		m.mix = armed
+		if m.mix == nil {
+			for ch := 0; ch < channels; ch++ {
+				m.mix = append(m.mix, ch)
+			}
+		}
+	} else {
+		// The last pair of an odd channel count is mono
+		m.left = 2 * (source - 1)
+		m.right = m.left + 1
+		if m.right >= channels {
+			m.right = m.left
+		}
+	}
+
+	m.cmd = exec.Command("aplay", "-q", "-D", device, "-t", "raw", "-f", "S16_LE", "-c", "2", "-r", strconv.Itoa(sampleRate))
+	stdin, err := m.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start aplay: %v", err)
+	}
+	go m.run(stdin)
+	return m, nil
+}
+
+// SetGain sets the output level in percent, 0 for silence
+func (m *Monitor) SetGain(percent int) {
+	m.gain.Store(int32(percent))
+}
+
+// Tap converts a block of input to 16-bit stereo and queues it for the
+// output, dropping it if the output has fallen behind. It is a SampleTap.
+func (m *Monitor) Tap(block []byte, startFrame int64) {
+	select {
+	case m.queue <- m.convert(block):
+	default:
+		// Output is behind; skip rather than block the recorder
+	}
+}
+
+// Feed converts a block and queues it, waiting for room. It returns false
+// if cancel is closed first or the output has stopped.
+func (m *Monitor) Feed(block []byte, cancel <-chan struct{}) bool {
+	out := m.convert(block)
+	select {
+	case m.queue <- out:
+		return true
+	case <-cancel:
+	case <-m.done:
+	}
+	return false
+}
+
+// convert mixes a block of interleaved S32LE input down to 16-bit stereo at
+// the current gain
+func (m *Monitor) convert(block []byte) []byte {
+	frameSize := m.channels * BitsPerSample / 8
+	frames := len(block) / frameSize
+	gain := int64(m.gain.Load())
+	out := make([]byte, frames*4)
+
+	sample := func(frame []byte, ch int) int64 {
+		return int64(int32(binary.LittleEndian.Uint32(frame[ch*4:])))
+	}
+	for i := 0; i < frames; i++ {
+		frame := block[i*frameSize : (i+1)*frameSize]
+		var l, r int64
+		if m.mix != nil {
+			for _, ch := range m.mix {
+				l += sample(frame, ch)
+			}
+			l /= int64(len(m.mix))
+			r = l
+		} else {
+			l, r = sample(frame, m.left), sample(frame, m.right)
+		}
+		binary.LittleEndian.PutUint16(out[i*4:], uint16(int16(l*gain/100>>16)))
+		binary.LittleEndian.PutUint16(out[i*4+2:], uint16(int16(r*gain/100>>16)))
+	}
+	return out
+}
+
+func (m *Monitor) run(stdin io.WriteCloser) {
+	defer close(m.done)
+	defer stdin.Close()
+
+	for block := range m.queue {
+		if _, err := stdin.Write(block); err != nil {
+			log.Printf("Monitor output stopped: %v", err)
+			// Keep draining so Tap never finds the queue full for long
+			for range m.queue {
+			}
+			return
+		}
+	}
+}
+
+// Stop closes the output once queued audio has been handed to aplay
+func (m *Monitor) Stop() {
+	close(m.queue)
+	<-m.done
+	m.cmd.Wait()
+}
+
+// Kill cuts the output off, dropping queued audio. Stop must still be called.
+func (m *Monitor) Kill() {
+	m.cmd.Process.Kill()
+}
+
+// Active reports whether the output is still running
+func (m *Monitor) Active() bool {
+	select {
+	case <-m.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// monitorGain is the output level after mute. Must be called with mutex held.
+func monitorGain() int {
+	if monitorMuted {
+		return 0
+	}
+	return monitorVolume
+}
+
+// startMonitor taps a starting take for the monitor output, if one is
+// selected. Must be called with mutex held.
+func startMonitor(r *Recorder) {
+	if monitorSource == 0 || monitorDevice == "" || 2*monitorSource-1 > r.channels {
+		return
+	}
+	m, err := newMonitor(monitorDevice, r.sampleRate, r.channels, monitorSource, r.armed)
+	if err != nil {
+		log.Printf("Monitor unavailable on %s: %v", monitorDevice, err)
+		return
+	}
+	m.SetGain(monitorGain())
+	r.AddTap(m.Tap)
+	monitor = m
+}
+
+// stopMonitor ends the monitor output. Must be called with mutex held.
+func stopMonitor() {
+	if monitor != nil {
+		monitor.Stop()
+		monitor = nil
+	}
+}
+
+// toggleMonitorMute is bound to a double press of the Play button. Must be
+// called with mutex held.
+func toggleMonitorMute() {
+	monitorMuted = !monitorMuted
+	if monitor != nil {
+		monitor.SetGain(monitorGain())
+	}
+	if player != nil {
+		player.out.SetGain(monitorGain())
+	}
+	if monitorMuted {
+		showAlert(i18n.T("alert.monitor_muted"), 2*time.Second)
+	} else {
+		showAlert(i18n.T("alert.monitor_unmuted"), 2*time.Second)
+	}
+}
+
+// onPlayPress toggles the monitor mute on a double press. A single press
+// plays the take shown on the file details screen, or stops it. Must be
+// called with mutex held.
+func onPlayPress() {
+	now := time.Now()
+	if now.Sub(lastPlayPress) < doubleClickWindow {
+		toggleMonitorMute()
+		lastPlayPress = time.Time{}
+		return
+	}
+	lastPlayPress = now
+
+	switch currentState {
+	case StateFileDetails:
+		startPlayback(detailsFile)
+	case StatePlayback:
+		stopPlayback()
+		currentState = StateFileDetails
+	}
+}
+
+// monitorStatusElements returns the status bar icon while monitoring
+func monitorStatusElements() []hardware.StatusElement {
+	if monitor == nil || !monitor.Active() {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.HeadphoneStatusElement(monitorMuted)}
+}
+
+// monitorSourceText shows the monitored channels
+func monitorSourceText() string {
+	switch {
+	case len(listOutputDevices()) == 0:
+		return i18n.T("monitor.no_device")
+	case monitorSource == 0:
+		return i18n.T("common.off")
+	case monitorSource == monitorMix:
+		return i18n.T("monitor.mix")
+	case 2*monitorSource > channelCount:
+		return strconv.Itoa(channelCount)
+	}
+	return fmt.Sprintf("%d-%d", 2*monitorSource-1, 2*monitorSource)
+}
+
+// adjustMonitorSource steps through Off, each channel pair and the mix
+func adjustMonitorSource(direction int) {
+	devices := listOutputDevices()
+	if len(devices) == 0 {
+		return
+	}
+	if monitorDevice == "" {
+		monitorDevice = devices[0].ID
+	}
+
+	// Options in order: off, pairs 1..n, mix
+	pairs := (channelCount + 1) / 2
+	idx := monitorSource
+	if idx == monitorMix {
+		idx = pairs + 1
+	}
+	count := pairs + 2
+	idx = ((idx+direction)%count + count) % count
+	monitorSource = idx
+	if idx == pairs+1 {
+		monitorSource = monitorMix
+	}
+}
+
+// monitorDeviceText shows the name of the chosen output device
+func monitorDeviceText() string {
+	for _, dev := range listOutputDevices() {
+		if dev.ID == monitorDevice {
+			return dev.Name
+		}
+	}
+	return i18n.T("monitor.no_device")
+}
+
+// adjustMonitorDevice steps through the playback devices
+func adjustMonitorDevice(direction int) {
+	devices := listOutputDevices()
+	if len(devices) == 0 {
+		monitorDevice = ""
+		return
+	}
+	idx := -1
+	for i, dev := range devices {
+		if dev.ID == monitorDevice {
+			idx = i
+		}
+	}
+	idx = ((idx+direction)%len(devices) + len(devices)) % len(devices)
+	monitorDevice = devices[idx].ID
+}
+
+// monitorVolumeText shows the monitor level
+func monitorVolumeText() string {
+	if monitorMuted {
+		return i18n.T("monitor.muted")
+	}
+	return fmt.Sprintf("%d%%", monitorVolume)
+}
+
+// adjustMonitorVolume changes the monitor level in volumeStep steps
+func adjustMonitorVolume(direction int) {
+	monitorVolume += direction * volumeStep
+	if monitorVolume < 0 {
+		monitorVolume = 0
+	} else if monitorVolume > 100 {
+		monitorVolume = 100
+	}
+	if monitor != nil {
+		monitor.SetGain(monitorGain())
+	}
+}
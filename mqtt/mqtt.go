@@ -0,0 +1,358 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: QoS 0 publish and subscribe
+// over plain TCP, with keepalive and a last will. It is enough to report
+// tally state to building automation and take simple commands back.
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPort is used when the broker address has no port
+const DefaultPort = "1883"
+
+// Packet types, in the high nibble of the fixed header
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxPacket bounds incoming packets; tally commands are tiny
+const maxPacket = 64 * 1024
+
+// Message is an application message sent or received
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection
+type Options struct {
+	Broker    string // host or host:port, optionally prefixed with tcp://
+	ClientID  string
+	Username  string // Empty for anonymous
+	Password  string
+	KeepAlive time.Duration
+	Will      *Message      // Published by the broker if the connection is lost
+	Timeout   time.Duration // For the dial, the handshake and each write
+}
+
+// Client is a connected MQTT session. Once Done is closed the session is
+// dead and a new one must be dialled.
+type Client struct {
+	conn     net.Conn
+	timeout  time.Duration
+	writeMu  sync.Mutex
+	messages chan Message
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	packetID uint16
+}
+
+// Dial connects to the broker and completes the MQTT handshake
+func Dial(opts Options) (*Client, error) {
+	addr := strings.TrimPrefix(opts.Broker, "tcp://")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:     conn,
+		timeout:  opts.Timeout,
+		messages: make(chan Message, 16),
+		done:     make(chan struct{}),
+	}
+
+	if err := c.write(packetConnect<<4, connectBody(opts)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(opts.Timeout))
+	header, body, err := readPacket(reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if header>>4 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, errors.New("mqtt: expected CONNACK")
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused: %s", connackReason(body[1]))
+	}
+
+	go c.readLoop(reader, opts.KeepAlive)
+	if opts.KeepAlive > 0 {
+		go c.pingLoop(opts.KeepAlive)
+	}
+	return c, nil
+}
+
+// Publish sends a QoS 0 message
+func (c *Client) Publish(m Message) error {
+	header := byte(packetPublish << 4)
+	if m.Retain {
+		header |= 0x01
+	}
+	body := appendString(nil, m.Topic)
+	return c.write(header, append(body, m.Payload...))
+}
+
+// Subscribe asks for messages on a topic filter at QoS 0. Matching messages
+// arrive on Messages.
+func (c *Client) Subscribe(filter string) error {
+	c.writeMu.Lock()
+	c.packetID++
+	id := c.packetID
+	c.writeMu.Unlock()
+
+	body := []byte{byte(id >> 8), byte(id)}
+	body = appendString(body, filter)
+	body = append(body, 0) // QoS 0
+	return c.write(packetSubscribe<<4|0x02, body)
+}
+
+// Messages delivers published messages on subscribed topics. Messages are
+// dropped if the receiver falls behind.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done is closed when the connection is lost or closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, once Done is closed
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close disconnects cleanly. The last will is not published.
+func (c *Client) Close() error {
+	c.write(packetDisconnect<<4, nil)
+	c.fail(errors.New("mqtt: closed"))
+	return nil
+}
+
+// fail ends the session with the first error seen
+func (c *Client) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+// write sends one packet, failing the session if the broker is not taking
+// data within the timeout
+func (c *Client) write(header byte, body []byte) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+
+	packet := append([]byte{header}, appendLength(nil, len(body))...)
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// readLoop handles incoming packets until the connection fails. Without a
+// packet for one and a half keepalive periods the broker is taken as gone.
+func (c *Client) readLoop(reader *bufio.Reader, keepAlive time.Duration) {
+	defer close(c.messages)
+	for {
+		if keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		} else {
+			c.conn.SetReadDeadline(time.Time{})
+		}
+		header, body, err := readPacket(reader)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if header>>4 != packetPublish {
+			continue // SUBACK, PINGRESP
+		}
+		m, err := parsePublish(header, body)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		select {
+		case c.messages <- m:
+		default:
+		}
+	}
+}
+
+// pingLoop keeps the session alive while it is otherwise quiet
+func (c *Client) pingLoop(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packetPingreq<<4, nil)
+		}
+	}
+}
+
+// connectBody builds the CONNECT variable header and payload
+func connectBody(opts Options) []byte {
+	flags := byte(0x02) // Clean session
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	keepAlive := int(opts.KeepAlive / time.Second)
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendString(body, string(opts.Will.Payload))
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return body
+}
+
+// parsePublish decodes an incoming PUBLISH. QoS 1 and 2 messages carry a
+// packet ID, which is skipped; they are handled as QoS 0.
+func parsePublish(header byte, body []byte) (Message, error) {
+	if len(body) < 2 {
+		return Message{}, errors.New("mqtt: short PUBLISH")
+	}
+	n := int(body[0])<<8 | int(body[1])
+	if len(body) < 2+n {
+		return Message{}, errors.New("mqtt: short PUBLISH topic")
+	}
+	m := Message{Topic: string(body[2 : 2+n]), Retain: header&0x01 != 0}
+	rest := body[2+n:]
+	if (header>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return Message{}, errors.New("mqtt: short PUBLISH packet ID")
+		}
+		rest = rest[2:]
+	}
+	m.Payload = append([]byte(nil), rest...)
+	return m, nil
+}
+
+// readPacket reads one packet, returning its fixed header byte and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxPacket {
+		return 0, nil, fmt.Errorf("mqtt: %d byte packet too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// appendLength encodes the remaining length field
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendString encodes a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// connackReason describes a CONNACK return code
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
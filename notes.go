@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// sessionNotesName is the session notes file in each session folder
+const sessionNotesName = "notes.txt"
+
+// noteChars are offered by the note editor after its actions, tokens and
+// recent entries
+var noteChars = []rune(" ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.,:;-/'!?()#+&@")
+
+const noteMaxLen = 200
+
+var (
+	noteText     []rune
+	noteCursor   = 0 // Position in noteText that entries insert at
+	noteEntries  []noteEntry
+	noteCharIdx  = 0     // Selected entry of noteEntries
+	noteTake     = ""    // Recording file the note is for, empty for a session note
+	noteUnitName = false // The editor is setting the unit name rather than a note
+	noteReturn   AppState
+	noteOption   = false // "Add note" is selected on the summary and details screens
+)
+
+// takeNotePath returns the notes file for the take a recording file belongs to
+func takeNotePath(path string) string {
+	return filepath.Join(filepath.Dir(path), takeName(path)+".txt")
+}
+
+// appendNote adds a timestamped line to a notes file
+func appendNote(path, text string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s  %s\n", time.Now().Format("2006-01-02 15:04:05"), text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveTakeNote adds a note to the take a recording file belongs to
+func saveTakeNote(file, text string) error {
+	return appendNote(takeNotePath(file), text)
+}
+
+// saveSessionNote adds a note to the current session on every available
+// target, so it is found whichever target the session's files are copied
+// from. Must be called with mutex held.
+func saveSessionNote(text string) error {
+	var lastErr error
+	saved := false
+	for _, target := range recordTargets {
+		if !target.Available() {
+			continue
+		}
+		dir := sessionDir(target.Path, sessionName)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := appendNote(filepath.Join(dir, sessionNotesName), text); err != nil {
+			lastErr = err
+			continue
+		}
+		saved = true
+	}
+	if !saved {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no record target available")
+		}
+		return lastErr
+	}
+	return nil
+}
+
+// noteFiles returns the notes that travel with a recording file when it is
+// copied, keyed by the name they are given on the destination
+func noteFiles(file string) map[string]string {
+	notes := make(map[string]string)
+	if path := takeNotePath(file); fileExists(path) {
+		notes[filepath.Base(path)] = path
+	}
+	dir := filepath.Dir(file)
+	if path := filepath.Join(dir, sessionNotesName); fileExists(path) {
+		notes["notes_"+filepath.Base(dir)+".txt"] = path
+	}
+	return notes
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// openNoteEditor starts a note for a take, or for the session when file is
+// empty. Must be called with mutex held.
+func openNoteEditor(file string) {
+	noteReturn = currentState
+	noteTake = file
+	noteUnitName = false
+	noteMarker = 0
+	noteOption = false
+	currentState = StateNoteEditor
+	setNoteText("")
+}
+
+// setNoteText starts the editor on text with the cursor at its end, and lays
+// out the strip for the field being edited. Openers call it again after
+// choosing the field. Must be called with mutex held.
+func setNoteText(text string) {
+	noteText = []rune(text)
+	noteCursor = len(noteText)
+	buildNoteEntries()
+}
+
+// noteEditorRotate moves through the editor entries
+func noteEditorRotate(direction int) {
+	count := len(noteEntries)
+	noteCharIdx = ((noteCharIdx+direction)%count + count) % count
+}
+
+// noteEditorClick inserts the selected character, token or recent entry at
+// the cursor, or runs the selected action
+func noteEditorClick() {
+	switch entry := noteEntries[noteCharIdx]; entry.kind {
+	case entrySave:
+		finishNote()
+	case entryDelete:
+		deleteNoteChar()
+	case entryDeleteWord:
+		deleteNoteWord()
+	case entryLeft:
+		moveNoteCursor(-1)
+	case entryRight:
+		moveNoteCursor(1)
+	case entryInsert:
+		insertNoteText(entry.text)
+	}
+}
+
+// finishNote saves the note, if any, and returns to the screen it was opened from
+func finishNote() {
+	text := strings.TrimSpace(string(noteText))
+	currentState = noteReturn
+	if text != "" {
+		rememberEntry(text)
+	}
+	if noteUnitName {
+		finishUnitName(text)
+		return
+	}
+	if noteMarker > 0 {
+		finishMarkerLabel(text)
+		return
+	}
+	if text == "" {
+		return
+	}
+
+	var err error
+	if noteTake != "" {
+		err = saveTakeNote(noteTake, text)
+	} else {
+		err = saveSessionNote(text)
+	}
+	if err != nil {
+		setLastError("Failed to save note: %v", err)
+		showAlert(i18n.T("notes.failed"), 5*time.Second)
+		return
+	}
+	log.Printf("Saved note for %s: %s", noteSubject(), text)
+	showAlert(i18n.T("notes.saved"), 3*time.Second)
+}
+
+// noteSubject names what the note being edited is attached to
+func noteSubject() string {
+	if noteTake != "" {
+		return takeName(noteTake)
+	}
+	if sessionName == "" {
+		return i18n.T("notes.no_session")
+	}
+	return sessionName
+}
+
+// noteTitle names the take or session the note is for
+func noteTitle() string {
+	if noteUnitName {
+		return i18n.T("unit.title")
+	}
+	if noteMarker > 0 {
+		return i18n.Tf("markers.rename_title", noteMarker)
+	}
+	if noteTake != "" {
+		return i18n.Tf("notes.take_title", noteSubject())
+	}
+	return i18n.Tf("notes.session_title", noteSubject())
+}
+
+func renderNoteEditor() {
+	hwManager.DrawCenteredText(hwManager.FitText(noteTitle(), DisplayWidth-8), "header", 16)
+
+	hwManager.SwitchToContext("menu")
+	hwManager.DrawText(8, 32, noteLine(DisplayWidth-16))
+
+	// The selected entry with its neighbours either side
+	hwManager.DrawCenteredText(noteStrip(4, DisplayWidth-4), "selected", 46)
+
+	hwManager.DrawCenteredText(i18n.T("notes.hint"), "details", 58)
+}
+
+// noteOptionText shows the bottom line of the summary and details screens,
+// which toggles between leaving the screen and adding a note
+func noteOptionText(leave string) string {
+	if noteOption {
+		return "‹" + i18n.T("notes.add") + "›"
+	}
+	return "‹" + leave + "›"
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	panelRotateInterval = 5 * time.Second  // How long each idle panel is shown
+	panelManualHold     = 30 * time.Second // Rotation pause after choosing a panel by hand
+	panelPinPriority    = 100              // Panels at or above this stay up while they have text
+	lowStorageWarning   = 15 * time.Minute // Remaining time that pins the low storage panel
+)
+
+// infoPanel is one of the detail lines the idle screen cycles through
+type infoPanel struct {
+	id       string
+	priority int
+	text     func() string // Empty when the panel has nothing to show
+}
+
+var (
+	infoPanels    []infoPanel
+	panelIdx      = 0
+	panelShownAt  time.Time
+	panelHoldTill time.Time
+
+	// idlePanel is the ID of the panel last chosen by hand, kept with the
+	// settings
+	idlePanel = ""
+)
+
+// registerInfoPanel adds a panel to the idle rotation. Panels rotate in the
+// order they are registered; the highest priority panel at or above
+// panelPinPriority that has text is shown instead of rotating.
+func registerInfoPanel(id string, priority int, text func() string) {
+	infoPanels = append(infoPanels, infoPanel{id: id, priority: priority, text: text})
+}
+
+// registerInfoPanels sets up the idle screen panels
+func registerInfoPanels() {
+	registerInfoPanel("remaining", 0, func() string {
+		return i18n.Tf("idle.available", formatDuration(estimateRemainingTime()), getRemainingStorage())
+	})
+	registerInfoPanel("last_take", 0, func() string {
+		if lastTake == nil {
+			return ""
+		}
+		duration := time.Duration(lastTake.DurationSeconds * float64(time.Second))
+		return i18n.Tf("idle.last_take", lastTake.Name, formatDuration(duration))
+	})
+	registerInfoPanel("session", 0, func() string {
+		if sessionName == "" {
+			return ""
+		}
+		return i18n.Tf("idle.session", sessionName)
+	})
+	registerInfoPanel("schedule", 0, scheduleIdleText)
+	registerInfoPanel("schedule_clock", panelPinPriority, scheduleClockText)
+	registerInfoPanel("low_storage", panelPinPriority, func() string {
+		remaining := estimateRemainingTime()
+		if remaining >= lowStorageWarning {
+			return ""
+		}
+		return i18n.Tf("idle.low_storage", formatDuration(remaining))
+	})
+	panelShownAt = time.Now()
+}
+
+// infoPanelNamed reports whether id is a registered idle panel
+func infoPanelNamed(id string) bool {
+	for _, panel := range infoPanels {
+		if panel.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// showIdlePanel makes the panel with the given ID, or the first if it is
+// empty, the one chosen by hand
+func showIdlePanel(id string) {
+	idlePanel = id
+	panelIdx = 0
+	for i, panel := range infoPanels {
+		if panel.id == id {
+			panelIdx = i
+		}
+	}
+}
+
+// idlePanelText returns the detail line for the idle screen, advancing the
+// rotation when the current panel has been up long enough. Must be called
+// with mutex held.
+func idlePanelText() string {
+	pinned := -1
+	for i, panel := range infoPanels {
+		if panel.priority >= panelPinPriority && (pinned < 0 || panel.priority > infoPanels[pinned].priority) && panel.text() != "" {
+			pinned = i
+		}
+	}
+	if pinned >= 0 {
+		return infoPanels[pinned].text()
+	}
+
+	now := time.Now()
+	text := infoPanels[panelIdx].text()
+	if text == "" || (now.Sub(panelShownAt) >= panelRotateInterval && now.After(panelHoldTill)) {
+		if next := nextPanel(1); next != panelIdx {
+			panelIdx = next
+			text = infoPanels[panelIdx].text()
+		}
+		panelShownAt = now
+	}
+	return text
+}
+
+// nextPanel returns the next rotating panel with text in the given direction
+func nextPanel(direction int) int {
+	n := len(infoPanels)
+	for step := 1; step <= n; step++ {
+		i := ((panelIdx+direction*step)%n + n) % n
+		if infoPanels[i].priority < panelPinPriority && infoPanels[i].text() != "" {
+			return i
+		}
+	}
+	return panelIdx
+}
+
+// flipPanel shows the next or previous panel from the encoder and holds it
+// for a while. The choice is saved with the settings. Must be called with
+// mutex held.
+func flipPanel(direction int) {
+	panelIdx = nextPanel(direction)
+	panelShownAt = time.Now()
+	panelHoldTill = panelShownAt.Add(panelManualHold)
+	idlePanel = infoPanels[panelIdx].id
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+const (
+	maxPeakBuckets  = 480 // History is halved in resolution once it reaches this
+	peakStripWidth  = 240 // Columns in the strip chart
+	peakStripX      = 8   // Position of the strip on the summary and details screens
+	peakStripBottom = 48
+	peakStripHeight = 8
+	peakFloorDB     = -60.0      // Level drawn as an empty column
+	clipLevel       = 0x7FFF0000 // Sample magnitude counted as a clip
+)
+
+// PeakHistory is the overall peak level of a take over time, stored in the
+// take sidecar. Each bucket covers SecondsPerBucket seconds; buckets are
+// merged in pairs as the take grows so memory stays bounded.
+type PeakHistory struct {
+	SecondsPerBucket int       `json:"seconds_per_bucket"`
+	Peaks            []float64 `json:"peaks"`                  // Linear, 1.0 is full scale
+	ClipBuckets      []int     `json:"clip_buckets,omitempty"` // Buckets containing a clipped sample
+}
+
+// peakRecorder builds a PeakHistory from the samples of a take
+type peakRecorder struct {
+	sampleRate int
+	channels   int
+	armed      []int // 0-based input channels measured, nil for all
+
+	mutex   sync.Mutex
+	history PeakHistory
+	clipped []bool
+	frames  int   // Frames in the second being measured
+	peak    int64 // Largest magnitude in the second being measured
+	clip    bool
+	seconds int // Seconds accumulated into the last bucket
+}
+
+func newPeakRecorder(sampleRate, channels int, armed []int) *peakRecorder {
+	return &peakRecorder{
+		sampleRate: sampleRate,
+		channels:   channels,
+		armed:      armed,
+		history:    PeakHistory{SecondsPerBucket: 1},
+	}
+}
+
+// Tap measures a block of interleaved input samples. It is a SampleTap.
+func (p *peakRecorder) Tap(block []byte, startFrame int64) {
+	frameSize := p.channels * BitsPerSample / 8
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for off := 0; off+frameSize <= len(block); off += frameSize {
+		frame := block[off : off+frameSize]
+		if p.armed == nil {
+			for ch := 0; ch < p.channels; ch++ {
+				p.measure(frame[ch*4:])
+			}
+		} else {
+			for _, ch := range p.armed {
+				p.measure(frame[ch*4:])
+			}
+		}
+
+		p.frames++
+		if p.frames == p.sampleRate {
+			p.addSecond()
+		}
+	}
+}
+
+// measure folds one 32-bit sample into the current second
+func (p *peakRecorder) measure(sample []byte) {
+	v := int64(int32(binary.LittleEndian.Uint32(sample)))
+	if v < 0 {
+		v = -v
+	}
+	if v > p.peak {
+		p.peak = v
+	}
+	if v >= clipLevel {
+		p.clip = true
+	}
+}
+
+// addSecond closes the current second, adding it to the last bucket or
+// starting a new one. Must be called with p.mutex held.
+func (p *peakRecorder) addSecond() {
+	level := float64(p.peak) / math.MaxInt32
+	h := &p.history
+
+	if p.seconds > 0 && p.seconds < h.SecondsPerBucket {
+		last := len(h.Peaks) - 1
+		h.Peaks[last] = math.Max(h.Peaks[last], level)
+		p.clipped[last] = p.clipped[last] || p.clip
+		p.seconds++
+	} else {
+		if len(h.Peaks) == maxPeakBuckets {
+			p.downsample()
+		}
+		h.Peaks = append(h.Peaks, level)
+		p.clipped = append(p.clipped, p.clip)
+		p.seconds = 1
+	}
+
+	p.frames = 0
+	p.peak = 0
+	p.clip = false
+}
+
+// downsample merges buckets in pairs, doubling the time each one covers.
+// Must be called with p.mutex held.
+func (p *peakRecorder) downsample() {
+	h := &p.history
+	n := len(h.Peaks) / 2
+	for i := 0; i < n; i++ {
+		h.Peaks[i] = math.Max(h.Peaks[2*i], h.Peaks[2*i+1])
+		p.clipped[i] = p.clipped[2*i] || p.clipped[2*i+1]
+	}
+	h.Peaks = h.Peaks[:n]
+	p.clipped = p.clipped[:n]
+	h.SecondsPerBucket *= 2
+}
+
+// History returns the peak history so far, without the partial second
+func (p *peakRecorder) History() *PeakHistory {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h := &PeakHistory{
+		SecondsPerBucket: p.history.SecondsPerBucket,
+		Peaks:            make([]float64, len(p.history.Peaks)),
+	}
+	for i, peak := range p.history.Peaks {
+		h.Peaks[i] = math.Round(peak*1000) / 1000
+		if p.clipped[i] {
+			h.ClipBuckets = append(h.ClipBuckets, i)
+		}
+	}
+	return h
+}
+
+// drawPeakStrip draws a peak history as a strip chart of peakStripWidth
+// columns with its bottom row at y. Columns with a clip are drawn at full
+// brightness.
+func drawPeakStrip(h *PeakHistory, x, y, height int) {
+	if h == nil || len(h.Peaks) == 0 {
+		return
+	}
+
+	clipped := make(map[int]bool, len(h.ClipBuckets))
+	for _, i := range h.ClipBuckets {
+		clipped[i] = true
+	}
+
+	for col := 0; col < peakStripWidth; col++ {
+		// Buckets covered by this column; short takes repeat buckets
+		first := col * len(h.Peaks) / peakStripWidth
+		last := (col + 1) * len(h.Peaks) / peakStripWidth
+		if last <= first {
+			last = first + 1
+		}
+
+		peak := 0.0
+		clip := false
+		for i := first; i < last; i++ {
+			peak = math.Max(peak, h.Peaks[i])
+			clip = clip || clipped[i]
+		}
+
+		rows := 1 // Baseline, so silence is still visible
+		if peak > 0 {
+			db := 20 * math.Log10(peak)
+			if db > peakFloorDB {
+				rows = int(math.Ceil((db - peakFloorDB) / -peakFloorDB * float64(height)))
+			}
+		}
+
+		brightness := byte(6)
+		if clip {
+			brightness = 15
+		}
+		for row := 0; row < rows && row < height; row++ {
+			hwManager.SetPixel(x+col, y-row, brightness)
+		}
+	}
+}
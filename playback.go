@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	playBlockFrames = 4800            // Frames handed to the output at a time
+	playSeekStep    = 5 * time.Second // Encoder detent while playing
+	playPreopen     = time.Second     // How long before a boundary the next part is opened
+)
+
+// partNumber returns a recording's place in its take: 1 for the first file
+// and N for the _partN files written after a failover
+func partNumber(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	suffix := partSuffix.FindString(name)
+	if suffix == "" {
+		return 1
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(suffix, "_part"))
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// sessionOf returns the folder of a recording relative to the record target
+// it is on, so the parts of a take on different targets can be matched
+func sessionOf(path string, roots []string) string {
+	dir := filepath.Dir(path)
+	best := ""
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if (dir == root || strings.HasPrefix(dir, root+string(filepath.Separator))) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" {
+		return dir
+	}
+	rel, _ := filepath.Rel(best, dir)
+	return rel
+}
+
+// resolveTakeParts finds the files of the take that file belongs to among
+// files, in part order. Parts share the take name and session folder but
+// may be on different targets. If two files claim the same part, file
+// itself is preferred, then the first in files.
+func resolveTakeParts(file string, files, roots []string) []string {
+	take, session := takeName(file), sessionOf(file, roots)
+	byPart := map[int]string{partNumber(file): file}
+	for _, f := range files {
+		if strings.ToLower(filepath.Ext(f)) != ".wav" || takeName(f) != take || sessionOf(f, roots) != session {
+			continue
+		}
+		if _, ok := byPart[partNumber(f)]; !ok {
+			byPart[partNumber(f)] = f
+		}
+	}
+
+	numbers := make([]int, 0, len(byPart))
+	for n := range byPart {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = byPart[n]
+	}
+	return parts
+}
+
+// takeParts returns the files of the take file belongs to, in order. The
+// take sidecar is trusted when every file it lists is still there;
+// otherwise the parts are matched by name across the record targets.
+func takeParts(file string) []string {
+	if take, err := readTakeInfo(file); err == nil && len(take.Files) > 0 {
+		complete := true
+		for _, f := range take.Files {
+			if _, err := os.Stat(f); err != nil {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return take.Files
+		}
+	}
+	return resolveTakeParts(file, allRecordings(recordTargets), targetPaths())
+}
+
+// playPart is one file of the take being played
+type playPart struct {
+	path   string
+	offset int64 // Start of the sample data
+	frames int64
+	file   *os.File // Opened when first needed
+}
+
+// Player plays the parts of a take through a Monitor as one continuous
+// stream. Blocks that cross a part boundary are filled from both files and
+// the next file is opened before it is needed, so there is no gap.
+type Player struct {
+	take       string
+	parts      []*playPart
+	sampleRate int
+	frameSize  int
+	total      int64 // Frames in every part
+	out        *Monitor
+
+	stop    chan struct{}
+	done    chan struct{}
+	outOnce sync.Once
+
+	mutex    sync.Mutex
+	position int64 // Next frame handed to the output
+}
+
+// player is the take being played, if any
+var player *Player
+
+// newPlayer starts playing files, in order, on device. Parts that are not in
+// the first part's format are skipped.
+func newPlayer(files []string, device string, source, gain int) (*Player, error) {
+	p := &Player{take: takeName(files[0]), stop: make(chan struct{}), done: make(chan struct{})}
+	var first *WAVInfo
+	for _, path := range files {
+		info, err := readWAVInfo(path)
+		if err != nil {
+			log.Printf("Playback: skipping %s: %v", path, err)
+			continue
+		}
+		if info.Bits != BitsPerSample {
+			log.Printf("Playback: skipping %s: %d-bit", path, info.Bits)
+			continue
+		}
+		if first == nil {
+			first = info
+		} else if info.SampleRate != first.SampleRate || info.Channels != first.Channels {
+			log.Printf("Playback: skipping %s: %dHz %dch does not match the take", path, info.SampleRate, info.Channels)
+			continue
+		}
+
+		// A take cut short may have a header that overstates the data
+		frameSize := info.Channels * info.Bits / 8
+		dataBytes := info.DataBytes
+		if stat, err := os.Stat(path); err == nil {
+			dataBytes = min(dataBytes, stat.Size()-info.DataOffset)
+		}
+		part := &playPart{path: path, offset: info.DataOffset, frames: dataBytes / int64(frameSize)}
+		p.parts = append(p.parts, part)
+		p.total += part.frames
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no playable files in %s", p.take)
+	}
+	p.sampleRate = first.SampleRate
+	p.frameSize = first.Channels * BitsPerSample / 8
+
+	if source == 0 || 2*source-1 > first.Channels {
+		source = monitorMix
+	}
+	out, err := newMonitor(device, first.SampleRate, first.Channels, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	out.SetGain(gain)
+	p.out = out
+
+	log.Printf("Playing %s: %d parts, %s", p.take, len(p.parts), formatDuration(p.Duration()))
+	go p.run()
+	return p, nil
+}
+
+// run hands blocks to the output until the end of the take or Close
+func (p *Player) run() {
+	defer close(p.done)
+	defer p.closeFiles()
+
+	buf := make([]byte, playBlockFrames*p.frameSize)
+	for {
+		p.mutex.Lock()
+		pos := p.position
+		p.mutex.Unlock()
+		if pos >= p.total {
+			return
+		}
+
+		n, err := p.readAt(buf, pos)
+		if err != nil {
+			log.Printf("Playback of %s stopped: %v", p.take, err)
+			return
+		}
+		p.preopen(pos + int64(n))
+		if !p.out.Feed(buf[:n*p.frameSize], p.stop) {
+			return
+		}
+
+		// A seek while the block was queued wins
+		p.mutex.Lock()
+		if p.position == pos {
+			p.position = pos + int64(n)
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// locate returns the part holding frame pos of the take and the frame
+// within it, or nil past the end
+func (p *Player) locate(pos int64) (*playPart, int64) {
+	for _, part := range p.parts {
+		if pos < part.frames {
+			return part, pos
+		}
+		pos -= part.frames
+	}
+	return nil, 0
+}
+
+// readAt fills buf with frames of the take from pos, continuing into the
+// following parts, and returns the number of frames read
+func (p *Player) readAt(buf []byte, pos int64) (int, error) {
+	want := len(buf) / p.frameSize
+	frames := 0
+	for frames < want {
+		part, offset := p.locate(pos + int64(frames))
+		if part == nil {
+			break
+		}
+		f, err := part.open()
+		if err != nil {
+			return frames, err
+		}
+		n := int(min(int64(want-frames), part.frames-offset))
+		chunk := buf[frames*p.frameSize : (frames+n)*p.frameSize]
+		if _, err := f.ReadAt(chunk, part.offset+offset*int64(p.frameSize)); err != nil && err != io.EOF {
+			return frames, err
+		}
+		frames += n
+	}
+	return frames, nil
+}
+
+// preopen opens the part after the one holding pos once pos is close to its
+// end, so switching files costs nothing at the boundary
+func (p *Player) preopen(pos int64) {
+	part, offset := p.locate(pos)
+	if part == nil || part.frames-offset > int64(playPreopen.Seconds()*float64(p.sampleRate)) {
+		return
+	}
+	if next, _ := p.locate(pos + part.frames - offset); next != nil {
+		if _, err := next.open(); err != nil {
+			log.Printf("Playback: failed to open %s: %v", next.path, err)
+		}
+	}
+}
+
+// open returns the part's file, opening it the first time
+func (part *playPart) open() (*os.File, error) {
+	if part.file == nil {
+		f, err := os.Open(part.path)
+		if err != nil {
+			return nil, err
+		}
+		part.file = f
+	}
+	return part.file, nil
+}
+
+// closeFiles closes every part opened
+func (p *Player) closeFiles() {
+	for _, part := range p.parts {
+		if part.file != nil {
+			part.file.Close()
+		}
+	}
+}
+
+// Seek moves playback by d, within the take
+func (p *Player) Seek(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.position += int64(d.Seconds() * float64(p.sampleRate))
+	p.position = max(0, min(p.position, p.total))
+}
+
+// Position returns how far into the take playback is
+func (p *Player) Position() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return time.Duration(p.position * int64(time.Second) / int64(p.sampleRate))
+}
+
+// Duration returns the length of the whole take
+func (p *Player) Duration() time.Duration {
+	return time.Duration(p.total * int64(time.Second) / int64(p.sampleRate))
+}
+
+// Part returns the 1-based part being played and the number of parts
+func (p *Player) Part() (int, int) {
+	p.mutex.Lock()
+	pos := p.position
+	p.mutex.Unlock()
+	for i, part := range p.parts {
+		if pos < part.frames {
+			return i + 1, len(p.parts)
+		}
+		pos -= part.frames
+	}
+	return len(p.parts), len(p.parts)
+}
+
+// Done is closed when playback ends
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// stopOutput closes the output once queued audio has played, however
+// playback ended
+func (p *Player) stopOutput() {
+	p.outOnce.Do(p.out.Stop)
+}
+
+// Close stops playback at once. It must be called only once.
+func (p *Player) Close() {
+	close(p.stop)
+	<-p.done
+	p.out.Kill()
+	p.stopOutput()
+}
+
+// playbackDevice is the monitor output, or the first output if none is chosen
+func playbackDevice() string {
+	if monitorDevice != "" {
+		return monitorDevice
+	}
+	if devices := listOutputDevices(); len(devices) > 0 {
+		return devices[0].ID
+	}
+	return ""
+}
+
+// startPlayback plays the take file belongs to from its start. Must be
+// called with mutex held.
+func startPlayback(file string) {
+	if reason := dependencyReason(depMonitor); reason != "" {
+		showAlert(reason, 3*time.Second)
+		return
+	}
+	device := playbackDevice()
+	if device == "" {
+		showAlert(i18n.T("alert.no_output"), 3*time.Second)
+		return
+	}
+
+	stopPlayback()
+	p, err := newPlayer(takeParts(file), device, monitorSource, monitorGain())
+	if err != nil {
+		setLastError("Failed to play %s: %v", file, err)
+		showAlert(i18n.Tf("alert.play_failed", err), 5*time.Second)
+		return
+	}
+	player = p
+	currentState = StatePlayback
+
+	// At the end of the take, let the last blocks play out before leaving
+	go func() {
+		<-p.Done()
+		p.stopOutput()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if player == p {
+			player = nil
+			if currentState == StatePlayback {
+				currentState = StateFileDetails
+			}
+		}
+	}()
+}
+
+// stopPlayback ends playback, if any. Must be called with mutex held.
+func stopPlayback() {
+	if player != nil {
+		player.Close()
+		player = nil
+	}
+}
+
+// playbackText shows the position in the take and, for a take in several
+// parts, which part is playing
+func playbackText() (string, string) {
+	if player == nil {
+		return "", ""
+	}
+	position := fmt.Sprintf("%s / %s", formatDuration(player.Position()), formatDuration(player.Duration()))
+	part, parts := player.Part()
+	if parts == 1 {
+		return position, ""
+	}
+	return position, i18n.Tf("play.part", part, parts)
+}
+
+// renderPlayback shows the progress through the take being played
+func renderPlayback() {
+	if player == nil {
+		return
+	}
+	position, part := playbackText()
+	progress := 0.0
+	if total := player.Duration(); total > 0 {
+		progress = float64(player.Position()) / float64(total) * 100
+	}
+	hwManager.DrawProgressBar(player.take, progress, strings.TrimSpace(position+"  "+part))
+}
+
+// renderLargePlayback shows the position and part in the large font
+func renderLargePlayback() {
+	position, part := playbackText()
+	drawLargeLines(position, part)
+}
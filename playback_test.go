@@ -0,0 +1,112 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPartNumber(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/rec/take.wav", 1},
+		{"/rec/take_part2.wav", 2},
+		{"/rec/take_part10.WAV", 10},
+		{"/rec/take_part02.wav", 2},
+		{"/rec/take_part.wav", 1},
+		{"/rec/take_party2.wav", 1},
+		{"/rec/take_part2_part3.wav", 3},
+		{"/rec/take_part2.wav.partial", 1},
+	}
+	for _, tt := range tests {
+		if got := partNumber(tt.path); got != tt.want {
+			t.Errorf("partNumber(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestResolveTakeParts(t *testing.T) {
+	roots := []string{"/mnt/ssd", "/mnt/usb"}
+	tests := []struct {
+		name  string
+		file  string
+		files []string
+		roots []string
+		want  []string
+	}{
+		{
+			name:  "numeric order",
+			file:  "/mnt/ssd/s1/take.wav",
+			files: []string{"/mnt/ssd/s1/take_part10.wav", "/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/s1/take.wav", "/mnt/ssd/s1/take_part3.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/s1/take_part3.wav", "/mnt/ssd/s1/take_part10.wav"},
+		},
+		{
+			name:  "from a later part",
+			file:  "/mnt/ssd/s1/take_part3.wav",
+			files: []string{"/mnt/ssd/s1/take_part3.wav", "/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/s1/take.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/s1/take_part3.wav"},
+		},
+		{
+			name:  "parts on another target",
+			file:  "/mnt/ssd/s1/take.wav",
+			files: []string{"/mnt/ssd/s1/take.wav", "/mnt/usb/s1/take_part2.wav", "/mnt/usb/s2/take_part3.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/usb/s1/take_part2.wav"},
+		},
+		{
+			name: "names that only look alike",
+			file: "/mnt/ssd/s1/take.wav",
+			files: []string{
+				"/mnt/ssd/s1/take_2.wav", "/mnt/ssd/s1/take_part.wav", "/mnt/ssd/s1/take_party3.wav",
+				"/mnt/ssd/s1/take_part2_part4.wav", "/mnt/ssd/s1/retake_part2.wav", "/mnt/ssd/s1/take_part2.wav",
+			},
+			want: []string{"/mnt/ssd/s1/take.wav", "/mnt/ssd/s1/take_part2.wav"},
+		},
+		{
+			name:  "files that are not audio",
+			file:  "/mnt/ssd/s1/take.wav",
+			files: []string{"/mnt/ssd/s1/take.json", "/mnt/ssd/s1/take_part2.WAV", "/mnt/ssd/s1/take_part3.wav.partial", "/mnt/ssd/s1/take_part4.peaks"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/ssd/s1/take_part2.WAV"},
+		},
+		{
+			name:  "the file wins a duplicate part",
+			file:  "/mnt/usb/s1/take_part2.wav",
+			files: []string{"/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/s1/take.wav", "/mnt/usb/s1/take_part2.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/usb/s1/take_part2.wav"},
+		},
+		{
+			name:  "otherwise the first listed",
+			file:  "/mnt/ssd/s1/take.wav",
+			files: []string{"/mnt/usb/s1/take_part02.wav", "/mnt/ssd/s1/take_part2.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav", "/mnt/usb/s1/take_part02.wav"},
+		},
+		{
+			name:  "a target that only starts like another",
+			file:  "/mnt/ssd/s1/take.wav",
+			files: []string{"/mnt/ssd2/s1/take_part2.wav"},
+			want:  []string{"/mnt/ssd/s1/take.wav"},
+		},
+		{
+			name:  "nested targets",
+			file:  "/mnt/ssd/backup/s1/take.wav",
+			files: []string{"/mnt/ssd/s1/take_part2.wav", "/mnt/ssd/backup/take_part3.wav"},
+			roots: []string{"/mnt/ssd", "/mnt/ssd/backup"},
+			want:  []string{"/mnt/ssd/backup/s1/take.wav", "/mnt/ssd/s1/take_part2.wav"},
+		},
+		{
+			name:  "outside every target",
+			file:  "/tmp/x/take.wav",
+			files: []string{"/tmp/x/take_part2.wav", "/tmp/y/take_part3.wav"},
+			want:  []string{"/tmp/x/take.wav", "/tmp/x/take_part2.wav"},
+		},
+	}
+	for _, tt := range tests {
+		r := roots
+		if tt.roots != nil {
+			r = tt.roots
+		}
+		if got := resolveTakeParts(tt.file, tt.files, r); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+	"pi9696/status"
+)
+
+const (
+	powerPollInterval = 5 * time.Second
+	// powerCutReadings is how many readings in a row must be at or below the
+	// shutdown voltage before the unit halts, so one noisy sample under load
+	// does not end a take
+	powerCutReadings = 2
+)
+
+var (
+	// Battery state has its own lock as the status writer reads it outside
+	// the UI mutex
+	power      *hardware.PowerReading // Nil without a fuel gauge
+	powerMutex sync.Mutex
+)
+
+// powerReading returns the latest battery reading, or nil without a gauge
+func powerReading() *hardware.PowerReading {
+	powerMutex.Lock()
+	defer powerMutex.Unlock()
+	if power == nil {
+		return nil
+	}
+	r := *power
+	return &r
+}
+
+// startPowerMonitor looks for the configured fuel gauge and watches it. Units
+// without one carry on without battery status.
+func startPowerMonitor() {
+	cfg := config.Power
+	if cfg.Chip == "" {
+		return
+	}
+	pm, err := hardware.NewPowerMonitor(hardware.PowerConfig{
+		Chip:       cfg.Chip,
+		Bus:        cfg.Bus,
+		Address:    cfg.Address,
+		EmptyVolts: cfg.EmptyVolts,
+		FullVolts:  cfg.FullVolts,
+		ShuntOhms:  cfg.ShuntOhms,
+	})
+	if err != nil {
+		log.Printf("No battery gauge found, battery status disabled: %v", err)
+		return
+	}
+	log.Printf("Battery gauge %s found", cfg.Chip)
+	go powerLoop(pm)
+}
+
+// powerLoop polls the gauge, warns as the charge crosses each threshold and
+// halts the unit before the UPS cuts the power
+func powerLoop(pm *hardware.PowerMonitor) {
+	warnAt := append([]int(nil), config.Power.WarnPercent...)
+	sort.Sort(sort.Reverse(sort.IntSlice(warnAt)))
+	warned := 0 // Thresholds already warned about, highest first
+	low := 0
+	failures := 0
+
+	ticker := time.NewTicker(powerPollInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		reading, err := pm.Read()
+		if err != nil {
+			if failures++; failures == 1 {
+				log.Printf("Failed to read battery gauge: %v", err)
+			}
+			continue
+		}
+		failures = 0
+
+		powerMutex.Lock()
+		power = &reading
+		powerMutex.Unlock()
+
+		if reading.Charging {
+			warned, low = 0, 0
+			continue
+		}
+
+		crossed := warned
+		for crossed < len(warnAt) && reading.Percent <= warnAt[crossed] {
+			crossed++
+		}
+		if crossed > warned {
+			warned = crossed
+			log.Printf("Battery low: %d%% (%.2fV)", reading.Percent, reading.Volts)
+			showAlert(i18n.Tf("alert.battery_low", reading.Percent), 10*time.Second)
+		}
+
+		if reading.Volts > config.Power.ShutdownVolts {
+			low = 0
+			continue
+		}
+		if low++; low >= powerCutReadings {
+			powerCut(reading)
+			return
+		}
+	}
+}
+
+// powerCut ends any take cleanly and halts before the battery gives out
+func powerCut(reading hardware.PowerReading) {
+	mutex.Lock()
+	setLastError("Battery at %.2fV, shutting down", reading.Volts)
+	if isRecording || startingRecorder != nil {
+		stopRecording()
+	}
+	showAlert(i18n.T("alert.battery_shutdown"), time.Minute)
+	settings := currentSettings()
+	mutex.Unlock()
+	flushSettings(settings)
+
+	// Let the banner reach the display before halting
+	time.Sleep(2 * time.Second)
+	if err := exec.Command("sudo", "shutdown", "-h", "now").Run(); err != nil {
+		setLastError("Failed to shut down: %v", err)
+	}
+}
+
+// powerStatusElements returns the battery icon when a gauge is fitted
+func powerStatusElements() []hardware.StatusElement {
+	r := powerReading()
+	if r == nil {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.BatteryStatusElement(r.Percent, r.Charging)}
+}
+
+// powerStatus converts the battery reading for the status file
+func powerStatus() *status.Power {
+	r := powerReading()
+	if r == nil {
+		return nil
+	}
+	return &status.Power{Percent: r.Percent, Volts: r.Volts, Charging: r.Charging}
+}
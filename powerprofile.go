@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+const (
+	// powerMeasureSettle is how long each profile runs before its current
+	// is measured
+	powerMeasureSettle = 15 * time.Second
+	// powerMeasureSamples is how many gauge readings are averaged for each
+	// profile, one every powerPollInterval
+	powerMeasureSamples = 12
+)
+
+// powerProfileNames lists the power profiles from fastest to most frugal
+var powerProfileNames = []string{"performance", "balanced", "power_save"}
+
+var (
+	// Read by the render and USB loops without the mutex
+	renderInterval  atomic.Int64 // Nanoseconds between frames
+	usbPollInterval atomic.Int64 // Nanoseconds between USB drive checks
+
+	powerProfile   string // Active profile, set by applyPowerProfile
+	measuringPower = false
+)
+
+// validPowerProfile reports whether name is a power profile
+func validPowerProfile(name string) bool {
+	for _, n := range powerProfileNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// profile returns the values of the named profile, or of performance for an
+// unknown name
+func (c PowerProfilesConfig) profile(name string) PowerProfileConfig {
+	switch name {
+	case "balanced":
+		return c.Balanced
+	case "power_save":
+		return c.PowerSave
+	}
+	return c.Performance
+}
+
+// validate checks a profile's values are ones the hardware can run at
+func (p PowerProfileConfig) validate() error {
+	switch {
+	case p.RenderMs < 20 || p.RenderMs > 1000:
+		return fmt.Errorf("render_ms must be 20 to 1000")
+	case p.EncoderPollMs < 1 || p.EncoderPollMs > 20:
+		return fmt.Errorf("encoder_poll_ms must be 1 to 20")
+	case p.ButtonPollMs < 1 || p.ButtonPollMs > 50:
+		return fmt.Errorf("button_poll_ms must be 1 to 50")
+	case p.USBPollMs < 100 || p.USBPollMs > 60000:
+		return fmt.Errorf("usb_poll_ms must be 100 to 60000")
+	case p.BrightnessPercent < 10 || p.BrightnessPercent > 100:
+		return fmt.Errorf("brightness_percent must be 10 to 100")
+	case p.BackgroundMBPerSec < 0:
+		return fmt.Errorf("background_mb_per_sec must not be negative")
+	}
+	return nil
+}
+
+// backgroundRate returns the tighter of the background I/O limit and the
+// profile's cap, where 0 means no limit
+func backgroundRate(limit, profileCap float64) float64 {
+	if limit == 0 || (profileCap > 0 && profileCap < limit) {
+		return profileCap
+	}
+	return limit
+}
+
+// applyPowerProfile switches the poll rates, render tick, brightness cap and
+// background throttle to the named profile. It takes effect on the next tick
+// of each loop. Must be called with mutex held.
+func applyPowerProfile(name string) {
+	p := config.PowerProfiles.profile(name)
+	powerProfile = name
+	renderInterval.Store(int64(time.Duration(p.RenderMs) * time.Millisecond))
+	usbPollInterval.Store(int64(time.Duration(p.USBPollMs) * time.Millisecond))
+	hwManager.SetPollIntervals(time.Duration(p.EncoderPollMs)*time.Millisecond, time.Duration(p.ButtonPollMs)*time.Millisecond)
+	if err := hwManager.SetBrightness(p.BrightnessPercent); err != nil && !errors.Is(err, hardware.ErrDisplayOffline) {
+		log.Printf("Failed to set display brightness: %v", err)
+	}
+	backgroundIO.SetRate(backgroundRate(config.BackgroundIO.MBPerSec, p.BackgroundMBPerSec))
+	log.Printf("Power profile %s: render %dms, encoder %dms, buttons %dms, USB %dms, brightness %d%%",
+		name, p.RenderMs, p.EncoderPollMs, p.ButtonPollMs, p.USBPollMs, p.BrightnessPercent)
+}
+
+// adjustPowerProfile steps through the power profiles. Must be called with
+// mutex held.
+func adjustPowerProfile(direction int) {
+	idx := 0
+	for i, name := range powerProfileNames {
+		if name == powerProfile {
+			idx = i
+		}
+	}
+	idx = (idx + direction + len(powerProfileNames)) % len(powerProfileNames)
+	applyPowerProfile(powerProfileNames[idx])
+}
+
+// powerProfileText names the active power profile
+func powerProfileText() string {
+	return i18n.T("power_profile." + powerProfile)
+}
+
+// startPowerMeasurement runs each power profile in turn with the unit left
+// idle and logs the battery current each draws, then goes back to the
+// profile in use. It needs a gauge that measures current and the unit on
+// battery. Must be called with mutex held.
+func startPowerMeasurement() {
+	if measuringPower {
+		return
+	}
+	if config.Power.Chip != hardware.ChipINA219 || powerReading() == nil {
+		showAlert(i18n.T("power_profile.no_current"), 5*time.Second)
+		return
+	}
+	measuringPower = true
+	currentState = StateIdle
+	showAlert(i18n.T("power_profile.measuring"), 5*time.Second)
+	go measurePowerProfiles(powerProfile)
+}
+
+// measurePowerProfiles measures the idle current of each profile and logs
+// how much each saves over performance. Readings taken while charging are
+// skipped, and a take or use of the controls stops the measurement.
+func measurePowerProfiles(restore string) {
+	started := time.Now()
+	results := make(map[string]float64)
+	var aborted string
+
+	stopped := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case isRecording:
+			aborted = "recording started"
+		case lastInput.After(started):
+			aborted = "controls in use"
+		}
+		return aborted != ""
+	}
+
+measure:
+	for _, name := range powerProfileNames {
+		mutex.Lock()
+		applyPowerProfile(name)
+		mutex.Unlock()
+
+		time.Sleep(powerMeasureSettle)
+		var sum float64
+		n := 0
+		for i := 0; i < powerMeasureSamples; i++ {
+			if stopped() {
+				break measure
+			}
+			if r := powerReading(); r != nil && !r.Charging {
+				sum -= r.Amps
+				n++
+			}
+			time.Sleep(powerPollInterval)
+		}
+		if n == 0 {
+			log.Printf("Power measurement: %s: no readings on battery", name)
+			continue
+		}
+		results[name] = sum / float64(n)
+		log.Printf("Power measurement: %s draws %.0fmA at idle (%d readings)", name, results[name]*1000, n)
+	}
+
+	var summary []string
+	if base, ok := results["performance"]; ok && aborted == "" {
+		for _, name := range powerProfileNames[1:] {
+			if amps, ok := results[name]; ok {
+				saved := base - amps
+				log.Printf("Power measurement: %s saves %.0fmA (%.0f%%) over performance at idle",
+					name, saved*1000, saved/base*100)
+			}
+		}
+	}
+	for _, name := range powerProfileNames {
+		if amps, ok := results[name]; ok {
+			summary = append(summary, fmt.Sprintf("%s %.0fmA", i18n.T("power_profile."+name), amps*1000))
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	measuringPower = false
+	applyPowerProfile(restore)
+	switch {
+	case aborted != "":
+		log.Printf("Power measurement: stopped, %s", aborted)
+		showAlert(i18n.T("power_profile.measure_stopped"), 5*time.Second)
+	case len(summary) == 0:
+		showAlert(i18n.T("power_profile.no_current"), 5*time.Second)
+	default:
+		showAlert(strings.Join(summary, ", "), 10*time.Second)
+	}
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+	"pi9696/mqtt"
+)
+
+const (
+	streamProbeDuration = 2 * time.Second  // Audio measured by the stream probe
+	streamProbeDeadline = 5 * time.Second  // Longest the probe holds the input
+	rateTolerance       = 0.05             // Allowed error in the measured sample rate
+	benchmarkSize       = 32 * 1024 * 1024 // Bytes written by the write-speed check
+	benchmarkMargin     = 2.0              // Required multiple of the recording data rate
+)
+
+// checkState is the progress of a preflight check
+type checkState int
+
+const (
+	checkPending checkState = iota
+	checkPass
+	checkFail
+)
+
+func (s checkState) String() string {
+	switch s {
+	case checkPass:
+		return "pass"
+	case checkFail:
+		return "fail"
+	}
+	return "pending"
+}
+
+// preflightCheck is one item on the preflight checklist. run returns a detail
+// to show on success; its error is shown on failure.
+type preflightCheck struct {
+	id      string
+	timeout time.Duration
+	run     func(ctx context.Context) (string, error)
+}
+
+// checkResult is the outcome of a preflight check
+type checkResult struct {
+	ID     string
+	State  checkState
+	Detail string
+}
+
+// preflightRun is one run of the preflight checks. Each check runs on its
+// own goroutine and fails independently when it times out.
+type preflightRun struct {
+	mutex    sync.Mutex
+	started  time.Time
+	finished time.Time
+	results  []checkResult
+}
+
+var (
+	preflight       *preflightRun // Latest run, nil until the first
+	preflightReturn int           // Settings item to return to
+	streamProbing   = false       // The stream probe holds the input
+)
+
+// startPreflight runs every check for the current settings, unless a run is
+// already in progress. Must be called with mutex held.
+func startPreflight() {
+	if preflight != nil && preflight.Running() {
+		return
+	}
+
+	sampleRate := sampleRates[sampleRateIdx]
+	channels := channelCount
+	armed := armedChannelIndexes()
+	if armed == nil {
+		for ch := 0; ch < channels; ch++ {
+			armed = append(armed, ch)
+		}
+	}
+	bytesPerSec := float64(sampleRate * recordedChannelCount() * BitsPerSample / 8)
+	minRemaining := time.Duration(config.PreflightMinMinutes) * time.Minute
+
+	probe := newStreamProbe(sampleRate, channels, armed)
+	checks := []preflightCheck{
+		{"stream", streamProbeDeadline + time.Second, probe.checkStream},
+		{"channels", streamProbeDeadline + time.Second, probe.checkChannels},
+		{"clock", 3 * time.Second, checkClock},
+		{"storage", 3 * time.Second, func(ctx context.Context) (string, error) {
+			return checkStorage(bytesPerSec, minRemaining)
+		}},
+		{"write_speed", 15 * time.Second, func(ctx context.Context) (string, error) {
+			return checkWriteSpeed(ctx, bytesPerSec)
+		}},
+		{"network", 5 * time.Second, func(ctx context.Context) (string, error) {
+			return checkNetwork(ctx, hwManager.GetNetworkInfo, config.MQTT.Broker)
+		}},
+	}
+	if usbNeeded(config.Backup.Path, recordTargets) {
+		checks = append(checks, preflightCheck{"usb", 3 * time.Second, checkUSB})
+	}
+
+	run := &preflightRun{started: time.Now()}
+	for _, check := range checks {
+		run.results = append(run.results, checkResult{ID: check.id})
+	}
+	preflight = run
+
+	log.Printf("Preflight started at %dHz, %d channels", sampleRate, channels)
+	go probe.run()
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check preflightCheck) {
+			defer wg.Done()
+			run.runCheck(i, check)
+		}(i, check)
+	}
+	go func() {
+		wg.Wait()
+		run.finish()
+	}()
+}
+
+// runCheck runs a single check, failing it if it does not finish in time
+func (p *preflightRun) runCheck(i int, check preflightCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), check.timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = fmt.Errorf("%s", i18n.T("preflight.timed_out"))
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if result.err != nil {
+		p.results[i].State = checkFail
+		p.results[i].Detail = result.err.Error()
+	} else {
+		p.results[i].State = checkPass
+		p.results[i].Detail = result.detail
+	}
+}
+
+// finish marks the run complete and logs the results
+func (p *preflightRun) finish() {
+	p.mutex.Lock()
+	p.finished = time.Now()
+	p.mutex.Unlock()
+
+	results := p.Results()
+	verdict := "PASS"
+	if !p.Passed() {
+		verdict = "FAIL"
+	}
+	log.Printf("Preflight %s", verdict)
+	for _, r := range results {
+		log.Printf("  %-12s %-7s %s", r.ID, r.State, r.Detail)
+	}
+}
+
+// Results returns a copy of the check results
+func (p *preflightRun) Results() []checkResult {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]checkResult(nil), p.results...)
+}
+
+// Running reports whether any check is still pending
+func (p *preflightRun) Running() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.finished.IsZero()
+}
+
+// Passed reports whether the run has finished with every check passing
+func (p *preflightRun) Passed() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.finished.IsZero() {
+		return false
+	}
+	for _, r := range p.results {
+		if r.State != checkPass {
+			return false
+		}
+	}
+	return true
+}
+
+// Times returns when the run started and finished; finished is zero while running
+func (p *preflightRun) Times() (started, finished time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.started, p.finished
+}
+
+// streamProbe captures a few seconds of audio to measure the incoming stream.
+// The stream and channel checks both wait on it.
+type streamProbe struct {
+	sampleRate int
+	channels   int
+	armed      []int // 0-based input channels expected to carry signal
+
+	done     chan struct{}
+	measured float64 // Sample rate measured from the arrival of audio
+	frames   int64
+	signal   []bool // Per armed channel, whether any non-zero sample arrived
+	err      error
+}
+
+func newStreamProbe(sampleRate, channels int, armed []int) *streamProbe {
+	return &streamProbe{
+		sampleRate: sampleRate,
+		channels:   channels,
+		armed:      armed,
+		done:       make(chan struct{}),
+		signal:     make([]bool, len(armed)),
+	}
+}
+
+// run takes the input from the input monitor for the length of the probe
+func (p *streamProbe) run() {
+	defer close(p.done)
+
+	mutex.Lock()
+	if isRecording {
+		mutex.Unlock()
+		p.err = fmt.Errorf("recording in progress")
+		return
+	}
+	streamProbing = true
+	stopInputMonitor()
+	mutex.Unlock()
+
+	defer func() {
+		mutex.Lock()
+		streamProbing = false
+		mutex.Unlock()
+	}()
+
+	cmd, source, err := startCapture(p.sampleRate, p.channels)
+	if err != nil {
+		p.err = err
+		return
+	}
+	deadline := time.AfterFunc(streamProbeDeadline, func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+	})
+	defer func() {
+		deadline.Stop()
+		cmd.Process.Signal(syscall.SIGTERM)
+		cmd.Wait()
+	}()
+
+	frameSize := p.channels * BitsPerSample / 8
+	buf := make([]byte, recordBlockFrames*frameSize)
+	var first time.Time
+	var firstFrames int64
+	for {
+		n, err := io.ReadFull(source, buf)
+		n -= n % frameSize
+		if n > 0 {
+			p.scan(buf[:n], frameSize)
+			p.frames += int64(n / frameSize)
+
+			// Time the stream from the end of the first block so pipe
+			// buffering at startup does not inflate the rate
+			if first.IsZero() {
+				first = time.Now()
+				firstFrames = p.frames
+			} else if elapsed := time.Since(first); elapsed >= streamProbeDuration {
+				p.measured = float64(p.frames-firstFrames) / elapsed.Seconds()
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// scan notes which armed channels carry a non-zero sample
+func (p *streamProbe) scan(block []byte, frameSize int) {
+	for i, ch := range p.armed {
+		if p.signal[i] {
+			continue
+		}
+		for off := ch * 4; off < len(block); off += frameSize {
+			if block[off]|block[off+1]|block[off+2]|block[off+3] != 0 {
+				p.signal[i] = true
+				break
+			}
+		}
+	}
+}
+
+// wait blocks until the probe has finished or ctx expires
+func (p *streamProbe) wait(ctx context.Context) error {
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkStream passes if audio arrives at the configured sample rate
+func (p *streamProbe) checkStream(ctx context.Context) (string, error) {
+	if err := p.wait(ctx); err != nil {
+		return "", err
+	}
+	if p.measured == 0 {
+		return "", fmt.Errorf("%s", i18n.T("preflight.no_audio"))
+	}
+	rate := int(p.measured + 0.5)
+	if p.measured < float64(p.sampleRate)*(1-rateTolerance) || p.measured > float64(p.sampleRate)*(1+rateTolerance) {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.rate_mismatch", rate, p.sampleRate))
+	}
+	return fmt.Sprintf("%d Hz", p.sampleRate), nil
+}
+
+// checkChannels passes if every armed channel carried signal. Unsubscribed
+// channels arrive as digital silence.
+func (p *streamProbe) checkChannels(ctx context.Context) (string, error) {
+	if err := p.wait(ctx); err != nil {
+		return "", err
+	}
+	if p.frames == 0 {
+		return "", fmt.Errorf("%s", i18n.T("preflight.no_audio"))
+	}
+	var silent []string
+	for i, ch := range p.armed {
+		if !p.signal[i] {
+			silent = append(silent, fmt.Sprint(ch+1))
+		}
+	}
+	if len(silent) > 0 {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.channels_silent", strings.Join(silent, ",")))
+	}
+	return i18n.Tf("preflight.channels_ok", len(p.armed)), nil
+}
+
+// checkClock passes if the system clock is synchronized
+func checkClock(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "timedatectl", "show", "-p", "NTPSynchronized", "--value").Output()
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(out)) != "yes" {
+		return "", fmt.Errorf("%s", i18n.T("preflight.clock_unsynced"))
+	}
+	return i18n.T("preflight.clock_synced"), nil
+}
+
+// checkStorage passes if there is room for at least minRemaining of recording
+func checkStorage(bytesPerSec float64, minRemaining time.Duration) (string, error) {
+	remaining := time.Duration(float64(totalFreeSpace(recordTargets))/bytesPerSec) * time.Second
+	if remaining < minRemaining {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.storage_low", formatDuration(remaining), formatDuration(minRemaining)))
+	}
+	return i18n.Tf("preflight.storage_ok", formatDuration(remaining)), nil
+}
+
+// checkWriteSpeed writes a scratch file to the first healthy record target
+// and passes if it was written comfortably faster than a take needs
+func checkWriteSpeed(ctx context.Context, bytesPerSec float64) (string, error) {
+	idx, err := pickRecordTarget(recordTargets, 0)
+	if err != nil {
+		return "", err
+	}
+
+	lease, err := resources.TryAcquire(jobBenchmark, recordTargets[idx].Path)
+	if err != nil {
+		return "", fmt.Errorf("%s", busyMessage(err))
+	}
+	defer lease.Release()
+
+	path := filepath.Join(recordTargets[idx].Path, ".pi9696-preflight")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	progress := startBackgroundJob(jobBenchmark, benchmarkSize)
+	defer progress.Finish()
+
+	// The write test is not rate limited, which would skew it, but it still
+	// waits while the recorder is under pressure. Time spent waiting is not
+	// counted.
+	block := make([]byte, 1024*1024)
+	var elapsed time.Duration
+	for written := 0; written < benchmarkSize; written += len(block) {
+		if err := backgroundIO.Wait(ctx, 0); err != nil {
+			return "", err
+		}
+		if lease.Preempted() {
+			return "", fmt.Errorf("%s", i18n.Tf("resource.paused", jobBenchmark.Label()))
+		}
+		start := time.Now()
+		if _, err := f.Write(block); err != nil {
+			return "", err
+		}
+		elapsed += time.Since(start)
+		progress.Add(int64(len(block)))
+	}
+	start := time.Now()
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	elapsed += time.Since(start)
+
+	speed := float64(benchmarkSize) / elapsed.Seconds()
+	const mb = 1024 * 1024
+	if speed < bytesPerSec*benchmarkMargin {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.speed_low", speed/mb, bytesPerSec*benchmarkMargin/mb))
+	}
+	return i18n.Tf("preflight.speed_ok", speed/mb), nil
+}
+
+// usbNeeded reports whether the rolling backup or a record target is on the
+// USB drive, so a take relies on it being there
+func usbNeeded(backupPath string, targets []*RecordTarget) bool {
+	onUSB := func(path string) bool {
+		return path == USBMountPoint || strings.HasPrefix(path, USBMountPoint+"/")
+	}
+	if backupPath != "" && onUSB(backupPath) {
+		return true
+	}
+	for _, t := range targets {
+		if onUSB(t.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUSB passes if the USB drive is mounted
+func checkUSB(ctx context.Context) (string, error) {
+	if _, err := os.Stat(USBMountPoint); err != nil {
+		return "", fmt.Errorf("%s", i18n.T("preflight.usb_missing"))
+	}
+	return i18n.T("preflight.usb_ok"), nil
+}
+
+// checkNetwork passes if the interface Dante arrives on has a link and an
+// address, and the MQTT broker, if one is set, takes a connection
+func checkNetwork(ctx context.Context, networkInfo func() (*hardware.NetworkInfo, error), broker string) (string, error) {
+	info, err := networkInfo()
+	if err != nil {
+		return "", err
+	}
+	if !info.LinkUp {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.network_no_link", info.InterfaceName))
+	}
+	if !info.Connected {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.network_no_address", info.InterfaceName))
+	}
+	if broker == "" {
+		return info.IPAddress, nil
+	}
+
+	addr := strings.TrimPrefix(broker, "tcp://")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, mqtt.DefaultPort)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("%s", i18n.Tf("preflight.broker_unreachable", addr))
+	}
+	conn.Close()
+	return i18n.Tf("preflight.network_broker", info.IPAddress), nil
+}
+
+// openPreflight starts a run and shows the checklist. Must be called with mutex held.
+func openPreflight() {
+	preflightReturn = selectedMenu
+	startPreflight()
+	currentState = StatePreflight
+	menuScrollOffset = 0
+}
+
+// preflightTitle says whether the latest run is still going, passed or failed
+func preflightTitle() string {
+	if preflight == nil || preflight.Running() {
+		return i18n.T("preflight.running")
+	}
+	if preflight.Passed() {
+		return i18n.T("preflight.passed")
+	}
+	return i18n.T("preflight.failed")
+}
+
+// renderPreflight draws the checklist of the latest run
+func renderPreflight() {
+	if preflight == nil {
+		return
+	}
+
+	hwManager.DrawCenteredText(preflightTitle(), "header", 16)
+
+	results := preflight.Results()
+	maxLines := 3
+	if menuScrollOffset > len(results)-maxLines {
+		menuScrollOffset = len(results) - maxLines
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
+
+	y := 28
+	for _, r := range results[menuScrollOffset:] {
+		if y > 48 {
+			break
+		}
+		context := "details"
+		if r.State == checkFail {
+			context = "emphasis"
+		}
+		hwManager.SwitchToContext(context)
+		line := fmt.Sprintf("%-4s %s  %s", i18n.T("preflight.state_"+r.State.String()), i18n.T("preflight.check."+r.ID), r.Detail)
+		hwManager.DrawText(8, y, hwManager.FitText(line, DisplayWidth-24))
+		y += 10
+	}
+
+	// Draw scroll indicators if needed
+	if len(results) > maxLines {
+		hwManager.SwitchToContext("details")
+		if menuScrollOffset > 0 {
+			hwManager.DrawText(240, 28, "↑")
+		}
+		if menuScrollOffset+maxLines < len(results) {
+			hwManager.DrawText(240, 48, "↓")
+		}
+	}
+
+	hwManager.DrawCenteredText(i18n.T("common.click_return"), "details", 58)
+}
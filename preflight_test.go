@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"pi9696/hardware"
+)
+
+func TestUSBNeeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		backup  string
+		targets []string
+		want    bool
+	}{
+		{"internal storage only", "", []string{"/mnt/ssd", "/rec"}, false},
+		{"backup on the drive", filepath.Join(USBMountPoint, "backup"), []string{"/rec"}, true},
+		{"backup elsewhere", "/mnt/ssd/backup", []string{"/rec"}, false},
+		{"target on the drive", "", []string{"/rec", USBMountPoint}, true},
+		{"path that only starts like the drive", "", []string{USBMountPoint + "2"}, false},
+	}
+	for _, tt := range tests {
+		var targets []*RecordTarget
+		for _, path := range tt.targets {
+			targets = append(targets, &RecordTarget{Path: path})
+		}
+		if got := usbNeeded(tt.backup, targets); got != tt.want {
+			t.Errorf("%s: usbNeeded() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+// closedPort returns an address nothing listens on
+func closedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestCheckNetwork(t *testing.T) {
+	broker, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	up := &hardware.NetworkInfo{InterfaceName: "eth0", IPAddress: "192.168.1.20", LinkUp: true, Connected: true}
+	tests := []struct {
+		name   string
+		info   *hardware.NetworkInfo
+		err    error
+		broker string
+		pass   bool
+	}{
+		{"detector error", nil, errors.New("network detector not initialized"), "", false},
+		{"cable out", &hardware.NetworkInfo{InterfaceName: "eth0"}, nil, "", false},
+		{"no DHCP lease", &hardware.NetworkInfo{InterfaceName: "eth0", LinkUp: true}, nil, "", false},
+		{"up without a broker", up, nil, "", true},
+		{"broker listening", up, nil, broker.Addr().String(), true},
+		{"broker down", up, nil, "tcp://" + closedPort(t), false},
+	}
+	for _, tt := range tests {
+		info := func() (*hardware.NetworkInfo, error) { return tt.info, tt.err }
+		detail, err := checkNetwork(context.Background(), info, tt.broker)
+		if pass := err == nil; pass != tt.pass {
+			t.Errorf("%s: passed %t (%q, %v), want %t", tt.name, pass, detail, err, tt.pass)
+		}
+	}
+}
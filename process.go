@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// procSuffix ends the name of a processed copy, before its extension
+const procSuffix = "_PROC"
+
+// processOption is set when "Process" is selected on the summary screen
+var processOption = false
+
+// pcmFormat reads and writes little-endian integer PCM samples of one bit
+// depth
+type pcmFormat struct {
+	bytes int     // Per sample
+	full  float64 // Full scale, 2^(bits-1)
+}
+
+// newPCMFormat returns the sample format of a bit depth the recorder writes
+// or imports
+func newPCMFormat(bits int) (pcmFormat, error) {
+	switch bits {
+	case 16, 24, 32:
+		return pcmFormat{bytes: bits / 8, full: math.Ldexp(1, bits-1)}, nil
+	}
+	return pcmFormat{}, fmt.Errorf("%d-bit samples are not supported", bits)
+}
+
+// sample decodes the sample at the start of b
+func (f pcmFormat) sample(b []byte) int64 {
+	switch f.bytes {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case 3:
+		return int64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8)
+	}
+	return int64(int32(binary.LittleEndian.Uint32(b)))
+}
+
+// put encodes v at the start of b, clipped to the sample range
+func (f pcmFormat) put(b []byte, v int64) {
+	top := int64(f.full) - 1
+	v = min(max(v, -top-1), top)
+	switch f.bytes {
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 3:
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+	default:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	}
+}
+
+// procPart is one file of a take being processed
+type procPart struct {
+	path   string
+	info   *WAVInfo
+	offset int64 // Frames of the take before this file
+	frames int64
+}
+
+// procAnalysis is where a take's sound starts and ends and how loud it gets
+type procAnalysis struct {
+	first, last int64   // First and last frame with a sample at or above the threshold; first is -1 without one
+	peak        float64 // Largest sample, as a fraction of full scale
+}
+
+// procName returns the name of the processed copy of path, beside it
+func procName(path string) string {
+	stem, ext := splitName(filepath.Base(path))
+	return filepath.Join(filepath.Dir(path), stem+procSuffix+ext)
+}
+
+// processed reports whether path is itself a processed copy
+func processed(path string) bool {
+	stem, _ := splitName(filepath.Base(path))
+	return strings.HasSuffix(stem, procSuffix)
+}
+
+// openProcParts reads the format of each file of a take, in order. The
+// files must share a format.
+func openProcParts(files []string) ([]procPart, pcmFormat, error) {
+	var parts []procPart
+	var offset int64
+	for _, file := range files {
+		info, err := readWAVInfo(file)
+		if err != nil {
+			return nil, pcmFormat{}, err
+		}
+		if len(parts) > 0 {
+			if first := parts[0].info; info.SampleRate != first.SampleRate || info.Channels != first.Channels || info.Bits != first.Bits {
+				return nil, pcmFormat{}, fmt.Errorf("%s has a different format from %s", filepath.Base(file), filepath.Base(files[0]))
+			}
+		}
+		if info.Channels <= 0 {
+			return nil, pcmFormat{}, fmt.Errorf("%s has no channels", filepath.Base(file))
+		}
+		frames := info.DataBytes / int64(info.Channels*info.Bits/8)
+		parts = append(parts, procPart{path: file, info: info, offset: offset, frames: frames})
+		offset += frames
+	}
+	if len(parts) == 0 {
+		return nil, pcmFormat{}, fmt.Errorf("no files")
+	}
+	format, err := newPCMFormat(parts[0].info.Bits)
+	return parts, format, err
+}
+
+// eachBlock reads frames from up to to of a part in blocks of whole frames,
+// paced by the background I/O scheduler and stopping at checkpoints while a
+// recording needs the storage. progress, if set, counts the bytes read.
+func eachBlock(ctx context.Context, part procPart, from, to int64, checkpoint func() error, progress *backgroundJob, fn func(block []byte) error) error {
+	f, err := os.Open(part.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	frameSize := int64(part.info.Channels * part.info.Bits / 8)
+	data := io.NewSectionReader(f, part.info.DataOffset+from*frameSize, (to-from)*frameSize)
+	buf := make([]byte, verifyBlockSize/frameSize*frameSize)
+	for {
+		if err := checkpoint(); err != nil {
+			return err
+		}
+		if err := backgroundIO.Wait(ctx, len(buf)); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(data, buf)
+		n -= n % int(frameSize)
+		if progress != nil {
+			progress.Add(int64(n))
+		}
+		if n > 0 {
+			if err := fn(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// analyzeTake finds the first and last frame of a take with a sample at or
+// above threshold, as a fraction of full scale, and its peak
+func analyzeTake(ctx context.Context, parts []procPart, format pcmFormat, threshold float64, checkpoint func() error, progress *backgroundJob) (procAnalysis, error) {
+	a := procAnalysis{first: -1, last: -1}
+	level := threshold * format.full
+	for _, part := range parts {
+		frameSize := part.info.Channels * format.bytes
+		frame := part.offset
+		err := eachBlock(ctx, part, 0, part.frames, checkpoint, progress, func(block []byte) error {
+			for i := 0; i < len(block); i += frameSize {
+				loud := false
+				for j := i; j < i+frameSize; j += format.bytes {
+					v := math.Abs(float64(format.sample(block[j:])))
+					if v >= level {
+						loud = true
+					}
+					a.peak = max(a.peak, v/format.full)
+				}
+				if loud {
+					if a.first < 0 {
+						a.first = frame
+					}
+					a.last = frame
+				}
+				frame++
+			}
+			return nil
+		})
+		if err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// keepRange returns the frames of a take of total frames kept after
+// trimming: from pad frames before its first sound to pad frames after its
+// last
+func keepRange(a procAnalysis, pad, total int64) (start, end int64) {
+	return max(a.first-pad, 0), min(a.last+1+pad, total)
+}
+
+// writeProcessed writes frames from up to to of a part, scaled by gain, as
+// its processed copy. The copy is written under a temporary name and
+// renamed once complete.
+func writeProcessed(ctx context.Context, part procPart, format pcmFormat, from, to int64, gain float64, checkpoint func() error, progress *backgroundJob) (string, error) {
+	dst := procName(part.path)
+	tmp := dst + ".tmp"
+	w, err := createWAV(tmp, part.info.SampleRate, part.info.Channels, part.info.Bits)
+	if err != nil {
+		return "", err
+	}
+	w.bext.Description = "Trimmed and normalized copy of " + filepath.Base(part.path)
+	if part.info.HasBext {
+		w.bext.TimeReference = part.info.TimeReference + uint64(from)
+	}
+
+	err = eachBlock(ctx, part, from, to, checkpoint, progress, func(block []byte) error {
+		for i := 0; i < len(block); i += format.bytes {
+			format.put(block[i:], int64(math.Round(float64(format.sample(block[i:]))*gain)))
+		}
+		_, err := w.Write(block)
+		return err
+	})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		noteWriteError(tmp, "process", err)
+		os.Remove(tmp)
+		return "", err
+	}
+	return dst, nil
+}
+
+// processTake writes a copy of each file of a take with the silence before
+// the first sound and after the last trimmed, padding kept, and the level
+// raised or lowered so the take peaks at the target. Files left with
+// nothing to keep get no copy. The originals are not touched.
+func processTake(ctx context.Context, files []string, cfg ProcessConfig, checkpoint func() error, progress *backgroundJob) ([]string, error) {
+	parts, format, err := openProcParts(files)
+	if err != nil {
+		return nil, err
+	}
+	a, err := analyzeTake(ctx, parts, format, math.Pow(10, cfg.ThresholdDB/20), checkpoint, progress)
+	if err != nil {
+		return nil, err
+	}
+	if a.first < 0 {
+		return nil, fmt.Errorf("no sound above %.0f dBFS", cfg.ThresholdDB)
+	}
+
+	last := parts[len(parts)-1]
+	pad := int64(cfg.PaddingMs) * int64(parts[0].info.SampleRate) / 1000
+	start, end := keepRange(a, pad, last.offset+last.frames)
+	gain := math.Pow(10, cfg.TargetPeakDB/20) / a.peak
+
+	var outputs []string
+	for _, part := range parts {
+		from, to := max(start-part.offset, 0), min(end-part.offset, part.frames)
+		if from >= to {
+			continue
+		}
+		out, err := writeProcessed(ctx, part, format, from, to, gain, checkpoint, progress)
+		if err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// takeFiles returns every file of the take file belongs to, in order, or
+// just file when it has no sidecar
+func takeFiles(file string) []string {
+	if take, err := readTakeInfo(file); err == nil && slices.Contains(take.Files, file) {
+		return append([]string(nil), take.Files...)
+	}
+	return []string{file}
+}
+
+// startProcessing writes processed copies of takes, each given as its
+// files, in the background. It waits for and pauses during recordings.
+func startProcessing(takes [][]string) {
+	cfg := config.Process
+	showAlert(i18n.Tf("process.started", len(takes)), 3*time.Second)
+	go func() {
+		ctx := context.Background()
+		lease, err := resources.Acquire(ctx, jobProcess, func(holder jobKind) {
+			showAlert(i18n.Tf("resource.waiting", holder.Label()), 3*time.Second)
+		}, targetPaths()...)
+		if err != nil {
+			return
+		}
+		defer lease.Release()
+		checkpoint := func() error {
+			return lease.Checkpoint(ctx, func() {
+				showAlert(i18n.Tf("resource.paused", jobProcess.Label()), 3*time.Second)
+			})
+		}
+
+		// Each file is read twice: to analyze it, then to write the copy
+		var total int64
+		for _, files := range takes {
+			total += 2 * totalSize(files)
+		}
+		progress := startBackgroundJob(jobProcess, total)
+		defer progress.Finish()
+
+		failed := 0
+		for _, files := range takes {
+			outputs, err := processTake(ctx, files, cfg, checkpoint, progress)
+			if err != nil {
+				setLastError("Failed to process %s: %v", filepath.Base(files[0]), err)
+				failed++
+				continue
+			}
+			log.Printf("Processed %s into %d files", filepath.Base(files[0]), len(outputs))
+		}
+		if failed > 0 {
+			showAlert(i18n.Tf("process.failed", failed, len(takes)), 5*time.Second)
+		} else {
+			showAlert(i18n.Tf("process.done", len(takes)), 5*time.Second)
+		}
+	}()
+}
+
+// processLastTake processes the take on the summary screen. Must be called
+// with mutex held.
+func processLastTake() {
+	if lastTake == nil || len(lastTake.Files) == 0 {
+		return
+	}
+	startProcessing([][]string{append([]string(nil), lastTake.Files...)})
+}
+
+// processSelected processes the takes of the files selected in the copy
+// list. Processed copies are skipped. Must be called with mutex held.
+func processSelected() {
+	var selected []string
+	for file, on := range filesToCopy {
+		if on && !processed(file) {
+			selected = append(selected, file)
+		}
+	}
+	sort.Strings(selected)
+
+	seen := make(map[string]bool)
+	var takes [][]string
+	for _, file := range selected {
+		files := takeFiles(file)
+		if seen[files[0]] {
+			continue
+		}
+		seen[files[0]] = true
+		takes = append(takes, files)
+	}
+	if len(takes) == 0 {
+		showAlert(i18n.T("process.none"), 3*time.Second)
+		return
+	}
+	startProcessing(takes)
+	currentState = StateIdle
+}
+
+// cycleSummaryOption steps the summary screen's bottom line from continue
+// to adding a note to processing the take
+func cycleSummaryOption() {
+	switch {
+	case !noteOption && !processOption:
+		noteOption = true
+	case noteOption:
+		noteOption, processOption = false, true
+	default:
+		processOption = false
+	}
+}
+
+// summaryOptionText shows the bottom line of the summary screen
+func summaryOptionText(leave string) string {
+	if processOption {
+		return "‹" + i18n.T("process.option") + "›"
+	}
+	return noteOptionText(leave)
+}
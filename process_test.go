@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Synthetic takes are quiet noise with a burst of square wave, peaking at
+// burstLevel of full scale, on the last channel
+const (
+	procRate      = 48000
+	procPartSize  = 50000
+	burstFrom     = 60000
+	burstTo       = 100000 // Exclusive
+	burstLevel    = 0.1
+	procNoiseStep = 0.0003 // Below the -50 dBFS threshold
+)
+
+// procSample is the sample of a synthetic take at frame on channel ch
+func procSample(format pcmFormat, frame int64, ch, channels int) int64 {
+	if ch == channels-1 && frame >= burstFrom && frame < burstTo {
+		if frame/24%2 == 0 {
+			return int64(burstLevel * format.full)
+		}
+		return -int64(burstLevel * format.full)
+	}
+	return int64(float64(frame%7-3) * procNoiseStep / 3 * format.full)
+}
+
+// writeProcTake writes a synthetic take split across parts files
+func writeProcTake(t *testing.T, bits, channels, parts int) []string {
+	t.Helper()
+	format, err := newPCMFormat(bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var files []string
+	for p := 0; p < parts; p++ {
+		name := "take.wav"
+		if p > 0 {
+			name = "take_part" + string(rune('1'+p)) + ".wav"
+		}
+		path := filepath.Join(dir, name)
+		w, err := createWAV(path, procRate, channels, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.bext.TimeReference = uint64(p * procPartSize)
+		block := make([]byte, procPartSize*channels*format.bytes)
+		for i := 0; i < procPartSize; i++ {
+			for ch := 0; ch < channels; ch++ {
+				format.put(block[(i*channels+ch)*format.bytes:], procSample(format, int64(p*procPartSize+i), ch, channels))
+			}
+		}
+		if _, err := w.Write(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestPCMFormat(t *testing.T) {
+	for _, bits := range []int{16, 24, 32} {
+		format, err := newPCMFormat(bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		top := int64(format.full) - 1
+		b := make([]byte, 4)
+		for _, tt := range []struct{ put, want int64 }{
+			{0, 0}, {1, 1}, {-1, -1}, {12345, 12345}, {-12345, -12345},
+			{top, top}, {-top - 1, -top - 1},
+			{top + 5, top}, {-top - 10, -top - 1},
+		} {
+			format.put(b, tt.put)
+			if got := format.sample(b); got != tt.want {
+				t.Errorf("%d-bit: %d reads back as %d, want %d", bits, tt.put, got, tt.want)
+			}
+		}
+	}
+	if _, err := newPCMFormat(8); err == nil {
+		t.Error("8-bit samples accepted")
+	}
+}
+
+func TestProcessTake(t *testing.T) {
+	cfg := ProcessConfig{ThresholdDB: -50, PaddingMs: 250, TargetPeakDB: -1}
+	pad := int64(procRate * cfg.PaddingMs / 1000)
+	for _, f := range []struct{ bits, channels int }{{16, 1}, {24, 2}, {32, 2}} {
+		format, _ := newPCMFormat(f.bits)
+		files := writeProcTake(t, f.bits, f.channels, 4)
+		var originals [][]byte
+		for _, file := range files {
+			data, _ := os.ReadFile(file)
+			originals = append(originals, data)
+		}
+
+		progress := startBackgroundJob(jobProcess, 0)
+		outputs, err := processTake(context.Background(), files, cfg, noCheckpoint, progress)
+		progress.Finish()
+		if err != nil {
+			t.Fatalf("%d-bit: %v", f.bits, err)
+		}
+
+		// The last part is all silence past the padding, so gets no copy
+		if len(outputs) != 3 {
+			t.Fatalf("%d-bit: %d copies, want 3", f.bits, len(outputs))
+		}
+		for i, out := range outputs {
+			if want := procName(files[i]); out != want {
+				t.Errorf("%d-bit: copy %d written to %s, want %s", f.bits, i, out, want)
+			}
+		}
+		for i, file := range files {
+			if data, _ := os.ReadFile(file); !bytes.Equal(data, originals[i]) {
+				t.Errorf("%d-bit: %s changed", f.bits, filepath.Base(file))
+			}
+		}
+
+		// The copies hold the burst with the padding either side, each part
+		// referenced to where it starts in the take
+		var samples []byte
+		for i, out := range outputs {
+			data, info := readSamples(t, out)
+			if info.Bits != f.bits || info.Channels != f.channels || info.SampleRate != procRate {
+				t.Errorf("%d-bit: copy %d is %d-bit, %d channels at %d Hz", f.bits, i, info.Bits, info.Channels, info.SampleRate)
+			}
+			wantRef := uint64(i * procPartSize)
+			if i == 0 {
+				wantRef = burstFrom - uint64(pad)
+			}
+			if !info.HasBext || info.TimeReference != wantRef {
+				t.Errorf("%d-bit: copy %d referenced at frame %d, want %d", f.bits, i, info.TimeReference, wantRef)
+			}
+			samples = append(samples, data...)
+		}
+		frameSize := f.channels * format.bytes
+		if frames := int64(len(samples) / frameSize); frames != burstTo-burstFrom+2*pad {
+			t.Fatalf("%d-bit: %d frames kept, want %d", f.bits, frames, burstTo-burstFrom+2*pad)
+		}
+
+		// The burst peaks at the target, within a step, and starts and ends
+		// where the padding says
+		gain := math.Pow(10, cfg.TargetPeakDB/20) / burstLevel
+		var peak int64
+		first, last := int64(-1), int64(-1)
+		for i := 0; i < len(samples); i += format.bytes {
+			v := format.sample(samples[i:])
+			peak = max(peak, v, -v)
+			if math.Abs(float64(v)) >= burstLevel*gain*format.full/2 {
+				if frame := int64(i / frameSize); first < 0 {
+					first = frame
+				}
+				last = int64(i / frameSize)
+			}
+		}
+		if want := math.Pow(10, cfg.TargetPeakDB/20) * format.full; math.Abs(float64(peak)-want) > 1 {
+			t.Errorf("%d-bit: peak %d, want %.1f", f.bits, peak, want)
+		}
+		if first != pad || last != pad+burstTo-burstFrom-1 {
+			t.Errorf("%d-bit: burst from frame %d to %d of the copy, want %d to %d", f.bits, first, last, pad, pad+burstTo-burstFrom-1)
+		}
+
+		// The quiet part before the burst is scaled by the same gain
+		orig := procSample(format, burstFrom-pad, 0, f.channels)
+		if got, want := format.sample(samples), int64(math.Round(float64(orig)*gain)); got != want {
+			t.Errorf("%d-bit: first sample %d, want %d", f.bits, got, want)
+		}
+	}
+}
+
+func TestProcessTakeEdges(t *testing.T) {
+	files := writeProcTake(t, 24, 1, 3)
+	format, _ := newPCMFormat(24)
+
+	// Padding stops at the ends of the take
+	cfg := ProcessConfig{ThresholdDB: -50, PaddingMs: 10000, TargetPeakDB: -6}
+	outputs, err := processTake(context.Background(), files, cfg, noCheckpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 3 {
+		t.Fatalf("%d copies with padding past both ends, want every part", len(outputs))
+	}
+	for i, out := range outputs {
+		if _, info := readSamples(t, out); info.DataBytes != procPartSize*int64(format.bytes) {
+			t.Errorf("copy %d has %d bytes, want the whole part", i, info.DataBytes)
+		}
+	}
+
+	// A take with nothing above the threshold is left alone
+	cfg = ProcessConfig{ThresholdDB: -10, PaddingMs: 250, TargetPeakDB: -1}
+	for _, out := range outputs {
+		os.Remove(out)
+	}
+	if outputs, err := processTake(context.Background(), files, cfg, noCheckpoint, nil); err == nil || len(outputs) != 0 {
+		t.Errorf("silent take processed into %v: %v", outputs, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(files[0]), "*"+procSuffix+"*")); len(matches) != 0 {
+		t.Errorf("silent take left %v", matches)
+	}
+
+	// Processed copies are told apart from takes
+	if !processed(procName(files[0])) || processed(files[0]) {
+		t.Errorf("processed(%s) wrong", filepath.Base(files[0]))
+	}
+}
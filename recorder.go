@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// recordBlockFrames is the number of sample frames read from the pipeline per write
+const recordBlockFrames = 4800
+
+// Reasons a pipeline never delivered samples
+var (
+	errPipelineExited = errors.New("capture pipeline exited before any samples")
+	errNoSamples      = errors.New("no samples from the capture pipeline")
+)
+
+// SampleTap receives each block of interleaved samples from the capture
+// pipeline. startFrame is the index of the block's first frame within the
+// stream. Taps run on the reader goroutine and must return quickly.
+type SampleTap func(block []byte, startFrame int64)
+
+// Recorder streams interleaved PCM from the inferno2pipe pipeline into WAV
+// files. If a write fails, the current file is closed and recording continues
+// in a new file on the next healthy record target.
+type Recorder struct {
+	sampleRate int
+	channels   int   // Channels delivered by the pipeline
+	armed      []int // 0-based pipeline channels written to disk, nil for all
+	session    string
+	baseName   string
+	targets    []*RecordTarget
+	ixml       IXMLInfo // Track names and take details for each file
+
+	// OnFailover is called from the writer goroutine after switching targets
+	OnFailover func(from, to *RecordTarget, cause error)
+	// OnMigrate is called from the writer goroutine after a migration
+	// requested with MigrateTo, with the error if the new file could not
+	// be opened
+	OnMigrate func(from, to *RecordTarget, err error)
+
+	cmd     *exec.Cmd
+	source  io.Reader
+	done    chan struct{}
+	started chan struct{} // Closed when the first samples arrive
+
+	taps  []SampleTap
+	slate *slateTone // Written over the head of the take, if set
+
+	mutex          sync.Mutex
+	targetIdx      int
+	migrateTo      int  // Target the next block goes to, -1 for none
+	migrated       bool // The take has moved to another target by MigrateTo
+	part           int
+	writer         *wavWriter
+	files          []string
+	writers        []*wavWriter // One per file, for their checksums
+	takeSum        hash.Hash    // XXH64 of the sample data of every file in order
+	err            error
+	framesWritten  int64
+	fileStartFrame int64
+	markers        []Marker
+	firstSample    time.Time
+	timeReference  uint64 // Samples since midnight of the first sample of the take
+	timeRefSource  string
+}
+
+// newRecorder prepares a recorder writing baseName.wav to the session folder
+// on the first healthy target. Only the armed channels are written; nil
+// arms every channel. names holds the name of each channel in the file.
+func newRecorder(targets []*RecordTarget, sampleRate, channels int, armed []int, names []string, session, baseName string) (*Recorder, error) {
+	idx, err := pickRecordTarget(targets, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		sampleRate: sampleRate,
+		channels:   channels,
+		armed:      armed,
+		session:    session,
+		baseName:   baseName,
+		targets:    targets,
+		ixml:       IXMLInfo{Project: session, Tape: unitName(), Note: baseName, Tracks: names},
+		done:       make(chan struct{}),
+		started:    make(chan struct{}),
+		takeSum:    xxhash.New(),
+		migrateTo:  -1,
+	}
+
+	if err := r.openFile(idx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// StartPipeline launches the capture pipeline and begins writing its samples
+func (r *Recorder) StartPipeline() error {
+	cmd, stdout, err := startCapture(r.sampleRate, r.channels)
+	if err != nil {
+		r.abort()
+		return err
+	}
+
+	r.cmd = cmd
+	r.Start(stdout)
+	return nil
+}
+
+// AddTap registers a tap for the sample stream. Must be called before Start.
+func (r *Recorder) AddTap(tap SampleTap) {
+	r.taps = append(r.taps, tap)
+}
+
+// SetSlate writes a tone over the start of the take. Must be called before
+// Start.
+func (r *Recorder) SetSlate(s *slateTone) {
+	r.slate = s
+}
+
+// Start begins copying samples from source into the current file
+func (r *Recorder) Start(source io.Reader) {
+	r.source = source
+	go r.run()
+}
+
+// Stop terminates the pipeline and waits for the last samples to be written
+func (r *Recorder) Stop() error {
+	if r.cmd != nil && r.cmd.Process != nil {
+		r.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	<-r.done
+	if r.cmd != nil {
+		r.cmd.Wait()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// WaitForSamples waits for the first block of samples from the pipeline. It
+// fails if the pipeline ends first or nothing arrives within timeout, which
+// is what a missing or unsubscribed Dante stream looks like.
+func (r *Recorder) WaitForSamples(timeout time.Duration) error {
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.started:
+	case <-r.done:
+		select {
+		case <-r.started: // A single block, then the end
+		default:
+			log.Printf("Recording %s: pipeline exited after %v without samples", r.baseName, time.Since(start).Round(time.Millisecond))
+			return errPipelineExited
+		}
+	case <-timer.C:
+		log.Printf("Recording %s: no samples within %v", r.baseName, timeout)
+		return errNoSamples
+	}
+	log.Printf("Recording %s: first samples after %v", r.baseName, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Cancel stops a take that never got going and removes its files
+func (r *Recorder) Cancel() {
+	r.Stop()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, f := range r.files {
+		os.Remove(f)
+	}
+}
+
+// Done is closed once the writer goroutine has finished
+func (r *Recorder) Done() <-chan struct{} {
+	return r.done
+}
+
+// CurrentTarget returns the target the recorder is currently writing to
+func (r *Recorder) CurrentTarget() *RecordTarget {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.targets[r.targetIdx]
+}
+
+// CurrentFile returns the path of the file currently being written
+func (r *Recorder) CurrentFile() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.files) == 0 {
+		return ""
+	}
+	return r.files[len(r.files)-1]
+}
+
+// Files returns every file written by this take, in order
+func (r *Recorder) Files() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Checksums returns the XXH64 of each file's sample data, in Files order, and
+// of the sample data of the whole take. Call it once the take has stopped.
+func (r *Recorder) Checksums() ([]string, string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	sums := make([]string, len(r.writers))
+	for i, w := range r.writers {
+		sums[i] = w.dataXXH64()
+	}
+	return sums, hex.EncodeToString(r.takeSum.Sum(nil))
+}
+
+// FramesWritten returns the number of sample frames recorded so far
+func (r *Recorder) FramesWritten() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.framesWritten
+}
+
+// FirstSampleTime returns the wall-clock time of the first sample, or zero
+// if no samples have arrived yet
+func (r *Recorder) FirstSampleTime() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.firstSample
+}
+
+// TimeReference returns the take's start position in samples since midnight
+// and where it came from ("clock" or "LTC")
+func (r *Recorder) TimeReference() (uint64, string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.timeReference, r.timeRefSource
+}
+
+// SetTimeReference overrides the take's time reference, e.g. from decoded
+// LTC. Files already closed keep the reference they were written with.
+func (r *Recorder) SetTimeReference(ref uint64, source string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timeReference = ref
+	r.timeRefSource = source
+	r.writer.bext.TimeReference = ref + uint64(r.fileStartFrame)
+}
+
+func (r *Recorder) frameSize() int {
+	return r.channels * BitsPerSample / 8
+}
+
+// fileChannels is the number of channels in each file
+func (r *Recorder) fileChannels() int {
+	if r.armed != nil {
+		return len(r.armed)
+	}
+	return r.channels
+}
+
+func (r *Recorder) fileFrameSize() int {
+	return r.fileChannels() * BitsPerSample / 8
+}
+
+// pack copies the armed channels of a block of pipeline frames into out
+func (r *Recorder) pack(block, out []byte) []byte {
+	const sampleSize = BitsPerSample / 8
+	frames := len(block) / r.frameSize()
+	out = out[:frames*r.fileFrameSize()]
+	o := 0
+	for f := 0; f < frames; f++ {
+		frame := block[f*r.frameSize():]
+		for _, ch := range r.armed {
+			copy(out[o:o+sampleSize], frame[ch*sampleSize:])
+			o += sampleSize
+		}
+	}
+	return out
+}
+
+// stampFirstSample derives the time reference from the system clock when the
+// first block arrives. The block has just been read, so its first sample
+// was captured one block duration ago.
+func (r *Recorder) stampFirstSample(frames int) {
+	blockDuration := time.Duration(frames) * time.Second / time.Duration(r.sampleRate)
+	first := time.Now().Add(-blockDuration)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.firstSample = first
+	r.timeReference = samplesSinceMidnight(first, r.sampleRate)
+	r.timeRefSource = "clock"
+	r.writer.bext.Origination = first
+	r.writer.bext.TimeReference = r.timeReference
+	close(r.started)
+}
+
+// samplesSinceMidnight converts a wall-clock time into a BWF time reference
+func samplesSinceMidnight(t time.Time, sampleRate int) uint64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return uint64(t.Sub(midnight).Seconds() * float64(sampleRate))
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	buf := make([]byte, recordBlockFrames*r.frameSize())
+	var packed []byte
+	if r.armed != nil {
+		packed = make([]byte, recordBlockFrames*r.fileFrameSize())
+	}
+	// Background jobs back off as writes take up more of each block's time
+	var load float64
+	defer setRecorderLoad(0)
+	for {
+		n, readErr := io.ReadFull(r.source, buf)
+		// Only whole frames are written so every file stays frame-aligned
+		n -= n % r.frameSize()
+		if n > 0 {
+			frames := n / r.frameSize()
+			if r.FirstSampleTime().IsZero() {
+				r.stampFirstSample(frames)
+			}
+			r.mutex.Lock()
+			startFrame := r.framesWritten
+			r.mutex.Unlock()
+			if r.slate != nil {
+				r.slate.apply(buf[:n], startFrame, r.channels)
+			}
+
+			out := buf[:n]
+			if r.armed != nil {
+				out = r.pack(out, packed)
+			}
+			writeStart := time.Now()
+			if err := r.write(out); err != nil {
+				r.finish(err)
+				return
+			}
+			blockTime := float64(frames) / float64(r.sampleRate)
+			load += (time.Since(writeStart).Seconds()/blockTime - load) * recorderLoadSmoothing
+			setRecorderLoad(load)
+
+			for _, tap := range r.taps {
+				tap(buf[:n], startFrame)
+			}
+		}
+		if readErr != nil {
+			if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+				readErr = nil
+			}
+			r.finish(readErr)
+			return
+		}
+	}
+}
+
+// write stores a block, rotating to the next target on failure
+func (r *Recorder) write(block []byte) error {
+	r.mutex.Lock()
+	to := r.migrateTo
+	r.migrateTo = -1
+	r.mutex.Unlock()
+	if to >= 0 {
+		r.migrate(to)
+	}
+
+	for len(block) > 0 {
+		r.mutex.Lock()
+		w := r.writer
+		r.mutex.Unlock()
+
+		// What does not fit in a full file goes to the next part
+		chunk := block
+		if room := max(wavMaxDataBytes-w.dataBytes, 0); int64(len(chunk)) > room {
+			chunk = block[:room-room%int64(r.fileFrameSize())]
+		}
+		n, err := w.Write(chunk)
+		countWritten(w.path, n)
+		if err == nil {
+			r.advance(n)
+			block = block[n:]
+			if len(block) > 0 {
+				if err := r.rollover(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		noteWriteError(w.path, "recorder", err)
+
+		// Keep the failed file frame-aligned and carry the rest over. The
+		// frames kept count before the next file is opened, so its time
+		// reference and marker offsets start after them.
+		aligned := n - n%r.fileFrameSize()
+		w.discardTail(n - aligned)
+		r.advance(aligned)
+		block = block[aligned:]
+
+		if ferr := r.failover(err); ferr != nil {
+			return ferr
+		}
+	}
+	return nil
+}
+
+// advance counts n bytes of the current file as written frames
+func (r *Recorder) advance(n int) {
+	frames := int64(n / r.fileFrameSize())
+	r.mutex.Lock()
+	r.framesWritten += frames
+	r.mutex.Unlock()
+}
+
+// rollover continues the take in the next part on the same target once the
+// current file is full. If the new file cannot be opened, the take fails
+// over as it would for a write error.
+func (r *Recorder) rollover() error {
+	r.mutex.Lock()
+	old := r.writer
+	idx := r.targetIdx
+	r.part++
+	r.mutex.Unlock()
+
+	if err := r.openFile(idx); err != nil {
+		r.mutex.Lock()
+		r.part--
+		r.mutex.Unlock()
+		return r.failover(err)
+	}
+
+	r.mutex.Lock()
+	old.markers = markersIn(r.markers, filepath.Base(old.path))
+	r.mutex.Unlock()
+	if err := old.Close(); err != nil {
+		log.Printf("Failed to close %s at the WAV size limit: %v", old.path, err)
+	}
+	log.Printf("Recording %s: %s is full, continuing in %s", r.baseName, filepath.Base(old.path), r.CurrentFile())
+	return nil
+}
+
+// failover closes the current file and opens a new one on the next healthy target
+func (r *Recorder) failover(cause error) error {
+	r.mutex.Lock()
+	from := r.targets[r.targetIdx]
+	failedFile := r.writer
+	failedFile.markers = markersIn(r.markers, filepath.Base(failedFile.path))
+	start := r.targetIdx + 1
+	r.mutex.Unlock()
+
+	if err := failedFile.Close(); err != nil {
+		log.Printf("Failed to close %s after write error: %v", failedFile.path, err)
+	}
+
+	idx, err := pickRecordTarget(r.targets, start)
+	if err != nil {
+		return fmt.Errorf("record target %s failed (%w), no fallback: %v", from.Name, cause, err)
+	}
+
+	r.mutex.Lock()
+	r.part++
+	r.mutex.Unlock()
+	if err := r.openFile(idx); err != nil {
+		return fmt.Errorf("record target %s failed (%w), fallback %s: %v", from.Name, cause, r.targets[idx].Name, err)
+	}
+
+	to := r.targets[idx]
+	log.Printf("Record target %s failed (%v), continuing on %s in %s", from.Name, cause, to.Name, r.CurrentFile())
+	if r.OnFailover != nil {
+		r.OnFailover(from, to, cause)
+	}
+	return nil
+}
+
+// TargetIndex returns the index of the target being written to
+func (r *Recorder) TargetIndex() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.targetIdx
+}
+
+// MigrateTo moves the take to the target at idx: the writer starts a new
+// file there before its next block, so the files meet on a frame boundary
+func (r *Recorder) MigrateTo(idx int) {
+	r.mutex.Lock()
+	r.migrateTo = idx
+	r.mutex.Unlock()
+}
+
+// MigratePending reports whether a migration waits for the next block
+func (r *Recorder) MigratePending() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.migrateTo >= 0
+}
+
+// Migrated reports whether the take has been moved to another target
+func (r *Recorder) Migrated() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.migrated
+}
+
+// migrate opens the next file of the take on the target at idx and closes
+// the current one. The new file's time reference follows on from the last
+// sample of the old one, and a marker at its first sample shows where the
+// take moved. If the new file cannot be opened the take carries on where
+// it is.
+func (r *Recorder) migrate(idx int) {
+	r.mutex.Lock()
+	from := r.targets[r.targetIdx]
+	old := r.writer
+	r.part++
+	r.mutex.Unlock()
+
+	err := r.openFile(idx)
+	if err != nil {
+		r.mutex.Lock()
+		r.part--
+		r.mutex.Unlock()
+		log.Printf("Recording %s: failed to migrate to %s: %v", r.baseName, r.targets[idx].Name, err)
+	} else {
+		r.mutex.Lock()
+		r.addMarker(fmt.Sprintf("Moved from %s to %s", from.Name, r.targets[idx].Name))
+		old.markers = markersIn(r.markers, filepath.Base(old.path))
+		r.migrated = true
+		r.mutex.Unlock()
+		if cerr := old.Close(); cerr != nil {
+			log.Printf("Failed to close %s after migrating: %v", old.path, cerr)
+		}
+		log.Printf("Recording %s: migrated from %s to %s in %s", r.baseName, from.Name, r.targets[idx].Name, r.CurrentFile())
+	}
+	if r.OnMigrate != nil {
+		r.OnMigrate(from, r.targets[idx], err)
+	}
+}
+
+// openFile creates the next file of the take on the target at idx
+func (r *Recorder) openFile(idx int) error {
+	r.mutex.Lock()
+	name := r.baseName + ".wav"
+	if r.part > 0 {
+		name = fmt.Sprintf("%s_part%d.wav", r.baseName, r.part+1)
+	}
+	r.mutex.Unlock()
+
+	// A FAT drive takes only names it allows
+	dir := sessionDir(r.targets[idx].Path, r.session)
+	if fatFilesystem(dir) {
+		name = fatName(name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	w, err := createWAV(path, r.sampleRate, r.fileChannels(), BitsPerSample)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	w.bext.Description = r.baseName
+	w.bext.Originator = bextOriginator()
+	w.ixml = &r.ixml
+	w.takeSum = r.takeSum
+	if !r.firstSample.IsZero() {
+		// Continuation files start where the previous one stopped
+		w.bext.Origination = r.firstSample
+		w.bext.TimeReference = r.timeReference + uint64(r.framesWritten)
+	}
+	r.fileStartFrame = r.framesWritten
+	r.targetIdx = idx
+	r.writer = w
+	r.files = append(r.files, path)
+	r.writers = append(r.writers, w)
+	r.mutex.Unlock()
+	return nil
+}
+
+// finish finalizes the current file and records the terminal error, if any
+func (r *Recorder) finish(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.writer.markers = markersIn(r.markers, filepath.Base(r.writer.path))
+	if cerr := r.writer.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("Recording %s ended with error: %v", r.baseName, err)
+	}
+	r.err = err
+}
+
+// abort removes the file created for a take that never started
+func (r *Recorder) abort() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.writer.Close()
+	for _, f := range r.files {
+		os.Remove(f)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testChannels = 2
+
+// failingFile passes writes through to the file until limit bytes have gone
+// in, then writes what still fits and fails every write after that, like a
+// drive that fills up or drops off mid-take
+type failingFile struct {
+	*os.File
+	limit int64
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if int64(len(p)) <= f.limit {
+		n, err := f.File.Write(p)
+		f.limit -= int64(n)
+		return n, err
+	}
+	n, _ := f.File.Write(p[:f.limit])
+	f.limit -= int64(n)
+	return n, syscall.EIO
+}
+
+// newTestRecorder returns a recorder of testChannels channels writing to a
+// new directory for each of n targets
+func newTestRecorder(t *testing.T, n int) (*Recorder, []*RecordTarget) {
+	t.Helper()
+	var targets []*RecordTarget
+	for i := 0; i < n; i++ {
+		targets = append(targets, &RecordTarget{Name: string(rune('A' + i)), Path: t.TempDir()})
+	}
+	r, err := newRecorder(targets, 48000, testChannels, nil, nil, "", "take")
+	if err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+	return r, targets
+}
+
+// failAfter makes the recorder's current file fail once frames frames and
+// extra more bytes have been written to it
+func failAfter(r *Recorder, frames int64, extra int64) {
+	r.writer.file = &failingFile{File: r.writer.file.(*os.File), limit: frames*int64(r.fileFrameSize()) + extra}
+}
+
+// testSamples returns frames frames in which every sample holds its own
+// index in the stream
+func testSamples(frames int) []byte {
+	b := make([]byte, frames*testChannels*4)
+	for i := 0; i < frames*testChannels; i++ {
+		binary.LittleEndian.PutUint32(b[i*4:], uint32(i))
+	}
+	return b
+}
+
+// record feeds samples through the recorder and waits for it to finish
+func record(t *testing.T, r *Recorder, samples []byte) {
+	t.Helper()
+	r.Start(bytes.NewReader(samples))
+	if err := r.Stop(); err != nil {
+		t.Fatalf("recording failed: %v", err)
+	}
+}
+
+// readSamples returns the sample data of a WAV file and its details
+func readSamples(t *testing.T, path string) ([]byte, *WAVInfo) {
+	t.Helper()
+	info, err := readWAVInfo(path)
+	if err != nil {
+		t.Fatalf("readWAVInfo(%s): %v", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data := make([]byte, info.DataBytes)
+	if _, err := f.ReadAt(data, info.DataOffset); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	return data, info
+}
+
+func TestFailoverCountsFramesOfPartialWrite(t *testing.T) {
+	r, targets := newTestRecorder(t, 2)
+	// The failing write keeps 1000 frames and half of the next
+	failAfter(r, 1000, 4)
+
+	total := 3 * recordBlockFrames
+	samples := testSamples(total)
+	record(t, r, samples)
+
+	files := r.Files()
+	if len(files) != 2 {
+		t.Fatalf("got files %v, want 2", files)
+	}
+	if dir := filepath.Dir(files[1]); dir != targets[1].Path {
+		t.Errorf("second file in %s, want %s", dir, targets[1].Path)
+	}
+
+	first, firstInfo := readSamples(t, files[0])
+	second, secondInfo := readSamples(t, files[1])
+	frameSize := r.fileFrameSize()
+	if len(first) != 1000*frameSize {
+		t.Errorf("first file holds %d bytes, want %d", len(first), 1000*frameSize)
+	}
+	if !bytes.Equal(append(first, second...), samples) {
+		t.Error("the files together do not hold the samples recorded")
+	}
+
+	if got := secondInfo.TimeReference - firstInfo.TimeReference; got != 1000 {
+		t.Errorf("second file starts %d frames after the first, want 1000", got)
+	}
+	if got := r.FramesWritten(); got != int64(total) {
+		t.Errorf("FramesWritten() = %d, want %d", got, total)
+	}
+
+	// A marker at the end falls in the second file, counted from its start
+	m := r.AddMarker()
+	if m.File != filepath.Base(files[1]) || m.Frame != int64(total-1000) {
+		t.Errorf("marker at %s frame %d, want %s frame %d", m.File, m.Frame, filepath.Base(files[1]), total-1000)
+	}
+}
+
+func TestRolloverBeforeWAVSizeLimit(t *testing.T) {
+	r, targets := newTestRecorder(t, 1)
+	// Start the file 100 frames short of full, without writing 4 GiB
+	frameSize := r.fileFrameSize()
+	r.writer.dataBytes = wavMaxDataBytes - wavMaxDataBytes%int64(frameSize) - 100*int64(frameSize)
+	if _, err := r.writer.file.Seek(wavHeaderSize+r.writer.dataBytes, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	total := recordBlockFrames
+	samples := testSamples(total)
+	record(t, r, samples)
+
+	files := r.Files()
+	if len(files) != 2 {
+		t.Fatalf("got files %v, want 2", files)
+	}
+	if dir := filepath.Dir(files[1]); dir != targets[0].Path {
+		t.Errorf("second file in %s, want it on the same target in %s", dir, targets[0].Path)
+	}
+
+	first, err := readWAVInfo(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.DataBytes > wavMaxDataBytes {
+		t.Errorf("full file holds %d bytes, over the %d limit", first.DataBytes, int64(wavMaxDataBytes))
+	}
+	stat, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	riff := make([]byte, 8)
+	if _, err := f.ReadAt(riff, 0); err != nil {
+		t.Fatal(err)
+	}
+	if size := int64(binary.LittleEndian.Uint32(riff[4:8])) + 8; size != stat.Size() {
+		t.Errorf("RIFF size says %d bytes, file has %d", size, stat.Size())
+	}
+
+	second, secondInfo := readSamples(t, files[1])
+	if !bytes.Equal(second, samples[100*frameSize:]) {
+		t.Error("second file does not continue from the sample after the full file")
+	}
+	if got := secondInfo.TimeReference - first.TimeReference; got != 100 {
+		t.Errorf("second file starts %d frames after the first, want 100", got)
+	}
+}
+
+func TestFailoverToNextTarget(t *testing.T) {
+	r, targets := newTestRecorder(t, 3)
+	var from, to []string
+	r.OnFailover = func(f, t *RecordTarget, cause error) {
+		from = append(from, f.Name)
+		to = append(to, t.Name)
+	}
+	failAfter(r, 2*recordBlockFrames, 0)
+
+	samples := testSamples(4 * recordBlockFrames)
+	record(t, r, samples)
+
+	if len(from) != 1 || from[0] != "A" || to[0] != "B" {
+		t.Errorf("failovers %v → %v, want [A] → [B]", from, to)
+	}
+	files := r.Files()
+	if len(files) != 2 || filepath.Dir(files[1]) != targets[1].Path {
+		t.Fatalf("got files %v, want the second on %s", files, targets[1].Path)
+	}
+	if filepath.Base(files[1]) != "take_part2.wav" {
+		t.Errorf("continuation file named %s, want take_part2.wav", filepath.Base(files[1]))
+	}
+	first, _ := readSamples(t, files[0])
+	second, _ := readSamples(t, files[1])
+	if !bytes.Equal(append(first, second...), samples) {
+		t.Error("the files together do not hold the samples recorded")
+	}
+	if r.CurrentTarget() != targets[1] {
+		t.Errorf("writing to %s, want B", r.CurrentTarget().Name)
+	}
+}
+
+func TestFailoverSkipsUnavailableTarget(t *testing.T) {
+	r, targets := newTestRecorder(t, 3)
+	if err := os.Remove(targets[1].Path); err != nil {
+		t.Fatal(err)
+	}
+	failAfter(r, recordBlockFrames/2, 0)
+
+	record(t, r, testSamples(2*recordBlockFrames))
+
+	files := r.Files()
+	if len(files) != 2 || filepath.Dir(files[1]) != targets[2].Path {
+		t.Errorf("got files %v, want the second on %s", files, targets[2].Path)
+	}
+}
+
+func TestFailoverWithoutFallbackEndsTake(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	failAfter(r, recordBlockFrames, 0)
+
+	r.Start(bytes.NewReader(testSamples(3 * recordBlockFrames)))
+	err := r.Stop()
+	if err == nil {
+		t.Fatal("take with no fallback target ended without an error")
+	}
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("error %v does not wrap the write error", err)
+	}
+	if got := r.FramesWritten(); got != recordBlockFrames {
+		t.Errorf("FramesWritten() = %d, want the %d frames written before the failure", got, recordBlockFrames)
+	}
+
+	// What was written before the failure is kept and readable
+	data, _ := readSamples(t, r.Files()[0])
+	if len(data) != recordBlockFrames*r.fileFrameSize() {
+		t.Errorf("file holds %d bytes, want %d", len(data), recordBlockFrames*r.fileFrameSize())
+	}
+}
+
+func TestNewRecorderPicksFirstHealthyTarget(t *testing.T) {
+	missing := &RecordTarget{Name: "SSD", Path: filepath.Join(t.TempDir(), "ssd")}
+	sd := &RecordTarget{Name: "SD", Path: t.TempDir()}
+	r, err := newRecorder([]*RecordTarget{missing, sd}, 48000, testChannels, nil, nil, "", "take")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.abort()
+	if r.CurrentTarget() != sd {
+		t.Errorf("recording to %s, want SD", r.CurrentTarget().Name)
+	}
+
+	if _, err := newRecorder([]*RecordTarget{missing}, 48000, testChannels, nil, nil, "", "take"); err == nil {
+		t.Error("newRecorder succeeded with no healthy target")
+	}
+}
+
+// fakePipeline stands in for the capture pipeline with a process that
+// writes n bytes of silence and then nothing more until the recorder stops
+// it
+func fakePipeline(t *testing.T, r *Recorder, n int) {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", fmt.Sprintf("head -c %d /dev/zero; exec sleep 60", n))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	r.cmd = cmd
+	r.Start(stdout)
+}
+
+func TestWaitForSamplesTimesOutWithoutAudio(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, 0)
+
+	if err := r.WaitForSamples(50 * time.Millisecond); !errors.Is(err, errNoSamples) {
+		t.Errorf("WaitForSamples() = %v, want %v", err, errNoSamples)
+	}
+	files := r.Files()
+	r.Cancel()
+	for _, f := range files {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s left behind by a cancelled take", f)
+		}
+	}
+}
+
+func TestWaitForSamplesPipelineExits(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	r.Start(bytes.NewReader(nil))
+
+	if err := r.WaitForSamples(time.Second); !errors.Is(err, errPipelineExited) {
+		t.Errorf("WaitForSamples() = %v, want %v", err, errPipelineExited)
+	}
+	r.Cancel()
+}
+
+func TestWaitForSamplesWithAudio(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	fakePipeline(t, r, recordBlockFrames*testChannels*4)
+
+	if err := r.WaitForSamples(5 * time.Second); err != nil {
+		t.Errorf("WaitForSamples() = %v with audio arriving", err)
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// Commands accepted from remote interfaces such as MQTT
+const (
+	remoteRecordStart     = "record/start"
+	remoteRecordStop      = "record/stop"
+	remoteRecordStopForce = "record/stop force" // Skips the stop prompt
+	remoteMarker          = "marker"
+)
+
+var (
+	// errAlreadyRecording refuses a start while a take records or starts
+	errAlreadyRecording = errors.New("already recording")
+	// errNotRecording refuses a stop or marker with no take
+	errNotRecording = errors.New("not recording")
+	// errRemoteOff refuses commands from an interface turned off in Remote
+	// Control
+	errRemoteOff = errors.New("turned off")
+)
+
+// requestStart starts a take for the Record button or a remote command.
+// Must be called with mutex held.
+func requestStart() error {
+	if isRecording || startingRecorder != nil {
+		return errAlreadyRecording
+	}
+	// Recording takes priority over a copy, which pauses until the take ends
+	if currentState != StateIdle && currentState != StateRecordingSummary && currentState != StateCopying && currentState != StateError {
+		return fmt.Errorf("not available on the %s screen", stateNames[currentState])
+	}
+	// Manual takes are never stopped by chase or auto-record
+	return startRecording()
+}
+
+// requestStop stops the take for the Stop button or a remote command. When
+// Stop asks for confirmation the first request raises the prompt and a
+// second while it is up stops; force stops at once. Must be called with
+// mutex held.
+func requestStop(force bool) error {
+	if startingRecorder != nil {
+		// Give up waiting for audio
+		cancelStart()
+		return nil
+	}
+	if !isRecording {
+		return errNotRecording
+	}
+	if !force && stopNeedsConfirm() && !stopPrompted() {
+		promptStop()
+		return errStopUnconfirmed
+	}
+	dismissStopPrompt()
+	if chaseTake {
+		// Don't restart until the code stops and rolls again
+		chaseSuppressed = true
+	}
+	// Likewise, auto-record waits for silence before starting again
+	autoSuppressed = autoArmed
+	stopRecording()
+	return nil
+}
+
+// requestMarker drops a marker in the take being recorded. Must be called
+// with mutex held.
+func requestMarker() error {
+	if !isRecording || recorder == nil {
+		return errNotRecording
+	}
+	m := recorder.AddMarker()
+	log.Printf("Marker %d in %s at %s", m.ID, m.File, markerTime(m.Frame, recorder.sampleRate))
+	showAlert(i18n.Tf("alert.marker", m.ID), 2*time.Second)
+	return nil
+}
+
+// runRemoteCommand applies a command from a remote interface through the
+// same checks as the front panel. source names the interface and from the
+// client or topic it came from; both are kept in the audit log. Commands
+// from an interface turned off in Remote Control are refused.
+func runRemoteCommand(source, from, command string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var err error
+	if remoteOff[source] {
+		err = fmt.Errorf("remote control over %s: %w", source, errRemoteOff)
+	} else {
+		switch command {
+		case remoteRecordStart:
+			err = requestStart()
+		case remoteRecordStop:
+			err = requestStop(false)
+		case remoteRecordStopForce:
+			err = requestStop(true)
+		case remoteMarker:
+			err = requestMarker()
+		default:
+			err = fmt.Errorf("unknown command %q", command)
+		}
+	}
+	auditRemoteCommand(source, from, command, err)
+	return err
+}
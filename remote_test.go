@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeRecording stands up a take in progress for the length of the test
+func fakeRecording(t *testing.T) *Recorder {
+	t.Helper()
+	r, _ := newTestRecorder(t, 1)
+	r.Start(bytes.NewReader(testSamples(recordBlockFrames)))
+
+	mutex.Lock()
+	recorder = r
+	isRecording = true
+	currentState = StateRecording
+	mutex.Unlock()
+
+	t.Cleanup(func() {
+		r.Stop()
+		mutex.Lock()
+		defer mutex.Unlock()
+		recorder = nil
+		isRecording = false
+		currentState = StateIdle
+	})
+	return r
+}
+
+func TestLockedSettingsRefusedWhileRecording(t *testing.T) {
+	fakeRecording(t)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rate, channels := sampleRateIdx, channelCount
+	mutations := []struct {
+		name    string
+		setting string
+		mutate  func() error
+	}{
+		{"sample rate up", lockedSampleRate, func() error { return adjustSampleRate(1) }},
+		{"sample rate down", lockedSampleRate, func() error { return adjustSampleRate(-1) }},
+		{"channels up", lockedChannels, func() error { return adjustChannelCount(1) }},
+		{"channels down", lockedChannels, func() error { return adjustChannelCount(-1) }},
+		{"settings with another rate", lockedSampleRate, func() error {
+			s := currentSettings()
+			s.SampleRate = sampleRates[(sampleRateIdx+1)%len(sampleRates)]
+			return checkSettingsUnlocked(s)
+		}},
+		{"settings with more channels", lockedChannels, func() error {
+			s := currentSettings()
+			s.Channels++
+			return checkSettingsUnlocked(s)
+		}},
+		{"settings arming one channel", lockedChannels, func() error {
+			s := currentSettings()
+			s.ArmedChannels = []int{0}
+			return checkSettingsUnlocked(s)
+		}},
+	}
+	for _, m := range mutations {
+		var locked *recordingLockedError
+		err := m.mutate()
+		if !errors.As(err, &locked) {
+			t.Errorf("%s: got %v, want a locked error", m.name, err)
+		} else if locked.setting != m.setting {
+			t.Errorf("%s: %s locked, want %s", m.name, locked.setting, m.setting)
+		}
+	}
+	if sampleRateIdx != rate || channelCount != channels {
+		t.Error("a refused change altered the format of the take")
+	}
+
+	// Settings that leave the format alone still apply
+	if err := checkSettingsUnlocked(currentSettings()); err != nil {
+		t.Errorf("unchanged settings refused: %v", err)
+	}
+}
+
+func TestLockedSettingsFreeWhenIdle(t *testing.T) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	rate, channels := sampleRateIdx, channelCount
+	defer func() { sampleRateIdx, channelCount = rate, channels }()
+
+	if err := adjustSampleRate(1); err != nil {
+		t.Errorf("adjustSampleRate while idle: %v", err)
+	}
+	if err := adjustChannelCount(-1); err != nil {
+		t.Errorf("adjustChannelCount while idle: %v", err)
+	}
+}
+
+// postCommand sends a control request to the HTTP server and returns its
+// status code
+func postCommand(t *testing.T, method, path, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	command := httpCommands[req.URL.Path]
+	controlHandler(command).ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestHTTPControl(t *testing.T) {
+	token := config.HTTP.Token
+	config.HTTP.Token = "secret"
+	t.Cleanup(func() { config.HTTP.Token = token })
+
+	if got := postCommand(t, http.MethodGet, "/record/start", "secret"); got != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+	if got := postCommand(t, http.MethodPost, "/record/start", "wrong"); got != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := postCommand(t, http.MethodPost, "/marker", "secret"); got != http.StatusConflict {
+		t.Errorf("marker while idle: status %d, want %d", got, http.StatusConflict)
+	}
+	if got := postCommand(t, http.MethodPost, "/record/stop", "secret"); got != http.StatusConflict {
+		t.Errorf("stop while idle: status %d, want %d", got, http.StatusConflict)
+	}
+
+	r := fakeRecording(t)
+	if got := postCommand(t, http.MethodPost, "/record/start", "secret"); got != http.StatusConflict {
+		t.Errorf("start while recording: status %d, want %d", got, http.StatusConflict)
+	}
+	mutex.Lock()
+	if recorder != r {
+		t.Error("start while recording replaced the take")
+	}
+	mutex.Unlock()
+	if got := postCommand(t, http.MethodPost, "/marker", "secret"); got != http.StatusOK {
+		t.Errorf("marker while recording: status %d, want %d", got, http.StatusOK)
+	}
+	if len(r.Markers()) != 1 {
+		t.Errorf("take has %d markers, want 1", len(r.Markers()))
+	}
+
+	mutex.Lock()
+	toggleRemote("http")
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		toggleRemote("http")
+		mutex.Unlock()
+	}()
+	if got := postCommand(t, http.MethodPost, "/marker", "secret"); got != http.StatusForbidden {
+		t.Errorf("interface turned off: status %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestHTTPControlNeedsToken(t *testing.T) {
+	token := config.HTTP.Token
+	config.HTTP.Token = ""
+	t.Cleanup(func() { config.HTTP.Token = token })
+
+	if got := postCommand(t, http.MethodPost, "/record/start", ""); got != http.StatusForbidden {
+		t.Errorf("no token configured: status %d, want %d", got, http.StatusForbidden)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if isRecording || startingRecorder != nil {
+		t.Error("a take started without a token configured")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// remoteAuditSize is how many remote commands the audit log keeps
+const remoteAuditSize = 50
+
+// remoteCommand is an entry in the remote command audit log
+type remoteCommand struct {
+	At      time.Time `json:"at"`
+	Source  string    `json:"source"`         // Interface, such as "mqtt" or "http"
+	From    string    `json:"from,omitempty"` // Client or topic, if known
+	Command string    `json:"command"`
+	Result  string    `json:"result"` // "ok" or why it failed
+}
+
+// remoteInterface is a surface remote commands arrive through, listed on
+// the Remote Control screen and in the diagnostics bundle
+type remoteInterface struct {
+	name       string // Source name in the audit log and settings
+	label      string
+	configured func() bool
+	endpoint   func() string // Port, topic base or socket path
+	auth       func() string
+	status     func() string // Connection state, if the interface has one
+}
+
+// remoteInterfaces lists every remote interface, configured or not
+var remoteInterfaces = []remoteInterface{
+	{
+		name:       "mqtt",
+		label:      "MQTT",
+		configured: func() bool { return config.MQTT.Broker != "" },
+		endpoint:   mqttBaseTopic,
+		auth: func() string {
+			if config.MQTT.Username != "" {
+				return i18n.Tf("remote.auth_user", config.MQTT.Username)
+			}
+			return i18n.T("remote.auth_none")
+		},
+		status: mqttStatusText,
+	},
+	{
+		name:       "http",
+		label:      "HTTP",
+		configured: func() bool { return config.HTTP.Listen != "" && config.HTTP.Token != "" },
+		endpoint:   func() string { return config.HTTP.Listen },
+		auth:       func() string { return i18n.T("remote.auth_token") },
+	},
+}
+
+var (
+	// remoteLog holds the last remoteAuditSize commands, oldest first
+	remoteLog []remoteCommand
+
+	// remoteOff holds the interfaces whose commands are refused
+	remoteOff = make(map[string]bool)
+)
+
+// auditRemoteCommand logs a remote command and keeps it for the Remote
+// Control screen. Must be called with mutex held.
+func auditRemoteCommand(source, from, command string, err error) {
+	entry := remoteCommand{At: time.Now(), Source: source, From: from, Command: command, Result: "ok"}
+	if err != nil {
+		entry.Result = err.Error()
+	}
+	log.Printf("Remote %s: command %q from %s: %s", source, command, from, entry.Result)
+	remoteLog = append(remoteLog, entry)
+	if len(remoteLog) > remoteAuditSize {
+		remoteLog = remoteLog[len(remoteLog)-remoteAuditSize:]
+	}
+}
+
+// lastRemoteCommand returns the newest command from source, or from any
+// interface if source is empty. Must be called with mutex held.
+func lastRemoteCommand(source string) (remoteCommand, bool) {
+	for i := len(remoteLog) - 1; i >= 0; i-- {
+		if source == "" || remoteLog[i].Source == source {
+			return remoteLog[i], true
+		}
+	}
+	return remoteCommand{}, false
+}
+
+// remoteCommandText summarises a command for the Remote Control screen
+func remoteCommandText(source string) string {
+	c, ok := lastRemoteCommand(source)
+	if !ok {
+		return i18n.T("remote.no_commands")
+	}
+	text := c.Command + " " + c.At.Format("15:04:05")
+	if source == "" {
+		text = c.Source + " · " + text
+	}
+	return text
+}
+
+// showRemoteCommand shows the full audit entry of the newest command from
+// source
+func showRemoteCommand(source string) {
+	c, ok := lastRemoteCommand(source)
+	if !ok {
+		return
+	}
+	showAlert(i18n.Tf("remote.command_details", c.Command, c.Source, c.From, c.At.Format("Jan 2 15:04:05"), c.Result), 5*time.Second)
+}
+
+// toggleRemote turns an interface's commands on or off. Must be called with
+// mutex held.
+func toggleRemote(name string) {
+	if remoteOff[name] {
+		delete(remoteOff, name)
+	} else {
+		remoteOff[name] = true
+	}
+	if remoteOff[name] {
+		log.Printf("Remote %s: commands turned off", name)
+	} else {
+		log.Printf("Remote %s: commands turned on", name)
+	}
+}
+
+// remoteOffNames lists the interfaces whose commands are refused, sorted.
+// Must be called with mutex held.
+func remoteOffNames() []string {
+	var names []string
+	for name := range remoteOff {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// remoteInterfaceNamed reports whether name is a remote interface
+func remoteInterfaceNamed(name string) bool {
+	for _, ri := range remoteInterfaces {
+		if ri.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteControlMenuItems lists the newest command, then each interface with
+// its commands switch, endpoint, authentication, link and last command
+func remoteControlMenuItems() []menuItem {
+	items := []menuItem{{Label: i18n.T("remote.last"), Value: func() string { return remoteCommandText("") },
+		Action: func() { showRemoteCommand("") }}}
+	for _, ri := range remoteInterfaces {
+		ri := ri
+		if !ri.configured() {
+			items = append(items, menuItem{Label: ri.label, Value: func() string { return i18n.T("remote.not_configured") },
+				Header: true, Disabled: true, Reason: i18n.T("reason.remote_not_configured")})
+			continue
+		}
+		items = append(items,
+			menuItem{Label: ri.label, Value: func() string { return commandsText(ri.name) },
+				Action: func() { toggleRemote(ri.name) }, Header: true},
+			menuItem{Label: i18n.T("remote.endpoint"), Value: ri.endpoint, Indent: 1},
+			menuItem{Label: i18n.T("remote.auth"), Value: ri.auth, Indent: 1},
+		)
+		if ri.status != nil {
+			items = append(items, menuItem{Label: i18n.T("remote.link"), Value: ri.status, Indent: 1})
+		}
+		items = append(items, menuItem{Label: i18n.T("remote.last"), Value: func() string { return remoteCommandText(ri.name) },
+			Action: func() { showRemoteCommand(ri.name) }, Indent: 1})
+	}
+	return append(items, menuItem{Label: i18n.T("common.back"), Action: func() { openMenu(StateSettings) }})
+}
+
+// commandsText shows whether an interface's commands are accepted
+func commandsText(name string) string {
+	if remoteOff[name] {
+		return i18n.T("remote.commands_off")
+	}
+	return i18n.T("remote.commands_on")
+}
+
+// remoteReport is the remote control state written to diagnostics bundles
+type remoteReport struct {
+	Interfaces []remoteInterfaceReport `json:"interfaces"`
+	Commands   []remoteCommand         `json:"commands"` // Oldest first
+}
+
+// remoteInterfaceReport describes one interface in a remoteReport
+type remoteInterfaceReport struct {
+	Name       string `json:"name"`
+	Configured bool   `json:"configured"`
+	Commands   bool   `json:"commands"` // Commands are accepted
+	Endpoint   string `json:"endpoint,omitempty"`
+	Auth       string `json:"auth,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+// remoteReportJSON describes every interface and the audit log. Must be
+// called with mutex held.
+func remoteReportJSON() ([]byte, error) {
+	report := remoteReport{Commands: append([]remoteCommand(nil), remoteLog...)}
+	for _, ri := range remoteInterfaces {
+		r := remoteInterfaceReport{Name: ri.name, Configured: ri.configured(), Commands: !remoteOff[ri.name]}
+		if r.Configured {
+			r.Endpoint, r.Auth = ri.endpoint(), ri.auth()
+			if ri.status != nil {
+				r.Status = ri.status()
+			}
+		}
+		report.Interfaces = append(report.Interfaces, r)
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pi9696/i18n"
+)
+
+// jobKind is a kind of work that needs storage to itself or shares it
+type jobKind string
+
+const (
+	jobRecording   jobKind = "recording"
+	jobCopy        jobKind = "copy"
+	jobVerify      jobKind = "verify"
+	jobImport      jobKind = "import"
+	jobBenchmark   jobKind = "benchmark"
+	jobFormat      jobKind = "format"
+	jobDelete      jobKind = "delete"
+	jobDiagnostics jobKind = "diagnostics"
+	jobMigrate     jobKind = "migrate"
+	jobProcess     jobKind = "process"
+)
+
+// background reports whether a job yields to recordings
+func (k jobKind) background() bool {
+	return k == jobCopy || k == jobVerify || k == jobBenchmark || k == jobImport || k == jobMigrate || k == jobProcess
+}
+
+// writesRecordings reports whether a job adds, removes or renames recordings
+// on the paths it holds
+func (k jobKind) writesRecordings() bool {
+	return k == jobRecording || k == jobImport || k == jobMigrate || k == jobProcess || k == jobDelete
+}
+
+// exclusive reports whether a job destroys data and may share nothing
+func (k jobKind) exclusive() bool {
+	return k == jobFormat || k == jobDelete
+}
+
+// Label returns the translated name of the job for messages
+func (k jobKind) Label() string {
+	return i18n.T("job." + string(k))
+}
+
+// blocks reports whether a holder of a resource keeps want from acquiring it.
+// Recordings are never blocked by background jobs; they preempt them instead.
+func (k jobKind) blocks(want jobKind) bool {
+	switch {
+	case k.exclusive() || want.exclusive():
+		return true
+	case k == jobRecording:
+		return want == jobRecording || want.background()
+	}
+	return false
+}
+
+// Lease is a job's hold on a set of storage paths
+type Lease struct {
+	rm    *resourceManager
+	kind  jobKind
+	paths []string
+}
+
+// resourceManager hands out path-scoped leases to the jobs that read, write
+// or destroy recordings. Paths overlap when one contains the other, so a
+// lease on a drive's mount point also covers a record target on it.
+type resourceManager struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	leases []*Lease
+}
+
+func newResourceManager() *resourceManager {
+	rm := &resourceManager{}
+	rm.cond = sync.NewCond(&rm.mutex)
+	return rm
+}
+
+// resources coordinates every job that touches the record targets or USB drive
+var resources = newResourceManager()
+
+// pathsOverlap reports whether either path contains the other
+func pathsOverlap(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	return a == b || strings.HasPrefix(b, a+"/") || strings.HasPrefix(a, b+"/")
+}
+
+// sharesPath reports whether l holds any of paths
+func (l *Lease) sharesPath(paths []string) bool {
+	for _, a := range l.paths {
+		for _, b := range paths {
+			if pathsOverlap(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blocker returns the lease keeping kind from acquiring paths, if any. Must
+// be called with rm.mutex held.
+func (rm *resourceManager) blocker(kind jobKind, paths []string) *Lease {
+	for _, l := range rm.leases {
+		if l.kind.blocks(kind) && l.sharesPath(paths) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Writing reports whether a job that changes recordings holds any of paths,
+// so changes seen there are the recorder's own
+func (rm *resourceManager) Writing(paths ...string) bool {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	for _, l := range rm.leases {
+		if l.kind.writesRecordings() && l.sharesPath(paths) {
+			return true
+		}
+	}
+	return false
+}
+
+// TryAcquire takes a lease without waiting. The error names the job in the way.
+func (rm *resourceManager) TryAcquire(kind jobKind, paths ...string) (*Lease, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if l := rm.blocker(kind, paths); l != nil {
+		return nil, &busyError{holder: l.kind}
+	}
+	return rm.grant(kind, paths), nil
+}
+
+// Acquire takes a lease, waiting for conflicting jobs to finish. onWait is
+// called each time the job holding it up changes, so the UI can say what it
+// is waiting for.
+func (rm *resourceManager) Acquire(ctx context.Context, kind jobKind, onWait func(holder jobKind), paths ...string) (*Lease, error) {
+	stop := context.AfterFunc(ctx, func() {
+		rm.mutex.Lock()
+		rm.cond.Broadcast()
+		rm.mutex.Unlock()
+	})
+	defer stop()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	var waitingFor *Lease
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l := rm.blocker(kind, paths)
+		if l == nil {
+			return rm.grant(kind, paths), nil
+		}
+		if l != waitingFor && onWait != nil {
+			onWait(l.kind)
+		}
+		waitingFor = l
+		rm.cond.Wait()
+	}
+}
+
+// grant records a new lease. Must be called with rm.mutex held.
+func (rm *resourceManager) grant(kind jobKind, paths []string) *Lease {
+	l := &Lease{rm: rm, kind: kind, paths: paths}
+	rm.leases = append(rm.leases, l)
+	return l
+}
+
+// Release gives the lease back and wakes jobs waiting on it
+func (l *Lease) Release() {
+	rm := l.rm
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	for i, held := range rm.leases {
+		if held == l {
+			rm.leases = append(rm.leases[:i], rm.leases[i+1:]...)
+			break
+		}
+	}
+	rm.cond.Broadcast()
+}
+
+// preemptedBy returns the recording sharing a background lease's paths, if
+// any. Must be called with rm.mutex held.
+func (l *Lease) preemptedBy() *Lease {
+	for _, held := range l.rm.leases {
+		if held.kind == jobRecording && held.sharesPath(l.paths) {
+			return held
+		}
+	}
+	return nil
+}
+
+// Preempted reports whether a recording has started on the lease's paths
+func (l *Lease) Preempted() bool {
+	l.rm.mutex.Lock()
+	defer l.rm.mutex.Unlock()
+	return l.preemptedBy() != nil
+}
+
+// Checkpoint is called by background jobs between units of work. It waits
+// while a recording is using the lease's paths, calling onPause once if it
+// has to.
+func (l *Lease) Checkpoint(ctx context.Context, onPause func()) error {
+	stop := context.AfterFunc(ctx, func() {
+		l.rm.mutex.Lock()
+		l.rm.cond.Broadcast()
+		l.rm.mutex.Unlock()
+	})
+	defer stop()
+
+	l.rm.mutex.Lock()
+	defer l.rm.mutex.Unlock()
+
+	paused := false
+	for l.preemptedBy() != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !paused && onPause != nil {
+			onPause()
+		}
+		paused = true
+		l.rm.cond.Wait()
+	}
+	return ctx.Err()
+}
+
+// busyError reports the job holding a resource
+type busyError struct {
+	holder jobKind
+}
+
+func (e *busyError) Error() string {
+	return fmt.Sprintf("%s in progress", e.holder)
+}
+
+// busyMessage is the alert shown when an action is refused because of err
+func busyMessage(err error) string {
+	if busy, ok := err.(*busyError); ok {
+		return i18n.Tf("resource.busy", busy.holder.Label())
+	}
+	return err.Error()
+}
+
+// targetPaths returns the paths of every record target
+func targetPaths() []string {
+	paths := make([]string, len(recordTargets))
+	for i, target := range recordTargets {
+		paths[i] = target.Path
+	}
+	return paths
+}
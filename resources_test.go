@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor fails the test if ch is not closed within a second
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// stillBlocked fails the test if ch closes within a short while
+func stillBlocked(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatalf("%s went ahead", what)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRecordingPreemptsBackgroundJob(t *testing.T) {
+	rm := newResourceManager()
+	copyLease, err := rm.TryAcquire(jobCopy, "/rec/session", "/media/usb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The recording is never held up by the copy
+	rec, err := rm.TryAcquire(jobRecording, "/rec")
+	if err != nil {
+		t.Fatalf("recording blocked by a copy: %v", err)
+	}
+	if !copyLease.Preempted() {
+		t.Error("copy not told a recording started on its paths")
+	}
+
+	// The copy pauses at its next checkpoint until the take ends
+	var pauses atomic.Int32
+	resumed := make(chan struct{})
+	go func() {
+		copyLease.Checkpoint(context.Background(), func() { pauses.Add(1) })
+		close(resumed)
+	}()
+	stillBlocked(t, resumed, "preempted copy")
+	rec.Release()
+	waitFor(t, resumed, "copy to resume")
+	if pauses.Load() != 1 {
+		t.Errorf("onPause called %d times, want once", pauses.Load())
+	}
+	copyLease.Release()
+}
+
+func TestBackgroundJobWaitsForRecording(t *testing.T) {
+	rm := newResourceManager()
+	rec, err := rm.TryAcquire(jobRecording, "/rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.TryAcquire(jobVerify, "/rec/session"); err == nil {
+		t.Fatal("verify started on a target being recorded to")
+	}
+
+	var waitedFor []jobKind
+	granted := make(chan struct{})
+	go func() {
+		lease, err := rm.Acquire(context.Background(), jobVerify, func(holder jobKind) {
+			waitedFor = append(waitedFor, holder)
+		}, "/rec/session")
+		if err == nil {
+			lease.Release()
+		}
+		close(granted)
+	}()
+	stillBlocked(t, granted, "verify")
+	rec.Release()
+	waitFor(t, granted, "verify to start")
+	if len(waitedFor) != 1 || waitedFor[0] != jobRecording {
+		t.Errorf("verify said it waited for %v, want [recording]", waitedFor)
+	}
+}
+
+func TestExclusiveJobsShareNothing(t *testing.T) {
+	rm := newResourceManager()
+	copyLease, _ := rm.TryAcquire(jobCopy, "/media/usb")
+
+	_, err := rm.TryAcquire(jobFormat, "/media/usb")
+	var busy *busyError
+	if !errors.As(err, &busy) || busy.holder != jobCopy {
+		t.Fatalf("format while copying: %v, want busy with the copy", err)
+	}
+	copyLease.Release()
+
+	format, err := rm.TryAcquire(jobFormat, "/media/usb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer format.Release()
+	for _, kind := range []jobKind{jobRecording, jobCopy, jobImport, jobDelete} {
+		if _, err := rm.TryAcquire(kind, "/media/usb/session"); err == nil {
+			t.Errorf("%s started on a drive being formatted", kind)
+		}
+	}
+
+	// Other paths are free
+	if l, err := rm.TryAcquire(jobRecording, "/rec"); err != nil {
+		t.Errorf("recording to another target refused during a format: %v", err)
+	} else {
+		l.Release()
+	}
+}
+
+func TestWaitsEndWithContext(t *testing.T) {
+	rm := newResourceManager()
+	bench, _ := rm.TryAcquire(jobBenchmark, "/rec")
+	defer bench.Release()
+	rec, _ := rm.TryAcquire(jobRecording, "/rec")
+	defer rec.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	var errs [2]error
+	go func() {
+		_, errs[0] = rm.Acquire(ctx, jobCopy, nil, "/rec")
+		done <- struct{}{}
+	}()
+	go func() {
+		errs[1] = bench.Checkpoint(ctx, nil)
+		done <- struct{}{}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("cancelled wait did not return")
+		}
+	}
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("wait %d returned %v, want context.Canceled", i, err)
+		}
+	}
+}
+
+func TestResourceStress(t *testing.T) {
+	rm := newResourceManager()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// Counts of jobs inside their leases; a format must always be alone
+	var formats, others atomic.Int32
+	var wg sync.WaitGroup
+	job := func(kind jobKind, work func(l *Lease)) {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			l, err := rm.Acquire(ctx, kind, nil, "/rec")
+			if err != nil {
+				return
+			}
+			counter := &others
+			if kind == jobFormat {
+				counter = &formats
+			}
+			counter.Add(1)
+			if formats.Load() > 0 && others.Load() > 0 || formats.Load() > 1 {
+				t.Errorf("%s ran alongside a format", kind)
+			}
+			work(l)
+			counter.Add(-1)
+			l.Release()
+		}
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go job(jobCopy, func(l *Lease) {
+			for j := 0; j < 10; j++ {
+				if l.Checkpoint(ctx, nil) != nil {
+					return
+				}
+			}
+		})
+	}
+	wg.Add(2)
+	go job(jobRecording, func(*Lease) { time.Sleep(time.Millisecond) })
+	go job(jobFormat, func(*Lease) { time.Sleep(time.Millisecond) })
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs deadlocked")
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/ical"
+)
+
+const (
+	scheduleFetchTimeout = 30 * time.Second
+	scheduleMaxFeed      = 4 << 20            // Largest feed read
+	scheduleLookahead    = 7 * 24 * time.Hour // How far ahead events are expanded
+	scheduleLookbehind   = 24 * time.Hour     // Events that started this long ago may still be running
+	scheduleRecheck      = 30 * time.Second   // How often the clock and the event list are refreshed
+
+	// timeError is what adjtimex returns while the clock is not in sync
+	timeError = 5
+	// staUnsync is the kernel clock status bit set until NTP has set the clock
+	staUnsync = 0x40
+)
+
+// scheduleCachePath keeps the last feed that fetched and parsed, for when
+// the server cannot be reached
+var scheduleCachePath = filepath.Join(StateDir, "schedule.ics")
+
+var (
+	// scheduleEvents are the coming events that pass the filter, in start
+	// order, and scheduleSynced whether the clock can be trusted to start
+	// them
+	scheduleEvents []ical.Occurrence
+	scheduleSynced = false
+
+	scheduleTake    = false // The current take was started by the schedule
+	scheduleTakeEnd time.Time
+
+	// scheduleHandled holds the events already started or skipped, so a
+	// take stopped by hand is not started again
+	scheduleHandled = make(map[string]bool)
+)
+
+// startScheduler follows the configured iCal feed in the background
+func startScheduler() {
+	if config.Schedule.URL == "" {
+		return
+	}
+	mutex.Lock()
+	scheduleSynced = clockSynced()
+	mutex.Unlock()
+	go scheduleLoop(config.Schedule)
+}
+
+// scheduleLoop fetches the feed every refresh and keeps the list of coming
+// events and the clock state current. When the feed cannot be fetched, the
+// last one that could is used.
+func scheduleLoop(cfg ScheduleConfig) {
+	cal := loadCachedSchedule()
+	refresh := time.Duration(cfg.RefreshMinutes) * time.Minute
+	var fetched time.Time
+	wasSynced := true
+	for {
+		if fetched.IsZero() || time.Since(fetched) >= refresh {
+			fetched = time.Now()
+			cal = refreshSchedule(cfg.URL, cal)
+		}
+
+		synced := clockSynced()
+		if synced != wasSynced {
+			log.Printf("Schedule: clock synchronized: %v", synced)
+			wasSynced = synced
+		}
+		var events []ical.Occurrence
+		if cal != nil {
+			now := time.Now()
+			events = filterSchedule(cal.Occurrences(now.Add(-scheduleLookbehind), now.Add(scheduleLookahead)), cfg.SummaryFilter)
+		}
+
+		mutex.Lock()
+		scheduleEvents = events
+		scheduleSynced = synced
+		mutex.Unlock()
+		time.Sleep(scheduleRecheck)
+	}
+}
+
+// refreshSchedule fetches the feed, keeping last, the schedule fetched
+// before, if it cannot be fetched or parsed
+func refreshSchedule(url string, last *ical.Calendar) *ical.Calendar {
+	cal, err := fetchSchedule(url)
+	if err == nil {
+		return cal
+	}
+	log.Printf("Schedule: failed to fetch %s: %v", url, err)
+	if last != nil {
+		log.Printf("Schedule: using the last schedule fetched")
+	}
+	return last
+}
+
+// fetchSchedule downloads and parses the feed, caching it once it parses
+func fetchSchedule(url string) (*ical.Calendar, error) {
+	client := &http.Client{Timeout: scheduleFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, scheduleMaxFeed))
+	if err != nil {
+		return nil, err
+	}
+
+	cal, err := parseSchedule(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(scheduleCachePath), 0755); err == nil {
+		tmp := scheduleCachePath + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err == nil {
+			os.Rename(tmp, scheduleCachePath)
+		}
+	}
+	return cal, nil
+}
+
+// loadCachedSchedule reads the feed fetched last time, if any
+func loadCachedSchedule() *ical.Calendar {
+	data, err := os.ReadFile(scheduleCachePath)
+	if err != nil {
+		return nil
+	}
+	cal, err := parseSchedule(data)
+	if err != nil {
+		log.Printf("Schedule: ignoring cached schedule: %v", err)
+		return nil
+	}
+	return cal
+}
+
+// parseSchedule parses a feed, logging the events that had to be left out
+func parseSchedule(data []byte) (*ical.Calendar, error) {
+	cal, err := ical.Parse(bytes.NewReader(data), time.Local)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range cal.Warnings {
+		log.Printf("Schedule: skipping %s", warning)
+	}
+	log.Printf("Schedule: %d events", len(cal.Events))
+	return cal, nil
+}
+
+// filterSchedule keeps the events whose summary contains filter, in any
+// case. An empty filter keeps every event.
+func filterSchedule(events []ical.Occurrence, filter string) []ical.Occurrence {
+	if filter == "" {
+		return events
+	}
+	filter = strings.ToLower(filter)
+	var kept []ical.Occurrence
+	for _, e := range events {
+		if strings.Contains(strings.ToLower(e.Summary), filter) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// clockSynced reports whether the kernel clock has been set by NTP, as
+// timedatectl does
+func clockSynced() bool {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	return err == nil && state != timeError && tx.Status&staUnsync == 0
+}
+
+// occurrenceKey identifies one sitting of an event
+func occurrenceKey(e ical.Occurrence) string {
+	return fmt.Sprintf("%s@%d", e.UID, e.Start.Unix())
+}
+
+// updateSchedule starts takes as scheduled events begin and stops them as
+// they end. A take already running is never taken over: the event is
+// skipped. Must be called with mutex held.
+func updateSchedule() {
+	if config.Schedule.URL == "" {
+		return
+	}
+	now := time.Now()
+
+	for _, e := range scheduleEvents {
+		if now.Before(e.Start) {
+			break
+		}
+		key := occurrenceKey(e)
+		if !now.Before(e.End) || scheduleHandled[key] {
+			continue
+		}
+
+		switch {
+		case isRecording && scheduleTake:
+			// Overlapping or back to back events run as one take
+			scheduleHandled[key] = true
+			if e.End.After(scheduleTakeEnd) {
+				scheduleTakeEnd = e.End
+			}
+		case isRecording:
+			scheduleHandled[key] = true
+			log.Printf("Schedule: %q skipped, already recording", e.Summary)
+			showAlert(i18n.Tf("alert.schedule_busy", e.Summary), 5*time.Second)
+		case !scheduleSynced:
+			// Left until the clock is in sync, if the event is still on
+		case currentState == StateIdle || currentState == StateRecordingSummary:
+			scheduleHandled[key] = true
+			log.Printf("Schedule: starting take for %q until %s", e.Summary, e.End.Format("15:04"))
+			scheduleTake = startRecording() == nil
+			scheduleTakeEnd = e.End
+		}
+	}
+
+	if isRecording && scheduleTake && !now.Before(scheduleTakeEnd) {
+		log.Printf("Schedule: event over, ending take")
+		stopRecording()
+	}
+}
+
+// nextScheduledEvent returns the event running or due next, if any. Must be
+// called with mutex held.
+func nextScheduledEvent() (ical.Occurrence, bool) {
+	now := time.Now()
+	for _, e := range scheduleEvents {
+		if now.Before(e.End) && !scheduleHandled[occurrenceKey(e)] {
+			return e, true
+		}
+	}
+	return ical.Occurrence{}, false
+}
+
+// scheduleIdleText is the idle panel showing the next scheduled event
+func scheduleIdleText() string {
+	e, ok := nextScheduledEvent()
+	if !ok {
+		return ""
+	}
+	when := e.Start.Format("15:04")
+	if e.Start.Format("20060102") != time.Now().Format("20060102") {
+		when = e.Start.Format("Mon 15:04")
+	}
+	return i18n.Tf("idle.schedule_next", when, e.Summary)
+}
+
+// scheduleClockText is the pinned idle panel warning that scheduled takes
+// will not start until the clock is in sync
+func scheduleClockText() string {
+	if config.Schedule.URL == "" || scheduleSynced {
+		return ""
+	}
+	return i18n.T("idle.schedule_unsynced")
+}
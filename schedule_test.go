@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// feedServer serves the current feed, or fails with the current status
+type feedServer struct {
+	mu     sync.Mutex
+	feed   string
+	status int
+}
+
+func (s *feedServer) set(status int, feed string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.feed = status, feed
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.feed))
+}
+
+// testFeed is a feed of one event with the given summary
+func testFeed(summary string) string {
+	return "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1@test\r\nSUMMARY:" + summary +
+		"\r\nDTSTART:20240320T120000Z\r\nDTEND:20240320T130000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestScheduleFallsBackToLastFetched(t *testing.T) {
+	saved := scheduleCachePath
+	scheduleCachePath = filepath.Join(t.TempDir(), "state", "schedule.ics")
+	t.Cleanup(func() { scheduleCachePath = saved })
+
+	feed := &feedServer{}
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	// Nothing fetched yet and nothing cached
+	feed.set(http.StatusServiceUnavailable, "")
+	if cal := refreshSchedule(server.URL, loadCachedSchedule()); cal != nil {
+		t.Fatalf("schedule %+v before any feed was fetched", cal)
+	}
+
+	feed.set(http.StatusOK, testFeed("Lecture"))
+	cal := refreshSchedule(server.URL, nil)
+	if cal == nil || len(cal.Events) != 1 || cal.Events[0].Summary != "Lecture" {
+		t.Fatalf("fetched schedule %+v, want the lecture", cal)
+	}
+
+	// A server error or a page that is not a feed keeps the schedule, and
+	// the cache, as they were
+	for _, fail := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusInternalServerError, testFeed("Error page")},
+		{http.StatusOK, "<html>Sign in</html>"},
+	} {
+		feed.set(fail.status, fail.body)
+		if got := refreshSchedule(server.URL, cal); got != cal {
+			t.Errorf("%d %q replaced the last schedule", fail.status, fail.body)
+		}
+	}
+
+	// After a restart without the server the cached feed is used
+	server.Close()
+	cached := loadCachedSchedule()
+	if got := refreshSchedule(server.URL, cached); got == nil || len(got.Events) != 1 || got.Events[0].Summary != "Lecture" {
+		t.Errorf("schedule %+v after a restart, want the cached lecture", got)
+	}
+
+	// A cache that no longer parses is ignored
+	if err := os.WriteFile(scheduleCachePath, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if loadCachedSchedule() != nil {
+		t.Error("unreadable cache used")
+	}
+}
+
+func TestScheduledTakeEndingOnItsOwnLeavesNextTakeAlone(t *testing.T) {
+	freshIOHealth(t)
+	keepErrorReports(t)
+	mutex.Lock()
+	savedURL, savedEvents, savedTake, savedPeaks := config.Schedule.URL, scheduleEvents, lastTake, recorderPeaks
+	config.Schedule.URL, scheduleEvents = "http://schedule.test/feed.ics", nil
+	recorderPeaks = newPeakRecorder(48000, testChannels, nil)
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		config.Schedule.URL, scheduleEvents, lastTake, recorderPeaks = savedURL, savedEvents, savedTake, savedPeaks
+		scheduleTake, lastTakeFailed, shownError, currentState = false, false, nil, StateIdle
+	})
+
+	// A scheduled take whose only target fails ends by itself
+	r, _ := newTestRecorder(t, 1)
+	failAfter(r, recordBlockFrames, 0)
+	mutex.Lock()
+	recorder, isRecording, currentState = r, true, StateRecording
+	scheduleTake, scheduleTakeEnd = true, time.Now().Add(-time.Minute)
+	mutex.Unlock()
+	r.Start(bytes.NewReader(testSamples(3 * recordBlockFrames)))
+	watchRecorder(r)
+
+	mutex.Lock()
+	ended := recorder == nil && !isRecording
+	mutex.Unlock()
+	if !ended {
+		t.Fatal("take still recording after ending by itself")
+	}
+
+	// A take started by hand afterwards is not ended by the schedule
+	fakeRecording(t)
+	mutex.Lock()
+	defer mutex.Unlock()
+	updateSchedule()
+	if !isRecording || recorder == nil {
+		t.Error("manual take stopped by the schedule")
+	}
+}
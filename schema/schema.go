@@ -0,0 +1,166 @@
+// Package schema versions the files the recorder keeps between runs and
+// migrates older ones forward. It is shared with pi9696ctl so an upgrade can
+// be previewed before it is installed.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration upgrades a file from one version to the next
+type Migration struct {
+	Summary string // What the upgrade changes, as reported by a dry run
+	Apply   func(doc map[string]json.RawMessage) error
+}
+
+// Artifact is a kind of file the recorder keeps between runs
+type Artifact struct {
+	Name    string // Shown on the About screen and by pi9696ctl
+	File    string // Name in the state directory, empty for take sidecars
+	Version int    // Written by this build
+
+	// Migrations[v-1] turns version v into v+1. Append one for every bump
+	// of Version.
+	Migrations []Migration
+}
+
+// NewerError is returned for a file written by a newer version of the
+// recorder, which this build must not overwrite
+type NewerError struct {
+	Artifact  string
+	Version   int // In the file
+	Supported int // Written by this build
+}
+
+func (e *NewerError) Error() string {
+	return fmt.Sprintf("%s created by a newer version (schema %d, this build supports %d)", e.Artifact, e.Version, e.Supported)
+}
+
+// VersionOf returns the version a file declares. Files from before
+// versioning have none, or a "version" field that is not a number, and are
+// version 1.
+func VersionOf(doc map[string]json.RawMessage) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 1, nil
+	}
+	if v < 1 {
+		return v, fmt.Errorf("unsupported version %d", v)
+	}
+	return v, nil
+}
+
+// Upgrade migrates file content to the current version, returning it as a
+// document and the version it was found at. A file from a newer version is
+// returned as it is, with a *NewerError.
+func (a *Artifact) Upgrade(data []byte) (map[string]json.RawMessage, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	from, err := VersionOf(doc)
+	if err != nil {
+		return nil, from, err
+	}
+	if from > a.Version {
+		return doc, from, &NewerError{Artifact: a.Name, Version: from, Supported: a.Version}
+	}
+	for v := from; v < a.Version; v++ {
+		if err := a.Migrations[v-1].Apply(doc); err != nil {
+			return nil, from, fmt.Errorf("migrating from version %d: %v", v, err)
+		}
+	}
+	doc["version"] = json.RawMessage(fmt.Sprint(a.Version))
+	return doc, from, nil
+}
+
+// Decode reads file content into v, migrating it from an older version. A
+// file from a newer version is decoded as far as its fields are known and a
+// *NewerError returned with it, so the caller can use it but not save over
+// it.
+func (a *Artifact) Decode(data []byte, v any) (int, error) {
+	doc, from, err := a.Upgrade(data)
+	if doc == nil {
+		return from, err
+	}
+	body, merr := json.Marshal(doc)
+	if merr == nil {
+		merr = json.Unmarshal(body, v)
+	}
+	if merr != nil {
+		return from, merr
+	}
+	return from, err
+}
+
+// Newer returns a *NewerError if file content is from a newer version, and
+// nil otherwise
+func (a *Artifact) Newer(data []byte) error {
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	if v, _ := VersionOf(doc); v > a.Version {
+		return &NewerError{Artifact: a.Name, Version: v, Supported: a.Version}
+	}
+	return nil
+}
+
+// Pending returns what upgrading a file from version from would change
+func (a *Artifact) Pending(from int) []string {
+	var changes []string
+	for v := max(from, 1); v < a.Version; v++ {
+		changes = append(changes, a.Migrations[v-1].Summary)
+	}
+	return changes
+}
+
+// nest moves every field of a file from before versioning, which was a bare
+// map, under key
+func nest(key string) func(doc map[string]json.RawMessage) error {
+	return func(doc map[string]json.RawMessage) error {
+		body, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		clear(doc)
+		doc[key] = body
+		return nil
+	}
+}
+
+// added upgrades a file to a version that only adds fields. The recorder
+// reads an older file over its configured defaults, so the new fields keep
+// those until they are saved.
+func added(doc map[string]json.RawMessage) error {
+	return nil
+}
+
+// The files the recorder versions
+var (
+	Settings = Artifact{Name: "settings", File: "settings.json", Version: 2, Migrations: []Migration{
+		{Summary: "add the display, monitor and arming settings, at their configured defaults", Apply: added},
+	}}
+
+	Wear = Artifact{Name: "wear", File: "wear.json", Version: 2, Migrations: []Migration{
+		{Summary: `move the write counters under "counters"`, Apply: nest("counters")},
+	}}
+
+	Recent = Artifact{Name: "recent", File: "recent.json", Version: 2, Migrations: []Migration{
+		{Summary: `move the recent entries under "entries"`, Apply: nest("entries")},
+	}}
+
+	Maintenance = Artifact{Name: "maintenance", File: "maintenance.json", Version: 1}
+
+	TakeInfo = Artifact{Name: "take", Version: 2, Migrations: []Migration{
+		{Summary: "hash the sample data with XXH64; older takes keep their MD5 sums", Apply: added},
+	}}
+)
+
+// All lists the versioned files, state directory files first
+var All = []*Artifact{&Settings, &Wear, &Recent, &Maintenance, &TakeInfo}
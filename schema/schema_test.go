@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestEveryBumpHasAMigration(t *testing.T) {
+	for _, a := range All {
+		if len(a.Migrations) != a.Version-1 {
+			t.Errorf("%s is at version %d with %d migrations", a.Name, a.Version, len(a.Migrations))
+		}
+		for i, m := range a.Migrations {
+			if m.Summary == "" || m.Apply == nil {
+				t.Errorf("%s migration from version %d has no summary or does nothing", a.Name, i+1)
+			}
+		}
+		if got := a.Pending(a.Version); len(got) != 0 {
+			t.Errorf("%s at its current version has changes pending: %q", a.Name, got)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	tests := []struct {
+		artifact *Artifact
+		old      string
+		want     string
+	}{
+		// Settings only gained fields, which keep their defaults
+		{&Settings, `{"version": 1, "settings": {"sample_rate": 96000}}`, `{"version": 2, "settings": {"sample_rate": 96000}}`},
+		// Wear and recent entries were bare maps before versioning
+		{&Wear, `{"sd": 12, "usb": 3}`, `{"version": 2, "counters": {"sd": 12, "usb": 3}}`},
+		{&Recent, `{"note": ["one", "two"], "marker": ["Applause"]}`, `{"version": 2, "entries": {"note": ["one", "two"], "marker": ["Applause"]}}`},
+		// Takes from before XXH64 keep their MD5 sums
+		{&TakeInfo, `{"name": "take", "data_md5": ["abc"]}`, `{"version": 2, "name": "take", "data_md5": ["abc"]}`},
+		{&Maintenance, `{"started": "2024-03-20T02:00:00Z", "verified": 12}`, `{"version": 1, "started": "2024-03-20T02:00:00Z", "verified": 12}`},
+	}
+	for _, tt := range tests {
+		doc, from, err := tt.artifact.Upgrade([]byte(tt.old))
+		if err != nil {
+			t.Errorf("%s: %v", tt.artifact.Name, err)
+			continue
+		}
+		if from != 1 {
+			t.Errorf("%s: found at version %d, want 1", tt.artifact.Name, from)
+		}
+		var want map[string]any
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(doc)
+		var got map[string]any
+		json.Unmarshal(body, &got)
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s upgraded to %s, want %s", tt.artifact.Name, gotJSON, wantJSON)
+		}
+
+		// An upgraded file is current and upgrades to itself
+		again, from, err := tt.artifact.Upgrade(body)
+		if err != nil || from != tt.artifact.Version {
+			t.Errorf("%s: upgraded file found at version %d: %v", tt.artifact.Name, from, err)
+		}
+		if againJSON, _ := json.Marshal(again); string(againJSON) != string(body) {
+			t.Errorf("%s: upgraded file changed again to %s", tt.artifact.Name, againJSON)
+		}
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	for _, tt := range []struct {
+		doc  string
+		want int
+		ok   bool
+	}{
+		{`{}`, 1, true},
+		{`{"version": "1.2"}`, 1, true}, // From before versioning
+		{`{"version": 3}`, 3, true},
+		{`{"version": 0}`, 0, false},
+		{`{"version": -2}`, -2, false},
+	} {
+		var doc map[string]json.RawMessage
+		json.Unmarshal([]byte(tt.doc), &doc)
+		v, err := VersionOf(doc)
+		if v != tt.want || (err == nil) != tt.ok {
+			t.Errorf("VersionOf(%s) = %d, %v; want %d", tt.doc, v, err, tt.want)
+		}
+	}
+	if _, _, err := Recent.Upgrade([]byte(`{"version": 0, "entries": {}}`)); err == nil {
+		t.Error("version 0 upgraded")
+	}
+}
+
+func TestNewerFileIsReadNotUpgraded(t *testing.T) {
+	data := []byte(`{"version": 9, "entries": {"note": ["from the future"]}, "pinned": ["kept"]}`)
+	var newer *NewerError
+
+	doc, from, err := Recent.Upgrade(data)
+	if !errors.As(err, &newer) || newer.Version != 9 || newer.Supported != Recent.Version || from != 9 {
+		t.Fatalf("Upgrade() = version %d, %v; want a NewerError for version 9", from, err)
+	}
+	if string(doc["version"]) != "9" || doc["pinned"] == nil {
+		t.Errorf("newer file changed: %v", doc)
+	}
+
+	// Its known fields are still read
+	var file struct {
+		Entries map[string][]string `json:"entries"`
+	}
+	if _, err := Recent.Decode(data, &file); !errors.As(err, &newer) {
+		t.Errorf("Decode() = %v, want a NewerError", err)
+	}
+	if !slices.Equal(file.Entries["note"], []string{"from the future"}) {
+		t.Errorf("decoded %v from the newer file", file.Entries)
+	}
+
+	if err := Recent.Newer(data); !errors.As(err, &newer) {
+		t.Errorf("Newer() = %v for version 9", err)
+	}
+	for _, current := range []string{`{"version": 2}`, `{}`, `not json`} {
+		if err := Recent.Newer([]byte(current)); err != nil {
+			t.Errorf("Newer(%s) = %v", current, err)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	for _, from := range []int{0, 1} {
+		if got := Wear.Pending(from); !slices.Equal(got, []string{Wear.Migrations[0].Summary}) {
+			t.Errorf("Wear.Pending(%d) = %q", from, got)
+		}
+	}
+	if got := Maintenance.Pending(1); len(got) != 0 {
+		t.Errorf("Maintenance.Pending(1) = %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	screenStreamInterval = 500 * time.Millisecond // 2 fps
+	screenMaxClients     = 4
+	screenJPEGQuality    = 90
+	screenBoundary       = "pi9696frame"
+)
+
+// screenClients counts the open screen requests. Frames are only copied and
+// encoded for a request, so nothing is done while none are open.
+var screenClients atomic.Int32
+
+// screenCache keeps the encodings of the last frame, so an unchanged screen
+// is not encoded again for each client and tick
+type screenCache struct {
+	mutex sync.Mutex
+	hash  uint64
+	png   []byte
+	jpeg  []byte
+}
+
+var screenEncoded screenCache
+
+// frameHash fingerprints a frame's pixels
+func frameHash(frame *image.Gray) uint64 {
+	h := fnv.New64a()
+	h.Write(frame.Pix)
+	return h.Sum64()
+}
+
+// encode returns the frame as a PNG or JPEG, from the cache when the frame
+// has not changed since it was last encoded
+func (c *screenCache) encode(frame *image.Gray, format string) ([]byte, error) {
+	hash := frameHash(frame)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if hash != c.hash {
+		c.hash, c.png, c.jpeg = hash, nil, nil
+	}
+	cached := &c.png
+	if format == "jpeg" {
+		cached = &c.jpeg
+	}
+	if *cached != nil {
+		return *cached, nil
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, frame, &jpeg.Options{Quality: screenJPEGQuality})
+	} else {
+		err = png.Encode(&buf, frame)
+	}
+	if err != nil {
+		return nil, err
+	}
+	*cached = buf.Bytes()
+	return *cached, nil
+}
+
+// screenFrame copies the last frame drawn, or returns nil without a display
+func screenFrame() *image.Gray {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return hwManager.Snapshot()
+}
+
+// startHTTP serves the screen over HTTP when a listen address is configured,
+// and takes record and marker commands when a token is set too
+func startHTTP() {
+	if config.HTTP.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/screen.png", screenHandler(serveScreenPNG))
+	mux.HandleFunc("/screen.mjpeg", screenHandler(serveScreenMJPEG))
+	for path, command := range httpCommands {
+		mux.HandleFunc(path, controlHandler(command))
+	}
+	server := &http.Server{Addr: config.HTTP.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("HTTP: serving the screen on %s", config.HTTP.Listen)
+		if err := server.ListenAndServe(); err != nil {
+			setLastError("HTTP server on %s stopped: %v", config.HTTP.Listen, err)
+		}
+	}()
+}
+
+// screenHandler checks the token and client limit, and counts the client
+// for as long as the request is served
+func screenHandler(serve func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		if !httpAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pi9696"`)
+			http.Error(w, "token required", http.StatusUnauthorized)
+			return
+		}
+		if screenClients.Add(1) > screenMaxClients {
+			screenClients.Add(-1)
+			http.Error(w, "too many viewers", http.StatusServiceUnavailable)
+			return
+		}
+		defer screenClients.Add(-1)
+		serve(w, r)
+	}
+}
+
+// httpAuthorized reports whether the request carries the configured token,
+// as a bearer token or a token query parameter. Without a token every
+// request is allowed.
+func httpAuthorized(r *http.Request) bool {
+	want := config.HTTP.Token
+	if want == "" {
+		return true
+	}
+	got := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// serveScreenPNG sends the current screen as a single PNG
+func serveScreenPNG(w http.ResponseWriter, r *http.Request) {
+	frame := screenFrame()
+	if frame == nil {
+		http.Error(w, "no display", http.StatusServiceUnavailable)
+		return
+	}
+	data, err := screenEncoded.encode(frame, "png")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// serveScreenMJPEG streams the screen as MJPEG at 2 fps until the client
+// goes away
+func serveScreenMJPEG(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+screenBoundary)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	log.Printf("HTTP: screen stream opened by %s", r.RemoteAddr)
+	defer log.Printf("HTTP: screen stream closed by %s", r.RemoteAddr)
+
+	ticker := time.NewTicker(screenStreamInterval)
+	defer ticker.Stop()
+	for {
+		if frame := screenFrame(); frame != nil {
+			data, err := screenEncoded.encode(frame, "jpeg")
+			if err != nil {
+				log.Printf("HTTP: failed to encode screen: %v", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", screenBoundary, len(data)); err != nil {
+				return
+			}
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			if _, err := w.Write([]byte("\r\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
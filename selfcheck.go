@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/status"
+)
+
+// External dependencies checked at startup
+const (
+	depCapture = "capture" // ./save_to_file, without which nothing records
+	depFonts   = "fonts"
+	depIcons   = "icons"
+	depSudo    = "sudo"   // Shutdown, restart and format
+	depFormat  = "format" // umount and mkfs.vfat
+	depMonitor = "monitor"
+	depClock   = "clock" // timedatectl, for the preflight clock check
+)
+
+// sudoProbeTimeout bounds the sudo permission probe
+const sudoProbeTimeout = 3 * time.Second
+
+// sbinDirs are searched for system tools that are only on root's PATH
+var sbinDirs = []string{"/sbin", "/usr/sbin"}
+
+// dependency is an external the recorder relies on. A fatal one stops
+// recording; anything else only loses the features that use it.
+type dependency struct {
+	id     string
+	fatal  bool
+	reason string // i18n key shown on the items it disables
+	check  func() error
+}
+
+var dependencies = []dependency{
+	{depCapture, true, "reason.no_capture", checkCapture},
+	{depFonts, false, "", func() error { return checkDir("./fonts") }},
+	{depIcons, false, "", func() error { return checkDir("./svg") }},
+	{depSudo, false, "reason.no_sudo", checkSudo},
+	{depFormat, false, "reason.no_format", func() error { return checkCommands("umount", "mkfs.vfat") }},
+	{depMonitor, false, "reason.no_monitor", func() error { return checkCommands("aplay") }},
+	{depClock, false, "", func() error { return checkCommands("timedatectl") }},
+}
+
+// selfCheck holds the startup results, in the order of dependencies
+var selfCheck []status.Dependency
+
+// runSelfCheck checks every dependency, logs what is missing and warns on
+// screen. Must be called with mutex held.
+func runSelfCheck() {
+	failed, fatal := 0, false
+	for _, dep := range dependencies {
+		result := status.Dependency{ID: dep.id, Severity: "degraded", OK: true}
+		if dep.fatal {
+			result.Severity = "fatal"
+		}
+		if err := dep.check(); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+			failed++
+			fatal = fatal || dep.fatal
+			log.Printf("Self-check: %s missing (%s): %v", dep.id, result.Severity, err)
+		}
+		selfCheck = append(selfCheck, result)
+	}
+
+	switch {
+	case failed == 0:
+		log.Printf("Self-check passed")
+	case fatal:
+		noteError("Self-check failed: recording is unavailable")
+		showAlert(i18n.Tf("alert.selfcheck_fatal", failed), time.Minute)
+	default:
+		showAlert(i18n.Tf("alert.selfcheck", failed), 15*time.Second)
+	}
+}
+
+// selfCheckFatal reports whether a dependency needed to record is missing
+func selfCheckFatal() bool {
+	for _, result := range selfCheck {
+		if !result.OK && result.Severity == "fatal" {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyReason explains why an item is unavailable if dependency id is
+// missing, or returns "" if it is present
+func dependencyReason(id string) string {
+	for i, dep := range dependencies {
+		if dep.id == id && i < len(selfCheck) && !selfCheck[i].OK {
+			return i18n.T(dep.reason)
+		}
+	}
+	return ""
+}
+
+// selfCheckLines lists the missing dependencies for the About screen
+func selfCheckLines() []string {
+	var lines []string
+	for _, result := range selfCheck {
+		if !result.OK {
+			lines = append(lines, i18n.Tf("about.missing", result.ID, result.Severity))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, i18n.T("about.selfcheck_ok"))
+	}
+	return lines
+}
+
+// checkCapture looks for the capture pipeline, which demo mode replaces
+func checkCapture() error {
+	if demoMode {
+		return nil
+	}
+	return checkExecutable("./save_to_file")
+}
+
+// checkExecutable reports a missing or non-executable file
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+// checkDir reports a missing directory
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// checkCommands looks for each command on the PATH and in the sbin
+// directories, where sudo finds system tools
+func checkCommands(names ...string) error {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err == nil {
+			continue
+		}
+		found := false
+		for _, dir := range sbinDirs {
+			if checkExecutable(filepath.Join(dir, name)) == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s not found", name)
+		}
+	}
+	return nil
+}
+
+// checkSudo confirms sudo runs without asking for a password
+func checkSudo() error {
+	ctx, cancel := context.WithTimeout(context.Background(), sudoProbeTimeout)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "sudo", "-n", "true").Run(); err != nil {
+		return fmt.Errorf("sudo -n failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pi9696/i18n"
+)
+
+// fakeTools replaces the PATH and the sbin directories with empty
+// directories for the test and returns them
+func fakeTools(t *testing.T) (bin, sbin string) {
+	t.Helper()
+	bin, sbin = t.TempDir(), t.TempDir()
+	t.Setenv("PATH", bin)
+	saved := sbinDirs
+	sbinDirs = []string{sbin}
+	t.Cleanup(func() { sbinDirs = saved })
+	return bin, sbin
+}
+
+// writeTool writes a shell script tool into dir
+func writeTool(t *testing.T, dir, name, body string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	bin, sbin := fakeTools(t)
+	writeTool(t, bin, "umount", "exit 0", 0755)
+	writeTool(t, sbin, "mkfs.vfat", "exit 0", 0755)
+	writeTool(t, sbin, "aplay", "exit 0", 0644)
+	if err := os.Mkdir(filepath.Join(sbin, "timedatectl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// On the PATH or only where sudo looks
+	if err := checkCommands("umount", "mkfs.vfat"); err != nil {
+		t.Errorf("checkCommands(umount, mkfs.vfat) = %v", err)
+	}
+	for _, name := range []string{"aplay", "timedatectl", "blkid"} {
+		if err := checkCommands("umount", name); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("checkCommands(umount, %s) = %v, want %s not found", name, err, name)
+		}
+	}
+}
+
+func TestCheckSudo(t *testing.T) {
+	bin, _ := fakeTools(t)
+	if err := checkSudo(); err == nil {
+		t.Error("sudo found with none on the PATH")
+	}
+	// sudo -n fails when it would have to ask for a password
+	writeTool(t, bin, "sudo", `[ "$1" = -n ] || exit 2; exit 1`, 0755)
+	if err := checkSudo(); err == nil {
+		t.Error("sudo that wants a password passed")
+	}
+	writeTool(t, bin, "sudo", `[ "$1" = -n ] || exit 2; exit 0`, 0755)
+	if err := checkSudo(); err != nil {
+		t.Errorf("passwordless sudo: %v", err)
+	}
+}
+
+func TestSelfCheckDisablesDependents(t *testing.T) {
+	bin, sbin := fakeTools(t)
+	writeTool(t, bin, "sudo", "exit 1", 0755)
+	writeTool(t, bin, "aplay", "exit 0", 0755)
+	writeTool(t, sbin, "umount", "exit 0", 0755)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	saved, demo := selfCheck, demoMode
+	t.Cleanup(func() {
+		selfCheck, demoMode = saved, demo
+		takeAlert()
+	})
+
+	for _, demo := range []bool{false, true} {
+		selfCheck, demoMode = nil, demo
+		runSelfCheck()
+		if len(selfCheck) != len(dependencies) {
+			t.Fatalf("%d results for %d dependencies", len(selfCheck), len(dependencies))
+		}
+		// Without the capture pipeline nothing records, except in demo mode
+		if selfCheckFatal() == demo {
+			t.Errorf("demo mode %t: fatal %t", demo, !demo)
+		}
+		if takeAlert() == "" {
+			t.Errorf("demo mode %t: missing dependencies not shown", demo)
+		}
+	}
+
+	for _, tt := range []struct {
+		id, reason string
+	}{
+		{depSudo, "reason.no_sudo"},
+		{depFormat, "reason.no_format"}, // umount is there, mkfs.vfat is not
+		{depMonitor, ""},
+	} {
+		want := ""
+		if tt.reason != "" {
+			want = i18n.T(tt.reason)
+		}
+		if got := dependencyReason(tt.id); got != want {
+			t.Errorf("%s disables items with %q, want %q", tt.id, got, want)
+		}
+	}
+
+	// Items that need sudo are disabled with the reason rather than failing
+	// when used
+	openMenu(StateSystemOptions)
+	for _, item := range currentMenuItems() {
+		if item.ID == "shutdown" && (!item.Disabled || item.Reason != i18n.T("reason.no_sudo")) {
+			t.Errorf("shutdown item disabled %t for %q without sudo", item.Disabled, item.Reason)
+		}
+	}
+	currentState = StateIdle
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// Settings are the user-adjustable recorder settings. Show configs and
+// settings export/import share this schema.
+type Settings struct {
+	SampleRate    int      `json:"sample_rate"`
+	Channels      int      `json:"channels"`
+	ArmedChannels []int    `json:"armed_channels,omitempty"` // 1-based; empty arms every channel
+	FilePrefix    string   `json:"file_prefix,omitempty"`
+	Session       string   `json:"session,omitempty"` // Folder takes are written to within each target
+	LTCChannel    int      `json:"ltc_channel"`
+	Language      string   `json:"language,omitempty"`
+	PowerProfile  string   `json:"power_profile,omitempty"`
+	RemoteOff     []string `json:"remote_off,omitempty"` // Remote interfaces whose commands are refused
+
+	ChannelNames map[int]string `json:"channel_names,omitempty"` // 1-based channel to name
+
+	LargeText     bool   `json:"large_text"`
+	ClickFlash    bool   `json:"click_flash"`
+	ConfirmStop   bool   `json:"confirm_stop"`
+	MonitorDevice string `json:"monitor_device,omitempty"` // Empty picks the first output
+	MonitorVolume int    `json:"monitor_volume"`           // Percent
+	ChaseArmed    bool   `json:"chase_armed"`
+	AutoRecord    bool   `json:"auto_record"`          // Auto-record armed
+	IdlePanel     string `json:"idle_panel,omitempty"` // Idle screen panel last chosen by hand
+}
+
+var (
+	armedChannels []int // 1-based, nil when every channel is armed
+	filePrefix    = "recording"
+	sessionName   = ""
+)
+
+// currentSettings captures the active settings. Must be called with mutex held.
+func currentSettings() Settings {
+	return Settings{
+		SampleRate:    sampleRates[sampleRateIdx],
+		Channels:      channelCount,
+		ArmedChannels: append([]int(nil), armedChannels...),
+		FilePrefix:    filePrefix,
+		Session:       sessionName,
+		LTCChannel:    ltcChannel,
+		Language:      i18n.Language(),
+		PowerProfile:  powerProfile,
+		RemoteOff:     remoteOffNames(),
+		ChannelNames:  maps.Clone(channelNames),
+		LargeText:     largeText,
+		ClickFlash:    clickFlash,
+		ConfirmStop:   confirmStop,
+		MonitorDevice: monitorDevice,
+		MonitorVolume: monitorVolume,
+		ChaseArmed:    chaseArmed,
+		AutoRecord:    autoArmed,
+		IdlePanel:     idlePanel,
+	}
+}
+
+// Validate checks the settings are usable on this unit
+func (s Settings) Validate() error {
+	rateIdx := sampleRateIndex(s.SampleRate)
+	if rateIdx < 0 {
+		return fmt.Errorf("unsupported sample_rate %d", s.SampleRate)
+	}
+	if s.Channels < 1 || s.Channels > MaxChannelCount {
+		return fmt.Errorf("channels must be 1-%d, got %d", MaxChannelCount, s.Channels)
+	}
+
+	seen := make(map[int]bool)
+	for _, ch := range s.ArmedChannels {
+		if ch < 1 || ch > s.Channels {
+			return fmt.Errorf("armed channel %d is outside 1-%d", ch, s.Channels)
+		}
+		if seen[ch] {
+			return fmt.Errorf("armed channel %d is listed twice", ch)
+		}
+		seen[ch] = true
+	}
+
+	if err := validateName("file_prefix", s.FilePrefix); err != nil {
+		return err
+	}
+	if err := validateName("session", s.Session); err != nil {
+		return err
+	}
+	if s.LTCChannel < 0 || s.LTCChannel > s.Channels {
+		return fmt.Errorf("ltc_channel must be 0 (off) or 1-%d, got %d", s.Channels, s.LTCChannel)
+	}
+	if s.Language != "" && !i18n.Has(s.Language) {
+		return fmt.Errorf("unknown language %q", s.Language)
+	}
+	if s.PowerProfile != "" && !validPowerProfile(s.PowerProfile) {
+		return fmt.Errorf("unknown power profile %q", s.PowerProfile)
+	}
+	for _, name := range s.RemoteOff {
+		if !remoteInterfaceNamed(name) {
+			return fmt.Errorf("unknown remote interface %q", name)
+		}
+	}
+	if err := validateChannelNames(s.ChannelNames); err != nil {
+		return fmt.Errorf("channel_names: %v", err)
+	}
+	if s.MonitorVolume < 0 || s.MonitorVolume > 100 {
+		return fmt.Errorf("monitor_volume must be 0-100, got %d", s.MonitorVolume)
+	}
+	if s.ChaseArmed && s.LTCChannel == 0 {
+		return fmt.Errorf("chase_armed needs an ltc_channel")
+	}
+	if s.IdlePanel != "" && !infoPanelNamed(s.IdlePanel) {
+		return fmt.Errorf("unknown idle_panel %q", s.IdlePanel)
+	}
+	return nil
+}
+
+// validateName rejects names that cannot be used as a single path element
+func validateName(field, name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%s %q is not a valid file name", field, name)
+	}
+	return nil
+}
+
+// armed returns the channels the settings arm in order, or nil for every
+// channel
+func (s Settings) armed() []int {
+	if len(s.ArmedChannels) == 0 || len(s.ArmedChannels) >= s.Channels {
+		return nil
+	}
+	armed := append([]int(nil), s.ArmedChannels...)
+	sort.Ints(armed)
+	return armed
+}
+
+// Settings that shape the files of a take and are locked while it records.
+// Bit depth and file format are fixed at build time.
+const (
+	lockedSampleRate = "sample_rate"
+	lockedChannels   = "channels"
+)
+
+// recordingLockedError is returned when a setting is changed while it is
+// locked by a take
+type recordingLockedError struct {
+	setting string
+}
+
+func (e *recordingLockedError) Error() string {
+	return fmt.Sprintf("%s cannot change while recording", e.setting)
+}
+
+// checkUnlocked refuses a change to a setting locked by the take in
+// progress. Must be called with mutex held.
+func checkUnlocked(setting string) error {
+	if isRecording || startingRecorder != nil {
+		return &recordingLockedError{setting: setting}
+	}
+	return nil
+}
+
+// checkSettingsUnlocked refuses settings that would change a locked setting.
+// Must be called with mutex held.
+func checkSettingsUnlocked(s Settings) error {
+	if sampleRateIndex(s.SampleRate) != sampleRateIdx {
+		if err := checkUnlocked(lockedSampleRate); err != nil {
+			return err
+		}
+	}
+	if s.Channels != channelCount || !slices.Equal(s.armed(), armedChannels) {
+		return checkUnlocked(lockedChannels)
+	}
+	return nil
+}
+
+// lockedMessage is the alert shown when a change is refused because of err
+func lockedMessage(err error) string {
+	if locked, ok := err.(*recordingLockedError); ok {
+		return i18n.Tf("alert.setting_locked", i18n.T("locked."+locked.setting))
+	}
+	return err.Error()
+}
+
+// alertIfLocked wraps a setter for a menu, showing why a change was refused
+func alertIfLocked(adjust func(direction int) error) func(direction int) {
+	return func(direction int) {
+		if err := adjust(direction); err != nil {
+			showAlert(lockedMessage(err), 3*time.Second)
+		}
+	}
+}
+
+// applySettings makes validated settings active. Must be called with mutex held.
+func applySettings(s Settings) {
+	sampleRateIdx = sampleRateIndex(s.SampleRate)
+	channelCount = s.Channels
+	armedChannels = s.armed()
+	filePrefix = s.FilePrefix
+	if filePrefix == "" {
+		filePrefix = "recording"
+	}
+	sessionName = s.Session
+	if s.LTCChannel != ltcChannel {
+		setLTCChannel(s.LTCChannel)
+	}
+	if s.Language != "" {
+		i18n.SetLanguage(s.Language)
+	}
+	if s.PowerProfile != "" && s.PowerProfile != powerProfile {
+		applyPowerProfile(s.PowerProfile)
+	}
+	remoteOff = make(map[string]bool)
+	for _, name := range s.RemoteOff {
+		remoteOff[name] = true
+	}
+	channelNames = s.ChannelNames
+	largeText = s.LargeText
+	clickFlash = s.ClickFlash
+	confirmStop = s.ConfirmStop
+	monitorDevice = s.MonitorDevice
+	if s.MonitorVolume != monitorVolume {
+		monitorVolume = s.MonitorVolume
+		if monitor != nil {
+			monitor.SetGain(monitorGain())
+		}
+	}
+	chaseArmed = s.ChaseArmed
+	if s.AutoRecord != autoArmed {
+		toggleAutoRecord()
+	}
+	if s.IdlePanel != idlePanel {
+		showIdlePanel(s.IdlePanel)
+	}
+}
+
+// adjustLanguage steps through the available UI languages
+func adjustLanguage(direction int) {
+	languages := i18n.Languages()
+	idx := 0
+	for i, code := range languages {
+		if code == i18n.Language() {
+			idx = i
+		}
+	}
+	idx = (idx + direction + len(languages)) % len(languages)
+	i18n.SetLanguage(languages[idx])
+}
+
+// sampleRateIndex returns the index of rate in sampleRates, or -1
+func sampleRateIndex(rate int) int {
+	for i, r := range sampleRates {
+		if r == rate {
+			return i
+		}
+	}
+	return -1
+}
+
+// armedChannelIndexes returns the 0-based input channels written to disk,
+// or nil when every channel is armed
+func armedChannelIndexes() []int {
+	if len(armedChannels) == 0 {
+		return nil
+	}
+	indexes := make([]int, len(armedChannels))
+	for i, ch := range armedChannels {
+		indexes[i] = ch - 1
+	}
+	return indexes
+}
+
+// recordedChannelCount is the number of channels written to each file
+func recordedChannelCount() int {
+	if len(armedChannels) > 0 {
+		return len(armedChannels)
+	}
+	return channelCount
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi9696/schema"
+)
+
+// settingsFlushInterval is the longest a change waits to be saved, so encoder
+// spins are written once rather than on every detent
+const settingsFlushInterval = 2 * time.Second
+
+// settingsPath holds the settings restored at startup. The previous good copy
+// is kept next to it with a .bak suffix.
+var settingsPath = filepath.Join(StateDir, schema.Settings.File)
+
+// settingsFile is the on-disk form of the settings
+type settingsFile struct {
+	Version  int             `json:"version"`
+	Settings json.RawMessage `json:"settings"`
+}
+
+var (
+	// savedSettings is the file content last loaded or written. A snapshot
+	// that encodes the same is not dirty and is not written again.
+	savedSettings []byte
+
+	// settingsFlushMutex keeps saves from overlapping
+	settingsFlushMutex sync.Mutex
+)
+
+// encodeSettings builds the settings file content
+func encodeSettings(s Settings) ([]byte, error) {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(settingsFile{Version: schema.Settings.Version, Settings: body}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeSettings reads settings file content over base, migrating older
+// versions. Settings the file leaves out, as in a file from before they
+// were saved, keep their base values. A file from a newer version gives a
+// *schema.NewerError, alone if its settings could still be read.
+func decodeSettings(data []byte, base Settings) (Settings, error) {
+	s := base
+	s.ArmedChannels = slices.Clone(base.ArmedChannels)
+	s.RemoteOff = slices.Clone(base.RemoteOff)
+	s.ChannelNames = maps.Clone(base.ChannelNames)
+	var file settingsFile
+	_, newerErr := schema.Settings.Decode(data, &file)
+	if newerErr != nil && !errors.As(newerErr, new(*schema.NewerError)) {
+		return s, newerErr
+	}
+	if err := json.Unmarshal(file.Settings, &s); err != nil {
+		return s, errors.Join(newerErr, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, errors.Join(newerErr, err)
+	}
+	return s, newerErr
+}
+
+// readSettingsFile loads the settings at path over base, falling back to
+// the backup copy if the primary is missing or corrupt. A file from a newer
+// version is not replaced by its backup.
+func readSettingsFile(path string, base Settings) (Settings, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var s Settings
+		if s, err = decodeSettings(data, base); err == nil || errors.As(err, new(*schema.NewerError)) {
+			return s, err
+		}
+	}
+	primaryErr := err
+
+	data, err = os.ReadFile(path + ".bak")
+	if err != nil {
+		return Settings{}, primaryErr
+	}
+	s, err := decodeSettings(data, base)
+	if err != nil {
+		return Settings{}, fmt.Errorf("%v; backup: %v", primaryErr, err)
+	}
+	log.Printf("Settings file %s unusable (%v), restored the backup", path, primaryErr)
+	return s, nil
+}
+
+// writeSettingsFile replaces the settings at path so that a power cut at any
+// point leaves either the old or the new settings readable. The file being
+// replaced becomes the backup if it is still good.
+func writeSettingsFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if old, err := os.ReadFile(path); err == nil {
+		if _, err := decodeSettings(old, Settings{}); err == nil {
+			if err := os.Rename(path, path+".bak"); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory so renames within it survive a power cut
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// loadSettings restores the settings saved by the last run. Must be called
+// with mutex held.
+func loadSettings() {
+	s, err := readSettingsFile(settingsPath, currentSettings())
+	var newer *schema.NewerError
+	if errors.As(err, &newer) {
+		// Used as far as they are understood, and never saved over
+		noteNewerState(settingsPath, newer)
+		if err != error(newer) {
+			log.Printf("Settings from a newer version not understood, using defaults: %v", err)
+			return
+		}
+		applySettings(s)
+		return
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			reportError("Failed to load settings, using defaults", newOpError(errSettingsLoad, err))
+		}
+		return
+	}
+	applySettings(s)
+	if data, err := encodeSettings(currentSettings()); err == nil {
+		savedSettings = data
+	}
+	log.Printf("Restored settings from %s", settingsPath)
+}
+
+// keepDefaultSettings runs on the defaults without restoring the saved
+// settings, as in safe mode. They are only saved over once a setting is
+// changed, and never if they are from a newer version. Must be called with
+// mutex held.
+func keepDefaultSettings() {
+	if data, err := os.ReadFile(settingsPath); err == nil {
+		var newer *schema.NewerError
+		if errors.As(schema.Settings.Newer(data), &newer) {
+			noteNewerState(settingsPath, newer)
+		}
+	}
+	if data, err := encodeSettings(currentSettings()); err == nil {
+		savedSettings = data
+	}
+	log.Printf("Saved settings in %s not restored, using defaults", settingsPath)
+}
+
+// flushSettings saves a settings snapshot if it differs from the last save
+func flushSettings(s Settings) {
+	settingsFlushMutex.Lock()
+	defer settingsFlushMutex.Unlock()
+
+	data, err := encodeSettings(s)
+	if err != nil {
+		log.Printf("Failed to encode settings: %v", err)
+		return
+	}
+	if bytes.Equal(data, savedSettings) || !stateWritable() {
+		// Kept in memory only on a degraded card
+		return
+	}
+	if err := writeSettingsFile(settingsPath, data); err != nil {
+		noteWriteError(settingsPath, "settings", err)
+		log.Printf("Failed to save settings: %v", err)
+		return
+	}
+	savedSettings = data
+}
+
+// flushOnSignal ends any take and saves the settings when the service is
+// stopped, so a change made in the last settingsFlushInterval is kept
+func flushOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("Received %v, saving settings and exiting", sig)
+
+	mutex.Lock()
+	if isRecording || startingRecorder != nil {
+		stopRecording()
+	}
+	s := currentSettings()
+	mutex.Unlock()
+	flushSettings(s)
+	os.Exit(0)
+}
+
+// settingsLoop saves changed settings at most every settingsFlushInterval
+func settingsLoop() {
+	ticker := time.NewTicker(settingsFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mutex.Lock()
+		s := currentSettings()
+		mutex.Unlock()
+		flushSettings(s)
+	}
+}
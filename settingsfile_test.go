@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/schema"
+)
+
+// settingsWriterEnv names the file a test run as the settings writer saves
+// to, over and over until it is killed
+const settingsWriterEnv = "PI9696_SETTINGS_WRITER"
+
+// Two versions of the settings the writer alternates between
+var (
+	oldSettings = Settings{SampleRate: 48000, Channels: 2, FilePrefix: "old", ClickFlash: true, MonitorVolume: 70}
+	newSettings = Settings{SampleRate: 96000, Channels: 8, ArmedChannels: []int{1, 2}, FilePrefix: "new", LTCChannel: 8,
+		ChannelNames: map[int]string{1: "Kick"}, LargeText: true, ConfirmStop: true, MonitorDevice: "plughw:1,0",
+		MonitorVolume: 40, ChaseArmed: true, AutoRecord: true}
+)
+
+// writeSettingsForever saves the two versions of the settings in turn
+// until the process is killed
+func writeSettingsForever(path string) {
+	for i := 0; ; i++ {
+		s := oldSettings
+		if i%2 == 1 {
+			s = newSettings
+		}
+		data, err := encodeSettings(s)
+		if err == nil {
+			err = writeSettingsFile(path, data)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// writeTestSettings saves s to path
+func writeTestSettings(t *testing.T, path string, s Settings) {
+	t.Helper()
+	data, err := encodeSettings(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSettingsFile(path, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	writeTestSettings(t, path, newSettings)
+	s, err := readSettingsFile(path, oldSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, newSettings) {
+		t.Errorf("read back %+v, want %+v", s, newSettings)
+	}
+}
+
+func TestSettingsFromVersion1KeepDefaults(t *testing.T) {
+	// Saved before the display and arming settings
+	data := []byte(`{"version": 1, "settings": {"sample_rate": 96000, "channels": 4, "ltc_channel": 0}}`)
+	s, err := decodeSettings(data, oldSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SampleRate != 96000 || s.Channels != 4 {
+		t.Errorf("format %d/%d, want the file's 96000/4", s.SampleRate, s.Channels)
+	}
+	if !s.ClickFlash || s.MonitorVolume != 70 || s.FilePrefix != "old" {
+		t.Errorf("settings missing from the file changed: %+v", s)
+	}
+}
+
+func TestDecodeSettingsLeavesBaseAlone(t *testing.T) {
+	base := newSettings
+	base.ArmedChannels = []int{1, 2}
+	base.ChannelNames = map[int]string{1: "Kick"}
+	data, err := encodeSettings(Settings{SampleRate: 48000, Channels: 8, ArmedChannels: []int{5, 6},
+		LTCChannel: 8, ChannelNames: map[int]string{2: "Snare"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeSettings(data, base); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(base.ArmedChannels, []int{1, 2}) || !reflect.DeepEqual(base.ChannelNames, map[int]string{1: "Kick"}) {
+		t.Errorf("decoding changed the base settings: %v %v", base.ArmedChannels, base.ChannelNames)
+	}
+}
+
+func TestValidateSavedSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Settings)
+	}{
+		{"monitor volume over 100", func(s *Settings) { s.MonitorVolume = 150 }},
+		{"negative monitor volume", func(s *Settings) { s.MonitorVolume = -10 }},
+		{"chase without an LTC channel", func(s *Settings) { s.ChaseArmed, s.LTCChannel = true, 0 }},
+		{"unknown idle panel", func(s *Settings) { s.IdlePanel = "weather" }},
+	}
+	if err := newSettings.Validate(); err != nil {
+		t.Fatalf("valid settings rejected: %v", err)
+	}
+	for _, tt := range tests {
+		s := newSettings
+		tt.change(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestReadSettingsFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	writeTestSettings(t, path, oldSettings)
+	writeTestSettings(t, path, newSettings)
+
+	// A torn primary, as a file system without atomic rename could leave
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readSettingsFile(path, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, oldSettings) {
+		t.Errorf("read %+v from the backup, want %+v", s, oldSettings)
+	}
+}
+
+func TestSettingsCrashBetweenRenames(t *testing.T) {
+	// The old file has become the backup and the new one is not in place
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	writeTestSettings(t, path, oldSettings)
+	if err := os.Rename(path, path+".bak"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := encodeSettings(newSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "settings.json.123"), data[:len(data)/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := readSettingsFile(path, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, oldSettings) {
+		t.Errorf("read %+v, want the old settings", s)
+	}
+}
+
+func TestSettingsSurviveKilledWriter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("kills a writer process many times")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 40; i++ {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		writeTestSettings(t, path, oldSettings)
+
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), settingsWriterEnv+"="+path)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Duration(rng.Intn(20000)) * time.Microsecond)
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		s, err := readSettingsFile(path, Settings{})
+		if err != nil {
+			t.Fatalf("run %d: settings unreadable after the writer was killed: %v", i, err)
+		}
+		if !reflect.DeepEqual(s, oldSettings) && !reflect.DeepEqual(s, newSettings) {
+			t.Fatalf("run %d: read %+v, neither the old nor the new settings", i, s)
+		}
+	}
+}
+
+func TestNewerSettingsNeverSavedOver(t *testing.T) {
+	savedPath, savedData := settingsPath, savedSettings
+	newerStateMutex.Lock()
+	savedNewer := newerState
+	newerStateMutex.Unlock()
+	settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	t.Cleanup(func() {
+		settingsPath, savedSettings = savedPath, savedData
+		newerStateMutex.Lock()
+		newerState = savedNewer
+		newerStateMutex.Unlock()
+	})
+
+	// Left by a newer version before a downgrade
+	data := []byte(`{"version": 99, "settings": {"sample_rate": 96000, "channels": 4}, "profiles": ["kept"]}`)
+	if err := os.WriteFile(settingsPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readSettingsFile(settingsPath, oldSettings)
+	var newer *schema.NewerError
+	if !errors.As(err, &newer) || newer.Version != 99 {
+		t.Fatalf("readSettingsFile() = %v, want a NewerError for version 99", err)
+	}
+	if s.SampleRate != 96000 || s.Channels != 4 || s.FilePrefix != "old" {
+		t.Errorf("read %+v, want the known settings over the defaults", s)
+	}
+
+	mutex.Lock()
+	keepDefaultSettings()
+	mutex.Unlock()
+	if !stateNewer() || stateWritable() {
+		t.Fatal("state directory writable with settings from a newer version")
+	}
+	if alert := takeAlert(); alert != i18n.T("schema.newer") {
+		t.Errorf("alert %q, want the newer version warning", alert)
+	}
+	if lines := schemaLines(); len(lines) == 0 || lines[0] != i18n.T("about.schema_newer") {
+		t.Errorf("About screen shows %q without the newer version warning", lines)
+	}
+
+	// A changed setting is kept in memory only
+	flushSettings(newSettings)
+	if got, _ := os.ReadFile(settingsPath); string(got) != string(data) {
+		t.Errorf("newer settings saved over with %s", got)
+	}
+	if _, err := os.Stat(settingsPath + ".bak"); !os.IsNotExist(err) {
+		t.Error("newer settings moved to the backup")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pi9696/i18n"
+)
+
+// showConfigName is the file looked for on a newly mounted USB drive
+const showConfigName = "pi9696-show.json"
+
+// ShowConfig is a show's settings, brought in on a USB stick
+type ShowConfig struct {
+	ShowName string   `json:"show_name"`
+	Settings Settings `json:"settings"`
+
+	raw []byte // The file as read, kept as provenance in the session
+}
+
+var (
+	showName    = ""        // Name of the applied show config, if any
+	pendingShow *ShowConfig // Show config awaiting confirmation
+)
+
+// readShowConfig loads and validates a show config. Settings the file leaves
+// out keep their current values. Unknown fields are rejected so a typo cannot
+// silently leave a setting unchanged. Must be called with mutex held.
+func readShowConfig(path string) (*ShowConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	show := &ShowConfig{Settings: currentSettings()}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(show); err != nil {
+		return nil, fmt.Errorf("%s: %v", showConfigName, err)
+	}
+
+	if show.ShowName == "" {
+		return nil, fmt.Errorf("%s: show_name is required", showConfigName)
+	}
+	if err := show.Settings.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", showConfigName, err)
+	}
+
+	show.raw = data
+	return show, nil
+}
+
+// checkShowConfig looks for a show config on a newly mounted USB drive and
+// queues it for confirmation. Must be called with mutex held.
+func checkShowConfig() {
+	path := filepath.Join(USBMountPoint, showConfigName)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	show, err := readShowConfig(path)
+	if err != nil {
+		setLastError("Rejected show config: %v", err)
+		showAlert(i18n.Tf("alert.show_rejected", err), 15*time.Second)
+		return
+	}
+	pendingShow = show
+}
+
+// offerShowConfig opens the confirmation dialog for a pending show config
+// once the recorder is idle. Must be called with mutex held.
+func offerShowConfig() {
+	if pendingShow == nil || isRecording || currentState != StateIdle {
+		return
+	}
+	menuMode = ShowConfigConfirm
+	currentState = StateConfirm
+	confirmOption = ConfirmNo
+}
+
+// applyShowConfig adopts a show's settings and creates its session, storing
+// a copy of the config there. Must be called with mutex held.
+func applyShowConfig(show *ShowConfig) {
+	settings := show.Settings
+	if settings.Session == "" {
+		settings.Session = show.ShowName
+	}
+	if err := validateName("session", settings.Session); err != nil {
+		showAlert(i18n.Tf("alert.show_rejected", err), 10*time.Second)
+		return
+	}
+
+	if err := checkSettingsUnlocked(settings); err != nil {
+		showAlert(i18n.Tf("alert.show_rejected", lockedMessage(err)), 10*time.Second)
+		return
+	}
+
+	applySettings(settings)
+	showName = show.ShowName
+
+	for _, target := range recordTargets {
+		if !target.Available() {
+			continue
+		}
+		dir := sessionDir(target.Path, sessionName)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Failed to create session %s on %s: %v", sessionName, target.Name, err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, showConfigName), show.raw, 0644); err != nil {
+			log.Printf("Failed to store show config on %s: %v", target.Name, err)
+		}
+	}
+
+	log.Printf("Loaded show config %q into session %s", showName, sessionName)
+	showAlert(i18n.Tf("alert.show_loaded", showName), 5*time.Second)
+}
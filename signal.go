@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"pi9696/i18n"
+)
+
+// signalHeard is when the input level last reached the auto-record
+// threshold. Set by updateSignal.
+var signalHeard time.Time
+
+// idleSignalWanted reports whether the input should be watched for the idle
+// signal indicator. It is off in the power_save profile, and while the
+// capture pipeline is missing.
+func idleSignalWanted() bool {
+	return config.IdleSignal.Enabled && powerProfile != "power_save" && !selfCheckFatal()
+}
+
+// updateSignal notes when signal was last heard. Must be called with mutex
+// held.
+func updateSignal() {
+	if level, live := autoMeter.Level(); live && level >= config.AutoRecord.ThresholdDB {
+		signalHeard = time.Now()
+	}
+}
+
+// renderIdleSignal marks the idle screen while the input is watched: lit
+// while signal is arriving, dimmed after DimAfterSec of silence
+func renderIdleSignal() {
+	if !idleSignalWanted() {
+		return
+	}
+	if _, live := autoMeter.Level(); !live {
+		return
+	}
+	text := i18n.T("idle.signal")
+	x := DisplayWidth - 4 - hwManager.GetTextWidth(text)
+	if time.Since(signalHeard) < time.Duration(config.IdleSignal.DimAfterSec)*time.Second {
+		hwManager.DrawText(x, 20, text)
+	} else {
+		hwManager.DrawDimText(x, 20, text)
+	}
+}
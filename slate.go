@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+// SlateInfo records in the take sidecar that the head of the take carries a
+// generated tone, so it is not mistaken for program audio
+type SlateInfo struct {
+	FrequencyHz float64 `json:"frequency_hz"`
+	LengthMs    int     `json:"length_ms"`
+	LevelDB     float64 `json:"level_db"`
+	Channels    []int   `json:"channels"` // 1-based pipeline channels
+}
+
+// slateTone is a sine tone written over the first samples of a take on the
+// chosen channels, for lining takes up against a backup recorder
+type slateTone struct {
+	info      SlateInfo
+	amplitude float64 // Fraction of full scale
+	step      float64 // Phase advance per frame in radians
+	frames    int64   // Length of the tone
+	channels  []int   // 0-based pipeline channels
+}
+
+// newSlateTone builds the tone for a take, or returns nil when the slate is
+// off or no channel can carry it. armed lists the 0-based channels written
+// to disk, nil for all, and ltc is the 0-based LTC channel, -1 for none,
+// which is never overwritten.
+func newSlateTone(cfg SlateConfig, sampleRate, channels int, armed []int, ltc int) *slateTone {
+	if !cfg.Enabled {
+		return nil
+	}
+	wanted := cfg.Channels
+	if len(wanted) == 0 {
+		for ch := 1; ch <= channels; ch++ {
+			wanted = append(wanted, ch)
+		}
+	}
+
+	s := &slateTone{
+		info:      SlateInfo{FrequencyHz: cfg.FrequencyHz, LengthMs: cfg.LengthMs, LevelDB: cfg.LevelDB},
+		amplitude: math.Pow(10, cfg.LevelDB/20),
+		step:      2 * math.Pi * cfg.FrequencyHz / float64(sampleRate),
+		frames:    int64(cfg.LengthMs) * int64(sampleRate) / 1000,
+	}
+	for _, ch := range wanted {
+		idx := ch - 1
+		if idx < 0 || idx >= channels || idx == ltc || (armed != nil && !slices.Contains(armed, idx)) {
+			continue
+		}
+		s.channels = append(s.channels, idx)
+		s.info.Channels = append(s.info.Channels, ch)
+	}
+	if len(s.channels) == 0 {
+		return nil
+	}
+	return s
+}
+
+// apply writes the tone over its channels in a block of interleaved S32LE
+// frames that starts at startFrame of the take. Other channels, and frames
+// after the tone, are left as they are.
+func (s *slateTone) apply(block []byte, startFrame int64, channels int) {
+	frameSize := channels * BitsPerSample / 8
+	for i := 0; i*frameSize < len(block); i++ {
+		frame := startFrame + int64(i)
+		if frame >= s.frames {
+			return
+		}
+		v := uint32(int32(s.amplitude * math.MaxInt32 * math.Sin(s.step*float64(frame))))
+		for _, ch := range s.channels {
+			binary.LittleEndian.PutUint32(block[i*frameSize+ch*4:], v)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSlateToneAtHeadOfTake(t *testing.T) {
+	r, _ := newTestRecorder(t, 1)
+	// 150ms runs past the first block of the take
+	cfg := SlateConfig{Enabled: true, FrequencyHz: 1000, LengthMs: 150, LevelDB: -20, Channels: []int{1}}
+	slate := newSlateTone(cfg, 48000, testChannels, nil, -1)
+	r.SetSlate(slate)
+	samples := testSamples(3 * recordBlockFrames)
+	record(t, r, samples)
+
+	data, _ := readSamples(t, r.Files()[0])
+	if len(data) != len(samples) {
+		t.Fatalf("%d bytes written, want %d", len(data), len(samples))
+	}
+	const toneFrames = 150 * 48
+	amplitude := math.Pow(10, -20.0/20) * math.MaxInt32
+	var peak float64
+	for frame := 0; frame < 3*recordBlockFrames; frame++ {
+		for ch := 0; ch < testChannels; ch++ {
+			off := (frame*testChannels + ch) * 4
+			got := int32(binary.LittleEndian.Uint32(data[off:]))
+			input := int32(binary.LittleEndian.Uint32(samples[off:]))
+			if frame >= toneFrames || ch != 0 {
+				if got != input {
+					t.Fatalf("frame %d channel %d is %d, want the input %d", frame, ch+1, got, input)
+				}
+				continue
+			}
+			want := amplitude * math.Sin(2*math.Pi*1000*float64(frame)/48000)
+			if math.Abs(float64(got)-want) > 1 {
+				t.Fatalf("tone frame %d is %d, want %.0f", frame, got, want)
+			}
+			peak = math.Max(peak, math.Abs(float64(got)))
+		}
+	}
+	if peak < amplitude*0.99 {
+		t.Errorf("tone peaks at %.0f, want %.0f", peak, amplitude)
+	}
+
+	info := newTakeInfo(r, nil, 0)
+	if info.Slate == nil || !slices.Equal(info.Slate.Channels, []int{1}) || info.Slate.LengthMs != 150 {
+		t.Errorf("sidecar notes the slate as %+v", info.Slate)
+	}
+}
+
+func TestNewSlateToneChannels(t *testing.T) {
+	on := SlateConfig{Enabled: true, FrequencyHz: 1000, LengthMs: 100, LevelDB: -20}
+	tests := []struct {
+		name  string
+		cfg   SlateConfig
+		armed []int
+		ltc   int
+		want  []int // 1-based, nil for no tone
+	}{
+		{"off", SlateConfig{Channels: []int{1}}, nil, -1, nil},
+		{"every channel", on, nil, -1, []int{1, 2, 3, 4}},
+		{"LTC is never overwritten", on, nil, 2, []int{1, 2, 4}},
+		{"only armed channels", on, []int{1, 3}, -1, []int{2, 4}},
+		{"chosen channels", SlateConfig{Enabled: true, Channels: []int{4, 9, 0}}, nil, -1, []int{4}},
+		{"no channel left", SlateConfig{Enabled: true, Channels: []int{3}}, nil, 2, nil},
+	}
+	for _, tt := range tests {
+		s := newSlateTone(tt.cfg, 48000, 4, tt.armed, tt.ltc)
+		var got []int
+		if s != nil {
+			got = s.info.Channels
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: tone on %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
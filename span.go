@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"pi9696/i18n"
+)
+
+const (
+	// spanReserve is left free on each drive of a span, so a drive is
+	// filled only nearly full
+	spanReserve = 64 << 20
+	// spanSwapPoll is how often the copy checks for the next drive
+	spanSwapPoll = 500 * time.Millisecond
+	// spanManifestPrefix starts the name of the manifest on each drive
+	spanManifestPrefix = "pi9696-span-"
+)
+
+// spanFile is a recording in a span manifest
+type spanFile struct {
+	Name     string `json:"name"`
+	Original string `json:"original,omitempty"` // Name before it was changed for a FAT drive
+	Source   string `json:"source"`
+	Size     int64  `json:"size"`
+}
+
+// spanManifest records which files of a span went to one drive. Every
+// drive gets one, so the set can be put back together from any of them.
+type spanManifest struct {
+	Span    string     `json:"span"`
+	Drive   int        `json:"drive"`
+	Written time.Time  `json:"written"`
+	Files   []spanFile `json:"files"`
+}
+
+// spanDrive is what went to one drive, for the completion summary
+type spanDrive struct {
+	files int
+	bytes int64
+}
+
+var (
+	// usbGeneration counts drives mounted, so a span can tell the next
+	// drive has been inserted
+	usbGeneration int
+
+	// pendingCopy is the selection waiting on the span or rename
+	// confirmation, and copyNeed, copyFree and copyRenamed what they show
+	pendingCopy        []string
+	copyNeed, copyFree uint64
+	copyRenamed        int // Files of pendingCopy renamed for a FAT drive
+
+	// spanWaiting is set while a span waits for drive spanNumber of about
+	// spanDrives to be inserted
+	spanWaiting bool
+	spanNumber  int
+	spanDrives  int
+
+	// spanResults and spanFailed are shown once a span completes
+	spanResults []spanDrive
+	spanFailed  int
+)
+
+// usbSpace returns the bytes available on the USB drive and its size
+func usbSpace() (free, total uint64) {
+	stat, err := statfsWithin(USBMountPoint, statfsTimeout)
+	if err != nil {
+		return 0, 0
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize)
+}
+
+// copySize returns the bytes a recording takes on the drive with the notes
+// that travel with it
+func copySize(file string) int64 {
+	size := totalSize([]string{file})
+	for _, note := range noteFiles(file) {
+		size += totalSize([]string{note})
+	}
+	return size
+}
+
+// fitBatch splits files into those that fit in space, taken in order, and
+// the rest. A file that does not fit ends the batch; files are never split.
+func fitBatch(files []string, space int64) (batch, rest []string) {
+	for i, file := range files {
+		size := copySize(file)
+		if size > space {
+			return files[:i], files[i:]
+		}
+		space -= size
+	}
+	return files, nil
+}
+
+// verifyCopied checks each file of jobs arrived whole, removing any copy
+// that did not, and returns those that did
+func verifyCopied(jobs []copyJob) []spanFile {
+	var copied []spanFile
+	for _, job := range jobs {
+		file, dst := job.src, job.dst
+		src, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			continue
+		}
+		if info.Size() != src.Size() {
+			log.Printf("Span: removing incomplete %s: %d of %d bytes", dst, info.Size(), src.Size())
+			os.Remove(dst)
+			continue
+		}
+		f := spanFile{Name: filepath.Base(dst), Source: file, Size: src.Size()}
+		if f.Name != filepath.Base(file) {
+			f.Original = filepath.Base(file)
+		}
+		copied = append(copied, f)
+	}
+	return copied
+}
+
+// manifestName is the name of the manifest for drive of span id
+func manifestName(id string, drive int) string {
+	return fmt.Sprintf("%s%s-drive%d.json", spanManifestPrefix, id, drive)
+}
+
+// writeSpanManifest writes the manifest for one drive of a span to dir
+func writeSpanManifest(dir string, manifest spanManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, manifestName(manifest.Span, manifest.Drive))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// hasSpanManifest reports whether dir already holds a drive of span id
+func hasSpanManifest(dir, id string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, spanManifestPrefix+id+"-drive*.json"))
+	return len(matches) > 0
+}
+
+// estimateDrives guesses how many drives a span needs: those filled so far
+// and enough drives the size of the current one for the rest
+func estimateDrives(filled int, rest []string, driveSize uint64) int {
+	var need int64
+	for _, file := range rest {
+		need += copySize(file)
+	}
+	usable := int64(driveSize) - spanReserve
+	if need == 0 || usable <= 0 {
+		return filled
+	}
+	return filled + int((need+usable-1)/usable)
+}
+
+// waitForNextDrive prompts for drive n of about total and returns once a
+// different drive is mounted, or ctx is done. A drive that already holds
+// part of the span is refused.
+func waitForNextDrive(ctx context.Context, id string, n, total int) error {
+	mutex.Lock()
+	generation := usbGeneration
+	spanWaiting, spanNumber, spanDrives = true, n, total
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		spanWaiting = false
+		mutex.Unlock()
+	}()
+
+	log.Printf("Span %s: waiting for drive %d of %d", id, n, total)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(spanSwapPoll):
+		}
+
+		mutex.Lock()
+		swapped := usbMounted && usbGeneration != generation
+		if swapped {
+			generation = usbGeneration
+		}
+		mutex.Unlock()
+		if !swapped {
+			continue
+		}
+		if hasSpanManifest(USBMountPoint, id) {
+			showAlert(i18n.T("alert.span_same_drive"), 3*time.Second)
+			continue
+		}
+		return nil
+	}
+}
+
+// spanCopy copies files across as many USB drives as they need, filling
+// each nearly full before asking for the next. Each drive gets only files
+// that were copied whole and a manifest of them, including when the copy is
+// cancelled part way. It returns what went to each drive and how many files
+// failed.
+func spanCopy(ctx context.Context, files []string, checkpoint func() error, progress *backgroundJob) ([]spanDrive, int) {
+	id := time.Now().Format("20060102-150405")
+	var results []spanDrive
+	failed, done := 0, 0
+	rest := files
+	for drive := 1; len(rest) > 0 && ctx.Err() == nil; drive++ {
+		if drive > 1 {
+			_, size := usbSpace()
+			if err := waitForNextDrive(ctx, id, drive, estimateDrives(drive-1, rest, size)); err != nil {
+				break
+			}
+		}
+
+		// A file too large for the drive inserted needs a larger one
+		free, size := usbSpace()
+		batch, next := fitBatch(rest, int64(free)-spanReserve)
+		for len(batch) == 0 {
+			showAlert(i18n.Tf("alert.span_too_large", filepath.Base(rest[0])), 5*time.Second)
+			if err := waitForNextDrive(ctx, id, drive, estimateDrives(drive-1, rest, size)); err != nil {
+				return results, failed
+			}
+			free, size = usbSpace()
+			batch, next = fitBatch(rest, int64(free)-spanReserve)
+		}
+		rest = next
+		log.Printf("Span %s: drive %d of %d gets %d files", id, drive, estimateDrives(drive, rest, size), len(batch))
+
+		offset := done
+		jobs := copyJobs(batch, USBMountPoint, progress)
+		runCopyJobs(ctx, jobs, checkpoint, func(n int) {
+			mutex.Lock()
+			copyProgress = int(float64(offset+n) / float64(len(files)) * 100)
+			mutex.Unlock()
+		})
+		done += len(batch)
+
+		// Whatever happened, the drive keeps only whole files and says so
+		copied := verifyCopied(jobs)
+		if ctx.Err() == nil {
+			failed += len(batch) - len(copied)
+		}
+		manifest := spanManifest{Span: id, Drive: drive, Written: time.Now(), Files: copied}
+		if err := writeSpanManifest(USBMountPoint, manifest); err != nil {
+			setLastError("Failed to write span manifest on drive %d: %v", drive, err)
+		}
+		syscall.Sync()
+
+		result := spanDrive{files: len(copied)}
+		for _, f := range copied {
+			result.bytes += f.Size
+		}
+		results = append(results, result)
+	}
+	return results, failed
+}
+
+// spanSummaryLines describes where a span's files went
+func spanSummaryLines() []string {
+	lines := make([]string, 0, len(spanResults)+1)
+	for i, drive := range spanResults {
+		lines = append(lines, i18n.Tf("copy.span_drive", i+1, drive.files, formatSize(uint64(drive.bytes))))
+	}
+	if spanFailed > 0 {
+		lines = append(lines, i18n.Tf("copy.span_failed", spanFailed))
+	}
+	return lines
+}
+
+// renderCopySummary lists the distribution of a span across drives
+func renderCopySummary() {
+	hwManager.DrawCenteredText(i18n.T("copy.summary_title"), "header", 16)
+
+	lines := spanSummaryLines()
+	maxLines := 3
+	if menuScrollOffset > len(lines)-maxLines {
+		menuScrollOffset = len(lines) - maxLines
+	}
+	if menuScrollOffset < 0 {
+		menuScrollOffset = 0
+	}
+	y := 28
+	for _, line := range lines[menuScrollOffset:] {
+		if y > 48 {
+			break
+		}
+		hwManager.DrawCenteredText(line, "details", y)
+		y += 10
+	}
+
+	hwManager.DrawCenteredText(i18n.T("common.click_continue"), "details", 58)
+}
+
+func renderLargeCopySummary() {
+	lines := spanSummaryLines()
+	if len(lines) == 0 {
+		return
+	}
+	clampScroll(len(lines))
+	drawLargeLines(lines[menuScrollOffset], itemOf(menuScrollOffset, len(lines)))
+}
+
+// spanPromptText asks for the next drive of a span
+func spanPromptText() string {
+	return i18n.Tf("copy.insert_drive", spanNumber, spanDrives)
+}
+
+// copyTitle is the title of the copy screen: the prompt for the next drive
+// while a span waits for one, or that files are coming in from the drive
+func copyTitle() string {
+	if spanWaiting {
+		return spanPromptText()
+	}
+	if isImporting {
+		return i18n.T("import.importing")
+	}
+	if isArchiving {
+		return i18n.T("archive.archiving")
+	}
+	return i18n.T("copy.copying")
+}
+
+// spanConfirmText is the message of the span confirmation
+func spanConfirmText() string {
+	return i18n.Tf("confirm.span.message", formatSize(copyNeed), formatSize(copyFree))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+	"pi9696/schema"
+)
+
+var (
+	// newerState lists the state files found written by a newer version of
+	// the recorder, as after a downgrade. While any is listed the state
+	// directory is read-only so none of them is overwritten.
+	newerState      []string
+	newerStateMutex sync.Mutex
+)
+
+// noteNewerState records a state file from a newer version and warns that
+// nothing will be saved until the recorder is upgraded again
+func noteNewerState(path string, err *schema.NewerError) {
+	log.Printf("%s: %v; running with the state directory read-only", path, err)
+	newerStateMutex.Lock()
+	newerState = append(newerState, path)
+	newerStateMutex.Unlock()
+	showAlert(i18n.T("schema.newer"), 10*time.Second)
+}
+
+// stateNewer reports whether a state file from a newer version was found
+func stateNewer() bool {
+	newerStateMutex.Lock()
+	defer newerStateMutex.Unlock()
+	return len(newerState) > 0
+}
+
+// schemaLines lists the schema version of each kind of file the recorder
+// keeps, for the About screen
+func schemaLines() []string {
+	var lines []string
+	if stateNewer() {
+		lines = append(lines, i18n.T("about.schema_newer"))
+	}
+	for _, a := range schema.All {
+		lines = append(lines, i18n.Tf("about.schema", a.Name, a.Version))
+	}
+	return lines
+}
+
+// newerStateStatusElements marks the status bar for as long as the state
+// directory is read-only because of a newer file, which is until restart
+func newerStateStatusElements() []hardware.StatusElement {
+	if !stateNewer() {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("readonly", i18n.T("status.state_newer"), hardware.AlignLeft, 125)}
+}
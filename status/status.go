@@ -0,0 +1,154 @@
+// Package status defines the unit status file written by the recorder and
+// read by pi9696ctl and other local tools.
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pi9696/hardware"
+)
+
+// DefaultPath is where the recorder writes its status file
+const DefaultPath = "/run/pi9696/status.json"
+
+// Status is the schema of the status file. Fields are only ever added.
+type Status struct {
+	UpdatedAt time.Time               `json:"updated_at"`
+	Unit      string                  `json:"unit,omitempty"` // Name that tells units apart
+	Demo      bool                    `json:"demo,omitempty"` // Recording synthetic audio
+	State     string                  `json:"state"`          // UI screen, e.g. "idle", "recording", "settings"
+	Recording *Recording              `json:"recording,omitempty"`
+	Copying   *Copying                `json:"copying,omitempty"`
+	Storage   Storage                 `json:"storage"`
+	LastError *Error                  `json:"last_error,omitempty"`
+	Preflight *Preflight              `json:"preflight,omitempty"`
+	SelfCheck []Dependency            `json:"self_check,omitempty"` // Startup dependency checks
+	Power     *Power                  `json:"power,omitempty"`      // Unset without a battery gauge
+	Hardware  hardware.HardwareStatus `json:"hardware"`
+}
+
+// Recording describes the take in progress
+type Recording struct {
+	Take           string    `json:"take"`
+	Target         string    `json:"target"`
+	File           string    `json:"file"`
+	Started        time.Time `json:"started"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	SampleRate     int       `json:"sample_rate"`
+	Channels       int       `json:"channels"`
+	Chase          bool      `json:"chase"` // Started by LTC chase
+	Auto           bool      `json:"auto"`  // Started by auto-record
+}
+
+// Copying describes a copy to USB in progress
+type Copying struct {
+	Percent int `json:"percent"`
+}
+
+// Storage is the space left on the record targets and the USB drive
+type Storage struct {
+	FreeBytes        uint64   `json:"free_bytes"`
+	RemainingSeconds float64  `json:"remaining_seconds"` // At the current rate and channel count
+	Targets          []Target `json:"targets"`
+	Degraded         []string `json:"degraded,omitempty"` // Devices that failed repeatedly and get no new writes
+	USBMounted       bool     `json:"usb_mounted"`
+	USBSize          string   `json:"usb_size,omitempty"`
+}
+
+// Target is one record target
+type Target struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Available bool   `json:"available"`
+	FreeBytes uint64 `json:"free_bytes"`
+
+	// BytesWritten counts writes to the device since install or the last
+	// reset, and RatedTBW is its endurance in TB if entered
+	BytesWritten uint64 `json:"bytes_written"`
+	RatedTBW     int    `json:"rated_tbw,omitempty"`
+}
+
+// Power is the latest battery reading
+type Power struct {
+	Percent  int     `json:"percent"`
+	Volts    float64 `json:"volts"`
+	Charging bool    `json:"charging"`
+}
+
+// Preflight is the latest run of the preflight checks
+type Preflight struct {
+	Started  time.Time        `json:"started"`
+	Finished *time.Time       `json:"finished,omitempty"` // Unset while running
+	Verdict  string           `json:"verdict"`            // "running", "pass" or "fail"
+	Checks   []PreflightCheck `json:"checks"`
+}
+
+// PreflightCheck is the result of one preflight check
+type PreflightCheck struct {
+	ID     string `json:"id"`    // e.g. "stream", "storage"
+	State  string `json:"state"` // "pending", "pass" or "fail"
+	Detail string `json:"detail,omitempty"`
+}
+
+// Dependency is the startup check of one external the recorder relies on
+type Dependency struct {
+	ID       string `json:"id"`       // e.g. "capture", "sudo"
+	Severity string `json:"severity"` // "fatal" or "degraded", if missing
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Error is the most recent error the recorder reported
+type Error struct {
+	Code    string    `json:"code,omitempty"` // Error catalog code, e.g. "E21", for failures in the catalog
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Write saves s to path. The file is replaced atomically so readers never
+// see a partial write.
+func Write(path string, s *Status) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read loads the status file at path
+func Read(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
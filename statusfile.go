@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"pi9696/status"
+)
+
+const (
+	statusInterval = 2 * time.Second        // Longest gap between status file writes
+	statusPoll     = 250 * time.Millisecond // How often state changes are looked for
+)
+
+// stateNames are the screen names used in the status file
+var stateNames = map[AppState]string{
+	StateIdle:             "idle",
+	StateRecording:        "recording",
+	StateSettings:         "settings",
+	StateCopyFiles:        "copy_files",
+	StateCopying:          "copying",
+	StateSystemOptions:    "system_options",
+	StateNetworkInfo:      "network_info",
+	StateConfirm:          "confirm",
+	StateRecordingSummary: "recording_summary",
+	StateRecordings:       "recordings",
+	StateFileDetails:      "file_details",
+	StateQuickJump:        "quick_jump",
+	StatePreflight:        "preflight",
+	StateNoteEditor:       "note_editor",
+	StateAbout:            "about",
+	StateStorageHealth:    "storage_health",
+	StateChannelNames:     "channel_names",
+	StatePlayback:         "playback",
+	StateCopySummary:      "copy_summary",
+	StateMarkers:          "markers",
+	StateImportFiles:      "import_files",
+	StateRemoteControl:    "remote_control",
+	StateError:            "error",
+	StateStarting:         "starting",
+}
+
+var (
+	// The last error is kept under its own lock so the recorder goroutines
+	// can report errors without taking the UI mutex
+	lastError      *status.Error
+	lastErrorMutex sync.Mutex
+)
+
+// setLastError logs an error and records it for the status file
+func setLastError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	noteError(msg)
+}
+
+// noteError records an error for the status file that has already been logged
+func noteError(msg string) {
+	lastErrorMutex.Lock()
+	lastError = &status.Error{Message: msg, Time: time.Now()}
+	lastErrorMutex.Unlock()
+}
+
+// statusKey summarizes the state a status file write should follow promptly.
+// Must be called with mutex held.
+func statusKey() string {
+	key := fmt.Sprintf("%d/%t/%t/%d/%t/%d/%d", currentState, isRecording, isCopying, copyProgress, usbMounted, sampleRateIdx, channelCount)
+	if preflight != nil {
+		for _, r := range preflight.Results() {
+			key += "/" + r.State.String()
+		}
+	}
+	return key
+}
+
+// statusJob is a snapshot waiting to be written. Storage and hardware are
+// filled in by the writer, away from the UI mutex.
+type statusJob struct {
+	status      *status.Status
+	bytesPerSec float64 // Recording data rate at the current settings
+}
+
+// statusSnapshot captures the recorder state for the status file. Must be
+// called with mutex held.
+func statusSnapshot() statusJob {
+	s := &status.Status{
+		UpdatedAt: time.Now(),
+		Unit:      unitName(),
+		Demo:      demoMode,
+		State:     stateNames[currentState],
+		SelfCheck: selfCheck,
+		Storage: status.Storage{
+			USBMounted: usbMounted,
+			USBSize:    usbSize,
+		},
+	}
+
+	if isRecording && recorder != nil {
+		s.Recording = &status.Recording{
+			Take:           recorder.baseName,
+			Target:         recorder.CurrentTarget().Name,
+			File:           recorder.CurrentFile(),
+			Started:        recordStart,
+			ElapsedSeconds: time.Since(recordStart).Seconds(),
+			SampleRate:     recorder.sampleRate,
+			Channels:       recorder.fileChannels(),
+			Chase:          chaseTake,
+			Auto:           autoTake,
+		}
+	}
+	if isCopying {
+		s.Copying = &status.Copying{Percent: copyProgress}
+	}
+
+	if preflight != nil {
+		s.Preflight = preflightStatus(preflight)
+	}
+
+	lastErrorMutex.Lock()
+	if lastError != nil {
+		e := *lastError
+		s.LastError = &e
+	}
+	lastErrorMutex.Unlock()
+
+	return statusJob{
+		status:      s,
+		bytesPerSec: float64(sampleRates[sampleRateIdx] * recordedChannelCount() * BitsPerSample / 8),
+	}
+}
+
+// preflightStatus reports a preflight run for the status file
+func preflightStatus(run *preflightRun) *status.Preflight {
+	started, finished := run.Times()
+	p := &status.Preflight{Started: started, Verdict: "running"}
+	if !finished.IsZero() {
+		p.Finished = &finished
+		p.Verdict = "fail"
+		if run.Passed() {
+			p.Verdict = "pass"
+		}
+	}
+	for _, r := range run.Results() {
+		p.Checks = append(p.Checks, status.PreflightCheck{ID: r.ID, State: r.State.String(), Detail: r.Detail})
+	}
+	return p
+}
+
+// statusLoop writes the status file every statusInterval and soon after each
+// state change. Writes happen on a separate goroutine; if the previous write
+// has not finished the cycle is skipped, so a slow filesystem never holds up
+// the UI.
+func statusLoop() {
+	queue := make(chan statusJob)
+	go statusWriter(queue)
+
+	ticker := time.NewTicker(statusPoll)
+	defer ticker.Stop()
+
+	var lastKey string
+	var lastWrite time.Time
+	for range ticker.C {
+		mutex.Lock()
+		key := statusKey()
+		if key == lastKey && time.Since(lastWrite) < statusInterval {
+			mutex.Unlock()
+			continue
+		}
+		snapshot := statusSnapshot()
+		mutex.Unlock()
+
+		select {
+		case queue <- snapshot:
+			lastKey = key
+			lastWrite = time.Now()
+		default:
+			// Previous write still in progress
+		}
+	}
+}
+
+// statusWriter fills in storage and hardware details and writes each snapshot
+func statusWriter(queue <-chan statusJob) {
+	failing := false
+	for job := range queue {
+		s := job.status
+		for _, target := range recordTargets {
+			t := status.Target{
+				Name:      target.Name,
+				Path:      target.Path,
+				Available: target.Available(),
+				FreeBytes: target.FreeSpace(),
+			}
+			if c := wearOf(target.Name); c.BytesWritten > 0 || c.RatedTBW > 0 {
+				t.BytesWritten = c.BytesWritten
+				t.RatedTBW = c.RatedTBW
+			}
+			s.Storage.Targets = append(s.Storage.Targets, t)
+		}
+		s.Storage.FreeBytes = totalFreeSpace(recordTargets)
+		s.Storage.Degraded = degradedStorage()
+		s.Storage.RemainingSeconds = float64(s.Storage.FreeBytes) / job.bytesPerSec
+		s.Hardware = hwManager.Status()
+		s.Power = powerStatus()
+
+		// Log the first failure only; /run missing is not worth a log line every 2s
+		if err := status.Write(config.StatusPath, s); err != nil {
+			if !failing {
+				log.Printf("Failed to write status file: %v", err)
+			}
+			failing = true
+		} else {
+			failing = false
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"pi9696/hardware"
+)
+
+const (
+	// statusLEDPoll is how often the conditions are checked for a new
+	// pattern
+	statusLEDPoll = time.Second
+	// ledStepMinMs and ledStepMaxMs bound each step of a pattern
+	ledStepMinMs = 20
+	ledStepMaxMs = 10000
+)
+
+// ledPatternNames are the patterns the config can set
+var ledPatternNames = []string{ledBooting, ledError, ledWarning, ledIdle}
+
+// ledReservedPins are wired to the display, encoder and buttons
+var ledReservedPins = []string{"GPIO5", "GPIO6", "GPIO8", "GPIO10", "GPIO11", "GPIO13", "GPIO17", "GPIO22", "GPIO24", "GPIO25", "GPIO27"}
+
+// validateLEDPattern checks a pattern's steps: one to keep the LED on, or
+// pairs of on and off times
+func validateLEDPattern(steps []int) error {
+	if len(steps) > 1 && len(steps)%2 != 0 {
+		return fmt.Errorf("needs one step or pairs of on and off times")
+	}
+	for _, ms := range steps {
+		if ms < ledStepMinMs || ms > ledStepMaxMs {
+			return fmt.Errorf("steps must be %d to %d ms", ledStepMinMs, ledStepMaxMs)
+		}
+	}
+	return nil
+}
+
+// ledPattern converts a configured pattern for the LED
+func ledPattern(steps []int) hardware.LEDPattern {
+	pattern := make(hardware.LEDPattern, len(steps))
+	for i, ms := range steps {
+		pattern[i] = time.Duration(ms) * time.Millisecond
+	}
+	return pattern
+}
+
+// startStatusLED lights the status LED when a pin is configured. It starts
+// solid, for booting, until the conditions say otherwise.
+func startStatusLED() {
+	cfg := config.StatusLED
+	if cfg.Pin == "" {
+		return
+	}
+	led, err := hardware.NewStatusLED(cfg.Pin)
+	if err != nil {
+		setLastError("Status LED disabled: %v", err)
+		return
+	}
+	led.SetPattern(ledPattern(cfg.Patterns[ledBooting]))
+	log.Printf("Status LED on %s", cfg.Pin)
+	go statusLEDLoop(led, cfg)
+}
+
+// statusLEDLoop plays the pattern of the top condition, changing it only
+// when a different pattern wins so blinks are not cut short
+func statusLEDLoop(led *hardware.StatusLED, cfg StatusLEDConfig) {
+	ticker := time.NewTicker(statusLEDPoll)
+	defer ticker.Stop()
+	shown, pattern := "", ledBooting
+	for range ticker.C {
+		mutex.Lock()
+		top, ok := topCondition(conditions)
+		mutex.Unlock()
+
+		name, next := "", ledIdle
+		if ok {
+			name, next = top.name, top.pattern
+		}
+		if name != shown {
+			if name != "" {
+				log.Printf("Status LED: %s", name)
+			} else if shown != "" {
+				log.Printf("Status LED: %s cleared", shown)
+			}
+			shown = name
+		}
+		if next != pattern {
+			led.SetPattern(ledPattern(cfg.Patterns[next]))
+			pattern = next
+		}
+	}
+}
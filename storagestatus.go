@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi9696/hardware"
+	"pi9696/i18n"
+)
+
+const (
+	// storageRefreshInterval is how often the storage status is read
+	storageRefreshInterval = 2 * time.Second
+	// statfsTimeout is how long a file system has to answer before its last
+	// reading is used instead
+	statfsTimeout = time.Second
+	// storageStaleAfter is how old the last full reading may get before the
+	// storage status counts as stale
+	storageStaleAfter = 3 * storageRefreshInterval
+)
+
+// errStatfsTimeout is returned for a file system that did not answer in time
+var errStatfsTimeout = errors.New("file system not responding")
+
+// statfs reads file system usage. Tests replace it.
+var statfs = syscall.Statfs
+
+type statfsResult struct {
+	stat syscall.Statfs_t
+	err  error
+}
+
+var (
+	// statfsPending holds the reads still running for each path. A read
+	// that times out is left running, and its result is taken by the next
+	// read of the path rather than starting another that would hang too.
+	statfsPending = make(map[string]chan statfsResult)
+	statfsMutex   sync.Mutex
+)
+
+// statfsWithin reads the usage of the file system holding path, giving up
+// with errStatfsTimeout after timeout
+func statfsWithin(path string, timeout time.Duration) (syscall.Statfs_t, error) {
+	statfsMutex.Lock()
+	result := statfsPending[path]
+	if result == nil {
+		result = make(chan statfsResult, 1)
+		statfsPending[path] = result
+		go func() {
+			var r statfsResult
+			r.err = statfs(path, &r.stat)
+			result <- r
+		}()
+	}
+	statfsMutex.Unlock()
+
+	select {
+	case r := <-result:
+		statfsMutex.Lock()
+		delete(statfsPending, path)
+		statfsMutex.Unlock()
+		return r.stat, r.err
+	case <-time.After(timeout):
+		return syscall.Statfs_t{}, errStatfsTimeout
+	}
+}
+
+// storageStatus is the storage state the screens show, read in the
+// background so drawing never waits on a file system
+type storageStatus struct {
+	mutex     sync.Mutex
+	freeBytes uint64    // Across the record targets
+	usbSize   string    // Size label of the USB drive, empty without one
+	fresh     time.Time // Last reading in which every file system answered
+	stale     bool      // Logged as overdue
+}
+
+var storageNow storageStatus
+
+// storageLoop keeps the storage status current
+func storageLoop() {
+	for {
+		time.Sleep(storageRefreshInterval)
+		refreshStorage()
+	}
+}
+
+// refreshStorage reads the free space of the record targets and the size of
+// the USB drive, keeping the last value of any that does not answer
+func refreshStorage() {
+	free, freeErr := sumFreeSpace(recordTargets)
+	usbSize, usbErr := getUSBSize()
+
+	storageNow.mutex.Lock()
+	defer storageNow.mutex.Unlock()
+	storageNow.freeBytes = free
+	if !errors.Is(usbErr, errStatfsTimeout) {
+		storageNow.usbSize = usbSize
+	}
+	if freeErr == nil && usbErr == nil {
+		if storageNow.stale {
+			log.Printf("Storage status is current again")
+		}
+		storageNow.fresh, storageNow.stale = time.Now(), false
+	} else if !storageNow.stale && time.Since(storageNow.fresh) > storageStaleAfter {
+		log.Printf("Storage status stale since %s: %v", storageNow.fresh.Format("15:04:05"), errors.Join(freeErr, usbErr))
+		storageNow.stale = true
+	}
+}
+
+// cachedFreeSpace returns the free space across the record targets at the
+// last reading
+func cachedFreeSpace() uint64 {
+	storageNow.mutex.Lock()
+	defer storageNow.mutex.Unlock()
+	return storageNow.freeBytes
+}
+
+// cachedUSBSize returns the USB drive's size label at the last reading
+func cachedUSBSize() string {
+	storageNow.mutex.Lock()
+	defer storageNow.mutex.Unlock()
+	return storageNow.usbSize
+}
+
+// storageStale reports whether the storage status is overdue, such as while
+// a USB stick has stopped answering
+func storageStale() bool {
+	storageNow.mutex.Lock()
+	defer storageNow.mutex.Unlock()
+	return time.Since(storageNow.fresh) > storageStaleAfter
+}
+
+// getUSBSize returns the USB drive's size, rounded to a power of two, as a
+// label such as "64GB". It is empty without a drive, and errStatfsTimeout
+// is returned if the drive does not answer.
+func getUSBSize() (string, error) {
+	stat, err := statfsWithin(USBMountPoint, statfsTimeout)
+	if err != nil {
+		if errors.Is(err, errStatfsTimeout) {
+			return "", err
+		}
+		return "", nil
+	}
+
+	totalBytes := uint64(stat.Blocks) * uint64(stat.Bsize)
+
+	if totalBytes < 1024*1024*1024 { // Less than 1GB
+		mb := totalBytes / (1024 * 1024)
+		return fmt.Sprintf("%dmb", roundToPowerOfTwo(int(mb))), nil
+	} else if totalBytes < 1024*1024*1024*1024 { // Less than 1TB
+		gb := totalBytes / (1024 * 1024 * 1024)
+		return fmt.Sprintf("%dGB", roundToPowerOfTwo(int(gb))), nil
+	} else {
+		tb := totalBytes / (1024 * 1024 * 1024 * 1024)
+		return fmt.Sprintf("%dTB", roundToPowerOfTwo(int(tb))), nil
+	}
+}
+
+// staleStatusElements shows while the storage status is overdue
+func staleStatusElements() []hardware.StatusElement {
+	if !storageStale() {
+		return nil
+	}
+	return []hardware.StatusElement{hardware.TextStatusElement("stale", i18n.T("status.storage_stale"), hardware.AlignLeft, 90)}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// hangingStatfs makes every file system stop answering until the returned
+// function is called, counting the reads started
+func hangingStatfs(t *testing.T) (*atomic.Int32, func()) {
+	var calls atomic.Int32
+	hang := make(chan struct{})
+	saved := statfs
+	statfs = func(path string, stat *syscall.Statfs_t) error {
+		calls.Add(1)
+		<-hang
+		return syscall.Statfs(path, stat)
+	}
+	released := false
+	release := func() {
+		if !released {
+			close(hang)
+			released = true
+		}
+	}
+	t.Cleanup(func() {
+		release()
+		statfs = saved
+		statfsMutex.Lock()
+		statfsPending = make(map[string]chan statfsResult)
+		statfsMutex.Unlock()
+	})
+	return &calls, release
+}
+
+// keepStorageStatus restores the storage status when the test ends
+func keepStorageStatus(t *testing.T) {
+	storageNow.mutex.Lock()
+	free, usb, fresh, stale := storageNow.freeBytes, storageNow.usbSize, storageNow.fresh, storageNow.stale
+	storageNow.mutex.Unlock()
+	t.Cleanup(func() {
+		storageNow.mutex.Lock()
+		defer storageNow.mutex.Unlock()
+		storageNow.freeBytes, storageNow.usbSize, storageNow.fresh, storageNow.stale = free, usb, fresh, stale
+	})
+}
+
+func TestRenderNeverWaitsOnStatfs(t *testing.T) {
+	keepStorageStatus(t)
+	useTargets(t, []*RecordTarget{{Name: "A", Path: t.TempDir()}})
+	refreshStorage()
+	free, usbSize := cachedFreeSpace(), cachedUSBSize()
+	if free == 0 || storageStale() {
+		t.Fatalf("%d bytes free, stale %v, after reading a working file system", free, storageStale())
+	}
+
+	calls, release := hangingStatfs(t)
+	inEachLayout(t, func(t *testing.T) {
+		refreshed := make(chan struct{})
+		go func() {
+			refreshStorage()
+			close(refreshed)
+		}()
+
+		// Frames keep coming while the file systems hang
+		frames := 0
+		for done := false; !done; frames++ {
+			select {
+			case <-refreshed:
+				done = true
+			default:
+			}
+			start := time.Now()
+			drawn(t)
+			if took := time.Since(start); took > statfsTimeout/2 {
+				t.Fatalf("frame took %v while statfs hung", took)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if frames < 10 {
+			t.Errorf("%d frames drawn while the storage status was read", frames)
+		}
+		if got := cachedFreeSpace(); got != free {
+			t.Errorf("%d bytes free after the read timed out, want the last reading of %d", got, free)
+		}
+		if got := cachedUSBSize(); got != usbSize {
+			t.Errorf("USB size %q after the read timed out, want %q", got, usbSize)
+		}
+	})
+
+	// A hung read is waited on again rather than started over
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d reads started for the target and the USB drive, want 2", n)
+	}
+
+	// Once overdue the status bar says so, until the file systems answer
+	storageNow.mutex.Lock()
+	storageNow.fresh = time.Now().Add(-storageStaleAfter - time.Second)
+	storageNow.mutex.Unlock()
+	if len(staleStatusElements()) == 0 {
+		t.Error("no stale warning while the storage status is overdue")
+	}
+	release()
+	refreshStorage()
+	if storageStale() || len(staleStatusElements()) != 0 {
+		t.Error("storage status still stale after the file systems answered")
+	}
+}
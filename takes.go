@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"pi9696/schema"
+)
+
+// TakeInfo is written as a JSON sidecar next to the first file of each take
+type TakeInfo struct {
+	Version         int          `json:"version"`
+	Name            string       `json:"name"`
+	Unit            string       `json:"unit,omitempty"` // Unit name when the take was recorded
+	Files           []string     `json:"files"`
+	SampleRate      int          `json:"sample_rate"`
+	Channels        int          `json:"channels"`
+	ArmedChannels   []int        `json:"armed_channels,omitempty"` // 1-based pipeline channels in the files
+	ChannelNames    []string     `json:"channel_names,omitempty"`  // Name of each channel in the files
+	BitsPerSample   int          `json:"bits_per_sample"`
+	Start           time.Time    `json:"start"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	TimeReference   uint64       `json:"time_reference"`
+	TimecodeSource  string       `json:"timecode_source"` // "clock", "LTC" or "import" for an imported file's bext
+	TimecodeFPS     int          `json:"timecode_fps"`
+	StartTimecode   string       `json:"start_timecode"`
+	LTCChannel      int          `json:"ltc_channel,omitempty"`
+	LTCDriftMs      *float64     `json:"ltc_drift_ms,omitempty"` // LTC minus system clock
+	Slate           *SlateInfo   `json:"slate,omitempty"`        // Tone written over the head of the take
+	Peaks           *PeakHistory `json:"peaks,omitempty"`
+	Markers         []Marker     `json:"markers,omitempty"`
+	Imported        *ImportInfo  `json:"imported,omitempty"` // Set for files brought back from USB
+
+	// DataXXH64 holds the XXH64 of each file's sample data, in Files
+	// order, and TakeDataXXH64 that of all of them in sequence. Both are
+	// hashed as the take is written. Takes recorded before version 2 have
+	// MD5 sums in DataMD5 and TakeDataMD5 instead.
+	DataXXH64     []string `json:"data_xxh64,omitempty"`
+	TakeDataXXH64 string   `json:"take_data_xxh64,omitempty"`
+	DataMD5       []string `json:"data_md5,omitempty"`
+	TakeDataMD5   string   `json:"take_data_md5,omitempty"`
+}
+
+// partSuffix matches the suffix added to files written after a failover
+var partSuffix = regexp.MustCompile(`_part\d+$`)
+
+// takeName returns the take a recording file belongs to
+func takeName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return partSuffix.ReplaceAllString(name, "")
+}
+
+// sidecarPath returns the path of the take sidecar for a recording file in the same directory
+func sidecarPath(path string) string {
+	return filepath.Join(filepath.Dir(path), takeName(path)+".json")
+}
+
+// newTakeInfo collects the details of a finished take. ltcChan is the 1-based
+// LTC channel and reader is nil when no LTC channel was designated.
+func newTakeInfo(r *Recorder, reader *ltcReader, ltcChan int) *TakeInfo {
+	ref, source := r.TimeReference()
+	info := &TakeInfo{
+		Name:            r.baseName,
+		Unit:            unitName(),
+		Files:           r.Files(),
+		SampleRate:      r.sampleRate,
+		Channels:        r.fileChannels(),
+		BitsPerSample:   BitsPerSample,
+		Start:           r.FirstSampleTime(),
+		DurationSeconds: float64(r.FramesWritten()) / float64(r.sampleRate),
+		TimeReference:   ref,
+		TimecodeSource:  source,
+		TimecodeFPS:     config.TimecodeFPS,
+		ChannelNames:    r.ixml.Tracks,
+		Markers:         r.Markers(),
+	}
+	info.DataXXH64, info.TakeDataXXH64 = r.Checksums()
+
+	if r.slate != nil {
+		slate := r.slate.info
+		info.Slate = &slate
+	}
+
+	for _, ch := range r.armed {
+		info.ArmedChannels = append(info.ArmedChannels, ch+1)
+	}
+
+	if reader != nil {
+		info.LTCChannel = ltcChan
+		if locked, fps, drift := reader.Lock(); locked {
+			info.TimecodeFPS = fps
+			info.LTCDriftMs = &drift
+		}
+	}
+	info.StartTimecode = timecodeAt(ref, info.SampleRate, info.TimecodeFPS)
+
+	return info
+}
+
+// writeTakeInfo saves the sidecar next to the take's first file. A sidecar
+// written by a newer version is not replaced.
+func writeTakeInfo(info *TakeInfo) error {
+	if len(info.Files) == 0 {
+		return fmt.Errorf("take %s has no files", info.Name)
+	}
+	path := sidecarPath(info.Files[0])
+	if old, err := os.ReadFile(path); err == nil {
+		if err := schema.TakeInfo.Newer(old); err != nil {
+			return err
+		}
+	}
+	info.Version = schema.TakeInfo.Version
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readTakeInfo loads the sidecar for a recording file, if there is one
+func readTakeInfo(path string) (*TakeInfo, error) {
+	data, err := os.ReadFile(sidecarPath(path))
+	if err != nil {
+		return nil, err
+	}
+	// A sidecar from a newer version is read as far as it is understood
+	var info TakeInfo
+	if _, err := schema.TakeInfo.Decode(data, &info); err != nil && !errors.As(err, new(*schema.NewerError)) {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/mqtt"
+)
+
+const (
+	mqttKeepAlive  = 30 * time.Second
+	mqttMinBackoff = time.Second
+	mqttMaxBackoff = time.Minute
+	tallyPoll      = 250 * time.Millisecond // How soon a state change is published
+
+	// thermalPath reports the SoC temperature in millidegrees
+	thermalPath = "/sys/class/thermal/thermal_zone0/temp"
+)
+
+// Tally states published to <base>/state. The broker publishes
+// tallyOffline for us if the connection drops.
+const (
+	tallyIdle      = "idle"
+	tallyRecording = "recording"
+	tallyError     = "error"
+	tallyOffline   = "offline"
+)
+
+var (
+	// lastTakeFailed is set when a take ends on a write failure and cleared
+	// when the next take starts
+	lastTakeFailed = false
+
+	// MQTT connection state has its own lock as the client goroutine
+	// updates it
+	mqttConnected bool
+	mqttMutex     sync.Mutex
+)
+
+// tallyTelemetry is published to <base>/telemetry
+type tallyTelemetry struct {
+	FreeBytes        uint64   `json:"free_bytes"`
+	RemainingSeconds float64  `json:"remaining_seconds"`
+	TemperatureC     *float64 `json:"temperature_c,omitempty"`
+}
+
+// startMQTT connects to the configured broker in the background. Nothing
+// the client does waits on the recorder beyond a brief state snapshot.
+func startMQTT() {
+	if config.MQTT.Broker == "" {
+		return
+	}
+	go mqttLoop(config.MQTT)
+}
+
+// mqttLoop keeps a broker session up, reconnecting with backoff
+func mqttLoop(cfg MQTTConfig) {
+	backoff := mqttMinBackoff
+	for {
+		base := mqttBaseTopic()
+		client, err := mqtt.Dial(mqtt.Options{
+			Broker:    cfg.Broker,
+			ClientID:  "pi9696-" + unitSlug(),
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			KeepAlive: mqttKeepAlive,
+			Will:      &mqtt.Message{Topic: base + "/state", Payload: []byte(tallyOffline), Retain: true},
+		})
+		if err != nil {
+			setMQTTStatus(false)
+			log.Printf("MQTT: failed to connect to %s, retrying in %v: %v", cfg.Broker, backoff, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, mqttMaxBackoff)
+			continue
+		}
+
+		backoff = mqttMinBackoff
+		setMQTTStatus(true)
+		log.Printf("MQTT: connected to %s as %s", cfg.Broker, base)
+		err = runMQTTSession(client, base, time.Duration(cfg.TelemetrySeconds)*time.Second)
+		setMQTTStatus(false)
+		log.Printf("MQTT: connection lost: %v", err)
+	}
+}
+
+// runMQTTSession publishes state and telemetry and runs commands until the
+// connection is lost
+func runMQTTSession(client *mqtt.Client, base string, telemetryEvery time.Duration) error {
+	defer client.Close()
+	if err := client.Subscribe(base + "/command"); err != nil {
+		return err
+	}
+
+	poll := time.NewTicker(tallyPoll)
+	defer poll.Stop()
+	telemetry := time.NewTicker(telemetryEvery)
+	defer telemetry.Stop()
+
+	lastState := ""
+	publishTelemetry(client, base)
+	for {
+		select {
+		case <-client.Done():
+			return client.Err()
+
+		case m, ok := <-client.Messages():
+			if !ok {
+				return client.Err()
+			}
+			command := strings.TrimSpace(string(m.Payload))
+			reply := "ok"
+			if err := runRemoteCommand("mqtt", m.Topic, command); err != nil {
+				reply = "error: " + err.Error()
+				if e, ok := asOpError(err); ok {
+					reply = "error: " + e.kind.code + " " + e.Message()
+				}
+			}
+			client.Publish(mqtt.Message{Topic: base + "/command/result", Payload: []byte(reply)})
+
+		case <-poll.C:
+			if state := tallyState(); state != lastState {
+				if err := client.Publish(mqtt.Message{Topic: base + "/state", Payload: []byte(state), Retain: true}); err != nil {
+					return err
+				}
+				lastState = state
+			}
+
+		case <-telemetry.C:
+			publishTelemetry(client, base)
+		}
+	}
+}
+
+// tallyState is the state shown on external tally lights
+func tallyState() string {
+	// A unit running headless still records, but needs attention
+	mutex.Lock()
+	recording, failed := isRecording, lastTakeFailed || displayOffline
+	mutex.Unlock()
+
+	switch {
+	case recording:
+		return tallyRecording
+	case failed || selfCheckFatal() || len(degradedStorage()) > 0:
+		return tallyError
+	}
+	for _, target := range recordTargets {
+		if target.Available() {
+			return tallyIdle
+		}
+	}
+	return tallyError
+}
+
+// publishTelemetry sends the storage and temperature readings
+func publishTelemetry(client *mqtt.Client, base string) {
+	mutex.Lock()
+	bytesPerSec := float64(sampleRates[sampleRateIdx] * recordedChannelCount() * BitsPerSample / 8)
+	mutex.Unlock()
+
+	t := tallyTelemetry{FreeBytes: totalFreeSpace(recordTargets)}
+	t.RemainingSeconds = float64(t.FreeBytes) / bytesPerSec
+	if celsius, ok := cpuTemperature(); ok {
+		t.TemperatureC = &celsius
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+	client.Publish(mqtt.Message{Topic: base + "/telemetry", Payload: data})
+}
+
+// cpuTemperature reads the SoC temperature in degrees Celsius
+func cpuTemperature() (float64, bool) {
+	data, err := os.ReadFile(thermalPath)
+	if err != nil {
+		return 0, false
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return float64(milli) / 1000, true
+}
+
+// mqttBaseTopic is the topic the unit publishes under and takes commands
+// from
+func mqttBaseTopic() string {
+	return strings.ReplaceAll(config.MQTT.BaseTopic, unitToken, unitSlug())
+}
+
+// mqttStatusText shows whether the broker is connected
+func mqttStatusText() string {
+	mqttMutex.Lock()
+	defer mqttMutex.Unlock()
+	if mqttConnected {
+		return i18n.T("remote.connected")
+	}
+	return i18n.T("remote.offline")
+}
+
+// setMQTTStatus records the broker connection state for Network Info
+func setMQTTStatus(connected bool) {
+	mqttMutex.Lock()
+	defer mqttMutex.Unlock()
+	mqttConnected = connected
+}
+
+// mqttStatusLines describes the broker connection for Network Info, or
+// nothing when MQTT is off
+func mqttStatusLines() []string {
+	if config.MQTT.Broker == "" {
+		return nil
+	}
+	mqttMutex.Lock()
+	defer mqttMutex.Unlock()
+	if mqttConnected {
+		return []string{i18n.Tf("network.mqtt_connected", config.MQTT.Broker)}
+	}
+	return []string{i18n.Tf("network.mqtt_disconnected", config.MQTT.Broker)}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"syscall"
+)
+
+// minTargetFreeBytes is the free space below which a target is not used for new takes
+const minTargetFreeBytes = 64 * 1024 * 1024
+
+// RecordTarget is a location recordings can be written to
+type RecordTarget struct {
+	Name         string
+	Path         string
+	RequireMount bool
+
+	lastFree atomic.Uint64 // Free space last read, used while the file system does not answer
+}
+
+// newRecordTargets builds the ordered target list from the configuration
+func newRecordTargets(cfg *Config) []*RecordTarget {
+	targets := make([]*RecordTarget, 0, len(cfg.RecordTargets))
+	for _, tc := range cfg.RecordTargets {
+		targets = append(targets, &RecordTarget{
+			Name:         tc.Name,
+			Path:         tc.Path,
+			RequireMount: tc.RequireMount,
+		})
+	}
+	return targets
+}
+
+// Available reports whether the target exists (and is mounted, if required)
+func (t *RecordTarget) Available() bool {
+	info, err := os.Stat(t.Path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	if t.RequireMount && !isMountPoint(t.Path) {
+		return false
+	}
+	return true
+}
+
+// CheckHealth verifies the target can accept a new recording
+func (t *RecordTarget) CheckHealth() error {
+	if storageDegraded(t.Name) {
+		return fmt.Errorf("%s (%s) degraded after write errors", t.Name, t.Path)
+	}
+	if !t.Available() {
+		return fmt.Errorf("%s (%s) not available", t.Name, t.Path)
+	}
+
+	if free := t.FreeSpace(); free < minTargetFreeBytes {
+		return fmt.Errorf("%s (%s) is full", t.Name, t.Path)
+	}
+
+	// Probe that the filesystem actually accepts writes
+	probe, err := os.CreateTemp(t.Path, ".pi9696-probe-*")
+	if err != nil {
+		return fmt.Errorf("%s (%s) not writable: %v", t.Name, t.Path, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return nil
+}
+
+// FreeSpace returns the bytes available on the target, or 0 if it is unavailable
+func (t *RecordTarget) FreeSpace() uint64 {
+	free, _ := t.freeSpace()
+	return free
+}
+
+// freeSpace returns the bytes available on the target. If its file system
+// does not answer within statfsTimeout, the last value read is returned
+// with errStatfsTimeout.
+func (t *RecordTarget) freeSpace() (uint64, error) {
+	if !t.Available() {
+		return 0, nil
+	}
+	stat, err := statfsWithin(t.Path, statfsTimeout)
+	if errors.Is(err, errStatfsTimeout) {
+		return t.lastFree.Load(), err
+	}
+	if err != nil {
+		return 0, nil
+	}
+	free := stat.Bavail * uint64(stat.Bsize)
+	t.lastFree.Store(free)
+	return free, nil
+}
+
+// Recordings lists the WAV files stored on the target, including those in session folders
+func (t *RecordTarget) Recordings() []string {
+	if !t.Available() {
+		return nil
+	}
+	var files []string
+	for _, pattern := range []string{"*.wav", "*/*.wav"} {
+		matches, err := filepath.Glob(filepath.Join(t.Path, pattern))
+		if err != nil {
+			continue
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// isMountPoint reports whether path is the root of a mounted filesystem
+func isMountPoint(path string) bool {
+	var self, parent syscall.Stat_t
+	if err := syscall.Stat(path, &self); err != nil {
+		return false
+	}
+	if err := syscall.Stat(filepath.Dir(filepath.Clean(path)), &parent); err != nil {
+		return false
+	}
+	return self.Dev != parent.Dev
+}
+
+// pickRecordTarget returns the index of the first healthy target at or after start
+func pickRecordTarget(targets []*RecordTarget, start int) (int, error) {
+	var lastErr error
+	for i := start; i < len(targets); i++ {
+		if err := targets[i].CheckHealth(); err != nil {
+			lastErr = err
+			continue
+		}
+		return i, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no record targets configured")
+	}
+	return -1, fmt.Errorf("no healthy record target: %v", lastErr)
+}
+
+// totalFreeSpace sums free space across all available targets, counting
+// targets that share a filesystem only once
+func totalFreeSpace(targets []*RecordTarget) uint64 {
+	total, _ := sumFreeSpace(targets)
+	return total
+}
+
+// sumFreeSpace is totalFreeSpace, also returning errStatfsTimeout if the
+// last value read had to be used for any target
+func sumFreeSpace(targets []*RecordTarget) (uint64, error) {
+	var total uint64
+	var timeout error
+	seen := make(map[uint64]bool)
+	for _, t := range targets {
+		if !t.Available() {
+			continue
+		}
+		var stat syscall.Stat_t
+		if err := syscall.Stat(t.Path, &stat); err == nil {
+			dev := uint64(stat.Dev)
+			if seen[dev] {
+				continue
+			}
+			seen[dev] = true
+		}
+		free, err := t.freeSpace()
+		if err != nil {
+			timeout = err
+		}
+		total += free
+	}
+	return total, timeout
+}
+
+// allRecordings lists recordings across every target, sorted by file name
+func allRecordings(targets []*RecordTarget) []string {
+	var files []string
+	for _, t := range targets {
+		files = append(files, t.Recordings()...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+	return files
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllRecordingsAcrossTargets(t *testing.T) {
+	ssd := &RecordTarget{Name: "SSD", Path: t.TempDir()}
+	sd := &RecordTarget{Name: "SD", Path: t.TempDir()}
+	missing := &RecordTarget{Name: "USB", Path: filepath.Join(t.TempDir(), "gone")}
+	for _, f := range []string{
+		filepath.Join(ssd.Path, "b.wav"),
+		filepath.Join(ssd.Path, "session", "c.wav"),
+		filepath.Join(sd.Path, "a.wav"),
+		filepath.Join(sd.Path, "notes.txt"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	for _, f := range allRecordings([]*RecordTarget{ssd, missing, sd}) {
+		names = append(names, filepath.Base(f))
+	}
+	if len(names) != 3 || names[0] != "a.wav" || names[1] != "b.wav" || names[2] != "c.wav" {
+		t.Errorf("allRecordings = %v, want [a.wav b.wav c.wav]", names)
+	}
+}
+
+func TestTotalFreeSpaceCountsSharedFileSystemOnce(t *testing.T) {
+	a := &RecordTarget{Name: "A", Path: t.TempDir()}
+	b := &RecordTarget{Name: "B", Path: t.TempDir()}
+	missing := &RecordTarget{Name: "C", Path: filepath.Join(t.TempDir(), "gone")}
+
+	one := a.FreeSpace()
+	total := totalFreeSpace([]*RecordTarget{a, b, missing})
+	// Other writers on the file system may move the figure a little
+	const slack = 16 << 20
+	if total+slack < one || total > one+slack {
+		t.Errorf("totalFreeSpace = %d for two targets on one file system with %d free", total, one)
+	}
+	if missing.FreeSpace() != 0 {
+		t.Errorf("missing target reports %d bytes free", missing.FreeSpace())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"pi9696/i18n"
+	"pi9696/ltc"
+)
+
+// ltcChannel is the 1-based input channel carrying LTC, or 0 when no channel
+// is designated
+var ltcChannel = 0
+
+// secondsPerDay is used to wrap time references that cross midnight
+const secondsPerDay = 24 * 60 * 60
+
+// ltcReader decodes LTC from one channel of a take and stamps the recorder's
+// time reference from the first valid frame
+type ltcReader struct {
+	recorder *Recorder
+	channel  int // 0-based index into the interleaved frame
+	decoder  *ltc.Decoder
+	samples  []int32
+
+	mutex   sync.Mutex
+	locked  bool
+	fps     int
+	driftMs float64 // LTC minus system clock at lock
+}
+
+// newLTCReader creates a reader for the given 0-based channel and registers
+// it as a tap on the recorder
+func newLTCReader(r *Recorder, channel int) *ltcReader {
+	l := &ltcReader{
+		recorder: r,
+		channel:  channel,
+		decoder:  ltc.NewDecoder(r.sampleRate),
+	}
+	r.AddTap(l.tap)
+	return l
+}
+
+// tap feeds the designated channel of a block of S32LE frames to the decoder
+func (l *ltcReader) tap(block []byte, startFrame int64) {
+	l.mutex.Lock()
+	locked := l.locked
+	l.mutex.Unlock()
+	if locked {
+		return
+	}
+
+	frameSize := l.recorder.frameSize()
+	frames := len(block) / frameSize
+	if cap(l.samples) < frames {
+		l.samples = make([]int32, frames)
+	}
+	l.samples = l.samples[:frames]
+	for i := range l.samples {
+		offset := i*frameSize + l.channel*4
+		l.samples[i] = int32(binary.LittleEndian.Uint32(block[offset:]))
+	}
+
+	// The decoder counts samples from the first block of the take, so its
+	// frame positions are already take-relative
+	if frames := l.decoder.Process(l.samples); len(frames) > 0 {
+		l.lock(frames[0])
+	}
+}
+
+// lock derives the take's time reference from a decoded frame
+func (l *ltcReader) lock(frame ltc.Frame) {
+	rate := int64(l.recorder.sampleRate)
+	ref := int64(frame.SecondsAt(frame.FPS)*float64(rate)) - frame.StartSample
+	if ref < 0 {
+		// The take started before midnight and the code has since wrapped
+		ref += secondsPerDay * rate
+	}
+
+	clockRef, _ := l.recorder.TimeReference()
+	drift := float64(ref-int64(clockRef)) * 1000 / float64(rate)
+
+	l.recorder.SetTimeReference(uint64(ref), "LTC")
+
+	l.mutex.Lock()
+	l.locked = true
+	l.fps = frame.FPS
+	l.driftMs = drift
+	l.mutex.Unlock()
+}
+
+// Lock reports whether LTC has been decoded, and if so its frame rate and
+// the offset of the code from the system clock in milliseconds
+func (l *ltcReader) Lock() (locked bool, fps int, driftMs float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.locked, l.fps, l.driftMs
+}
+
+// ltcChannelText formats the LTC input setting
+func ltcChannelText() string {
+	if ltcChannel == 0 {
+		return i18n.T("common.off")
+	}
+	return i18n.Tf("ltc.channel", ltcChannel)
+}
+
+// adjustLTCChannel steps the LTC input through Off and the recorded channels
+func adjustLTCChannel(direction int) {
+	ltcChannel += direction
+	if ltcChannel < 0 {
+		ltcChannel = channelCount
+	} else if ltcChannel > channelCount {
+		ltcChannel = 0
+	}
+	setLTCChannel(ltcChannel)
+}
+
+// setLTCChannel points the LTC watcher at a new input, disarming chase since
+// code seen on the old channel says nothing about the new one
+func setLTCChannel(channel int) {
+	ltcChannel = channel
+	ltcWatch.SetChannel(channel - 1)
+	chaseArmed = false
+}
+
+// timecodeAt formats a time reference as timecode
+func timecodeAt(timeReference uint64, sampleRate, fps int) string {
+	return ltc.FromSamples(int64(timeReference), sampleRate, fps).String()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// watchSettle is how long changes are collected before a rescan, so a
+	// burst such as an rsync of a session folder costs one
+	watchSettle = 500 * time.Millisecond
+	// watchResync is how often watches are checked against the record
+	// targets, for targets mounted or folders created since
+	watchResync = 30 * time.Second
+
+	watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+		syscall.IN_CLOSE_WRITE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+)
+
+// recordingWatcher watches the record targets and their session folders
+// through inotify for recordings added, removed or renamed, such as from a
+// shell on the unit
+type recordingWatcher struct {
+	fd      int
+	mutex   sync.Mutex
+	dirs    map[int32]string  // Watch descriptor to folder
+	watched map[string]uint64 // Folder to the device it was on when watched
+	changes chan string       // Folders something changed in
+}
+
+// newRecordingWatcher opens an inotify instance and watches the targets
+func newRecordingWatcher() (*recordingWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	w := &recordingWatcher{
+		fd:      fd,
+		dirs:    make(map[int32]string),
+		watched: make(map[string]uint64),
+		changes: make(chan string, 64),
+	}
+	w.sync()
+	go w.read()
+	return w, nil
+}
+
+// watch adds a watch on dir, replacing one left on the folder a mount now
+// covers
+func (w *recordingWatcher) watch(dir string) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if dev, ok := w.watched[dir]; ok && dev == uint64(st.Dev) {
+		return
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		log.Printf("Watch: cannot watch %s: %v", dir, err)
+		return
+	}
+	w.dirs[int32(wd)] = dir
+	w.watched[dir] = uint64(st.Dev)
+}
+
+// sync watches each available target and the session folders in it, the
+// folders Recordings looks in
+func (w *recordingWatcher) sync() {
+	for _, target := range recordTargets {
+		if !target.Available() {
+			continue
+		}
+		w.watch(target.Path)
+		entries, _ := os.ReadDir(target.Path)
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				w.watch(filepath.Join(target.Path, e.Name()))
+			}
+		}
+	}
+}
+
+// forget drops a watch the kernel has removed, as when its folder was
+// deleted or unmounted
+func (w *recordingWatcher) forget(wd int32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.watched, w.dirs[wd])
+	delete(w.dirs, wd)
+}
+
+// read passes on changes to recordings and folders from the inotify events
+func (w *recordingWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			log.Printf("Watch: stopped: %v", err)
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := strings.TrimRight(string(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+size]), "\x00")
+			off += syscall.SizeofInotifyEvent + size
+
+			w.mutex.Lock()
+			dir := w.dirs[wd]
+			w.mutex.Unlock()
+			switch {
+			case mask&syscall.IN_IGNORED != 0:
+				w.forget(wd)
+			case dir == "":
+			case mask&syscall.IN_ISDIR != 0 || mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+				if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					w.watch(filepath.Join(dir, name))
+				}
+				w.changes <- dir
+			case strings.HasSuffix(name, ".wav"):
+				w.changes <- dir
+			}
+		}
+	}
+}
+
+var recordings *recordingWatcher
+
+// startRecordingWatcher watches the record targets so the copy list, the
+// last take and the storage status follow changes made outside the
+// recorder
+func startRecordingWatcher() {
+	w, err := newRecordingWatcher()
+	if err != nil {
+		log.Printf("Watch: recordings will be rescanned only on menu entry: %v", err)
+		return
+	}
+	recordings = w
+	go w.loop()
+}
+
+// loop rescans once changes settle. Changes made while one of the
+// recorder's own jobs is writing to the folder are not rescanned one by
+// one; the job's end brings a single rescan instead.
+func (w *recordingWatcher) loop() {
+	settle := time.NewTicker(watchSettle)
+	defer settle.Stop()
+	resync := time.NewTicker(watchResync)
+	defer resync.Stop()
+
+	external, own := false, false
+	for {
+		select {
+		case dir := <-w.changes:
+			if resources.Writing(dir) {
+				own = true
+			} else {
+				external = true
+			}
+		case <-settle.C:
+			if own && !resources.Writing(targetPaths()...) {
+				own, external = false, true
+			}
+			if external {
+				external = false
+				rescanRecordings()
+			}
+		case <-resync.C:
+			w.sync()
+		}
+	}
+}
+
+// rescanRecordings reads the recordings on the targets again and brings
+// the screens that show them up to date
+func rescanRecordings() {
+	files := allRecordings(recordTargets)
+	refreshStorage()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	applyRecordingScan(files)
+}
+
+// applyRecordingScan updates what is shown of the recordings after a scan
+// found files: the copy list keeps its selection and collapsed groups, with
+// new files selected, the Recordings list and file details are read again,
+// and a last take or detail screen whose files are gone is dropped. Must be
+// called with mutex held.
+func applyRecordingScan(files []string) {
+	recordingFiles = files
+	if allFiles != nil && !slices.Equal(allFiles, files) {
+		collapsed := make(map[string]bool)
+		for _, g := range copyGroups {
+			collapsed[g.name] = g.collapsed
+		}
+		selection := make(map[string]bool)
+		for _, file := range files {
+			selection[file] = true
+			if selected, ok := filesToCopy[file]; ok {
+				selection[file] = selected
+			}
+		}
+		allFiles, filesToCopy = files, selection
+		copyGroups = groupRecordings(allFiles, recordTargets, filesToCopy)
+		for _, g := range copyGroups {
+			g.collapsed = collapsed[g.name]
+		}
+		log.Printf("Watch: copy list now has %d files", len(allFiles))
+	}
+
+	present := make(map[string]bool)
+	for _, file := range files {
+		present[file] = true
+	}
+	if lastTake != nil && !slices.ContainsFunc(lastTake.Files, func(f string) bool { return present[f] }) {
+		log.Printf("Watch: last take %s was removed", lastTake.Name)
+		lastTake = nil
+	}
+	if currentState == StateFileDetails && !present[detailsFile] {
+		openMenu(StateRecordings)
+	} else if detailsFile != "" && present[detailsFile] {
+		loadFileDetails()
+	}
+}
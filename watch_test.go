@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordTestTake records frames frames to a take of its own and returns its
+// file
+func recordTestTake(t *testing.T, frames int) (string, []*RecordTarget) {
+	t.Helper()
+	r, targets := newTestRecorder(t, 1)
+	record(t, r, testSamples(frames))
+	return r.Files()[0], targets
+}
+
+func TestFileDetailsReadOnOpen(t *testing.T) {
+	file, _ := recordTestTake(t, recordBlockFrames)
+	longer, _ := recordTestTake(t, 4*recordBlockFrames)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	t.Cleanup(func() { currentState, detailsFile, detailsInfo, detailsTake = StateIdle, "", nil, nil })
+
+	openFileDetails(file)
+	if detailsInfo == nil {
+		t.Fatal("details of a readable file not read on open")
+	}
+	want := detailsInfo.Duration()
+
+	// Drawing the screen goes on showing what was read when it opened
+	data, err := os.ReadFile(longer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	detailsOptionText("")
+	markerMenuItems()
+	if detailsInfo.Duration() != want {
+		t.Error("file details read again while on screen")
+	}
+
+	// Until the watcher sees the change
+	applyRecordingScan([]string{file})
+	if currentState != StateFileDetails {
+		t.Fatalf("state %s after the file changed, want file details", stateNames[currentState])
+	}
+	if detailsInfo == nil || detailsInfo.Duration() <= want {
+		t.Error("file details not read again after the watcher saw a change")
+	}
+
+	// And leaves the screen once the file is gone
+	applyRecordingScan(nil)
+	if currentState != StateRecordings {
+		t.Errorf("state %s after the file was removed, want recordings", stateNames[currentState])
+	}
+}
+
+func TestRecordingsListReadOnOpen(t *testing.T) {
+	first, targets := recordTestTake(t, recordBlockFrames)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	saved := recordTargets
+	t.Cleanup(func() { recordTargets, recordingFiles, currentState = saved, nil, StateIdle })
+
+	recordTargets = targets
+	openRecordings()
+	if items := recordingsMenuItems(); len(items) != 2 {
+		t.Fatalf("recordings lists %d items, want the take and back", len(items))
+	}
+
+	second, _ := recordTestTake(t, recordBlockFrames)
+	if items := recordingsMenuItems(); len(items) != 2 {
+		t.Errorf("recordings list read again while on screen: %d items", len(items))
+	}
+	applyRecordingScan([]string{first, second})
+	if items := recordingsMenuItems(); len(items) != 3 {
+		t.Errorf("recordings lists %d items after the watcher saw a new take, want 3", len(items))
+	}
+}
+
+// writeTestWAV writes an empty recording to path, as a shell on the unit
+// might
+func writeTestWAV(t *testing.T, path string) {
+	t.Helper()
+	w, err := createWAV(path, 48000, 2, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// watched waits for w to see a change and collects the rest of the burst,
+// as the watcher's loop does before a rescan, returning the folders changed
+func watched(t *testing.T, w *recordingWatcher) []string {
+	t.Helper()
+	var dirs []string
+	select {
+	case dir := <-w.changes:
+		dirs = append(dirs, dir)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher saw no change")
+	}
+	for settle := time.After(watchSettle); ; {
+		select {
+		case dir := <-w.changes:
+			dirs = append(dirs, dir)
+		case <-settle:
+			return dirs
+		}
+	}
+}
+
+func TestWatcherSeesExternalChanges(t *testing.T) {
+	target := &RecordTarget{Name: "A", Path: t.TempDir()}
+	useTargets(t, []*RecordTarget{target})
+	mutex.Lock()
+	savedAll, savedSelection, savedGroups, savedFiles, savedTake := allFiles, filesToCopy, copyGroups, recordingFiles, lastTake
+	allFiles, filesToCopy, copyGroups, recordingFiles, lastTake = []string{}, make(map[string]bool), nil, nil, nil
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		allFiles, filesToCopy, copyGroups, recordingFiles, lastTake = savedAll, savedSelection, savedGroups, savedFiles, savedTake
+	})
+
+	// The watcher is left reading when the test ends, on folders that are
+	// then removed
+	w, err := newRecordingWatcher()
+	if err != nil {
+		t.Skipf("no inotify: %v", err)
+	}
+	shown := func(files ...string) {
+		t.Helper()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !slices.Equal(allFiles, files) || !slices.Equal(recordingFiles, files) {
+			t.Fatalf("copy list %v and recordings %v, want %v", allFiles, recordingFiles, files)
+		}
+		for _, file := range files {
+			if !filesToCopy[file] {
+				t.Errorf("%s not selected in the copy list", filepath.Base(file))
+			}
+		}
+	}
+
+	take := filepath.Join(target.Path, "take.wav")
+	writeTestWAV(t, take)
+	watched(t, w)
+	rescanRecordings()
+	shown(take)
+
+	// A session folder made after the watcher started is watched too
+	session := filepath.Join(target.Path, "Session")
+	if err := os.Mkdir(session, 0755); err != nil {
+		t.Fatal(err)
+	}
+	watched(t, w)
+	inSession := filepath.Join(session, "take2.wav")
+	writeTestWAV(t, inSession)
+	if dirs := watched(t, w); !slices.Contains(dirs, session) {
+		t.Errorf("changes seen in %v, want the session folder", dirs)
+	}
+	rescanRecordings()
+	shown(take, inSession)
+
+	// Renaming and removing files are seen, and a last take whose files
+	// are gone is dropped
+	mutex.Lock()
+	lastTake = &TakeInfo{Name: "take", Files: []string{take}}
+	mutex.Unlock()
+	renamed := filepath.Join(target.Path, "renamed.wav")
+	if err := os.Rename(take, renamed); err != nil {
+		t.Fatal(err)
+	}
+	watched(t, w)
+	rescanRecordings()
+	shown(renamed, inSession)
+	mutex.Lock()
+	if lastTake != nil {
+		t.Error("last take kept after its file was renamed away")
+	}
+	mutex.Unlock()
+	if err := os.Remove(inSession); err != nil {
+		t.Fatal(err)
+	}
+	watched(t, w)
+	rescanRecordings()
+	shown(renamed)
+
+	// Files that are not recordings bring no rescan
+	if err := os.WriteFile(filepath.Join(target.Path, "notes.txt"), []byte("note"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case dir := <-w.changes:
+		t.Errorf("change seen in %s for a notes file", dir)
+	case <-time.After(2 * watchSettle):
+	}
+
+	// Changes made while one of the recorder's own jobs writes there are
+	// told apart from external ones
+	lease, err := resources.TryAcquire(jobProcess, target.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestWAV(t, filepath.Join(target.Path, "renamed"+procSuffix+".wav"))
+	for _, dir := range watched(t, w) {
+		if !resources.Writing(dir) {
+			t.Errorf("change in %s while processing counted as external", dir)
+		}
+	}
+	lease.Release()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// bextChunkSize is the size of a Broadcast Wave bext chunk without coding history
+const bextChunkSize = 602
+
+// wavHeaderSize covers the RIFF header, bext, fmt and data chunk headers
+const wavHeaderSize = 12 + 8 + bextChunkSize + 8 + 16 + 8
+
+// wavTrailerRoom is kept below the 4 GiB limit for the iXML and cue chunks
+// written after the samples
+const wavTrailerRoom = 1 << 20
+
+// wavMaxDataBytes is the most sample data a file takes before the recorder
+// continues in the next part, as the RIFF sizes are 32-bit
+const wavMaxDataBytes = math.MaxUint32 - wavHeaderSize - wavTrailerRoom
+
+// BextInfo is the Broadcast Wave metadata written to each file
+type BextInfo struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	Origination         time.Time
+	TimeReference       uint64 // Samples since midnight of the first sample
+}
+
+// wavFile is the part of an *os.File a wavWriter uses
+type wavFile interface {
+	io.WriteCloser
+	io.WriterAt
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// wavWriter writes interleaved PCM samples to a Broadcast Wave file and
+// patches the header when closed
+type wavWriter struct {
+	file       wavFile
+	path       string
+	sampleRate int
+	channels   int
+	bits       int
+	dataBytes  int64
+	bext       BextInfo
+	ixml       *IXMLInfo // Written after the samples on Close, if set
+	markers    []Marker  // Written as cue points after the iXML chunk on Close
+	trailer    int64     // Bytes after the sample data, counted in the RIFF size
+	sum        hash.Hash // XXH64 of the sample data written so far
+	takeSum    hash.Hash // Shared by every file of a take, if set
+	unhashed   []byte    // Data of a failed write, hashed once discardTail settles how much stays
+}
+
+// createWAV creates a new WAV file with a placeholder header
+func createWAV(path string, sampleRate, channels, bits int) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wavWriter{
+		file:       file,
+		path:       path,
+		sampleRate: sampleRate,
+		channels:   channels,
+		bits:       bits,
+		bext:       BextInfo{Originator: "PI9696"},
+		sum:        xxhash.New(),
+	}
+
+	if _, err := file.Write(w.header()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write WAV header: %v", err)
+	}
+
+	return w, nil
+}
+
+// header builds the RIFF, bext, fmt and data chunk headers for the current data size
+func (w *wavWriter) header() []byte {
+	blockAlign := w.channels * w.bits / 8
+	// Sizes past 4 GiB saturate rather than wrap, so a reader never takes
+	// the file for a short one
+	riffSize := uint32(min(wavHeaderSize-8+w.dataBytes+w.trailer, math.MaxUint32))
+	dataSize := uint32(min(w.dataBytes, math.MaxUint32))
+
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:8], riffSize)
+	copy(h[8:12], "WAVE")
+
+	// Broadcast Wave extension chunk
+	b := h[12:]
+	copy(b[0:4], "bext")
+	binary.LittleEndian.PutUint32(b[4:8], bextChunkSize)
+	bext := b[8 : 8+bextChunkSize]
+	copy(bext[0:256], w.bext.Description)
+	copy(bext[256:288], w.bext.Originator)
+	copy(bext[288:320], w.bext.OriginatorReference)
+	if !w.bext.Origination.IsZero() {
+		copy(bext[320:330], w.bext.Origination.Format("2006-01-02"))
+		copy(bext[330:338], w.bext.Origination.Format("15:04:05"))
+	}
+	binary.LittleEndian.PutUint32(bext[338:342], uint32(w.bext.TimeReference))
+	binary.LittleEndian.PutUint32(bext[342:346], uint32(w.bext.TimeReference>>32))
+	binary.LittleEndian.PutUint16(bext[346:348], 1) // Version
+
+	f := b[8+bextChunkSize:]
+	copy(f[0:4], "fmt ")
+	binary.LittleEndian.PutUint32(f[4:8], 16)
+	binary.LittleEndian.PutUint16(f[8:10], 1) // PCM
+	binary.LittleEndian.PutUint16(f[10:12], uint16(w.channels))
+	binary.LittleEndian.PutUint32(f[12:16], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(f[16:20], uint32(w.sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(f[20:22], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(f[22:24], uint16(w.bits))
+	copy(f[24:28], "data")
+	binary.LittleEndian.PutUint32(f[28:32], dataSize)
+	return h
+}
+
+// Write appends sample data to the file, hashing it straight from p
+func (w *wavWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.dataBytes += int64(n)
+	if err != nil {
+		// The caller discards part of a failed write, so what stays is
+		// hashed by discardTail
+		w.unhashed = p[:n]
+		return n, err
+	}
+	w.hashData(p)
+	return n, nil
+}
+
+// hashData adds sample data kept in the file to its checksums
+func (w *wavWriter) hashData(p []byte) {
+	w.sum.Write(p)
+	if w.takeSum != nil {
+		w.takeSum.Write(p)
+	}
+}
+
+// dataXXH64 returns the XXH64 of the sample data written so far, in hex
+func (w *wavWriter) dataXXH64() string {
+	return hex.EncodeToString(w.sum.Sum(nil))
+}
+
+// discardTail drops the last n bytes of sample data, e.g. a partially written frame
+func (w *wavWriter) discardTail(n int) {
+	if w.unhashed != nil {
+		w.hashData(w.unhashed[:len(w.unhashed)-max(n, 0)])
+		w.unhashed = nil
+	}
+	if n <= 0 {
+		return
+	}
+	w.dataBytes -= int64(n)
+	w.file.Truncate(wavHeaderSize + w.dataBytes)
+	w.file.Seek(0, io.SeekEnd)
+}
+
+// ixmlChunk builds the iXML chunk that follows the sample data, padded so it
+// starts on a word boundary
+func (w *wavWriter) ixmlChunk() []byte {
+	body := w.ixml.encode()
+	pad := int(w.dataBytes % 2)
+	chunk := make([]byte, pad+8+len(body)+len(body)%2)
+	copy(chunk[pad:pad+4], "iXML")
+	binary.LittleEndian.PutUint32(chunk[pad+4:pad+8], uint32(len(body)))
+	copy(chunk[pad+8:], body)
+	return chunk
+}
+
+// Close writes the iXML chunk, patches the header with the final sizes and
+// closes the file
+func (w *wavWriter) Close() error {
+	if w.ixml != nil {
+		chunk := w.ixmlChunk()
+		if _, err := w.file.WriteAt(chunk, wavHeaderSize+w.dataBytes); err != nil {
+			w.file.Close()
+			return fmt.Errorf("failed to write iXML chunk: %v", err)
+		}
+		w.trailer = int64(len(chunk))
+	}
+	if len(w.markers) > 0 {
+		offset := wavHeaderSize + w.dataBytes + w.trailer
+		chunk := cueChunks(w.markers, offset%2 == 1)
+		if _, err := w.file.WriteAt(chunk, offset); err != nil {
+			w.file.Close()
+			return fmt.Errorf("failed to write cue chunk: %v", err)
+		}
+		w.trailer += int64(len(chunk))
+	}
+	if _, err := w.file.WriteAt(w.header(), 0); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to finalize WAV header: %v", err)
+	}
+	return w.file.Close()
+}
+
+// WAVInfo describes an existing WAV file
+type WAVInfo struct {
+	SampleRate    int
+	Channels      int
+	Bits          int
+	DataBytes     int64
+	DataOffset    int64 // Where the sample data starts in the file
+	HasBext       bool
+	TimeReference uint64
+}
+
+// Duration returns the playing time of the sample data
+func (i *WAVInfo) Duration() time.Duration {
+	bytesPerSec := int64(i.SampleRate * i.Channels * i.Bits / 8)
+	if bytesPerSec == 0 {
+		return 0
+	}
+	return time.Duration(i.DataBytes * int64(time.Second) / bytesPerSec)
+}
+
+// readWAVInfo walks the chunks of a WAV file and returns its format details
+func readWAVInfo(path string) (*WAVInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(file, riff); err != nil {
+		return nil, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%s is not a WAV file", path)
+	}
+
+	info := &WAVInfo{}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			break
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			fmtData := make([]byte, 16)
+			if _, err := io.ReadFull(file, fmtData); err != nil {
+				return nil, err
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(fmtData[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(fmtData[4:8]))
+			info.Bits = int(binary.LittleEndian.Uint16(fmtData[14:16]))
+			size -= 16
+		case "bext":
+			bext := make([]byte, 346)
+			if size >= 346 {
+				if _, err := io.ReadFull(file, bext); err != nil {
+					return nil, err
+				}
+				info.HasBext = true
+				info.TimeReference = uint64(binary.LittleEndian.Uint32(bext[338:342])) |
+					uint64(binary.LittleEndian.Uint32(bext[342:346]))<<32
+				size -= 346
+			}
+		case "data":
+			info.DataBytes = size
+			info.DataOffset, err = file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			return info, nil
+		}
+
+		// Chunks are word aligned
+		if _, err := file.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if info.SampleRate == 0 {
+		return nil, fmt.Errorf("%s has no fmt chunk", path)
+	}
+	return info, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "take.wav")
+	w, err := createWAV(path, 48000, 2, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.bext.TimeReference = 1<<32 + 5
+	w.bext.Origination = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	samples := testSamples(480)
+	if _, err := w.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, info := readSamples(t, path)
+	if info.SampleRate != 48000 || info.Channels != 2 || info.Bits != 32 {
+		t.Errorf("format %dHz %dch %d-bit, want 48000Hz 2ch 32-bit", info.SampleRate, info.Channels, info.Bits)
+	}
+	if !info.HasBext || info.TimeReference != 1<<32+5 {
+		t.Errorf("time reference %d (bext %v), want %d", info.TimeReference, info.HasBext, uint64(1<<32+5))
+	}
+	if info.DataOffset != wavHeaderSize {
+		t.Errorf("data at %d, want %d", info.DataOffset, wavHeaderSize)
+	}
+	if !bytes.Equal(data, samples) {
+		t.Error("sample data read back differs")
+	}
+	if got := info.Duration(); got != 10*time.Millisecond {
+		t.Errorf("Duration() = %v, want 10ms", got)
+	}
+}
+
+func TestWAVHeaderSizesSaturatePast4GiB(t *testing.T) {
+	for _, dataBytes := range []int64{math.MaxUint32 - wavHeaderSize + 8, math.MaxUint32, math.MaxUint32 + 1, 6 << 30} {
+		w := &wavWriter{sampleRate: 48000, channels: 2, bits: 32, dataBytes: dataBytes}
+		h := w.header()
+		riff := binary.LittleEndian.Uint32(h[4:8])
+		data := binary.LittleEndian.Uint32(h[wavHeaderSize-4:])
+		if riff != math.MaxUint32 {
+			t.Errorf("%d bytes of data: RIFF size %d, want %d", dataBytes, riff, uint32(math.MaxUint32))
+		}
+		if want := uint32(min(dataBytes, math.MaxUint32)); data != want {
+			t.Errorf("%d bytes of data: data size %d, want %d", dataBytes, data, want)
+		}
+	}
+}
+
+func TestWAVHeaderSizesBelowLimit(t *testing.T) {
+	w := &wavWriter{sampleRate: 48000, channels: 2, bits: 32, dataBytes: wavMaxDataBytes, trailer: wavTrailerRoom}
+	h := w.header()
+	if got, want := binary.LittleEndian.Uint32(h[4:8]), uint32(wavHeaderSize-8+wavMaxDataBytes+wavTrailerRoom); got != want {
+		t.Errorf("RIFF size %d, want %d", got, want)
+	}
+	if got := binary.LittleEndian.Uint32(h[wavHeaderSize-4:]); got != wavMaxDataBytes {
+		t.Errorf("data size %d, want %d", got, wavMaxDataBytes)
+	}
+}
+
+func TestReadWAVInfoRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.wav")
+	if err := os.WriteFile(path, []byte("not a wave file at all"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readWAVInfo(path); err == nil {
+		t.Error("readWAVInfo accepted a file that is not a WAV")
+	}
+}
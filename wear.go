@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pi9696/i18n"
+	"pi9696/schema"
+)
+
+const (
+	wearFlushInterval = time.Minute // At most this much writing is lost in a crash
+	usbStorageName    = "USB"
+	tb                = 1000 * 1000 * 1000 * 1000 // Card endurance is rated in decimal TB
+)
+
+// wearPath holds the write counters of each storage device
+var wearPath = filepath.Join(StateDir, schema.Wear.File)
+
+// wearFile is the on-disk form of the write counters
+type wearFile struct {
+	Version  int                     `json:"version"`
+	Counters map[string]*wearCounter `json:"counters"`
+}
+
+// wearCounter is the lifetime write total of one storage device
+type wearCounter struct {
+	BytesWritten uint64    `json:"bytes_written"`
+	RatedTBW     int       `json:"rated_tbw,omitempty"` // Endurance from the card's datasheet, 0 if unknown
+	Since        time.Time `json:"since"`               // When the counter was started or last reset
+}
+
+var (
+	// Counters have their own lock as the recorder and copy goroutines add to
+	// them while writing
+	wear        = make(map[string]*wearCounter)
+	wearDirty   = false
+	wearMutex   sync.Mutex
+	wearPending string // Storage a reset is being confirmed for
+
+	// wearFlushMutex keeps saves from overlapping
+	wearFlushMutex sync.Mutex
+)
+
+// loadWear reads the saved counters at startup
+func loadWear() {
+	data, err := os.ReadFile(wearPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read write counters: %v", err)
+		}
+		return
+	}
+	var file wearFile
+	_, err = schema.Wear.Decode(data, &file)
+	var newer *schema.NewerError
+	if errors.As(err, &newer) {
+		noteNewerState(wearPath, newer)
+	} else if err != nil {
+		log.Printf("Failed to parse %s, starting new write counters: %v", wearPath, err)
+		return
+	}
+	wearMutex.Lock()
+	defer wearMutex.Unlock()
+	if file.Counters != nil {
+		wear = file.Counters
+	}
+}
+
+// storageName returns the record target or USB drive a path is on
+func storageName(path string) string {
+	if pathsOverlap(USBMountPoint, path) {
+		return usbStorageName
+	}
+	for _, target := range recordTargets {
+		if pathsOverlap(target.Path, path) {
+			return target.Name
+		}
+	}
+	return ""
+}
+
+// countWritten adds n bytes written to path to its device's counter
+func countWritten(path string, n int) {
+	name := storageName(path)
+	if name == "" || n <= 0 {
+		return
+	}
+	wearMutex.Lock()
+	defer wearMutex.Unlock()
+	c := wear[name]
+	if c == nil {
+		c = &wearCounter{Since: time.Now()}
+		wear[name] = c
+	}
+	c.BytesWritten += uint64(n)
+	wearDirty = true
+}
+
+// wearOf returns a copy of a device's counter
+func wearOf(name string) wearCounter {
+	wearMutex.Lock()
+	defer wearMutex.Unlock()
+	if c := wear[name]; c != nil {
+		return *c
+	}
+	return wearCounter{}
+}
+
+// updateWear changes a device's counter and saves it in the background
+func updateWear(name string, change func(c *wearCounter)) {
+	wearMutex.Lock()
+	c := wear[name]
+	if c == nil {
+		c = &wearCounter{Since: time.Now()}
+		wear[name] = c
+	}
+	change(c)
+	wearDirty = true
+	wearMutex.Unlock()
+	go flushWear()
+}
+
+// flushWear saves the counters if they have changed
+func flushWear() {
+	wearFlushMutex.Lock()
+	defer wearFlushMutex.Unlock()
+
+	wearMutex.Lock()
+	if !wearDirty || !stateWritable() {
+		wearMutex.Unlock()
+		return
+	}
+	data, err := json.MarshalIndent(wearFile{Version: schema.Wear.Version, Counters: wear}, "", "  ")
+	wearDirty = false
+	wearMutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to encode write counters: %v", err)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(wearPath), 0755)
+	if err == nil {
+		tmp := wearPath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, wearPath)
+		}
+	}
+	if err != nil {
+		noteWriteError(wearPath, "write counters", err)
+		log.Printf("Failed to save write counters: %v", err)
+		wearMutex.Lock()
+		wearDirty = true
+		wearMutex.Unlock()
+	}
+}
+
+// wearLoop saves the counters periodically so a crash loses little
+func wearLoop() {
+	ticker := time.NewTicker(wearFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushWear()
+	}
+}
+
+// wearStorageNames lists the devices shown on the storage health screen
+func wearStorageNames() []string {
+	var names []string
+	for _, target := range recordTargets {
+		names = append(names, target.Name)
+	}
+	names = append(names, usbStorageName)
+	return names
+}
+
+// formatWritten shows a byte count in decimal units, as cards are rated
+func formatWritten(n uint64) string {
+	switch {
+	case n >= tb:
+		return fmt.Sprintf("%.1f TB", float64(n)/tb)
+	case n >= tb/1000:
+		return fmt.Sprintf("%.1f GB", float64(n)/(tb/1000))
+	}
+	return fmt.Sprintf("%d MB", n/(1000*1000))
+}
+
+// enduranceLeft returns the percentage of rated endurance left, or -1 when
+// no rating is set
+func (c wearCounter) enduranceLeft() int {
+	if c.RatedTBW <= 0 {
+		return -1
+	}
+	left := 100 - int(float64(c.BytesWritten)*100/(float64(c.RatedTBW)*tb))
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
+// adjustRatedTBW steps a device's rated endurance: 10TB steps up to 100TB,
+// then 50TB steps, with 0 for unknown
+func adjustRatedTBW(name string, direction int) {
+	updateWear(name, func(c *wearCounter) {
+		step := 10
+		if c.RatedTBW > 100 || (c.RatedTBW == 100 && direction > 0) {
+			step = 50
+		}
+		c.RatedTBW += direction * step
+		if c.RatedTBW < 0 {
+			c.RatedTBW = 0
+		}
+	})
+}
+
+// confirmWearReset asks before zeroing a device's counter. Must be called
+// with mutex held.
+func confirmWearReset(name string) {
+	wearPending = name
+	menuMode = WearResetConfirm
+	currentState = StateConfirm
+	confirmOption = ConfirmNo
+}
+
+// resetWear starts a device's counter again, e.g. after the card is replaced
+func resetWear(name string) {
+	updateWear(name, func(c *wearCounter) {
+		log.Printf("Write counter for %s reset at %s", name, formatWritten(c.BytesWritten))
+		*c = wearCounter{Since: time.Now()}
+	})
+}
+
+// storageHealthMenuItems shows the last maintenance run, then the write
+// total of each device, with its rated endurance and a reset for when the
+// card is replaced
+func storageHealthMenuItems() []menuItem {
+	items := []menuItem{{Label: i18n.T("maintenance.label"), Value: maintenanceText, Action: maintenanceDetails}}
+	for _, name := range wearStorageNames() {
+		name := name
+		items = append(items,
+			menuItem{Label: i18n.Tf("wear.written", name), Value: func() string {
+				c := wearOf(name)
+				text := formatWritten(c.BytesWritten)
+				if left := c.enduranceLeft(); left >= 0 {
+					text += fmt.Sprintf(" · %d%%", left)
+				}
+				return text
+			}},
+			menuItem{Label: i18n.Tf("wear.rated", name), Value: func() string {
+				if rated := wearOf(name).RatedTBW; rated > 0 {
+					return fmt.Sprintf("%d TB", rated)
+				}
+				return i18n.T("common.off")
+			}, Adjust: func(direction int) { adjustRatedTBW(name, direction) }},
+			menuItem{Label: i18n.Tf("wear.reset", name), Action: func() { confirmWearReset(name) }},
+		)
+	}
+	items = append(items, menuItem{Label: i18n.T("common.back"), Action: func() { openMenu(StateSystemOptions) }})
+	return items
+}